@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// response urbs-setting 接口的标准返回数据，与 tpl.ResponseType 对应
+type response struct {
+	Error         string          `json:"error"`
+	Message       string          `json:"message"`
+	TotalSize     int             `json:"totalSize"`
+	NextPageToken string          `json:"nextPageToken"`
+	Result        json.RawMessage `json:"result"`
+	StatusCode    int             `json:"-"`
+}
+
+// apiError 接口返回的错误
+type apiError struct {
+	StatusCode int
+	Err        string
+	Message    string
+}
+
+func (e *apiError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("%d %s: %s", e.StatusCode, e.Err, e.Message)
+	}
+	return fmt.Sprintf("%d %s", e.StatusCode, e.Err)
+}
+
+type client struct {
+	profile *Profile
+	http    *http.Client
+}
+
+func newClient(p *Profile) *client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if p.Insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return &client{
+		profile: p,
+		http:    &http.Client{Transport: transport, Timeout: 60 * time.Second},
+	}
+}
+
+// do 请求接口，body 不为 nil 时以 JSON 发送，非 2xx 响应返回 *apiError
+func (c *client) do(method, path string, query url.Values, body interface{}) (*response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	raw, status, err := c.send(method, path, query, "application/json", reader)
+	if err != nil {
+		return nil, err
+	}
+	return decodeResponse(method, path, raw, status)
+}
+
+// upload 以流的方式发送 body，不限制请求时长，用于上传大文件
+func (c *client) upload(path string, query url.Values, contentType string, body io.Reader) (*response, error) {
+	uc := *c
+	uc.http = &http.Client{Transport: c.http.Transport}
+	raw, status, err := uc.send(http.MethodPost, path, query, contentType, body)
+	if err != nil {
+		return nil, err
+	}
+	return decodeResponse(http.MethodPost, path, raw, status)
+}
+
+func decodeResponse(method, path string, raw []byte, status int) (*response, error) {
+	out := &response{StatusCode: status}
+	if len(bytes.TrimSpace(raw)) > 0 {
+		if err := json.Unmarshal(raw, out); err != nil {
+			return nil, fmt.Errorf("invalid response from %s %s: %v", method, path, err)
+		}
+	}
+	return out, nil
+}
+
+// send 请求接口并返回原始的响应体，body 不为 nil 时按 contentType 发送，非 2xx 响应返回 *apiError
+func (c *client) send(method, path string, query url.Values, contentType string, body io.Reader) ([]byte, int, error) {
+	u := strings.TrimRight(c.profile.Server, "/") + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, 0, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "urbsctl")
+	auth, err := c.profile.authorization(time.Now())
+	if err != nil {
+		return nil, 0, err
+	}
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer res.Body.Close()
+	raw, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if res.StatusCode >= 300 {
+		out := &response{}
+		json.Unmarshal(raw, out)
+		e := &apiError{StatusCode: res.StatusCode, Err: out.Error, Message: out.Message}
+		if e.Err == "" {
+			e.Err = http.StatusText(res.StatusCode)
+		}
+		return nil, res.StatusCode, e
+	}
+	return raw, res.StatusCode, nil
+}
+
+// listAll 请求列表接口，all 为 true 时按 nextPageToken 读取全部分页并合并结果
+func (c *client) listAll(path string, query url.Values, all bool) (*response, error) {
+	res, err := c.do(http.MethodGet, path, query, nil)
+	if err != nil || !all {
+		return res, err
+	}
+
+	items := []json.RawMessage{}
+	for {
+		page := []json.RawMessage{}
+		if len(res.Result) > 0 {
+			if err := json.Unmarshal(res.Result, &page); err != nil {
+				return nil, fmt.Errorf("invalid list response from %s: %v", path, err)
+			}
+		}
+		items = append(items, page...)
+		if res.NextPageToken == "" {
+			break
+		}
+		q := url.Values{}
+		for k, v := range query {
+			q[k] = v
+		}
+		q.Set("pageToken", res.NextPageToken)
+		if res, err = c.do(http.MethodGet, path, q, nil); err != nil {
+			return nil, err
+		}
+	}
+	data, err := json.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+	return &response{TotalSize: len(items), Result: data, StatusCode: http.StatusOK}, nil
+}
+
+// pathf 拼接接口路径，参数按路径片段转义
+func pathf(format string, args ...string) string {
+	escaped := make([]interface{}, len(args))
+	for i, a := range args {
+		escaped[i] = url.PathEscape(a)
+	}
+	return fmt.Sprintf(format, escaped...)
+}
@@ -0,0 +1,538 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+var (
+	productColumns = []string{"name", "desc", "protected", "status", "createdAt", "offlineAt"}
+	labelColumns   = []string{"hid", "name", "desc", "channels", "clients", "status", "exactStatus", "release", "createdAt"}
+	settingColumns = []string{"hid", "module", "name", "desc", "channels", "clients", "values", "status", "exactStatus", "release", "createdAt"}
+	ruleColumns    = []string{"hid", "kind", "rule", "value", "release", "updatedAt"}
+)
+
+var rootCommand = &command{
+	Name: "urbsctl",
+	Desc: "urbsctl manages urbs-setting through its /v1 API.",
+	Subs: []*command{
+		productsCommand,
+		modulesCommand,
+		settingsCommand,
+		labelsCommand,
+		usersCommand,
+		groupsCommand,
+		membersCommand,
+		jobsCommand,
+		rulesCommand,
+		configCommand,
+		completionCommand,
+	},
+}
+
+var productsCommand = &command{
+	Name: "products",
+	Desc: "List and manage products",
+	Subs: []*command{
+		{
+			Name: "list", Desc: "List products", MaxArgs: 0,
+			Setup: func(fs *flag.FlagSet) func(c *cli, args []string) error {
+				lo := registerListOptions(fs)
+				return func(c *cli, args []string) error {
+					return c.list("/v1/products", lo, nil, productColumns)
+				}
+			},
+		},
+		{
+			Name: "create", Args: "NAME", Desc: "Create a product", MinArgs: 1, MaxArgs: 1,
+			Setup: func(fs *flag.FlagSet) func(c *cli, args []string) error {
+				desc := fs.String("desc", "", "product description")
+				return func(c *cli, args []string) error {
+					body := map[string]interface{}{"name": args[0], "desc": *desc}
+					return c.call(http.MethodPost, "/v1/products", nil, body, productColumns)
+				}
+			},
+		},
+		{
+			Name: "update", Args: "PRODUCT", Desc: "Update a product's description or protected flag", MinArgs: 1, MaxArgs: 1,
+			Setup: func(fs *flag.FlagSet) func(c *cli, args []string) error {
+				desc := &optString{}
+				protected := &optBool{}
+				fs.Var(desc, "desc", "product description")
+				fs.Var(protected, "protected", "require approval for key writes on the product (owner only)")
+				return func(c *cli, args []string) error {
+					body := map[string]interface{}{}
+					desc.putTo(body, "desc")
+					protected.putTo(body, "protected")
+					if len(body) == 0 {
+						return usageErrorf("-desc or -protected required")
+					}
+					return c.call(http.MethodPut, pathf("/v1/products/%s", args[0]), nil, body, productColumns)
+				}
+			},
+		},
+		pathCommand("offline", "PRODUCT", "Take a product offline", http.MethodPut, "/v1/products/%s:offline", nil),
+		pathCommand("delete", "PRODUCT", "Delete an offline product", http.MethodDelete, "/v1/products/%s", nil),
+		pathCommand("stats", "PRODUCT", "Show product statistics", http.MethodGet, "/v1/products/%s/statistics", nil),
+		exportCommand,
+		planCommand,
+		applyCommand,
+		cloneCommand,
+		promoteCommand,
+	},
+}
+
+var modulesCommand = &command{
+	Name: "modules",
+	Desc: "List and manage modules",
+	Subs: []*command{
+		{
+			Name: "list", Args: "PRODUCT", Desc: "List modules of a product", MinArgs: 1, MaxArgs: 1,
+			Setup: func(fs *flag.FlagSet) func(c *cli, args []string) error {
+				lo := registerListOptions(fs)
+				return func(c *cli, args []string) error {
+					return c.list(pathf("/v1/products/%s/modules", args[0]), lo, nil, nil)
+				}
+			},
+		},
+		{
+			Name: "create", Args: "PRODUCT NAME", Desc: "Create a module", MinArgs: 2, MaxArgs: 2,
+			Setup: func(fs *flag.FlagSet) func(c *cli, args []string) error {
+				desc := fs.String("desc", "", "module description")
+				return func(c *cli, args []string) error {
+					body := map[string]interface{}{"name": args[1], "desc": *desc}
+					return c.call(http.MethodPost, pathf("/v1/products/%s/modules", args[0]), nil, body, nil)
+				}
+			},
+		},
+		{
+			Name: "update", Args: "PRODUCT MODULE", Desc: "Update a module's description", MinArgs: 2, MaxArgs: 2,
+			Setup: func(fs *flag.FlagSet) func(c *cli, args []string) error {
+				desc := &optString{}
+				fs.Var(desc, "desc", "module description")
+				return func(c *cli, args []string) error {
+					body := map[string]interface{}{}
+					desc.putTo(body, "desc")
+					if len(body) == 0 {
+						return usageErrorf("-desc required")
+					}
+					return c.call(http.MethodPut, pathf("/v1/products/%s/modules/%s", args[0], args[1]), nil, body, nil)
+				}
+			},
+		},
+		pathCommand("offline", "PRODUCT MODULE", "Take a module offline", http.MethodPut, "/v1/products/%s/modules/%s:offline", nil),
+	},
+}
+
+var settingsCommand = &command{
+	Name: "settings",
+	Desc: "List and manage settings, assign or recall them for users and groups",
+	Subs: []*command{
+		{
+			Name: "list", Args: "PRODUCT [MODULE]", Desc: "List settings of a product or a module", MinArgs: 1, MaxArgs: 2,
+			Setup: func(fs *flag.FlagSet) func(c *cli, args []string) error {
+				lo := registerListOptions(fs)
+				return func(c *cli, args []string) error {
+					if len(args) == 1 {
+						return c.list(pathf("/v1/products/%s/settings", args[0]), lo, nil, settingColumns)
+					}
+					return c.list(pathf("/v1/products/%s/modules/%s/settings", args[0], args[1]), lo, nil, settingColumns)
+				}
+			},
+		},
+		pathCommand("get", "PRODUCT MODULE SETTING", "Show a setting", http.MethodGet,
+			"/v1/products/%s/modules/%s/settings/%s", settingColumns),
+		{
+			Name: "create", Args: "PRODUCT MODULE NAME", Desc: "Create a setting", MinArgs: 3, MaxArgs: 3,
+			Setup: func(fs *flag.FlagSet) func(c *cli, args []string) error {
+				attrs := registerAttrs(fs, true)
+				return func(c *cli, args []string) error {
+					body := attrs.body()
+					body["name"] = args[2]
+					return c.call(http.MethodPost, pathf("/v1/products/%s/modules/%s/settings", args[0], args[1]),
+						nil, body, settingColumns)
+				}
+			},
+		},
+		{
+			Name: "update", Args: "PRODUCT MODULE SETTING", Desc: "Update a setting", MinArgs: 3, MaxArgs: 3,
+			Setup: func(fs *flag.FlagSet) func(c *cli, args []string) error {
+				attrs := registerAttrs(fs, true)
+				return func(c *cli, args []string) error {
+					body := attrs.body()
+					if len(body) == 0 {
+						return usageErrorf("-desc, -channels, -clients or -values required")
+					}
+					return c.call(http.MethodPut, pathf("/v1/products/%s/modules/%s/settings/%s", args[0], args[1], args[2]),
+						nil, body, settingColumns)
+				}
+			},
+		},
+		pathCommand("offline", "PRODUCT MODULE SETTING", "Take a setting offline", http.MethodPut,
+			"/v1/products/%s/modules/%s/settings/%s:offline", nil),
+		pathCommand("cleanup", "PRODUCT MODULE SETTING", "Remove the setting from all users and groups", http.MethodDelete,
+			"/v1/products/%s/modules/%s/settings/%s:cleanup", nil),
+		{
+			Name: "assign", Args: "PRODUCT MODULE SETTING", Desc: "Assign a setting value to users and groups", MinArgs: 3, MaxArgs: 3,
+			Setup: func(fs *flag.FlagSet) func(c *cli, args []string) error {
+				value := fs.String("value", "", "setting value")
+				targets := registerTargets(fs)
+				return func(c *cli, args []string) error {
+					body, err := targets.body(c)
+					if err != nil {
+						return err
+					}
+					body["value"] = *value
+					return c.call(http.MethodPost, pathf("/v1/products/%s/modules/%s/settings/%s:assign", args[0], args[1], args[2]),
+						nil, body, nil)
+				}
+			},
+		},
+		recallCommand("PRODUCT MODULE SETTING", "/v1/products/%s/modules/%s/settings/%s:recall"),
+		listPathCommand("users", "PRODUCT MODULE SETTING", "List users assigned the setting",
+			"/v1/products/%s/modules/%s/settings/%s/users"),
+		listPathCommand("groups", "PRODUCT MODULE SETTING", "List groups assigned the setting",
+			"/v1/products/%s/modules/%s/settings/%s/groups"),
+	},
+}
+
+var labelsCommand = &command{
+	Name: "labels",
+	Desc: "List and manage labels, assign or recall them for users and groups",
+	Subs: []*command{
+		{
+			Name: "list", Args: "PRODUCT", Desc: "List labels of a product", MinArgs: 1, MaxArgs: 1,
+			Setup: func(fs *flag.FlagSet) func(c *cli, args []string) error {
+				lo := registerListOptions(fs)
+				return func(c *cli, args []string) error {
+					return c.list(pathf("/v1/products/%s/labels", args[0]), lo, nil, labelColumns)
+				}
+			},
+		},
+		{
+			Name: "create", Args: "PRODUCT NAME", Desc: "Create a label", MinArgs: 2, MaxArgs: 2,
+			Setup: func(fs *flag.FlagSet) func(c *cli, args []string) error {
+				attrs := registerAttrs(fs, false)
+				return func(c *cli, args []string) error {
+					body := attrs.body()
+					body["name"] = args[1]
+					return c.call(http.MethodPost, pathf("/v1/products/%s/labels", args[0]), nil, body, labelColumns)
+				}
+			},
+		},
+		{
+			Name: "update", Args: "PRODUCT LABEL", Desc: "Update a label", MinArgs: 2, MaxArgs: 2,
+			Setup: func(fs *flag.FlagSet) func(c *cli, args []string) error {
+				attrs := registerAttrs(fs, false)
+				return func(c *cli, args []string) error {
+					body := attrs.body()
+					if len(body) == 0 {
+						return usageErrorf("-desc, -channels or -clients required")
+					}
+					return c.call(http.MethodPut, pathf("/v1/products/%s/labels/%s", args[0], args[1]), nil, body, labelColumns)
+				}
+			},
+		},
+		pathCommand("offline", "PRODUCT LABEL", "Take a label offline", http.MethodPut, "/v1/products/%s/labels/%s:offline", nil),
+		pathCommand("delete", "PRODUCT LABEL", "Delete an offline label", http.MethodDelete, "/v1/products/%s/labels/%s", nil),
+		pathCommand("cleanup", "PRODUCT LABEL", "Remove the label from all users and groups", http.MethodDelete,
+			"/v1/products/%s/labels/%s:cleanup", nil),
+		{
+			Name: "assign", Args: "PRODUCT LABEL", Desc: "Assign a label to users and groups", MinArgs: 2, MaxArgs: 2,
+			Setup: func(fs *flag.FlagSet) func(c *cli, args []string) error {
+				targets := registerTargets(fs)
+				return func(c *cli, args []string) error {
+					body, err := targets.body(c)
+					if err != nil {
+						return err
+					}
+					return c.call(http.MethodPost, pathf("/v1/products/%s/labels/%s:assign", args[0], args[1]), nil, body, nil)
+				}
+			},
+		},
+		recallCommand("PRODUCT LABEL", "/v1/products/%s/labels/%s:recall"),
+		listPathCommand("users", "PRODUCT LABEL", "List users assigned the label", "/v1/products/%s/labels/%s/users"),
+		listPathCommand("groups", "PRODUCT LABEL", "List groups assigned the label", "/v1/products/%s/labels/%s/groups"),
+	},
+}
+
+var groupsCommand = &command{
+	Name: "groups",
+	Desc: "List and manage groups",
+	Subs: []*command{
+		{
+			Name: "list", Desc: "List groups", MaxArgs: 0,
+			Setup: func(fs *flag.FlagSet) func(c *cli, args []string) error {
+				lo := registerListOptions(fs)
+				kind := fs.String("kind", "", "only list groups of the kind")
+				return func(c *cli, args []string) error {
+					return c.list("/v1/groups", lo, kindQuery(*kind), nil)
+				}
+			},
+		},
+		{
+			Name: "create", Args: "UID", Desc: "Create a group", MinArgs: 1, MaxArgs: 1,
+			Setup: func(fs *flag.FlagSet) func(c *cli, args []string) error {
+				kind := fs.String("kind", "", "group kind, required")
+				desc := fs.String("desc", "", "group description")
+				return func(c *cli, args []string) error {
+					if *kind == "" {
+						return usageErrorf("-kind required")
+					}
+					body := map[string]interface{}{
+						"groups": []map[string]string{{"uid": args[0], "kind": *kind, "desc": *desc}},
+					}
+					return c.call(http.MethodPost, "/v1/groups:batch", nil, body, nil)
+				}
+			},
+		},
+		{
+			Name: "update", Args: "UID", Desc: "Update a group's description", MinArgs: 1, MaxArgs: 1,
+			Setup: func(fs *flag.FlagSet) func(c *cli, args []string) error {
+				kind := fs.String("kind", "", "group kind")
+				desc := &optString{}
+				fs.Var(desc, "desc", "group description")
+				return func(c *cli, args []string) error {
+					body := map[string]interface{}{}
+					desc.putTo(body, "desc")
+					if len(body) == 0 {
+						return usageErrorf("-desc required")
+					}
+					return c.call(http.MethodPut, pathf("/v1/groups/%s", args[0]), kindQuery(*kind), body, nil)
+				}
+			},
+		},
+		{
+			Name: "delete", Args: "UID", Desc: "Delete a group", MinArgs: 1, MaxArgs: 1,
+			Setup: func(fs *flag.FlagSet) func(c *cli, args []string) error {
+				kind := fs.String("kind", "", "group kind")
+				return func(c *cli, args []string) error {
+					return c.call(http.MethodDelete, pathf("/v1/groups/%s", args[0]), kindQuery(*kind), nil, nil)
+				}
+			},
+		},
+		importCommand("", "Import groups from a CSV (uid, kind and optional desc columns) or NDJSON file", "/v1/groups:import", false),
+	},
+}
+
+var membersCommand = &command{
+	Name: "members",
+	Desc: "List and manage group members",
+	Subs: []*command{
+		{
+			Name: "list", Args: "GROUP", Desc: "List members of a group", MinArgs: 1, MaxArgs: 1,
+			Setup: func(fs *flag.FlagSet) func(c *cli, args []string) error {
+				lo := registerListOptions(fs)
+				kind := fs.String("kind", "", "group kind")
+				return func(c *cli, args []string) error {
+					return c.list(pathf("/v1/groups/%s/members", args[0]), lo, kindQuery(*kind), nil)
+				}
+			},
+		},
+		{
+			Name: "add", Args: "GROUP", Desc: "Add users to a group", MinArgs: 1, MaxArgs: 1,
+			Setup: func(fs *flag.FlagSet) func(c *cli, args []string) error {
+				kind := fs.String("kind", "", "group kind")
+				users := &uidsInput{}
+				users.register(fs, "users", "user")
+				return func(c *cli, args []string) error {
+					uids, err := users.read(c)
+					if err != nil {
+						return err
+					}
+					if len(uids) == 0 {
+						return usageErrorf("-users or -users-file required")
+					}
+					body := map[string]interface{}{"users": uids}
+					return c.call(http.MethodPost, pathf("/v1/groups/%s/members:batch", args[0]), kindQuery(*kind), body, nil)
+				}
+			},
+		},
+		{
+			Name: "remove", Args: "GROUP", Desc: "Remove a member, or all members synced before -sync-lt", MinArgs: 1, MaxArgs: 1,
+			Setup: func(fs *flag.FlagSet) func(c *cli, args []string) error {
+				kind := fs.String("kind", "", "group kind")
+				user := fs.String("user", "", "uid of the member to remove")
+				syncLt := fs.Int64("sync-lt", 0, "remove all members whose sync time is less than the unix timestamp")
+				return func(c *cli, args []string) error {
+					if (*user == "") == (*syncLt == 0) {
+						return usageErrorf("either -user or -sync-lt required")
+					}
+					q := kindQuery(*kind)
+					if *user != "" {
+						q.Set("user", *user)
+					} else {
+						q.Set("syncLt", strconv.FormatInt(*syncLt, 10))
+					}
+					return c.call(http.MethodDelete, pathf("/v1/groups/%s/members", args[0]), q, nil, nil)
+				}
+			},
+		},
+		importCommand("GROUP", "Import members of a group from a CSV (uid column) or NDJSON file", "/v1/groups/%s/members:import", true),
+	},
+}
+
+var rulesCommand = &command{
+	Name: "rules",
+	Desc: "Manage percent rules of labels (PRODUCT LABEL) and settings (PRODUCT MODULE SETTING)",
+	Subs: []*command{
+		{
+			Name: "list", Args: "PRODUCT LABEL | PRODUCT MODULE SETTING", Desc: "List rules", MinArgs: 2, MaxArgs: 3,
+			Setup: func(fs *flag.FlagSet) func(c *cli, args []string) error {
+				return func(c *cli, args []string) error {
+					return c.call(http.MethodGet, rulesPath(args), nil, nil, ruleColumns)
+				}
+			},
+		},
+		{
+			Name: "create", Args: "PRODUCT LABEL | PRODUCT MODULE SETTING", Desc: "Create a rule", MinArgs: 2, MaxArgs: 3,
+			Setup: func(fs *flag.FlagSet) func(c *cli, args []string) error {
+				rule := registerRule(fs)
+				return func(c *cli, args []string) error {
+					body, err := rule.body(len(args) == 3)
+					if err != nil {
+						return err
+					}
+					return c.call(http.MethodPost, rulesPath(args), nil, body, ruleColumns)
+				}
+			},
+		},
+		{
+			Name: "update", Args: "PRODUCT LABEL HID | PRODUCT MODULE SETTING HID", Desc: "Update a rule", MinArgs: 3, MaxArgs: 4,
+			Setup: func(fs *flag.FlagSet) func(c *cli, args []string) error {
+				rule := registerRule(fs)
+				return func(c *cli, args []string) error {
+					target, hid := args[:len(args)-1], args[len(args)-1]
+					body, err := rule.body(len(target) == 3)
+					if err != nil {
+						return err
+					}
+					return c.call(http.MethodPut, rulesPath(target)+"/"+url.PathEscape(hid), nil, body, ruleColumns)
+				}
+			},
+		},
+		{
+			Name: "delete", Args: "PRODUCT LABEL HID | PRODUCT MODULE SETTING HID", Desc: "Delete a rule", MinArgs: 3, MaxArgs: 4,
+			Setup: func(fs *flag.FlagSet) func(c *cli, args []string) error {
+				return func(c *cli, args []string) error {
+					target, hid := args[:len(args)-1], args[len(args)-1]
+					return c.call(http.MethodDelete, rulesPath(target)+"/"+url.PathEscape(hid), nil, nil, nil)
+				}
+			},
+		},
+	},
+}
+
+// pathCommand 创建只需要路径参数的命令，参数个数由 format 中的 %s 决定
+func pathCommand(name, args, desc, method, format string, columns []string) *command {
+	n := countVerbs(format)
+	return &command{
+		Name: name, Args: args, Desc: desc, MinArgs: n, MaxArgs: n,
+		Setup: func(fs *flag.FlagSet) func(c *cli, args []string) error {
+			return func(c *cli, args []string) error {
+				return c.call(method, pathf(format, args...), nil, nil, columns)
+			}
+		},
+	}
+}
+
+// listPathCommand 创建只需要路径参数的分页列表命令
+func listPathCommand(name, args, desc, format string) *command {
+	n := countVerbs(format)
+	return &command{
+		Name: name, Args: args, Desc: desc, MinArgs: n, MaxArgs: n,
+		Setup: func(fs *flag.FlagSet) func(c *cli, args []string) error {
+			lo := registerListOptions(fs)
+			return func(c *cli, args []string) error {
+				return c.list(pathf(format, args...), lo, nil, nil)
+			}
+		},
+	}
+}
+
+// recallCommand 创建按 release 撤销环境标签或配置项的命令
+func recallCommand(args, format string) *command {
+	n := countVerbs(format)
+	return &command{
+		Name: "recall", Args: args, Desc: "Recall a release of assignments", MinArgs: n, MaxArgs: n,
+		Setup: func(fs *flag.FlagSet) func(c *cli, args []string) error {
+			release := fs.Int64("release", 0, "release to recall, required")
+			return func(c *cli, args []string) error {
+				if *release <= 0 {
+					return usageErrorf("-release required")
+				}
+				body := map[string]interface{}{"release": *release}
+				return c.call(http.MethodPost, pathf(format, args...), nil, body, nil)
+			}
+		},
+	}
+}
+
+func rulesPath(args []string) string {
+	if len(args) == 3 {
+		return pathf("/v1/products/%s/modules/%s/settings/%s/rules", args...)
+	}
+	return pathf("/v1/products/%s/labels/%s/rules", args...)
+}
+
+func kindQuery(kind string) url.Values {
+	q := url.Values{}
+	if kind != "" {
+		q.Set("kind", kind)
+	}
+	return q
+}
+
+func countVerbs(format string) int {
+	n := 0
+	for i := 0; i+1 < len(format); i++ {
+		if format[i] == '%' && format[i+1] == 's' {
+			n++
+		}
+	}
+	return n
+}
+
+// api 返回按 profile 创建的接口客户端
+func (c *cli) api() (*client, error) {
+	if c.client == nil {
+		p, err := c.opts.resolveProfile()
+		if err != nil {
+			return nil, err
+		}
+		c.client = newClient(p)
+	}
+	return c.client, nil
+}
+
+// call 请求接口并输出结果，受保护产品上的操作返回 202 时提示变更申请待审批
+func (c *cli) call(method, path string, query url.Values, body interface{}, columns []string) error {
+	cl, err := c.api()
+	if err != nil {
+		return err
+	}
+	res, err := cl.do(method, path, query, body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode == http.StatusAccepted {
+		fmt.Fprintln(c.stderr, "the product is protected, a change request was created and is pending approval")
+	}
+	return c.printResult(res, columns)
+}
+
+// list 请求分页列表接口并输出结果
+func (c *cli) list(path string, lo *listOptions, query url.Values, columns []string) error {
+	cl, err := c.api()
+	if err != nil {
+		return err
+	}
+	res, err := cl.listAll(path, lo.query(query), lo.all)
+	if err != nil {
+		return err
+	}
+	return c.printResult(res, columns)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+const bashCompletion = `# bash completion for urbsctl, load it with: source <(urbsctl completion bash)
+_urbsctl() {
+    local IFS=$'\n'
+    COMPREPLY=( $(urbsctl __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null) )
+}
+complete -o default -F _urbsctl urbsctl
+`
+
+const zshCompletion = `# zsh completion for urbsctl, load it with: source <(urbsctl completion zsh)
+_urbsctl() {
+    local -a candidates
+    candidates=(${(f)"$(urbsctl __complete "${(@)words[2,CURRENT]}" 2>/dev/null)"})
+    if (( ${#candidates} )); then
+        compadd -a candidates
+    else
+        _files
+    fi
+}
+compdef _urbsctl urbsctl
+`
+
+var completionCommand = &command{
+	Name: "completion", Args: "bash|zsh", Desc: "Print the shell completion script", MinArgs: 1, MaxArgs: 1,
+	Setup: func(fs *flag.FlagSet) func(c *cli, args []string) error {
+		return func(c *cli, args []string) error {
+			switch args[0] {
+			case "bash":
+				_, err := fmt.Fprint(c.stdout, bashCompletion)
+				return err
+			case "zsh":
+				_, err := fmt.Fprint(c.stdout, zshCompletion)
+				return err
+			default:
+				return usageErrorf("unsupported shell %q, should be bash or zsh", args[0])
+			}
+		}
+	},
+}
+
+func init() {
+	// completeCommand 引用了 rootCommand，在 init 中注册以避免初始化循环
+	rootCommand.Subs = append(rootCommand.Subs, completeCommand)
+}
+
+// completeCommand 供补全脚本调用，参数为已输入的单词，最后一个为正在输入的单词
+var completeCommand = &command{
+	Name: "__complete", Hidden: true, RawArgs: true, MaxArgs: -1,
+	Setup: func(fs *flag.FlagSet) func(c *cli, args []string) error {
+		return func(c *cli, args []string) error {
+			for _, s := range complete(rootCommand, args) {
+				fmt.Fprintln(c.stdout, s)
+			}
+			return nil
+		}
+	},
+}
+
+// complete 返回补全候选项：正在输入 flag 时返回当前命令的 flags，否则返回子命令，
+// 位置参数和 flag 值返回空，由 shell 补全文件名
+func complete(root *command, words []string) []string {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	cur, prev := words[len(words)-1], words[:len(words)-1]
+
+	cmd := root
+	fs := commandFlagSet(cmd)
+	inArgs := false
+	for i := 0; i < len(prev) && !inArgs; i++ {
+		w := prev[i]
+		if w == "--" {
+			return nil
+		}
+		if strings.HasPrefix(w, "-") {
+			if flagTakesValue(fs, w) {
+				i++
+			}
+			continue
+		}
+		sub := cmd.sub(w)
+		if sub == nil {
+			// 已进入位置参数
+			inArgs = true
+			continue
+		}
+		cmd = sub
+		fs = commandFlagSet(cmd)
+	}
+	if len(prev) > 0 && strings.HasPrefix(prev[len(prev)-1], "-") && flagTakesValue(fs, prev[len(prev)-1]) {
+		return nil
+	}
+
+	candidates := []string{}
+	if strings.HasPrefix(cur, "-") {
+		fs.VisitAll(func(f *flag.Flag) {
+			name := "-" + f.Name
+			if strings.HasPrefix(cur, "--") {
+				name = "-" + name
+			}
+			if strings.HasPrefix(name, cur) {
+				candidates = append(candidates, name)
+			}
+		})
+		sort.Strings(candidates)
+		return candidates
+	}
+	if inArgs {
+		return nil
+	}
+	for _, s := range cmd.Subs {
+		if !s.Hidden && strings.HasPrefix(s.Name, cur) {
+			candidates = append(candidates, s.Name)
+		}
+	}
+	return candidates
+}
+
+func commandFlagSet(cmd *command) *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	(&globalOptions{}).register(fs)
+	if cmd.Setup != nil {
+		cmd.Setup(fs)
+	}
+	return fs
+}
+
+// flagTakesValue 判断 "-name" 形式的 flag 是否需要读取下一个单词作为值
+func flagTakesValue(fs *flag.FlagSet, word string) bool {
+	name := strings.TrimLeft(word, "-")
+	if strings.Contains(name, "=") {
+		return false
+	}
+	f := fs.Lookup(name)
+	if f == nil {
+		return false
+	}
+	if bf, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && bf.IsBoolFlag() {
+		return false
+	}
+	return true
+}
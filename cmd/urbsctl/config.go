@@ -0,0 +1,299 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Config urbsctl 配置文件，默认为 ~/.urbsctl.yml，例如：
+//
+//	current: dev
+//	profiles:
+//	  dev:
+//	    server: http://localhost:8081
+//	    auth_key: your-auth-key  # 服务端 auth_keys 之一，用于签发 JWT
+//	    subject: alice           # 签发 JWT 的 sub，即请求者身份
+//	  prod:
+//	    server: https://urbs-setting:8443
+//	    token: urbsk_xxx         # 直接使用的 JWT 或 API key
+type Config struct {
+	Current  string              `yaml:"current"`
+	Profiles map[string]*Profile `yaml:"profiles"`
+}
+
+// Profile 一个 urbs-setting 服务的连接和身份验证配置，token 和 auth_key 二选一
+type Profile struct {
+	Server   string `yaml:"server"`
+	Token    string `yaml:"token,omitempty"`    // JWT token 或 API key
+	AuthKey  string `yaml:"auth_key,omitempty"` // 服务端 auth_keys 之一，每次请求时用 HS256 签发 JWT
+	Subject  string `yaml:"subject,omitempty"`  // 签发 JWT 的 sub，默认为 urbsctl
+	TokenTTL string `yaml:"token_ttl,omitempty"`
+	Insecure bool   `yaml:"insecure,omitempty"` // 不验证服务端 TLS 证书，只用于测试环境
+}
+
+// configPath 返回配置文件路径：--config，$URBSCTL_CONFIG，~/.urbsctl.yml
+func (o *globalOptions) configPath() string {
+	if o.config != "" {
+		return o.config
+	}
+	if p := os.Getenv("URBSCTL_CONFIG"); p != "" {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".urbsctl.yml"
+	}
+	return filepath.Join(home, ".urbsctl.yml")
+}
+
+// loadConfig 读取配置文件，文件不存在时返回空配置
+func loadConfig(path string) (*Config, error) {
+	cfg := &Config{Profiles: map[string]*Profile{}}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cfg, nil
+		}
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+	if cfg.Profiles == nil {
+		cfg.Profiles = map[string]*Profile{}
+	}
+	return cfg, nil
+}
+
+func saveConfig(path string, cfg *Config) error {
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+// profileName 返回使用的 profile 名称：--profile，$URBSCTL_PROFILE，配置文件的 current，default
+func (o *globalOptions) profileName(cfg *Config) string {
+	if o.profile != "" {
+		return o.profile
+	}
+	if p := os.Getenv("URBSCTL_PROFILE"); p != "" {
+		return p
+	}
+	if cfg.Current != "" {
+		return cfg.Current
+	}
+	return "default"
+}
+
+// resolveProfile 合并配置文件的 profile 和命令行的 --server、--token
+func (o *globalOptions) resolveProfile() (*Profile, error) {
+	cfg, err := loadConfig(o.configPath())
+	if err != nil {
+		return nil, err
+	}
+	name := o.profileName(cfg)
+	p := &Profile{}
+	if v, ok := cfg.Profiles[name]; ok {
+		*p = *v
+	} else if o.profile != "" {
+		return nil, fmt.Errorf("profile %q not found in %s", name, o.configPath())
+	}
+
+	if o.server != "" {
+		p.Server = o.server
+	}
+	if o.token != "" {
+		p.Token = o.token
+		p.AuthKey = ""
+	}
+	if p.Server == "" {
+		return nil, fmt.Errorf("server required, set it in profile %q or with -server", name)
+	}
+	return p, nil
+}
+
+// authorization 返回请求的 Authorization 头，没有配置身份验证时返回空字符串
+func (p *Profile) authorization(now time.Time) (string, error) {
+	if p.Token != "" {
+		return "Bearer " + p.Token, nil
+	}
+	if p.AuthKey == "" {
+		return "", nil
+	}
+
+	ttl := 10 * time.Minute
+	if p.TokenTTL != "" {
+		d, err := time.ParseDuration(p.TokenTTL)
+		if err != nil {
+			return "", fmt.Errorf("invalid token_ttl %q: %v", p.TokenTTL, err)
+		}
+		ttl = d
+	}
+	sub := p.Subject
+	if sub == "" {
+		sub = "urbsctl"
+	}
+	token, err := signJWT(p.AuthKey, map[string]interface{}{
+		"sub": sub,
+		"iat": now.Unix(),
+		"exp": now.Add(ttl).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	return "Bearer " + token, nil
+}
+
+// signJWT 用 HS256 签发 JWT，与服务端 auth_keys 的验证方式一致
+func signJWT(key string, claims map[string]interface{}) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawURLEncoding
+	signing := enc.EncodeToString(header) + "." + enc.EncodeToString(payload)
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(signing))
+	return signing + "." + enc.EncodeToString(mac.Sum(nil)), nil
+}
+
+// profileNames 返回排序后的 profile 名称
+func (cfg *Config) profileNames() []string {
+	names := make([]string, 0, len(cfg.Profiles))
+	for name := range cfg.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var configCommand = &command{
+	Name: "config",
+	Desc: "Manage profiles in the config file",
+	Subs: []*command{
+		{
+			Name: "profiles", Desc: "List profiles", MaxArgs: 0,
+			Setup: func(fs *flag.FlagSet) func(c *cli, args []string) error {
+				return func(c *cli, args []string) error {
+					cfg, err := loadConfig(c.opts.configPath())
+					if err != nil {
+						return err
+					}
+					current := c.opts.profileName(cfg)
+					tw := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+					fmt.Fprintln(tw, "CURRENT\tNAME\tSERVER\tAUTH")
+					for _, name := range cfg.profileNames() {
+						p := cfg.Profiles[name]
+						mark := ""
+						if name == current {
+							mark = "*"
+						}
+						fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", mark, name, p.Server, p.authKind())
+					}
+					return tw.Flush()
+				}
+			},
+		},
+		{
+			Name: "use", Args: "PROFILE", Desc: "Set the current profile", MinArgs: 1, MaxArgs: 1,
+			Setup: func(fs *flag.FlagSet) func(c *cli, args []string) error {
+				return func(c *cli, args []string) error {
+					path := c.opts.configPath()
+					cfg, err := loadConfig(path)
+					if err != nil {
+						return err
+					}
+					if _, ok := cfg.Profiles[args[0]]; !ok {
+						return fmt.Errorf("profile %q not found in %s", args[0], path)
+					}
+					cfg.Current = args[0]
+					return saveConfig(path, cfg)
+				}
+			},
+		},
+		{
+			Name: "set", Args: "PROFILE", Desc: "Create or update a profile with -server, -token or -auth-key", MinArgs: 1, MaxArgs: 1,
+			Setup: func(fs *flag.FlagSet) func(c *cli, args []string) error {
+				authKey := &optString{}
+				subject := &optString{}
+				ttl := &optString{}
+				insecure := &optBool{}
+				fs.Var(authKey, "auth-key", "one of the server's auth_keys, used to sign JWT")
+				fs.Var(subject, "subject", "JWT subject, the identity of requests signed with -auth-key")
+				fs.Var(ttl, "token-ttl", "lifetime of JWT signed with -auth-key, 10m by default")
+				fs.Var(insecure, "insecure", "skip verifying the server's TLS certificate")
+				return func(c *cli, args []string) error {
+					path := c.opts.configPath()
+					cfg, err := loadConfig(path)
+					if err != nil {
+						return err
+					}
+					p, ok := cfg.Profiles[args[0]]
+					if !ok {
+						p = &Profile{}
+						cfg.Profiles[args[0]] = p
+					}
+					if c.opts.server != "" {
+						p.Server = c.opts.server
+					}
+					if c.opts.token != "" {
+						p.Token, p.AuthKey = c.opts.token, ""
+					}
+					if authKey.set {
+						p.AuthKey, p.Token = authKey.val, ""
+					}
+					if subject.set {
+						p.Subject = subject.val
+					}
+					if ttl.set {
+						p.TokenTTL = ttl.val
+					}
+					if insecure.set {
+						p.Insecure = insecure.val
+					}
+					if p.Server == "" {
+						return usageErrorf("-server required for a new profile")
+					}
+					if cfg.Current == "" {
+						cfg.Current = args[0]
+					}
+					return saveConfig(path, cfg)
+				}
+			},
+		},
+	},
+}
+
+// authKind 返回 profile 的身份验证方式，不显示密钥
+func (p *Profile) authKind() string {
+	switch {
+	case p.Token != "":
+		return "token"
+	case p.AuthKey != "":
+		sub := p.Subject
+		if sub == "" {
+			sub = "urbsctl"
+		}
+		return "jwt(sub=" + sub + ")"
+	default:
+		return "none"
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// optString 只有在命令行中指定时才发送的字符串参数
+type optString struct {
+	set bool
+	val string
+}
+
+func (o *optString) String() string {
+	return o.val
+}
+
+func (o *optString) Set(s string) error {
+	o.set, o.val = true, s
+	return nil
+}
+
+func (o *optString) putTo(body map[string]interface{}, key string) {
+	if o.set {
+		body[key] = o.val
+	}
+}
+
+// optBool 只有在命令行中指定时才发送的布尔参数，-protected 等同于 -protected=true
+type optBool struct {
+	set bool
+	val bool
+}
+
+func (o *optBool) String() string {
+	return strconv.FormatBool(o.val)
+}
+
+func (o *optBool) Set(s string) error {
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	o.set, o.val = true, v
+	return nil
+}
+
+func (o *optBool) IsBoolFlag() bool {
+	return true
+}
+
+func (o *optBool) putTo(body map[string]interface{}, key string) {
+	if o.set {
+		body[key] = o.val
+	}
+}
+
+// optList 逗号分隔的列表参数，可以多次指定，-channels= 表示清空
+type optList struct {
+	set  bool
+	vals []string
+}
+
+func (o *optList) String() string {
+	return strings.Join(o.vals, ",")
+}
+
+func (o *optList) Set(s string) error {
+	o.set = true
+	o.vals = append(o.vals, splitUIDs(s)...)
+	return nil
+}
+
+func (o *optList) putTo(body map[string]interface{}, key string) {
+	if o.set {
+		vals := o.vals
+		if vals == nil {
+			vals = []string{}
+		}
+		body[key] = vals
+	}
+}
+
+// listOptions 列表命令的分页和搜索参数
+type listOptions struct {
+	pageSize  int
+	pageToken string
+	search    string
+	all       bool
+}
+
+func registerListOptions(fs *flag.FlagSet) *listOptions {
+	lo := &listOptions{}
+	fs.IntVar(&lo.pageSize, "page-size", 0, "page size, 10 by default, 1000 at most")
+	fs.StringVar(&lo.pageToken, "page-token", "", "page token from the previous page")
+	fs.StringVar(&lo.search, "q", "", "search keyword")
+	fs.BoolVar(&lo.all, "all", false, "read all pages")
+	return lo
+}
+
+func (lo *listOptions) query(q url.Values) url.Values {
+	if q == nil {
+		q = url.Values{}
+	}
+	if lo.pageSize > 0 {
+		q.Set("pageSize", strconv.Itoa(lo.pageSize))
+	}
+	if lo.pageToken != "" {
+		q.Set("pageToken", lo.pageToken)
+	}
+	if lo.search != "" {
+		q.Set("q", lo.search)
+	}
+	return q
+}
+
+// attrs 环境标签和配置项的属性参数
+type attrs struct {
+	desc     optString
+	channels optList
+	clients  optList
+	values   optList
+}
+
+func registerAttrs(fs *flag.FlagSet, withValues bool) *attrs {
+	a := &attrs{}
+	fs.Var(&a.desc, "desc", "description")
+	fs.Var(&a.channels, "channels", "comma separated channels")
+	fs.Var(&a.clients, "clients", "comma separated clients")
+	if withValues {
+		fs.Var(&a.values, "values", "comma separated optional values")
+	}
+	return a
+}
+
+func (a *attrs) body() map[string]interface{} {
+	body := map[string]interface{}{}
+	a.desc.putTo(body, "desc")
+	a.channels.putTo(body, "channels")
+	a.clients.putTo(body, "clients")
+	a.values.putTo(body, "values")
+	return body
+}
+
+// uidsInput 从命令行和文件（"-" 为标准输入）读取 uid 列表
+type uidsInput struct {
+	inline optList
+	file   string
+}
+
+func (u *uidsInput) register(fs *flag.FlagSet, name, kind string) {
+	fs.Var(&u.inline, name, fmt.Sprintf("comma separated %s uids", kind))
+	fs.StringVar(&u.file, name+"-file", "", fmt.Sprintf("file of %s uids separated by newlines, commas or spaces, - for stdin", kind))
+}
+
+func (u *uidsInput) read(c *cli) ([]string, error) {
+	uids := append([]string{}, u.inline.vals...)
+	if u.file != "" {
+		var r io.Reader
+		if u.file == "-" {
+			r = c.stdin
+		} else {
+			f, err := os.Open(u.file)
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+			r = f
+		}
+		vals, err := readUIDs(r)
+		if err != nil {
+			return nil, err
+		}
+		uids = append(uids, vals...)
+	}
+	return dedupe(uids), nil
+}
+
+// targets 设置或撤销环境标签、配置项的用户和群组
+type targets struct {
+	users  uidsInput
+	groups uidsInput
+}
+
+func registerTargets(fs *flag.FlagSet) *targets {
+	t := &targets{}
+	t.users.register(fs, "users", "user")
+	t.groups.register(fs, "groups", "group")
+	return t
+}
+
+func (t *targets) body(c *cli) (map[string]interface{}, error) {
+	if t.users.file == "-" && t.groups.file == "-" {
+		return nil, usageErrorf("only one of -users-file and -groups-file can read from stdin")
+	}
+	users, err := t.users.read(c)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := t.groups.read(c)
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 && len(groups) == 0 {
+		return nil, usageErrorf("users or groups required, use -users, -users-file, -groups or -groups-file")
+	}
+	return map[string]interface{}{"users": users, "groups": groups}, nil
+}
+
+// rule 百分比发布规则参数
+type rule struct {
+	kind    string
+	percent int
+	value   string
+}
+
+func registerRule(fs *flag.FlagSet) *rule {
+	r := &rule{}
+	fs.StringVar(&r.kind, "kind", "userPercent", "rule kind: userPercent, newUserPercent or childLabelUserPercent")
+	fs.IntVar(&r.percent, "percent", -1, "percent of users, 0 to 100, required")
+	fs.StringVar(&r.value, "value", "", "setting value, only for setting rules")
+	return r
+}
+
+func (r *rule) body(setting bool) (map[string]interface{}, error) {
+	if r.percent < 0 || r.percent > 100 {
+		return nil, usageErrorf("-percent should be in [0, 100]")
+	}
+	body := map[string]interface{}{
+		"kind": r.kind,
+		"rule": map[string]int{"value": r.percent},
+	}
+	if setting {
+		body["value"] = r.value
+	} else if r.value != "" {
+		return nil, usageErrorf("-value is only for setting rules")
+	}
+	return body, nil
+}
+
+// readUIDs 读取 uid 列表，支持换行、逗号和空白分隔，# 之后为注释
+func readUIDs(r io.Reader) ([]string, error) {
+	uids := []string{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		uids = append(uids, splitUIDs(line)...)
+	}
+	return uids, scanner.Err()
+}
+
+func splitUIDs(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+}
+
+func dedupe(vals []string) []string {
+	seen := make(map[string]bool, len(vals))
+	res := make([]string, 0, len(vals))
+	for _, v := range vals {
+		if !seen[v] {
+			seen[v] = true
+			res = append(res, v)
+		}
+	}
+	return res
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	jobColumns      = []string{"hid", "kind", "target", "status", "processed", "invalidated", "failed", "message", "createdAt", "finishedAt"}
+	jobErrorColumns = []string{"line", "uid", "message"}
+)
+
+// importContentTypes 导入文件格式对应的 Content-Type
+var importContentTypes = map[string]string{
+	"csv":    "text/csv",
+	"ndjson": "application/x-ndjson",
+	"jsonl":  "application/x-ndjson",
+}
+
+var usersCommand = &command{
+	Name: "users",
+	Desc: "Manage users",
+	Subs: []*command{
+		importCommand("", "Import users from a CSV (uid column) or NDJSON file", "/v1/users:import", false),
+	},
+}
+
+var jobsCommand = &command{
+	Name: "jobs",
+	Desc: "List background jobs and their results",
+	Subs: []*command{
+		{
+			Name: "list", Desc: "List background jobs", MaxArgs: 0,
+			Setup: func(fs *flag.FlagSet) func(c *cli, args []string) error {
+				lo := registerListOptions(fs)
+				kind := fs.String("kind", "", "only list jobs of the kind")
+				return func(c *cli, args []string) error {
+					return c.list("/v1/jobs", lo, kindQuery(*kind), jobColumns)
+				}
+			},
+		},
+		pathCommand("get", "HID", "Show the progress and result of a job", http.MethodGet, "/v1/jobs/%s", jobColumns),
+		{
+			Name: "errors", Args: "HID", Desc: "List invalid rows of an import job", MinArgs: 1, MaxArgs: 1,
+			Setup: func(fs *flag.FlagSet) func(c *cli, args []string) error {
+				lo := registerListOptions(fs)
+				return func(c *cli, args []string) error {
+					return c.list(pathf("/v1/jobs/%s/errors", args[0]), lo, nil, jobErrorColumns)
+				}
+			},
+		},
+	},
+}
+
+// importCommand 创建上传 CSV 或 NDJSON 文件的导入命令，args 为文件之前的路径参数
+func importCommand(args, desc, format string, withKind bool) *command {
+	n := countVerbs(format)
+	usage := "FILE"
+	if args != "" {
+		usage = args + " FILE"
+	}
+	return &command{
+		Name: "import", Args: usage, Desc: desc, MinArgs: n + 1, MaxArgs: n + 1,
+		Setup: func(fs *flag.FlagSet) func(c *cli, args []string) error {
+			fileFormat := fs.String("format", "", "file format, csv or ndjson, detected from the file extension by default, required for stdin")
+			var kind *string
+			if withKind {
+				kind = fs.String("kind", "", "group kind")
+			}
+			return func(c *cli, args []string) error {
+				q := url.Values{}
+				if kind != nil {
+					q = kindQuery(*kind)
+				}
+				return c.importFile(pathf(format, args[:n]...), q, args[n], *fileFormat)
+			}
+		},
+	}
+}
+
+// importFile 上传导入文件，- 为 stdin，输出执行导入的后台任务
+func (c *cli) importFile(path string, query url.Values, file, format string) error {
+	if format == "" && file != "-" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(file)), ".")
+	}
+	contentType, ok := importContentTypes[format]
+	if !ok {
+		return usageErrorf("-format should be csv or ndjson")
+	}
+
+	var r io.Reader = c.stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	cl, err := c.api()
+	if err != nil {
+		return err
+	}
+	res, err := cl.upload(path, query, contentType, r)
+	if err != nil {
+		return err
+	}
+	return c.printResult(res, jobColumns)
+}
@@ -0,0 +1,199 @@
+// urbsctl 是 urbs-setting 的命令行管理工具，通过 /v1 接口管理产品、功能模块、配置项、环境标签、群组、群组成员和发布规则。
+//
+// 服务地址和身份验证信息从配置文件的 profile 中读取，参见 config.go。
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run 执行命令并返回进程退出码：0 成功，1 执行失败，2 参数错误
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	c := &cli{stdin: stdin, stdout: stdout, stderr: stderr}
+	if err := c.dispatch(rootCommand, nil, args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		fmt.Fprintf(stderr, "urbsctl: %v\n", err)
+		var ue usageError
+		if errors.As(err, &ue) {
+			return 2
+		}
+		return 1
+	}
+	return 0
+}
+
+// usageError 命令参数错误
+type usageError struct {
+	msg string
+}
+
+func (e usageError) Error() string {
+	return e.msg
+}
+
+func usageErrorf(format string, args ...interface{}) error {
+	return usageError{msg: fmt.Sprintf(format, args...)}
+}
+
+// command 命令树的节点，有子命令的节点只负责分发
+type command struct {
+	Name    string
+	Args    string // 位置参数说明，如 "PRODUCT LABEL"
+	Desc    string
+	MinArgs int
+	MaxArgs int  // -1 表示不限制
+	Hidden  bool // 不在帮助信息和补全中显示
+	RawArgs bool // 不解析 flags，所有参数原样作为位置参数
+	Subs    []*command
+	// Setup 在 FlagSet 上注册命令的 flags，并返回命令的执行函数
+	Setup func(fs *flag.FlagSet) func(c *cli, args []string) error
+}
+
+func (cmd *command) sub(name string) *command {
+	for _, s := range cmd.Subs {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// globalOptions 所有命令都支持的 flags
+type globalOptions struct {
+	config  string
+	profile string
+	server  string
+	token   string
+	output  string
+}
+
+// register 在 fs 上注册全局 flags，使用当前值作为默认值，以便上级命令已解析的值在子命令中保留
+func (o *globalOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.config, "config", o.config, "config file path, default $URBSCTL_CONFIG or ~/.urbsctl.yml")
+	fs.StringVar(&o.profile, "profile", o.profile, "profile name in config file, default $URBSCTL_PROFILE or current profile")
+	fs.StringVar(&o.server, "server", o.server, "urbs-setting server URL, overrides the profile")
+	fs.StringVar(&o.token, "token", o.token, "JWT token or API key, overrides the profile")
+	fs.StringVar(&o.output, "output", o.output, "output format: table, json or yaml")
+	fs.StringVar(&o.output, "o", o.output, "shorthand for -output")
+}
+
+type cli struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+	opts   globalOptions
+	client *client
+}
+
+// dispatch 解析 args 并执行 cmd 或其子命令，flags 可以出现在位置参数之间
+func (c *cli) dispatch(cmd *command, path []string, args []string) error {
+	path = append(path, cmd.Name)
+	fs := flag.NewFlagSet(strings.Join(path, " "), flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	c.opts.register(fs)
+	var exec func(c *cli, args []string) error
+	if cmd.Setup != nil {
+		exec = cmd.Setup(fs)
+	}
+
+	if len(cmd.Subs) > 0 {
+		if err := fs.Parse(args); err != nil {
+			return c.flagError(cmd, path, fs, err)
+		}
+		if fs.NArg() == 0 {
+			c.usage(cmd, path, fs)
+			return usageErrorf("%s: command required", strings.Join(path, " "))
+		}
+		sub := cmd.sub(fs.Arg(0))
+		if sub == nil {
+			return usageErrorf("%s: unknown command %q", strings.Join(path, " "), fs.Arg(0))
+		}
+		return c.dispatch(sub, path, fs.Args()[1:])
+	}
+
+	positional := args
+	if !cmd.RawArgs {
+		var err error
+		if positional, err = parseInterleaved(fs, args); err != nil {
+			return c.flagError(cmd, path, fs, err)
+		}
+	}
+	if len(positional) < cmd.MinArgs || (cmd.MaxArgs >= 0 && len(positional) > cmd.MaxArgs) {
+		return usageErrorf("usage: %s %s", strings.Join(path, " "), cmd.Args)
+	}
+	return exec(c, positional)
+}
+
+func (c *cli) flagError(cmd *command, path []string, fs *flag.FlagSet, err error) error {
+	if err == flag.ErrHelp {
+		c.usage(cmd, path, fs)
+		return err
+	}
+	return usageError{msg: err.Error()}
+}
+
+// parseInterleaved 解析 flags 和位置参数交替出现的参数列表，"--" 之后都作为位置参数
+func parseInterleaved(fs *flag.FlagSet, args []string) ([]string, error) {
+	var tail []string
+	for i, arg := range args {
+		if arg == "--" {
+			args, tail = args[:i], args[i+1:]
+			break
+		}
+	}
+
+	positional := []string{}
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return append(positional, tail...), nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+func (c *cli) usage(cmd *command, path []string, fs *flag.FlagSet) {
+	w := tabwriter.NewWriter(c.stderr, 0, 2, 2, ' ', 0)
+	defer w.Flush()
+	if cmd.Desc != "" {
+		fmt.Fprintf(w, "%s\n\n", cmd.Desc)
+	}
+	if len(cmd.Subs) > 0 {
+		fmt.Fprintf(w, "Usage: %s COMMAND [ARGS] [FLAGS]\n\nCommands:\n", strings.Join(path, " "))
+		for _, s := range cmd.Subs {
+			if !s.Hidden {
+				fmt.Fprintf(w, "  %s\t%s\n", s.Name, s.Desc)
+			}
+		}
+	} else {
+		fmt.Fprintf(w, "Usage: %s %s [FLAGS]\n", strings.Join(path, " "), cmd.Args)
+	}
+
+	names := []string{}
+	fs.VisitAll(func(f *flag.Flag) {
+		names = append(names, f.Name)
+	})
+	sort.Strings(names)
+	fmt.Fprintf(w, "\nFlags:\n")
+	for _, name := range names {
+		f := fs.Lookup(name)
+		fmt.Fprintf(w, "  -%s\t%s\n", f.Name, f.Usage)
+	}
+}
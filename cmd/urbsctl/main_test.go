@@ -0,0 +1,618 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recorded 测试服务收到的请求
+type recorded struct {
+	Method      string
+	Path        string
+	Query       string
+	Auth        string
+	ContentType string
+	Body        map[string]interface{}
+	Raw         string // 非 JSON 的请求体
+}
+
+type testServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []recorded
+	respond  func(w http.ResponseWriter, r *http.Request)
+}
+
+func newTestServer(t *testing.T) *testServer {
+	ts := &testServer{}
+	ts.respond = func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, 200, map[string]interface{}{"result": true})
+	}
+	ts.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := recorded{Method: r.Method, Path: r.URL.EscapedPath(), Query: r.URL.RawQuery, Auth: r.Header.Get("Authorization"),
+			ContentType: r.Header.Get("Content-Type")}
+		if data, _ := ioutil.ReadAll(r.Body); len(data) > 0 {
+			if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+				require.Nil(t, json.Unmarshal(data, &rec.Body))
+			} else {
+				rec.Raw = string(data)
+			}
+		}
+		ts.mu.Lock()
+		ts.requests = append(ts.requests, rec)
+		ts.mu.Unlock()
+		ts.respond(w, r)
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func (ts *testServer) last() recorded {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if len(ts.requests) == 0 {
+		return recorded{}
+	}
+	return ts.requests[len(ts.requests)-1]
+}
+
+func writeJSON(w http.ResponseWriter, code int, val interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(val)
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "urbsctl")
+	require.Nil(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+	return dir
+}
+
+func setenv(t *testing.T, key, val string) {
+	prev, ok := os.LookupEnv(key)
+	os.Setenv(key, val)
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, prev)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+// runCLI 执行命令，不读取用户目录下的配置文件
+func runCLI(t *testing.T, stdin string, args ...string) (code int, stdout, stderr string) {
+	if os.Getenv("URBSCTL_CONFIG") == "" {
+		setenv(t, "URBSCTL_CONFIG", filepath.Join(tempDir(t), "urbsctl.yml"))
+	}
+	var out, errOut bytes.Buffer
+	code = run(args, strings.NewReader(stdin), &out, &errOut)
+	return code, out.String(), errOut.String()
+}
+
+func TestProducts(t *testing.T) {
+	ts := newTestServer(t)
+
+	t.Run("list should print table, json and yaml", func(t *testing.T) {
+		assert := assert.New(t)
+
+		ts.respond = func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, 200, map[string]interface{}{
+				"nextPageToken": "h.1",
+				"result": []map[string]interface{}{
+					{"name": "urbs", "desc": "Urbs", "protected": true, "status": 0, "createdAt": "2021-01-12T06:24:25Z"},
+				},
+			})
+		}
+
+		code, out, errOut := runCLI(t, "", "-server", ts.URL, "products", "list", "-page-size", "1", "-q", "ur")
+		assert.Equal(0, code, errOut)
+		assert.Equal("GET", ts.last().Method)
+		assert.Equal("/v1/products", ts.last().Path)
+		assert.Equal("pageSize=1&q=ur", ts.last().Query)
+		assert.Contains(out, "NAME  DESC  PROTECTED  STATUS  CREATEDAT             OFFLINEAT")
+		assert.Contains(out, "urbs  Urbs  true       0       2021-01-12T06:24:25Z  -")
+		assert.Contains(errOut, "-page-token h.1")
+
+		code, out, _ = runCLI(t, "", "products", "list", "-server", ts.URL, "-o", "json")
+		assert.Equal(0, code)
+		assert.Contains(out, `"protected": true`)
+		assert.Contains(out, `"status": 0`)
+
+		code, out, _ = runCLI(t, "", "products", "list", "-server", ts.URL, "-output", "yaml")
+		assert.Equal(0, code)
+		assert.Contains(out, "- createdAt: \"2021-01-12T06:24:25Z\"\n  desc: Urbs\n")
+		assert.Contains(out, "  status: 0\n")
+	})
+
+	t.Run("list -all should read all pages", func(t *testing.T) {
+		assert := assert.New(t)
+
+		ts.respond = func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("pageToken") == "" {
+				writeJSON(w, 200, map[string]interface{}{"nextPageToken": "h.2", "result": []map[string]interface{}{{"name": "a"}}})
+				return
+			}
+			writeJSON(w, 200, map[string]interface{}{"result": []map[string]interface{}{{"name": "b"}}})
+		}
+
+		code, out, errOut := runCLI(t, "", "products", "list", "-all", "-server", ts.URL, "-o", "json")
+		assert.Equal(0, code, errOut)
+		assert.Equal("pageToken=h.2", ts.last().Query)
+		var items []map[string]interface{}
+		assert.Nil(json.Unmarshal([]byte(out), &items))
+		assert.Equal(2, len(items))
+	})
+
+	t.Run("update should only send given fields", func(t *testing.T) {
+		assert := assert.New(t)
+
+		ts.respond = func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, 200, map[string]interface{}{"result": map[string]interface{}{"name": "urbs", "protected": true}})
+		}
+		code, _, errOut := runCLI(t, "", "products", "update", "urbs", "-protected", "-server", ts.URL)
+		assert.Equal(0, code, errOut)
+		assert.Equal("PUT", ts.last().Method)
+		assert.Equal("/v1/products/urbs", ts.last().Path)
+		assert.Equal(map[string]interface{}{"protected": true}, ts.last().Body)
+
+		code, _, errOut = runCLI(t, "", "products", "update", "urbs", "-server", ts.URL)
+		assert.Equal(2, code)
+		assert.Contains(errOut, "-desc or -protected required")
+	})
+
+	t.Run("should print server errors", func(t *testing.T) {
+		assert := assert.New(t)
+
+		ts.respond = func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, 404, map[string]interface{}{"error": "NotFound", "message": "product \"x\" not found"})
+		}
+		code, out, errOut := runCLI(t, "", "products", "offline", "x", "-server", ts.URL)
+		assert.Equal(1, code)
+		assert.Equal("", out)
+		assert.Equal("/v1/products/x:offline", ts.last().Path)
+		assert.Contains(errOut, `404 NotFound: product "x" not found`)
+	})
+}
+
+func TestAssignAndRecall(t *testing.T) {
+	ts := newTestServer(t)
+	ts.respond = func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, 200, map[string]interface{}{"result": map[string]interface{}{"release": 3}})
+	}
+
+	t.Run("labels assign should read uids from stdin", func(t *testing.T) {
+		assert := assert.New(t)
+
+		stdin := "u1\nu2, u3  # comment\n\n# u4\nu1\n"
+		code, out, errOut := runCLI(t, stdin, "labels", "assign", "urbs", "beta", "-users-file", "-", "-groups", "g1", "-server", ts.URL)
+		assert.Equal(0, code, errOut)
+		assert.Equal("POST", ts.last().Method)
+		assert.Equal("/v1/products/urbs/labels/beta:assign", ts.last().Path)
+		assert.Equal([]interface{}{"u1", "u2", "u3"}, ts.last().Body["users"])
+		assert.Equal([]interface{}{"g1"}, ts.last().Body["groups"])
+		assert.Contains(out, "release:  3")
+	})
+
+	t.Run("settings assign should read uids from file", func(t *testing.T) {
+		assert := assert.New(t)
+
+		file := filepath.Join(tempDir(t), "uids.txt")
+		assert.Nil(ioutil.WriteFile(file, []byte("a1\na2\n"), 0600))
+		code, _, errOut := runCLI(t, "", "settings", "assign", "urbs", "web", "theme", "-value", "dark",
+			"-users-file", file, "-server", ts.URL)
+		assert.Equal(0, code, errOut)
+		assert.Equal("/v1/products/urbs/modules/web/settings/theme:assign", ts.last().Path)
+		assert.Equal([]interface{}{"a1", "a2"}, ts.last().Body["users"])
+		assert.Equal([]interface{}{}, ts.last().Body["groups"])
+		assert.Equal("dark", ts.last().Body["value"])
+	})
+
+	t.Run("assign without uids should fail", func(t *testing.T) {
+		assert := assert.New(t)
+
+		n := len(ts.requests)
+		code, _, errOut := runCLI(t, "", "labels", "assign", "urbs", "beta", "-users-file", "-", "-server", ts.URL)
+		assert.Equal(2, code)
+		assert.Contains(errOut, "users or groups required")
+		assert.Equal(n, len(ts.requests))
+	})
+
+	t.Run("recall should send release", func(t *testing.T) {
+		assert := assert.New(t)
+
+		code, _, errOut := runCLI(t, "", "labels", "recall", "urbs", "beta", "-release", "3", "-server", ts.URL)
+		assert.Equal(0, code, errOut)
+		assert.Equal("/v1/products/urbs/labels/beta:recall", ts.last().Path)
+		assert.Equal(float64(3), ts.last().Body["release"])
+	})
+
+	t.Run("protected product should print change request note", func(t *testing.T) {
+		assert := assert.New(t)
+
+		ts.respond = func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, 202, map[string]interface{}{"result": map[string]interface{}{"hid": "AwAAAAAAAAB25V_QnbhCuRwF", "status": "pending"}})
+		}
+		code, out, errOut := runCLI(t, "", "labels", "cleanup", "urbs", "beta", "-server", ts.URL)
+		assert.Equal(0, code, errOut)
+		assert.Equal("DELETE", ts.last().Method)
+		assert.Contains(errOut, "pending approval")
+		assert.Contains(out, "AwAAAAAAAAB25V_QnbhCuRwF")
+	})
+}
+
+func TestGroupsAndRules(t *testing.T) {
+	ts := newTestServer(t)
+
+	t.Run("groups and members", func(t *testing.T) {
+		assert := assert.New(t)
+
+		code, _, errOut := runCLI(t, "", "groups", "create", "org1", "-kind", "organization", "-desc", "Org", "-server", ts.URL)
+		assert.Equal(0, code, errOut)
+		assert.Equal("/v1/groups:batch", ts.last().Path)
+		assert.Equal([]interface{}{map[string]interface{}{"uid": "org1", "kind": "organization", "desc": "Org"}},
+			ts.last().Body["groups"])
+
+		code, _, errOut = runCLI(t, "", "members", "add", "org1", "-kind", "organization", "-users", "u1,u2", "-server", ts.URL)
+		assert.Equal(0, code, errOut)
+		assert.Equal("/v1/groups/org1/members:batch", ts.last().Path)
+		assert.Equal("kind=organization", ts.last().Query)
+		assert.Equal([]interface{}{"u1", "u2"}, ts.last().Body["users"])
+
+		code, _, errOut = runCLI(t, "", "members", "remove", "org1", "-sync-lt", "1610000000", "-server", ts.URL)
+		assert.Equal(0, code, errOut)
+		assert.Equal("DELETE", ts.last().Method)
+		assert.Equal("syncLt=1610000000", ts.last().Query)
+
+		code, _, _ = runCLI(t, "", "members", "remove", "org1", "-server", ts.URL)
+		assert.Equal(2, code)
+	})
+
+	t.Run("rules", func(t *testing.T) {
+		assert := assert.New(t)
+
+		code, _, errOut := runCLI(t, "", "rules", "create", "urbs", "web", "theme", "-percent", "20", "-value", "dark", "-server", ts.URL)
+		assert.Equal(0, code, errOut)
+		assert.Equal("POST", ts.last().Method)
+		assert.Equal("/v1/products/urbs/modules/web/settings/theme/rules", ts.last().Path)
+		assert.Equal("userPercent", ts.last().Body["kind"])
+		assert.Equal(map[string]interface{}{"value": float64(20)}, ts.last().Body["rule"])
+		assert.Equal("dark", ts.last().Body["value"])
+
+		code, _, errOut = runCLI(t, "", "rules", "update", "urbs", "beta", "AwAAAAAAAAB25V_QnbhCuRwF", "-percent", "50",
+			"-kind", "newUserPercent", "-server", ts.URL)
+		assert.Equal(0, code, errOut)
+		assert.Equal("PUT", ts.last().Method)
+		assert.Equal("/v1/products/urbs/labels/beta/rules/AwAAAAAAAAB25V_QnbhCuRwF", ts.last().Path)
+		assert.Equal("newUserPercent", ts.last().Body["kind"])
+		_, ok := ts.last().Body["value"]
+		assert.False(ok)
+
+		code, _, errOut = runCLI(t, "", "rules", "create", "urbs", "beta", "-percent", "20", "-value", "x", "-server", ts.URL)
+		assert.Equal(2, code)
+		assert.Contains(errOut, "-value is only for setting rules")
+	})
+}
+
+func TestImport(t *testing.T) {
+	ts := newTestServer(t)
+	ts.respond = func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/errors") {
+			writeJSON(w, 200, map[string]interface{}{"result": []map[string]interface{}{{"line": 3, "uid": "a b", "message": "invalid user"}}})
+			return
+		}
+		writeJSON(w, 202, map[string]interface{}{"result": map[string]interface{}{"hid": "job1", "kind": "import_users", "status": "running"}})
+	}
+	dir := tempDir(t)
+	file := filepath.Join(dir, "users.csv")
+	require.Nil(t, ioutil.WriteFile(file, []byte("uid\nu1\n"), 0644))
+
+	t.Run("import", func(t *testing.T) {
+		assert := assert.New(t)
+
+		code, out, errOut := runCLI(t, "", "users", "import", file, "-server", ts.URL)
+		assert.Equal(0, code, errOut)
+		assert.Equal("/v1/users:import", ts.last().Path)
+		assert.Equal("text/csv", ts.last().ContentType)
+		assert.Equal("uid\nu1\n", ts.last().Raw)
+		assert.Contains(out, "job1")
+
+		code, _, errOut = runCLI(t, `{"uid":"u1"}`, "members", "import", "org1", "-", "-kind", "organization", "-format", "ndjson", "-server", ts.URL)
+		assert.Equal(0, code, errOut)
+		assert.Equal("/v1/groups/org1/members:import", ts.last().Path)
+		assert.Equal("kind=organization", ts.last().Query)
+		assert.Equal("application/x-ndjson", ts.last().ContentType)
+		assert.Equal(`{"uid":"u1"}`, ts.last().Raw)
+
+		code, _, errOut = runCLI(t, "", "groups", "import", "-", "-server", ts.URL)
+		assert.Equal(2, code)
+		assert.Contains(errOut, "-format should be csv or ndjson")
+	})
+
+	t.Run("jobs errors", func(t *testing.T) {
+		assert := assert.New(t)
+
+		code, out, errOut := runCLI(t, "", "jobs", "errors", "job1", "-server", ts.URL)
+		assert.Equal(0, code, errOut)
+		assert.Equal("/v1/jobs/job1/errors", ts.last().Path)
+		assert.Contains(out, "invalid user")
+	})
+}
+
+func TestProductConfig(t *testing.T) {
+	ts := newTestServer(t)
+	file := filepath.Join(tempDir(t), "urbs.yml")
+	config := "product: urbs\nmodules:\n  - name: web\n    desc: Web\n"
+	require.Nil(t, ioutil.WriteFile(file, []byte(config), 0644))
+
+	t.Run("export should print YAML", func(t *testing.T) {
+		assert := assert.New(t)
+
+		ts.respond = func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/yaml")
+			w.Write([]byte(config))
+		}
+		code, out, errOut := runCLI(t, "", "products", "export", "urbs", "-server", ts.URL)
+		assert.Equal(0, code, errOut)
+		assert.Equal("/v1/products/urbs:export", ts.last().Path)
+		assert.Equal("format=yaml", ts.last().Query)
+		assert.Equal(config, out)
+	})
+
+	t.Run("plan should print operations", func(t *testing.T) {
+		assert := assert.New(t)
+
+		ts.respond = func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, 200, map[string]interface{}{"result": map[string]interface{}{
+				"product": "urbs",
+				"prune":   true,
+				"operations": []map[string]interface{}{
+					{"op": "update", "kind": "module", "target": "web", "before": map[string]interface{}{"desc": "web"},
+						"after": map[string]interface{}{"desc": "Web"}},
+					{"op": "create", "kind": "labelRule", "target": "beta/userPercent", "after": map[string]interface{}{"kind": "userPercent", "percent": 10}},
+					{"op": "offline", "kind": "label", "target": "alpha", "before": map[string]interface{}{"name": "alpha"}},
+				},
+			}})
+		}
+		code, out, errOut := runCLI(t, "", "products", "plan", "urbs", file, "-prune", "-server", ts.URL)
+		assert.Equal(0, code, errOut)
+		assert.Equal("POST", ts.last().Method)
+		assert.Equal("/v1/products/urbs:plan", ts.last().Path)
+		assert.Equal("prune=true", ts.last().Query)
+		assert.Equal(config, ts.last().Raw)
+		assert.Equal(`~ update module web
+    desc: "web" -> "Web"
++ create labelRule beta/userPercent
+- offline label alpha
+Plan: 1 to create, 1 to update, 1 to offline or delete.
+`, out)
+
+		code, out, errOut = runCLI(t, config, "products", "plan", "urbs", "-", "-output", "json", "-server", ts.URL)
+		assert.Equal(0, code, errOut)
+		assert.Equal("", ts.last().Query)
+		assert.Equal(config, ts.last().Raw)
+		assert.Contains(out, `"operations": [`)
+	})
+
+	t.Run("apply should print result or pending change request", func(t *testing.T) {
+		assert := assert.New(t)
+
+		ts.respond = func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, 200, map[string]interface{}{"result": map[string]interface{}{"product": "urbs", "operations": []interface{}{}}})
+		}
+		code, out, errOut := runCLI(t, "", "products", "apply", "urbs", file, "-server", ts.URL)
+		assert.Equal(0, code, errOut)
+		assert.Equal("/v1/products/urbs:apply", ts.last().Path)
+		assert.Equal("No changes, the product is up to date.\n", out)
+
+		ts.respond = func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, 202, map[string]interface{}{"result": map[string]interface{}{"hid": "AwAAAAAAAAB25V_QnbhCuRwF", "status": "pending"}})
+		}
+		code, out, errOut = runCLI(t, "", "products", "apply", "urbs", file, "-prune", "-server", ts.URL)
+		assert.Equal(0, code, errOut)
+		assert.Contains(errOut, "pending approval")
+		assert.Contains(out, "AwAAAAAAAAB25V_QnbhCuRwF")
+
+		code, _, errOut = runCLI(t, "", "products", "apply", "urbs", filepath.Join(tempDir(t), "missing.yml"), "-server", ts.URL)
+		assert.Equal(1, code)
+		assert.Contains(errOut, "missing.yml")
+	})
+}
+
+func TestProductPromote(t *testing.T) {
+	ts := newTestServer(t)
+
+	t.Run("promote should print operations and conflicts", func(t *testing.T) {
+		assert := assert.New(t)
+
+		ts.respond = func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, 200, map[string]interface{}{"result": map[string]interface{}{
+				"source": "urbs-staging",
+				"target": "urbs",
+				"dryRun": true,
+				"operations": []map[string]interface{}{
+					{"op": "create", "kind": "setting", "target": "web/theme", "after": map[string]interface{}{"name": "theme"}},
+					{"op": "assign", "kind": "labelGroups", "target": "beta", "after": map[string]interface{}{"groups": []string{"org:1"}}},
+				},
+				"conflicts": []map[string]interface{}{
+					{"op": "update", "kind": "module", "target": "web", "before": map[string]interface{}{"desc": "web"},
+						"after": map[string]interface{}{"desc": "Web"}, "reason": "differs from source product"},
+				},
+			}})
+		}
+		code, out, errOut := runCLI(t, "", "products", "promote", "urbs-staging", "urbs", "-modules", "web/theme",
+			"-labels", "beta", "-groups", "-dry-run", "-server", ts.URL)
+		assert.Equal(0, code, errOut)
+		assert.Equal("POST", ts.last().Method)
+		assert.Equal("/v1/products/urbs-staging:promote", ts.last().Path)
+		assert.Equal("urbs", ts.last().Body["target"])
+		assert.Equal([]interface{}{"web/theme"}, ts.last().Body["modules"])
+		assert.Equal([]interface{}{"beta"}, ts.last().Body["labels"])
+		assert.Equal(true, ts.last().Body["groups"])
+		assert.Equal(true, ts.last().Body["dryRun"])
+		assert.Equal(false, ts.last().Body["overwrite"])
+		assert.Equal(`+ create setting web/theme
++ assign labelGroups beta
+Plan: 2 to create, 0 to update, 0 to offline or delete.
+! conflict module web: differs from source product
+    desc: "web" -> "Web"
+1 conflicts left unchanged, use -overwrite to replace them.
+`, out)
+
+		code, _, errOut = runCLI(t, "", "products", "promote", "urbs-staging", "urbs", "-server", ts.URL)
+		assert.Equal(1, code)
+		assert.Contains(errOut, "-modules or -labels required")
+	})
+
+	t.Run("clone should send target and desc", func(t *testing.T) {
+		assert := assert.New(t)
+
+		ts.respond = func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, 200, map[string]interface{}{"result": map[string]interface{}{
+				"source": "urbs", "target": "urbs-staging", "operations": []interface{}{}, "conflicts": []interface{}{},
+			}})
+		}
+		code, out, errOut := runCLI(t, "", "products", "clone", "urbs", "urbs-staging", "-desc", "staging", "-overwrite", "-server", ts.URL)
+		assert.Equal(0, code, errOut)
+		assert.Equal("/v1/products/urbs:clone", ts.last().Path)
+		assert.Equal("urbs-staging", ts.last().Body["target"])
+		assert.Equal("staging", ts.last().Body["desc"])
+		assert.Equal(true, ts.last().Body["overwrite"])
+		assert.Equal("No changes, the product is up to date.\n", out)
+	})
+}
+
+func TestProfiles(t *testing.T) {
+	ts := newTestServer(t)
+	setenv(t, "URBSCTL_CONFIG", filepath.Join(tempDir(t), "urbsctl.yml"))
+
+	t.Run("config set and use should write profiles", func(t *testing.T) {
+		assert := assert.New(t)
+
+		code, _, errOut := runCLI(t, "", "config", "set", "dev", "-server", ts.URL, "-auth-key", "secret", "-subject", "alice")
+		assert.Equal(0, code, errOut)
+		code, _, errOut = runCLI(t, "", "config", "set", "prod", "-server", "https://urbs.example.com", "-token", "urbsk_xxx")
+		assert.Equal(0, code, errOut)
+
+		code, out, _ := runCLI(t, "", "config", "profiles")
+		assert.Equal(0, code)
+		assert.Regexp(`\*\s+dev\s+`+regexp.QuoteMeta(ts.URL)+`\s+jwt\(sub=alice\)`, out)
+		assert.Contains(out, "prod")
+		assert.NotContains(out, "urbsk_xxx")
+		assert.NotContains(out, "secret")
+
+		code, _, _ = runCLI(t, "", "config", "use", "prod")
+		assert.Equal(0, code)
+		code, out, _ = runCLI(t, "", "config", "profiles")
+		assert.Equal(0, code)
+		assert.Regexp(`\*\s+prod\s`, out)
+
+		code, _, errOut = runCLI(t, "", "config", "use", "test")
+		assert.Equal(1, code)
+		assert.Contains(errOut, `profile "test" not found`)
+	})
+
+	t.Run("profile with auth_key should sign JWT", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		code, _, errOut := runCLI(t, "", "-profile", "dev", "modules", "list", "urbs")
+		require.Equal(0, code, errOut)
+		auth := ts.last().Auth
+		require.True(strings.HasPrefix(auth, "Bearer "))
+		parts := strings.Split(strings.TrimPrefix(auth, "Bearer "), ".")
+		require.Equal(3, len(parts))
+
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write([]byte(parts[0] + "." + parts[1]))
+		assert.Equal(base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), parts[2])
+		payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+		require.Nil(err)
+		claims := map[string]interface{}{}
+		require.Nil(json.Unmarshal(payload, &claims))
+		assert.Equal("alice", claims["sub"])
+		assert.Equal(float64(600), claims["exp"].(float64)-claims["iat"].(float64))
+	})
+
+	t.Run("current profile and -token should work", func(t *testing.T) {
+		assert := assert.New(t)
+
+		code, _, errOut := runCLI(t, "", "-server", ts.URL, "labels", "list", "urbs")
+		assert.Equal(0, code, errOut)
+		assert.Equal("Bearer urbsk_xxx", ts.last().Auth)
+
+		code, _, errOut = runCLI(t, "", "-profile", "dev", "-token", "jwt", "labels", "list", "urbs")
+		assert.Equal(0, code, errOut)
+		assert.Equal("Bearer jwt", ts.last().Auth)
+
+		code, _, errOut = runCLI(t, "", "-profile", "test", "labels", "list", "urbs")
+		assert.Equal(1, code)
+		assert.Contains(errOut, `profile "test" not found`)
+	})
+}
+
+func TestUsageAndCompletion(t *testing.T) {
+	t.Run("usage errors", func(t *testing.T) {
+		assert := assert.New(t)
+
+		code, _, errOut := runCLI(t, "", "labels")
+		assert.Equal(2, code)
+		assert.Contains(errOut, "Commands:")
+
+		code, _, errOut = runCLI(t, "", "labels", "unknown")
+		assert.Equal(2, code)
+		assert.Contains(errOut, `unknown command "unknown"`)
+
+		code, _, errOut = runCLI(t, "", "labels", "assign", "urbs")
+		assert.Equal(2, code)
+		assert.Contains(errOut, "usage: urbsctl labels assign PRODUCT LABEL")
+
+		code, _, errOut = runCLI(t, "", "labels", "list", "urbs", "-h")
+		assert.Equal(0, code)
+		assert.Contains(errOut, "-page-size")
+
+		code, _, errOut = runCLI(t, "", "labels", "list", "urbs", "-server", "http://localhost", "-o", "xml")
+		assert.NotEqual(0, code)
+		assert.Contains(errOut, "urbsctl:")
+	})
+
+	t.Run("completion", func(t *testing.T) {
+		assert := assert.New(t)
+
+		code, out, _ := runCLI(t, "", "completion", "bash")
+		assert.Equal(0, code)
+		assert.Contains(out, "complete -o default -F _urbsctl urbsctl")
+		code, out, _ = runCLI(t, "", "completion", "zsh")
+		assert.Equal(0, code)
+		assert.Contains(out, "compdef _urbsctl urbsctl")
+
+		assert.Equal([]string{"labels"}, complete(rootCommand, []string{"lab"}))
+		assert.Equal([]string{"assign"}, complete(rootCommand, []string{"-o", "json", "labels", "as"}))
+		assert.Equal([]string{"-users", "-users-file"}, complete(rootCommand, []string{"labels", "assign", "-us"}))
+		assert.Nil(complete(rootCommand, []string{"labels", "assign", "-users-file", ""}))
+		assert.Nil(complete(rootCommand, []string{"labels", "assign", "urbs", ""}))
+		assert.NotContains(complete(rootCommand, []string{""}), "__complete")
+
+		code, out, _ = runCLI(t, "", "__complete", "settings", "-o", "json", "re")
+		assert.Equal(0, code)
+		assert.Equal("recall\n", out)
+	})
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v2"
+)
+
+// preferredColumns 表格输出时未指定列的情况下优先显示的字段，其余字段按字母序排在后面
+var preferredColumns = []string{"hid", "uid", "kind", "name", "product", "module", "setting", "label", "user", "group",
+	"value", "release", "desc", "status"}
+
+// printResult 按 -output 格式输出接口返回的 result，columns 为表格输出的列，为空时自动选择
+func (c *cli) printResult(res *response, columns []string) error {
+	val, err := decodeResult(res.Result)
+	if err != nil {
+		return err
+	}
+
+	switch c.opts.output {
+	case "json":
+		data, err := json.MarshalIndent(val, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(c.stdout, "%s\n", data)
+		return err
+	case "yaml":
+		data, err := yaml.Marshal(val)
+		if err != nil {
+			return err
+		}
+		_, err = c.stdout.Write(data)
+		return err
+	case "", "table":
+		if err := printTable(c.stdout, val, columns); err != nil {
+			return err
+		}
+		if res.NextPageToken != "" {
+			fmt.Fprintf(c.stderr, "more results available, use -page-token %s or -all\n", res.NextPageToken)
+		}
+		return nil
+	default:
+		return usageErrorf("invalid output format %q, should be table, json or yaml", c.opts.output)
+	}
+}
+
+// decodeResult 解析 result，整数保持为 int64，以便 YAML 和表格中不出现科学计数法
+func decodeResult(raw json.RawMessage) (interface{}, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var val interface{}
+	if err := dec.Decode(&val); err != nil {
+		return nil, err
+	}
+	return normalize(val), nil
+}
+
+func normalize(val interface{}) interface{} {
+	switch v := val.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = normalize(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalize(item)
+		}
+	}
+	return val
+}
+
+func printTable(w io.Writer, val interface{}, columns []string) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	switch v := val.(type) {
+	case []interface{}:
+		rows := make([]map[string]interface{}, 0, len(v))
+		for _, item := range v {
+			if m, ok := item.(map[string]interface{}); ok {
+				rows = append(rows, m)
+			} else {
+				rows = append(rows, map[string]interface{}{"value": item})
+			}
+		}
+		if len(columns) == 0 {
+			columns = autoColumns(rows)
+		}
+		header := make([]string, len(columns))
+		for i, col := range columns {
+			header[i] = strings.ToUpper(col)
+		}
+		fmt.Fprintln(tw, strings.Join(header, "\t"))
+		for _, row := range rows {
+			cells := make([]string, len(columns))
+			for i, col := range columns {
+				cells[i] = formatCell(row[col])
+			}
+			fmt.Fprintln(tw, strings.Join(cells, "\t"))
+		}
+	case map[string]interface{}:
+		keys := columns
+		if len(keys) == 0 {
+			keys = autoColumns([]map[string]interface{}{v})
+		}
+		for _, k := range keys {
+			fmt.Fprintf(tw, "%s:\t%s\n", k, formatCell(v[k]))
+		}
+	default:
+		fmt.Fprintln(tw, formatCell(v))
+	}
+	return tw.Flush()
+}
+
+// autoColumns 返回所有行中出现的标量字段，嵌套对象不在表格中显示
+func autoColumns(rows []map[string]interface{}) []string {
+	seen := map[string]bool{}
+	for _, row := range rows {
+		for k, v := range row {
+			if _, ok := v.(map[string]interface{}); !ok {
+				seen[k] = true
+			}
+		}
+	}
+	columns := []string{}
+	for _, k := range preferredColumns {
+		if seen[k] {
+			columns = append(columns, k)
+			delete(seen, k)
+		}
+	}
+	rest := []string{}
+	for k := range seen {
+		rest = append(rest, k)
+	}
+	sort.Strings(rest)
+	return append(columns, rest...)
+}
+
+func formatCell(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return "-"
+	case string:
+		if v == "" {
+			return "-"
+		}
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case []interface{}:
+		if len(v) == 0 {
+			return "-"
+		}
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = formatCell(item)
+		}
+		return strings.Join(items, ",")
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
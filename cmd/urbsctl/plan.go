@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// configPlan 声明式配置 plan、apply 接口的返回结果，与 tpl.ProductConfigPlan 对应
+type configPlan struct {
+	Product    string     `json:"product"`
+	Prune      bool       `json:"prune"`
+	Operations []configOp `json:"operations"`
+}
+
+type configOp struct {
+	Op     string                 `json:"op"`
+	Kind   string                 `json:"kind"`
+	Target string                 `json:"target"`
+	Before map[string]interface{} `json:"before"`
+	After  map[string]interface{} `json:"after"`
+	Reason string                 `json:"reason"`
+}
+
+// promoteResult 复制、推广接口的返回结果，与 tpl.ProductPromoteResult 对应
+type promoteResult struct {
+	Source     string     `json:"source"`
+	Target     string     `json:"target"`
+	DryRun     bool       `json:"dryRun"`
+	Operations []configOp `json:"operations"`
+	Conflicts  []configOp `json:"conflicts"`
+}
+
+var opSymbols = map[string]string{"create": "+", "assign": "+", "update": "~", "offline": "-", "delete": "-"}
+
+var exportCommand = &command{
+	Name: "export", Args: "PRODUCT", Desc: "Export modules, settings, labels and rules of a product as YAML", MinArgs: 1, MaxArgs: 1,
+	Setup: func(fs *flag.FlagSet) func(c *cli, args []string) error {
+		return func(c *cli, args []string) error {
+			cl, err := c.api()
+			if err != nil {
+				return err
+			}
+			// 表格不适合展示嵌套的配置，默认输出 YAML
+			if c.opts.output == "json" {
+				res, err := cl.do(http.MethodGet, pathf("/v1/products/%s:export", args[0]), nil, nil)
+				if err != nil {
+					return err
+				}
+				return c.printResult(res, nil)
+			}
+			q := url.Values{}
+			q.Set("format", "yaml")
+			data, _, err := cl.send(http.MethodGet, pathf("/v1/products/%s:export", args[0]), q, "", nil)
+			if err != nil {
+				return err
+			}
+			_, err = c.stdout.Write(data)
+			return err
+		}
+	},
+}
+
+var planCommand = &command{
+	Name: "plan", Args: "PRODUCT FILE", Desc: "Show operations to sync a product with a YAML file, \"-\" reads stdin", MinArgs: 2, MaxArgs: 2,
+	Setup: func(fs *flag.FlagSet) func(c *cli, args []string) error {
+		prune := fs.Bool("prune", false, "include offline and delete operations for objects missing from the file")
+		return func(c *cli, args []string) error {
+			return c.syncConfig("plan", args[0], args[1], *prune)
+		}
+	},
+}
+
+var applyCommand = &command{
+	Name: "apply", Args: "PRODUCT FILE", Desc: "Sync a product with a YAML file, \"-\" reads stdin", MinArgs: 2, MaxArgs: 2,
+	Setup: func(fs *flag.FlagSet) func(c *cli, args []string) error {
+		prune := fs.Bool("prune", false, "take offline or delete objects missing from the file")
+		return func(c *cli, args []string) error {
+			return c.syncConfig("apply", args[0], args[1], *prune)
+		}
+	},
+}
+
+var cloneCommand = &command{
+	Name: "clone", Args: "PRODUCT TARGET", Desc: "Copy all modules, settings, labels and rules of a product into the target product, creating it if missing", MinArgs: 2, MaxArgs: 2,
+	Setup: func(fs *flag.FlagSet) func(c *cli, args []string) error {
+		desc := fs.String("desc", "", "description of the target product when it is created")
+		po := registerPromoteOptions(fs)
+		return func(c *cli, args []string) error {
+			body := po.body(args[1])
+			body["desc"] = *desc
+			return c.promote("clone", args[0], body)
+		}
+	},
+}
+
+var promoteCommand = &command{
+	Name: "promote", Args: "PRODUCT TARGET", Desc: "Copy chosen modules, settings and labels of a product into the target product", MinArgs: 2, MaxArgs: 2,
+	Setup: func(fs *flag.FlagSet) func(c *cli, args []string) error {
+		modules := &optList{}
+		labels := &optList{}
+		fs.Var(modules, "modules", "comma separated modules (web) or settings (web/theme) to promote")
+		fs.Var(labels, "labels", "comma separated labels to promote")
+		po := registerPromoteOptions(fs)
+		return func(c *cli, args []string) error {
+			if len(modules.vals) == 0 && len(labels.vals) == 0 {
+				return fmt.Errorf("-modules or -labels required")
+			}
+			body := po.body(args[1])
+			body["modules"] = modules.vals
+			body["labels"] = labels.vals
+			return c.promote("promote", args[0], body)
+		}
+	},
+}
+
+// promoteOptions 复制、推广命令的公共参数
+type promoteOptions struct {
+	groups    bool
+	overwrite bool
+	dryRun    bool
+}
+
+func registerPromoteOptions(fs *flag.FlagSet) *promoteOptions {
+	po := &promoteOptions{}
+	fs.BoolVar(&po.groups, "groups", false, "also assign the groups of labels and settings in the target product")
+	fs.BoolVar(&po.overwrite, "overwrite", false, "replace conflicting objects in the target product instead of reporting them")
+	fs.BoolVar(&po.dryRun, "dry-run", false, "only show operations and conflicts")
+	return po
+}
+
+func (po *promoteOptions) body(target string) map[string]interface{} {
+	return map[string]interface{}{
+		"target":    target,
+		"groups":    po.groups,
+		"overwrite": po.overwrite,
+		"dryRun":    po.dryRun,
+	}
+}
+
+// promote 请求复制或推广接口，输出操作和冲突
+func (c *cli) promote(action, product string, body map[string]interface{}) error {
+	cl, err := c.api()
+	if err != nil {
+		return err
+	}
+	res, err := cl.do(http.MethodPost, pathf("/v1/products/%s:"+action, product), nil, body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode == http.StatusAccepted {
+		fmt.Fprintln(c.stderr, "the target product is protected, a change request was created and is pending approval")
+		return c.printResult(res, nil)
+	}
+	if c.opts.output != "" && c.opts.output != "table" {
+		return c.printResult(res, nil)
+	}
+
+	result := promoteResult{}
+	if err := json.Unmarshal(res.Result, &result); err != nil {
+		return fmt.Errorf("invalid response from %s %s: %v", action, product, err)
+	}
+	mode := "apply"
+	if result.DryRun {
+		mode = "plan"
+	}
+	printPlan(c.stdout, mode, configPlan{Product: result.Target, Operations: result.Operations})
+	for _, op := range result.Conflicts {
+		fmt.Fprintf(c.stdout, "! conflict %s %s: %s\n", op.Kind, op.Target, op.Reason)
+		for _, line := range changedFields(op.Before, op.After) {
+			fmt.Fprintf(c.stdout, "    %s\n", line)
+		}
+	}
+	if n := len(result.Conflicts); n > 0 {
+		fmt.Fprintf(c.stdout, "%d conflicts left unchanged, use -overwrite to replace them.\n", n)
+	}
+	return nil
+}
+
+// syncConfig 把声明式配置文件提交到 plan 或 apply 接口并输出操作
+func (c *cli) syncConfig(action, product, file string, prune bool) error {
+	var data []byte
+	var err error
+	if file == "-" {
+		data, err = ioutil.ReadAll(c.stdin)
+	} else {
+		data, err = ioutil.ReadFile(file)
+	}
+	if err != nil {
+		return err
+	}
+
+	cl, err := c.api()
+	if err != nil {
+		return err
+	}
+	q := url.Values{}
+	if prune {
+		q.Set("prune", "true")
+	}
+	raw, status, err := cl.send(http.MethodPost, pathf("/v1/products/%s:"+action, product), q, "application/yaml", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	res := &response{StatusCode: status}
+	if err := json.Unmarshal(raw, res); err != nil {
+		return fmt.Errorf("invalid response from %s %s: %v", action, product, err)
+	}
+	if status == http.StatusAccepted {
+		fmt.Fprintln(c.stderr, "the product is protected, a change request was created and is pending approval")
+		return c.printResult(res, nil)
+	}
+	if c.opts.output != "" && c.opts.output != "table" {
+		return c.printResult(res, nil)
+	}
+
+	plan := configPlan{}
+	if err := json.Unmarshal(res.Result, &plan); err != nil {
+		return fmt.Errorf("invalid response from %s %s: %v", action, product, err)
+	}
+	printPlan(c.stdout, action, plan)
+	return nil
+}
+
+// printPlan 逐行输出操作，更新操作附带变化的字段
+func printPlan(w io.Writer, action string, plan configPlan) {
+	counts := map[string]int{}
+	for _, op := range plan.Operations {
+		counts[op.Op]++
+		symbol := opSymbols[op.Op]
+		if symbol == "" {
+			symbol = "?"
+		}
+		fmt.Fprintf(w, "%s %s %s %s\n", symbol, op.Op, op.Kind, op.Target)
+		if op.Op == "update" {
+			for _, line := range changedFields(op.Before, op.After) {
+				fmt.Fprintf(w, "    %s\n", line)
+			}
+		}
+	}
+
+	if len(plan.Operations) == 0 {
+		fmt.Fprintln(w, "No changes, the product is up to date.")
+		return
+	}
+	format := "Plan: %d to create, %d to update, %d to offline or delete.\n"
+	if action == "apply" {
+		format = "Applied: %d created, %d updated, %d taken offline or deleted.\n"
+	}
+	fmt.Fprintf(w, format, counts["create"]+counts["assign"], counts["update"], counts["offline"]+counts["delete"])
+}
+
+// changedFields 返回 before、after 中值不同的字段，格式为 key: before -> after
+func changedFields(before, after map[string]interface{}) []string {
+	keys := []string{}
+	seen := map[string]bool{}
+	for _, m := range []map[string]interface{}{before, after} {
+		for k := range m {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Strings(keys)
+
+	lines := []string{}
+	for _, k := range keys {
+		b, _ := json.Marshal(before[k])
+		a, _ := json.Marshal(after[k])
+		if string(a) != string(b) {
+			lines = append(lines, fmt.Sprintf("%s: %s -> %s", k, strings.TrimSpace(string(b)), strings.TrimSpace(string(a))))
+		}
+	}
+	return lines
+}
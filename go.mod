@@ -4,15 +4,23 @@ go 1.14
 
 require (
 	github.com/DavidCai1993/request v0.0.0-20171115020405-aad722fa9b76
+	github.com/alicebob/miniredis/v2 v2.14.1
 	github.com/doug-martin/goqu/v9 v9.10.0
+	github.com/go-http-utils/headers v0.0.0-20181008091004-fed159eddc2a // indirect
+	github.com/go-redis/redis/v8 v8.4.0
 	github.com/go-sql-driver/mysql v1.5.0
 	github.com/open-trust/ot-go-lib v0.3.0
-	github.com/opentracing/opentracing-go v1.2.0 // indirect
-	github.com/stretchr/testify v1.5.1
+	github.com/prometheus/client_golang v1.9.0
+	github.com/stretchr/testify v1.6.1
 	github.com/teambition/gear v1.21.6
 	github.com/teambition/gear-auth v1.7.0
-	github.com/teambition/gear-tracing v1.1.1
+	go.opentelemetry.io/otel v0.14.0
+	go.opentelemetry.io/otel/exporters/otlp v0.14.0
+	go.opentelemetry.io/otel/exporters/stdout v0.14.0
+	go.opentelemetry.io/otel/sdk v0.14.0
 	go.uber.org/dig v1.10.0
+	golang.org/x/lint v0.0.0-20200302205851-738671d3881b // indirect
+	golang.org/x/sync v0.0.0-20200625203802-6e8e738ad208
 	golang.org/x/tools v0.0.0-20200917221617-d56e4e40bc9d // indirect
 	gopkg.in/yaml.v2 v2.3.0
 )
@@ -1,14 +1,19 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/teambition/urbs-setting/src/api"
+	"github.com/teambition/urbs-setting/src/bll"
 	"github.com/teambition/urbs-setting/src/conf"
 	"github.com/teambition/urbs-setting/src/logging"
+	"github.com/teambition/urbs-setting/src/tracing"
+	"github.com/teambition/urbs-setting/src/util"
 )
 
 var help = flag.Bool("help", false, "show help info")
@@ -26,6 +31,19 @@ func main() {
 		conf.Config.SrvAddr = ":8081"
 	}
 
+	cfg := conf.Config.Tracing
+	shutdownTracing, err := tracing.Init(tracing.Options{
+		ServiceName:    api.AppName,
+		ServiceVersion: api.AppVersion,
+		Exporter:       cfg.Exporter,
+		Endpoint:       cfg.Endpoint,
+		Insecure:       cfg.Insecure,
+		SampleRatio:    cfg.SampleRatio,
+	})
+	if err != nil {
+		logging.Panicf("Init tracing error: %v", err)
+	}
+
 	app := api.NewApp()
 	ctx := conf.Config.GlobalCtx
 	host := "http://" + conf.Config.SrvAddr
@@ -34,5 +52,33 @@ func main() {
 	}
 	logging.Infof("Urbs-Setting start on %s", host)
 	logging.Errf("Urbs-Setting closed %v", app.ListenWithContext(
-		ctx, conf.Config.SrvAddr, conf.Config.CertFile, conf.Config.KeyFile))
+		delayContext(ctx, conf.Config.Healthz.ShutdownDelayDuration()), conf.Config.SrvAddr, conf.Config.CertFile, conf.Config.KeyFile))
+
+	sctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// 写入剩余的按天统计计数
+	_ = util.DigInvoke(func(blls *bll.Blls) error {
+		return blls.Statistic.Flush(sctx)
+	})
+	// 导出剩余的 span
+	if err := shutdownTracing(sctx); err != nil {
+		logging.Errf("Shutdown tracing error: %v", err)
+	}
+}
+
+// delayContext 返回在 ctx 结束 delay 时间后才结束的 context。
+// 收到退出信号后 /readyz 立即返回 503，服务继续处理请求直到负载均衡摘除实例
+func delayContext(ctx context.Context, delay time.Duration) context.Context {
+	if delay <= 0 {
+		return ctx
+	}
+
+	delayed, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-ctx.Done()
+		logging.Infof("Urbs-Setting shutting down in %s", delay)
+		time.Sleep(delay)
+		cancel()
+	}()
+	return delayed
 }
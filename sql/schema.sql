@@ -6,12 +6,24 @@ CREATE TABLE IF NOT EXISTS `urbs`.`urbs_user` (
   `created_at` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
   `active_at` bigint NOT NULL DEFAULT 0,
   `uid` varchar(63) NOT NULL,
-  `labels` varchar(8190) NOT NULL DEFAULT '',
   PRIMARY KEY (`id`),
   UNIQUE KEY `uk_user_uid` (`uid`),
   KEY `idx_user_active_at` (`active_at`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
 
+CREATE TABLE IF NOT EXISTS `urbs`.`urbs_user_archive` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `created_at` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+  `user_id` bigint NOT NULL,
+  `uid` varchar(63) NOT NULL,
+  `user_created_at` datetime(3) NOT NULL,
+  `active_at` bigint NOT NULL DEFAULT 0,
+  `data` mediumtext NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_user_archive_uid` (`uid`),
+  KEY `idx_user_archive_created_at` (`created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
  CREATE TABLE IF NOT EXISTS `urbs`.`urbs_group` (
   `id` bigint NOT NULL AUTO_INCREMENT,
   `created_at` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
@@ -35,6 +47,7 @@ CREATE TABLE IF NOT EXISTS `urbs`.`urbs_product` (
   `name` varchar(63) NOT NULL,
   `description` varchar(1022) NOT NULL DEFAULT '',
   `status` bigint NOT NULL  DEFAULT 0,
+  `protected` tinyint(1) NOT NULL DEFAULT 0,
   PRIMARY KEY (`id`),
   UNIQUE KEY `uk_product_name` (`name`),
   KEY `idx_product_created_at` (`created_at`)
@@ -51,7 +64,9 @@ CREATE TABLE IF NOT EXISTS `urbs`.`urbs_label` (
   `channels` varchar(255) NOT NULL DEFAULT '', -- split by comma
   `clients` varchar(255) NOT NULL DEFAULT '', -- split by comma
   `status` bigint NOT NULL DEFAULT 0,
+  `exact_status` bigint NOT NULL DEFAULT 0,
   `rls` bigint NOT NULL DEFAULT 0,
+  `reconciled_at` datetime(3) DEFAULT NULL,
   PRIMARY KEY (`id`),
   UNIQUE KEY `uk_label_product_id_name` (`product_id`,`name`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
@@ -81,7 +96,9 @@ CREATE TABLE IF NOT EXISTS `urbs`.`urbs_setting` (
   `clients` varchar(255) NOT NULL DEFAULT '', -- split by comma
   `vals` varchar(1022) NOT NULL DEFAULT '', -- split by comma
   `status` bigint NOT NULL DEFAULT 0,
+  `exact_status` bigint NOT NULL DEFAULT 0,
   `rls` bigint NOT NULL DEFAULT 0,
+  `reconciled_at` datetime(3) DEFAULT NULL,
   PRIMARY KEY (`id`),
   UNIQUE KEY `uk_setting_module_id_name` (`module_id`,`name`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
@@ -108,6 +125,19 @@ CREATE TABLE IF NOT EXISTS `urbs`.`user_label` (
   KEY `idx_user_label_label_id` (`label_id`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
 
+CREATE TABLE IF NOT EXISTS `urbs`.`user_label_cache` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `created_at` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+  `updated_at` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3) ON UPDATE CURRENT_TIMESTAMP(3),
+  `user_id` bigint NOT NULL,
+  `product_id` bigint NOT NULL,
+  `active_at` bigint NOT NULL DEFAULT 0,
+  `labels` mediumtext NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_user_label_cache_user_id_product_id` (`user_id`,`product_id`),
+  KEY `idx_user_label_cache_product_id` (`product_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
 CREATE TABLE IF NOT EXISTS `urbs`.`user_setting` (
   `id` bigint NOT NULL AUTO_INCREMENT,
   `created_at` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
@@ -196,3 +226,169 @@ CREATE TABLE IF NOT EXISTS `urbs`.`urbs_lock` (
   PRIMARY KEY (`id`),
   UNIQUE KEY `uk_urbs_lock_name` (`name`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE IF NOT EXISTS `urbs`.`urbs_job` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `created_at` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+  `updated_at` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3) ON UPDATE CURRENT_TIMESTAMP(3),
+  `kind` varchar(63) NOT NULL,
+  `target` varchar(255) NOT NULL DEFAULT '',
+  `status` varchar(15) NOT NULL DEFAULT 'running',
+  `processed` bigint NOT NULL DEFAULT 0,
+  `invalidated` bigint NOT NULL DEFAULT 0,
+  `failed` bigint NOT NULL DEFAULT 0,
+  `message` varchar(1022) NOT NULL DEFAULT '',
+  `finished_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_job_kind` (`kind`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE IF NOT EXISTS `urbs`.`urbs_job_error` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `job_id` bigint NOT NULL,
+  `line` bigint NOT NULL,
+  `uid` varchar(63) NOT NULL DEFAULT '',
+  `message` varchar(1022) NOT NULL DEFAULT '',
+  PRIMARY KEY (`id`),
+  KEY `idx_job_error_job_id` (`job_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE IF NOT EXISTS `urbs`.`urbs_audit_log` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `created_at` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+  `actor` varchar(255) NOT NULL DEFAULT '',
+  `action` varchar(255) NOT NULL,
+  `product` varchar(63) NOT NULL DEFAULT '',
+  `target` varchar(1022) NOT NULL,
+  `status` int NOT NULL DEFAULT 0,
+  `body` mediumtext NOT NULL,
+  `before` mediumtext NOT NULL,
+  `after` mediumtext NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_audit_log_created_at` (`created_at`),
+  KEY `idx_audit_log_product` (`product`),
+  KEY `idx_audit_log_actor` (`actor`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE IF NOT EXISTS `urbs`.`urbs_version` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `created_at` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+  `kind` varchar(15) NOT NULL,
+  `object_id` bigint NOT NULL,
+  `version` bigint NOT NULL,
+  `actor` varchar(255) NOT NULL DEFAULT '',
+  `restored` bigint NOT NULL DEFAULT 0,
+  `snapshot` mediumtext NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_version_kind_object_id_version` (`kind`,`object_id`,`version`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE IF NOT EXISTS `urbs`.`urbs_webhook` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `created_at` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+  `updated_at` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3) ON UPDATE CURRENT_TIMESTAMP(3),
+  `product_id` bigint NOT NULL,
+  `url` varchar(1022) NOT NULL,
+  `events` varchar(1022) NOT NULL DEFAULT '',
+  `secret` varchar(255) NOT NULL DEFAULT '',
+  PRIMARY KEY (`id`),
+  KEY `idx_webhook_product_id` (`product_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE IF NOT EXISTS `urbs`.`urbs_webhook_delivery` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `created_at` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+  `updated_at` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3) ON UPDATE CURRENT_TIMESTAMP(3),
+  `webhook_id` bigint NOT NULL,
+  `event` varchar(63) NOT NULL,
+  `payload` mediumtext NOT NULL,
+  `status` varchar(15) NOT NULL DEFAULT 'pending',
+  `attempts` int NOT NULL DEFAULT 0,
+  `code` int NOT NULL DEFAULT 0,
+  `message` varchar(1022) NOT NULL DEFAULT '',
+  `next_at` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+  `delivered_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_webhook_delivery_webhook_id` (`webhook_id`),
+  KEY `idx_webhook_delivery_status_next_at` (`status`,`next_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE IF NOT EXISTS `urbs`.`urbs_change` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `seq` bigint DEFAULT NULL,
+  `created_at` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+  `product` varchar(63) NOT NULL DEFAULT '',
+  `event` varchar(63) NOT NULL,
+  `data` mediumtext NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_change_seq` (`seq`),
+  KEY `idx_change_product` (`product`),
+  KEY `idx_change_created_at` (`created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE IF NOT EXISTS `urbs`.`urbs_role_binding` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `created_at` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+  `updated_at` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3) ON UPDATE CURRENT_TIMESTAMP(3),
+  `subject` varchar(255) NOT NULL,
+  `product_id` bigint NOT NULL DEFAULT 0,
+  `role` varchar(15) NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_role_binding_subject_product_id` (`subject`,`product_id`),
+  KEY `idx_role_binding_product_id` (`product_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE IF NOT EXISTS `urbs`.`urbs_api_key` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `created_at` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+  `updated_at` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3) ON UPDATE CURRENT_TIMESTAMP(3),
+  `name` varchar(63) NOT NULL,
+  `hash` char(64) NOT NULL,
+  `scopes` varchar(1022) NOT NULL DEFAULT '',
+  `created_by` varchar(255) NOT NULL DEFAULT '',
+  `expired_at` datetime(3) DEFAULT NULL,
+  `revoked_at` datetime(3) DEFAULT NULL,
+  `last_used_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE IF NOT EXISTS `urbs`.`urbs_change_request` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `created_at` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+  `updated_at` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3) ON UPDATE CURRENT_TIMESTAMP(3),
+  `product_id` bigint NOT NULL,
+  `action` varchar(63) NOT NULL,
+  `target` varchar(1022) NOT NULL DEFAULT '',
+  `payload` mediumtext NOT NULL,
+  `status` varchar(15) NOT NULL DEFAULT 'pending',
+  `created_by` varchar(255) NOT NULL DEFAULT '',
+  `decided_by` varchar(255) NOT NULL DEFAULT '',
+  `decided_at` datetime(3) DEFAULT NULL,
+  `reason` varchar(1022) NOT NULL DEFAULT '',
+  `result` mediumtext NOT NULL,
+  `expired_at` datetime(3) NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_change_request_product_id` (`product_id`),
+  KEY `idx_change_request_status_expired_at` (`status`, `expired_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE IF NOT EXISTS `urbs`.`urbs_statistic_daily` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `day` date NOT NULL,
+  `product_id` bigint NOT NULL,
+  `metric` varchar(63) NOT NULL,
+  `kind` varchar(63) NOT NULL,
+  `object_id` bigint NOT NULL DEFAULT 0,
+  `value` bigint NOT NULL DEFAULT 0,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_statistic_daily_product_id_metric_kind_object_id_day` (`product_id`,`metric`,`kind`,`object_id`,`day`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE IF NOT EXISTS `urbs`.`urbs_heartbeat` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `updated_at` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3) ON UPDATE CURRENT_TIMESTAMP(3),
+  `name` varchar(127) NOT NULL,
+  `beat_at` bigint NOT NULL DEFAULT 0,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_urbs_heartbeat_name` (`name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
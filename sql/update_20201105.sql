@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS `urbs`.`user_label_cache` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `created_at` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+  `updated_at` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3) ON UPDATE CURRENT_TIMESTAMP(3),
+  `user_id` bigint NOT NULL,
+  `product_id` bigint NOT NULL,
+  `active_at` bigint NOT NULL DEFAULT 0,
+  `labels` mediumtext NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_user_label_cache_user_id_product_id` (`user_id`,`product_id`),
+  KEY `idx_user_label_cache_product_id` (`product_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+-- 迁移 urbs_user.labels 中的缓存数据，被截断的非法 JSON 数据直接丢弃，下次访问时会重新刷新
+INSERT IGNORE INTO `urbs`.`user_label_cache` (`user_id`, `product_id`, `active_at`, `labels`)
+  SELECT `u`.`id`, `p`.`id`,
+    IFNULL(CAST(JSON_UNQUOTE(JSON_EXTRACT(`u`.`labels`, CONCAT('$."', `p`.`name`, '".activeAt'))) AS SIGNED), 0),
+    IFNULL(JSON_EXTRACT(`u`.`labels`, CONCAT('$."', `p`.`name`, '".labels')), '[]')
+  FROM `urbs`.`urbs_user` AS `u`, `urbs`.`urbs_product` AS `p`
+  WHERE `u`.`labels` <> '' AND JSON_VALID(`u`.`labels`)
+    AND JSON_CONTAINS_PATH(`u`.`labels`, 'one', CONCAT('$."', `p`.`name`, '"'));
+
+ALTER TABLE `urbs`.`urbs_user` DROP COLUMN `labels`;
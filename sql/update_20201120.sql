@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS `urbs`.`urbs_user_archive` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `created_at` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+  `user_id` bigint NOT NULL,
+  `uid` varchar(63) NOT NULL,
+  `user_created_at` datetime(3) NOT NULL,
+  `active_at` bigint NOT NULL DEFAULT 0,
+  `data` mediumtext NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_user_archive_uid` (`uid`),
+  KEY `idx_user_archive_created_at` (`created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS `urbs`.`urbs_job` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `created_at` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+  `updated_at` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3) ON UPDATE CURRENT_TIMESTAMP(3),
+  `kind` varchar(63) NOT NULL,
+  `target` varchar(255) NOT NULL DEFAULT '',
+  `status` varchar(15) NOT NULL DEFAULT 'running',
+  `processed` bigint NOT NULL DEFAULT 0,
+  `invalidated` bigint NOT NULL DEFAULT 0,
+  `message` varchar(1022) NOT NULL DEFAULT '',
+  `finished_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_job_kind` (`kind`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS `urbs`.`urbs_audit_log` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `created_at` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+  `actor` varchar(255) NOT NULL DEFAULT '',
+  `action` varchar(255) NOT NULL,
+  `product` varchar(63) NOT NULL DEFAULT '',
+  `target` varchar(1022) NOT NULL,
+  `status` int NOT NULL DEFAULT 0,
+  `body` mediumtext NOT NULL,
+  `before` mediumtext NOT NULL,
+  `after` mediumtext NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_audit_log_created_at` (`created_at`),
+  KEY `idx_audit_log_product` (`product`),
+  KEY `idx_audit_log_actor` (`actor`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS `urbs`.`urbs_version` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `created_at` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+  `kind` varchar(15) NOT NULL,
+  `object_id` bigint NOT NULL,
+  `version` bigint NOT NULL,
+  `actor` varchar(255) NOT NULL DEFAULT '',
+  `restored` bigint NOT NULL DEFAULT 0,
+  `snapshot` mediumtext NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_version_kind_object_id_version` (`kind`,`object_id`,`version`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS `urbs`.`urbs_webhook` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `created_at` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+  `updated_at` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3) ON UPDATE CURRENT_TIMESTAMP(3),
+  `product_id` bigint NOT NULL,
+  `url` varchar(1022) NOT NULL,
+  `events` varchar(1022) NOT NULL DEFAULT '',
+  `secret` varchar(255) NOT NULL DEFAULT '',
+  PRIMARY KEY (`id`),
+  KEY `idx_webhook_product_id` (`product_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE IF NOT EXISTS `urbs`.`urbs_webhook_delivery` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `created_at` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+  `updated_at` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3) ON UPDATE CURRENT_TIMESTAMP(3),
+  `webhook_id` bigint NOT NULL,
+  `event` varchar(63) NOT NULL,
+  `payload` mediumtext NOT NULL,
+  `status` varchar(15) NOT NULL DEFAULT 'pending',
+  `attempts` int NOT NULL DEFAULT 0,
+  `code` int NOT NULL DEFAULT 0,
+  `message` varchar(1022) NOT NULL DEFAULT '',
+  `next_at` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+  `delivered_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_webhook_delivery_webhook_id` (`webhook_id`),
+  KEY `idx_webhook_delivery_status_next_at` (`status`,`next_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS `urbs`.`urbs_change` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `created_at` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+  `product` varchar(63) NOT NULL DEFAULT '',
+  `event` varchar(63) NOT NULL,
+  `data` mediumtext NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_change_product` (`product`),
+  KEY `idx_change_created_at` (`created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS `urbs`.`urbs_role_binding` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `created_at` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+  `updated_at` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3) ON UPDATE CURRENT_TIMESTAMP(3),
+  `subject` varchar(255) NOT NULL,
+  `product_id` bigint NOT NULL DEFAULT 0,
+  `role` varchar(15) NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_role_binding_subject_product_id` (`subject`,`product_id`),
+  KEY `idx_role_binding_product_id` (`product_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
@@ -0,0 +1,21 @@
+ALTER TABLE `urbs`.`urbs_product` ADD COLUMN `protected` tinyint(1) NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS `urbs`.`urbs_change_request` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `created_at` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+  `updated_at` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3) ON UPDATE CURRENT_TIMESTAMP(3),
+  `product_id` bigint NOT NULL,
+  `action` varchar(63) NOT NULL,
+  `target` varchar(1022) NOT NULL DEFAULT '',
+  `payload` mediumtext NOT NULL,
+  `status` varchar(15) NOT NULL DEFAULT 'pending',
+  `created_by` varchar(255) NOT NULL DEFAULT '',
+  `decided_by` varchar(255) NOT NULL DEFAULT '',
+  `decided_at` datetime(3) DEFAULT NULL,
+  `reason` varchar(1022) NOT NULL DEFAULT '',
+  `result` mediumtext NOT NULL,
+  `expired_at` datetime(3) NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_change_request_product_id` (`product_id`),
+  KEY `idx_change_request_status_expired_at` (`status`, `expired_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
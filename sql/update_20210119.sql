@@ -0,0 +1,11 @@
+ALTER TABLE `urbs`.`urbs_job` ADD COLUMN `failed` bigint NOT NULL DEFAULT 0 AFTER `invalidated`;
+
+CREATE TABLE IF NOT EXISTS `urbs`.`urbs_job_error` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `job_id` bigint NOT NULL,
+  `line` bigint NOT NULL,
+  `uid` varchar(63) NOT NULL DEFAULT '',
+  `message` varchar(1022) NOT NULL DEFAULT '',
+  PRIMARY KEY (`id`),
+  KEY `idx_job_error_job_id` (`job_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS `urbs`.`urbs_statistic_daily` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `day` date NOT NULL,
+  `product_id` bigint NOT NULL,
+  `metric` varchar(63) NOT NULL,
+  `kind` varchar(63) NOT NULL,
+  `object_id` bigint NOT NULL DEFAULT 0,
+  `value` bigint NOT NULL DEFAULT 0,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_statistic_daily_product_id_metric_kind_object_id_day` (`product_id`,`metric`,`kind`,`object_id`,`day`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
@@ -0,0 +1,4 @@
+ALTER TABLE `urbs`.`urbs_label` ADD COLUMN `exact_status` bigint NOT NULL DEFAULT 0 AFTER `status`;
+ALTER TABLE `urbs`.`urbs_label` ADD COLUMN `reconciled_at` datetime(3) DEFAULT NULL AFTER `rls`;
+ALTER TABLE `urbs`.`urbs_setting` ADD COLUMN `exact_status` bigint NOT NULL DEFAULT 0 AFTER `status`;
+ALTER TABLE `urbs`.`urbs_setting` ADD COLUMN `reconciled_at` datetime(3) DEFAULT NULL AFTER `rls`;
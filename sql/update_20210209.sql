@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS `urbs`.`urbs_heartbeat` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `updated_at` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3) ON UPDATE CURRENT_TIMESTAMP(3),
+  `name` varchar(127) NOT NULL,
+  `beat_at` bigint NOT NULL DEFAULT 0,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_urbs_heartbeat_name` (`name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+-- 从库延迟检测的心跳原写入 urbs_statistic，迁移到 urbs_heartbeat
+DELETE FROM `urbs`.`urbs_statistic` WHERE `name` = 'ReplicaHeartbeat';
@@ -0,0 +1,5 @@
+-- 变更流序号：后台任务按提交后可见的顺序分配，取代自增 ID 作为游标，避免长事务提交的较小 ID 落在消费者游标之前
+ALTER TABLE `urbs`.`urbs_change` ADD COLUMN `seq` bigint DEFAULT NULL AFTER `id`;
+ALTER TABLE `urbs`.`urbs_change` ADD UNIQUE KEY `uk_change_seq` (`seq`);
+-- 已有事件的序号即 ID，消费者已保存的游标保持有效
+UPDATE `urbs`.`urbs_change` SET `seq` = `id`;
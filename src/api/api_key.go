@@ -0,0 +1,186 @@
+package api
+
+import (
+	"strings"
+
+	"github.com/teambition/gear"
+	"github.com/teambition/urbs-setting/src/bll"
+	"github.com/teambition/urbs-setting/src/middleware"
+	"github.com/teambition/urbs-setting/src/schema"
+	"github.com/teambition/urbs-setting/src/service"
+	"github.com/teambition/urbs-setting/src/tpl"
+)
+
+// evaluateRoutes read:evaluate 允许的路由，读取用户、群组的环境标签和配置项
+var evaluateRoutes = map[string]bool{
+	"GET /v1/users/:uid/labels":            true,
+	"GET /v1/users/:uid/settings":          true,
+	"GET /v1/users/:uid/settings:unionAll": true,
+	"GET /v1/users/:uid+:exists":           true,
+	"GET /v1/groups/:uid/labels":           true,
+	"GET /v1/groups/:uid/settings":         true,
+	"GET /v1/groups/:uid+:exists":          true,
+}
+
+// assignRoutes write:assign 允许的路由，为用户、群组设置或撤销环境标签和配置项
+var assignRoutes = map[string]bool{
+	"PUT /v1/users/:uid/labels:cache":                                                   true,
+	"POST /v1/products/:product/users/rules:apply":                                      true,
+	"POST /v1/products/:product/labels/:label+:assign":                                  true,
+	"POST /v1/products/:product/labels/:label+:recall":                                  true,
+	"DELETE /v1/products/:product/labels/:label/users/:uid":                             true,
+	"DELETE /v1/products/:product/labels/:label/groups/:uid":                            true,
+	"POST /v1/products/:product/modules/:module/settings/:setting+:assign":              true,
+	"POST /v1/products/:product/modules/:module/settings/:setting+:recall":              true,
+	"PUT /v1/products/:product/modules/:module/settings/:setting/users/:uid+:rollback":  true,
+	"DELETE /v1/products/:product/modules/:module/settings/:setting/users/:uid":         true,
+	"PUT /v1/products/:product/modules/:module/settings/:setting/groups/:uid+:rollback": true,
+	"DELETE /v1/products/:product/modules/:module/settings/:setting/groups/:uid":        true,
+	"POST /v2/products/:product/labels/:label+:assign":                                  true,
+	"POST /v2/products/:product/modules/:module/settings/:setting+:assign":              true,
+}
+
+// checkScopes 检查 API key 的 scopes 是否允许调用路由，不允许时返回 403 错误。
+// 需要 owner 或 admin 角色的路由只允许 admin 或 admin:product:<product> scope
+func checkScopes(scopes []string, method, pattern, product string) error {
+	route := method + " " + pattern
+	if role := requiredRole(method, pattern); role == schema.RoleAdmin || role == schema.RoleOwner {
+		for _, scope := range scopes {
+			if scope == schema.ScopeAdmin ||
+				(product != "" && scope == schema.ScopeAdminProduct+product) {
+				return nil
+			}
+		}
+		return gear.ErrForbidden.WithMsgf("api key scopes %v do not allow %q", scopes, route)
+	}
+
+	isRead := isReadRoute(method, pattern)
+	for _, scope := range scopes {
+		switch {
+		case scope == schema.ScopeAdmin:
+			return nil
+		case strings.HasPrefix(scope, schema.ScopeAdminProduct):
+			if product != "" && scope[len(schema.ScopeAdminProduct):] == product {
+				return nil
+			}
+		case scope == schema.ScopeReadAll:
+			if isRead {
+				return nil
+			}
+		case scope == schema.ScopeReadEvaluate:
+			if evaluateRoutes[route] {
+				return nil
+			}
+		case scope == schema.ScopeWriteAll:
+			if !isRead {
+				return nil
+			}
+		case scope == schema.ScopeWriteAssign:
+			if assignRoutes[route] {
+				return nil
+			}
+		}
+	}
+	return gear.ErrForbidden.WithMsgf("api key scopes %v do not allow %q", scopes, route)
+}
+
+// coveredScopes 检查 scopes 是否包含 want 的全部权限，用于限制 API key 创建超出自身权限的 key
+func coveredScopes(scopes, want []string) bool {
+	for _, w := range want {
+		covered := false
+		for _, scope := range scopes {
+			switch {
+			case scope == w, scope == schema.ScopeAdmin:
+				covered = true
+			case scope == schema.ScopeReadAll && w == schema.ScopeReadEvaluate:
+				covered = true
+			case scope == schema.ScopeWriteAll && w == schema.ScopeWriteAssign:
+				covered = true
+			}
+			if covered {
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+// APIKey ..
+type APIKey struct {
+	blls *bll.Blls
+}
+
+// List ..
+func (a *APIKey) List(ctx *gear.Context) error {
+	req := tpl.Pagination{}
+	if err := ctx.ParseURL(&req); err != nil {
+		return err
+	}
+
+	res, err := a.blls.APIKey.List(ctx, req)
+	if err != nil {
+		return err
+	}
+	return ctx.OkJSON(res)
+}
+
+// Create ..
+func (a *APIKey) Create(ctx *gear.Context) error {
+	body := tpl.APIKeyBody{}
+	if err := ctx.ParseBody(&body); err != nil {
+		return err
+	}
+	if scopes, ok := middleware.Scopes(ctx); ok && !coveredScopes(scopes, body.Scopes) {
+		return gear.ErrForbidden.WithMsgf("api key scopes %v do not cover %v", scopes, body.Scopes)
+	}
+
+	res, err := a.blls.APIKey.Create(ctx, middleware.Subject(ctx), &body)
+	if err != nil {
+		return err
+	}
+	return ctx.OkJSON(res)
+}
+
+// Update ..
+func (a *APIKey) Update(ctx *gear.Context) error {
+	req := tpl.APIKeyURL{}
+	if err := ctx.ParseURL(&req); err != nil {
+		return err
+	}
+
+	body := tpl.APIKeyUpdateBody{}
+	if err := ctx.ParseBody(&body); err != nil {
+		return err
+	}
+
+	keyID := service.HIDToID(req.HID, "api_key")
+	if keyID <= 0 {
+		return gear.ErrBadRequest.WithMsgf("invalid api key hid: %s", req.HID)
+	}
+	res, err := a.blls.APIKey.Update(ctx, keyID, body)
+	if err != nil {
+		return err
+	}
+	return ctx.OkJSON(res)
+}
+
+// Revoke ..
+func (a *APIKey) Revoke(ctx *gear.Context) error {
+	req := tpl.APIKeyURL{}
+	if err := ctx.ParseURL(&req); err != nil {
+		return err
+	}
+
+	keyID := service.HIDToID(req.HID, "api_key")
+	if keyID <= 0 {
+		return gear.ErrBadRequest.WithMsgf("invalid api key hid: %s", req.HID)
+	}
+	res, err := a.blls.APIKey.Revoke(ctx, keyID)
+	if err != nil {
+		return err
+	}
+	return ctx.OkJSON(res)
+}
@@ -0,0 +1,224 @@
+package api
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DavidCai1993/request"
+	"github.com/doug-martin/goqu/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/teambition/urbs-setting/src/schema"
+	"github.com/teambition/urbs-setting/src/tpl"
+)
+
+func TestAPIKeyAPIs(t *testing.T) {
+	tt, cleanup := SetUpTestTools()
+	defer cleanup()
+
+	product, err := createProduct(tt)
+	require.Nil(t, err)
+	label, err := createLabel(tt, product.Name)
+	require.Nil(t, err)
+
+	var key tpl.APIKeyInfo
+	t.Run(`"POST /v1/api-keys" should work`, func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		res, err := request.Post(fmt.Sprintf("%s/v1/api-keys", tt.Host)).
+			Set("Content-Type", "application/json").
+			Send(tpl.APIKeyBody{Name: "gateway", Scopes: []string{schema.ScopeReadEvaluate, schema.ScopeWriteAssign}}).
+			End()
+		require.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		json := tpl.APIKeyInfoRes{}
+		res.JSON(&json)
+		key = json.Result
+		assert.True(key.Active)
+		assert.Equal([]string{schema.ScopeReadEvaluate, schema.ScopeWriteAssign}, key.Scopes)
+		assert.Nil(key.LastUsedAt)
+		require.Contains(key.Key, tpl.APIKeyPrefix+key.HID+"_")
+
+		res, err = request.Post(fmt.Sprintf("%s/v1/api-keys", tt.Host)).
+			Set("Content-Type", "application/json").
+			Send(tpl.APIKeyBody{Name: "gateway", Scopes: []string{"write"}}).
+			End()
+		require.Nil(err)
+		assert.Equal(400, res.StatusCode)
+		res.Content() // close http client
+	})
+
+	t.Run("api key should not be recorded in audit logs", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		time.Sleep(100 * time.Millisecond) // 等待异步写入审计日志
+		logs := make([]schema.AuditLog, 0)
+		err := tt.DB.From(schema.TableAuditLog).
+			Where(goqu.C("action").Eq("POST /v1/api-keys")).
+			ScanStructs(&logs)
+		require.Nil(err)
+		require.True(len(logs) > 0)
+		for _, log := range logs {
+			assert.NotContains(log.After, tpl.APIKeyPrefix)
+			assert.NotContains(log.After, key.Key)
+		}
+		assert.Contains(logs[len(logs)-1].After, key.HID)
+	})
+
+	t.Run("api key should be accepted and limited by scopes", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		res, err := request.Post(fmt.Sprintf("%s/v1/products/%s/labels/%s:assign", tt.Host, product.Name, label.Name)).
+			Set("Authorization", "Bearer "+key.Key).
+			Set("Content-Type", "application/json").
+			Send(tpl.UsersGroupsBody{Users: []string{tpl.RandUID()}}).
+			End()
+		require.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		res.Content() // close http client
+
+		res, err = request.Delete(fmt.Sprintf("%s/v1/products/%s/labels/%s", tt.Host, product.Name, label.Name)).
+			Set("Authorization", "Bearer "+key.Key).
+			End()
+		require.Nil(err)
+		assert.Equal(403, res.StatusCode)
+		res.Content() // close http client
+
+		res, err = request.Get(fmt.Sprintf("%s/v1/products/%s/labels", tt.Host, product.Name)).
+			Set("Authorization", "Bearer "+key.Key+"x").
+			End()
+		require.Nil(err)
+		assert.Equal(401, res.StatusCode)
+		res.Content() // close http client
+
+		time.Sleep(100 * time.Millisecond) // 等待异步更新最近使用时间
+		res, err = request.Get(fmt.Sprintf("%s/v1/api-keys", tt.Host)).
+			End()
+		require.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		json := tpl.APIKeysInfoRes{}
+		res.JSON(&json)
+		require.True(len(json.Result) > 0)
+		assert.Equal(key.HID, json.Result[0].HID)
+		assert.Equal("", json.Result[0].Key)
+		assert.NotNil(json.Result[0].LastUsedAt)
+	})
+
+	t.Run(`"PUT /v1/api-keys/:hid" should expire the key`, func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		expiredAt := time.Now().Add(-time.Second)
+		res, err := request.Put(fmt.Sprintf("%s/v1/api-keys/%s", tt.Host, key.HID)).
+			Set("Content-Type", "application/json").
+			Send(tpl.APIKeyUpdateBody{ExpiredAt: &expiredAt}).
+			End()
+		require.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		json := tpl.APIKeyInfoRes{}
+		res.JSON(&json)
+		assert.False(json.Result.Active)
+
+		res, err = request.Get(fmt.Sprintf("%s/v1/users/%s/labels", tt.Host, tpl.RandUID())).
+			Set("Authorization", "Bearer "+key.Key).
+			End()
+		require.Nil(err)
+		assert.Equal(401, res.StatusCode)
+		res.Content() // close http client
+	})
+
+	t.Run(`"POST /v1/api-keys/:hid:revoke" should work`, func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		res, err := request.Post(fmt.Sprintf("%s/v1/api-keys/%s:revoke", tt.Host, key.HID)).
+			End()
+		require.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		json := tpl.APIKeyInfoRes{}
+		res.JSON(&json)
+		assert.False(json.Result.Active)
+		assert.NotNil(json.Result.RevokedAt)
+	})
+
+	t.Run("write:all api key should not call admin or owner routes", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		res, err := request.Post(fmt.Sprintf("%s/v1/api-keys", tt.Host)).
+			Set("Content-Type", "application/json").
+			Send(tpl.APIKeyBody{Name: "writer", Scopes: []string{schema.ScopeReadAll, schema.ScopeWriteAll}}).
+			End()
+		require.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		json := tpl.APIKeyInfoRes{}
+		res.JSON(&json)
+		writer := json.Result.Key
+
+		res, err = request.Post(fmt.Sprintf("%s/v1/api-keys", tt.Host)).
+			Set("Authorization", "Bearer "+writer).
+			Set("Content-Type", "application/json").
+			Send(tpl.APIKeyBody{Name: "writer", Scopes: []string{schema.ScopeWriteAll}}).
+			End()
+		require.Nil(err)
+		assert.Equal(403, res.StatusCode)
+		res.Content() // close http client
+
+		res, err = request.Get(fmt.Sprintf("%s/v1/products/%s/webhooks", tt.Host, product.Name)).
+			Set("Authorization", "Bearer "+writer).
+			End()
+		require.Nil(err)
+		assert.Equal(403, res.StatusCode)
+		res.Content() // close http client
+
+		res, err = request.Get(fmt.Sprintf("%s/v1/products/%s/labels", tt.Host, product.Name)).
+			Set("Authorization", "Bearer "+writer).
+			End()
+		require.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		res.Content() // close http client
+	})
+
+	t.Run("api key should not create keys beyond its own scopes", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		res, err := request.Post(fmt.Sprintf("%s/v1/api-keys", tt.Host)).
+			Set("Content-Type", "application/json").
+			Send(tpl.APIKeyBody{Name: "product admin", Scopes: []string{schema.ScopeAdminProduct + product.Name}}).
+			End()
+		require.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		json := tpl.APIKeyInfoRes{}
+		res.JSON(&json)
+		productAdmin := json.Result.Key
+
+		// admin:product:<product> 不能调用全局的 admin 路由
+		res, err = request.Post(fmt.Sprintf("%s/v1/api-keys", tt.Host)).
+			Set("Authorization", "Bearer "+productAdmin).
+			Set("Content-Type", "application/json").
+			Send(tpl.APIKeyBody{Name: "admin", Scopes: []string{schema.ScopeAdmin}}).
+			End()
+		require.Nil(err)
+		assert.Equal(403, res.StatusCode)
+		res.Content() // close http client
+
+		res, err = request.Get(fmt.Sprintf("%s/v1/products/%s/webhooks", tt.Host, product.Name)).
+			Set("Authorization", "Bearer "+productAdmin).
+			End()
+		require.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		res.Content() // close http client
+
+		assert.True(coveredScopes([]string{schema.ScopeAdmin}, []string{schema.ScopeAdminProduct + "a", schema.ScopeWriteAll}))
+		assert.True(coveredScopes([]string{schema.ScopeReadAll, schema.ScopeWriteAll}, []string{schema.ScopeReadEvaluate, schema.ScopeWriteAssign}))
+		assert.True(coveredScopes([]string{schema.ScopeAdminProduct + "a"}, []string{schema.ScopeAdminProduct + "a"}))
+		assert.False(coveredScopes([]string{schema.ScopeAdminProduct + "a"}, []string{schema.ScopeAdminProduct + "b"}))
+		assert.False(coveredScopes([]string{schema.ScopeAdminProduct + "a"}, []string{schema.ScopeWriteAll}))
+		assert.False(coveredScopes([]string{schema.ScopeWriteAssign}, []string{schema.ScopeWriteAll}))
+	})
+}
@@ -1,13 +1,20 @@
 package api
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
 	"log"
 	"strings"
 
 	"github.com/teambition/gear"
-	tracing "github.com/teambition/gear-tracing"
 
+	"github.com/teambition/urbs-setting/src/bll"
+	"github.com/teambition/urbs-setting/src/conf"
 	"github.com/teambition/urbs-setting/src/logging"
+	"github.com/teambition/urbs-setting/src/metrics"
+	"github.com/teambition/urbs-setting/src/middleware"
+	"github.com/teambition/urbs-setting/src/service"
 	"github.com/teambition/urbs-setting/src/util"
 )
 
@@ -38,6 +45,18 @@ func NewApp() *gear.App {
 	app := gear.New()
 
 	app.Set(gear.SetTrustedProxy, true)
+	if caFile := conf.Config.LabelsCache.ClientCAFile; caFile != "" {
+		// 请求但不强制 mTLS 客户端证书，由 labels:cache 接口的访问控制中间件检查
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			logging.Panicf("Read labels_cache.client_ca_file failed: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			logging.Panicf("Invalid labels_cache.client_ca_file: %s", caFile)
+		}
+		app.Server.TLSConfig = &tls.Config{ClientCAs: pool, ClientAuth: tls.VerifyClientCertIfGiven}
+	}
 	app.Set(gear.SetBodyParser, gear.DefaultBodyParser(2<<22)) // 8MB
 	// ignore TLS handshake error
 	app.Set(gear.SetLogger, log.New(gear.DefaultFilterWriter(), "", 0))
@@ -61,7 +80,8 @@ func NewApp() *gear.App {
 		return nil
 	})
 
-	app.Use(tracing.New("EntryPoint"))
+	app.Use(middleware.Tracing)
+	app.Use(middleware.Metrics)
 	if app.Env() != "test" {
 		app.UseHandler(logging.AccessLogger)
 	}
@@ -77,5 +97,26 @@ func NewApp() *gear.App {
 		logging.Panicf("DigInvoke error: %v", err)
 	}
 
+	// 启动后台任务
+	err = util.DigInvoke(func(blls *bll.Blls, sql *service.SQL, exposure *service.Exposure) error {
+		metrics.Register(metrics.NewDBStatsCollector("primary", sql.DBStats))
+		metrics.Register(metrics.NewDBStatsCollector("read", sql.RdDBStats))
+		metrics.Register(metrics.NewStatisticCollector(blls.Models.Statistic.FindTotals))
+		sql.StartHeartbeat(conf.Config.GlobalCtx)
+		exposure.Start(conf.Config.GlobalCtx)
+		blls.User.StartPurgeJob(conf.Config.GlobalCtx)
+		blls.AuditLog.StartPurgeJob(conf.Config.GlobalCtx)
+		blls.Webhook.StartDeliveryJob(conf.Config.GlobalCtx)
+		blls.Change.StartPurgeJob(conf.Config.GlobalCtx)
+		blls.Change.StartSequenceJob(conf.Config.GlobalCtx)
+		blls.ChangeRequest.StartExpireJob(conf.Config.GlobalCtx)
+		blls.Statistic.StartJob(conf.Config.GlobalCtx)
+		blls.Statistic.StartReconcileJob(conf.Config.GlobalCtx)
+		return nil
+	})
+	if err != nil {
+		logging.Panicf("DigInvoke error: %v", err)
+	}
+
 	return app
 }
@@ -48,13 +48,24 @@ func TestMain(m *testing.M) {
 	tt.DB.Exec("TRUNCATE TABLE urbs_setting;")
 	tt.DB.Exec("TRUNCATE TABLE user_group;")
 	tt.DB.Exec("TRUNCATE TABLE user_label;")
+	tt.DB.Exec("TRUNCATE TABLE user_label_cache;")
 	tt.DB.Exec("TRUNCATE TABLE user_setting;")
 	tt.DB.Exec("TRUNCATE TABLE group_label;")
 	tt.DB.Exec("TRUNCATE TABLE group_setting;")
 	tt.DB.Exec("TRUNCATE TABLE label_rule;")
 	tt.DB.Exec("TRUNCATE TABLE setting_rule;")
 	tt.DB.Exec("TRUNCATE TABLE urbs_statistic;")
+	tt.DB.Exec("TRUNCATE TABLE urbs_statistic_daily;")
 	tt.DB.Exec("TRUNCATE TABLE urbs_lock;")
+	tt.DB.Exec("TRUNCATE TABLE urbs_job;")
+	tt.DB.Exec("TRUNCATE TABLE urbs_audit_log;")
+	tt.DB.Exec("TRUNCATE TABLE urbs_version;")
+	tt.DB.Exec("TRUNCATE TABLE urbs_webhook;")
+	tt.DB.Exec("TRUNCATE TABLE urbs_webhook_delivery;")
+	tt.DB.Exec("TRUNCATE TABLE urbs_change;")
+	tt.DB.Exec("TRUNCATE TABLE urbs_role_binding;")
+	tt.DB.Exec("TRUNCATE TABLE urbs_api_key;")
+	tt.DB.Exec("TRUNCATE TABLE urbs_change_request;")
 	cleanup()
 	os.Exit(m.Run())
 }
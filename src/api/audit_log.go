@@ -0,0 +1,108 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/teambition/gear"
+	"github.com/teambition/urbs-setting/src/bll"
+	"github.com/teambition/urbs-setting/src/middleware"
+	"github.com/teambition/urbs-setting/src/schema"
+	"github.com/teambition/urbs-setting/src/service"
+	"github.com/teambition/urbs-setting/src/tpl"
+)
+
+// maxAuditBodySize 审计日志记录的请求参数和响应结果的最大长度，超过则截断
+const maxAuditBodySize = 1 << 20
+
+// AuditLog ..
+type AuditLog struct {
+	blls *bll.Blls
+}
+
+// List ..
+func (a *AuditLog) List(ctx *gear.Context) error {
+	req := tpl.AuditLogsURL{}
+	if err := ctx.ParseURL(&req); err != nil {
+		return err
+	}
+
+	res, err := a.blls.AuditLog.List(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	return ctx.OkJSON(res)
+}
+
+// Record 审计中间件，记录所有成功的写请求，需要放在 Auth 中间件之后。
+// 业务层可以通过 service.SetAuditBefore 补充变更前的数据
+func (a *AuditLog) Record(ctx *gear.Context) error {
+	switch ctx.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return nil
+	}
+
+	log := &schema.AuditLog{
+		Actor:   middleware.Subject(ctx),
+		Action:  ctx.Method + " " + gear.GetRouterPatternFromCtx(ctx),
+		Product: ctx.Param("product"),
+		Target:  ctx.Req.URL.RequestURI(),
+	}
+	if len(log.Target) > 1022 {
+		log.Target = log.Target[:1022]
+	}
+	if ctx.Req.Body != nil {
+		data, err := ioutil.ReadAll(io.LimitReader(ctx.Req.Body, maxAuditBodySize))
+		if err != nil {
+			return gear.ErrBadRequest.WithMsgf("read request body error: %v", err)
+		}
+		// 还原请求体，超出部分由后续处理继续读取
+		ctx.Req.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(data), ctx.Req.Body))
+		log.Body = string(data)
+	}
+
+	ctx.WithContext(service.WithAuditLog(ctx.Context(), log))
+	ctx.After(func() {
+		status := ctx.Res.Status()
+		if status >= 400 {
+			return
+		}
+		log := service.AuditLogFrom(ctx)
+		log.Status = status
+		log.After = auditResult(ctx.Res.Body())
+		if fields := service.AuditRedactFields(ctx); len(fields) > 0 {
+			log.Body = service.RedactJSON(log.Body, fields)
+			log.Before = service.RedactJSON(log.Before, fields)
+			log.After = service.RedactJSON(log.After, fields)
+		}
+		a.blls.AuditLog.Create(ctx, log)
+	})
+	return nil
+}
+
+// Redact 返回路由中间件，审计日志中移除请求参数、变更前和变更后数据中的 fields 字段，用于密钥等敏感数据。
+// 需要放在 Record 中间件之后
+func (a *AuditLog) Redact(fields ...string) gear.Middleware {
+	return func(ctx *gear.Context) error {
+		service.SetAuditRedact(ctx, fields...)
+		return nil
+	}
+}
+
+// auditResult 从 JSON 响应中取出 result 字段作为变更后的数据
+func auditResult(body []byte) string {
+	if len(body) > maxAuditBodySize {
+		body = body[:maxAuditBodySize]
+	}
+	res := struct {
+		Result json.RawMessage `json:"result"`
+	}{}
+	if err := json.Unmarshal(body, &res); err == nil && len(res.Result) > 0 {
+		return string(res.Result)
+	}
+	return string(body)
+}
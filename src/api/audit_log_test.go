@@ -0,0 +1,91 @@
+package api
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/DavidCai1993/request"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/teambition/urbs-setting/src/tpl"
+)
+
+func TestAuditLogAPIs(t *testing.T) {
+	tt, cleanup := SetUpTestTools()
+	defer cleanup()
+
+	product, err := createProduct(tt)
+	assert.Nil(t, err)
+
+	desc := "updated desc"
+	res, err := request.Put(fmt.Sprintf("%s/v1/products/%s", tt.Host, product.Name)).
+		Set("Content-Type", "application/json").
+		Send(tpl.ProductUpdateBody{Desc: &desc}).
+		End()
+	assert.Nil(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	res.Content() // close http client
+
+	res, err = request.Put(fmt.Sprintf("%s/v1/products/%s", tt.Host, product.Name)).
+		Set("Content-Type", "application/json").
+		Send(tpl.ProductUpdateBody{}).
+		End()
+	assert.Nil(t, err)
+	assert.Equal(t, 400, res.StatusCode)
+	res.Content() // close http client
+
+	t.Run(`"GET /v1/audit-logs" should work`, func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		res, err := request.Get(fmt.Sprintf("%s/v1/audit-logs?product=%s", tt.Host, product.Name)).
+			End()
+		require.Nil(err)
+		assert.Equal(200, res.StatusCode)
+
+		json := tpl.AuditLogsRes{}
+		res.JSON(&json)
+		require.Equal(1, len(json.Result))
+		assert.Equal(1, json.TotalSize)
+
+		log := json.Result[0]
+		assert.Equal("PUT /v1/products/:product", log.Action)
+		assert.Equal(product.Name, log.Product)
+		assert.Equal("/v1/products/"+product.Name, log.Target)
+		assert.Equal(200, log.Status)
+		assert.Contains(log.Body, desc)
+		assert.Contains(log.Before, product.Desc)
+		assert.NotContains(log.Before, desc)
+		assert.Contains(log.After, desc)
+	})
+
+	t.Run(`"GET /v1/audit-logs" with target prefix`, func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		res, err := request.Get(fmt.Sprintf("%s/v1/audit-logs?target=/v1/products", tt.Host)).
+			End()
+		require.Nil(err)
+		assert.Equal(200, res.StatusCode)
+
+		json := tpl.AuditLogsRes{}
+		res.JSON(&json)
+		require.True(len(json.Result) >= 2)
+		actions := make(map[string]bool)
+		for _, log := range json.Result {
+			actions[log.Action] = true
+		}
+		assert.True(actions["POST /v1/products"])
+		assert.True(actions["PUT /v1/products/:product"])
+	})
+
+	t.Run(`"GET /v1/audit-logs" with invalid time range`, func(t *testing.T) {
+		assert := assert.New(t)
+
+		res, err := request.Get(fmt.Sprintf("%s/v1/audit-logs?start=100&end=10", tt.Host)).
+			End()
+		assert.Nil(err)
+		assert.Equal(400, res.StatusCode)
+		res.Content()
+	})
+}
@@ -0,0 +1,27 @@
+package api
+
+import (
+	"github.com/teambition/gear"
+	"github.com/teambition/urbs-setting/src/bll"
+	"github.com/teambition/urbs-setting/src/tpl"
+)
+
+// Change ..
+type Change struct {
+	blls *bll.Blls
+}
+
+// List ..
+func (a *Change) List(ctx *gear.Context) error {
+	req := tpl.ChangesURL{}
+	if err := ctx.ParseURL(&req); err != nil {
+		return err
+	}
+
+	res, err := a.blls.Change.List(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	return ctx.OkJSON(res)
+}
@@ -0,0 +1,407 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/teambition/gear"
+	"github.com/teambition/urbs-setting/src/bll"
+	"github.com/teambition/urbs-setting/src/dto"
+	"github.com/teambition/urbs-setting/src/middleware"
+	"github.com/teambition/urbs-setting/src/schema"
+	"github.com/teambition/urbs-setting/src/service"
+	"github.com/teambition/urbs-setting/src/tpl"
+)
+
+// protectedRoutes 受保护产品上需要审批的路由及其操作类型
+var protectedRoutes = map[string]string{
+	"PUT /v1/products/:product":                                                               schema.ActionProductUpdate,
+	"PUT /v1/products/:product+:offline":                                                      schema.ActionProductOffline,
+	"DELETE /v1/products/:product":                                                            schema.ActionProductDelete,
+	"POST /v1/products/:product+:apply":                                                       schema.ActionProductApply,
+	"POST /v1/products/:product+:clone":                                                       schema.ActionProductClone,
+	"POST /v1/products/:product+:promote":                                                     schema.ActionProductPromote,
+	"PUT /v1/products/:product/modules/:module":                                               schema.ActionModuleUpdate,
+	"PUT /v1/products/:product/modules/:module+:offline":                                      schema.ActionModuleOffline,
+	"PUT /v1/products/:product/modules/:module/settings/:setting":                             schema.ActionSettingUpdate,
+	"PUT /v1/products/:product/modules/:module/settings/:setting+:offline":                    schema.ActionSettingOffline,
+	"POST /v1/products/:product/modules/:module/settings/:setting+:assign":                    schema.ActionSettingAssign,
+	"POST /v2/products/:product/modules/:module/settings/:setting+:assign":                    schema.ActionSettingAssign,
+	"POST /v1/products/:product/modules/:module/settings/:setting+:recall":                    schema.ActionSettingRecall,
+	"DELETE /v1/products/:product/modules/:module/settings/:setting+:cleanup":                 schema.ActionSettingCleanup,
+	"POST /v1/products/:product/modules/:module/settings/:setting/rules":                      schema.ActionSettingRuleCreate,
+	"PUT /v1/products/:product/modules/:module/settings/:setting/rules/:hid":                  schema.ActionSettingRuleUpdate,
+	"DELETE /v1/products/:product/modules/:module/settings/:setting/rules/:hid":               schema.ActionSettingRuleDelete,
+	"POST /v1/products/:product/modules/:module/settings/:setting/versions/:version+:restore": schema.ActionSettingRestore,
+	"DELETE /v1/products/:product/modules/:module/settings/:setting/users/:uid":               schema.ActionSettingUserDelete,
+	"PUT /v1/products/:product/modules/:module/settings/:setting/users/:uid+:rollback":        schema.ActionSettingUserRollback,
+	"DELETE /v1/products/:product/modules/:module/settings/:setting/groups/:uid":              schema.ActionSettingGroupDelete,
+	"PUT /v1/products/:product/modules/:module/settings/:setting/groups/:uid+:rollback":       schema.ActionSettingGroupRollback,
+	"PUT /v1/products/:product/labels/:label":                                                 schema.ActionLabelUpdate,
+	"DELETE /v1/products/:product/labels/:label":                                              schema.ActionLabelDelete,
+	"PUT /v1/products/:product/labels/:label+:offline":                                        schema.ActionLabelOffline,
+	"POST /v1/products/:product/labels/:label+:assign":                                        schema.ActionLabelAssign,
+	"POST /v2/products/:product/labels/:label+:assign":                                        schema.ActionLabelAssign,
+	"POST /v1/products/:product/labels/:label+:recall":                                        schema.ActionLabelRecall,
+	"DELETE /v1/products/:product/labels/:label+:cleanup":                                     schema.ActionLabelCleanup,
+	"POST /v1/products/:product/labels/:label/rules":                                          schema.ActionLabelRuleCreate,
+	"PUT /v1/products/:product/labels/:label/rules/:hid":                                      schema.ActionLabelRuleUpdate,
+	"DELETE /v1/products/:product/labels/:label/rules/:hid":                                   schema.ActionLabelRuleDelete,
+	"POST /v1/products/:product/labels/:label/versions/:version+:restore":                     schema.ActionLabelRestore,
+	"DELETE /v1/products/:product/labels/:label/users/:uid":                                   schema.ActionLabelUserDelete,
+	"DELETE /v1/products/:product/labels/:label/groups/:uid":                                  schema.ActionLabelGroupDelete,
+}
+
+// unprotectedRoutes 受保护产品上不需要审批的写路由，新增写路由时必须加入 protectedRoutes 或此处
+var unprotectedRoutes = map[string]bool{
+	// 只读取数据
+	"POST /v1/products/:product+:plan": true,
+	// 创建的功能模块、配置项和环境标签在设置给用户或创建发布规则前不影响用户
+	"POST /v1/products/:product/modules":                  true,
+	"POST /v1/products/:product/modules/:module/settings": true,
+	"POST /v1/products/:product/labels":                   true,
+	// 按已审批生效的发布规则为用户设置环境标签和配置项
+	"POST /v1/products/:product/users/rules:apply": true,
+	// webhook 和产品角色需要 owner，不改变用户得到的环境标签和配置项
+	"POST /v1/products/:product/webhooks":                                      true,
+	"PUT /v1/products/:product/webhooks/:hid":                                  true,
+	"DELETE /v1/products/:product/webhooks/:hid":                               true,
+	"POST /v1/products/:product/webhooks/:hid/deliveries/:delivery+:redeliver": true,
+	"PUT /v1/products/:product/roles":                                          true,
+	"DELETE /v1/products/:product/roles":                                       true,
+	// 审批本身
+	"POST /v1/products/:product/change-requests/:hid+:approve": true,
+	"POST /v1/products/:product/change-requests/:hid+:reject":  true,
+}
+
+// actionRoutes 操作类型对应的 v1 路由，审批时按该路由检查审批者的角色或 API key scopes
+var actionRoutes = map[string]string{}
+
+func init() {
+	for route, action := range protectedRoutes {
+		if strings.Contains(route, " /v1/") {
+			actionRoutes[action] = route
+		}
+	}
+	// 复制、推广的变更申请属于目标产品，审批者需要目标产品上 apply 的权限
+	actionRoutes[schema.ActionProductClone] = targetWriteRoute
+	actionRoutes[schema.ActionProductPromote] = targetWriteRoute
+}
+
+// ChangeRequest ..
+type ChangeRequest struct {
+	blls *bll.Blls
+}
+
+// Intercept 变更审批中间件，需要放在 AuditLog.Record 中间件之后。
+// 受保护产品上需要审批的写请求不会立即执行，而是创建待审批的变更申请并返回 202
+func (a *ChangeRequest) Intercept(ctx *gear.Context) error {
+	pattern := gear.GetRouterPatternFromCtx(ctx)
+	action, ok := protectedRoutes[ctx.Method+" "+pattern]
+	if !ok {
+		return nil
+	}
+	product := ctx.Param("product")
+	if action == schema.ActionProductUpdate {
+		// 只有取消保护需要审批，否则审批可以被先取消保护绕过
+		body := &tpl.ProductUpdateBody{}
+		if err := peekBody(ctx, body); err != nil || body.Protected == nil || *body.Protected {
+			return nil
+		}
+	}
+	if action == schema.ActionProductClone || action == schema.ActionProductPromote {
+		// 复制、推广时需要审批的是目标产品，预演不需要审批
+		target, err := peekPromoteTarget(ctx)
+		if err != nil || target.DryRun {
+			return nil
+		}
+		product = target.Target
+	}
+	protected, err := a.blls.ChangeRequest.IsProtected(ctx, product)
+	if err != nil || !protected {
+		// 产品不存在等错误由后续处理返回
+		return nil
+	}
+	if product != ctx.Param("product") {
+		if err := checkRoute(ctx, a.blls, targetWriteRoute, product); err != nil {
+			return err
+		}
+	}
+
+	payload, err := changeRequestPayload(ctx, action, strings.HasPrefix(pattern, "/v2/"))
+	if err != nil {
+		return err
+	}
+	res, err := a.blls.ChangeRequest.Create(ctx, middleware.Subject(ctx), action, ctx.Req.URL.RequestURI(), payload)
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(http.StatusAccepted, res)
+}
+
+// changeRequestPayload 解析并验证请求参数，v1 的群组统一转换为 v2 的 kind + uid 格式
+func changeRequestPayload(ctx *gear.Context, action string, v2 bool) (tpl.ChangeRequestPayload, error) {
+	payload := tpl.ChangeRequestPayload{
+		Product: ctx.Param("product"),
+		Module:  ctx.Param("module"),
+		Setting: ctx.Param("setting"),
+		Label:   ctx.Param("label"),
+	}
+
+	var body interface{}
+	switch action {
+	case schema.ActionLabelAssign, schema.ActionSettingAssign:
+		if v2 {
+			b := &tpl.UsersGroupsBodyV2{}
+			if err := ctx.ParseBody(b); err != nil {
+				return payload, err
+			}
+			body = b
+		} else {
+			b := tpl.UsersGroupsBody{}
+			if err := ctx.ParseBody(&b); err != nil {
+				return payload, err
+			}
+			groups := []*tpl.GroupKindUID{}
+			for _, uid := range b.Groups {
+				groups = append(groups, &tpl.GroupKindUID{Kind: dto.GroupOrgKind, UID: uid})
+			}
+			body = &tpl.UsersGroupsBodyV2{Users: b.Users, Groups: groups, Value: b.Value}
+		}
+	case schema.ActionLabelRecall, schema.ActionSettingRecall:
+		b := &tpl.RecallBody{}
+		if err := ctx.ParseBody(b); err != nil {
+			return payload, err
+		}
+		body = b
+	case schema.ActionLabelRuleCreate, schema.ActionLabelRuleUpdate:
+		b := &tpl.LabelRuleBody{}
+		if err := ctx.ParseBody(b); err != nil {
+			return payload, err
+		}
+		body = b
+	case schema.ActionSettingRuleCreate, schema.ActionSettingRuleUpdate:
+		b := &tpl.SettingRuleBody{}
+		if err := ctx.ParseBody(b); err != nil {
+			return payload, err
+		}
+		body = b
+	case schema.ActionProductClone:
+		b := &tpl.ProductCloneBody{}
+		if err := ctx.ParseBody(b); err != nil {
+			return payload, err
+		}
+		payload.Product, payload.Source = b.Target, ctx.Param("product")
+		body = b
+	case schema.ActionProductPromote:
+		b := &tpl.ProductPromoteBody{}
+		if err := ctx.ParseBody(b); err != nil {
+			return payload, err
+		}
+		payload.Product, payload.Source = b.Target, ctx.Param("product")
+		body = b
+	case schema.ActionProductUpdate:
+		b := &tpl.ProductUpdateBody{}
+		if err := ctx.ParseBody(b); err != nil {
+			return payload, err
+		}
+		body = b
+	case schema.ActionModuleUpdate:
+		b := &tpl.ModuleUpdateBody{}
+		if err := ctx.ParseBody(b); err != nil {
+			return payload, err
+		}
+		body = b
+	case schema.ActionLabelUpdate:
+		b := &tpl.LabelUpdateBody{}
+		if err := ctx.ParseBody(b); err != nil {
+			return payload, err
+		}
+		body = b
+	case schema.ActionSettingUpdate:
+		b := &tpl.SettingUpdateBody{}
+		if err := ctx.ParseBody(b); err != nil {
+			return payload, err
+		}
+		body = b
+	case schema.ActionLabelUserDelete:
+		req := tpl.ProductLabelUIDURL{}
+		if err := ctx.ParseURL(&req); err != nil {
+			return payload, err
+		}
+		payload.UID = req.UID
+	case schema.ActionLabelGroupDelete:
+		req := tpl.ProductLabelGroupURL{}
+		if err := ctx.ParseURL(&req); err != nil {
+			return payload, err
+		}
+		payload.Kind, payload.UID = req.Kind, req.UID
+	case schema.ActionSettingUserDelete, schema.ActionSettingUserRollback:
+		req := tpl.ProductModuleSettingUIDURL{}
+		if err := ctx.ParseURL(&req); err != nil {
+			return payload, err
+		}
+		payload.UID = req.UID
+	case schema.ActionSettingGroupDelete, schema.ActionSettingGroupRollback:
+		req := tpl.ProductModuleSettingGroupURL{}
+		if err := ctx.ParseURL(&req); err != nil {
+			return payload, err
+		}
+		payload.Kind, payload.UID = req.Kind, req.UID
+	case schema.ActionProductApply:
+		req := tpl.ProductConfigURL{}
+		if err := ctx.ParseURL(&req); err != nil {
+			return payload, err
+		}
+		cfg, err := readProductConfig(ctx)
+		if err != nil {
+			return payload, err
+		}
+		body = &tpl.ProductConfigApplyBody{Prune: req.Prune, Config: cfg}
+	}
+
+	switch action {
+	case schema.ActionLabelRuleUpdate, schema.ActionSettingRuleUpdate,
+		schema.ActionLabelRuleDelete, schema.ActionSettingRuleDelete:
+		payload.Rule = ctx.Param("hid")
+	case schema.ActionLabelRestore, schema.ActionSettingRestore:
+		version, err := strconv.ParseInt(ctx.Param("version"), 10, 64)
+		if err != nil || version <= 0 {
+			return payload, gear.ErrBadRequest.WithMsgf("invalid version: %s", ctx.Param("version"))
+		}
+		payload.Version = version
+	}
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return payload, err
+		}
+		payload.Body = data
+	}
+	return payload, nil
+}
+
+// List ..
+func (a *ChangeRequest) List(ctx *gear.Context) error {
+	req := tpl.ChangeRequestsURL{}
+	if err := ctx.ParseURL(&req); err != nil {
+		return err
+	}
+
+	res, err := a.blls.ChangeRequest.List(ctx, req.Product, req.Status, req.Pagination)
+	if err != nil {
+		return err
+	}
+	return ctx.OkJSON(res)
+}
+
+// Get ..
+func (a *ChangeRequest) Get(ctx *gear.Context) error {
+	req := tpl.ProductChangeRequestURL{}
+	if err := ctx.ParseURL(&req); err != nil {
+		return err
+	}
+
+	crID, err := changeRequestID(req.HID)
+	if err != nil {
+		return err
+	}
+	res, err := a.blls.ChangeRequest.Get(ctx, req.Product, crID)
+	if err != nil {
+		return err
+	}
+	return ctx.OkJSON(res)
+}
+
+// Diff ..
+func (a *ChangeRequest) Diff(ctx *gear.Context) error {
+	req := tpl.ProductChangeRequestURL{}
+	if err := ctx.ParseURL(&req); err != nil {
+		return err
+	}
+
+	crID, err := changeRequestID(req.HID)
+	if err != nil {
+		return err
+	}
+	res, err := a.blls.ChangeRequest.Diff(ctx, req.Product, crID)
+	if err != nil {
+		return err
+	}
+	return ctx.OkJSON(res)
+}
+
+// Approve ..
+func (a *ChangeRequest) Approve(ctx *gear.Context) error {
+	req := tpl.ProductChangeRequestURL{}
+	if err := ctx.ParseURL(&req); err != nil {
+		return err
+	}
+
+	body := tpl.ChangeRequestDecisionBody{}
+	if err := ctx.ParseBody(&body); err != nil {
+		return err
+	}
+
+	crID, err := changeRequestID(req.HID)
+	if err != nil {
+		return err
+	}
+	if err := a.checkDecider(ctx, req.Product, crID); err != nil {
+		return err
+	}
+	res, err := a.blls.ChangeRequest.Approve(ctx, req.Product, crID, middleware.Subject(ctx), body.Reason)
+	if err != nil {
+		return err
+	}
+	return ctx.OkJSON(res)
+}
+
+// Reject ..
+func (a *ChangeRequest) Reject(ctx *gear.Context) error {
+	req := tpl.ProductChangeRequestURL{}
+	if err := ctx.ParseURL(&req); err != nil {
+		return err
+	}
+
+	body := tpl.ChangeRequestDecisionBody{}
+	if err := ctx.ParseBody(&body); err != nil {
+		return err
+	}
+
+	crID, err := changeRequestID(req.HID)
+	if err != nil {
+		return err
+	}
+	if err := a.checkDecider(ctx, req.Product, crID); err != nil {
+		return err
+	}
+	res, err := a.blls.ChangeRequest.Reject(ctx, req.Product, crID, middleware.Subject(ctx), body.Reason)
+	if err != nil {
+		return err
+	}
+	return ctx.OkJSON(res)
+}
+
+// checkDecider 审批者需要有直接执行该操作的权限
+func (a *ChangeRequest) checkDecider(ctx *gear.Context, product string, crID int64) error {
+	action, err := a.blls.ChangeRequest.Action(ctx, product, crID)
+	if err != nil {
+		return err
+	}
+	route, ok := actionRoutes[action]
+	if !ok {
+		return gear.ErrBadRequest.WithMsgf("unsupported change request action: %s", action)
+	}
+	return checkRoute(ctx, a.blls, route, product)
+}
+
+func changeRequestID(hid string) (int64, error) {
+	crID := service.HIDToID(hid, "change_request")
+	if crID <= 0 {
+		return 0, gear.ErrBadRequest.WithMsgf("invalid change_request hid: %s", hid)
+	}
+	return crID, nil
+}
@@ -0,0 +1,656 @@
+package api
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/DavidCai1993/request"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	auth "github.com/teambition/gear-auth"
+	"github.com/teambition/urbs-setting/src/middleware"
+	"github.com/teambition/urbs-setting/src/schema"
+	"github.com/teambition/urbs-setting/src/tpl"
+)
+
+func TestChangeRequestAPIs(t *testing.T) {
+	tt, cleanup := SetUpTestTools()
+	defer cleanup()
+
+	product, err := createProduct(tt)
+	require.Nil(t, err)
+	label, err := createLabel(tt, product.Name)
+	require.Nil(t, err)
+
+	// 启用 JWT 身份验证以区分申请者和审批者，测试结束后恢复
+	auther := middleware.Auther
+	defer func() {
+		middleware.Auther = auther
+	}()
+	middleware.Auther = auth.New([]byte("urbs-change-request-test"))
+
+	token := func(sub string) string {
+		s, err := middleware.Auther.JWT().Sign(map[string]interface{}{"sub": sub})
+		require.Nil(t, err)
+		return "Bearer " + s
+	}
+	aliceToken := token("alice")
+	bobToken := token("bob")
+
+	protected := true
+	res, err := request.Put(fmt.Sprintf("%s/v1/products/%s", tt.Host, product.Name)).
+		Set("Authorization", aliceToken).
+		Set("Content-Type", "application/json").
+		Send(tpl.ProductUpdateBody{Protected: &protected}).
+		End()
+	require.Nil(t, err)
+	require.Equal(t, 200, res.StatusCode)
+	res.Content() // close http client
+
+	uid := tpl.RandUID()
+	var cr tpl.ChangeRequestInfo
+	t.Run("assign on protected product should create change request", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		res, err := request.Post(fmt.Sprintf("%s/v1/products/%s/labels/%s:assign", tt.Host, product.Name, label.Name)).
+			Set("Authorization", aliceToken).
+			Set("Content-Type", "application/json").
+			Send(tpl.UsersGroupsBody{Users: []string{uid}}).
+			End()
+		require.Nil(err)
+		assert.Equal(202, res.StatusCode)
+		json := tpl.ChangeRequestInfoRes{}
+		res.JSON(&json)
+		cr = json.Result
+		assert.Equal(schema.ActionLabelAssign, cr.Action)
+		assert.Equal(schema.ChangeRequestPending, cr.Status)
+		assert.Equal("alice", cr.CreatedBy)
+		assert.Equal(label.Name, cr.Payload.Label)
+
+		res, err = request.Get(fmt.Sprintf("%s/v1/products/%s/labels/%s/users", tt.Host, product.Name, label.Name)).
+			Set("Authorization", aliceToken).
+			End()
+		require.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		users := tpl.LabelUsersInfoRes{}
+		res.JSON(&users)
+		assert.Equal(0, len(users.Result))
+	})
+
+	t.Run(`"GET /v1/products/:product/change-requests/:hid:diff" should work`, func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		res, err := request.Get(fmt.Sprintf("%s/v1/products/%s/change-requests/%s:diff", tt.Host, product.Name, cr.HID)).
+			Set("Authorization", bobToken).
+			End()
+		require.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		text, err := res.Text()
+		require.Nil(err)
+		assert.Contains(text, `"action":"label.assign"`)
+		assert.Contains(text, uid)
+		assert.Contains(text, `"before":{"hid"`)
+	})
+
+	t.Run(`"POST /v1/products/:product/change-requests/:hid:approve" should work`, func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		res, err := request.Post(fmt.Sprintf("%s/v1/products/%s/change-requests/%s:approve", tt.Host, product.Name, cr.HID)).
+			Set("Authorization", aliceToken).
+			Set("Content-Type", "application/json").
+			Send(tpl.ChangeRequestDecisionBody{}).
+			End()
+		require.Nil(err)
+		assert.Equal(403, res.StatusCode)
+		res.Content() // close http client
+
+		res, err = request.Post(fmt.Sprintf("%s/v1/products/%s/change-requests/%s:approve", tt.Host, product.Name, cr.HID)).
+			Set("Authorization", bobToken).
+			Set("Content-Type", "application/json").
+			Send(tpl.ChangeRequestDecisionBody{Reason: "LGTM"}).
+			End()
+		require.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		json := tpl.ChangeRequestInfoRes{}
+		res.JSON(&json)
+		assert.Equal(schema.ChangeRequestApplied, json.Result.Status)
+		assert.Equal("bob", json.Result.DecidedBy)
+		assert.Equal("LGTM", json.Result.Reason)
+		assert.NotNil(json.Result.DecidedAt)
+
+		res, err = request.Get(fmt.Sprintf("%s/v1/products/%s/labels/%s/users", tt.Host, product.Name, label.Name)).
+			Set("Authorization", aliceToken).
+			End()
+		require.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		users := tpl.LabelUsersInfoRes{}
+		res.JSON(&users)
+		require.Equal(1, len(users.Result))
+		assert.Equal(uid, users.Result[0].User)
+
+		// 已审批的申请不能再次审批
+		res, err = request.Post(fmt.Sprintf("%s/v1/products/%s/change-requests/%s:reject", tt.Host, product.Name, cr.HID)).
+			Set("Authorization", bobToken).
+			Set("Content-Type", "application/json").
+			Send(tpl.ChangeRequestDecisionBody{}).
+			End()
+		require.Nil(err)
+		assert.Equal(409, res.StatusCode)
+		res.Content() // close http client
+	})
+
+	t.Run(`"POST /v1/products/:product/change-requests/:hid:reject" should work`, func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		res, err := request.Put(fmt.Sprintf("%s/v1/products/%s/labels/%s:offline", tt.Host, product.Name, label.Name)).
+			Set("Authorization", aliceToken).
+			End()
+		require.Nil(err)
+		assert.Equal(202, res.StatusCode)
+		json := tpl.ChangeRequestInfoRes{}
+		res.JSON(&json)
+		assert.Equal(schema.ActionLabelOffline, json.Result.Action)
+
+		res, err = request.Post(fmt.Sprintf("%s/v1/products/%s/change-requests/%s:reject", tt.Host, product.Name, json.Result.HID)).
+			Set("Authorization", bobToken).
+			Set("Content-Type", "application/json").
+			Send(tpl.ChangeRequestDecisionBody{Reason: "not now"}).
+			End()
+		require.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		json = tpl.ChangeRequestInfoRes{}
+		res.JSON(&json)
+		assert.Equal(schema.ChangeRequestRejected, json.Result.Status)
+		assert.Equal("", json.Result.Result)
+
+		res, err = request.Get(fmt.Sprintf("%s/v1/products/%s/labels", tt.Host, product.Name)).
+			Set("Authorization", aliceToken).
+			End()
+		require.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		labels := tpl.LabelsInfoRes{}
+		res.JSON(&labels)
+		assert.Equal(1, len(labels.Result))
+	})
+
+	t.Run("expired change request should not be approved", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		res, err := request.Delete(fmt.Sprintf("%s/v1/products/%s/labels/%s:cleanup", tt.Host, product.Name, label.Name)).
+			Set("Authorization", aliceToken).
+			End()
+		require.Nil(err)
+		assert.Equal(202, res.StatusCode)
+		json := tpl.ChangeRequestInfoRes{}
+		res.JSON(&json)
+
+		_, err = tt.DB.Exec("update `urbs_change_request` set `expired_at` = '2020-01-01' where `id` = ?", json.Result.ID)
+		require.Nil(err)
+		res, err = request.Post(fmt.Sprintf("%s/v1/products/%s/change-requests/%s:approve", tt.Host, product.Name, json.Result.HID)).
+			Set("Authorization", bobToken).
+			Set("Content-Type", "application/json").
+			Send(tpl.ChangeRequestDecisionBody{}).
+			End()
+		require.Nil(err)
+		assert.Equal(409, res.StatusCode)
+		res.Content() // close http client
+	})
+
+	t.Run(`"GET /v1/products/:product/change-requests" should work`, func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		res, err := request.Get(fmt.Sprintf("%s/v1/products/%s/change-requests?status=pending", tt.Host, product.Name)).
+			Set("Authorization", aliceToken).
+			End()
+		require.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		json := tpl.ChangeRequestsInfoRes{}
+		res.JSON(&json)
+		assert.Equal(1, len(json.Result))
+
+		res, err = request.Get(fmt.Sprintf("%s/v1/products/%s/change-requests", tt.Host, product.Name)).
+			Set("Authorization", aliceToken).
+			End()
+		require.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		json = tpl.ChangeRequestsInfoRes{}
+		res.JSON(&json)
+		assert.Equal(3, len(json.Result))
+		assert.Equal(schema.ChangeRequestPending, json.Result[0].Status)
+		assert.Equal(schema.ChangeRequestRejected, json.Result[1].Status)
+		assert.Equal(schema.ChangeRequestApplied, json.Result[2].Status)
+	})
+}
+
+func TestChangeRequestProtectedRoutes(t *testing.T) {
+	tt, cleanup := SetUpTestTools()
+	defer cleanup()
+
+	product, err := createProduct(tt)
+	require.Nil(t, err)
+	label, err := createLabel(tt, product.Name)
+	require.Nil(t, err)
+	module, err := createModule(tt, product.Name)
+	require.Nil(t, err)
+	setting, err := createSetting(tt, product.Name, module.Name, "x", "y")
+	require.Nil(t, err)
+
+	res, err := request.Post(fmt.Sprintf("%s/v1/products/%s/labels/%s/rules", tt.Host, product.Name, label.Name)).
+		Set("Content-Type", "application/json").
+		Send(map[string]interface{}{
+			"kind": "userPercent",
+			"rule": map[string]interface{}{
+				"value": 50,
+			},
+		}).
+		End()
+	require.Nil(t, err)
+	require.Equal(t, 200, res.StatusCode)
+	labelRule := tpl.LabelRuleInfoRes{}
+	res.JSON(&labelRule)
+
+	res, err = request.Post(fmt.Sprintf("%s/v1/products/%s/modules/%s/settings/%s/rules", tt.Host, product.Name, module.Name, setting.Name)).
+		Set("Content-Type", "application/json").
+		Send(map[string]interface{}{
+			"kind":  "userPercent",
+			"value": "y",
+			"rule": map[string]interface{}{
+				"value": 50,
+			},
+		}).
+		End()
+	require.Nil(t, err)
+	require.Equal(t, 200, res.StatusCode)
+	settingRule := tpl.SettingRuleInfoRes{}
+	res.JSON(&settingRule)
+
+	// 启用 JWT 身份验证以区分申请者和审批者，测试结束后恢复
+	auther := middleware.Auther
+	defer func() {
+		middleware.Auther = auther
+	}()
+	middleware.Auther = auth.New([]byte("urbs-change-request-test"))
+
+	token := func(sub string) string {
+		s, err := middleware.Auther.JWT().Sign(map[string]interface{}{"sub": sub})
+		require.Nil(t, err)
+		return "Bearer " + s
+	}
+	aliceToken := token("alice")
+	bobToken := token("bob")
+
+	protected := true
+	res, err = request.Put(fmt.Sprintf("%s/v1/products/%s", tt.Host, product.Name)).
+		Set("Authorization", aliceToken).
+		Set("Content-Type", "application/json").
+		Send(tpl.ProductUpdateBody{Protected: &protected}).
+		End()
+	require.Nil(t, err)
+	require.Equal(t, 200, res.StatusCode)
+	res.Content() // close http client
+
+	approve := func(t *testing.T, hid string) {
+		res, err := request.Post(fmt.Sprintf("%s/v1/products/%s/change-requests/%s:approve", tt.Host, product.Name, hid)).
+			Set("Authorization", bobToken).
+			Set("Content-Type", "application/json").
+			Send(tpl.ChangeRequestDecisionBody{}).
+			End()
+		require.Nil(t, err)
+		assert.Equal(t, 200, res.StatusCode)
+		json := tpl.ChangeRequestInfoRes{}
+		res.JSON(&json)
+		assert.Equal(t, schema.ChangeRequestApplied, json.Result.Status, json.Result.Result)
+	}
+
+	t.Run("requester should not approve with own api key", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		res, err := request.Post(fmt.Sprintf("%s/v1/api-keys", tt.Host)).
+			Set("Authorization", aliceToken).
+			Set("Content-Type", "application/json").
+			Send(tpl.APIKeyBody{Name: "alice", Scopes: []string{schema.ScopeAdmin}}).
+			End()
+		require.Nil(err)
+		require.Equal(200, res.StatusCode)
+		key := tpl.APIKeyInfoRes{}
+		res.JSON(&key)
+
+		res, err = request.Post(fmt.Sprintf("%s/v1/products/%s/labels/%s:assign", tt.Host, product.Name, label.Name)).
+			Set("Authorization", aliceToken).
+			Set("Content-Type", "application/json").
+			Send(tpl.UsersGroupsBody{Users: []string{tpl.RandUID()}}).
+			End()
+		require.Nil(err)
+		assert.Equal(202, res.StatusCode)
+		json := tpl.ChangeRequestInfoRes{}
+		res.JSON(&json)
+
+		res, err = request.Post(fmt.Sprintf("%s/v1/products/%s/change-requests/%s:approve", tt.Host, product.Name, json.Result.HID)).
+			Set("Authorization", "Bearer "+key.Result.Key).
+			Set("Content-Type", "application/json").
+			Send(tpl.ChangeRequestDecisionBody{}).
+			End()
+		require.Nil(err)
+		assert.Equal(403, res.StatusCode)
+		res.Content() // close http client
+
+		// API key 提交的申请也不能由创建者审批
+		res, err = request.Post(fmt.Sprintf("%s/v1/products/%s/labels/%s:assign", tt.Host, product.Name, label.Name)).
+			Set("Authorization", "Bearer "+key.Result.Key).
+			Set("Content-Type", "application/json").
+			Send(tpl.UsersGroupsBody{Users: []string{tpl.RandUID()}}).
+			End()
+		require.Nil(err)
+		assert.Equal(202, res.StatusCode)
+		json = tpl.ChangeRequestInfoRes{}
+		res.JSON(&json)
+
+		res, err = request.Post(fmt.Sprintf("%s/v1/products/%s/change-requests/%s:reject", tt.Host, product.Name, json.Result.HID)).
+			Set("Authorization", aliceToken).
+			Set("Content-Type", "application/json").
+			Send(tpl.ChangeRequestDecisionBody{}).
+			End()
+		require.Nil(err)
+		assert.Equal(403, res.StatusCode)
+		res.Content() // close http client
+
+		res, err = request.Post(fmt.Sprintf("%s/v1/products/%s/change-requests/%s:reject", tt.Host, product.Name, json.Result.HID)).
+			Set("Authorization", bobToken).
+			Set("Content-Type", "application/json").
+			Send(tpl.ChangeRequestDecisionBody{}).
+			End()
+		require.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		res.Content() // close http client
+	})
+
+	t.Run("delete rules on protected product should create change request", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		res, err := request.Delete(fmt.Sprintf("%s/v1/products/%s/labels/%s/rules/%s", tt.Host, product.Name, label.Name, labelRule.Result.HID)).
+			Set("Authorization", aliceToken).
+			End()
+		require.Nil(err)
+		assert.Equal(202, res.StatusCode)
+		json := tpl.ChangeRequestInfoRes{}
+		res.JSON(&json)
+		assert.Equal(schema.ActionLabelRuleDelete, json.Result.Action)
+		assert.Equal(labelRule.Result.HID, json.Result.Payload.Rule)
+
+		res, err = request.Get(fmt.Sprintf("%s/v1/products/%s/labels/%s/rules", tt.Host, product.Name, label.Name)).
+			Set("Authorization", aliceToken).
+			End()
+		require.Nil(err)
+		rules := tpl.LabelRulesInfoRes{}
+		res.JSON(&rules)
+		assert.Equal(1, len(rules.Result))
+
+		approve(t, json.Result.HID)
+		res, err = request.Get(fmt.Sprintf("%s/v1/products/%s/labels/%s/rules", tt.Host, product.Name, label.Name)).
+			Set("Authorization", aliceToken).
+			End()
+		require.Nil(err)
+		rules = tpl.LabelRulesInfoRes{}
+		res.JSON(&rules)
+		assert.Equal(0, len(rules.Result))
+
+		res, err = request.Delete(fmt.Sprintf("%s/v1/products/%s/modules/%s/settings/%s/rules/%s", tt.Host, product.Name, module.Name, setting.Name, settingRule.Result.HID)).
+			Set("Authorization", aliceToken).
+			End()
+		require.Nil(err)
+		assert.Equal(202, res.StatusCode)
+		json = tpl.ChangeRequestInfoRes{}
+		res.JSON(&json)
+		assert.Equal(schema.ActionSettingRuleDelete, json.Result.Action)
+		assert.Equal(settingRule.Result.HID, json.Result.Payload.Rule)
+
+		approve(t, json.Result.HID)
+		res, err = request.Get(fmt.Sprintf("%s/v1/products/%s/modules/%s/settings/%s/rules", tt.Host, product.Name, module.Name, setting.Name)).
+			Set("Authorization", aliceToken).
+			End()
+		require.Nil(err)
+		settingRules := tpl.SettingRulesInfoRes{}
+		res.JSON(&settingRules)
+		assert.Equal(0, len(settingRules.Result))
+	})
+
+	t.Run("restore versions on protected product should create change request", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		res, err := request.Post(fmt.Sprintf("%s/v1/products/%s/labels/%s/versions/99:restore", tt.Host, product.Name, label.Name)).
+			Set("Authorization", aliceToken).
+			End()
+		require.Nil(err)
+		assert.Equal(404, res.StatusCode)
+		res.Content() // close http client
+
+		res, err = request.Post(fmt.Sprintf("%s/v1/products/%s/labels/%s/versions/2:restore", tt.Host, product.Name, label.Name)).
+			Set("Authorization", aliceToken).
+			End()
+		require.Nil(err)
+		assert.Equal(202, res.StatusCode)
+		json := tpl.ChangeRequestInfoRes{}
+		res.JSON(&json)
+		assert.Equal(schema.ActionLabelRestore, json.Result.Action)
+		assert.Equal(int64(2), json.Result.Payload.Version)
+
+		approve(t, json.Result.HID)
+		res, err = request.Get(fmt.Sprintf("%s/v1/products/%s/labels/%s/rules", tt.Host, product.Name, label.Name)).
+			Set("Authorization", aliceToken).
+			End()
+		require.Nil(err)
+		rules := tpl.LabelRulesInfoRes{}
+		res.JSON(&rules)
+		assert.Equal(1, len(rules.Result))
+
+		// 恢复到有灰度发布规则的版本
+		res, err = request.Get(fmt.Sprintf("%s/v1/products/%s/modules/%s/settings/%s/versions", tt.Host, product.Name, module.Name, setting.Name)).
+			Set("Authorization", aliceToken).
+			End()
+		require.Nil(err)
+		versions := tpl.VersionsInfoRes{}
+		res.JSON(&versions)
+		version := int64(0)
+		for _, v := range versions.Result {
+			if len(v.Snapshot.Rules) == 1 {
+				version = v.Version
+				break
+			}
+		}
+		require.True(version > 0)
+
+		res, err = request.Post(fmt.Sprintf("%s/v1/products/%s/modules/%s/settings/%s/versions/%d:restore", tt.Host, product.Name, module.Name, setting.Name, version)).
+			Set("Authorization", aliceToken).
+			End()
+		require.Nil(err)
+		assert.Equal(202, res.StatusCode)
+		json = tpl.ChangeRequestInfoRes{}
+		res.JSON(&json)
+		assert.Equal(schema.ActionSettingRestore, json.Result.Action)
+		assert.Equal(version, json.Result.Payload.Version)
+
+		approve(t, json.Result.HID)
+		res, err = request.Get(fmt.Sprintf("%s/v1/products/%s/modules/%s/settings/%s/rules", tt.Host, product.Name, module.Name, setting.Name)).
+			Set("Authorization", aliceToken).
+			End()
+		require.Nil(err)
+		settingRules := tpl.SettingRulesInfoRes{}
+		res.JSON(&settingRules)
+		assert.Equal(1, len(settingRules.Result))
+	})
+
+	t.Run("update definitions and remove users on protected product should create change request", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		desc := "protected desc"
+		res, err := request.Put(fmt.Sprintf("%s/v1/products/%s/labels/%s", tt.Host, product.Name, label.Name)).
+			Set("Authorization", aliceToken).
+			Set("Content-Type", "application/json").
+			Send(tpl.LabelUpdateBody{Desc: &desc}).
+			End()
+		require.Nil(err)
+		assert.Equal(202, res.StatusCode)
+		json := tpl.ChangeRequestInfoRes{}
+		res.JSON(&json)
+		assert.Equal(schema.ActionLabelUpdate, json.Result.Action)
+
+		approve(t, json.Result.HID)
+		res, err = request.Get(fmt.Sprintf("%s/v1/products/%s/labels", tt.Host, product.Name)).
+			Set("Authorization", aliceToken).
+			End()
+		require.Nil(err)
+		labels := tpl.LabelsInfoRes{}
+		res.JSON(&labels)
+		require.Equal(1, len(labels.Result))
+		assert.Equal(desc, labels.Result[0].Desc)
+
+		uid := tpl.RandUID()
+		res, err = request.Delete(fmt.Sprintf("%s/v1/products/%s/labels/%s/users/%s", tt.Host, product.Name, label.Name, uid)).
+			Set("Authorization", aliceToken).
+			End()
+		require.Nil(err)
+		assert.Equal(202, res.StatusCode)
+		json = tpl.ChangeRequestInfoRes{}
+		res.JSON(&json)
+		assert.Equal(schema.ActionLabelUserDelete, json.Result.Action)
+		assert.Equal(uid, json.Result.Payload.UID)
+
+		res, err = request.Put(fmt.Sprintf("%s/v1/products/%s/modules/%s/settings/%s/groups/%s:rollback", tt.Host, product.Name, module.Name, setting.Name, uid)).
+			Set("Authorization", aliceToken).
+			End()
+		require.Nil(err)
+		assert.Equal(202, res.StatusCode)
+		json = tpl.ChangeRequestInfoRes{}
+		res.JSON(&json)
+		assert.Equal(schema.ActionSettingGroupRollback, json.Result.Action)
+		assert.Equal(uid, json.Result.Payload.UID)
+	})
+
+	t.Run("unprotect product should create change request", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		desc := "new desc"
+		res, err := request.Put(fmt.Sprintf("%s/v1/products/%s", tt.Host, product.Name)).
+			Set("Authorization", aliceToken).
+			Set("Content-Type", "application/json").
+			Send(tpl.ProductUpdateBody{Desc: &desc}).
+			End()
+		require.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		res.Content() // close http client
+
+		unprotected := false
+		res, err = request.Put(fmt.Sprintf("%s/v1/products/%s", tt.Host, product.Name)).
+			Set("Authorization", aliceToken).
+			Set("Content-Type", "application/json").
+			Send(tpl.ProductUpdateBody{Protected: &unprotected}).
+			End()
+		require.Nil(err)
+		assert.Equal(202, res.StatusCode)
+		json := tpl.ChangeRequestInfoRes{}
+		res.JSON(&json)
+		assert.Equal(schema.ActionProductUpdate, json.Result.Action)
+
+		res, err = request.Post(fmt.Sprintf("%s/v1/products/%s/labels/%s:assign", tt.Host, product.Name, label.Name)).
+			Set("Authorization", aliceToken).
+			Set("Content-Type", "application/json").
+			Send(tpl.UsersGroupsBody{Users: []string{tpl.RandUID()}}).
+			End()
+		require.Nil(err)
+		assert.Equal(202, res.StatusCode)
+		res.Content() // close http client
+
+		approve(t, json.Result.HID)
+		res, err = request.Post(fmt.Sprintf("%s/v1/products/%s/labels/%s:assign", tt.Host, product.Name, label.Name)).
+			Set("Authorization", aliceToken).
+			Set("Content-Type", "application/json").
+			Send(tpl.UsersGroupsBody{Users: []string{tpl.RandUID()}}).
+			End()
+		require.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		res.Content() // close http client
+	})
+}
+
+// routerWriteRoutes 解析 router.go，返回 /v1、/v2 路由中产品下的全部写路由
+func routerWriteRoutes(t *testing.T) map[string]bool {
+	f, err := parser.ParseFile(token.NewFileSet(), "router.go", nil, 0)
+	require.Nil(t, err)
+
+	routes := map[string]bool{}
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		root := "/v1"
+		if fn.Name.Name == "newRoutersV2" {
+			root = "/v2"
+		}
+		ast.Inspect(fn, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok || len(call.Args) == 0 {
+				return true
+			}
+			sel, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			if x, ok := sel.X.(*ast.Ident); !ok || x.Name != "routerV1" {
+				return true
+			}
+			method := strings.ToUpper(sel.Sel.Name)
+			switch method {
+			case "POST", "PUT", "PATCH", "DELETE":
+			default:
+				return true
+			}
+			lit, ok := call.Args[0].(*ast.BasicLit)
+			if !ok {
+				return true
+			}
+			pattern, err := strconv.Unquote(lit.Value)
+			require.Nil(t, err)
+			if strings.HasPrefix(pattern, "/products/:product") {
+				routes[method+" "+root+pattern] = true
+			}
+			return true
+		})
+	}
+	return routes
+}
+
+func TestProtectedRoutesCoverage(t *testing.T) {
+	assert := assert.New(t)
+
+	routes := routerWriteRoutes(t)
+	assert.True(len(routes) > 40)
+	for route := range routes {
+		_, protected := protectedRoutes[route]
+		exempted := unprotectedRoutes[route]
+		assert.True(protected || exempted, "write route %q should be protected or explicitly exempted", route)
+		assert.False(protected && exempted, "route %q should not be both protected and exempted", route)
+	}
+	for route := range protectedRoutes {
+		assert.True(routes[route], "protected route %q not found in router", route)
+	}
+	for route := range unprotectedRoutes {
+		assert.True(routes[route], "exempted route %q not found in router", route)
+	}
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/DavidCai1993/request"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/teambition/urbs-setting/src/schema"
+	"github.com/teambition/urbs-setting/src/tpl"
+)
+
+func TestChangeAPIs(t *testing.T) {
+	tt, cleanup := SetUpTestTools()
+	defer cleanup()
+
+	product, err := createProduct(tt)
+	assert.Nil(t, err)
+
+	label, err := createLabel(tt, product.Name)
+	assert.Nil(t, err)
+
+	users, err := createUsers(tt, 2)
+	assert.Nil(t, err)
+
+	res, err := request.Post(fmt.Sprintf("%s/v1/products/%s/labels", tt.Host, product.Name)).
+		Set("Content-Type", "application/json").
+		Send(tpl.LabelBody{Name: label.Name, Desc: label.Name}).
+		End()
+	assert.Nil(t, err)
+	assert.Equal(t, 409, res.StatusCode)
+	res.Content() // close http client
+
+	res, err = request.Post(fmt.Sprintf("%s/v1/products/%s/labels/%s:assign", tt.Host, product.Name, label.Name)).
+		Set("Content-Type", "application/json").
+		Send(tpl.UsersGroupsBody{Users: schema.GetUsersUID(users)}).
+		End()
+	assert.Nil(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	res.Content() // close http client
+
+	var cursor string
+	t.Run(`"GET /v1/changes" should work`, func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		res, err := request.Get(fmt.Sprintf("%s/v1/changes?product=%s&wait=5", tt.Host, product.Name)).
+			End()
+		require.Nil(err)
+		assert.Equal(200, res.StatusCode)
+
+		json := tpl.ChangesRes{}
+		res.JSON(&json)
+		require.Equal(3, len(json.Result))
+		assert.Equal(schema.EventProductCreated, json.Result[0].Event)
+		assert.Equal(schema.EventLabelCreated, json.Result[1].Event)
+		assert.Equal(schema.EventLabelAssigned, json.Result[2].Event)
+		assert.Equal(product.Name, json.Result[2].Product)
+		assert.Equal(json.Result[2].Cursor, json.NextCursor)
+
+		data := struct {
+			Label   string   `json:"label"`
+			Release int64    `json:"release"`
+			Users   []string `json:"users"`
+		}{}
+		require.Nil(decodeChangeData(json.Result[2], &data))
+		assert.Equal(label.Name, data.Label)
+		assert.Equal(int64(1), data.Release)
+		assert.ElementsMatch(schema.GetUsersUID(users), data.Users)
+		cursor = json.NextCursor
+	})
+
+	t.Run(`"GET /v1/changes" should resume from cursor`, func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		res, err := request.Get(fmt.Sprintf("%s/v1/changes?product=%s&cursor=%s&wait=1", tt.Host, product.Name, cursor)).
+			End()
+		require.Nil(err)
+		assert.Equal(200, res.StatusCode)
+
+		json := tpl.ChangesRes{}
+		res.JSON(&json)
+		assert.Equal(0, len(json.Result))
+		assert.Equal(cursor, json.NextCursor)
+
+		res, err = request.Delete(fmt.Sprintf("%s/v1/products/%s/labels/%s/users/%s", tt.Host, product.Name, label.Name, users[0].UID)).
+			End()
+		require.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		res.Content() // close http client
+
+		res, err = request.Get(fmt.Sprintf("%s/v1/changes?product=%s&cursor=%s&wait=5", tt.Host, product.Name, cursor)).
+			End()
+		require.Nil(err)
+		assert.Equal(200, res.StatusCode)
+
+		json = tpl.ChangesRes{}
+		res.JSON(&json)
+		require.Equal(1, len(json.Result))
+		assert.Equal(schema.EventLabelUserRemoved, json.Result[0].Event)
+		assert.NotEqual(cursor, json.NextCursor)
+	})
+
+	t.Run(`"GET /v1/changes" should not skip changes committed after the cursor`, func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		res, err := request.Get(fmt.Sprintf("%s/v1/changes?product=%s&cursor=%s&wait=1", tt.Host, product.Name, cursor)).
+			End()
+		require.Nil(err)
+		json := tpl.ChangesRes{}
+		res.JSON(&json)
+		cursor = json.NextCursor
+
+		// 长事务先分配到较小的自增 ID，晚于之后的事件提交
+		tx, err := tt.DB.Begin()
+		require.Nil(err)
+		_, err = tx.Insert(schema.TableChange).
+			Rows(schema.Change{Product: product.Name, Event: "test.slow", Data: "{}"}).
+			Executor().Exec()
+		require.Nil(err)
+
+		res, err = request.Delete(fmt.Sprintf("%s/v1/products/%s/labels/%s/users/%s", tt.Host, product.Name, label.Name, users[1].UID)).
+			End()
+		require.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		res.Content() // close http client
+
+		res, err = request.Get(fmt.Sprintf("%s/v1/changes?product=%s&cursor=%s&wait=5", tt.Host, product.Name, cursor)).
+			End()
+		require.Nil(err)
+		json = tpl.ChangesRes{}
+		res.JSON(&json)
+		require.Equal(1, len(json.Result))
+		assert.Equal(schema.EventLabelUserRemoved, json.Result[0].Event)
+		cursor = json.NextCursor
+
+		require.Nil(tx.Commit())
+		res, err = request.Get(fmt.Sprintf("%s/v1/changes?product=%s&cursor=%s&wait=5", tt.Host, product.Name, cursor)).
+			End()
+		require.Nil(err)
+		json = tpl.ChangesRes{}
+		res.JSON(&json)
+		require.Equal(1, len(json.Result))
+		assert.Equal("test.slow", json.Result[0].Event)
+	})
+
+	t.Run(`"GET /v1/changes" with invalid cursor`, func(t *testing.T) {
+		assert := assert.New(t)
+
+		res, err := request.Get(fmt.Sprintf("%s/v1/changes?cursor=abc", tt.Host)).
+			End()
+		assert.Nil(err)
+		assert.Equal(400, res.StatusCode)
+		res.Content()
+	})
+}
+
+func decodeChangeData(change tpl.ChangeInfo, v interface{}) error {
+	return json.Unmarshal(change.Data, v)
+}
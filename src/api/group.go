@@ -1,6 +1,8 @@
 package api
 
 import (
+	"net/http"
+
 	"github.com/teambition/gear"
 	"github.com/teambition/urbs-setting/src/bll"
 	"github.com/teambition/urbs-setting/src/tpl"
@@ -128,6 +130,21 @@ func (a *Group) Delete(ctx *gear.Context) error {
 	return ctx.OkJSON(tpl.BoolRes{Result: true})
 }
 
+// Import 流式导入群组，请求体为 CSV 或 NDJSON，返回执行导入的后台任务
+func (a *Group) Import(ctx *gear.Context) error {
+	format, err := tpl.ImportFormatOf(ctx.GetHeader(gear.HeaderContentType))
+	if err != nil {
+		return err
+	}
+
+	job, err := a.blls.Import.Groups(ctx, format, ctx.Req.Body)
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusAccepted, tpl.JobRes{Result: *job})
+}
+
 // BatchAddMembers ..
 func (a *Group) BatchAddMembers(ctx *gear.Context) error {
 	req := tpl.GroupURL{}
@@ -140,11 +157,36 @@ func (a *Group) BatchAddMembers(ctx *gear.Context) error {
 		return err
 	}
 
-	if err := a.blls.Group.BatchAddMembers(ctx, req.Kind, req.UID, body.Users); err != nil {
+	job, err := a.blls.Group.BatchAddMembers(ctx, req.Kind, req.UID, body.Users)
+	if err != nil {
 		return err
 	}
 
-	return ctx.OkJSON(tpl.BoolRes{Result: true})
+	res := tpl.BoolJobRes{}
+	res.Result = true
+	if job != nil {
+		res.Job = job.HID
+	}
+	return ctx.OkJSON(res)
+}
+
+// ImportMembers 流式导入群组成员，请求体为 CSV 或 NDJSON，返回执行导入的后台任务
+func (a *Group) ImportMembers(ctx *gear.Context) error {
+	req := tpl.GroupURL{}
+	if err := ctx.ParseURL(&req); err != nil {
+		return err
+	}
+	format, err := tpl.ImportFormatOf(ctx.GetHeader(gear.HeaderContentType))
+	if err != nil {
+		return err
+	}
+
+	job, err := a.blls.Import.Members(ctx, req.Kind, req.UID, format, ctx.Req.Body)
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusAccepted, tpl.JobRes{Result: *job})
 }
 
 // RemoveMembers ..
@@ -153,9 +195,15 @@ func (a *Group) RemoveMembers(ctx *gear.Context) error {
 	if err := ctx.ParseURL(&req); err != nil {
 		return err
 	}
-	if err := a.blls.Group.RemoveMembers(ctx, req.Kind, req.UID, req.User, req.SyncLt); err != nil {
+	job, err := a.blls.Group.RemoveMembers(ctx, req.Kind, req.UID, req.User, req.SyncLt)
+	if err != nil {
 		return err
 	}
 
-	return ctx.OkJSON(tpl.BoolRes{Result: true})
+	res := tpl.BoolJobRes{}
+	res.Result = true
+	if job != nil {
+		res.Job = job.HID
+	}
+	return ctx.OkJSON(res)
 }
@@ -1,8 +1,11 @@
 package api
 
 import (
+	"net/http"
+
 	"github.com/teambition/gear"
 	"github.com/teambition/urbs-setting/src/bll"
+	"github.com/teambition/urbs-setting/src/tpl"
 )
 
 // Healthz ..
@@ -12,8 +15,21 @@ type Healthz struct {
 
 // Get ..
 func (a *Healthz) Get(ctx *gear.Context) error {
-	stats := a.blls.Models.Healthz.DBStats(ctx)
 	return ctx.OkJSON(map[string]interface{}{
-		"dbConnect": stats.OpenConnections > 0,
+		"dbConnect": a.blls.Healthz.DBConnect(ctx),
 	})
 }
+
+// Livez 存活检查，只要进程能响应请求即返回 200，不检查数据库，避免数据库故障时实例被反复重启
+func (a *Healthz) Livez(ctx *gear.Context) error {
+	return ctx.OkJSON(map[string]string{"status": tpl.HealthOK})
+}
+
+// Readyz 就绪检查，检查主库和从库连接、从库延迟、数据库结构升级和服务是否正在关闭，不能接收流量时返回 503
+func (a *Healthz) Readyz(ctx *gear.Context) error {
+	res := a.blls.Healthz.Ready(ctx)
+	if !res.Ready() {
+		return ctx.JSON(http.StatusServiceUnavailable, res)
+	}
+	return ctx.OkJSON(res)
+}
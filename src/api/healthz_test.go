@@ -2,10 +2,12 @@ package api
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/DavidCai1993/request"
 	"github.com/stretchr/testify/assert"
+	"github.com/teambition/urbs-setting/src/tpl"
 )
 
 func TestHealthzAPIs(t *testing.T) {
@@ -23,4 +25,48 @@ func TestHealthzAPIs(t *testing.T) {
 		res.JSON(&json)
 		assert.True(json["dbConnect"].(bool))
 	})
+
+	t.Run(`"GET /livez" should work`, func(t *testing.T) {
+		assert := assert.New(t)
+
+		res, err := request.Get(fmt.Sprintf("%s/livez", tt.Host)).End()
+		assert.Nil(err)
+		assert.Equal(200, res.StatusCode)
+
+		json := map[string]interface{}{}
+		res.JSON(&json)
+		assert.Equal("ok", json["status"])
+	})
+
+	t.Run(`"GET /readyz" should work`, func(t *testing.T) {
+		assert := assert.New(t)
+
+		res, err := request.Get(fmt.Sprintf("%s/readyz", tt.Host)).End()
+		assert.Nil(err)
+		assert.Equal(200, res.StatusCode)
+
+		json := tpl.ReadyzRes{}
+		res.JSON(&json)
+		assert.Equal("ok", json.Status)
+		assert.Equal(5, len(json.Checks))
+		names := make([]string, 0, len(json.Checks))
+		for _, c := range json.Checks {
+			assert.NotEqual("fail", c.Status, c.Name+": "+c.Message)
+			assert.True(c.Latency >= 0)
+			names = append(names, c.Name)
+		}
+		assert.Equal([]string{"shutdown", "db", "rd_db", "replica_lag", "migrations"}, names)
+	})
+
+	t.Run(`"GET /metrics" should work`, func(t *testing.T) {
+		assert := assert.New(t)
+
+		res, err := request.Get(fmt.Sprintf("%s/metrics", tt.Host)).End()
+		assert.Nil(err)
+		assert.Equal(200, res.StatusCode)
+
+		text, _ := res.Text()
+		assert.True(strings.Contains(text, "urbs_http_request_duration_seconds"))
+		assert.True(strings.Contains(text, `urbs_db_open_connections{pool="primary"}`))
+	})
 }
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/DavidCai1993/request"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/teambition/urbs-setting/src/schema"
+	"github.com/teambition/urbs-setting/src/tpl"
+)
+
+func TestImportAPIs(t *testing.T) {
+	tt, cleanup := SetUpTestTools()
+	defer cleanup()
+
+	post := func(path, contentType, body string) *request.Response {
+		res, err := request.Post(tt.Host+path).
+			Set("Content-Type", contentType).
+			Send(body).
+			End()
+		require.Nil(t, err)
+		return res
+	}
+	importJob := func(path, contentType, body string) schema.Job {
+		res := post(path, contentType, body)
+		require.Equal(t, 202, res.StatusCode)
+		json := tpl.JobRes{}
+		res.JSON(&json)
+		job, err := waitJob(tt, json.Result.HID)
+		require.Nil(t, err)
+		return job
+	}
+	jobErrors := func(hid string) []schema.JobError {
+		res, err := request.Get(fmt.Sprintf("%s/v1/jobs/%s/errors", tt.Host, hid)).End()
+		require.Nil(t, err)
+		require.Equal(t, 200, res.StatusCode)
+		json := tpl.JobErrorsRes{}
+		res.JSON(&json)
+		return json.Result
+	}
+
+	t.Run(`"POST /v1/users:import"`, func(t *testing.T) {
+		t.Run("should work with CSV", func(t *testing.T) {
+			assert := assert.New(t)
+
+			uid1, uid2 := tpl.RandUID(), tpl.RandUID()
+			job := importJob("/v1/users:import", "text/csv", fmt.Sprintf("uid\n%s\n\"a b\"\n%s\n", uid1, uid2))
+			assert.Equal(schema.JobSucceeded, job.Status)
+			assert.Equal(schema.JobImportUsers, job.Kind)
+			assert.Equal(int64(2), job.Processed)
+			assert.Equal(int64(1), job.Failed)
+
+			errs := jobErrors(job.HID)
+			assert.Equal(1, len(errs))
+			assert.Equal(int64(3), errs[0].Line)
+			assert.Equal("a b", errs[0].UID)
+
+			checkUserExists(tt, t, uid1)
+			checkUserExists(tt, t, uid2)
+		})
+
+		t.Run("should work with NDJSON", func(t *testing.T) {
+			assert := assert.New(t)
+
+			uid := tpl.RandUID()
+			job := importJob("/v1/users:import", "application/x-ndjson", fmt.Sprintf("{\"uid\":%q}\n\n{bad json}\n", uid))
+			assert.Equal(schema.JobSucceeded, job.Status)
+			assert.Equal(int64(1), job.Processed)
+			assert.Equal(int64(1), job.Failed)
+
+			errs := jobErrors(job.HID)
+			assert.Equal(1, len(errs))
+			assert.Equal(int64(3), errs[0].Line)
+			assert.True(strings.HasPrefix(errs[0].Message, "invalid JSON"))
+
+			checkUserExists(tt, t, uid)
+		})
+
+		t.Run("should return error", func(t *testing.T) {
+			assert := assert.New(t)
+
+			res := post("/v1/users:import", "application/json", `[]`)
+			assert.Equal(415, res.StatusCode)
+			res.Content() // close http client
+
+			res = post("/v1/users:import", "text/csv", "id\nabc\n")
+			assert.Equal(400, res.StatusCode)
+			res.Content() // close http client
+
+			res = post("/v1/users:import", "text/csv", "")
+			assert.Equal(400, res.StatusCode)
+			res.Content() // close http client
+		})
+	})
+
+	t.Run(`"POST /v1/groups:import"`, func(t *testing.T) {
+		t.Run("should work", func(t *testing.T) {
+			assert := assert.New(t)
+
+			uid := tpl.RandUID()
+			job := importJob("/v1/groups:import", "text/csv", fmt.Sprintf("uid,kind,desc\n%s,organization,imported\n%s,Bad,\n", uid, tpl.RandUID()))
+			assert.Equal(schema.JobSucceeded, job.Status)
+			assert.Equal(int64(1), job.Processed)
+			assert.Equal(int64(1), job.Failed)
+
+			checkGroupExists(tt, t, uid, "organization")
+		})
+	})
+
+	t.Run(`"POST /v1/groups/:uid/members:import"`, func(t *testing.T) {
+		group, err := createGroup(tt)
+		require.Nil(t, err)
+
+		t.Run("should work", func(t *testing.T) {
+			assert := assert.New(t)
+
+			uid1, uid2 := tpl.RandUID(), tpl.RandUID()
+			job := importJob(fmt.Sprintf("/v1/groups/%s/members:import?kind=%s", group.UID, group.Kind),
+				"application/x-ndjson", fmt.Sprintf("{\"uid\":%q}\n{\"uid\":%q}", uid1, uid2))
+			assert.Equal(schema.JobSucceeded, job.Status)
+			assert.Equal(schema.JobImportMembers, job.Kind)
+			assert.Equal(int64(2), job.Processed)
+			assert.Equal(int64(0), job.Failed)
+
+			res, err := request.Get(fmt.Sprintf("%s/v1/groups/%s/members?kind=%s", tt.Host, group.UID, group.Kind)).End()
+			assert.Nil(err)
+			json := tpl.GroupMembersRes{}
+			res.JSON(&json)
+			assert.Equal(2, len(json.Result))
+		})
+
+		t.Run("should 404 if group not exists", func(t *testing.T) {
+			assert := assert.New(t)
+
+			res := post(fmt.Sprintf("/v1/groups/%s/members:import", tpl.RandUID()), "text/csv", "uid\nabc\n")
+			assert.Equal(404, res.StatusCode)
+			res.Content() // close http client
+		})
+	})
+}
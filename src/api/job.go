@@ -0,0 +1,66 @@
+package api
+
+import (
+	"github.com/teambition/gear"
+	"github.com/teambition/urbs-setting/src/bll"
+	"github.com/teambition/urbs-setting/src/service"
+	"github.com/teambition/urbs-setting/src/tpl"
+)
+
+// Job ..
+type Job struct {
+	blls *bll.Blls
+}
+
+// List ..
+func (a *Job) List(ctx *gear.Context) error {
+	req := tpl.JobsURL{}
+	if err := ctx.ParseURL(&req); err != nil {
+		return err
+	}
+
+	res, err := a.blls.Job.List(ctx, req.Kind, req.Pagination)
+	if err != nil {
+		return err
+	}
+
+	return ctx.OkJSON(res)
+}
+
+// Get ..
+func (a *Job) Get(ctx *gear.Context) error {
+	req := tpl.JobURL{}
+	if err := ctx.ParseURL(&req); err != nil {
+		return err
+	}
+
+	jobID := service.HIDToID(req.HID, "job")
+	if jobID <= 0 {
+		return gear.ErrBadRequest.WithMsgf("invalid job hid: %s", req.HID)
+	}
+	res, err := a.blls.Job.Get(ctx, jobID)
+	if err != nil {
+		return err
+	}
+
+	return ctx.OkJSON(res)
+}
+
+// Errors ..
+func (a *Job) Errors(ctx *gear.Context) error {
+	req := tpl.JobErrorsURL{}
+	if err := ctx.ParseURL(&req); err != nil {
+		return err
+	}
+
+	jobID := service.HIDToID(req.HID, "job")
+	if jobID <= 0 {
+		return gear.ErrBadRequest.WithMsgf("invalid job hid: %s", req.HID)
+	}
+	res, err := a.blls.Job.Errors(ctx, jobID, req.Pagination)
+	if err != nil {
+		return err
+	}
+
+	return ctx.OkJSON(res)
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DavidCai1993/request"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/teambition/urbs-setting/src/schema"
+	"github.com/teambition/urbs-setting/src/tpl"
+)
+
+func waitJob(tt *TestTools, hid string) (job schema.Job, err error) {
+	for i := 0; i < 50; i++ {
+		res, e := request.Get(fmt.Sprintf("%s/v1/jobs/%s", tt.Host, hid)).End()
+		if e != nil {
+			return job, e
+		}
+		json := tpl.JobRes{}
+		if _, err = res.JSON(&json); err != nil {
+			return
+		}
+		job = json.Result
+		if job.Status != schema.JobRunning {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return job, fmt.Errorf("job %s not finished", hid)
+}
+
+func TestJobAPIs(t *testing.T) {
+	tt, cleanup := SetUpTestTools()
+	defer cleanup()
+
+	product, err := createProduct(tt)
+	assert.Nil(t, err)
+
+	label, err := createLabel(tt, product.Name)
+	assert.Nil(t, err)
+
+	group, users, err := createGroupWithUsers(tt, 3)
+	assert.Nil(t, err)
+
+	for _, user := range users {
+		res, err := request.Get(fmt.Sprintf("%s/users/%s/labels:cache?product=%s", tt.Host, user.UID, product.Name)).
+			End()
+		assert.Nil(t, err)
+		res.Content() // close http client
+	}
+
+	var jobHID string
+	t.Run(`label assigned to group should invalidate members' label caches`, func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		res, err := request.Post(fmt.Sprintf("%s/v1/products/%s/labels/%s:assign", tt.Host, product.Name, label.Name)).
+			Set("Content-Type", "application/json").
+			Send(tpl.UsersGroupsBody{Groups: []string{group.UID}}).
+			End()
+		require.Nil(err)
+		assert.Equal(200, res.StatusCode)
+
+		json := tpl.LabelReleaseInfoRes{}
+		res.JSON(&json)
+		require.NotEqual("", json.Result.Job)
+		jobHID = json.Result.Job
+
+		job, err := waitJob(tt, jobHID)
+		require.Nil(err)
+		assert.Equal(jobHID, job.HID)
+		assert.Equal(schema.JobInvalidateLabelCache, job.Kind)
+		assert.Equal(schema.JobSucceeded, job.Status)
+		assert.Equal(int64(3), job.Processed)
+		assert.Equal(int64(3), job.Invalidated)
+		assert.NotNil(job.FinishedAt)
+
+		var count int64
+		_, err = tt.DB.ScanVal(&count, "select count(*) from `user_label_cache` where `product_id` = ? and `active_at` = 1", product.ID)
+		assert.Nil(err)
+		assert.Equal(int64(3), count)
+
+		res, err = request.Get(fmt.Sprintf("%s/users/%s/labels:cache?product=%s", tt.Host, users[0].UID, product.Name)).
+			End()
+		require.Nil(err)
+		json2 := tpl.CacheLabelsInfoRes{}
+		res.JSON(&json2)
+		require.Equal(1, len(json2.Result))
+		assert.Equal(label.Name, json2.Result[0].Label)
+	})
+
+	t.Run(`removing members should invalidate their label caches`, func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		res, err := request.Delete(fmt.Sprintf("%s/v1/groups/%s/members?user=%s", tt.Host, group.UID, users[0].UID)).
+			End()
+		require.Nil(err)
+		assert.Equal(200, res.StatusCode)
+
+		json := tpl.BoolJobRes{}
+		res.JSON(&json)
+		assert.True(json.Result)
+		require.NotEqual("", json.Job)
+
+		job, err := waitJob(tt, json.Job)
+		require.Nil(err)
+		assert.Equal(schema.JobSucceeded, job.Status)
+		assert.Equal(int64(1), job.Processed)
+		assert.Equal(int64(1), job.Invalidated)
+
+		res, err = request.Get(fmt.Sprintf("%s/users/%s/labels:cache?product=%s", tt.Host, users[0].UID, product.Name)).
+			End()
+		require.Nil(err)
+		json2 := tpl.CacheLabelsInfoRes{}
+		res.JSON(&json2)
+		assert.Equal(0, len(json2.Result))
+	})
+
+	t.Run(`"GET /v1/jobs"`, func(t *testing.T) {
+		assert := assert.New(t)
+
+		res, err := request.Get(fmt.Sprintf("%s/v1/jobs?kind=%s", tt.Host, schema.JobInvalidateLabelCache)).
+			End()
+		assert.Nil(err)
+		assert.Equal(200, res.StatusCode)
+
+		json := tpl.JobsRes{}
+		res.JSON(&json)
+		assert.True(json.TotalSize >= 2)
+		assert.True(len(json.Result) >= 2)
+		assert.Equal(jobHID, json.Result[1].HID)
+	})
+
+	t.Run(`"GET /v1/jobs/:hid" with invalid hid`, func(t *testing.T) {
+		assert := assert.New(t)
+
+		res, err := request.Get(fmt.Sprintf("%s/v1/jobs/%s", tt.Host, label.Name)).
+			End()
+		assert.Nil(err)
+		assert.Equal(400, res.StatusCode)
+		res.Content()
+	})
+}
@@ -280,3 +280,42 @@ func (a *Label) DeleteGroup(ctx *gear.Context) error {
 	}
 	return ctx.OkJSON(res)
 }
+
+// ListVersions ..
+func (a *Label) ListVersions(ctx *gear.Context) error {
+	req := tpl.ProductLabelURL{}
+	if err := ctx.ParseURL(&req); err != nil {
+		return err
+	}
+	res, err := a.blls.Label.ListVersions(ctx, req.Product, req.Label, req.Pagination)
+	if err != nil {
+		return err
+	}
+	return ctx.OkJSON(res)
+}
+
+// DiffVersions ..
+func (a *Label) DiffVersions(ctx *gear.Context) error {
+	req := tpl.ProductLabelVersionDiffURL{}
+	if err := ctx.ParseURL(&req); err != nil {
+		return err
+	}
+	res, err := a.blls.Label.DiffVersions(ctx, req.Product, req.Label, req.VersionDiffQuery)
+	if err != nil {
+		return err
+	}
+	return ctx.OkJSON(res)
+}
+
+// RestoreVersion ..
+func (a *Label) RestoreVersion(ctx *gear.Context) error {
+	req := tpl.ProductLabelVersionURL{}
+	if err := ctx.ParseURL(&req); err != nil {
+		return err
+	}
+	res, err := a.blls.Label.RestoreVersion(ctx, req.Product, req.Label, req.Version)
+	if err != nil {
+		return err
+	}
+	return ctx.OkJSON(res)
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"testing"
@@ -8,9 +9,11 @@ import (
 
 	"github.com/DavidCai1993/request"
 	"github.com/stretchr/testify/assert"
+	"github.com/teambition/urbs-setting/src/bll"
 	"github.com/teambition/urbs-setting/src/schema"
 	"github.com/teambition/urbs-setting/src/service"
 	"github.com/teambition/urbs-setting/src/tpl"
+	"github.com/teambition/urbs-setting/src/util"
 )
 
 func createLabel(tt *TestTools, productName string) (label schema.Label, err error) {
@@ -128,6 +131,59 @@ func TestLabelAPIs(t *testing.T) {
 			assert.True(data.UpdatedAt.UTC().Unix() > int64(0))
 			assert.Nil(data.OfflineAt)
 			assert.Equal(int64(0), data.Status)
+			assert.Equal(int64(0), data.ExactStatus)
+			assert.Nil(data.ReconciledAt)
+		})
+
+		t.Run("should return exact status after reconciliation", func(t *testing.T) {
+			assert := assert.New(t)
+
+			product, err := createProduct(tt)
+			assert.Nil(err)
+			label, err := createLabel(tt, product.Name)
+			assert.Nil(err)
+			group, users, err := createGroupWithUsers(tt, 2)
+			assert.Nil(err)
+
+			// users[0] 既被直接设置，又通过群组继承
+			res, err := request.Post(fmt.Sprintf("%s/v1/products/%s/labels/%s:assign", tt.Host, product.Name, label.Name)).
+				Set("Content-Type", "application/json").
+				Send(tpl.UsersGroupsBody{Users: []string{users[0].UID}, Groups: []string{group.UID}}).
+				End()
+			assert.Nil(err)
+			assert.Equal(200, res.StatusCode)
+			res.Content() // close http client
+
+			err = util.DigInvoke(func(blls *bll.Blls) error {
+				if _, _, err := blls.Statistic.Reconcile(context.Background()); err != nil {
+					return err
+				}
+				// 对账完成后释放锁，可以立即再次执行
+				_, _, err := blls.Statistic.Reconcile(context.Background())
+				return err
+			})
+			assert.Nil(err)
+
+			res, err = request.Get(fmt.Sprintf("%s/v1/products/%s/labels", tt.Host, product.Name)).
+				End()
+			assert.Nil(err)
+			assert.Equal(200, res.StatusCode)
+
+			json := tpl.LabelsInfoRes{}
+			res.JSON(&json)
+			assert.Equal(1, len(json.Result))
+			data := json.Result[0]
+			assert.Equal(int64(3), data.Status)
+			assert.Equal(int64(2), data.ExactStatus)
+			assert.NotNil(data.ReconciledAt)
+			assert.Equal(label.UpdatedAt.Unix(), data.UpdatedAt.Unix())
+
+			var total, count int64
+			_, err = tt.DB.ScanVal(&total, "select `status` from `urbs_statistic` where `name` = 'LabelRulesTotalSize'")
+			assert.Nil(err)
+			_, err = tt.DB.ScanVal(&count, "select count(*) from `label_rule`")
+			assert.Nil(err)
+			assert.Equal(count, total)
 		})
 	})
 
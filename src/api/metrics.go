@@ -0,0 +1,20 @@
+package api
+
+import (
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/teambition/gear"
+	"github.com/teambition/urbs-setting/src/metrics"
+)
+
+// Metrics ..
+type Metrics struct{}
+
+var metricsHandler = promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{
+	ErrorHandling: promhttp.ContinueOnError,
+})
+
+// Get 输出 Prometheus 指标
+func (a *Metrics) Get(ctx *gear.Context) error {
+	metricsHandler.ServeHTTP(ctx.Res, ctx.Req)
+	return nil
+}
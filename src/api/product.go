@@ -98,3 +98,16 @@ func (a *Product) Statistics(ctx *gear.Context) error {
 	}
 	return ctx.OkJSON(tpl.ProductStatisticsRes{Result: *res})
 }
+
+// Timeseries ..
+func (a *Product) Timeseries(ctx *gear.Context) error {
+	req := tpl.TimeseriesURL{}
+	if err := ctx.ParseURL(&req); err != nil {
+		return err
+	}
+	res, err := a.blls.Statistic.Timeseries(ctx, &req)
+	if err != nil {
+		return err
+	}
+	return ctx.OkJSON(tpl.TimeseriesRes{Result: *res})
+}
@@ -0,0 +1,188 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/teambition/gear"
+	"github.com/teambition/urbs-setting/src/bll"
+	"github.com/teambition/urbs-setting/src/tpl"
+	"gopkg.in/yaml.v2"
+)
+
+// maxProductConfigSize 声明式配置文件的最大长度，与请求体的限制一致
+const maxProductConfigSize = 2 << 22
+
+// 复制、推广时按以下路由检查请求者在目标产品上的权限
+const (
+	targetReadRoute   = "POST /v1/products/:product+:plan"
+	targetWriteRoute  = "POST /v1/products/:product+:apply"
+	targetCreateRoute = "POST /v1/products"
+)
+
+// ProductConfig ..
+type ProductConfig struct {
+	blls *bll.Blls
+}
+
+// Export ..
+func (a *ProductConfig) Export(ctx *gear.Context) error {
+	req := tpl.ProductConfigURL{}
+	if err := ctx.ParseURL(&req); err != nil {
+		return err
+	}
+	res, err := a.blls.ProductConfig.Export(ctx, req.Product)
+	if err != nil {
+		return err
+	}
+	if req.Format == "yaml" {
+		data, err := yaml.Marshal(res.Result)
+		if err != nil {
+			return err
+		}
+		ctx.Type("application/yaml; charset=utf-8")
+		return ctx.End(http.StatusOK, data)
+	}
+	return ctx.OkJSON(res)
+}
+
+// Plan ..
+func (a *ProductConfig) Plan(ctx *gear.Context) error {
+	req := tpl.ProductConfigURL{}
+	if err := ctx.ParseURL(&req); err != nil {
+		return err
+	}
+	cfg, err := readProductConfig(ctx)
+	if err != nil {
+		return err
+	}
+	res, err := a.blls.ProductConfig.Plan(ctx, req.Product, cfg, req.Prune)
+	if err != nil {
+		return err
+	}
+	return ctx.OkJSON(res)
+}
+
+// Apply ..
+func (a *ProductConfig) Apply(ctx *gear.Context) error {
+	req := tpl.ProductConfigURL{}
+	if err := ctx.ParseURL(&req); err != nil {
+		return err
+	}
+	cfg, err := readProductConfig(ctx)
+	if err != nil {
+		return err
+	}
+	res, err := a.blls.ProductConfig.Apply(ctx, req.Product, cfg, req.Prune)
+	if err != nil {
+		return err
+	}
+	return ctx.OkJSON(res)
+}
+
+// Clone ..
+func (a *ProductConfig) Clone(ctx *gear.Context) error {
+	req := tpl.ProductURL{}
+	if err := ctx.ParseURL(&req); err != nil {
+		return err
+	}
+	body := tpl.ProductCloneBody{}
+	if err := ctx.ParseBody(&body); err != nil {
+		return err
+	}
+	if err := a.checkTarget(ctx, body.Target, body.DryRun, true); err != nil {
+		return err
+	}
+	res, err := a.blls.ProductConfig.Clone(ctx, req.Product, &body)
+	if err != nil {
+		return err
+	}
+	return ctx.OkJSON(res)
+}
+
+// Promote ..
+func (a *ProductConfig) Promote(ctx *gear.Context) error {
+	req := tpl.ProductURL{}
+	if err := ctx.ParseURL(&req); err != nil {
+		return err
+	}
+	body := tpl.ProductPromoteBody{}
+	if err := ctx.ParseBody(&body); err != nil {
+		return err
+	}
+	if err := a.checkTarget(ctx, body.Target, body.DryRun, false); err != nil {
+		return err
+	}
+	res, err := a.blls.ProductConfig.Promote(ctx, req.Product, &body)
+	if err != nil {
+		return err
+	}
+	return ctx.OkJSON(res)
+}
+
+// checkTarget 检查请求者在目标产品上的权限：预演需要读权限，
+// 复制到不存在的产品时需要创建产品的权限，否则需要 apply 的权限
+func (a *ProductConfig) checkTarget(ctx *gear.Context, target string, dryRun, create bool) error {
+	if dryRun {
+		return checkRoute(ctx, a.blls, targetReadRoute, target)
+	}
+	if create {
+		exists, err := a.blls.Product.Exists(ctx, target)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return checkRoute(ctx, a.blls, targetCreateRoute, "")
+		}
+	}
+	return checkRoute(ctx, a.blls, targetWriteRoute, target)
+}
+
+// promoteTarget 复制、推广请求的目标产品
+type promoteTarget struct {
+	Target string `json:"target"`
+	DryRun bool   `json:"dryRun"`
+}
+
+// peekPromoteTarget 读取请求体中的目标产品，并恢复请求体供后续解析
+func peekPromoteTarget(ctx *gear.Context) (*promoteTarget, error) {
+	t := &promoteTarget{}
+	if err := peekBody(ctx, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// peekBody 解析 JSON 请求体到 v 但不消费请求体，后续处理仍可读取
+func peekBody(ctx *gear.Context, v interface{}) error {
+	if ctx.Req.Body == nil {
+		return gear.ErrBadRequest.WithMsg("request body required")
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(ctx.Req.Body, maxProductConfigSize))
+	if err != nil {
+		return gear.ErrBadRequest.WithMsgf("read request body error: %v", err)
+	}
+	ctx.Req.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(data), ctx.Req.Body))
+	if err := json.Unmarshal(data, v); err != nil {
+		return gear.ErrBadRequest.WithMsgf("invalid request body: %v", err)
+	}
+	return nil
+}
+
+// readProductConfig 读取请求体中 YAML 或 JSON 格式的声明式配置
+func readProductConfig(ctx *gear.Context) (*tpl.ProductConfig, error) {
+	if ctx.Req.Body == nil {
+		return nil, gear.ErrBadRequest.WithMsg("product config required")
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(ctx.Req.Body, maxProductConfigSize+1))
+	if err != nil {
+		return nil, gear.ErrBadRequest.WithMsgf("read request body error: %v", err)
+	}
+	if len(data) > maxProductConfigSize {
+		return nil, gear.ErrRequestEntityTooLarge.WithMsgf("product config too large: > %d bytes", maxProductConfigSize)
+	}
+	return tpl.ParseProductConfig(data)
+}
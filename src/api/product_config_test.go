@@ -0,0 +1,206 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/DavidCai1993/request"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/teambition/urbs-setting/src/tpl"
+)
+
+func TestProductConfigAPIs(t *testing.T) {
+	tt, cleanup := SetUpTestTools()
+	defer cleanup()
+
+	product, err := createProduct(tt)
+	require.Nil(t, err)
+	module, err := createModule(tt, product.Name)
+	require.Nil(t, err)
+	label, err := createLabel(tt, product.Name)
+	require.Nil(t, err)
+
+	config := fmt.Sprintf(`
+product: %s
+modules:
+  - name: %s
+    desc: updated
+    settings:
+      - name: theme
+        desc: theme
+        channels: [stable, beta]
+        values: [light, dark]
+        rules:
+          - kind: userPercent
+            percent: 10
+            value: dark
+  - name: web
+    desc: web app
+labels:
+  - name: beta
+    desc: beta users
+    clients: [web]
+    rules:
+      - kind: userPercent
+        percent: 5
+`, product.Name, module.Name)
+
+	post := func(action, query, body string) *request.Response {
+		res, err := request.Post(fmt.Sprintf("%s/v1/products/%s+:%s%s", tt.Host, product.Name, action, query)).
+			Send(body).
+			Set("Content-Type", "application/yaml").
+			End()
+		require.Nil(t, err)
+		return res
+	}
+
+	t.Run(`"POST /v1/products/:product+:plan"`, func(t *testing.T) {
+		t.Run("should work", func(t *testing.T) {
+			assert := assert.New(t)
+
+			res := post("plan", "", config)
+			assert.Equal(200, res.StatusCode)
+
+			json := tpl.ProductConfigPlanRes{}
+			res.JSON(&json)
+			assert.Equal(product.Name, json.Result.Product)
+			assert.False(json.Result.Prune)
+			targets := []string{}
+			for _, op := range json.Result.Operations {
+				targets = append(targets, op.Op+" "+op.Kind+" "+op.Target)
+			}
+			assert.Equal([]string{
+				"update module " + module.Name,
+				"create setting " + module.Name + "/theme",
+				"create settingRule " + module.Name + "/theme/userPercent",
+				"create module web",
+				"create label beta",
+				"create labelRule beta/userPercent",
+			}, targets)
+		})
+
+		t.Run("should include offline operations with prune", func(t *testing.T) {
+			assert := assert.New(t)
+
+			res := post("plan", "?prune=true", config)
+			assert.Equal(200, res.StatusCode)
+
+			json := tpl.ProductConfigPlanRes{}
+			res.JSON(&json)
+			assert.True(json.Result.Prune)
+			last := json.Result.Operations[len(json.Result.Operations)-1]
+			assert.Equal("offline", last.Op)
+			assert.Equal("label", last.Kind)
+			assert.Equal(label.Name, last.Target)
+		})
+
+		t.Run("should return 400 for invalid config", func(t *testing.T) {
+			assert := assert.New(t)
+
+			res := post("plan", "", "modules: [{name: web, unknown: 1}]")
+			assert.Equal(400, res.StatusCode)
+			res.Content() // close http client
+
+			res = post("plan", "", "product: other\nmodules: []")
+			assert.Equal(400, res.StatusCode)
+			res.Content() // close http client
+		})
+	})
+
+	t.Run(`"POST /v1/products/:product+:apply"`, func(t *testing.T) {
+		t.Run("should work", func(t *testing.T) {
+			assert := assert.New(t)
+
+			res := post("apply", "?prune=true", config)
+			assert.Equal(200, res.StatusCode)
+
+			json := tpl.ProductConfigPlanRes{}
+			res.JSON(&json)
+			assert.Equal(7, len(json.Result.Operations))
+
+			res = post("plan", "?prune=true", config)
+			assert.Equal(200, res.StatusCode)
+			json = tpl.ProductConfigPlanRes{}
+			res.JSON(&json)
+			assert.Equal(0, len(json.Result.Operations))
+		})
+
+		t.Run("should update and delete rules", func(t *testing.T) {
+			assert := assert.New(t)
+
+			changed := strings.Replace(config, "percent: 10", "percent: 20", 1)
+			changed = strings.Replace(changed, "      - kind: userPercent\n        percent: 5\n", "", 1)
+			changed = strings.Replace(changed, "    clients: [web]\n    rules:\n", "    clients: [web]\n", 1)
+
+			res := post("apply", "", changed)
+			assert.Equal(200, res.StatusCode)
+			json := tpl.ProductConfigPlanRes{}
+			res.JSON(&json)
+			assert.Equal(1, len(json.Result.Operations))
+			assert.Equal("update", json.Result.Operations[0].Op)
+
+			res = post("apply", "?prune=true", changed)
+			assert.Equal(200, res.StatusCode)
+			json = tpl.ProductConfigPlanRes{}
+			res.JSON(&json)
+			assert.Equal(1, len(json.Result.Operations))
+			assert.Equal("delete labelRule beta/userPercent", json.Result.Operations[0].Op+" "+json.Result.Operations[0].Kind+" "+json.Result.Operations[0].Target)
+		})
+	})
+
+	t.Run(`"GET /v1/products/:product+:export"`, func(t *testing.T) {
+		t.Run("should work", func(t *testing.T) {
+			assert := assert.New(t)
+
+			res, err := request.Get(fmt.Sprintf("%s/v1/products/%s+:export", tt.Host, product.Name)).
+				End()
+			assert.Nil(err)
+			assert.Equal(200, res.StatusCode)
+
+			json := tpl.ProductConfigRes{}
+			res.JSON(&json)
+			assert.Equal(product.Name, json.Result.Product)
+			assert.Equal(2, len(json.Result.Modules))
+			var mc *tpl.ModuleConfig
+			for _, m := range json.Result.Modules {
+				if m.Name == module.Name {
+					mc = m
+				}
+			}
+			require.NotNil(t, mc)
+			assert.Equal("updated", mc.Desc)
+			setting := mc.Settings[0]
+			assert.Equal([]string{"beta", "stable"}, setting.Channels)
+			assert.Equal([]string{"dark", "light"}, setting.Values)
+			assert.Equal(tpl.RuleConfig{Kind: "userPercent", Percent: 20, Value: "dark"}, *setting.Rules[0])
+			assert.Equal(1, len(json.Result.Labels))
+			assert.Equal("beta", json.Result.Labels[0].Name)
+			assert.Equal(0, len(json.Result.Labels[0].Rules))
+		})
+
+		t.Run("should work with yaml format", func(t *testing.T) {
+			assert := assert.New(t)
+
+			res, err := request.Get(fmt.Sprintf("%s/v1/products/%s+:export?format=yaml", tt.Host, product.Name)).
+				End()
+			assert.Nil(err)
+			assert.Equal(200, res.StatusCode)
+			assert.True(strings.HasPrefix(res.Header.Get("Content-Type"), "application/yaml"))
+
+			text, err := res.Text()
+			assert.Nil(err)
+			cfg, err := tpl.ParseProductConfig([]byte(text))
+			assert.Nil(err)
+			assert.Equal(product.Name, cfg.Product)
+
+			// 导出的配置再次 plan 没有差异
+			res = post("plan", "?prune=true", text)
+			assert.Equal(200, res.StatusCode)
+			json := tpl.ProductConfigPlanRes{}
+			res.JSON(&json)
+			assert.Equal(0, len(json.Result.Operations))
+		})
+	})
+}
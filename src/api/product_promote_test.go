@@ -0,0 +1,230 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/DavidCai1993/request"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/teambition/urbs-setting/src/tpl"
+)
+
+func TestProductPromoteAPIs(t *testing.T) {
+	tt, cleanup := SetUpTestTools()
+	defer cleanup()
+
+	source, err := createProduct(tt)
+	require.Nil(t, err)
+	target, err := createProduct(tt)
+	require.Nil(t, err)
+	group, err := createGroup(tt)
+	require.Nil(t, err)
+
+	config := `
+modules:
+  - name: web
+    desc: web app
+    settings:
+      - name: theme
+        values: [light, dark]
+        rules:
+          - kind: userPercent
+            percent: 10
+            value: dark
+      - name: font
+labels:
+  - name: beta
+    desc: beta users
+`
+	apply := func(config string) {
+		res, err := request.Post(fmt.Sprintf("%s/v1/products/%s+:apply", tt.Host, source.Name)).
+			Send(config).
+			Set("Content-Type", "application/yaml").
+			End()
+		require.Nil(t, err)
+		require.Equal(t, 200, res.StatusCode)
+		res.Content() // close http client
+	}
+	apply(config)
+
+	res, err := request.Post(fmt.Sprintf("%s/v1/products/%s/labels/beta:assign", tt.Host, source.Name)).
+		Set("Content-Type", "application/json").
+		Send(tpl.UsersGroupsBody{Groups: []string{group.UID}}).
+		End()
+	require.Nil(t, err)
+	require.Equal(t, 200, res.StatusCode)
+	res.Content() // close http client
+
+	post := func(action string, body interface{}) *request.Response {
+		res, err := request.Post(fmt.Sprintf("%s/v1/products/%s+:%s", tt.Host, source.Name, action)).
+			Set("Content-Type", "application/json").
+			Send(body).
+			End()
+		require.Nil(t, err)
+		return res
+	}
+	opsOf := func(ops []tpl.ProductConfigOp) []string {
+		res := []string{}
+		for _, op := range ops {
+			res = append(res, op.Op+" "+op.Kind+" "+op.Target)
+		}
+		return res
+	}
+
+	t.Run(`"POST /v1/products/:product+:promote"`, func(t *testing.T) {
+		body := tpl.ProductPromoteBody{
+			Target:  target.Name,
+			Modules: []string{"web/theme"},
+			Labels:  []string{"beta"},
+			Groups:  true,
+			DryRun:  true,
+		}
+
+		t.Run("should work with dryRun", func(t *testing.T) {
+			assert := assert.New(t)
+
+			res := post("promote", body)
+			assert.Equal(200, res.StatusCode)
+
+			json := tpl.ProductPromoteRes{}
+			res.JSON(&json)
+			assert.True(json.Result.DryRun)
+			assert.Equal(source.Name, json.Result.Source)
+			assert.Equal([]string{
+				"create module web",
+				"create setting web/theme",
+				"create settingRule web/theme/userPercent",
+				"create label beta",
+				"assign labelGroups beta",
+			}, opsOf(json.Result.Operations))
+			assert.Equal(0, len(json.Result.Conflicts))
+		})
+
+		t.Run("should work", func(t *testing.T) {
+			assert := assert.New(t)
+
+			body.DryRun = false
+			res := post("promote", body)
+			assert.Equal(200, res.StatusCode)
+			json := tpl.ProductPromoteRes{}
+			res.JSON(&json)
+			assert.Equal(5, len(json.Result.Operations))
+
+			res, err := request.Get(fmt.Sprintf("%s/v1/products/%s+:export", tt.Host, target.Name)).
+				End()
+			assert.Nil(err)
+			cfg := tpl.ProductConfigRes{}
+			res.JSON(&cfg)
+			assert.Equal(1, len(cfg.Result.Modules))
+			assert.Equal(1, len(cfg.Result.Modules[0].Settings))
+			assert.Equal("theme", cfg.Result.Modules[0].Settings[0].Name)
+			assert.Equal(1, len(cfg.Result.Labels))
+
+			// 再次推广没有操作
+			res = post("promote", body)
+			assert.Equal(200, res.StatusCode)
+			json = tpl.ProductPromoteRes{}
+			res.JSON(&json)
+			assert.Equal(0, len(json.Result.Operations))
+			assert.Equal(0, len(json.Result.Conflicts))
+		})
+
+		t.Run("should report conflicts", func(t *testing.T) {
+			assert := assert.New(t)
+
+			changed := strings.Replace(config, "values: [light, dark]", "values: [light, dark, auto]", 1)
+			changed = strings.Replace(changed, "value: dark", "value: auto", 1)
+			apply(changed)
+
+			res := post("promote", body)
+			assert.Equal(200, res.StatusCode)
+			json := tpl.ProductPromoteRes{}
+			res.JSON(&json)
+			assert.Equal(0, len(json.Result.Operations))
+			assert.Equal([]string{
+				"update setting web/theme",
+				"update settingRule web/theme/userPercent",
+			}, opsOf(json.Result.Conflicts))
+			assert.Equal("differs from source product", json.Result.Conflicts[0].Reason)
+
+			body.Overwrite = true
+			res = post("promote", body)
+			assert.Equal(200, res.StatusCode)
+			json = tpl.ProductPromoteRes{}
+			res.JSON(&json)
+			assert.Equal([]string{
+				"update setting web/theme",
+				"update settingRule web/theme/userPercent",
+			}, opsOf(json.Result.Operations))
+			assert.Equal(0, len(json.Result.Conflicts))
+		})
+
+		t.Run("should return error", func(t *testing.T) {
+			assert := assert.New(t)
+
+			res := post("promote", tpl.ProductPromoteBody{Target: target.Name})
+			assert.Equal(400, res.StatusCode)
+			res.Content() // close http client
+
+			res = post("promote", tpl.ProductPromoteBody{Target: source.Name, Labels: []string{"beta"}})
+			assert.Equal(400, res.StatusCode)
+			res.Content() // close http client
+
+			res = post("promote", tpl.ProductPromoteBody{Target: target.Name, Modules: []string{"web/unknown"}})
+			assert.Equal(404, res.StatusCode)
+			res.Content() // close http client
+
+			res = post("promote", tpl.ProductPromoteBody{Target: tpl.RandName(), Labels: []string{"beta"}})
+			assert.Equal(404, res.StatusCode)
+			res.Content() // close http client
+		})
+	})
+
+	t.Run(`"POST /v1/products/:product+:clone"`, func(t *testing.T) {
+		name := tpl.RandName()
+
+		t.Run("should work with dryRun", func(t *testing.T) {
+			assert := assert.New(t)
+
+			res := post("clone", tpl.ProductCloneBody{Target: name, DryRun: true})
+			assert.Equal(200, res.StatusCode)
+			json := tpl.ProductPromoteRes{}
+			res.JSON(&json)
+			assert.Equal([]string{
+				"create product " + name,
+				"create module web",
+				"create setting web/font",
+				"create setting web/theme",
+				"create settingRule web/theme/userPercent",
+				"create label beta",
+			}, opsOf(json.Result.Operations))
+
+			res, err := request.Get(fmt.Sprintf("%s/v1/products/%s+:export", tt.Host, name)).
+				End()
+			assert.Nil(err)
+			assert.Equal(404, res.StatusCode)
+			res.Content() // close http client
+		})
+
+		t.Run("should work", func(t *testing.T) {
+			assert := assert.New(t)
+
+			res := post("clone", tpl.ProductCloneBody{Target: name, Desc: "cloned", Groups: true})
+			assert.Equal(200, res.StatusCode)
+			json := tpl.ProductPromoteRes{}
+			res.JSON(&json)
+			assert.Equal(7, len(json.Result.Operations))
+			assert.Equal("assign labelGroups beta", opsOf(json.Result.Operations)[6])
+
+			res, err := request.Get(fmt.Sprintf("%s/v1/products/%s/labels/beta/groups", tt.Host, name)).
+				End()
+			assert.Nil(err)
+			groups := tpl.LabelGroupsInfoRes{}
+			res.JSON(&groups)
+			assert.Equal(1, len(groups.Result))
+			assert.Equal(group.UID, groups.Result[0].Group)
+		})
+	})
+}
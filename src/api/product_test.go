@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"testing"
@@ -8,8 +9,10 @@ import (
 
 	"github.com/DavidCai1993/request"
 	"github.com/stretchr/testify/assert"
+	"github.com/teambition/urbs-setting/src/bll"
 	"github.com/teambition/urbs-setting/src/schema"
 	"github.com/teambition/urbs-setting/src/tpl"
+	"github.com/teambition/urbs-setting/src/util"
 )
 
 func createProduct(tt *TestTools) (product schema.Product, err error) {
@@ -258,6 +261,85 @@ func TestProductAPIs(t *testing.T) {
 		})
 	})
 
+	t.Run(`"GET /v1/products/:product/statistics/timeseries"`, func(t *testing.T) {
+		product, err := createProduct(tt)
+		assert.Nil(t, err)
+
+		label, err := createLabel(tt, product.Name)
+		assert.Nil(t, err)
+
+		users, err := createUsers(tt, 2)
+		assert.Nil(t, err)
+
+		res, err := request.Post(fmt.Sprintf("%s/v1/products/%s/labels/%s:assign", tt.Host, product.Name, label.Name)).
+			Set("Content-Type", "application/json").
+			Send(tpl.UsersGroupsBody{Users: schema.GetUsersUID(users)}).
+			End()
+		assert.Nil(t, err)
+		assert.Equal(t, 200, res.StatusCode)
+		res.Content() // close http client
+
+		err = util.DigInvoke(func(blls *bll.Blls) error {
+			return blls.Statistic.Flush(context.Background())
+		})
+		assert.Nil(t, err)
+
+		t.Run("should work", func(t *testing.T) {
+			assert := assert.New(t)
+
+			res, err := request.Get(fmt.Sprintf("%s/v1/products/%s/statistics/timeseries?metric=assignments", tt.Host, product.Name)).
+				End()
+			assert.Nil(err)
+			assert.Equal(200, res.StatusCode)
+
+			json := tpl.TimeseriesRes{}
+			res.JSON(&json)
+			assert.Equal("assignments", json.Result.Metric)
+			assert.Equal("day", json.Result.Granularity)
+			assert.Equal(30, len(json.Result.Points))
+			today := json.Result.Points[29]
+			assert.Equal(time.Now().UTC().Format("2006-01-02"), today.Date)
+			assert.Equal(int64(2), today.Value)
+		})
+
+		t.Run("should filter by label", func(t *testing.T) {
+			assert := assert.New(t)
+
+			today := time.Now().UTC().Format("2006-01-02")
+			res, err := request.Get(fmt.Sprintf("%s/v1/products/%s/statistics/timeseries?metric=assignments&from=%s&to=%s&granularity=month&label=%s",
+				tt.Host, product.Name, today, today, label.Name)).
+				End()
+			assert.Nil(err)
+			assert.Equal(200, res.StatusCode)
+
+			json := tpl.TimeseriesRes{}
+			res.JSON(&json)
+			assert.Equal(1, len(json.Result.Points))
+			assert.Equal(today[:8]+"01", json.Result.Points[0].Date)
+			assert.Equal(int64(2), json.Result.Points[0].Value)
+		})
+
+		t.Run("should 400 with invalid metric", func(t *testing.T) {
+			assert := assert.New(t)
+
+			res, err := request.Get(fmt.Sprintf("%s/v1/products/%s/statistics/timeseries?metric=clicks", tt.Host, product.Name)).
+				End()
+			assert.Nil(err)
+			assert.Equal(400, res.StatusCode)
+			res.Content() // close http client
+		})
+
+		t.Run("should 404 with unknown label", func(t *testing.T) {
+			assert := assert.New(t)
+
+			res, err := request.Get(fmt.Sprintf("%s/v1/products/%s/statistics/timeseries?metric=rule_hits&label=unknown-label", tt.Host, product.Name)).
+				End()
+			assert.Nil(err)
+			assert.Equal(404, res.StatusCode)
+			res.Content() // close http client
+		})
+	})
+
 	t.Run(`"PUT /v1/products/:product+:offline"`, func(t *testing.T) {
 		product, err := createProduct(tt)
 		assert.Nil(t, err)
@@ -0,0 +1,177 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/teambition/gear"
+	"github.com/teambition/urbs-setting/src/bll"
+	"github.com/teambition/urbs-setting/src/middleware"
+	"github.com/teambition/urbs-setting/src/schema"
+	"github.com/teambition/urbs-setting/src/tpl"
+)
+
+// routeRoles 需要高于默认角色的路由，默认读请求需要 viewer，写请求需要 editor。
+// 路由包含 :product 时检查请求者在该产品下的角色（包括全局角色），否则只检查全局角色
+var routeRoles = map[string]string{
+	"POST /v1/products":                                                        schema.RoleAdmin,
+	"PUT /v1/products/:product":                                                schema.RoleOwner,
+	"PUT /v1/products/:product+:offline":                                       schema.RoleOwner,
+	"DELETE /v1/products/:product":                                             schema.RoleOwner,
+	"GET /v1/products/:product/webhooks":                                       schema.RoleOwner,
+	"POST /v1/products/:product/webhooks":                                      schema.RoleOwner,
+	"PUT /v1/products/:product/webhooks/:hid":                                  schema.RoleOwner,
+	"DELETE /v1/products/:product/webhooks/:hid":                               schema.RoleOwner,
+	"GET /v1/products/:product/webhooks/:hid/deliveries":                       schema.RoleOwner,
+	"POST /v1/products/:product/webhooks/:hid/deliveries/:delivery+:redeliver": schema.RoleOwner,
+	"GET /v1/products/:product/roles":                                          schema.RoleOwner,
+	"PUT /v1/products/:product/roles":                                          schema.RoleOwner,
+	"DELETE /v1/products/:product/roles":                                       schema.RoleOwner,
+	"GET /v1/audit-logs":                                                       schema.RoleAdmin,
+	"GET /v1/roles":                                                            schema.RoleAdmin,
+	"PUT /v1/roles":                                                            schema.RoleAdmin,
+	"DELETE /v1/roles":                                                         schema.RoleAdmin,
+	"GET /v1/api-keys":                                                         schema.RoleAdmin,
+	"POST /v1/api-keys":                                                        schema.RoleAdmin,
+	"PUT /v1/api-keys/:hid":                                                    schema.RoleAdmin,
+	"POST /v1/api-keys/:hid+:revoke":                                           schema.RoleAdmin,
+}
+
+// readRoutes 对 :product 只读取数据的写方法路由，与读请求一样需要 viewer 角色或 read:all scope。
+// 复制、推广时另外检查请求者在目标产品上的权限
+var readRoutes = map[string]bool{
+	"POST /v1/products/:product+:plan":    true,
+	"POST /v1/products/:product+:clone":   true,
+	"POST /v1/products/:product+:promote": true,
+}
+
+// requiredRole 返回调用路由需要的最低角色
+func requiredRole(method, pattern string) string {
+	if role, ok := routeRoles[method+" "+pattern]; ok {
+		return role
+	}
+	if isReadRoute(method, pattern) {
+		return schema.RoleViewer
+	}
+	return schema.RoleEditor
+}
+
+// isReadRoute 判断路由是否只读取数据
+func isReadRoute(method, pattern string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return readRoutes[method+" "+pattern]
+}
+
+// Role ..
+type Role struct {
+	blls *bll.Blls
+}
+
+// Enforce 角色检查中间件，需要放在 Auth 中间件之后，从路由中解析 :product，
+// 请求者没有所需角色时返回 403 错误。未启用 RBAC 时不做检查。
+// 使用 API key 的请求只检查 key 的 scopes，不检查角色
+func (a *Role) Enforce(ctx *gear.Context) error {
+	return checkRoute(ctx, a.blls, ctx.Method+" "+gear.GetRouterPatternFromCtx(ctx), ctx.Param("product"))
+}
+
+// checkRoute 检查请求者能否在产品下调用路由，route 格式为 "POST /v1/products/:product+:apply"
+func checkRoute(ctx *gear.Context, blls *bll.Blls, route, product string) error {
+	i := strings.IndexByte(route, ' ')
+	method, pattern := route[:i], route[i+1:]
+	if scopes, ok := middleware.Scopes(ctx); ok {
+		return checkScopes(scopes, method, pattern, product)
+	}
+	return blls.Role.Check(ctx, middleware.Subject(ctx), product, requiredRole(method, pattern))
+}
+
+// List ..
+func (a *Role) List(ctx *gear.Context) error {
+	req := tpl.RolesURL{}
+	if err := ctx.ParseURL(&req); err != nil {
+		return err
+	}
+
+	res, err := a.blls.Role.List(ctx, "", req.Subject, req.Pagination)
+	if err != nil {
+		return err
+	}
+	return ctx.OkJSON(res)
+}
+
+// Grant ..
+func (a *Role) Grant(ctx *gear.Context) error {
+	body := tpl.RoleBody{}
+	if err := ctx.ParseBody(&body); err != nil {
+		return err
+	}
+
+	res, err := a.blls.Role.Grant(ctx, "", &body)
+	if err != nil {
+		return err
+	}
+	return ctx.OkJSON(res)
+}
+
+// Revoke ..
+func (a *Role) Revoke(ctx *gear.Context) error {
+	req := tpl.RoleSubjectURL{}
+	if err := ctx.ParseURL(&req); err != nil {
+		return err
+	}
+
+	res, err := a.blls.Role.Revoke(ctx, "", req.Subject)
+	if err != nil {
+		return err
+	}
+	return ctx.OkJSON(res)
+}
+
+// ListByProduct ..
+func (a *Role) ListByProduct(ctx *gear.Context) error {
+	req := tpl.ProductRolesURL{}
+	if err := ctx.ParseURL(&req); err != nil {
+		return err
+	}
+
+	res, err := a.blls.Role.List(ctx, req.Product, req.Subject, req.Pagination)
+	if err != nil {
+		return err
+	}
+	return ctx.OkJSON(res)
+}
+
+// GrantByProduct ..
+func (a *Role) GrantByProduct(ctx *gear.Context) error {
+	req := tpl.ProductURL{}
+	if err := ctx.ParseURL(&req); err != nil {
+		return err
+	}
+
+	body := tpl.RoleBody{}
+	if err := ctx.ParseBody(&body); err != nil {
+		return err
+	}
+
+	res, err := a.blls.Role.Grant(ctx, req.Product, &body)
+	if err != nil {
+		return err
+	}
+	return ctx.OkJSON(res)
+}
+
+// RevokeByProduct ..
+func (a *Role) RevokeByProduct(ctx *gear.Context) error {
+	req := tpl.ProductRoleSubjectURL{}
+	if err := ctx.ParseURL(&req); err != nil {
+		return err
+	}
+
+	res, err := a.blls.Role.Revoke(ctx, req.Product, req.Subject)
+	if err != nil {
+		return err
+	}
+	return ctx.OkJSON(res)
+}
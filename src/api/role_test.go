@@ -0,0 +1,183 @@
+package api
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/DavidCai1993/request"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	auth "github.com/teambition/gear-auth"
+	"github.com/teambition/urbs-setting/src/conf"
+	"github.com/teambition/urbs-setting/src/middleware"
+	"github.com/teambition/urbs-setting/src/schema"
+	"github.com/teambition/urbs-setting/src/tpl"
+)
+
+func TestRoleAPIs(t *testing.T) {
+	tt, cleanup := SetUpTestTools()
+	defer cleanup()
+
+	product, err := createProduct(tt)
+	require.Nil(t, err)
+
+	// 启用 JWT 身份验证和 RBAC，测试结束后恢复
+	rbac := conf.Config.RBAC
+	auther := middleware.Auther
+	defer func() {
+		conf.Config.RBAC = rbac
+		middleware.Auther = auther
+	}()
+	middleware.Auther = auth.New([]byte("urbs-rbac-test"))
+	conf.Config.RBAC.Enabled = true
+	conf.Config.RBAC.Admins = []string{"rbac-admin"}
+
+	token := func(sub string) string {
+		s, err := middleware.Auther.JWT().Sign(map[string]interface{}{"sub": sub})
+		require.Nil(t, err)
+		return "Bearer " + s
+	}
+	adminToken := token("rbac-admin")
+	viewerToken := token("rbac-viewer")
+	editorToken := token("rbac-editor")
+
+	t.Run("should deny subjects without roles", func(t *testing.T) {
+		assert := assert.New(t)
+
+		res, err := request.Get(fmt.Sprintf("%s/v1/products/%s/labels", tt.Host, product.Name)).
+			Set("Authorization", viewerToken).
+			End()
+		assert.Nil(err)
+		assert.Equal(403, res.StatusCode)
+		text, _ := res.Text()
+		assert.Contains(text, "requires role")
+		assert.Contains(text, schema.RoleViewer)
+	})
+
+	t.Run(`"PUT /v1/products/:product/roles" should work`, func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		res, err := request.Put(fmt.Sprintf("%s/v1/products/%s/roles", tt.Host, product.Name)).
+			Set("Authorization", adminToken).
+			Set("Content-Type", "application/json").
+			Send(tpl.RoleBody{Subject: "rbac-viewer", Role: schema.RoleViewer}).
+			End()
+		require.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		json := tpl.RoleBindingInfoRes{}
+		res.JSON(&json)
+		assert.Equal("rbac-viewer", json.Result.Subject)
+		assert.Equal(product.Name, json.Result.Product)
+		assert.Equal(schema.RoleViewer, json.Result.Role)
+
+		res, err = request.Get(fmt.Sprintf("%s/v1/products/%s/labels", tt.Host, product.Name)).
+			Set("Authorization", viewerToken).
+			End()
+		require.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		res.Content() // close http client
+
+		res, err = request.Post(fmt.Sprintf("%s/v1/products/%s/labels", tt.Host, product.Name)).
+			Set("Authorization", viewerToken).
+			Set("Content-Type", "application/json").
+			Send(tpl.LabelBody{Name: tpl.RandLabel()}).
+			End()
+		require.Nil(err)
+		assert.Equal(403, res.StatusCode)
+		res.Content() // close http client
+
+		// admin 只能全局授予
+		res, err = request.Put(fmt.Sprintf("%s/v1/products/%s/roles", tt.Host, product.Name)).
+			Set("Authorization", adminToken).
+			Set("Content-Type", "application/json").
+			Send(tpl.RoleBody{Subject: "rbac-viewer", Role: schema.RoleAdmin}).
+			End()
+		require.Nil(err)
+		assert.Equal(400, res.StatusCode)
+		res.Content() // close http client
+
+		// viewer 不能管理产品角色
+		res, err = request.Get(fmt.Sprintf("%s/v1/products/%s/roles", tt.Host, product.Name)).
+			Set("Authorization", viewerToken).
+			End()
+		require.Nil(err)
+		assert.Equal(403, res.StatusCode)
+		res.Content() // close http client
+	})
+
+	t.Run(`"PUT /v1/roles" should work`, func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		res, err := request.Put(fmt.Sprintf("%s/v1/roles", tt.Host)).
+			Set("Authorization", editorToken).
+			Set("Content-Type", "application/json").
+			Send(tpl.RoleBody{Subject: "rbac-editor", Role: schema.RoleAdmin}).
+			End()
+		require.Nil(err)
+		assert.Equal(403, res.StatusCode)
+		res.Content() // close http client
+
+		res, err = request.Put(fmt.Sprintf("%s/v1/roles", tt.Host)).
+			Set("Authorization", adminToken).
+			Set("Content-Type", "application/json").
+			Send(tpl.RoleBody{Subject: "rbac-editor", Role: schema.RoleEditor}).
+			End()
+		require.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		res.Content() // close http client
+
+		res, err = request.Post(fmt.Sprintf("%s/v1/products/%s/labels", tt.Host, product.Name)).
+			Set("Authorization", editorToken).
+			Set("Content-Type", "application/json").
+			Send(tpl.LabelBody{Name: tpl.RandLabel()}).
+			End()
+		require.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		res.Content() // close http client
+
+		res, err = request.Delete(fmt.Sprintf("%s/v1/products/%s", tt.Host, product.Name)).
+			Set("Authorization", editorToken).
+			End()
+		require.Nil(err)
+		assert.Equal(403, res.StatusCode)
+		text, _ := res.Text()
+		assert.Contains(text, "requires role")
+		assert.Contains(text, schema.RoleOwner)
+
+		res, err = request.Get(fmt.Sprintf("%s/v1/roles?subject=rbac-editor", tt.Host)).
+			Set("Authorization", adminToken).
+			End()
+		require.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		json := tpl.RoleBindingsInfoRes{}
+		res.JSON(&json)
+		require.Equal(1, len(json.Result))
+		assert.Equal("", json.Result[0].Product)
+		assert.Equal(schema.RoleEditor, json.Result[0].Role)
+	})
+
+	t.Run(`"DELETE /v1/roles" should work`, func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		res, err := request.Delete(fmt.Sprintf("%s/v1/roles?subject=rbac-editor", tt.Host)).
+			Set("Authorization", adminToken).
+			End()
+		require.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		json := tpl.BoolRes{}
+		res.JSON(&json)
+		assert.True(json.Result)
+
+		res, err = request.Post(fmt.Sprintf("%s/v1/products/%s/labels", tt.Host, product.Name)).
+			Set("Authorization", editorToken).
+			Set("Content-Type", "application/json").
+			Send(tpl.LabelBody{Name: tpl.RandLabel()}).
+			End()
+		require.Nil(err)
+		assert.Equal(403, res.StatusCode)
+		res.Content() // close http client
+	})
+}
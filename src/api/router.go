@@ -4,6 +4,7 @@ import (
 	"github.com/teambition/gear"
 
 	"github.com/teambition/urbs-setting/src/bll"
+	"github.com/teambition/urbs-setting/src/conf"
 	"github.com/teambition/urbs-setting/src/middleware"
 	"github.com/teambition/urbs-setting/src/util"
 )
@@ -15,24 +16,43 @@ func init() {
 
 // APIs ..
 type APIs struct {
-	Healthz *Healthz
-	User    *User
-	Group   *Group
-	Product *Product
-	Module  *Module
-	Setting *Setting
-	Label   *Label
+	Healthz       *Healthz
+	User          *User
+	Group         *Group
+	Product       *Product
+	Module        *Module
+	Setting       *Setting
+	Label         *Label
+	Job           *Job
+	AuditLog      *AuditLog
+	Webhook       *Webhook
+	Change        *Change
+	Role          *Role
+	APIKey        *APIKey
+	ChangeRequest *ChangeRequest
+	ProductConfig *ProductConfig
+	Metrics       *Metrics
 }
 
 func newAPIs(blls *bll.Blls) *APIs {
+	middleware.APIKeyVerifier = blls.APIKey.Verify
 	return &APIs{
-		Healthz: &Healthz{blls: blls},
-		User:    &User{blls: blls},
-		Group:   &Group{blls: blls},
-		Product: &Product{blls: blls},
-		Module:  &Module{blls: blls},
-		Setting: &Setting{blls: blls},
-		Label:   &Label{blls: blls},
+		Healthz:       &Healthz{blls: blls},
+		User:          &User{blls: blls},
+		Group:         &Group{blls: blls},
+		Product:       &Product{blls: blls},
+		Module:        &Module{blls: blls},
+		Setting:       &Setting{blls: blls},
+		Label:         &Label{blls: blls},
+		Job:           &Job{blls: blls},
+		AuditLog:      &AuditLog{blls: blls},
+		Webhook:       &Webhook{blls: blls},
+		Change:        &Change{blls: blls},
+		Role:          &Role{blls: blls},
+		APIKey:        &APIKey{blls: blls},
+		ChangeRequest: &ChangeRequest{blls: blls},
+		ProductConfig: &ProductConfig{blls: blls},
+		Metrics:       &Metrics{},
 	}
 }
 
@@ -41,13 +61,21 @@ func newRouters(apis *APIs) []*gear.Router {
 	router := gear.NewRouter()
 	// health check
 	router.Get("/healthz", apis.Healthz.Get)
-	// 读取指定用户的环境标签，包括继承自群组的标签，返回轻量级 labels，无身份验证，用于网关
-	router.Get("/users/:uid/labels:cache", apis.User.ListCachedLabels)
+	router.Get("/livez", apis.Healthz.Livez)
+	router.Get("/readyz", apis.Healthz.Readyz)
+	// Prometheus 指标，按 metrics 配置验证 Bearer 令牌
+	router.Get("/metrics", middleware.NewMetricsGuard(conf.Config.Metrics), apis.Metrics.Get)
+	// 读取指定用户的环境标签，包括继承自群组的标签，返回轻量级 labels，用于网关，按 labels_cache 配置验证网关身份并限流
+	router.Get("/users/:uid/labels:cache", middleware.NewLabelsCacheGuard(conf.Config.LabelsCache), apis.User.ListCachedLabels)
 
 	routerV1 := gear.NewRouter(gear.RouterOptions{
 		Root: "/v1",
 	})
 	routerV1.Use(middleware.Auth)
+	routerV1.Use(apis.Role.Enforce)
+	routerV1.Use(middleware.ReadYourWrites)
+	routerV1.Use(apis.AuditLog.Record)
+	routerV1.Use(apis.ChangeRequest.Intercept)
 
 	// ***** user ******
 	// 读取用户列表，支持条件筛选
@@ -64,6 +92,10 @@ func newRouters(apis *APIs) []*gear.Router {
 	routerV1.Get("/users/:uid+:exists", apis.User.CheckExists)
 	// 批量添加用户
 	routerV1.Post("/users:batch", apis.User.BatchAdd)
+	// 流式导入用户（CSV 或 NDJSON），返回后台任务
+	routerV1.Post("/users:import", apis.User.Import)
+	// 预览不活跃用户清理报告（dry-run）
+	routerV1.Get("/users:purge", apis.User.PurgeReport)
 
 	// ***** group ******
 	// 读取指定群组的环境标签，支持条件筛选
@@ -76,6 +108,8 @@ func newRouters(apis *APIs) []*gear.Router {
 	routerV1.Get("/groups/:uid+:exists", apis.Group.CheckExists)
 	// 批量添加群组
 	routerV1.Post("/groups:batch", apis.Group.BatchAdd)
+	// 流式导入群组（CSV 或 NDJSON），返回后台任务
+	routerV1.Post("/groups:import", apis.Group.Import)
 	// 更新指定群组
 	routerV1.Put("/groups/:uid", apis.Group.Update)
 	// 删除指定群组
@@ -84,6 +118,8 @@ func newRouters(apis *APIs) []*gear.Router {
 	routerV1.Get("/groups/:uid/members", apis.Group.ListMembers)
 	// 指定群组批量添加成员
 	routerV1.Post("/groups/:uid/members:batch", apis.Group.BatchAddMembers)
+	// 指定群组流式导入成员（CSV 或 NDJSON），返回后台任务
+	routerV1.Post("/groups/:uid/members:import", apis.Group.ImportMembers)
 	// 指定群组根据条件清理成员
 	routerV1.Delete("/groups/:uid/members", apis.Group.RemoveMembers)
 
@@ -94,6 +130,8 @@ func newRouters(apis *APIs) []*gear.Router {
 	routerV1.Post("/products", apis.Product.Create)
 	// 读取指定产品的统计数据
 	routerV1.Get("/products/:product/statistics", apis.Product.Statistics)
+	// 读取指定产品、环境标签或配置项按天、周或月的时间序列统计
+	routerV1.Get("/products/:product/statistics/timeseries", apis.Product.Timeseries)
 	// 更新指定产品
 	routerV1.Put("/products/:product", apis.Product.Update)
 	// 下线指定产品功能模块
@@ -102,6 +140,16 @@ func newRouters(apis *APIs) []*gear.Router {
 	// routerV1.Put("/products/:product+:online", apis.Product.Online)
 	// 删除指定产品
 	routerV1.Delete("/products/:product", apis.Product.Delete)
+	// 导出指定产品的声明式配置，包括功能模块、配置项、环境标签和灰度发布规则
+	routerV1.Get("/products/:product+:export", apis.ProductConfig.Export)
+	// 对比声明式配置与线上配置，返回需要执行的操作
+	routerV1.Post("/products/:product+:plan", apis.ProductConfig.Plan)
+	// 按声明式配置同步线上配置
+	routerV1.Post("/products/:product+:apply", apis.ProductConfig.Apply)
+	// 把产品的全部配置复制到目标产品，目标产品不存在时创建
+	routerV1.Post("/products/:product+:clone", apis.ProductConfig.Clone)
+	// 把产品中选定的功能模块、配置项、环境标签推广到目标产品
+	routerV1.Post("/products/:product+:promote", apis.ProductConfig.Promote)
 	// 触发应用规则
 	routerV1.Post("/products/:product/users/rules:apply", apis.User.ApplyRules)
 	// ***** module ******
@@ -145,6 +193,12 @@ func newRouters(apis *APIs) []*gear.Router {
 	routerV1.Delete("/products/:product/modules/:module/settings/:setting/rules/:hid", apis.Setting.DeleteRule)
 	// 读取指定产品功能模块配置项的灰度发布规则列表
 	routerV1.Get("/products/:product/modules/:module/settings/:setting/rules", apis.Setting.ListRules)
+	// 读取指定产品功能模块配置项定义的版本列表
+	routerV1.Get("/products/:product/modules/:module/settings/:setting/versions", apis.Setting.ListVersions)
+	// 比较指定产品功能模块配置项定义的两个版本
+	routerV1.Get("/products/:product/modules/:module/settings/:setting/versions:diff", apis.Setting.DiffVersions)
+	// 把指定产品功能模块配置项的定义恢复到指定版本
+	routerV1.Post("/products/:product/modules/:module/settings/:setting/versions/:version+:restore", apis.Setting.RestoreVersion)
 	// 读取指定产品功能模块配置项的用户列表
 	routerV1.Get("/products/:product/modules/:module/settings/:setting/users", apis.Setting.ListUsers)
 	// 回滚指定用户的指定配置项
@@ -185,6 +239,12 @@ func newRouters(apis *APIs) []*gear.Router {
 	routerV1.Put("/products/:product/labels/:label/rules/:hid", apis.Label.UpdateRule)
 	// 删除指定产品环境标签的指定灰度发布规则
 	routerV1.Delete("/products/:product/labels/:label/rules/:hid", apis.Label.DeleteRule)
+	// 读取指定产品环境标签定义的版本列表
+	routerV1.Get("/products/:product/labels/:label/versions", apis.Label.ListVersions)
+	// 比较指定产品环境标签定义的两个版本
+	routerV1.Get("/products/:product/labels/:label/versions:diff", apis.Label.DiffVersions)
+	// 把指定产品环境标签的定义恢复到指定版本
+	routerV1.Post("/products/:product/labels/:label/versions/:version+:restore", apis.Label.RestoreVersion)
 	// 读取指定产品环境标签的用户列表
 	routerV1.Get("/products/:product/labels/:label/users", apis.Label.ListUsers)
 	// 移除指定用户的指定环境标签
@@ -194,6 +254,72 @@ func newRouters(apis *APIs) []*gear.Router {
 	// 移除指定群组的指定环境标签
 	routerV1.Delete("/products/:product/labels/:label/groups/:uid", apis.Label.DeleteGroup)
 
+	// ***** webhook ******
+	// 读取指定产品的 webhook 订阅列表
+	routerV1.Get("/products/:product/webhooks", apis.Webhook.List)
+	// 创建指定产品的 webhook 订阅，审计日志中不记录 secret
+	routerV1.Post("/products/:product/webhooks", apis.AuditLog.Redact("secret"), apis.Webhook.Create)
+	// 更新指定产品的指定 webhook 订阅，审计日志中不记录 secret
+	routerV1.Put("/products/:product/webhooks/:hid", apis.AuditLog.Redact("secret"), apis.Webhook.Update)
+	// 删除指定产品的指定 webhook 订阅
+	routerV1.Delete("/products/:product/webhooks/:hid", apis.Webhook.Delete)
+	// 读取指定 webhook 的投递记录
+	routerV1.Get("/products/:product/webhooks/:hid/deliveries", apis.Webhook.ListDeliveries)
+	// 重新投递指定的投递记录
+	routerV1.Post("/products/:product/webhooks/:hid/deliveries/:delivery+:redeliver", apis.Webhook.Redeliver)
+
+	// ***** job ******
+	// 读取后台任务列表，支持条件筛选
+	routerV1.Get("/jobs", apis.Job.List)
+	// 读取指定后台任务的进度和结果
+	routerV1.Get("/jobs/:hid", apis.Job.Get)
+	// 读取导入任务中无效的行
+	routerV1.Get("/jobs/:hid/errors", apis.Job.Errors)
+
+	// ***** audit log ******
+	// 读取写操作的审计日志，支持条件筛选
+	routerV1.Get("/audit-logs", apis.AuditLog.List)
+
+	// ***** change feed ******
+	// 按游标读取变更事件，没有新事件时支持长轮询
+	routerV1.Get("/changes", apis.Change.List)
+
+	// ***** role ******
+	// 读取全局角色列表
+	routerV1.Get("/roles", apis.Role.List)
+	// 授予请求者全局角色
+	routerV1.Put("/roles", apis.Role.Grant)
+	// 撤销请求者的全局角色
+	routerV1.Delete("/roles", apis.Role.Revoke)
+	// 读取指定产品的角色列表
+	routerV1.Get("/products/:product/roles", apis.Role.ListByProduct)
+	// 授予请求者指定产品的角色
+	routerV1.Put("/products/:product/roles", apis.Role.GrantByProduct)
+	// 撤销请求者指定产品的角色
+	routerV1.Delete("/products/:product/roles", apis.Role.RevokeByProduct)
+
+	// ***** api key ******
+	// 读取 API key 列表
+	routerV1.Get("/api-keys", apis.APIKey.List)
+	// 创建 API key，完整的 key 只在返回结果中出现一次
+	routerV1.Post("/api-keys", apis.AuditLog.Redact("key"), apis.APIKey.Create)
+	// 更新指定 API key 的名称或过期时间
+	routerV1.Put("/api-keys/:hid", apis.APIKey.Update)
+	// 撤销指定 API key
+	routerV1.Post("/api-keys/:hid+:revoke", apis.APIKey.Revoke)
+
+	// ***** change request ******
+	// 读取指定产品的变更申请列表，支持按状态筛选
+	routerV1.Get("/products/:product/change-requests", apis.ChangeRequest.List)
+	// 读取指定变更申请
+	routerV1.Get("/products/:product/change-requests/:hid", apis.ChangeRequest.Get)
+	// 对比指定变更申请的操作对象当前数据和申请的请求参数
+	routerV1.Get("/products/:product/change-requests/:hid+:diff", apis.ChangeRequest.Diff)
+	// 批准指定变更申请并执行申请的操作
+	routerV1.Post("/products/:product/change-requests/:hid+:approve", apis.ChangeRequest.Approve)
+	// 拒绝指定变更申请
+	routerV1.Post("/products/:product/change-requests/:hid+:reject", apis.ChangeRequest.Reject)
+
 	return []*gear.Router{router, routerV1, newRoutersV2(apis)}
 }
 
@@ -202,6 +328,10 @@ func newRoutersV2(apis *APIs) *gear.Router {
 		Root: "/v2",
 	})
 	routerV1.Use(middleware.Auth)
+	routerV1.Use(apis.Role.Enforce)
+	routerV1.Use(middleware.ReadYourWrites)
+	routerV1.Use(apis.AuditLog.Record)
+	routerV1.Use(apis.ChangeRequest.Intercept)
 	// ***** label ******
 	// 批量为用户或群组设置产品环境标签
 	routerV1.Post("/products/:product/labels/:label+:assign", apis.Label.AssignV2)
@@ -334,3 +334,42 @@ func (a *Setting) DeleteGroup(ctx *gear.Context) error {
 	}
 	return ctx.OkJSON(res)
 }
+
+// ListVersions ..
+func (a *Setting) ListVersions(ctx *gear.Context) error {
+	req := tpl.ProductModuleSettingURL{}
+	if err := ctx.ParseURL(&req); err != nil {
+		return err
+	}
+	res, err := a.blls.Setting.ListVersions(ctx, req.Product, req.Module, req.Setting, req.Pagination)
+	if err != nil {
+		return err
+	}
+	return ctx.OkJSON(res)
+}
+
+// DiffVersions ..
+func (a *Setting) DiffVersions(ctx *gear.Context) error {
+	req := tpl.ProductModuleSettingVersionDiffURL{}
+	if err := ctx.ParseURL(&req); err != nil {
+		return err
+	}
+	res, err := a.blls.Setting.DiffVersions(ctx, req.Product, req.Module, req.Setting, req.VersionDiffQuery)
+	if err != nil {
+		return err
+	}
+	return ctx.OkJSON(res)
+}
+
+// RestoreVersion ..
+func (a *Setting) RestoreVersion(ctx *gear.Context) error {
+	req := tpl.ProductModuleSettingVersionURL{}
+	if err := ctx.ParseURL(&req); err != nil {
+		return err
+	}
+	res, err := a.blls.Setting.RestoreVersion(ctx, req.Product, req.Module, req.Setting, req.Version)
+	if err != nil {
+		return err
+	}
+	return ctx.OkJSON(res)
+}
@@ -1,6 +1,8 @@
 package api
 
 import (
+	"net/http"
+
 	"github.com/teambition/gear"
 	"github.com/teambition/urbs-setting/src/bll"
 	"github.com/teambition/urbs-setting/src/tpl"
@@ -127,6 +129,21 @@ func (a *User) BatchAdd(ctx *gear.Context) error {
 	return ctx.OkJSON(tpl.BoolRes{Result: true})
 }
 
+// Import 流式导入用户，请求体为 CSV 或 NDJSON，返回执行导入的后台任务
+func (a *User) Import(ctx *gear.Context) error {
+	format, err := tpl.ImportFormatOf(ctx.GetHeader(gear.HeaderContentType))
+	if err != nil {
+		return err
+	}
+
+	job, err := a.blls.Import.Users(ctx, format, ctx.Req.Body)
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusAccepted, tpl.JobRes{Result: *job})
+}
+
 // ApplyRules ..
 func (a *User) ApplyRules(ctx *gear.Context) error {
 	req := &tpl.ProductURL{}
@@ -143,3 +160,17 @@ func (a *User) ApplyRules(ctx *gear.Context) error {
 	}
 	return ctx.OkJSON(tpl.BoolRes{Result: true})
 }
+
+// PurgeReport 返回不活跃用户清理的预览报告（dry-run）
+func (a *User) PurgeReport(ctx *gear.Context) error {
+	req := tpl.UsersPurgeURL{}
+	if err := ctx.ParseURL(&req); err != nil {
+		return err
+	}
+
+	res, err := a.blls.User.PurgeReport(ctx, req.Retention)
+	if err != nil {
+		return err
+	}
+	return ctx.OkJSON(res)
+}
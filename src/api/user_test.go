@@ -8,7 +8,12 @@ import (
 
 	"github.com/DavidCai1993/request"
 	"github.com/doug-martin/goqu/v9"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
+	"github.com/teambition/gear"
+	"github.com/teambition/urbs-setting/src/conf"
+	"github.com/teambition/urbs-setting/src/metrics"
+	"github.com/teambition/urbs-setting/src/middleware"
 	"github.com/teambition/urbs-setting/src/schema"
 	"github.com/teambition/urbs-setting/src/service"
 	"github.com/teambition/urbs-setting/src/tpl"
@@ -36,8 +41,25 @@ func createUsers(tt *TestTools, count int) (users []schema.User, err error) {
 	return
 }
 
+func checkUserExists(tt *TestTools, t *testing.T, uid string) {
+	assert := assert.New(t)
+
+	res, err := request.Get(fmt.Sprintf("%s/v1/users/%s:exists", tt.Host, uid)).
+		End()
+	assert.Nil(err)
+	assert.Equal(200, res.StatusCode)
+
+	json := tpl.BoolRes{}
+	res.JSON(&json)
+	assert.True(json.Result)
+}
+
 func cleanupUserLabels(db *goqu.Database, uid string) error {
-	_, err := db.Exec("update `urbs_user` set `labels` = '', `active_at` = 0 where `uid` = ?", uid)
+	_, err := db.Exec("update `urbs_user` set `active_at` = 0 where `uid` = ?", uid)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("delete from `user_label_cache` where `user_id` = (select `id` from `urbs_user` where `uid` = ?)", uid)
 	return err
 }
 
@@ -771,4 +793,247 @@ func TestUserApplyRulesAPIs(t *testing.T) {
 			assert.Equal(label.ID, ul.LabelID)
 		})
 	})
+
+	t.Run(`"GET /v1/users:purge"`, func(t *testing.T) {
+		t.Run(`should 400 if user purge is disabled and no retention`, func(t *testing.T) {
+			assert := assert.New(t)
+
+			res, err := request.Get(fmt.Sprintf("%s/v1/users:purge", tt.Host)).
+				End()
+			assert.Nil(err)
+			assert.Equal(400, res.StatusCode)
+			res.Content() // close http client
+		})
+
+		t.Run(`should 400 if invalid retention`, func(t *testing.T) {
+			assert := assert.New(t)
+
+			res, err := request.Get(fmt.Sprintf("%s/v1/users:purge?retention=1h", tt.Host)).
+				End()
+			assert.Nil(err)
+			assert.Equal(400, res.StatusCode)
+			res.Content() // close http client
+		})
+
+		t.Run(`should return dry-run report`, func(t *testing.T) {
+			assert := assert.New(t)
+
+			uid := tpl.RandUID()
+			_, err := tt.DB.Exec("insert into `urbs_user` (`uid`, `created_at`, `active_at`) values (?, ?, 0)",
+				uid, time.Now().UTC().Add(-100*24*time.Hour))
+			assert.Nil(err)
+
+			res, err := request.Get(fmt.Sprintf("%s/v1/users:purge?retention=720h", tt.Host)).
+				End()
+			assert.Nil(err)
+			assert.Equal(200, res.StatusCode)
+
+			json := tpl.UsersPurgeInfoRes{}
+			_, err = res.JSON(&json)
+			assert.Nil(err)
+			assert.False(json.Result.Enabled)
+			assert.Equal("720h0m0s", json.Result.Retention)
+			assert.True(json.Result.Users >= 1)
+			assert.True(len(json.Result.Samples) >= 1)
+
+			user := &schema.User{}
+			ok, err := tt.DB.ScanStruct(user, "select * from `urbs_user` where `uid` = ? limit 1", uid)
+			assert.Nil(err)
+			assert.True(ok)
+		})
+
+		t.Run(`users reading settings only should not be inactive`, func(t *testing.T) {
+			assert := assert.New(t)
+
+			product, err := createProduct(tt)
+			assert.Nil(err)
+			uid := tpl.RandUID()
+			_, err = tt.DB.Exec("insert into `urbs_user` (`uid`, `created_at`, `active_at`) values (?, ?, 0)",
+				uid, time.Now().UTC().Add(-100*24*time.Hour))
+			assert.Nil(err)
+
+			res, err := request.Get(fmt.Sprintf("%s/v1/users/%s/settings:unionAll?product=%s", tt.Host, uid, product.Name)).
+				End()
+			assert.Nil(err)
+			assert.Equal(200, res.StatusCode)
+			res.Content() // close http client
+
+			time.Sleep(time.Millisecond * 100)
+			user := &schema.User{}
+			ok, err := tt.DB.ScanStruct(user, "select * from `urbs_user` where `uid` = ? limit 1", uid)
+			assert.Nil(err)
+			assert.True(ok)
+			assert.True(user.ActiveAt > time.Now().Add(-time.Minute).Unix())
+		})
+	})
+}
+
+func TestLabelsCacheGuard(t *testing.T) {
+	app := gear.New()
+	router := gear.NewRouter()
+	router.Get("/users/:uid/labels:cache", middleware.NewLabelsCacheGuard(conf.LabelsCache{
+		SharedSecrets: []string{"old-secret", "new-secret"},
+		UIDRate:       1,
+		UIDBurst:      2,
+		MaxEntries:    100,
+	}), func(ctx *gear.Context) error {
+		return ctx.OkJSON(tpl.CacheLabelsInfoRes{})
+	})
+	app.UseHandler(router)
+	srv := app.Start()
+	defer srv.Close()
+	host := "http://" + srv.Addr().String()
+
+	t.Run("should reject requests without gateway secret", func(t *testing.T) {
+		assert := assert.New(t)
+
+		unauthorized := metrics.LabelsCacheRejected.WithLabelValues("unauthorized")
+		before := testutil.ToFloat64(unauthorized)
+		res, err := request.Get(fmt.Sprintf("%s/users/%s/labels:cache", host, tpl.RandUID())).
+			Set(middleware.HeaderGatewaySecret, "invalid").
+			End()
+		assert.Nil(err)
+		assert.Equal(401, res.StatusCode)
+		res.Content() // close http client
+		assert.Equal(before+1, testutil.ToFloat64(unauthorized))
+	})
+
+	t.Run("should limit requests by uid", func(t *testing.T) {
+		assert := assert.New(t)
+
+		uid := tpl.RandUID()
+		for i := 0; i < 2; i++ {
+			res, err := request.Get(fmt.Sprintf("%s/users/%s/labels:cache", host, uid)).
+				Set(middleware.HeaderGatewaySecret, "new-secret").
+				End()
+			assert.Nil(err)
+			assert.Equal(200, res.StatusCode)
+			res.Content() // close http client
+		}
+
+		uidLimited := metrics.LabelsCacheRejected.WithLabelValues("uid_limited")
+		before := testutil.ToFloat64(uidLimited)
+		res, err := request.Get(fmt.Sprintf("%s/users/%s/labels:cache", host, uid)).
+			Set(middleware.HeaderGatewaySecret, "old-secret").
+			End()
+		assert.Nil(err)
+		assert.Equal(429, res.StatusCode)
+		assert.Equal("1", res.Header.Get("Retry-After"))
+		res.Content() // close http client
+		assert.Equal(before+1, testutil.ToFloat64(uidLimited))
+
+		res, err = request.Get(fmt.Sprintf("%s/users/%s/labels:cache", host, tpl.RandUID())).
+			Set(middleware.HeaderGatewaySecret, "old-secret").
+			End()
+		assert.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		res.Content() // close http client
+	})
+}
+
+func TestReadYourWrites(t *testing.T) {
+	app := gear.New()
+	router := gear.NewRouter()
+	router.Use(middleware.ReadYourWrites)
+	router.Post("/write", func(ctx *gear.Context) error {
+		return ctx.OkJSON(tpl.BoolRes{Result: true})
+	})
+	router.Get("/read", func(ctx *gear.Context) error {
+		return ctx.OkJSON(tpl.BoolRes{Result: service.IsPrimary(ctx.Context())})
+	})
+	app.UseHandler(router)
+	srv := app.Start()
+	defer srv.Close()
+	host := "http://" + srv.Addr().String()
+
+	t.Run("should read primary with the returned header", func(t *testing.T) {
+		assert := assert.New(t)
+
+		res, err := request.Post(fmt.Sprintf("%s/write", host)).End()
+		assert.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		until := res.Header.Get(middleware.HeaderReadPrimaryUntil)
+		assert.NotEqual("", until)
+		res.Content() // close http client
+
+		json := tpl.BoolRes{}
+		res, err = request.Get(fmt.Sprintf("%s/read", host)).End()
+		assert.Nil(err)
+		res.JSON(&json)
+		assert.False(json.Result)
+
+		json = tpl.BoolRes{}
+		res, err = request.Get(fmt.Sprintf("%s/read", host)).
+			Set(middleware.HeaderReadPrimaryUntil, until).
+			End()
+		assert.Nil(err)
+		res.JSON(&json)
+		assert.True(json.Result)
+
+		json = tpl.BoolRes{}
+		res, err = request.Get(fmt.Sprintf("%s/read", host)).
+			Set(middleware.HeaderReadPrimaryUntil, fmt.Sprintf("%d", time.Now().Add(time.Hour).UnixNano()/int64(time.Millisecond))).
+			End()
+		assert.Nil(err)
+		res.JSON(&json)
+		assert.False(json.Result)
+	})
+
+	t.Run("should limit requests by connection address and ignore untrusted forwarded headers", func(t *testing.T) {
+		assert := assert.New(t)
+
+		for _, cfg := range []conf.LabelsCache{
+			{IPRate: 1, IPBurst: 1},
+			{IPRate: 1, IPBurst: 1, TrustedProxies: []string{"10.0.0.0/8"}},
+		} {
+			assert.Nil(cfg.Validate())
+			router := gear.NewRouter()
+			router.Get("/users/:uid/labels:cache", middleware.NewLabelsCacheGuard(cfg), func(ctx *gear.Context) error {
+				return ctx.OkJSON(tpl.CacheLabelsInfoRes{})
+			})
+			app := gear.New()
+			app.UseHandler(router)
+			srv := app.Start()
+
+			statuses := []int{}
+			for _, ip := range []string{"1.1.1.1", "2.2.2.2"} {
+				res, err := request.Get(fmt.Sprintf("http://%s/users/%s/labels:cache", srv.Addr().String(), tpl.RandUID())).
+					Set("X-Forwarded-For", ip).
+					Set("X-Real-IP", ip).
+					End()
+				assert.Nil(err)
+				statuses = append(statuses, res.StatusCode)
+				res.Content() // close http client
+			}
+			assert.Equal([]int{200, 429}, statuses)
+			srv.Close()
+		}
+	})
+
+	t.Run("should use forwarded headers from trusted proxies", func(t *testing.T) {
+		assert := assert.New(t)
+
+		cfg := conf.LabelsCache{IPRate: 1, IPBurst: 1, TrustedProxies: []string{"127.0.0.0/8", "10.0.0.0/8"}}
+		assert.Nil(cfg.Validate())
+		router := gear.NewRouter()
+		router.Get("/users/:uid/labels:cache", middleware.NewLabelsCacheGuard(cfg), func(ctx *gear.Context) error {
+			return ctx.OkJSON(tpl.CacheLabelsInfoRes{})
+		})
+		app := gear.New()
+		app.UseHandler(router)
+		srv := app.Start()
+		defer srv.Close()
+
+		statuses := []int{}
+		// 客户端自行添加的 X-Forwarded-For 在左侧，取最右侧不属于可信代理的地址
+		for _, xff := range []string{"9.9.9.9, 1.1.1.1, 10.0.0.1", "9.9.9.9, 2.2.2.2", "8.8.8.8, 2.2.2.2, 10.0.0.2"} {
+			res, err := request.Get(fmt.Sprintf("http://%s/users/%s/labels:cache", srv.Addr().String(), tpl.RandUID())).
+				Set("X-Forwarded-For", xff).
+				End()
+			assert.Nil(err)
+			statuses = append(statuses, res.StatusCode)
+			res.Content() // close http client
+		}
+		assert.Equal([]int{200, 200, 429}, statuses)
+	})
 }
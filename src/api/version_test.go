@@ -0,0 +1,123 @@
+package api
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/DavidCai1993/request"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/teambition/urbs-setting/src/tpl"
+)
+
+func TestVersionAPIs(t *testing.T) {
+	tt, cleanup := SetUpTestTools()
+	defer cleanup()
+
+	product, err := createProduct(tt)
+	assert.Nil(t, err)
+
+	label, err := createLabel(tt, product.Name)
+	assert.Nil(t, err)
+
+	desc := "new desc"
+	res, err := request.Put(fmt.Sprintf("%s/v1/products/%s/labels/%s", tt.Host, product.Name, label.Name)).
+		Set("Content-Type", "application/json").
+		Send(tpl.LabelUpdateBody{Desc: &desc}).
+		End()
+	assert.Nil(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	res.Content() // close http client
+
+	res, err = request.Post(fmt.Sprintf("%s/v1/products/%s/labels/%s/rules", tt.Host, product.Name, label.Name)).
+		Set("Content-Type", "application/json").
+		Send(map[string]interface{}{
+			"kind": "userPercent",
+			"rule": map[string]interface{}{
+				"value": 50,
+			},
+		}).
+		End()
+	assert.Nil(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	res.Content() // close http client
+
+	t.Run(`"GET /v1/products/:product/labels/:label/versions" should work`, func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		res, err := request.Get(fmt.Sprintf("%s/v1/products/%s/labels/%s/versions", tt.Host, product.Name, label.Name)).
+			End()
+		require.Nil(err)
+		assert.Equal(200, res.StatusCode)
+
+		json := tpl.VersionsInfoRes{}
+		res.JSON(&json)
+		require.Equal(3, len(json.Result))
+		assert.Equal(3, json.TotalSize)
+		assert.Equal(int64(3), json.Result[0].Version)
+		assert.Equal(1, len(json.Result[0].Snapshot.Rules))
+		assert.Equal("userPercent", json.Result[0].Snapshot.Rules[0].Kind)
+		assert.Equal(desc, json.Result[1].Snapshot.Desc)
+		assert.Equal(label.Desc, json.Result[2].Snapshot.Desc)
+		assert.Equal(0, len(json.Result[2].Snapshot.Rules))
+	})
+
+	t.Run(`"GET /v1/products/:product/labels/:label/versions:diff" should work`, func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		res, err := request.Get(fmt.Sprintf("%s/v1/products/%s/labels/%s/versions:diff?from=1", tt.Host, product.Name, label.Name)).
+			End()
+		require.Nil(err)
+		assert.Equal(200, res.StatusCode)
+
+		json := tpl.VersionDiffRes{}
+		res.JSON(&json)
+		assert.Equal(int64(1), json.Result.From)
+		assert.Equal(int64(3), json.Result.To)
+		require.Equal(2, len(json.Result.Changes))
+		assert.Equal("desc", json.Result.Changes[0].Field)
+		assert.Equal(label.Desc, json.Result.Changes[0].From)
+		assert.Equal(desc, json.Result.Changes[0].To)
+		assert.Equal("rules.userPercent", json.Result.Changes[1].Field)
+		assert.Nil(json.Result.Changes[1].From)
+
+		res, err = request.Get(fmt.Sprintf("%s/v1/products/%s/labels/%s/versions:diff?from=9", tt.Host, product.Name, label.Name)).
+			End()
+		require.Nil(err)
+		assert.Equal(404, res.StatusCode)
+		res.Content()
+	})
+
+	t.Run(`"POST /v1/products/:product/labels/:label/versions/:version:restore" should work`, func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		res, err := request.Post(fmt.Sprintf("%s/v1/products/%s/labels/%s/versions/1:restore", tt.Host, product.Name, label.Name)).
+			End()
+		require.Nil(err)
+		assert.Equal(200, res.StatusCode)
+
+		json := tpl.VersionInfoRes{}
+		res.JSON(&json)
+		assert.Equal(int64(4), json.Result.Version)
+		assert.Equal(int64(1), json.Result.Restored)
+		assert.Equal(label.Desc, json.Result.Snapshot.Desc)
+		assert.Equal(0, len(json.Result.Snapshot.Rules))
+
+		res, err = request.Get(fmt.Sprintf("%s/v1/products/%s/labels/%s/rules", tt.Host, product.Name, label.Name)).
+			End()
+		require.Nil(err)
+		json2 := tpl.LabelRulesInfoRes{}
+		res.JSON(&json2)
+		assert.Equal(0, len(json2.Result))
+
+		res, err = request.Get(fmt.Sprintf("%s/v1/products/%s/labels/%s/versions:diff?from=1&to=4", tt.Host, product.Name, label.Name)).
+			End()
+		require.Nil(err)
+		json3 := tpl.VersionDiffRes{}
+		res.JSON(&json3)
+		assert.Equal(0, len(json3.Result.Changes))
+	})
+}
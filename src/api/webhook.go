@@ -0,0 +1,126 @@
+package api
+
+import (
+	"github.com/teambition/gear"
+	"github.com/teambition/urbs-setting/src/bll"
+	"github.com/teambition/urbs-setting/src/service"
+	"github.com/teambition/urbs-setting/src/tpl"
+)
+
+// Webhook ..
+type Webhook struct {
+	blls *bll.Blls
+}
+
+// List ..
+func (a *Webhook) List(ctx *gear.Context) error {
+	req := tpl.ProductURL{}
+	if err := ctx.ParseURL(&req); err != nil {
+		return err
+	}
+	res, err := a.blls.Webhook.List(ctx, req.Product)
+	if err != nil {
+		return err
+	}
+	return ctx.OkJSON(res)
+}
+
+// Create ..
+func (a *Webhook) Create(ctx *gear.Context) error {
+	req := tpl.ProductURL{}
+	if err := ctx.ParseURL(&req); err != nil {
+		return err
+	}
+
+	body := tpl.WebhookBody{}
+	if err := ctx.ParseBody(&body); err != nil {
+		return err
+	}
+
+	res, err := a.blls.Webhook.Create(ctx, req.Product, &body)
+	if err != nil {
+		return err
+	}
+	return ctx.OkJSON(res)
+}
+
+// Update ..
+func (a *Webhook) Update(ctx *gear.Context) error {
+	req := tpl.ProductWebhookURL{}
+	if err := ctx.ParseURL(&req); err != nil {
+		return err
+	}
+
+	body := tpl.WebhookUpdateBody{}
+	if err := ctx.ParseBody(&body); err != nil {
+		return err
+	}
+
+	webhookID := service.HIDToID(req.HID, "webhook")
+	if webhookID <= 0 {
+		return gear.ErrBadRequest.WithMsgf("invalid webhook hid: %s", req.HID)
+	}
+	res, err := a.blls.Webhook.Update(ctx, req.Product, webhookID, body)
+	if err != nil {
+		return err
+	}
+	return ctx.OkJSON(res)
+}
+
+// Delete ..
+func (a *Webhook) Delete(ctx *gear.Context) error {
+	req := tpl.ProductWebhookURL{}
+	if err := ctx.ParseURL(&req); err != nil {
+		return err
+	}
+
+	webhookID := service.HIDToID(req.HID, "webhook")
+	if webhookID <= 0 {
+		return gear.ErrBadRequest.WithMsgf("invalid webhook hid: %s", req.HID)
+	}
+	res, err := a.blls.Webhook.Delete(ctx, req.Product, webhookID)
+	if err != nil {
+		return err
+	}
+	return ctx.OkJSON(res)
+}
+
+// ListDeliveries ..
+func (a *Webhook) ListDeliveries(ctx *gear.Context) error {
+	req := tpl.ProductWebhookURL{}
+	if err := ctx.ParseURL(&req); err != nil {
+		return err
+	}
+
+	webhookID := service.HIDToID(req.HID, "webhook")
+	if webhookID <= 0 {
+		return gear.ErrBadRequest.WithMsgf("invalid webhook hid: %s", req.HID)
+	}
+	res, err := a.blls.Webhook.ListDeliveries(ctx, req.Product, webhookID, req.Pagination)
+	if err != nil {
+		return err
+	}
+	return ctx.OkJSON(res)
+}
+
+// Redeliver ..
+func (a *Webhook) Redeliver(ctx *gear.Context) error {
+	req := tpl.ProductWebhookDeliveryURL{}
+	if err := ctx.ParseURL(&req); err != nil {
+		return err
+	}
+
+	webhookID := service.HIDToID(req.HID, "webhook")
+	if webhookID <= 0 {
+		return gear.ErrBadRequest.WithMsgf("invalid webhook hid: %s", req.HID)
+	}
+	deliveryID := service.HIDToID(req.Delivery, "webhook_delivery")
+	if deliveryID <= 0 {
+		return gear.ErrBadRequest.WithMsgf("invalid webhook delivery hid: %s", req.Delivery)
+	}
+	res, err := a.blls.Webhook.Redeliver(ctx, req.Product, webhookID, deliveryID)
+	if err != nil {
+		return err
+	}
+	return ctx.OkJSON(res)
+}
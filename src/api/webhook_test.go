@@ -0,0 +1,297 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DavidCai1993/request"
+	"github.com/doug-martin/goqu/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/teambition/urbs-setting/src/schema"
+	"github.com/teambition/urbs-setting/src/service"
+	"github.com/teambition/urbs-setting/src/tpl"
+)
+
+type webhookReceiver struct {
+	mu       sync.Mutex
+	status   int
+	received []*http.Request
+	bodies   [][]byte
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.received = append(r.received, req)
+	r.bodies = append(r.bodies, body)
+	w.WriteHeader(r.status)
+}
+
+func (r *webhookReceiver) setStatus(status int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status = status
+}
+
+// waitFor 等待收到 n 次投递，返回最后一次的请求和内容
+func (r *webhookReceiver) waitFor(n int) (*http.Request, []byte, error) {
+	for i := 0; i < 100; i++ {
+		r.mu.Lock()
+		if len(r.received) >= n {
+			req, body := r.received[n-1], r.bodies[n-1]
+			r.mu.Unlock()
+			return req, body, nil
+		}
+		r.mu.Unlock()
+		time.Sleep(100 * time.Millisecond)
+	}
+	return nil, nil, fmt.Errorf("webhook delivery %d not received", n)
+}
+
+func (r *webhookReceiver) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.received)
+}
+
+func listWebhookDeliveries(tt *TestTools, product, webhook string) ([]tpl.WebhookDeliveryInfo, error) {
+	res, err := request.Get(fmt.Sprintf("%s/v1/products/%s/webhooks/%s/deliveries", tt.Host, product, webhook)).
+		End()
+	if err != nil {
+		return nil, err
+	}
+	json := tpl.WebhookDeliveriesInfoRes{}
+	_, err = res.JSON(&json)
+	return json.Result, err
+}
+
+func TestWebhookAPIs(t *testing.T) {
+	tt, cleanup := SetUpTestTools()
+	defer cleanup()
+
+	receiver := &webhookReceiver{status: 200}
+	srv := httptest.NewServer(receiver)
+	defer srv.Close()
+
+	product, err := createProduct(tt)
+	assert.Nil(t, err)
+
+	secret := "webhook-secret"
+	var webhook tpl.WebhookInfo
+	t.Run(`"POST /v1/products/:product/webhooks" should work`, func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		res, err := request.Post(fmt.Sprintf("%s/v1/products/%s/webhooks", tt.Host, product.Name)).
+			Set("Content-Type", "application/json").
+			Send(tpl.WebhookBody{URL: srv.URL, Events: []string{schema.EventLabelOffline, schema.EventLabelRuleCreated}, Secret: secret}).
+			End()
+		require.Nil(err)
+		assert.Equal(200, res.StatusCode)
+
+		text, err := res.Text()
+		require.Nil(err)
+		assert.NotContains(text, secret)
+
+		json := tpl.WebhookInfoRes{}
+		res.JSON(&json)
+		webhook = json.Result
+		assert.NotEqual("", webhook.HID)
+		assert.Equal(srv.URL, webhook.URL)
+		assert.Equal([]string{schema.EventLabelOffline, schema.EventLabelRuleCreated}, webhook.Events)
+
+		res, err = request.Post(fmt.Sprintf("%s/v1/products/%s/webhooks", tt.Host, product.Name)).
+			Set("Content-Type", "application/json").
+			Send(tpl.WebhookBody{URL: srv.URL, Events: []string{"label.unknown"}, Secret: secret}).
+			End()
+		require.Nil(err)
+		assert.Equal(400, res.StatusCode)
+		res.Content()
+	})
+
+	t.Run(`subscribed event should be delivered with signature`, func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		label, err := createLabel(tt, product.Name)
+		require.Nil(err)
+
+		res, err := request.Put(fmt.Sprintf("%s/v1/products/%s/labels/%s:offline", tt.Host, product.Name, label.Name)).
+			End()
+		require.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		res.Content()
+
+		req, body, err := receiver.waitFor(1)
+		require.Nil(err)
+		assert.Equal(schema.EventLabelOffline, req.Header.Get(service.HeaderWebhookEvent))
+		assert.Equal(service.SignWebhookPayload(secret, body), req.Header.Get(service.HeaderWebhookSignature))
+
+		event := tpl.WebhookEvent{}
+		require.Nil(json.Unmarshal(body, &event))
+		assert.Equal(schema.EventLabelOffline, event.Event)
+		assert.Equal(product.Name, event.Product)
+		assert.Equal(label.Name, event.Data.(map[string]interface{})["label"])
+
+		deliveries, err := listWebhookDeliveries(tt, product.Name, webhook.HID)
+		require.Nil(err)
+		require.Equal(1, len(deliveries))
+		assert.Equal(req.Header.Get(service.HeaderWebhookDelivery), deliveries[0].HID)
+		assert.Equal(schema.WebhookDeliverySucceeded, deliveries[0].Status)
+		assert.Equal(1, deliveries[0].Attempts)
+		assert.Equal(200, deliveries[0].Code)
+		assert.NotNil(deliveries[0].DeliveredAt)
+	})
+
+	t.Run(`unsubscribed event should not be delivered`, func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		label, err := createLabel(tt, product.Name)
+		require.Nil(err)
+
+		res, err := request.Delete(fmt.Sprintf("%s/v1/products/%s/labels/%s:cleanup", tt.Host, product.Name, label.Name)).
+			End()
+		require.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		res.Content()
+
+		time.Sleep(500 * time.Millisecond)
+		assert.Equal(1, receiver.count())
+	})
+
+	t.Run(`failed delivery should be retried with backoff`, func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		label, err := createLabel(tt, product.Name)
+		require.Nil(err)
+
+		receiver.setStatus(500)
+		res, err := request.Post(fmt.Sprintf("%s/v1/products/%s/labels/%s/rules", tt.Host, product.Name, label.Name)).
+			Set("Content-Type", "application/json").
+			Send(map[string]interface{}{
+				"kind": "userPercent",
+				"rule": map[string]interface{}{
+					"value": 10,
+				},
+			}).
+			End()
+		require.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		res.Content()
+
+		_, _, err = receiver.waitFor(2)
+		require.Nil(err)
+		time.Sleep(100 * time.Millisecond)
+		deliveries, err := listWebhookDeliveries(tt, product.Name, webhook.HID)
+		require.Nil(err)
+		require.Equal(2, len(deliveries))
+		assert.Equal(schema.EventLabelRuleCreated, deliveries[0].Event)
+		assert.Equal(schema.WebhookDeliveryPending, deliveries[0].Status)
+		assert.Equal(1, deliveries[0].Attempts)
+		assert.Equal(500, deliveries[0].Code)
+
+		receiver.setStatus(200)
+		_, _, err = receiver.waitFor(3)
+		require.Nil(err)
+		time.Sleep(100 * time.Millisecond)
+		deliveries, err = listWebhookDeliveries(tt, product.Name, webhook.HID)
+		require.Nil(err)
+		assert.Equal(schema.WebhookDeliverySucceeded, deliveries[0].Status)
+		assert.Equal(2, deliveries[0].Attempts)
+		assert.Equal(200, deliveries[0].Code)
+	})
+
+	t.Run(`"POST /v1/products/:product/webhooks/:hid/deliveries/:delivery+:redeliver" should work`, func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		deliveries, err := listWebhookDeliveries(tt, product.Name, webhook.HID)
+		require.Nil(err)
+		require.True(len(deliveries) > 0)
+		delivery := deliveries[len(deliveries)-1]
+
+		res, err := request.Post(fmt.Sprintf("%s/v1/products/%s/webhooks/%s/deliveries/%s:redeliver", tt.Host, product.Name, webhook.HID, delivery.HID)).
+			End()
+		require.Nil(err)
+		assert.Equal(200, res.StatusCode)
+
+		json := tpl.WebhookDeliveryInfoRes{}
+		res.JSON(&json)
+		assert.Equal(delivery.HID, json.Result.HID)
+		assert.Equal(schema.WebhookDeliverySucceeded, json.Result.Status)
+		assert.Equal(1, json.Result.Attempts)
+
+		req, body, err := receiver.waitFor(4)
+		require.Nil(err)
+		assert.Equal(delivery.HID, req.Header.Get(service.HeaderWebhookDelivery))
+		assert.Equal(delivery.Payload, string(body))
+	})
+
+	t.Run(`secret should not be recorded in audit logs`, func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		secret2 := "webhook-secret-2"
+		res, err := request.Put(fmt.Sprintf("%s/v1/products/%s/webhooks/%s", tt.Host, product.Name, webhook.HID)).
+			Set("Content-Type", "application/json").
+			Send(tpl.WebhookUpdateBody{Secret: &secret2}).
+			End()
+		require.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		res.Content()
+
+		time.Sleep(100 * time.Millisecond)
+		logs := make([]schema.AuditLog, 0)
+		err = tt.DB.From(schema.TableAuditLog).
+			Where(goqu.C("product").Eq(product.Name), goqu.C("action").Like("%/webhooks%")).
+			ScanStructs(&logs)
+		require.Nil(err)
+		// 创建、更新和重新投递
+		assert.True(len(logs) >= 3)
+		for _, log := range logs {
+			for _, data := range []string{log.Body, log.Before, log.After} {
+				assert.NotContains(data, secret)
+				assert.NotContains(data, secret2)
+			}
+		}
+	})
+
+	t.Run(`"PUT and DELETE /v1/products/:product/webhooks/:hid" should work`, func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		events := []string{}
+		res, err := request.Put(fmt.Sprintf("%s/v1/products/%s/webhooks/%s", tt.Host, product.Name, webhook.HID)).
+			Set("Content-Type", "application/json").
+			Send(tpl.WebhookUpdateBody{Events: &events}).
+			End()
+		require.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		json := tpl.WebhookInfoRes{}
+		res.JSON(&json)
+		assert.Equal(0, len(json.Result.Events))
+
+		res, err = request.Delete(fmt.Sprintf("%s/v1/products/%s/webhooks/%s", tt.Host, product.Name, webhook.HID)).
+			End()
+		require.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		res.Content()
+
+		res, err = request.Get(fmt.Sprintf("%s/v1/products/%s/webhooks", tt.Host, product.Name)).
+			End()
+		require.Nil(err)
+		json2 := tpl.WebhooksInfoRes{}
+		res.JSON(&json2)
+		assert.Equal(0, len(json2.Result))
+	})
+}
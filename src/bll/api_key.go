@@ -0,0 +1,204 @@
+package bll
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/teambition/gear"
+	"github.com/teambition/urbs-setting/src/conf"
+	"github.com/teambition/urbs-setting/src/logging"
+	"github.com/teambition/urbs-setting/src/model"
+	"github.com/teambition/urbs-setting/src/schema"
+	"github.com/teambition/urbs-setting/src/service"
+	"github.com/teambition/urbs-setting/src/tpl"
+	"github.com/teambition/urbs-setting/src/util"
+)
+
+// apiKeyTouchInterval 同一个 API key 最近使用时间的最小更新间隔
+const apiKeyTouchInterval = time.Minute
+
+// APIKey ...
+type APIKey struct {
+	ms      *model.Models
+	cache   *util.TTLCache // id -> schema.APIKey
+	touched *util.TTLCache // id -> true，间隔内已更新过最近使用时间
+}
+
+func newAPIKey(ms *model.Models) *APIKey {
+	b := &APIKey{ms: ms, touched: util.NewTTLCache(apiKeyTouchInterval, 10000)}
+	if du := conf.Config.APIKey.CacheTTLDuration(); du > 0 {
+		b.cache = util.NewTTLCache(du, 10000)
+	}
+	return b
+}
+
+// APIKeySubject 返回 API key 作为请求者的身份
+func APIKeySubject(id int64) string {
+	return "apikey:" + service.IDToHID(id, "api_key")
+}
+
+// maxAPIKeyChain API key 可以由 API key 创建，追溯创建者的最大层数
+const maxAPIKeyChain = 8
+
+// Principals 返回请求者代表的全部身份：API key 请求者依次追溯到创建它的请求者，其它请求者只返回自身
+func (b *APIKey) Principals(ctx context.Context, subject string) ([]string, error) {
+	principals := []string{subject}
+	for i := 0; i < maxAPIKeyChain && strings.HasPrefix(subject, "apikey:"); i++ {
+		id := service.HIDToID(strings.TrimPrefix(subject, "apikey:"), "api_key")
+		if id <= 0 {
+			break
+		}
+		key, err := b.acquire(ctx, id)
+		if err != nil {
+			if gear.ParseError(err).Status() == 404 {
+				break
+			}
+			return nil, err
+		}
+		if key.CreatedBy == "" {
+			break
+		}
+		subject = key.CreatedBy
+		principals = append(principals, subject)
+	}
+	return principals, nil
+}
+
+func hashAPIKeySecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Create 创建 API key，完整的 key 只在返回结果中出现一次
+func (b *APIKey) Create(ctx context.Context, createdBy string, body *tpl.APIKeyBody) (*tpl.APIKeyInfoRes, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	secret := base64.RawURLEncoding.EncodeToString(buf)
+
+	key := &schema.APIKey{
+		Name:      body.Name,
+		Hash:      hashAPIKeySecret(secret),
+		Scopes:    strings.Join(body.Scopes, ","),
+		CreatedBy: createdBy,
+	}
+	if body.ExpiredAt != nil {
+		t := body.ExpiredAt.UTC()
+		key.ExpiredAt = &t
+	}
+	if err := b.ms.APIKey.Create(ctx, key); err != nil {
+		return nil, err
+	}
+
+	info := tpl.APIKeyInfoFrom(*key)
+	info.Key = tpl.APIKeyPrefix + info.HID + "_" + secret
+	return &tpl.APIKeyInfoRes{Result: info}, nil
+}
+
+// List 返回 API key 列表，不返回 key
+func (b *APIKey) List(ctx context.Context, pg tpl.Pagination) (*tpl.APIKeysInfoRes, error) {
+	keys, total, err := b.ms.APIKey.Find(ctx, pg)
+	if err != nil {
+		return nil, err
+	}
+	res := &tpl.APIKeysInfoRes{Result: tpl.APIKeysInfoFrom(keys)}
+	res.TotalSize = total
+	if len(res.Result) > pg.PageSize {
+		res.NextPageToken = tpl.IDToPageToken(res.Result[pg.PageSize].ID)
+		res.Result = res.Result[:pg.PageSize]
+	}
+	return res, nil
+}
+
+// Update 更新 API key 的名称或过期时间
+func (b *APIKey) Update(ctx context.Context, id int64, body tpl.APIKeyUpdateBody) (*tpl.APIKeyInfoRes, error) {
+	if _, err := b.ms.APIKey.Acquire(ctx, id); err != nil {
+		return nil, err
+	}
+	key, err := b.ms.APIKey.Update(ctx, id, body.ToMap())
+	if err != nil {
+		return nil, err
+	}
+	b.invalidate(id)
+	return &tpl.APIKeyInfoRes{Result: tpl.APIKeyInfoFrom(*key)}, nil
+}
+
+// Revoke 撤销 API key，撤销后不能恢复
+func (b *APIKey) Revoke(ctx context.Context, id int64) (*tpl.APIKeyInfoRes, error) {
+	if _, err := b.ms.APIKey.Acquire(ctx, id); err != nil {
+		return nil, err
+	}
+	key, err := b.ms.APIKey.Revoke(ctx, id, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	b.invalidate(id)
+	return &tpl.APIKeyInfoRes{Result: tpl.APIKeyInfoFrom(*key)}, nil
+}
+
+// Verify 验证 API key，返回请求者身份和 key 的 scopes，验证失败时返回 401 错误
+func (b *APIKey) Verify(ctx context.Context, token string) (string, []string, error) {
+	id, secret := tpl.ParseAPIKey(token)
+	if id <= 0 {
+		return "", nil, gear.ErrUnauthorized.WithMsg("invalid api key")
+	}
+
+	key, err := b.acquire(ctx, id)
+	if err != nil {
+		if gear.ParseError(err).Status() == 404 {
+			return "", nil, gear.ErrUnauthorized.WithMsg("invalid api key")
+		}
+		return "", nil, err
+	}
+	if !hmac.Equal([]byte(hashAPIKeySecret(secret)), []byte(key.Hash)) {
+		return "", nil, gear.ErrUnauthorized.WithMsg("invalid api key")
+	}
+	now := time.Now().UTC()
+	if !key.IsActive(now) {
+		return "", nil, gear.ErrUnauthorized.WithMsg("api key is revoked or expired")
+	}
+
+	cacheKey := strconv.FormatInt(id, 10)
+	if _, ok := b.touched.Get(cacheKey); !ok {
+		b.touched.Set(cacheKey, true)
+		util.Go(ctx, 5*time.Second, func(gctx context.Context) {
+			if err := b.ms.APIKey.TouchLastUsed(gctx, id, now); err != nil {
+				logging.Warningf("TouchLastUsed: api key %d, error %v", id, err)
+			}
+		})
+	}
+	return APIKeySubject(id), tpl.StringToSlice(key.Scopes), nil
+}
+
+func (b *APIKey) acquire(ctx context.Context, id int64) (*schema.APIKey, error) {
+	cacheKey := strconv.FormatInt(id, 10)
+	if b.cache != nil {
+		if val, ok := b.cache.Get(cacheKey); ok {
+			key := val.(schema.APIKey)
+			return &key, nil
+		}
+	}
+	// 读主库，保证新建的 key 立即可用
+	key, err := b.ms.APIKey.Acquire(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if b.cache != nil {
+		b.cache.Set(cacheKey, *key)
+	}
+	return key, nil
+}
+
+func (b *APIKey) invalidate(id int64) {
+	if b.cache != nil {
+		b.cache.Delete(strconv.FormatInt(id, 10))
+	}
+}
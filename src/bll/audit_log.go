@@ -0,0 +1,86 @@
+package bll
+
+import (
+	"context"
+	"time"
+
+	"github.com/teambition/urbs-setting/src/conf"
+	"github.com/teambition/urbs-setting/src/logging"
+	"github.com/teambition/urbs-setting/src/model"
+	"github.com/teambition/urbs-setting/src/schema"
+	"github.com/teambition/urbs-setting/src/tpl"
+	"github.com/teambition/urbs-setting/src/util"
+)
+
+// AuditLog ...
+type AuditLog struct {
+	ms *model.Models
+}
+
+// List 返回审计日志列表
+func (b *AuditLog) List(ctx context.Context, filter tpl.AuditLogsURL) (*tpl.AuditLogsRes, error) {
+	logs, total, err := b.ms.AuditLog.Find(context.WithValue(ctx, model.ReadDB, true), filter)
+	if err != nil {
+		return nil, err
+	}
+	res := &tpl.AuditLogsRes{Result: logs}
+	res.TotalSize = total
+	if len(res.Result) > filter.PageSize {
+		res.NextPageToken = tpl.IDToPageToken(res.Result[filter.PageSize].ID)
+		res.Result = res.Result[:filter.PageSize]
+	}
+	return res, nil
+}
+
+// Create 写入审计日志，失败时只记录日志，不影响已完成的写操作
+func (b *AuditLog) Create(ctx context.Context, log *schema.AuditLog) {
+	if err := b.ms.AuditLog.Create(ctx, log); err != nil {
+		logging.Errf("AuditLog: actor %s, action %s, target %s, error %v", log.Actor, log.Action, log.Target, err)
+	}
+}
+
+// Purge 分批删除超过保留时长的审计日志
+func (b *AuditLog) Purge(ctx context.Context) (int64, error) {
+	retention := conf.Config.AuditLog.RetentionDuration()
+	if retention <= 0 {
+		return 0, nil
+	}
+
+	var total int64
+	before := time.Now().UTC().Add(-retention)
+	for {
+		n, err := b.ms.AuditLog.DeleteBefore(ctx, before, 1000)
+		total += n
+		if err != nil || n < 1000 {
+			return total, err
+		}
+	}
+}
+
+// StartPurgeJob 启动后台过期审计日志清理任务，ctx 结束时退出
+func (b *AuditLog) StartPurgeJob(ctx context.Context) {
+	cfg := conf.Config.AuditLog
+	if cfg.RetentionDuration() <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(cfg.IntervalDuration())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				util.Go(ctx, cfg.IntervalDuration(), func(gctx context.Context) {
+					total, err := b.Purge(gctx)
+					if err != nil {
+						logging.Warningf("AuditLog: purged %d logs, error %v", total, err)
+					} else if total > 0 {
+						logging.Infof("AuditLog: purged %d logs", total)
+					}
+				})
+			}
+		}
+	}()
+}
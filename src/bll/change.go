@@ -0,0 +1,144 @@
+package bll
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/teambition/urbs-setting/src/conf"
+	"github.com/teambition/urbs-setting/src/logging"
+	"github.com/teambition/urbs-setting/src/model"
+	"github.com/teambition/urbs-setting/src/schema"
+	"github.com/teambition/urbs-setting/src/tpl"
+	"github.com/teambition/urbs-setting/src/util"
+)
+
+// Change ...
+type Change struct {
+	ms *model.Models
+}
+
+// List 返回游标之后的变更事件，没有新事件时按 wait 长轮询等待
+func (b *Change) List(ctx context.Context, q tpl.ChangesURL) (*tpl.ChangesRes, error) {
+	cursor := tpl.ChangeCursorToSeq(q.Cursor)
+	deadline := time.Now().Add(time.Duration(q.Wait) * time.Second)
+	for {
+		changes, err := b.ms.Change.FindAfter(ctx, cursor, q.Product, q.PageSize)
+		if err != nil {
+			return nil, err
+		}
+		if len(changes) > 0 || !time.Now().Before(deadline) {
+			res := &tpl.ChangesRes{Result: tpl.ChangesInfoFrom(changes), NextCursor: q.Cursor}
+			if n := len(changes); n > 0 {
+				res.NextCursor = tpl.SeqToChangeCursor(changes[n-1].Seq)
+			}
+			return res, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(conf.Config.ChangeFeed.PollIntervalDuration()):
+		}
+	}
+}
+
+// Purge 分批删除超过保留时长的变更事件
+func (b *Change) Purge(ctx context.Context) (int64, error) {
+	retention := conf.Config.ChangeFeed.RetentionDuration()
+	if retention <= 0 {
+		return 0, nil
+	}
+
+	var total int64
+	before := time.Now().UTC().Add(-retention)
+	for {
+		n, err := b.ms.Change.DeleteBefore(ctx, before, 1000)
+		total += n
+		if err != nil || n < 1000 {
+			return total, err
+		}
+	}
+}
+
+// StartPurgeJob 启动后台过期变更事件清理任务，ctx 结束时退出
+func (b *Change) StartPurgeJob(ctx context.Context) {
+	cfg := conf.Config.ChangeFeed
+	if cfg.RetentionDuration() <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(cfg.IntervalDuration())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				util.Go(ctx, cfg.IntervalDuration(), func(gctx context.Context) {
+					total, err := b.Purge(gctx)
+					if err != nil {
+						logging.Warningf("Change: purged %d changes, error %v", total, err)
+					} else if total > 0 {
+						logging.Infof("Change: purged %d changes", total)
+					}
+				})
+			}
+		}
+	}()
+}
+
+// Sequence 为已提交的变更事件分配变更流序号，直到没有待分配的事件
+func (b *Change) Sequence(ctx context.Context) (int, error) {
+	total := 0
+	for {
+		n, err := b.ms.Change.Sequence(ctx, 1000)
+		total += n
+		if err != nil || n < 1000 {
+			return total, err
+		}
+	}
+}
+
+// StartSequenceJob 启动后台变更流序号分配任务，按 change_feed.poll_interval 执行，ctx 结束时退出
+func (b *Change) StartSequenceJob(ctx context.Context) {
+	interval := conf.Config.ChangeFeed.PollIntervalDuration()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				util.Go(ctx, 10*time.Second, func(gctx context.Context) {
+					if total, err := b.Sequence(gctx); err != nil {
+						logging.Warningf("Change: sequenced %d changes, error %v", total, err)
+					}
+				})
+			}
+		}
+	}()
+}
+
+// withChange 在同一事务中执行写操作 fn 并写入其返回的变更事件，fn 返回 nil 事件表示没有产生变更
+func withChange(ctx context.Context, ms *model.Models, fn func(context.Context) (*schema.Change, error)) error {
+	return ms.Model.Transaction(ctx, func(ctx context.Context) error {
+		change, err := fn(ctx)
+		if err != nil || change == nil {
+			return err
+		}
+		return ms.Change.Create(ctx, change)
+	})
+}
+
+// changeOf 构造变更事件，productName 为事件所属的产品名称，与产品无关则为空
+func changeOf(productName, event string, data map[string]interface{}) (*schema.Change, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return &schema.Change{Product: productName, Event: event, Data: string(b)}, nil
+}
@@ -0,0 +1,593 @@
+package bll
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+	"time"
+
+	"github.com/teambition/gear"
+	"github.com/teambition/urbs-setting/src/conf"
+	"github.com/teambition/urbs-setting/src/logging"
+	"github.com/teambition/urbs-setting/src/model"
+	"github.com/teambition/urbs-setting/src/schema"
+	"github.com/teambition/urbs-setting/src/service"
+	"github.com/teambition/urbs-setting/src/tpl"
+	"github.com/teambition/urbs-setting/src/util"
+)
+
+// ChangeRequest 受保护产品的变更审批，批准后通过已有的业务方法执行申请的操作
+type ChangeRequest struct {
+	ms       *model.Models
+	product  *Product
+	module   *Module
+	setting  *Setting
+	label    *Label
+	config   *ProductConfig
+	auditLog *AuditLog
+	apiKey   *APIKey
+}
+
+// IsProtected 判断产品是否受保护，包括已下线的产品
+func (b *ChangeRequest) IsProtected(ctx context.Context, productName string) (bool, error) {
+	product, err := b.findProduct(ctx, productName)
+	if err != nil {
+		return false, err
+	}
+	return product.Protected, nil
+}
+
+// findProduct 返回未删除的产品，已下线的产品仍可以申请和审批删除
+func (b *ChangeRequest) findProduct(ctx context.Context, productName string) (*schema.Product, error) {
+	product, err := b.ms.Product.FindByName(ctx, productName, "")
+	if err != nil {
+		return nil, err
+	}
+	if product == nil || product.DeletedAt != nil {
+		return nil, gear.ErrNotFound.WithMsgf("product %s not found", productName)
+	}
+	return product, nil
+}
+
+// Create 创建待审批的变更申请
+func (b *ChangeRequest) Create(ctx context.Context, createdBy, action, target string, payload tpl.ChangeRequestPayload) (*tpl.ChangeRequestInfoRes, error) {
+	product, err := b.findProduct(ctx, payload.Product)
+	if err != nil {
+		return nil, err
+	}
+	// 操作对象必须存在
+	if _, err := b.current(ctx, action, payload); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	if len(target) > 1022 {
+		target = target[:1022]
+	}
+
+	cr := &schema.ChangeRequest{
+		ProductID: product.ID,
+		Action:    action,
+		Target:    target,
+		Payload:   string(data),
+		CreatedBy: createdBy,
+		ExpiredAt: time.Now().UTC().Add(conf.Config.ChangeRequest.TTLDuration()),
+	}
+	if err := b.ms.ChangeRequest.Create(ctx, cr); err != nil {
+		return nil, err
+	}
+	return &tpl.ChangeRequestInfoRes{Result: tpl.ChangeRequestInfoFrom(*cr, payload.Product)}, nil
+}
+
+// List 返回产品下的变更申请
+func (b *ChangeRequest) List(ctx context.Context, productName, status string, pg tpl.Pagination) (*tpl.ChangeRequestsInfoRes, error) {
+	product, err := b.findProduct(ctx, productName)
+	if err != nil {
+		return nil, err
+	}
+	crs, total, err := b.ms.ChangeRequest.Find(ctx, product.ID, status, pg)
+	if err != nil {
+		return nil, err
+	}
+	res := &tpl.ChangeRequestsInfoRes{Result: tpl.ChangeRequestsInfoFrom(crs, productName)}
+	res.TotalSize = total
+	if len(res.Result) > pg.PageSize {
+		res.NextPageToken = tpl.IDToPageToken(res.Result[pg.PageSize].ID)
+		res.Result = res.Result[:pg.PageSize]
+	}
+	return res, nil
+}
+
+// Get 返回产品下指定的变更申请
+func (b *ChangeRequest) Get(ctx context.Context, productName string, id int64) (*tpl.ChangeRequestInfoRes, error) {
+	cr, err := b.acquire(ctx, productName, id)
+	if err != nil {
+		return nil, err
+	}
+	return &tpl.ChangeRequestInfoRes{Result: tpl.ChangeRequestInfoFrom(*cr, productName)}, nil
+}
+
+// Diff 对比变更申请的操作对象的当前数据和申请的请求参数
+func (b *ChangeRequest) Diff(ctx context.Context, productName string, id int64) (*tpl.ChangeRequestDiffRes, error) {
+	cr, err := b.acquire(ctx, productName, id)
+	if err != nil {
+		return nil, err
+	}
+	payload := tpl.ChangeRequestPayload{}
+	if err := json.Unmarshal([]byte(cr.Payload), &payload); err != nil {
+		return nil, err
+	}
+	before, err := b.current(ctx, cr.Action, payload)
+	if err != nil {
+		return nil, err
+	}
+	return &tpl.ChangeRequestDiffRes{Result: tpl.ChangeRequestDiff{
+		Action: cr.Action,
+		Target: cr.Target,
+		Before: before,
+		After:  payload.Body,
+	}}, nil
+}
+
+// Approve 批准变更申请并执行申请的操作，申请者不能批准自己的申请。
+// 执行失败时申请状态为 failed，错误信息记录在 result 中
+func (b *ChangeRequest) Approve(ctx context.Context, productName string, id int64, subject, reason string) (*tpl.ChangeRequestInfoRes, error) {
+	cr, err := b.acquireDecidable(ctx, productName, id, subject)
+	if err != nil {
+		return nil, err
+	}
+	payload := tpl.ChangeRequestPayload{}
+	if err := json.Unmarshal([]byte(cr.Payload), &payload); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	ok, err := b.ms.ChangeRequest.Decide(ctx, id, schema.ChangeRequestApplied, subject, reason, now)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, gear.ErrConflict.WithMsgf("change request %s was decided or expired", service.IDToHID(id, "change_request"))
+	}
+
+	status := schema.ChangeRequestApplied
+	var result string
+	if res, err := b.apply(ctx, cr.Action, payload); err != nil {
+		status = schema.ChangeRequestFailed
+		result = err.Error()
+	} else if data, err := json.Marshal(res); err == nil {
+		result = string(data)
+	}
+	if err := b.ms.ChangeRequest.Finish(ctx, id, status, result); err != nil {
+		return nil, err
+	}
+	// 批准删除产品后产品已不存在，不能再通过产品读取申请
+	if cr, err = b.ms.ChangeRequest.Acquire(ctx, id); err != nil {
+		return nil, err
+	}
+	return &tpl.ChangeRequestInfoRes{Result: tpl.ChangeRequestInfoFrom(*cr, productName)}, nil
+}
+
+// Reject 拒绝变更申请，申请者不能拒绝自己的申请
+func (b *ChangeRequest) Reject(ctx context.Context, productName string, id int64, subject, reason string) (*tpl.ChangeRequestInfoRes, error) {
+	if _, err := b.acquireDecidable(ctx, productName, id, subject); err != nil {
+		return nil, err
+	}
+	ok, err := b.ms.ChangeRequest.Decide(ctx, id, schema.ChangeRequestRejected, subject, reason, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, gear.ErrConflict.WithMsgf("change request %s was decided or expired", service.IDToHID(id, "change_request"))
+	}
+	return b.Get(ctx, productName, id)
+}
+
+// Action 返回变更申请的操作类型，用于审批前检查审批者的权限
+func (b *ChangeRequest) Action(ctx context.Context, productName string, id int64) (string, error) {
+	cr, err := b.acquire(ctx, productName, id)
+	if err != nil {
+		return "", err
+	}
+	return cr.Action, nil
+}
+
+// ExpirePending 把已过期的待审批申请标记为过期，并写入审计日志
+func (b *ChangeRequest) ExpirePending(ctx context.Context) (int, error) {
+	total := 0
+	for {
+		now := time.Now().UTC()
+		crs, err := b.ms.ChangeRequest.FindExpired(ctx, now, 100)
+		if err != nil {
+			return total, err
+		}
+		for _, cr := range crs {
+			ok, err := b.ms.ChangeRequest.Expire(ctx, cr.ID, now)
+			if err != nil {
+				return total, err
+			}
+			if !ok {
+				continue
+			}
+			total++
+			productName := ""
+			if product, err := b.ms.Product.AcquireByID(ctx, cr.ProductID); err == nil {
+				productName = product.Name
+			}
+			cr.Status = schema.ChangeRequestExpired
+			cr.DecidedAt = &now
+			after, _ := json.Marshal(tpl.ChangeRequestInfoFrom(cr, productName))
+			b.auditLog.Create(ctx, &schema.AuditLog{
+				Actor:   "system",
+				Action:  "EXPIRE change-request",
+				Product: productName,
+				Target:  cr.Target,
+				Status:  200,
+				Body:    cr.Payload,
+				After:   string(after),
+			})
+		}
+		if len(crs) < 100 {
+			return total, nil
+		}
+	}
+}
+
+// StartExpireJob 启动后台任务，定期把已过期的待审批申请标记为过期，ctx 结束时退出
+func (b *ChangeRequest) StartExpireJob(ctx context.Context) {
+	cfg := conf.Config.ChangeRequest
+	var running int32
+	go func() {
+		ticker := time.NewTicker(cfg.IntervalDuration())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				// 上一轮还未结束时跳过
+				if !atomic.CompareAndSwapInt32(&running, 0, 1) {
+					continue
+				}
+				util.Go(ctx, cfg.IntervalDuration(), func(gctx context.Context) {
+					defer atomic.StoreInt32(&running, 0)
+					total, err := b.ExpirePending(gctx)
+					if err != nil {
+						logging.Warningf("ChangeRequest: expired %d requests, error %v", total, err)
+					} else if total > 0 {
+						logging.Infof("ChangeRequest: expired %d requests", total)
+					}
+				})
+			}
+		}
+	}()
+}
+
+func (b *ChangeRequest) acquire(ctx context.Context, productName string, id int64) (*schema.ChangeRequest, error) {
+	product, err := b.findProduct(ctx, productName)
+	if err != nil {
+		return nil, err
+	}
+	cr, err := b.ms.ChangeRequest.Acquire(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if cr.ProductID != product.ID {
+		return nil, gear.ErrNotFound.WithMsgf("change request %s not found", service.IDToHID(id, "change_request"))
+	}
+	return cr, nil
+}
+
+func (b *ChangeRequest) acquireDecidable(ctx context.Context, productName string, id int64, subject string) (*schema.ChangeRequest, error) {
+	cr, err := b.acquire(ctx, productName, id)
+	if err != nil {
+		return nil, err
+	}
+	hid := service.IDToHID(id, "change_request")
+	if cr.Status != schema.ChangeRequestPending {
+		return nil, gear.ErrConflict.WithMsgf("change request %s is %s", hid, cr.Status)
+	}
+	if !cr.IsActionable(time.Now().UTC()) {
+		return nil, gear.ErrConflict.WithMsgf("change request %s is expired", hid)
+	}
+	// 未启用身份验证时请求者为空，无法区分申请者和审批者
+	if subject != "" {
+		// API key 代表其创建者，申请者不能通过自己创建的 API key 审批，反之亦然
+		deciders, err := b.apiKey.Principals(ctx, subject)
+		if err != nil {
+			return nil, err
+		}
+		creators, err := b.apiKey.Principals(ctx, cr.CreatedBy)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range deciders {
+			for _, c := range creators {
+				if d == c {
+					return nil, gear.ErrForbidden.WithMsgf("change request %s should be decided by another subject", hid)
+				}
+			}
+		}
+	}
+	return cr, nil
+}
+
+// bodyTemplate 与 gear.BodyTemplate 相同
+type bodyTemplate interface {
+	Validate() error
+}
+
+func decodePayloadBody(data json.RawMessage, body bodyTemplate) error {
+	if err := json.Unmarshal(data, body); err != nil {
+		return gear.ErrBadRequest.WithMsgf("invalid change request payload: %v", err)
+	}
+	return body.Validate()
+}
+
+// promote 执行或预演复制、推广的变更申请，payload 中的 Product 为目标产品
+func (b *ChangeRequest) promote(ctx context.Context, action string, p tpl.ChangeRequestPayload, dryRun bool) (*tpl.ProductPromoteRes, error) {
+	if action == schema.ActionProductClone {
+		body := &tpl.ProductCloneBody{}
+		if err := decodePayloadBody(p.Body, body); err != nil {
+			return nil, err
+		}
+		body.Target, body.DryRun = p.Product, dryRun
+		return b.config.Clone(ctx, p.Source, body)
+	}
+	body := &tpl.ProductPromoteBody{}
+	if err := decodePayloadBody(p.Body, body); err != nil {
+		return nil, err
+	}
+	body.Target, body.DryRun = p.Product, dryRun
+	return b.config.Promote(ctx, p.Source, body)
+}
+
+func payloadRuleID(payload tpl.ChangeRequestPayload, kind string) (int64, error) {
+	ruleID := service.HIDToID(payload.Rule, kind)
+	if ruleID <= 0 {
+		return 0, gear.ErrBadRequest.WithMsgf("invalid %s hid: %s", kind, payload.Rule)
+	}
+	return ruleID, nil
+}
+
+// apply 通过已有的业务方法执行变更申请的操作
+func (b *ChangeRequest) apply(ctx context.Context, action string, p tpl.ChangeRequestPayload) (interface{}, error) {
+	switch action {
+	case schema.ActionProductUpdate:
+		body := &tpl.ProductUpdateBody{}
+		if err := decodePayloadBody(p.Body, body); err != nil {
+			return nil, err
+		}
+		return b.product.Update(ctx, p.Product, *body)
+	case schema.ActionProductOffline:
+		return b.product.Offline(ctx, p.Product)
+	case schema.ActionProductDelete:
+		return b.product.Delete(ctx, p.Product)
+	case schema.ActionProductApply:
+		body := &tpl.ProductConfigApplyBody{}
+		if err := decodePayloadBody(p.Body, body); err != nil {
+			return nil, err
+		}
+		return b.config.Apply(ctx, p.Product, body.Config, body.Prune)
+	case schema.ActionProductClone, schema.ActionProductPromote:
+		return b.promote(ctx, action, p, false)
+	case schema.ActionModuleUpdate:
+		body := &tpl.ModuleUpdateBody{}
+		if err := decodePayloadBody(p.Body, body); err != nil {
+			return nil, err
+		}
+		return b.module.Update(ctx, p.Product, p.Module, *body)
+	case schema.ActionModuleOffline:
+		return b.module.Offline(ctx, p.Product, p.Module)
+
+	case schema.ActionLabelUpdate:
+		body := &tpl.LabelUpdateBody{}
+		if err := decodePayloadBody(p.Body, body); err != nil {
+			return nil, err
+		}
+		return b.label.Update(ctx, p.Product, p.Label, *body)
+	case schema.ActionLabelDelete:
+		return b.label.Delete(ctx, p.Product, p.Label)
+	case schema.ActionLabelUserDelete:
+		return b.label.DeleteUser(ctx, p.Product, p.Label, p.UID)
+	case schema.ActionLabelGroupDelete:
+		return b.label.DeleteGroup(ctx, p.Product, p.Label, p.Kind, p.UID)
+
+	case schema.ActionLabelAssign:
+		body := &tpl.UsersGroupsBodyV2{}
+		if err := decodePayloadBody(p.Body, body); err != nil {
+			return nil, err
+		}
+		return b.label.Assign(ctx, p.Product, p.Label, body.Users, body.Groups)
+	case schema.ActionLabelRecall:
+		body := &tpl.RecallBody{}
+		if err := decodePayloadBody(p.Body, body); err != nil {
+			return nil, err
+		}
+		return b.label.Recall(ctx, p.Product, p.Label, body.Release)
+	case schema.ActionLabelCleanup:
+		return b.label.Cleanup(ctx, p.Product, p.Label)
+	case schema.ActionLabelOffline:
+		return b.label.Offline(ctx, p.Product, p.Label)
+	case schema.ActionLabelRuleCreate:
+		body := &tpl.LabelRuleBody{}
+		if err := decodePayloadBody(p.Body, body); err != nil {
+			return nil, err
+		}
+		return b.label.CreateRule(ctx, p.Product, p.Label, *body)
+	case schema.ActionLabelRuleUpdate:
+		ruleID, err := payloadRuleID(p, "label_rule")
+		if err != nil {
+			return nil, err
+		}
+		body := &tpl.LabelRuleBody{}
+		if err := decodePayloadBody(p.Body, body); err != nil {
+			return nil, err
+		}
+		return b.label.UpdateRule(ctx, p.Product, p.Label, ruleID, *body)
+	case schema.ActionLabelRuleDelete:
+		ruleID, err := payloadRuleID(p, "label_rule")
+		if err != nil {
+			return nil, err
+		}
+		return b.label.DeleteRule(ctx, p.Product, p.Label, ruleID)
+	case schema.ActionLabelRestore:
+		return b.label.RestoreVersion(ctx, p.Product, p.Label, p.Version)
+
+	case schema.ActionSettingUpdate:
+		body := &tpl.SettingUpdateBody{}
+		if err := decodePayloadBody(p.Body, body); err != nil {
+			return nil, err
+		}
+		return b.setting.Update(ctx, p.Product, p.Module, p.Setting, *body)
+	case schema.ActionSettingUserDelete:
+		return b.setting.DeleteUser(ctx, p.Product, p.Module, p.Setting, p.UID)
+	case schema.ActionSettingUserRollback:
+		return b.setting.RollbackUserSetting(ctx, p.Product, p.Module, p.Setting, p.UID)
+	case schema.ActionSettingGroupDelete:
+		return b.setting.DeleteGroup(ctx, p.Product, p.Module, p.Setting, p.Kind, p.UID)
+	case schema.ActionSettingGroupRollback:
+		return b.setting.RollbackGroupSetting(ctx, p.Product, p.Module, p.Setting, p.Kind, p.UID)
+	case schema.ActionSettingAssign:
+		body := &tpl.UsersGroupsBodyV2{}
+		if err := decodePayloadBody(p.Body, body); err != nil {
+			return nil, err
+		}
+		return b.setting.Assign(ctx, p.Product, p.Module, p.Setting, body.Value, body.Users, body.Groups)
+	case schema.ActionSettingRecall:
+		body := &tpl.RecallBody{}
+		if err := decodePayloadBody(p.Body, body); err != nil {
+			return nil, err
+		}
+		return b.setting.Recall(ctx, p.Product, p.Module, p.Setting, body.Release)
+	case schema.ActionSettingCleanup:
+		return b.setting.Cleanup(ctx, p.Product, p.Module, p.Setting)
+	case schema.ActionSettingOffline:
+		return b.setting.Offline(ctx, p.Product, p.Module, p.Setting)
+	case schema.ActionSettingRuleCreate:
+		body := &tpl.SettingRuleBody{}
+		if err := decodePayloadBody(p.Body, body); err != nil {
+			return nil, err
+		}
+		return b.setting.CreateRule(ctx, p.Product, p.Module, p.Setting, *body)
+	case schema.ActionSettingRuleUpdate:
+		ruleID, err := payloadRuleID(p, "setting_rule")
+		if err != nil {
+			return nil, err
+		}
+		body := &tpl.SettingRuleBody{}
+		if err := decodePayloadBody(p.Body, body); err != nil {
+			return nil, err
+		}
+		return b.setting.UpdateRule(ctx, p.Product, p.Module, p.Setting, ruleID, *body)
+	case schema.ActionSettingRuleDelete:
+		ruleID, err := payloadRuleID(p, "setting_rule")
+		if err != nil {
+			return nil, err
+		}
+		return b.setting.DeleteRule(ctx, p.Product, p.Module, p.Setting, ruleID)
+	case schema.ActionSettingRestore:
+		return b.setting.RestoreVersion(ctx, p.Product, p.Module, p.Setting, p.Version)
+	}
+	return nil, gear.ErrBadRequest.WithMsgf("unsupported change request action: %s", action)
+}
+
+// current 返回变更申请的操作对象的当前数据，创建规则时返回 nil
+func (b *ChangeRequest) current(ctx context.Context, action string, p tpl.ChangeRequestPayload) (interface{}, error) {
+	switch action {
+	case schema.ActionProductUpdate, schema.ActionProductOffline:
+		return b.ms.Product.Acquire(ctx, p.Product)
+	case schema.ActionProductDelete:
+		product, err := b.findProduct(ctx, p.Product)
+		if err != nil {
+			return nil, err
+		}
+		if product.OfflineAt == nil {
+			return nil, gear.ErrConflict.WithMsgf("product %s is not offline", p.Product)
+		}
+		return product, nil
+	case schema.ActionProductApply:
+		res, err := b.config.Export(ctx, p.Product)
+		if err != nil {
+			return nil, err
+		}
+		return res.Result, nil
+	case schema.ActionProductClone, schema.ActionProductPromote:
+		// 复制、推广的当前状态为预演的结果，即审批通过后将要执行的操作和冲突
+		res, err := b.promote(ctx, action, p, true)
+		if err != nil {
+			return nil, err
+		}
+		return res.Result, nil
+	case schema.ActionLabelRuleCreate, schema.ActionSettingRuleCreate:
+		return nil, nil
+	}
+
+	productID, err := b.ms.Product.AcquireID(ctx, p.Product)
+	if err != nil {
+		return nil, err
+	}
+	switch action {
+	case schema.ActionModuleUpdate, schema.ActionModuleOffline:
+		return b.ms.Module.Acquire(ctx, productID, p.Module)
+
+	case schema.ActionLabelRuleUpdate, schema.ActionLabelRuleDelete:
+		ruleID, err := payloadRuleID(p, "label_rule")
+		if err != nil {
+			return nil, err
+		}
+		rule, err := b.ms.LabelRule.Acquire(ctx, ruleID)
+		if err != nil {
+			return nil, err
+		}
+		return tpl.LabelRuleInfoFrom(*rule), nil
+	case schema.ActionLabelRestore:
+		label, err := b.ms.Label.Acquire(ctx, productID, p.Label)
+		if err != nil {
+			return nil, err
+		}
+		// 恢复的版本必须存在
+		if _, err := b.ms.Version.Acquire(ctx, schema.VersionLabel, label.ID, p.Version); err != nil {
+			return nil, err
+		}
+		return tpl.LabelInfoFrom(*label, p.Product), nil
+	case schema.ActionLabelUpdate, schema.ActionLabelDelete, schema.ActionLabelAssign, schema.ActionLabelRecall,
+		schema.ActionLabelCleanup, schema.ActionLabelOffline, schema.ActionLabelUserDelete, schema.ActionLabelGroupDelete:
+		label, err := b.ms.Label.Acquire(ctx, productID, p.Label)
+		if err != nil {
+			return nil, err
+		}
+		return tpl.LabelInfoFrom(*label, p.Product), nil
+
+	case schema.ActionSettingRuleUpdate, schema.ActionSettingRuleDelete:
+		ruleID, err := payloadRuleID(p, "setting_rule")
+		if err != nil {
+			return nil, err
+		}
+		rule, err := b.ms.SettingRule.Acquire(ctx, ruleID)
+		if err != nil {
+			return nil, err
+		}
+		return tpl.SettingRuleInfoFrom(*rule), nil
+	case schema.ActionSettingRestore:
+		res, err := b.setting.Get(ctx, p.Product, p.Module, p.Setting)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := b.ms.Version.Acquire(ctx, schema.VersionSetting, res.Result.ID, p.Version); err != nil {
+			return nil, err
+		}
+		return res.Result, nil
+	case schema.ActionSettingUpdate, schema.ActionSettingAssign, schema.ActionSettingRecall, schema.ActionSettingCleanup,
+		schema.ActionSettingOffline, schema.ActionSettingUserDelete, schema.ActionSettingUserRollback,
+		schema.ActionSettingGroupDelete, schema.ActionSettingGroupRollback:
+		res, err := b.setting.Get(ctx, p.Product, p.Module, p.Setting)
+		if err != nil {
+			return nil, err
+		}
+		return res.Result, nil
+	}
+	return nil, gear.ErrBadRequest.WithMsgf("unsupported change request action: %s", action)
+}
@@ -2,6 +2,7 @@ package bll
 
 import (
 	"github.com/teambition/urbs-setting/src/model"
+	"github.com/teambition/urbs-setting/src/service"
 	"github.com/teambition/urbs-setting/src/util"
 )
 
@@ -11,24 +12,62 @@ func init() {
 
 // Blls ...
 type Blls struct {
-	User    *User
-	Group   *Group
-	Product *Product
-	Label   *Label
-	Module  *Module
-	Setting *Setting
-	Models  *model.Models
+	User          *User
+	Group         *Group
+	Product       *Product
+	Label         *Label
+	Module        *Module
+	Setting       *Setting
+	Job           *Job
+	AuditLog      *AuditLog
+	Webhook       *Webhook
+	Change        *Change
+	Role          *Role
+	APIKey        *APIKey
+	ChangeRequest *ChangeRequest
+	ProductConfig *ProductConfig
+	Import        *Import
+	Healthz       *Healthz
+	Statistic     *Statistic
+	Models        *model.Models
 }
 
 // NewBlls ...
-func NewBlls(models *model.Models) *Blls {
-	return &Blls{
-		User:    &User{ms: models},
-		Group:   &Group{ms: models},
-		Product: &Product{ms: models},
-		Label:   &Label{ms: models},
-		Module:  &Module{ms: models},
-		Setting: &Setting{ms: models},
-		Models:  models,
+func NewBlls(models *model.Models, exposure *service.Exposure) *Blls {
+	blls := &Blls{
+		User:      &User{ms: models, exposure: exposure},
+		Group:     &Group{ms: models},
+		Product:   &Product{ms: models},
+		Label:     &Label{ms: models},
+		Module:    &Module{ms: models},
+		Setting:   &Setting{ms: models},
+		Job:       &Job{ms: models},
+		AuditLog:  &AuditLog{ms: models},
+		Webhook:   &Webhook{ms: models},
+		Change:    &Change{ms: models},
+		Role:      newRole(models),
+		APIKey:    newAPIKey(models),
+		Import:    &Import{ms: models},
+		Healthz:   &Healthz{ms: models},
+		Statistic: &Statistic{ms: models},
+		Models:    models,
 	}
+	blls.ProductConfig = &ProductConfig{
+		ms:      models,
+		product: blls.Product,
+		module:  blls.Module,
+		setting: blls.Setting,
+		label:   blls.Label,
+	}
+	blls.ChangeRequest = &ChangeRequest{
+		ms:       models,
+		product:  blls.Product,
+		module:   blls.Module,
+		setting:  blls.Setting,
+		label:    blls.Label,
+		config:   blls.ProductConfig,
+		auditLog: blls.AuditLog,
+		apiKey:   blls.APIKey,
+	}
+	return blls
 }
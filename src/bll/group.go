@@ -2,8 +2,11 @@ package bll
 
 import (
 	"context"
+	"fmt"
 
+	"github.com/teambition/urbs-setting/src/logging"
 	"github.com/teambition/urbs-setting/src/model"
+	"github.com/teambition/urbs-setting/src/schema"
 	"github.com/teambition/urbs-setting/src/tpl"
 )
 
@@ -124,28 +127,48 @@ func (b *Group) CheckExists(ctx context.Context, kind, uid string) bool {
 
 // BatchAdd ...
 func (b *Group) BatchAdd(ctx context.Context, groups []tpl.GroupBody) error {
-	return b.ms.Group.BatchAdd(ctx, groups)
+	return withChange(ctx, b.ms, func(ctx context.Context) (*schema.Change, error) {
+		if err := b.ms.Group.BatchAdd(ctx, groups); err != nil {
+			return nil, err
+		}
+		return changeOf("", schema.EventGroupCreated, map[string]interface{}{"groups": groups})
+	})
 }
 
 // BatchAddMembers 批量给群组添加成员，如果用户未加入系统，则会自动加入
-func (b *Group) BatchAddMembers(ctx context.Context, kind, uid string, users []string) error {
+// 新成员继承群组的 labels，返回将其 labels 缓存标记为过期的后台任务
+func (b *Group) BatchAddMembers(ctx context.Context, kind, uid string, users []string) (*schema.Job, error) {
 	group, err := b.ms.Group.Acquire(ctx, kind, uid)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if err = b.ms.User.BatchAdd(ctx, users); err != nil {
-		return err
+	err = withChange(ctx, b.ms, func(ctx context.Context) (*schema.Change, error) {
+		if err := b.ms.User.BatchAdd(ctx, users); err != nil {
+			return nil, err
+		}
+		if err := b.ms.Group.BatchAddMembers(ctx, group, users); err != nil {
+			return nil, err
+		}
+		return changeOf("", schema.EventGroupMembersAdded, map[string]interface{}{"kind": kind, "group": uid, "users": users})
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return b.ms.Group.BatchAddMembers(ctx, group, users)
+	userIDs, err := b.ms.User.FindIDsByUIDs(ctx, users)
+	if err != nil {
+		logging.Warningf("BatchAddMembers: group %s/%s, find user ids error %v", kind, uid, err)
+		return nil, nil
+	}
+	return b.tryInvalidateMembers(ctx, fmt.Sprintf("group:%s/%s:add", kind, uid), userIDs), nil
 }
 
-// RemoveMembers ...
-func (b *Group) RemoveMembers(ctx context.Context, kind, uid, userUID string, syncLt int64) error {
+// RemoveMembers 删除群组成员，返回将其 labels 缓存标记为过期的后台任务
+func (b *Group) RemoveMembers(ctx context.Context, kind, uid, userUID string, syncLt int64) (*schema.Job, error) {
 	group, err := b.ms.Group.Acquire(ctx, kind, uid)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	var userID int64
@@ -155,7 +178,34 @@ func (b *Group) RemoveMembers(ctx context.Context, kind, uid, userUID string, sy
 		}
 	}
 
-	return b.ms.Group.RemoveMembers(ctx, group.ID, userID, syncLt)
+	var userIDs []int64
+	err = withChange(ctx, b.ms, func(ctx context.Context) (*schema.Change, error) {
+		if userIDs, err = b.ms.Group.RemoveMembers(ctx, group.ID, userID, syncLt); err != nil || len(userIDs) == 0 {
+			return nil, err
+		}
+		uids, err := b.ms.User.FindUIDsByIDs(ctx, userIDs)
+		if err != nil {
+			return nil, err
+		}
+		return changeOf("", schema.EventGroupMembersRemoved, map[string]interface{}{"kind": kind, "group": uid, "users": uids})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return b.tryInvalidateMembers(ctx, fmt.Sprintf("group:%s/%s:remove", kind, uid), userIDs), nil
+}
+
+// tryInvalidateMembers 成员变更已生效，创建后台任务失败时只记录日志，缓存仍会在有效期后刷新
+func (b *Group) tryInvalidateMembers(ctx context.Context, target string, userIDs []int64) *schema.Job {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	job, err := b.ms.InvalidateUsersLabelCache(ctx, target, userIDs, 0)
+	if err != nil {
+		logging.Warningf("InvalidateUsersLabelCache: target %s, error %v", target, err)
+		return nil
+	}
+	return job
 }
 
 // Update ...
@@ -164,7 +214,12 @@ func (b *Group) Update(ctx context.Context, kind, uid string, body tpl.GroupUpda
 	if err != nil {
 		return nil, err
 	}
-	group, err = b.ms.Group.Update(ctx, group.ID, body.ToMap())
+	err = withChange(ctx, b.ms, func(ctx context.Context) (*schema.Change, error) {
+		if group, err = b.ms.Group.Update(ctx, group.ID, body.ToMap()); err != nil {
+			return nil, err
+		}
+		return changeOf("", schema.EventGroupUpdated, map[string]interface{}{"kind": kind, "group": uid, "definition": group})
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -177,5 +232,10 @@ func (b *Group) Delete(ctx context.Context, kind, uid string) error {
 	if group == nil {
 		return nil
 	}
-	return b.ms.Group.Delete(ctx, group.ID)
+	return withChange(ctx, b.ms, func(ctx context.Context) (*schema.Change, error) {
+		if err := b.ms.Group.Delete(ctx, group.ID); err != nil {
+			return nil, err
+		}
+		return changeOf("", schema.EventGroupDeleted, map[string]interface{}{"kind": kind, "group": uid})
+	})
 }
@@ -0,0 +1,128 @@
+package bll
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/teambition/urbs-setting/src/conf"
+	"github.com/teambition/urbs-setting/src/model"
+	"github.com/teambition/urbs-setting/src/tpl"
+)
+
+// Healthz ...
+type Healthz struct {
+	ms *model.Models
+}
+
+// healthCheck 返回检查状态和说明，超过 healthz.timeout 的检查为 fail
+type healthCheck func(ctx context.Context) (status, message string)
+
+// DBConnect 检查主库是否可以连接
+func (b *Healthz) DBConnect(ctx context.Context) bool {
+	ctx, cancel := context.WithTimeout(ctx, conf.Config.Healthz.TimeoutDuration())
+	defer cancel()
+	return b.ms.Healthz.PingDB(ctx) == nil
+}
+
+// Ready 并发执行就绪检查：主库和从库连接、从库延迟、数据库结构升级和服务是否正在关闭
+func (b *Healthz) Ready(ctx context.Context) *tpl.ReadyzRes {
+	checks := []struct {
+		name  string
+		check healthCheck
+	}{
+		{"shutdown", b.checkShutdown},
+		{"db", b.checkDB},
+		{"rd_db", b.checkRdDB},
+		{"replica_lag", b.checkReplicaLag},
+		{"migrations", b.checkMigrations},
+	}
+
+	res := &tpl.ReadyzRes{Status: tpl.HealthOK, Checks: make([]*tpl.HealthCheck, len(checks))}
+	timeout := conf.Config.Healthz.TimeoutDuration()
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, name string, check healthCheck) {
+			defer wg.Done()
+			cctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			start := time.Now()
+			status, message := check(cctx)
+			if cctx.Err() == context.DeadlineExceeded {
+				status, message = tpl.HealthFail, fmt.Sprintf("timeout after %s", timeout)
+			}
+			res.Checks[i] = &tpl.HealthCheck{
+				Name:    name,
+				Status:  status,
+				Latency: float64(time.Since(start).Microseconds()) / 1000,
+				Message: message,
+			}
+		}(i, c.name, c.check)
+	}
+	wg.Wait()
+
+	for _, c := range res.Checks {
+		if c.Status == tpl.HealthFail {
+			res.Status = tpl.HealthFail
+			break
+		}
+	}
+	return res
+}
+
+// checkShutdown 收到退出信号后返回 fail，使负载均衡在服务关闭前摘除实例
+func (b *Healthz) checkShutdown(ctx context.Context) (string, string) {
+	if conf.Config.GlobalCtx.Err() != nil {
+		return tpl.HealthFail, "shutting down"
+	}
+	return tpl.HealthOK, ""
+}
+
+func (b *Healthz) checkDB(ctx context.Context) (string, string) {
+	if err := b.ms.Healthz.PingDB(ctx); err != nil {
+		return tpl.HealthFail, err.Error()
+	}
+	return tpl.HealthOK, ""
+}
+
+func (b *Healthz) checkRdDB(ctx context.Context) (string, string) {
+	if _, ok := b.ms.Healthz.ReplicaLag(); !ok {
+		return tpl.HealthOK, "no replica configured, reads use db"
+	}
+	if err := b.ms.Healthz.PingRdDB(ctx); err != nil {
+		return tpl.HealthFail, err.Error()
+	}
+	return tpl.HealthOK, ""
+}
+
+// checkReplicaLag 从库延迟过大时读请求会自动走主库，所以只返回 warn
+func (b *Healthz) checkReplicaLag(ctx context.Context) (string, string) {
+	lag, ok := b.ms.Healthz.ReplicaLag()
+	if !ok {
+		return tpl.HealthOK, "no replica configured"
+	}
+	if lag == math.MaxInt64 {
+		return tpl.HealthWarn, "replica heartbeat failed, reads routed to db"
+	}
+	max := conf.Config.ReadRouting.MaxReplicaLagDuration()
+	if lag > max {
+		return tpl.HealthWarn, fmt.Sprintf("lag %s exceeds %s, reads routed to db", lag, max)
+	}
+	return tpl.HealthOK, fmt.Sprintf("lag %s", lag)
+}
+
+func (b *Healthz) checkMigrations(ctx context.Context) (string, string) {
+	pending, err := b.ms.Healthz.PendingMigrations(ctx)
+	if err != nil {
+		return tpl.HealthFail, err.Error()
+	}
+	if len(pending) > 0 {
+		return tpl.HealthFail, "pending sql/update_*.sql: " + strings.Join(pending, ", ")
+	}
+	return tpl.HealthOK, ""
+}
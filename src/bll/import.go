@@ -0,0 +1,379 @@
+package bll
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/teambition/gear"
+	"github.com/teambition/urbs-setting/src/conf"
+	"github.com/teambition/urbs-setting/src/logging"
+	"github.com/teambition/urbs-setting/src/model"
+	"github.com/teambition/urbs-setting/src/schema"
+	"github.com/teambition/urbs-setting/src/tpl"
+	"github.com/teambition/urbs-setting/src/util"
+)
+
+// maxImportLineSize NDJSON 单行的最大长度，超过时该行记为无效
+const maxImportLineSize = 64 << 10
+
+// Import 流式导入用户、群组和群组成员。请求体先写入临时文件，
+// 再由后台任务逐行解析、分批写入，无效的行记录到任务的错误报告中
+type Import struct {
+	ms *model.Models
+}
+
+// importJob 描述一种导入：columns 为 CSV 必需的列，validate 验证每一行，write 写入一批有效的行并返回标记为过期的 labels 缓存数
+type importJob struct {
+	kind     string
+	target   string
+	format   string
+	columns  []string
+	validate func(*tpl.ImportRow) error
+	write    func(context.Context, []tpl.ImportRow) (int64, error)
+}
+
+// Users 导入用户，CSV 需要 uid 列，已存在的用户会被忽略
+func (b *Import) Users(ctx context.Context, format string, r io.Reader) (*schema.Job, error) {
+	return b.start(ctx, r, importJob{
+		kind:     schema.JobImportUsers,
+		target:   "users",
+		format:   format,
+		columns:  []string{"uid"},
+		validate: (*tpl.ImportRow).ValidateUser,
+		write: func(ctx context.Context, rows []tpl.ImportRow) (int64, error) {
+			return 0, b.ms.User.BatchAdd(ctx, uidsOfImportRows(rows))
+		},
+	})
+}
+
+// Groups 导入群组，CSV 需要 kind、uid 列，desc 列可选，已存在的群组会被忽略
+func (b *Import) Groups(ctx context.Context, format string, r io.Reader) (*schema.Job, error) {
+	return b.start(ctx, r, importJob{
+		kind:     schema.JobImportGroups,
+		target:   "groups",
+		format:   format,
+		columns:  []string{"kind", "uid"},
+		validate: (*tpl.ImportRow).ValidateGroup,
+		write: func(ctx context.Context, rows []tpl.ImportRow) (int64, error) {
+			groups := make([]tpl.GroupBody, len(rows))
+			for i, row := range rows {
+				groups[i] = tpl.GroupBody{UID: row.UID, Kind: row.Kind, Desc: row.Desc}
+			}
+			return 0, withChange(ctx, b.ms, func(ctx context.Context) (*schema.Change, error) {
+				if err := b.ms.Group.BatchAdd(ctx, groups); err != nil {
+					return nil, err
+				}
+				return changeOf("", schema.EventGroupCreated, map[string]interface{}{"groups": groups})
+			})
+		},
+	})
+}
+
+// Members 导入群组成员，CSV 需要 uid 列，如果用户未加入系统，则会自动加入。
+// 新成员继承群组的 labels，每批写入后将其 labels 缓存标记为过期
+func (b *Import) Members(ctx context.Context, kind, uid, format string, r io.Reader) (*schema.Job, error) {
+	group, err := b.ms.Group.Acquire(ctx, kind, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.start(ctx, r, importJob{
+		kind:     schema.JobImportMembers,
+		target:   fmt.Sprintf("group:%s/%s", kind, uid),
+		format:   format,
+		columns:  []string{"uid"},
+		validate: (*tpl.ImportRow).ValidateUser,
+		write: func(ctx context.Context, rows []tpl.ImportRow) (int64, error) {
+			users := uidsOfImportRows(rows)
+			err := withChange(ctx, b.ms, func(ctx context.Context) (*schema.Change, error) {
+				if err := b.ms.User.BatchAdd(ctx, users); err != nil {
+					return nil, err
+				}
+				if err := b.ms.Group.BatchAddMembers(ctx, group, users); err != nil {
+					return nil, err
+				}
+				return changeOf("", schema.EventGroupMembersAdded, map[string]interface{}{"kind": kind, "group": uid, "users": users})
+			})
+			if err != nil {
+				return 0, err
+			}
+			userIDs, err := b.ms.User.FindIDsByUIDs(ctx, users)
+			if err != nil {
+				return 0, err
+			}
+			return b.ms.User.InvalidateLabelCaches(ctx, userIDs, 0)
+		},
+	})
+}
+
+// start 暂存请求体并验证 CSV 标题行，然后创建后台任务执行导入
+func (b *Import) start(ctx context.Context, r io.Reader, job importJob) (*schema.Job, error) {
+	cfg := conf.Config.Import
+	file, err := spoolImport(r, cfg.TempDir, cfg.MaxSize)
+	if err != nil {
+		return nil, err
+	}
+
+	rd, err := newImportReader(job.format, file, job.columns)
+	if err == nil {
+		var j *schema.Job
+		if j, err = b.ms.Job.Create(ctx, job.kind, job.target); err == nil {
+			util.Go(ctx, cfg.TimeoutDuration(), func(gctx context.Context) {
+				defer removeImportFile(file)
+				b.run(gctx, j, job, rd)
+			})
+			return j, nil
+		}
+	}
+	removeImportFile(file)
+	return nil, err
+}
+
+// run 逐行读取导入文件，每 BatchSize 个有效的行写入一次并更新任务进度
+func (b *Import) run(ctx context.Context, j *schema.Job, job importJob, rd importReader) {
+	cfg := conf.Config.Import
+	var processed, invalidated, failed int64
+	rows := make([]tpl.ImportRow, 0, cfg.BatchSize)
+	errs := make([]schema.JobError, 0)
+	recorded := 0
+
+	addError := func(line int64, uid, msg string) {
+		failed++
+		// 超过 MaxErrors 的无效行只计数，不再记录详情
+		if recorded < cfg.MaxErrors {
+			recorded++
+			errs = append(errs, schema.JobError{JobID: j.ID, Line: line, UID: uid, Message: msg})
+		}
+	}
+	flush := func() error {
+		if len(rows) > 0 {
+			n, err := job.write(ctx, rows)
+			if err != nil {
+				return err
+			}
+			processed += int64(len(rows))
+			invalidated += n
+			rows = rows[:0]
+		}
+		if err := b.ms.Job.AddErrors(ctx, j.ID, errs); err != nil {
+			return err
+		}
+		errs = errs[:0]
+		if err := b.ms.Job.UpdateProgress(ctx, j.ID, processed, invalidated, failed); err != nil {
+			logging.Warningf("Import: job %d, update progress error %v", j.ID, err)
+		}
+		return nil
+	}
+
+	var err error
+	for {
+		line, row, e := rd.next()
+		if e == io.EOF {
+			err = flush()
+			break
+		}
+		if re, ok := e.(*importRowError); ok {
+			addError(line, "", re.msg)
+			continue
+		}
+		if e != nil {
+			err = e
+			break
+		}
+		if e := job.validate(row); e != nil {
+			addError(line, row.UID, importErrorMsg(e))
+			continue
+		}
+		rows = append(rows, *row)
+		if len(rows) >= cfg.BatchSize || len(errs) >= cfg.BatchSize {
+			if err = flush(); err != nil {
+				break
+			}
+		}
+	}
+
+	// 任务超时后 ctx 已结束，仍需记录任务结果
+	fctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err != nil {
+		if e := b.ms.Job.AddErrors(fctx, j.ID, errs); e != nil {
+			logging.Warningf("Import: job %d, add errors error %v", j.ID, e)
+		}
+	}
+	if e := b.ms.Job.Finish(fctx, j.ID, processed, invalidated, failed, err); e != nil {
+		logging.Warningf("Import: job %d, finish error %v", j.ID, e)
+	}
+	logging.Infof("Import: job %d, target %s, processed %d, invalidated %d, failed %d, error %v",
+		j.ID, job.target, processed, invalidated, failed, err)
+}
+
+func uidsOfImportRows(rows []tpl.ImportRow) []string {
+	uids := make([]string, len(rows))
+	for i, row := range rows {
+		uids[i] = row.UID
+	}
+	return uids
+}
+
+// importErrorMsg 返回不带错误类型前缀的错误信息
+func importErrorMsg(err error) string {
+	if e, ok := err.(*gear.Error); ok {
+		return e.Msg
+	}
+	return err.Error()
+}
+
+// spoolImport 把请求体写入临时文件，超过 maxSize 时返回 413 错误
+func spoolImport(r io.Reader, dir string, maxSize int64) (*os.File, error) {
+	file, err := ioutil.TempFile(dir, "urbs-import-*")
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := io.Copy(file, io.LimitReader(r, maxSize+1))
+	switch {
+	case err != nil:
+		err = gear.ErrBadRequest.WithMsgf("read import body error: %v", err)
+	case n > maxSize:
+		err = gear.ErrRequestEntityTooLarge.WithMsgf("import body too large: > %d bytes", maxSize)
+	case n == 0:
+		err = gear.ErrBadRequest.WithMsg("import body is empty")
+	default:
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		removeImportFile(file)
+		return nil, err
+	}
+	return file, nil
+}
+
+func removeImportFile(file *os.File) {
+	file.Close()
+	if err := os.Remove(file.Name()); err != nil {
+		logging.Warningf("Import: remove temp file %s error %v", file.Name(), err)
+	}
+}
+
+// importReader 逐行读取导入文件，返回行号和该行，文件结束时返回 io.EOF。
+// 该行无法解析时返回 *importRowError，可以继续读取下一行
+type importReader interface {
+	next() (int64, *tpl.ImportRow, error)
+}
+
+type importRowError struct {
+	msg string
+}
+
+func (e *importRowError) Error() string {
+	return e.msg
+}
+
+func newImportReader(format string, r io.Reader, columns []string) (importReader, error) {
+	if format == tpl.ImportCSV {
+		return newCSVImportReader(r, columns)
+	}
+	return &ndjsonImportReader{r: bufio.NewReaderSize(r, maxImportLineSize)}, nil
+}
+
+// csvImportReader 的行号为记录的序号，标题行为第 1 行
+type csvImportReader struct {
+	r       *csv.Reader
+	line    int64
+	columns map[string]int
+}
+
+func newCSVImportReader(r io.Reader, columns []string) (*csvImportReader, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	cr.ReuseRecord = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, gear.ErrBadRequest.WithMsgf("invalid CSV header: %v", err)
+	}
+	c := &csvImportReader{r: cr, line: 1, columns: make(map[string]int, len(header))}
+	for i, name := range header {
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff") // UTF-8 BOM
+		}
+		c.columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range columns {
+		if _, ok := c.columns[name]; !ok {
+			return nil, gear.ErrBadRequest.WithMsgf("CSV header should contain columns %v", columns)
+		}
+	}
+	return c, nil
+}
+
+func (c *csvImportReader) next() (int64, *tpl.ImportRow, error) {
+	record, err := c.r.Read()
+	if err == io.EOF {
+		return c.line, nil, err
+	}
+	c.line++
+	if e, ok := err.(*csv.ParseError); ok {
+		return c.line, nil, &importRowError{msg: e.Err.Error()}
+	}
+	if err != nil {
+		return c.line, nil, err
+	}
+	return c.line, &tpl.ImportRow{
+		UID:  c.field(record, "uid"),
+		Kind: c.field(record, "kind"),
+		Desc: c.field(record, "desc"),
+	}, nil
+}
+
+func (c *csvImportReader) field(record []string, name string) string {
+	if i, ok := c.columns[name]; ok && i < len(record) {
+		return strings.TrimSpace(record[i])
+	}
+	return ""
+}
+
+// ndjsonImportReader 的行号为文件的行号，忽略空行
+type ndjsonImportReader struct {
+	r    *bufio.Reader
+	line int64
+}
+
+func (n *ndjsonImportReader) next() (int64, *tpl.ImportRow, error) {
+	for {
+		data, err := n.r.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			n.line++
+			for err == bufio.ErrBufferFull {
+				_, err = n.r.ReadSlice('\n')
+			}
+			if err != nil && err != io.EOF {
+				return n.line, nil, err
+			}
+			return n.line, nil, &importRowError{msg: fmt.Sprintf("line too long: > %d bytes", maxImportLineSize)}
+		}
+		if err != nil && (err != io.EOF || len(data) == 0) {
+			return n.line, nil, err
+		}
+
+		n.line++
+		if data = bytes.TrimSpace(data); len(data) == 0 {
+			continue
+		}
+		row := &tpl.ImportRow{}
+		if e := json.Unmarshal(data, row); e != nil {
+			return n.line, nil, &importRowError{msg: "invalid JSON: " + e.Error()}
+		}
+		return n.line, row, nil
+	}
+}
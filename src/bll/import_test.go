@@ -0,0 +1,57 @@
+package bll
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/teambition/urbs-setting/src/tpl"
+)
+
+func TestImportReader(t *testing.T) {
+	readAll := func(rd importReader) (lines []int64, rows []*tpl.ImportRow, errs []string) {
+		for {
+			line, row, err := rd.next()
+			if err == io.EOF {
+				return
+			}
+			lines = append(lines, line)
+			rows = append(rows, row)
+			if err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+	}
+
+	t.Run("CSV reader should work", func(t *testing.T) {
+		assert := assert.New(t)
+
+		rd, err := newImportReader(tpl.ImportCSV, strings.NewReader("\ufeffUID, Kind ,desc\nu1,org,d1\n\nu2,org\n\"u3,org\nu4\n"), []string{"uid", "kind"})
+		assert.Nil(err)
+		lines, rows, errs := readAll(rd)
+		assert.Equal([]int64{2, 3, 4}, lines)
+		assert.Equal(tpl.ImportRow{UID: "u1", Kind: "org", Desc: "d1"}, *rows[0])
+		assert.Equal(tpl.ImportRow{UID: "u2", Kind: "org"}, *rows[1])
+		assert.Nil(rows[2])
+		assert.Equal(1, len(errs))
+
+		_, err = newImportReader(tpl.ImportCSV, strings.NewReader("uid,desc\nu1,d1\n"), []string{"uid", "kind"})
+		assert.NotNil(err)
+	})
+
+	t.Run("NDJSON reader should work", func(t *testing.T) {
+		assert := assert.New(t)
+
+		long := `{"uid":"` + strings.Repeat("a", maxImportLineSize) + `"}`
+		rd, err := newImportReader(tpl.ImportNDJSON, strings.NewReader("{\"uid\":\"u1\"}\n\n[1]\n"+long+"\n{\"uid\":\"u2\",\"kind\":\"org\"}"), nil)
+		assert.Nil(err)
+		lines, rows, errs := readAll(rd)
+		assert.Equal([]int64{1, 3, 4, 5}, lines)
+		assert.Equal("u1", rows[0].UID)
+		assert.Equal(tpl.ImportRow{UID: "u2", Kind: "org"}, *rows[3])
+		assert.Equal(2, len(errs))
+		assert.True(strings.HasPrefix(errs[0], "invalid JSON"))
+		assert.True(strings.HasPrefix(errs[1], "line too long"))
+	})
+}
@@ -0,0 +1,55 @@
+package bll
+
+import (
+	"context"
+
+	"github.com/teambition/urbs-setting/src/model"
+	"github.com/teambition/urbs-setting/src/tpl"
+)
+
+// Job ...
+type Job struct {
+	ms *model.Models
+}
+
+// List 返回后台任务列表
+func (b *Job) List(ctx context.Context, kind string, pg tpl.Pagination) (*tpl.JobsRes, error) {
+	jobs, total, err := b.ms.Job.Find(context.WithValue(ctx, model.ReadDB, true), kind, pg)
+	if err != nil {
+		return nil, err
+	}
+	res := &tpl.JobsRes{Result: jobs}
+	res.TotalSize = total
+	if len(res.Result) > pg.PageSize {
+		res.NextPageToken = tpl.IDToPageToken(res.Result[pg.PageSize].ID)
+		res.Result = res.Result[:pg.PageSize]
+	}
+	return res, nil
+}
+
+// Get 返回后台任务的进度和结果
+func (b *Job) Get(ctx context.Context, id int64) (*tpl.JobRes, error) {
+	job, err := b.ms.Job.Acquire(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &tpl.JobRes{Result: *job}, nil
+}
+
+// Errors 返回导入任务中无效的行
+func (b *Job) Errors(ctx context.Context, id int64, pg tpl.Pagination) (*tpl.JobErrorsRes, error) {
+	if _, err := b.ms.Job.Acquire(ctx, id); err != nil {
+		return nil, err
+	}
+	errs, total, err := b.ms.Job.FindErrors(context.WithValue(ctx, model.ReadDB, true), id, pg)
+	if err != nil {
+		return nil, err
+	}
+	res := &tpl.JobErrorsRes{Result: errs}
+	res.TotalSize = total
+	if len(res.Result) > pg.PageSize {
+		res.NextPageToken = tpl.IDToPageToken(res.Result[pg.PageSize].ID)
+		res.Result = res.Result[:pg.PageSize]
+	}
+	return res, nil
+}
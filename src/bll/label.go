@@ -2,9 +2,11 @@ package bll
 
 import (
 	"context"
+	"fmt"
 	"strings"
 
 	"github.com/teambition/gear"
+	"github.com/teambition/urbs-setting/src/logging"
 	"github.com/teambition/urbs-setting/src/model"
 	"github.com/teambition/urbs-setting/src/schema"
 	"github.com/teambition/urbs-setting/src/tpl"
@@ -51,9 +53,18 @@ func (b *Label) Create(ctx context.Context, productName string, body *tpl.LabelB
 	if body.Clients != nil {
 		label.Clients = strings.Join(*body.Clients, ",")
 	}
-	if err = b.ms.Label.Create(ctx, label); err != nil {
+	err = withChange(ctx, b.ms, func(ctx context.Context) (*schema.Change, error) {
+		if err := b.ms.Label.Create(ctx, label); err != nil {
+			return nil, err
+		}
+		return changeOf(productName, schema.EventLabelCreated, map[string]interface{}{
+			"label": label.Name, "definition": tpl.LabelInfoFrom(*label, productName),
+		})
+	})
+	if err != nil {
 		return nil, err
 	}
+	snapshotVersion(ctx, b.ms, schema.VersionLabel, label.ID)
 	return &tpl.LabelInfoRes{Result: tpl.LabelInfoFrom(*label, productName)}, nil
 }
 
@@ -65,10 +76,22 @@ func (b *Label) Update(ctx context.Context, productName, labelName string, body
 	}
 
 	label, err := b.ms.Label.Acquire(ctx, productID, labelName)
-	label, err = b.ms.Label.Update(ctx, label.ID, body.ToMap())
 	if err != nil {
 		return nil, err
 	}
+	snapshotVersion(ctx, b.ms, schema.VersionLabel, label.ID)
+	err = withChange(ctx, b.ms, func(ctx context.Context) (*schema.Change, error) {
+		if label, err = b.ms.Label.Update(ctx, label.ID, body.ToMap()); err != nil {
+			return nil, err
+		}
+		return changeOf(productName, schema.EventLabelUpdated, map[string]interface{}{
+			"label": labelName, "definition": tpl.LabelInfoFrom(*label, productName),
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	snapshotVersion(ctx, b.ms, schema.VersionLabel, label.ID)
 	return &tpl.LabelInfoRes{Result: tpl.LabelInfoFrom(*label, productName)}, nil
 }
 
@@ -88,10 +111,17 @@ func (b *Label) Offline(ctx context.Context, productName, labelName string) (*tp
 		return nil, gear.ErrNotFound.WithMsgf("label %s not found", labelName)
 	}
 	if label.OfflineAt == nil {
-		if err = b.ms.Label.Offline(ctx, label.ID); err != nil {
+		err = withChange(ctx, b.ms, func(ctx context.Context) (*schema.Change, error) {
+			if err := b.ms.Label.Offline(ctx, label.ID); err != nil {
+				return nil, err
+			}
+			return changeOf(productName, schema.EventLabelOffline, map[string]interface{}{"label": labelName})
+		})
+		if err != nil {
 			return nil, err
 		}
 		res.Result = true
+		emitEvent(ctx, b.ms, productID, productName, schema.EventLabelOffline, map[string]interface{}{"label": labelName})
 	}
 	return res, nil
 }
@@ -103,8 +133,43 @@ func (b *Label) Assign(ctx context.Context, productName, labelName string, users
 		return nil, err
 	}
 
-	label, err := b.ms.Label.Acquire(ctx, productID, labelName)
-	return b.ms.Label.Assign(ctx, label.ID, users, groups)
+	labelID, err := b.ms.Label.AcquireID(ctx, productID, labelName)
+	if err != nil {
+		return nil, err
+	}
+
+	var res *tpl.LabelReleaseInfo
+	err = withChange(ctx, b.ms, func(ctx context.Context) (*schema.Change, error) {
+		if res, err = b.ms.Label.Assign(ctx, labelID, users, groups); err != nil {
+			return nil, err
+		}
+		return changeOf(productName, schema.EventLabelAssigned, map[string]interface{}{
+			"label": labelName, "release": res.Release, "users": res.Users, "groups": res.Groups,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	b.ms.StatisticDaily.Incr(productID, schema.MetricAssignments, schema.StatisticKindLabel, labelID, int64(len(res.Users)+len(res.Groups)))
+	emitEvent(ctx, b.ms, productID, productName, schema.EventLabelAssigned, map[string]interface{}{
+		"label": labelName, "release": res.Release, "users": res.Users, "groups": res.Groups,
+	})
+
+	if len(res.Groups) > 0 {
+		// 群组成员继承新的 label，后台分批将其在该产品下的 labels 缓存标记为过期
+		target := fmt.Sprintf("label:%s/%s", productName, labelName)
+		groupIDs, err := b.ms.Label.FindGroupIDsByRelease(ctx, labelID, res.Release)
+		if err == nil && len(groupIDs) > 0 {
+			var job *schema.Job
+			if job, err = b.ms.InvalidateGroupsLabelCache(ctx, target, groupIDs, productID); err == nil {
+				res.Job = job.HID
+			}
+		}
+		if err != nil {
+			logging.Warningf("InvalidateGroupsLabelCache: target %s, error %v", target, err)
+		}
+	}
+	return res, nil
 }
 
 // Delete 物理删除标签
@@ -125,7 +190,13 @@ func (b *Label) Delete(ctx context.Context, productName, labelName string) (*tpl
 			return nil, gear.ErrConflict.WithMsgf("label %s is not offline", labelName)
 		}
 
-		if err = b.ms.Label.Delete(ctx, label.ID); err != nil {
+		err = withChange(ctx, b.ms, func(ctx context.Context) (*schema.Change, error) {
+			if err := b.ms.Label.Delete(ctx, label.ID); err != nil {
+				return nil, err
+			}
+			return changeOf(productName, schema.EventLabelDeleted, map[string]interface{}{"label": labelName})
+		})
+		if err != nil {
 			return nil, err
 		}
 		res.Result = true
@@ -140,16 +211,24 @@ func (b *Label) Recall(ctx context.Context, productName, labelName string, relea
 		return nil, err
 	}
 
-	label, err := b.ms.Label.Acquire(ctx, productID, labelName)
+	labelID, err := b.ms.Label.AcquireID(ctx, productID, labelName)
 	if err != nil {
 		return nil, err
 	}
 
 	res := &tpl.BoolRes{Result: false}
-	if err = b.ms.Label.Recall(ctx, label.ID, release); err != nil {
+	err = withChange(ctx, b.ms, func(ctx context.Context) (*schema.Change, error) {
+		if err := b.ms.Label.Recall(ctx, labelID, release); err != nil {
+			return nil, err
+		}
+		return changeOf(productName, schema.EventLabelRecalled, map[string]interface{}{"label": labelName, "release": release})
+	})
+	if err != nil {
 		return nil, err
 	}
 	res.Result = true
+	b.ms.StatisticDaily.Incr(productID, schema.MetricRecalls, schema.StatisticKindLabel, labelID, 1)
+	emitEvent(ctx, b.ms, productID, productName, schema.EventLabelRecalled, map[string]interface{}{"label": labelName, "release": release})
 	return res, nil
 }
 
@@ -160,16 +239,25 @@ func (b *Label) Cleanup(ctx context.Context, productName, labelName string) (*tp
 		return nil, err
 	}
 
-	label, err := b.ms.Label.Acquire(ctx, productID, labelName)
+	labelID, err := b.ms.Label.AcquireID(ctx, productID, labelName)
 	if err != nil {
 		return nil, err
 	}
 
 	res := &tpl.BoolRes{Result: false}
-	if err = b.ms.Label.Cleanup(ctx, label.ID); err != nil {
+	snapshotVersion(ctx, b.ms, schema.VersionLabel, labelID)
+	err = withChange(ctx, b.ms, func(ctx context.Context) (*schema.Change, error) {
+		if err := b.ms.Label.Cleanup(ctx, labelID); err != nil {
+			return nil, err
+		}
+		return changeOf(productName, schema.EventLabelCleanup, map[string]interface{}{"label": labelName})
+	})
+	if err != nil {
 		return nil, err
 	}
+	snapshotVersion(ctx, b.ms, schema.VersionLabel, labelID)
 	res.Result = true
+	emitEvent(ctx, b.ms, productID, productName, schema.EventLabelCleanup, map[string]interface{}{"label": labelName})
 	return res, nil
 }
 
@@ -192,21 +280,32 @@ func (b *Label) CreateRule(ctx context.Context, productName, labelName string, b
 		Rule:      body.ToRule(),
 		Release:   0,
 	}
-	if err = b.ms.LabelRule.Create(ctx, labelRule); err != nil {
-		return nil, err
-	}
-	// 创建成功再从 label 获取当前的 release 发布计数
-	release, err := b.ms.Label.AcquireRelease(ctx, label.ID)
-	if err != nil {
-		return nil, err
-	}
+	snapshotVersion(ctx, b.ms, schema.VersionLabel, label.ID)
+	err = withChange(ctx, b.ms, func(ctx context.Context) (*schema.Change, error) {
+		if err := b.ms.LabelRule.Create(ctx, labelRule); err != nil {
+			return nil, err
+		}
+		// 创建成功再从 label 获取当前的 release 发布计数
+		release, err := b.ms.Label.AcquireRelease(ctx, label.ID)
+		if err != nil {
+			return nil, err
+		}
 
-	changed := map[string]interface{}{"rls": release}
-	labelRule, err = b.ms.LabelRule.Update(ctx, labelRule.ID, changed)
+		changed := map[string]interface{}{"rls": release}
+		if labelRule, err = b.ms.LabelRule.Update(ctx, labelRule.ID, changed); err != nil {
+			return nil, err
+		}
+		return changeOf(productName, schema.EventLabelRuleCreated, map[string]interface{}{
+			"label": labelName, "rule": tpl.LabelRuleInfoFrom(*labelRule),
+		})
+	})
 	if err != nil {
 		return nil, err
 	}
-	return &tpl.LabelRuleInfoRes{Result: tpl.LabelRuleInfoFrom(*labelRule)}, nil
+	snapshotVersion(ctx, b.ms, schema.VersionLabel, label.ID)
+	ruleInfo := tpl.LabelRuleInfoFrom(*labelRule)
+	emitEvent(ctx, b.ms, productID, productName, schema.EventLabelRuleCreated, map[string]interface{}{"label": labelName, "rule": ruleInfo})
+	return &tpl.LabelRuleInfoRes{Result: ruleInfo}, nil
 }
 
 // ListRules ...
@@ -216,12 +315,12 @@ func (b *Label) ListRules(ctx context.Context, productName, labelName string) (*
 		return nil, err
 	}
 
-	label, err := b.ms.Label.Acquire(ctx, productID, labelName)
+	labelID, err := b.ms.Label.AcquireID(ctx, productID, labelName)
 	if err != nil {
 		return nil, err
 	}
 
-	labelRules, err := b.ms.LabelRule.Find(ctx, productID, label.ID)
+	labelRules, err := b.ms.LabelRule.Find(ctx, productID, labelID)
 	if err != nil {
 		return nil, err
 	}
@@ -259,15 +358,27 @@ func (b *Label) UpdateRule(ctx context.Context, productName, labelName string, r
 	}
 
 	if len(changed) > 0 {
-		release, err := b.ms.Label.AcquireRelease(ctx, label.ID)
-		if err != nil {
-			return nil, err
-		}
-		changed["rls"] = release
-		labelRule, err = b.ms.LabelRule.Update(ctx, labelRule.ID, changed)
+		snapshotVersion(ctx, b.ms, schema.VersionLabel, label.ID)
+		err = withChange(ctx, b.ms, func(ctx context.Context) (*schema.Change, error) {
+			release, err := b.ms.Label.AcquireRelease(ctx, label.ID)
+			if err != nil {
+				return nil, err
+			}
+			changed["rls"] = release
+			if labelRule, err = b.ms.LabelRule.Update(ctx, labelRule.ID, changed); err != nil {
+				return nil, err
+			}
+			return changeOf(productName, schema.EventLabelRuleUpdated, map[string]interface{}{
+				"label": labelName, "rule": tpl.LabelRuleInfoFrom(*labelRule),
+			})
+		})
 		if err != nil {
 			return nil, err
 		}
+		snapshotVersion(ctx, b.ms, schema.VersionLabel, label.ID)
+		emitEvent(ctx, b.ms, productID, productName, schema.EventLabelRuleUpdated, map[string]interface{}{
+			"label": labelName, "rule": tpl.LabelRuleInfoFrom(*labelRule),
+		})
 	}
 
 	return &tpl.LabelRuleInfoRes{Result: tpl.LabelRuleInfoFrom(*labelRule)}, nil
@@ -295,10 +406,25 @@ func (b *Label) DeleteRule(ctx context.Context, productName, labelName string, r
 		return nil, gear.ErrNotFound.WithMsgf("label rule not matched!")
 	}
 
-	rowsAffected, err := b.ms.LabelRule.Delete(ctx, labelRule.ID)
+	snapshotVersion(ctx, b.ms, schema.VersionLabel, label.ID)
+	var rowsAffected int64
+	err = withChange(ctx, b.ms, func(ctx context.Context) (*schema.Change, error) {
+		if rowsAffected, err = b.ms.LabelRule.Delete(ctx, labelRule.ID); err != nil || rowsAffected == 0 {
+			return nil, err
+		}
+		return changeOf(productName, schema.EventLabelRuleDeleted, map[string]interface{}{
+			"label": labelName, "rule": tpl.LabelRuleInfoFrom(*labelRule),
+		})
+	})
 	if err != nil {
 		return nil, err
 	}
+	if rowsAffected > 0 {
+		snapshotVersion(ctx, b.ms, schema.VersionLabel, label.ID)
+		emitEvent(ctx, b.ms, productID, productName, schema.EventLabelRuleDeleted, map[string]interface{}{
+			"label": labelName, "rule": tpl.LabelRuleInfoFrom(*labelRule),
+		})
+	}
 	res.Result = rowsAffected > 0
 	return res, nil
 }
@@ -310,12 +436,12 @@ func (b *Label) ListUsers(ctx context.Context, productName, labelName string, pg
 		return nil, err
 	}
 
-	label, err := b.ms.Label.Acquire(ctx, productID, labelName)
+	labelID, err := b.ms.Label.AcquireID(ctx, productID, labelName)
 	if err != nil {
 		return nil, err
 	}
 
-	data, total, err := b.ms.Label.ListUsers(ctx, label.ID, pg)
+	data, total, err := b.ms.Label.ListUsers(ctx, labelID, pg)
 	if err != nil {
 		return nil, err
 	}
@@ -335,7 +461,7 @@ func (b *Label) DeleteUser(ctx context.Context, productName, labelName, uid stri
 		return nil, err
 	}
 
-	label, err := b.ms.Label.Acquire(ctx, productID, labelName)
+	labelID, err := b.ms.Label.AcquireID(ctx, productID, labelName)
 	if err != nil {
 		return nil, err
 	}
@@ -345,7 +471,13 @@ func (b *Label) DeleteUser(ctx context.Context, productName, labelName, uid stri
 		return nil, err
 	}
 
-	rowsAffected, err := b.ms.Label.RemoveUserLabel(ctx, user.ID, label.ID)
+	var rowsAffected int64
+	err = withChange(ctx, b.ms, func(ctx context.Context) (*schema.Change, error) {
+		if rowsAffected, err = b.ms.Label.RemoveUserLabel(ctx, user.ID, labelID); err != nil || rowsAffected == 0 {
+			return nil, err
+		}
+		return changeOf(productName, schema.EventLabelUserRemoved, map[string]interface{}{"label": labelName, "user": uid})
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -359,12 +491,12 @@ func (b *Label) ListGroups(ctx context.Context, productName, labelName string, p
 		return nil, err
 	}
 
-	label, err := b.ms.Label.Acquire(ctx, productID, labelName)
+	labelID, err := b.ms.Label.AcquireID(ctx, productID, labelName)
 	if err != nil {
 		return nil, err
 	}
 
-	data, total, err := b.ms.Label.ListGroups(ctx, label.ID, pg)
+	data, total, err := b.ms.Label.ListGroups(ctx, labelID, pg)
 	if err != nil {
 		return nil, err
 	}
@@ -384,7 +516,7 @@ func (b *Label) DeleteGroup(ctx context.Context, productName, labelName, kind, u
 		return nil, err
 	}
 
-	label, err := b.ms.Label.Acquire(ctx, productID, labelName)
+	labelID, err := b.ms.Label.AcquireID(ctx, productID, labelName)
 	if err != nil {
 		return nil, err
 	}
@@ -394,9 +526,145 @@ func (b *Label) DeleteGroup(ctx context.Context, productName, labelName, kind, u
 		return nil, err
 	}
 
-	rowsAffected, err := b.ms.Label.RemoveGroupLabel(ctx, group.ID, label.ID)
+	var rowsAffected int64
+	err = withChange(ctx, b.ms, func(ctx context.Context) (*schema.Change, error) {
+		if rowsAffected, err = b.ms.Label.RemoveGroupLabel(ctx, group.ID, labelID); err != nil || rowsAffected == 0 {
+			return nil, err
+		}
+		return changeOf(productName, schema.EventLabelGroupRemoved, map[string]interface{}{
+			"label": labelName, "kind": kind, "group": uid,
+		})
+	})
 	if err != nil {
 		return nil, err
 	}
 	return &tpl.BoolRes{Result: rowsAffected > 0}, nil
 }
+
+// ListVersions 返回环境标签定义的版本列表
+func (b *Label) ListVersions(ctx context.Context, productName, labelName string, pg tpl.Pagination) (*tpl.VersionsInfoRes, error) {
+	productID, err := b.ms.Product.AcquireID(ctx, productName)
+	if err != nil {
+		return nil, err
+	}
+
+	labelID, err := b.ms.Label.AcquireID(ctx, productID, labelName)
+	if err != nil {
+		return nil, err
+	}
+	return listVersions(ctx, b.ms, schema.VersionLabel, labelID, pg)
+}
+
+// DiffVersions 比较环境标签定义的两个版本
+func (b *Label) DiffVersions(ctx context.Context, productName, labelName string, q tpl.VersionDiffQuery) (*tpl.VersionDiffRes, error) {
+	productID, err := b.ms.Product.AcquireID(ctx, productName)
+	if err != nil {
+		return nil, err
+	}
+
+	labelID, err := b.ms.Label.AcquireID(ctx, productID, labelName)
+	if err != nil {
+		return nil, err
+	}
+	return diffVersions(ctx, b.ms, schema.VersionLabel, labelID, q)
+}
+
+// RestoreVersion 把环境标签的描述、版本通道、客户端类型和灰度发布规则恢复到指定版本，并保存为新版本
+func (b *Label) RestoreVersion(ctx context.Context, productName, labelName string, version int64) (*tpl.VersionInfoRes, error) {
+	productID, err := b.ms.Product.AcquireID(ctx, productName)
+	if err != nil {
+		return nil, err
+	}
+
+	label, err := b.ms.Label.Acquire(ctx, productID, labelName)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := b.ms.Version.Acquire(ctx, schema.VersionLabel, label.ID, version)
+	if err != nil {
+		return nil, err
+	}
+	snapshotVersion(ctx, b.ms, schema.VersionLabel, label.ID)
+
+	err = withChange(ctx, b.ms, func(ctx context.Context) (*schema.Change, error) {
+		s := v.GetSnapshot()
+		changed := map[string]interface{}{
+			"description": s.Desc,
+			"channels":    strings.Join(s.Channels, ","),
+			"clients":     strings.Join(s.Clients, ","),
+		}
+		if label, err = b.ms.Label.Update(ctx, label.ID, changed); err != nil {
+			return nil, err
+		}
+
+		labelRules, err := b.ms.LabelRule.Find(ctx, productID, label.ID)
+		if err != nil {
+			return nil, err
+		}
+		rules := make(map[string]schema.RuleSnapshot, len(s.Rules))
+		for _, r := range s.Rules {
+			rules[r.Kind] = r
+		}
+		for _, labelRule := range labelRules {
+			r, ok := rules[labelRule.Kind]
+			delete(rules, labelRule.Kind)
+			switch {
+			case !ok:
+				if _, err = b.ms.LabelRule.Delete(ctx, labelRule.ID); err != nil {
+					return nil, err
+				}
+			case r.Rule != labelRule.Rule:
+				release, err := b.ms.Label.AcquireRelease(ctx, label.ID)
+				if err != nil {
+					return nil, err
+				}
+				changed := map[string]interface{}{"rule": r.Rule, "rls": release}
+				if _, err = b.ms.LabelRule.Update(ctx, labelRule.ID, changed); err != nil {
+					return nil, err
+				}
+			}
+		}
+		for _, r := range s.Rules {
+			if _, ok := rules[r.Kind]; !ok {
+				continue
+			}
+			labelRule := &schema.LabelRule{
+				ProductID: productID,
+				LabelID:   label.ID,
+				Kind:      r.Kind,
+				Rule:      r.Rule,
+				Release:   0,
+			}
+			if err = b.ms.LabelRule.Create(ctx, labelRule); err != nil {
+				return nil, err
+			}
+			// 创建成功再从 label 获取当前的 release 发布计数
+			release, err := b.ms.Label.AcquireRelease(ctx, label.ID)
+			if err != nil {
+				return nil, err
+			}
+			if _, err = b.ms.LabelRule.Update(ctx, labelRule.ID, map[string]interface{}{"rls": release}); err != nil {
+				return nil, err
+			}
+		}
+
+		labelRules, err = b.ms.LabelRule.Find(ctx, productID, label.ID)
+		if err != nil {
+			return nil, err
+		}
+		return changeOf(productName, schema.EventLabelUpdated, map[string]interface{}{
+			"label": labelName, "definition": tpl.LabelInfoFrom(*label, productName),
+			"rules": tpl.LabelRulesInfoFrom(labelRules), "restored": v.Version,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	restored, err := b.ms.Version.Snapshot(ctx, schema.VersionLabel, label.ID, v.Version)
+	if err != nil {
+		return nil, err
+	}
+	return &tpl.VersionInfoRes{Result: tpl.VersionInfoFrom(*restored)}, nil
+}
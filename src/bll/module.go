@@ -42,7 +42,13 @@ func (b *Module) Create(ctx context.Context, productName, moduleName, desc strin
 	}
 
 	module := &schema.Module{ProductID: productID, Name: moduleName, Desc: desc}
-	if err = b.ms.Module.Create(ctx, module); err != nil {
+	err = withChange(ctx, b.ms, func(ctx context.Context) (*schema.Change, error) {
+		if err := b.ms.Module.Create(ctx, module); err != nil {
+			return nil, err
+		}
+		return changeOf(productName, schema.EventModuleCreated, map[string]interface{}{"module": moduleName, "definition": module})
+	})
+	if err != nil {
 		return nil, err
 	}
 	return &tpl.ModuleRes{Result: *module}, nil
@@ -60,7 +66,12 @@ func (b *Module) Update(ctx context.Context, productName, moduleName string, bod
 		return nil, err
 	}
 
-	module, err = b.ms.Module.Update(ctx, module.ID, body.ToMap())
+	err = withChange(ctx, b.ms, func(ctx context.Context) (*schema.Change, error) {
+		if module, err = b.ms.Module.Update(ctx, module.ID, body.ToMap()); err != nil {
+			return nil, err
+		}
+		return changeOf(productName, schema.EventModuleUpdated, map[string]interface{}{"module": moduleName, "definition": module})
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -83,10 +94,17 @@ func (b *Module) Offline(ctx context.Context, productName, moduleName string) (*
 		return nil, gear.ErrNotFound.WithMsgf("module %s not found", moduleName)
 	}
 	if module.OfflineAt == nil {
-		if err = b.ms.Module.Offline(ctx, module.ID); err != nil {
+		err = withChange(ctx, b.ms, func(ctx context.Context) (*schema.Change, error) {
+			if err := b.ms.Module.Offline(ctx, module.ID); err != nil {
+				return nil, err
+			}
+			return changeOf(productName, schema.EventModuleOffline, map[string]interface{}{"module": moduleName})
+		})
+		if err != nil {
 			return nil, err
 		}
 		res.Result = true
+		emitEvent(ctx, b.ms, productID, productName, schema.EventModuleOffline, map[string]interface{}{"module": moduleName})
 	}
 	return res, nil
 }
@@ -30,10 +30,25 @@ func (b *Product) List(ctx context.Context, pg tpl.Pagination) (*tpl.ProductsRes
 	return res, nil
 }
 
+// Exists 判断产品名称是否已被使用，包括已下线和已删除的产品
+func (b *Product) Exists(ctx context.Context, productName string) (bool, error) {
+	product, err := b.ms.Product.FindByName(ctx, productName, "id")
+	if err != nil {
+		return false, err
+	}
+	return product != nil, nil
+}
+
 // Create 创建产品
 func (b *Product) Create(ctx context.Context, name, desc string) (*tpl.ProductRes, error) {
 	product := &schema.Product{Name: name, Desc: desc}
-	if err := b.ms.Product.Create(ctx, product); err != nil {
+	err := withChange(ctx, b.ms, func(ctx context.Context) (*schema.Change, error) {
+		if err := b.ms.Product.Create(ctx, product); err != nil {
+			return nil, err
+		}
+		return changeOf(name, schema.EventProductCreated, map[string]interface{}{"product": name, "definition": product})
+	})
+	if err != nil {
 		return nil, err
 	}
 	res := &tpl.ProductRes{Result: *product}
@@ -47,7 +62,13 @@ func (b *Product) Update(ctx context.Context, productName string, body tpl.Produ
 		return nil, err
 	}
 
-	product, err := b.ms.Product.Update(ctx, productID, body.ToMap())
+	var product *schema.Product
+	err = withChange(ctx, b.ms, func(ctx context.Context) (*schema.Change, error) {
+		if product, err = b.ms.Product.Update(ctx, productID, body.ToMap()); err != nil {
+			return nil, err
+		}
+		return changeOf(productName, schema.EventProductUpdated, map[string]interface{}{"product": productName, "definition": product})
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -69,10 +90,17 @@ func (b *Product) Offline(ctx context.Context, productName string) (*tpl.BoolRes
 
 	res := &tpl.BoolRes{Result: false}
 	if product.OfflineAt == nil {
-		if err = b.ms.Product.Offline(ctx, product.ID); err != nil {
+		err = withChange(ctx, b.ms, func(ctx context.Context) (*schema.Change, error) {
+			if err := b.ms.Product.Offline(ctx, product.ID); err != nil {
+				return nil, err
+			}
+			return changeOf(productName, schema.EventProductOffline, map[string]interface{}{"product": productName})
+		})
+		if err != nil {
 			return nil, err
 		}
 		res.Result = true
+		emitEvent(ctx, b.ms, product.ID, productName, schema.EventProductOffline, map[string]interface{}{"product": productName})
 	}
 	return res, nil
 }
@@ -92,7 +120,13 @@ func (b *Product) Delete(ctx context.Context, productName string) (*tpl.BoolRes,
 		}
 
 		if product.DeletedAt == nil {
-			if err = b.ms.Product.Delete(ctx, product.ID); err != nil {
+			err = withChange(ctx, b.ms, func(ctx context.Context) (*schema.Change, error) {
+				if err := b.ms.Product.Delete(ctx, product.ID); err != nil {
+					return nil, err
+				}
+				return changeOf(productName, schema.EventProductDeleted, map[string]interface{}{"product": productName})
+			})
+			if err != nil {
 				return nil, err
 			}
 			res.Result = true
@@ -0,0 +1,605 @@
+package bll
+
+import (
+	"context"
+	"sort"
+
+	"github.com/teambition/gear"
+	"github.com/teambition/urbs-setting/src/model"
+	"github.com/teambition/urbs-setting/src/schema"
+	"github.com/teambition/urbs-setting/src/tpl"
+)
+
+// 同步声明式配置的操作类型
+const (
+	configOpCreate  = "create"
+	configOpUpdate  = "update"
+	configOpOffline = "offline"
+	configOpDelete  = "delete"
+)
+
+// 同步声明式配置的操作对象类型
+const (
+	configKindModule      = "module"
+	configKindSetting     = "setting"
+	configKindSettingRule = "settingRule"
+	configKindLabel       = "label"
+	configKindLabelRule   = "labelRule"
+)
+
+// ProductConfig 产品的声明式配置：导出线上配置，对比配置文件与线上配置，
+// 并通过功能模块、配置项、环境标签已有的业务方法同步差异
+type ProductConfig struct {
+	ms      *model.Models
+	product *Product
+	module  *Module
+	setting *Setting
+	label   *Label
+}
+
+// Export 导出产品的线上配置，对象按名称排序，规则按类型排序
+func (b *ProductConfig) Export(ctx context.Context, productName string) (*tpl.ProductConfigRes, error) {
+	live, err := b.load(ctx, productName)
+	if err != nil {
+		return nil, err
+	}
+	return &tpl.ProductConfigRes{Result: configOf(productName, live)}, nil
+}
+
+// Plan 对比配置文件与线上配置，返回需要执行的操作。
+// prune 为 false 时不下线或删除配置文件中没有的对象
+func (b *ProductConfig) Plan(ctx context.Context, productName string, cfg *tpl.ProductConfig, prune bool) (*tpl.ProductConfigPlanRes, error) {
+	ops, err := b.plan(ctx, productName, cfg, prune)
+	if err != nil {
+		return nil, err
+	}
+	return &tpl.ProductConfigPlanRes{Result: planOf(productName, prune, ops)}, nil
+}
+
+// Apply 按 Plan 的结果依次执行操作，返回已执行的操作。
+// 各操作分别提交，执行失败时停止，已执行的操作不会回滚，修正后再次 apply 即可
+func (b *ProductConfig) Apply(ctx context.Context, productName string, cfg *tpl.ProductConfig, prune bool) (*tpl.ProductConfigPlanRes, error) {
+	ops, err := b.plan(ctx, productName, cfg, prune)
+	if err != nil {
+		return nil, err
+	}
+	if err := runOps(ctx, ops); err != nil {
+		return nil, err
+	}
+	return &tpl.ProductConfigPlanRes{Result: planOf(productName, prune, ops)}, nil
+}
+
+// runOps 依次执行操作，失败时停止并返回已执行的操作数量
+func runOps(ctx context.Context, ops []configOp) error {
+	for i, op := range ops {
+		if err := op.run(ctx); err != nil {
+			herr := gear.ParseError(err)
+			msg := herr.Error()
+			if e, ok := herr.(*gear.Error); ok {
+				msg = e.Msg
+			}
+			return gear.Err.WithCode(herr.Status()).WithMsgf("%s %s %s failed after %d operations applied: %s",
+				op.Op, op.Kind, op.Target, i, msg)
+		}
+	}
+	return nil
+}
+
+// configOp 同步声明式配置的一个操作及其执行方法
+type configOp struct {
+	tpl.ProductConfigOp
+	run func(ctx context.Context) error
+}
+
+func planOf(productName string, prune bool, ops []configOp) tpl.ProductConfigPlan {
+	plan := tpl.ProductConfigPlan{
+		Product:    productName,
+		Prune:      prune,
+		Operations: make([]tpl.ProductConfigOp, len(ops)),
+	}
+	for i, op := range ops {
+		plan.Operations[i] = op.ProductConfigOp
+	}
+	return plan
+}
+
+// plan 先创建、更新功能模块及其配置项，再创建、更新环境标签，最后下线多余的功能模块和环境标签，
+// 新的配置项可选值在规则使用之前生效
+func (b *ProductConfig) plan(ctx context.Context, productName string, cfg *tpl.ProductConfig, prune bool) ([]configOp, error) {
+	if cfg.Product != "" && cfg.Product != productName {
+		return nil, gear.ErrBadRequest.WithMsgf("product config is for %s, not %s", cfg.Product, productName)
+	}
+	live, err := b.load(ctx, productName)
+	if err != nil {
+		return nil, err
+	}
+	return b.diff(productName, live, cfg, prune), nil
+}
+
+// diff 对比配置与线上配置，返回需要执行的操作
+func (b *ProductConfig) diff(productName string, live *productState, cfg *tpl.ProductConfig, prune bool) []configOp {
+	ops := make([]configOp, 0)
+	liveModules := make(map[string]schema.Module, len(live.modules))
+	for _, m := range live.modules {
+		liveModules[m.Name] = m
+	}
+	for _, mc := range cfg.Modules {
+		mc := mc
+		m, ok := liveModules[mc.Name]
+		if !ok {
+			ops = append(ops, configOp{
+				ProductConfigOp: tpl.ProductConfigOp{Op: configOpCreate, Kind: configKindModule, Target: mc.Name,
+					After: &tpl.ModuleConfig{Name: mc.Name, Desc: mc.Desc}},
+				run: func(ctx context.Context) error {
+					_, err := b.module.Create(ctx, productName, mc.Name, mc.Desc)
+					return err
+				},
+			})
+		} else if m.Desc != mc.Desc {
+			ops = append(ops, configOp{
+				ProductConfigOp: tpl.ProductConfigOp{Op: configOpUpdate, Kind: configKindModule, Target: mc.Name,
+					Before: map[string]interface{}{"desc": m.Desc}, After: map[string]interface{}{"desc": mc.Desc}},
+				run: func(ctx context.Context) error {
+					_, err := b.module.Update(ctx, productName, mc.Name, tpl.ModuleUpdateBody{Desc: &mc.Desc})
+					return err
+				},
+			})
+		}
+		// 功能模块不存在时 m.ID 为 0，没有线上的配置项
+		ops = append(ops, b.planSettings(productName, mc, live.settings[m.ID], live.settingRules, prune)...)
+		delete(liveModules, mc.Name)
+	}
+
+	liveLabels := make(map[string]schema.Label, len(live.labels))
+	for _, l := range live.labels {
+		liveLabels[l.Name] = l
+	}
+	for _, lc := range cfg.Labels {
+		lc := lc
+		l, ok := liveLabels[lc.Name]
+		if !ok {
+			ops = append(ops, configOp{
+				ProductConfigOp: tpl.ProductConfigOp{Op: configOpCreate, Kind: configKindLabel, Target: lc.Name,
+					After: &tpl.LabelConfig{Name: lc.Name, Desc: lc.Desc, Channels: lc.Channels, Clients: lc.Clients}},
+				run: func(ctx context.Context) error {
+					_, err := b.label.Create(ctx, productName, lc.Body())
+					return err
+				},
+			})
+		} else if before, after, body := labelChanges(labelConfigFrom(l), lc); body != nil {
+			ops = append(ops, configOp{
+				ProductConfigOp: tpl.ProductConfigOp{Op: configOpUpdate, Kind: configKindLabel, Target: lc.Name,
+					Before: before, After: after},
+				run: func(ctx context.Context) error {
+					_, err := b.label.Update(ctx, productName, lc.Name, *body)
+					return err
+				},
+			})
+		}
+		ops = append(ops, planRules(configKindLabelRule, lc.Name, live.labelRules[l.ID], lc.Rules, prune, ruleFuncs{
+			create: func(ctx context.Context, r *tpl.RuleConfig) error {
+				_, err := b.label.CreateRule(ctx, productName, lc.Name, tpl.LabelRuleBody{PercentRule: *r.PercentRule()})
+				return err
+			},
+			update: func(ctx context.Context, id int64, r *tpl.RuleConfig) error {
+				_, err := b.label.UpdateRule(ctx, productName, lc.Name, id, tpl.LabelRuleBody{PercentRule: *r.PercentRule()})
+				return err
+			},
+			delete: func(ctx context.Context, id int64) error {
+				_, err := b.label.DeleteRule(ctx, productName, lc.Name, id)
+				return err
+			},
+		})...)
+		delete(liveLabels, lc.Name)
+	}
+
+	if prune {
+		for _, m := range live.modules {
+			if _, ok := liveModules[m.Name]; !ok {
+				continue
+			}
+			name := m.Name
+			ops = append(ops, configOp{
+				ProductConfigOp: tpl.ProductConfigOp{Op: configOpOffline, Kind: configKindModule, Target: name,
+					Before: moduleConfigFrom(m)},
+				run: func(ctx context.Context) error {
+					_, err := b.module.Offline(ctx, productName, name)
+					return err
+				},
+			})
+		}
+		for _, l := range live.labels {
+			if _, ok := liveLabels[l.Name]; !ok {
+				continue
+			}
+			name := l.Name
+			ops = append(ops, configOp{
+				ProductConfigOp: tpl.ProductConfigOp{Op: configOpOffline, Kind: configKindLabel, Target: name,
+					Before: labelConfigFrom(l)},
+				run: func(ctx context.Context) error {
+					_, err := b.label.Offline(ctx, productName, name)
+					return err
+				},
+			})
+		}
+	}
+	return ops
+}
+
+// planSettings 对比功能模块下的配置项，下线功能模块时其配置项随之下线，不需要单独的操作
+func (b *ProductConfig) planSettings(productName string, mc *tpl.ModuleConfig, settings []schema.Setting,
+	settingRules map[int64][]ruleState, prune bool) []configOp {
+	ops := make([]configOp, 0)
+	liveSettings := make(map[string]schema.Setting, len(settings))
+	for _, s := range settings {
+		liveSettings[s.Name] = s
+	}
+	for _, sc := range mc.Settings {
+		sc := sc
+		target := mc.Name + "/" + sc.Name
+		s, ok := liveSettings[sc.Name]
+		if !ok {
+			ops = append(ops, configOp{
+				ProductConfigOp: tpl.ProductConfigOp{Op: configOpCreate, Kind: configKindSetting, Target: target,
+					After: &tpl.SettingConfig{Name: sc.Name, Desc: sc.Desc, Channels: sc.Channels, Clients: sc.Clients, Values: sc.Values}},
+				run: func(ctx context.Context) error {
+					_, err := b.setting.Create(ctx, productName, mc.Name, sc.Body())
+					return err
+				},
+			})
+		} else if before, after, body := settingChanges(settingConfigFrom(s), sc); body != nil {
+			ops = append(ops, configOp{
+				ProductConfigOp: tpl.ProductConfigOp{Op: configOpUpdate, Kind: configKindSetting, Target: target,
+					Before: before, After: after},
+				run: func(ctx context.Context) error {
+					_, err := b.setting.Update(ctx, productName, mc.Name, sc.Name, *body)
+					return err
+				},
+			})
+		}
+		ops = append(ops, planRules(configKindSettingRule, target, settingRules[s.ID], sc.Rules, prune, ruleFuncs{
+			create: func(ctx context.Context, r *tpl.RuleConfig) error {
+				_, err := b.setting.CreateRule(ctx, productName, mc.Name, sc.Name, tpl.SettingRuleBody{PercentRule: *r.PercentRule(), Value: r.Value})
+				return err
+			},
+			update: func(ctx context.Context, id int64, r *tpl.RuleConfig) error {
+				_, err := b.setting.UpdateRule(ctx, productName, mc.Name, sc.Name, id, tpl.SettingRuleBody{PercentRule: *r.PercentRule(), Value: r.Value})
+				return err
+			},
+			delete: func(ctx context.Context, id int64) error {
+				_, err := b.setting.DeleteRule(ctx, productName, mc.Name, sc.Name, id)
+				return err
+			},
+		})...)
+		delete(liveSettings, sc.Name)
+	}
+
+	if prune {
+		for _, s := range settings {
+			if _, ok := liveSettings[s.Name]; !ok {
+				continue
+			}
+			name := s.Name
+			ops = append(ops, configOp{
+				ProductConfigOp: tpl.ProductConfigOp{Op: configOpOffline, Kind: configKindSetting, Target: mc.Name + "/" + name,
+					Before: settingConfigFrom(s)},
+				run: func(ctx context.Context) error {
+					_, err := b.setting.Offline(ctx, productName, mc.Name, name)
+					return err
+				},
+			})
+		}
+	}
+	return ops
+}
+
+// ruleState 线上的灰度发布规则
+type ruleState struct {
+	id  int64
+	cfg tpl.RuleConfig
+}
+
+type ruleFuncs struct {
+	create func(ctx context.Context, r *tpl.RuleConfig) error
+	update func(ctx context.Context, id int64, r *tpl.RuleConfig) error
+	delete func(ctx context.Context, id int64) error
+}
+
+// planRules 按规则类型对比，线上同一类型有多条规则时只对比第一条，其余的在 prune 时删除
+func planRules(kind, target string, states []ruleState, rules []*tpl.RuleConfig, prune bool, fns ruleFuncs) []configOp {
+	ops := make([]configOp, 0)
+	byKind := make(map[string]ruleState, len(states))
+	for _, s := range states {
+		if _, ok := byKind[s.cfg.Kind]; !ok {
+			byKind[s.cfg.Kind] = s
+		}
+	}
+
+	matched := make(map[int64]bool, len(rules))
+	for _, r := range rules {
+		r := r
+		s, ok := byKind[r.Kind]
+		if !ok {
+			ops = append(ops, configOp{
+				ProductConfigOp: tpl.ProductConfigOp{Op: configOpCreate, Kind: kind, Target: target + "/" + r.Kind, After: r},
+				run:             func(ctx context.Context) error { return fns.create(ctx, r) },
+			})
+			continue
+		}
+		matched[s.id] = true
+		if s.cfg != *r {
+			before := s.cfg
+			ops = append(ops, configOp{
+				ProductConfigOp: tpl.ProductConfigOp{Op: configOpUpdate, Kind: kind, Target: target + "/" + r.Kind, Before: &before, After: r},
+				run:             func(ctx context.Context) error { return fns.update(ctx, s.id, r) },
+			})
+		}
+	}
+
+	if prune {
+		for _, s := range states {
+			if matched[s.id] {
+				continue
+			}
+			s := s
+			ops = append(ops, configOp{
+				ProductConfigOp: tpl.ProductConfigOp{Op: configOpDelete, Kind: kind, Target: target + "/" + s.cfg.Kind, Before: &s.cfg},
+				run:             func(ctx context.Context) error { return fns.delete(ctx, s.id) },
+			})
+		}
+	}
+	return ops
+}
+
+func ruleStatesOfLabel(rules []schema.LabelRule) []ruleState {
+	states := make([]ruleState, len(rules))
+	for i, r := range rules {
+		states[i] = ruleState{id: r.ID, cfg: tpl.RuleConfig{Kind: r.Kind, Percent: schema.ToPercentRule(r.Kind, r.Rule).Rule.Value}}
+	}
+	return states
+}
+
+func ruleStatesOfSetting(rules []schema.SettingRule) []ruleState {
+	states := make([]ruleState, len(rules))
+	for i, r := range rules {
+		states[i] = ruleState{id: r.ID, cfg: tpl.RuleConfig{Kind: r.Kind, Percent: schema.ToPercentRule(r.Kind, r.Rule).Rule.Value, Value: r.Value}}
+	}
+	return states
+}
+
+// ruleConfigsOf 返回每种类型的第一条规则，按类型排序
+func ruleConfigsOf(states []ruleState) []*tpl.RuleConfig {
+	res := make([]*tpl.RuleConfig, 0, len(states))
+	seen := make(map[string]bool, len(states))
+	for _, s := range states {
+		if !seen[s.cfg.Kind] {
+			seen[s.cfg.Kind] = true
+			cfg := s.cfg
+			res = append(res, &cfg)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Kind < res[j].Kind })
+	return res
+}
+
+// configOf 返回线上配置对应的声明式配置
+func configOf(productName string, live *productState) tpl.ProductConfig {
+	cfg := tpl.ProductConfig{
+		Product: productName,
+		Modules: make([]*tpl.ModuleConfig, 0, len(live.modules)),
+		Labels:  make([]*tpl.LabelConfig, 0, len(live.labels)),
+	}
+	for _, m := range live.modules {
+		mc := moduleConfigFrom(m)
+		for _, s := range live.settings[m.ID] {
+			sc := settingConfigFrom(s)
+			sc.Rules = ruleConfigsOf(live.settingRules[s.ID])
+			mc.Settings = append(mc.Settings, sc)
+		}
+		cfg.Modules = append(cfg.Modules, mc)
+	}
+	for _, l := range live.labels {
+		lc := labelConfigFrom(l)
+		lc.Rules = ruleConfigsOf(live.labelRules[l.ID])
+		cfg.Labels = append(cfg.Labels, lc)
+	}
+	return cfg
+}
+
+func moduleConfigFrom(m schema.Module) *tpl.ModuleConfig {
+	return &tpl.ModuleConfig{Name: m.Name, Desc: m.Desc}
+}
+
+func settingConfigFrom(s schema.Setting) *tpl.SettingConfig {
+	return &tpl.SettingConfig{
+		Name:     s.Name,
+		Desc:     s.Desc,
+		Channels: tpl.StringToSlice(s.Channels),
+		Clients:  tpl.StringToSlice(s.Clients),
+		Values:   tpl.StringToSlice(s.Values),
+	}
+}
+
+func labelConfigFrom(l schema.Label) *tpl.LabelConfig {
+	return &tpl.LabelConfig{
+		Name:     l.Name,
+		Desc:     l.Desc,
+		Channels: tpl.StringToSlice(l.Channels),
+		Clients:  tpl.StringToSlice(l.Clients),
+	}
+}
+
+// settingChanges 返回配置项变化的字段，没有变化时 body 为 nil
+func settingChanges(cur, want *tpl.SettingConfig) (before, after map[string]interface{}, body *tpl.SettingUpdateBody) {
+	before, after = map[string]interface{}{}, map[string]interface{}{}
+	b := &tpl.SettingUpdateBody{}
+	if cur.Desc != want.Desc {
+		before["desc"], after["desc"] = cur.Desc, want.Desc
+		b.Desc = &want.Desc
+	}
+	if !sameStrings(cur.Channels, want.Channels) {
+		before["channels"], after["channels"] = cur.Channels, want.Channels
+		b.Channels = &want.Channels
+	}
+	if !sameStrings(cur.Clients, want.Clients) {
+		before["clients"], after["clients"] = cur.Clients, want.Clients
+		b.Clients = &want.Clients
+	}
+	if !sameStrings(cur.Values, want.Values) {
+		before["values"], after["values"] = cur.Values, want.Values
+		b.Values = &want.Values
+	}
+	if len(after) == 0 {
+		return nil, nil, nil
+	}
+	return before, after, b
+}
+
+// labelChanges 返回环境标签变化的字段，没有变化时 body 为 nil
+func labelChanges(cur, want *tpl.LabelConfig) (before, after map[string]interface{}, body *tpl.LabelUpdateBody) {
+	before, after = map[string]interface{}{}, map[string]interface{}{}
+	b := &tpl.LabelUpdateBody{}
+	if cur.Desc != want.Desc {
+		before["desc"], after["desc"] = cur.Desc, want.Desc
+		b.Desc = &want.Desc
+	}
+	if !sameStrings(cur.Channels, want.Channels) {
+		before["channels"], after["channels"] = cur.Channels, want.Channels
+		b.Channels = &want.Channels
+	}
+	if !sameStrings(cur.Clients, want.Clients) {
+		before["clients"], after["clients"] = cur.Clients, want.Clients
+		b.Clients = &want.Clients
+	}
+	if len(after) == 0 {
+		return nil, nil, nil
+	}
+	return before, after, b
+}
+
+// sameStrings 判断两个字符串集合是否相同，nil 与空数组相同
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sa := append([]string{}, a...)
+	sb := append([]string{}, b...)
+	sort.Strings(sa)
+	sort.Strings(sb)
+	for i := range sa {
+		if sa[i] != sb[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// productState 产品的线上配置，只包括未下线的对象
+type productState struct {
+	modules      []schema.Module
+	settings     map[int64][]schema.Setting // 按功能模块 ID 索引
+	settingRules map[int64][]ruleState      // 按配置项 ID 索引
+	labels       []schema.Label
+	labelRules   map[int64][]ruleState // 按环境标签 ID 索引
+}
+
+func newProductState() *productState {
+	return &productState{
+		settings:     make(map[int64][]schema.Setting),
+		settingRules: make(map[int64][]ruleState),
+		labelRules:   make(map[int64][]ruleState),
+	}
+}
+
+// configPageSize 读取线上配置时的分页大小
+const configPageSize = 1000
+
+// findAll 分页读取全部数据，fetch 返回下一页的起始 ID，没有下一页时返回 0
+func findAll(fetch func(pg tpl.Pagination) (int64, error)) error {
+	pg := tpl.Pagination{PageSize: configPageSize}
+	for {
+		next, err := fetch(pg)
+		if err != nil || next <= 0 {
+			return err
+		}
+		pg.PageToken = tpl.IDToPageToken(next)
+	}
+}
+
+func (b *ProductConfig) load(ctx context.Context, productName string) (*productState, error) {
+	productID, err := b.ms.Product.AcquireID(ctx, productName)
+	if err != nil {
+		return nil, err
+	}
+
+	st := newProductState()
+	err = findAll(func(pg tpl.Pagination) (next int64, err error) {
+		modules, _, err := b.ms.Module.Find(ctx, productID, pg)
+		if err != nil {
+			return 0, err
+		}
+		if len(modules) > pg.PageSize {
+			next = modules[pg.PageSize].ID
+			modules = modules[:pg.PageSize]
+		}
+		st.modules = append(st.modules, modules...)
+		return next, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(st.modules, func(i, j int) bool { return st.modules[i].Name < st.modules[j].Name })
+
+	for _, m := range st.modules {
+		moduleID := m.ID
+		err = findAll(func(pg tpl.Pagination) (next int64, err error) {
+			settings, _, err := b.ms.Setting.Find(ctx, productID, moduleID, pg)
+			if err != nil {
+				return 0, err
+			}
+			if len(settings) > pg.PageSize {
+				next = settings[pg.PageSize].ID
+				settings = settings[:pg.PageSize]
+			}
+			st.settings[moduleID] = append(st.settings[moduleID], settings...)
+			return next, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		settings := st.settings[moduleID]
+		sort.Slice(settings, func(i, j int) bool { return settings[i].Name < settings[j].Name })
+		for _, s := range settings {
+			rules, err := b.ms.SettingRule.Find(ctx, productID, s.ID)
+			if err != nil {
+				return nil, err
+			}
+			st.settingRules[s.ID] = ruleStatesOfSetting(rules)
+		}
+	}
+
+	err = findAll(func(pg tpl.Pagination) (next int64, err error) {
+		labels, _, err := b.ms.Label.Find(ctx, productID, pg)
+		if err != nil {
+			return 0, err
+		}
+		if len(labels) > pg.PageSize {
+			next = labels[pg.PageSize].ID
+			labels = labels[:pg.PageSize]
+		}
+		st.labels = append(st.labels, labels...)
+		return next, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(st.labels, func(i, j int) bool { return st.labels[i].Name < st.labels[j].Name })
+	for _, l := range st.labels {
+		rules, err := b.ms.LabelRule.Find(ctx, productID, l.ID)
+		if err != nil {
+			return nil, err
+		}
+		st.labelRules[l.ID] = ruleStatesOfLabel(rules)
+	}
+	return st, nil
+}
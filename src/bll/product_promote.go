@@ -0,0 +1,428 @@
+package bll
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/teambition/gear"
+	"github.com/teambition/urbs-setting/src/schema"
+	"github.com/teambition/urbs-setting/src/tpl"
+)
+
+// 复制、推广产品配置时额外的操作类型和操作对象类型
+const (
+	configOpAssign          = "assign"
+	configKindProduct       = "product"
+	configKindLabelGroups   = "labelGroups"
+	configKindSettingGroups = "settingGroups"
+)
+
+// 复制、推广产品配置时冲突的原因
+const (
+	conflictReasonDiffers = "differs from source product"
+	conflictReasonValue   = "value is not in the values of target setting"
+)
+
+// promoteOptions 复制、推广的参数，all 为 true 时包括源产品的全部功能模块和环境标签
+type promoteOptions struct {
+	target    string
+	desc      string
+	create    bool // 目标产品不存在时创建
+	all       bool
+	modules   []string
+	labels    []string
+	groups    bool
+	overwrite bool
+	dryRun    bool
+}
+
+// Clone 把产品的全部配置复制到目标产品，目标产品不存在时创建
+func (b *ProductConfig) Clone(ctx context.Context, source string, body *tpl.ProductCloneBody) (*tpl.ProductPromoteRes, error) {
+	return b.promote(ctx, source, promoteOptions{
+		target:    body.Target,
+		desc:      body.Desc,
+		create:    true,
+		all:       true,
+		groups:    body.Groups,
+		overwrite: body.Overwrite,
+		dryRun:    body.DryRun,
+	})
+}
+
+// Promote 把产品中选定的功能模块、配置项和环境标签推广到已存在的目标产品
+func (b *ProductConfig) Promote(ctx context.Context, source string, body *tpl.ProductPromoteBody) (*tpl.ProductPromoteRes, error) {
+	return b.promote(ctx, source, promoteOptions{
+		target:    body.Target,
+		modules:   body.Modules,
+		labels:    body.Labels,
+		groups:    body.Groups,
+		overwrite: body.Overwrite,
+		dryRun:    body.DryRun,
+	})
+}
+
+// promote 以源产品的线上配置为目标，不带 prune 地同步到目标产品：目标产品中没有的对象被创建，
+// 已有的对象被合并。与源产品不一致的对象默认作为冲突返回，不做修改，overwrite 时覆盖。
+// 各操作分别提交，失败时停止，已执行的操作不会回滚
+func (b *ProductConfig) promote(ctx context.Context, source string, opts promoteOptions) (*tpl.ProductPromoteRes, error) {
+	if source == opts.target {
+		return nil, gear.ErrBadRequest.WithMsgf("target product must be different from %s", source)
+	}
+	src, err := b.load(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := selectConfig(source, src, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	ops := make([]configOp, 0)
+	live := newProductState()
+	product, err := b.ms.Product.FindByName(ctx, opts.target, "id")
+	if err != nil {
+		return nil, err
+	}
+	if product == nil && opts.create {
+		ops = append(ops, configOp{
+			ProductConfigOp: tpl.ProductConfigOp{Op: configOpCreate, Kind: configKindProduct, Target: opts.target,
+				After: &tpl.NameDescBody{Name: opts.target, Desc: opts.desc}},
+			run: func(ctx context.Context) error {
+				_, err := b.product.Create(ctx, opts.target, opts.desc)
+				return err
+			},
+		})
+	} else if live, err = b.load(ctx, opts.target); err != nil {
+		return nil, err
+	}
+
+	conflicts := make([]tpl.ProductConfigOp, 0)
+	skipped := make(map[string]bool)
+	for _, op := range b.diff(opts.target, live, cfg, false) {
+		if reason := conflictOf(op, live, skipped, opts.overwrite); reason != "" {
+			if op.Kind == configKindSetting {
+				skipped[op.Target] = true
+			}
+			op.Reason = reason
+			conflicts = append(conflicts, op.ProductConfigOp)
+			continue
+		}
+		ops = append(ops, op)
+	}
+	if opts.groups {
+		groupOps, groupConflicts, err := b.planGroups(ctx, src, live, cfg, skipped, opts)
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, groupOps...)
+		conflicts = append(conflicts, groupConflicts...)
+	}
+
+	if !opts.dryRun {
+		if err := runOps(ctx, ops); err != nil {
+			return nil, err
+		}
+	}
+	res := &tpl.ProductPromoteRes{Result: tpl.ProductPromoteResult{
+		Source:     source,
+		Target:     opts.target,
+		DryRun:     opts.dryRun,
+		Operations: planOf(opts.target, false, ops).Operations,
+		Conflicts:  conflicts,
+	}}
+	return res, nil
+}
+
+// conflictOf 返回操作冲突的原因，没有冲突时返回空字符串。
+// 没有覆盖时，更新操作都是冲突；配置项的可选值没有更新时，规则的值必须是目标配置项已有的可选值
+func conflictOf(op configOp, live *productState, skipped map[string]bool, overwrite bool) string {
+	if overwrite {
+		return ""
+	}
+	if op.Op == configOpUpdate {
+		return conflictReasonDiffers
+	}
+	if op.Op == configOpCreate && op.Kind == configKindSettingRule {
+		setting := op.Target[:strings.LastIndexByte(op.Target, '/')]
+		if r := op.After.(*tpl.RuleConfig); skipped[setting] && r.Value != "" &&
+			!tpl.StringSliceHas(live.settingValues(setting), r.Value) {
+			return conflictReasonValue
+		}
+	}
+	return ""
+}
+
+// selectConfig 返回源产品中需要复制的配置，选定的对象不存在时返回 404 错误
+func selectConfig(source string, src *productState, opts promoteOptions) (*tpl.ProductConfig, error) {
+	full := configOf(source, src)
+	if opts.all {
+		return &full, nil
+	}
+
+	cfg := &tpl.ProductConfig{Product: source, Modules: []*tpl.ModuleConfig{}, Labels: []*tpl.LabelConfig{}}
+	modules := make(map[string]*tpl.ModuleConfig, len(full.Modules))
+	for _, mc := range full.Modules {
+		modules[mc.Name] = mc
+	}
+	selected := make(map[string]*tpl.ModuleConfig)
+	for _, name := range opts.modules {
+		moduleName, settingName := tpl.SplitModuleSetting(name)
+		mc, ok := modules[moduleName]
+		if !ok {
+			return nil, gear.ErrNotFound.WithMsgf("module %s not found in product %s", moduleName, source)
+		}
+		sel, ok := selected[moduleName]
+		if !ok {
+			sel = &tpl.ModuleConfig{Name: mc.Name, Desc: mc.Desc}
+			selected[moduleName] = sel
+			cfg.Modules = append(cfg.Modules, sel)
+		}
+		if settingName == "" {
+			sel.Settings = mc.Settings
+			continue
+		}
+		var sc *tpl.SettingConfig
+		for _, s := range mc.Settings {
+			if s.Name == settingName {
+				sc = s
+			}
+		}
+		if sc == nil {
+			return nil, gear.ErrNotFound.WithMsgf("setting %s not found in product %s", name, source)
+		}
+		if !hasSettingConfig(sel.Settings, settingName) {
+			sel.Settings = append(sel.Settings, sc)
+		}
+	}
+
+	labels := make(map[string]*tpl.LabelConfig, len(full.Labels))
+	for _, lc := range full.Labels {
+		labels[lc.Name] = lc
+	}
+	for _, name := range opts.labels {
+		lc, ok := labels[name]
+		if !ok {
+			return nil, gear.ErrNotFound.WithMsgf("label %s not found in product %s", name, source)
+		}
+		if lc != nil {
+			cfg.Labels = append(cfg.Labels, lc)
+			labels[name] = nil // 忽略重复选择的环境标签
+		}
+	}
+	return cfg, nil
+}
+
+func hasSettingConfig(settings []*tpl.SettingConfig, name string) bool {
+	for _, s := range settings {
+		if s.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// planGroups 对比源产品和目标产品中选定对象的群组，返回为目标产品补充群组的操作。
+// 群组在目标配置项中的值不同时作为冲突返回，overwrite 时覆盖
+func (b *ProductConfig) planGroups(ctx context.Context, src, live *productState, cfg *tpl.ProductConfig,
+	skipped map[string]bool, opts promoteOptions) ([]configOp, []tpl.ProductConfigOp, error) {
+	ops := make([]configOp, 0)
+	conflicts := make([]tpl.ProductConfigOp, 0)
+
+	for _, mc := range cfg.Modules {
+		for _, sc := range mc.Settings {
+			moduleName, settingName, target := mc.Name, sc.Name, mc.Name+"/"+sc.Name
+			groups, err := b.settingGroups(ctx, src.settingID(target))
+			if err != nil {
+				return nil, nil, err
+			}
+			if len(groups) == 0 {
+				continue
+			}
+			current, err := b.settingGroups(ctx, live.settingID(target))
+			if err != nil {
+				return nil, nil, err
+			}
+			values := sc.Values
+			if skipped[target] {
+				values = live.settingValues(target)
+			}
+
+			keys := make([]string, 0, len(groups))
+			for key := range groups {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			byValue := make(map[string][]*tpl.GroupKindUID)
+			for _, key := range keys {
+				value, group := groups[key], groupOfKey(key)
+				before, ok := current[key]
+				switch {
+				case ok && before == value:
+					continue
+				case value != "" && !tpl.StringSliceHas(values, value):
+					conflicts = append(conflicts, tpl.ProductConfigOp{Op: configOpAssign, Kind: configKindSettingGroups, Target: target,
+						After: map[string]interface{}{"group": group, "value": value}, Reason: conflictReasonValue})
+					continue
+				case ok && !opts.overwrite:
+					conflicts = append(conflicts, tpl.ProductConfigOp{Op: configOpAssign, Kind: configKindSettingGroups, Target: target,
+						Before: map[string]interface{}{"group": group, "value": before},
+						After:  map[string]interface{}{"group": group, "value": value}, Reason: conflictReasonDiffers})
+					continue
+				}
+				byValue[value] = append(byValue[value], group)
+			}
+
+			for _, value := range sortedKeys(byValue) {
+				value, groups := value, byValue[value]
+				ops = append(ops, configOp{
+					ProductConfigOp: tpl.ProductConfigOp{Op: configOpAssign, Kind: configKindSettingGroups, Target: target,
+						After: map[string]interface{}{"value": value, "groups": groups}},
+					run: func(ctx context.Context) error {
+						_, err := b.setting.Assign(ctx, opts.target, moduleName, settingName, value, nil, groups)
+						return err
+					},
+				})
+			}
+		}
+	}
+
+	for _, lc := range cfg.Labels {
+		labelName := lc.Name
+		groups, err := b.labelGroups(ctx, src.labelID(labelName))
+		if err != nil {
+			return nil, nil, err
+		}
+		current, err := b.labelGroups(ctx, live.labelID(labelName))
+		if err != nil {
+			return nil, nil, err
+		}
+		missing := make([]*tpl.GroupKindUID, 0)
+		for key := range groups {
+			if !current[key] {
+				missing = append(missing, groupOfKey(key))
+			}
+		}
+		if len(missing) == 0 {
+			continue
+		}
+		sortGroups(missing)
+		ops = append(ops, configOp{
+			ProductConfigOp: tpl.ProductConfigOp{Op: configOpAssign, Kind: configKindLabelGroups, Target: labelName,
+				After: map[string]interface{}{"groups": missing}},
+			run: func(ctx context.Context) error {
+				_, err := b.label.Assign(ctx, opts.target, labelName, nil, missing)
+				return err
+			},
+		})
+	}
+	return ops, conflicts, nil
+}
+
+// settingGroups 返回配置项的全部群组及其值，按 kind:uid 索引，配置项不存在时返回空
+func (b *ProductConfig) settingGroups(ctx context.Context, settingID int64) (map[string]string, error) {
+	res := make(map[string]string)
+	if settingID == 0 {
+		return res, nil
+	}
+	err := findAll(func(pg tpl.Pagination) (next int64, err error) {
+		groups, _, err := b.ms.Setting.ListGroups(ctx, settingID, pg)
+		if err != nil {
+			return 0, err
+		}
+		if len(groups) > pg.PageSize {
+			next = groups[pg.PageSize].ID
+			groups = groups[:pg.PageSize]
+		}
+		for _, g := range groups {
+			res[g.Kind+":"+g.Group] = g.Value
+		}
+		return next, nil
+	})
+	return res, err
+}
+
+// labelGroups 返回环境标签的全部群组，按 kind:uid 索引，环境标签不存在时返回空
+func (b *ProductConfig) labelGroups(ctx context.Context, labelID int64) (map[string]bool, error) {
+	res := make(map[string]bool)
+	if labelID == 0 {
+		return res, nil
+	}
+	err := findAll(func(pg tpl.Pagination) (next int64, err error) {
+		groups, _, err := b.ms.Label.ListGroups(ctx, labelID, pg)
+		if err != nil {
+			return 0, err
+		}
+		if len(groups) > pg.PageSize {
+			next = groups[pg.PageSize].ID
+			groups = groups[:pg.PageSize]
+		}
+		for _, g := range groups {
+			res[g.Kind+":"+g.Group] = true
+		}
+		return next, nil
+	})
+	return res, err
+}
+
+func groupOfKey(key string) *tpl.GroupKindUID {
+	i := strings.IndexByte(key, ':')
+	return &tpl.GroupKindUID{Kind: key[:i], UID: key[i+1:]}
+}
+
+func sortGroups(groups []*tpl.GroupKindUID) {
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Kind != groups[j].Kind {
+			return groups[i].Kind < groups[j].Kind
+		}
+		return groups[i].UID < groups[j].UID
+	})
+}
+
+func sortedKeys(m map[string][]*tpl.GroupKindUID) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// setting 返回 web/theme 格式的配置项，不存在时返回 nil
+func (st *productState) setting(target string) *schema.Setting {
+	moduleName, settingName := tpl.SplitModuleSetting(target)
+	for _, m := range st.modules {
+		if m.Name != moduleName {
+			continue
+		}
+		for i, s := range st.settings[m.ID] {
+			if s.Name == settingName {
+				return &st.settings[m.ID][i]
+			}
+		}
+	}
+	return nil
+}
+
+func (st *productState) settingID(target string) int64 {
+	if s := st.setting(target); s != nil {
+		return s.ID
+	}
+	return 0
+}
+
+func (st *productState) settingValues(target string) []string {
+	if s := st.setting(target); s != nil {
+		return tpl.StringToSlice(s.Values)
+	}
+	return nil
+}
+
+func (st *productState) labelID(name string) int64 {
+	for _, l := range st.labels {
+		if l.Name == name {
+			return l.ID
+		}
+	}
+	return 0
+}
@@ -0,0 +1,162 @@
+package bll
+
+import (
+	"context"
+
+	"github.com/teambition/gear"
+	"github.com/teambition/urbs-setting/src/conf"
+	"github.com/teambition/urbs-setting/src/model"
+	"github.com/teambition/urbs-setting/src/schema"
+	"github.com/teambition/urbs-setting/src/tpl"
+	"github.com/teambition/urbs-setting/src/util"
+)
+
+// Role ...
+type Role struct {
+	ms    *model.Models
+	cache *util.TTLCache // subject -> []schema.RoleBinding
+}
+
+func newRole(ms *model.Models) *Role {
+	b := &Role{ms: ms}
+	if du := conf.Config.RBAC.CacheTTLDuration(); du > 0 {
+		b.cache = util.NewTTLCache(du, 10000)
+	}
+	return b
+}
+
+// Check 检查请求者在指定产品下是否拥有 required 或更高的角色，product 为空时只检查全局角色。
+// 未启用 RBAC 时不做检查，检查不通过时返回 403 错误
+func (b *Role) Check(ctx context.Context, subject, product, required string) error {
+	cfg := conf.Config.RBAC
+	if !cfg.Enabled {
+		return nil
+	}
+	if subject == "" {
+		return gear.ErrForbidden.WithMsgf("role %q required, but the request has no authenticated subject", required)
+	}
+	if cfg.IsAdmin(subject) {
+		return nil
+	}
+
+	bindings, err := b.bindings(ctx, subject)
+	if err != nil {
+		return err
+	}
+
+	need := schema.RoleLevel(required)
+	level := 0
+	hasProductRole := false
+	for _, rb := range bindings {
+		if rb.ProductID == 0 {
+			if l := schema.RoleLevel(rb.Role); l > level {
+				level = l
+			}
+		} else {
+			hasProductRole = true
+		}
+	}
+	if level < need && product != "" && hasProductRole {
+		// 产品不存在时视为没有该产品下的角色
+		if productID, err := b.ms.Product.AcquireID(context.WithValue(ctx, model.ReadDB, true), product); err == nil {
+			for _, rb := range bindings {
+				if rb.ProductID == productID {
+					if l := schema.RoleLevel(rb.Role); l > level {
+						level = l
+					}
+				}
+			}
+		}
+	}
+	if level >= need {
+		return nil
+	}
+	if product == "" {
+		return gear.ErrForbidden.WithMsgf("subject %q requires global role %q", subject, required)
+	}
+	return gear.ErrForbidden.WithMsgf("subject %q requires role %q on product %q", subject, required, product)
+}
+
+func (b *Role) bindings(ctx context.Context, subject string) ([]schema.RoleBinding, error) {
+	if b.cache != nil {
+		if val, ok := b.cache.Get(subject); ok {
+			return val.([]schema.RoleBinding), nil
+		}
+	}
+	bindings, err := b.ms.RoleBinding.FindBySubject(ctx, subject)
+	if err != nil {
+		return nil, err
+	}
+	if b.cache != nil {
+		b.cache.Set(subject, bindings)
+	}
+	return bindings, nil
+}
+
+// List 返回全局角色（productName 为空）或指定产品下的角色
+func (b *Role) List(ctx context.Context, productName, subject string, pg tpl.Pagination) (*tpl.RoleBindingsInfoRes, error) {
+	var productID int64
+	var err error
+	if productName != "" {
+		if productID, err = b.ms.Product.AcquireID(ctx, productName); err != nil {
+			return nil, err
+		}
+	}
+
+	bindings, total, err := b.ms.RoleBinding.Find(ctx, productID, subject, pg)
+	if err != nil {
+		return nil, err
+	}
+	res := &tpl.RoleBindingsInfoRes{Result: tpl.RoleBindingsInfoFrom(bindings, productName)}
+	res.TotalSize = total
+	if len(res.Result) > pg.PageSize {
+		res.NextPageToken = tpl.IDToPageToken(res.Result[pg.PageSize].ID)
+		res.Result = res.Result[:pg.PageSize]
+	}
+	return res, nil
+}
+
+// Grant 授予请求者全局角色（productName 为空）或指定产品下的角色，已有角色时替换。admin 只能全局授予
+func (b *Role) Grant(ctx context.Context, productName string, body *tpl.RoleBody) (*tpl.RoleBindingInfoRes, error) {
+	var productID int64
+	var err error
+	if productName != "" {
+		if body.Role == schema.RoleAdmin {
+			return nil, gear.ErrBadRequest.WithMsgf("role %q can only be granted globally", body.Role)
+		}
+		if productID, err = b.ms.Product.AcquireID(ctx, productName); err != nil {
+			return nil, err
+		}
+	}
+
+	binding, err := b.ms.RoleBinding.Upsert(ctx, body.Subject, productID, body.Role)
+	if err != nil {
+		return nil, err
+	}
+	b.invalidate(body.Subject)
+	return &tpl.RoleBindingInfoRes{Result: tpl.RoleBindingInfoFrom(*binding, productName)}, nil
+}
+
+// Revoke 撤销请求者的全局角色（productName 为空）或指定产品下的角色
+func (b *Role) Revoke(ctx context.Context, productName, subject string) (*tpl.BoolRes, error) {
+	var productID int64
+	var err error
+	if productName != "" {
+		if productID, err = b.ms.Product.AcquireID(ctx, productName); err != nil {
+			return nil, err
+		}
+	}
+
+	rowsAffected, err := b.ms.RoleBinding.Delete(ctx, subject, productID)
+	if err != nil {
+		return nil, err
+	}
+	b.invalidate(subject)
+	return &tpl.BoolRes{Result: rowsAffected > 0}, nil
+}
+
+func (b *Role) invalidate(subject string) {
+	if b.cache != nil {
+		b.cache.Delete(subject)
+	}
+}
@@ -51,12 +51,12 @@ func (b *Setting) Get(ctx context.Context, productName, moduleName, settingName
 		return nil, err
 	}
 
-	module, err := b.ms.Module.Acquire(ctx, productID, moduleName)
+	moduleID, err := b.ms.Module.AcquireID(ctx, productID, moduleName)
 	if err != nil {
 		return nil, err
 	}
 
-	setting, err := b.ms.Setting.Acquire(ctx, module.ID, settingName)
+	setting, err := b.ms.Setting.Acquire(ctx, moduleID, settingName)
 	if err != nil {
 		return nil, err
 	}
@@ -72,12 +72,12 @@ func (b *Setting) Create(ctx context.Context, productName, moduleName string, bo
 		return nil, err
 	}
 
-	module, err := b.ms.Module.Acquire(ctx, productID, moduleName)
+	moduleID, err := b.ms.Module.AcquireID(ctx, productID, moduleName)
 	if err != nil {
 		return nil, err
 	}
 
-	setting := &schema.Setting{ModuleID: module.ID, Name: body.Name, Desc: body.Desc}
+	setting := &schema.Setting{ModuleID: moduleID, Name: body.Name, Desc: body.Desc}
 	if body.Channels != nil {
 		setting.Channels = strings.Join(*body.Channels, ",")
 	}
@@ -88,9 +88,18 @@ func (b *Setting) Create(ctx context.Context, productName, moduleName string, bo
 		setting.Values = strings.Join(*body.Values, ",")
 	}
 
-	if err = b.ms.Setting.Create(ctx, setting); err != nil {
+	err = withChange(ctx, b.ms, func(ctx context.Context) (*schema.Change, error) {
+		if err := b.ms.Setting.Create(ctx, setting); err != nil {
+			return nil, err
+		}
+		return changeOf(productName, schema.EventSettingCreated, map[string]interface{}{
+			"module": moduleName, "setting": setting.Name, "definition": tpl.SettingInfoFrom(*setting, productName, moduleName),
+		})
+	})
+	if err != nil {
 		return nil, err
 	}
+	snapshotVersion(ctx, b.ms, schema.VersionSetting, setting.ID)
 	return &tpl.SettingInfoRes{Result: tpl.SettingInfoFrom(*setting, productName, moduleName)}, nil
 }
 
@@ -101,20 +110,29 @@ func (b *Setting) Update(ctx context.Context, productName, moduleName, settingNa
 		return nil, err
 	}
 
-	module, err := b.ms.Module.Acquire(ctx, productID, moduleName)
+	moduleID, err := b.ms.Module.AcquireID(ctx, productID, moduleName)
 	if err != nil {
 		return nil, err
 	}
 
-	setting, err := b.ms.Setting.Acquire(ctx, module.ID, settingName)
+	setting, err := b.ms.Setting.Acquire(ctx, moduleID, settingName)
 	if err != nil {
 		return nil, err
 	}
 
-	setting, err = b.ms.Setting.Update(ctx, setting.ID, body.ToMap())
+	snapshotVersion(ctx, b.ms, schema.VersionSetting, setting.ID)
+	err = withChange(ctx, b.ms, func(ctx context.Context) (*schema.Change, error) {
+		if setting, err = b.ms.Setting.Update(ctx, setting.ID, body.ToMap()); err != nil {
+			return nil, err
+		}
+		return changeOf(productName, schema.EventSettingUpdated, map[string]interface{}{
+			"module": moduleName, "setting": settingName, "definition": tpl.SettingInfoFrom(*setting, productName, moduleName),
+		})
+	})
 	if err != nil {
 		return nil, err
 	}
+	snapshotVersion(ctx, b.ms, schema.VersionSetting, setting.ID)
 	return &tpl.SettingInfoRes{Result: tpl.SettingInfoFrom(*setting, productName, moduleName)}, nil
 }
 
@@ -125,13 +143,13 @@ func (b *Setting) Offline(ctx context.Context, productName, moduleName, settingN
 		return nil, err
 	}
 
-	module, err := b.ms.Module.Acquire(ctx, productID, moduleName)
+	moduleID, err := b.ms.Module.AcquireID(ctx, productID, moduleName)
 	if err != nil {
 		return nil, err
 	}
 
 	res := &tpl.BoolRes{Result: false}
-	setting, err := b.ms.Setting.FindByName(ctx, module.ID, settingName, "id, `offline_at`")
+	setting, err := b.ms.Setting.FindByName(ctx, moduleID, settingName, "id, `offline_at`")
 	if err != nil {
 		return nil, err
 	}
@@ -139,10 +157,19 @@ func (b *Setting) Offline(ctx context.Context, productName, moduleName, settingN
 		return nil, gear.ErrNotFound.WithMsgf("setting %s not found", settingName)
 	}
 	if setting.OfflineAt == nil {
-		if err = b.ms.Setting.Offline(ctx, module.ID, setting.ID); err != nil {
+		err = withChange(ctx, b.ms, func(ctx context.Context) (*schema.Change, error) {
+			if err := b.ms.Setting.Offline(ctx, moduleID, setting.ID); err != nil {
+				return nil, err
+			}
+			return changeOf(productName, schema.EventSettingOffline, map[string]interface{}{"module": moduleName, "setting": settingName})
+		})
+		if err != nil {
 			return nil, err
 		}
 		res.Result = true
+		emitEvent(ctx, b.ms, productID, productName, schema.EventSettingOffline, map[string]interface{}{
+			"module": moduleName, "setting": settingName,
+		})
 	}
 	return res, nil
 }
@@ -154,12 +181,12 @@ func (b *Setting) Assign(ctx context.Context, productName, moduleName, settingNa
 		return nil, err
 	}
 
-	module, err := b.ms.Module.Acquire(ctx, productID, moduleName)
+	moduleID, err := b.ms.Module.AcquireID(ctx, productID, moduleName)
 	if err != nil {
 		return nil, err
 	}
 
-	setting, err := b.ms.Setting.Acquire(ctx, module.ID, settingName)
+	setting, err := b.ms.Setting.Acquire(ctx, moduleID, settingName)
 	if err != nil {
 		return nil, err
 	}
@@ -167,7 +194,25 @@ func (b *Setting) Assign(ctx context.Context, productName, moduleName, settingNa
 	if value != "" && !tpl.StringSliceHas(vals, value) {
 		return nil, gear.ErrBadRequest.WithMsgf("value %s is not in setting", value)
 	}
-	return b.ms.Setting.Assign(ctx, setting.ID, value, users, groups)
+	var res *tpl.SettingReleaseInfo
+	err = withChange(ctx, b.ms, func(ctx context.Context) (*schema.Change, error) {
+		if res, err = b.ms.Setting.Assign(ctx, setting.ID, value, users, groups); err != nil {
+			return nil, err
+		}
+		return changeOf(productName, schema.EventSettingAssigned, map[string]interface{}{
+			"module": moduleName, "setting": settingName, "value": res.Value,
+			"release": res.Release, "users": res.Users, "groups": res.Groups,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	b.ms.StatisticDaily.Incr(productID, schema.MetricAssignments, schema.StatisticKindSetting, setting.ID, int64(len(res.Users)+len(res.Groups)))
+	emitEvent(ctx, b.ms, productID, productName, schema.EventSettingAssigned, map[string]interface{}{
+		"module": moduleName, "setting": settingName, "value": res.Value,
+		"release": res.Release, "users": res.Users, "groups": res.Groups,
+	})
+	return res, nil
 }
 
 // Delete 物理删除配置项
@@ -177,12 +222,12 @@ func (b *Setting) Delete(ctx context.Context, productName, moduleName, settingNa
 		return nil, err
 	}
 
-	module, err := b.ms.Module.Acquire(ctx, productID, moduleName)
+	moduleID, err := b.ms.Module.AcquireID(ctx, productID, moduleName)
 	if err != nil {
 		return nil, err
 	}
 
-	setting, err := b.ms.Setting.FindByName(ctx, module.ID, settingName, "id, `offline_at`")
+	setting, err := b.ms.Setting.FindByName(ctx, moduleID, settingName, "id, `offline_at`")
 	if err != nil {
 		return nil, err
 	}
@@ -192,7 +237,13 @@ func (b *Setting) Delete(ctx context.Context, productName, moduleName, settingNa
 		if setting.OfflineAt == nil {
 			return nil, gear.ErrConflict.WithMsgf("setting %s is not offline", settingName)
 		}
-		if err = b.ms.Setting.Delete(ctx, setting.ID); err != nil {
+		err = withChange(ctx, b.ms, func(ctx context.Context) (*schema.Change, error) {
+			if err := b.ms.Setting.Delete(ctx, setting.ID); err != nil {
+				return nil, err
+			}
+			return changeOf(productName, schema.EventSettingDeleted, map[string]interface{}{"module": moduleName, "setting": settingName})
+		})
+		if err != nil {
 			return nil, err
 		}
 		res.Result = true
@@ -207,21 +258,31 @@ func (b *Setting) Recall(ctx context.Context, productName, moduleName, settingNa
 		return nil, err
 	}
 
-	module, err := b.ms.Module.Acquire(ctx, productID, moduleName)
+	moduleID, err := b.ms.Module.AcquireID(ctx, productID, moduleName)
 	if err != nil {
 		return nil, err
 	}
 
-	setting, err := b.ms.Setting.Acquire(ctx, module.ID, settingName)
+	settingID, err := b.ms.Setting.AcquireID(ctx, moduleID, settingName)
 	if err != nil {
 		return nil, err
 	}
 
 	res := &tpl.BoolRes{Result: false}
-	if err = b.ms.Setting.Recall(ctx, setting.ID, release); err != nil {
+	err = withChange(ctx, b.ms, func(ctx context.Context) (*schema.Change, error) {
+		if err := b.ms.Setting.Recall(ctx, settingID, release); err != nil {
+			return nil, err
+		}
+		return changeOf(productName, schema.EventSettingRecalled, map[string]interface{}{"module": moduleName, "setting": settingName, "release": release})
+	})
+	if err != nil {
 		return nil, err
 	}
 	res.Result = true
+	b.ms.StatisticDaily.Incr(productID, schema.MetricRecalls, schema.StatisticKindSetting, settingID, 1)
+	emitEvent(ctx, b.ms, productID, productName, schema.EventSettingRecalled, map[string]interface{}{
+		"module": moduleName, "setting": settingName, "release": release,
+	})
 	return res, nil
 }
 
@@ -232,21 +293,32 @@ func (b *Setting) Cleanup(ctx context.Context, productName, moduleName, settingN
 		return nil, err
 	}
 
-	module, err := b.ms.Module.Acquire(ctx, productID, moduleName)
+	moduleID, err := b.ms.Module.AcquireID(ctx, productID, moduleName)
 	if err != nil {
 		return nil, err
 	}
 
-	setting, err := b.ms.Setting.Acquire(ctx, module.ID, settingName)
+	settingID, err := b.ms.Setting.AcquireID(ctx, moduleID, settingName)
 	if err != nil {
 		return nil, err
 	}
 
 	res := &tpl.BoolRes{Result: false}
-	if err = b.ms.Setting.Cleanup(ctx, setting.ID); err != nil {
+	snapshotVersion(ctx, b.ms, schema.VersionSetting, settingID)
+	err = withChange(ctx, b.ms, func(ctx context.Context) (*schema.Change, error) {
+		if err := b.ms.Setting.Cleanup(ctx, settingID); err != nil {
+			return nil, err
+		}
+		return changeOf(productName, schema.EventSettingCleanup, map[string]interface{}{"module": moduleName, "setting": settingName})
+	})
+	if err != nil {
 		return nil, err
 	}
+	snapshotVersion(ctx, b.ms, schema.VersionSetting, settingID)
 	res.Result = true
+	emitEvent(ctx, b.ms, productID, productName, schema.EventSettingCleanup, map[string]interface{}{
+		"module": moduleName, "setting": settingName,
+	})
 	return res, nil
 }
 
@@ -257,12 +329,12 @@ func (b *Setting) CreateRule(ctx context.Context, productName, moduleName, setti
 		return nil, err
 	}
 
-	module, err := b.ms.Module.Acquire(ctx, productID, moduleName)
+	moduleID, err := b.ms.Module.AcquireID(ctx, productID, moduleName)
 	if err != nil {
 		return nil, err
 	}
 
-	setting, err := b.ms.Setting.Acquire(ctx, module.ID, settingName)
+	setting, err := b.ms.Setting.Acquire(ctx, moduleID, settingName)
 	if err != nil {
 		return nil, err
 	}
@@ -279,20 +351,34 @@ func (b *Setting) CreateRule(ctx context.Context, productName, moduleName, setti
 		Value:     body.Value,
 		Release:   0,
 	}
-	if err = b.ms.SettingRule.Create(ctx, settingRule); err != nil {
-		return nil, err
-	}
-	// 创建成功再从 setting 获取当前的 release 发布计数
-	release, err := b.ms.Setting.AcquireRelease(ctx, setting.ID)
-	if err != nil {
-		return nil, err
-	}
+	snapshotVersion(ctx, b.ms, schema.VersionSetting, setting.ID)
+	err = withChange(ctx, b.ms, func(ctx context.Context) (*schema.Change, error) {
+		if err := b.ms.SettingRule.Create(ctx, settingRule); err != nil {
+			return nil, err
+		}
+		// 创建成功再从 setting 获取当前的 release 发布计数
+		release, err := b.ms.Setting.AcquireRelease(ctx, setting.ID)
+		if err != nil {
+			return nil, err
+		}
 
-	settingRule, err = b.ms.SettingRule.Update(ctx, settingRule.ID, map[string]interface{}{"rls": release})
+		settingRule, err = b.ms.SettingRule.Update(ctx, settingRule.ID, map[string]interface{}{"rls": release})
+		if err != nil {
+			return nil, err
+		}
+		return changeOf(productName, schema.EventSettingRuleCreated, map[string]interface{}{
+			"module": moduleName, "setting": settingName, "rule": tpl.SettingRuleInfoFrom(*settingRule),
+		})
+	})
 	if err != nil {
 		return nil, err
 	}
-	return &tpl.SettingRuleInfoRes{Result: tpl.SettingRuleInfoFrom(*settingRule)}, nil
+	snapshotVersion(ctx, b.ms, schema.VersionSetting, setting.ID)
+	ruleInfo := tpl.SettingRuleInfoFrom(*settingRule)
+	emitEvent(ctx, b.ms, productID, productName, schema.EventSettingRuleCreated, map[string]interface{}{
+		"module": moduleName, "setting": settingName, "rule": ruleInfo,
+	})
+	return &tpl.SettingRuleInfoRes{Result: ruleInfo}, nil
 }
 
 // ListRules ...
@@ -302,17 +388,17 @@ func (b *Setting) ListRules(ctx context.Context, productName, moduleName, settin
 		return nil, err
 	}
 
-	module, err := b.ms.Module.Acquire(ctx, productID, moduleName)
+	moduleID, err := b.ms.Module.AcquireID(ctx, productID, moduleName)
 	if err != nil {
 		return nil, err
 	}
 
-	setting, err := b.ms.Setting.Acquire(ctx, module.ID, settingName)
+	settingID, err := b.ms.Setting.AcquireID(ctx, moduleID, settingName)
 	if err != nil {
 		return nil, err
 	}
 
-	settingRules, err := b.ms.SettingRule.Find(ctx, productID, setting.ID)
+	settingRules, err := b.ms.SettingRule.Find(ctx, productID, settingID)
 	if err != nil {
 		return nil, err
 	}
@@ -329,12 +415,12 @@ func (b *Setting) UpdateRule(ctx context.Context, productName, moduleName, setti
 		return nil, err
 	}
 
-	module, err := b.ms.Module.Acquire(ctx, productID, moduleName)
+	moduleID, err := b.ms.Module.AcquireID(ctx, productID, moduleName)
 	if err != nil {
 		return nil, err
 	}
 
-	setting, err := b.ms.Setting.Acquire(ctx, module.ID, settingName)
+	setting, err := b.ms.Setting.Acquire(ctx, moduleID, settingName)
 	if err != nil {
 		return nil, err
 	}
@@ -365,15 +451,27 @@ func (b *Setting) UpdateRule(ctx context.Context, productName, moduleName, setti
 	}
 
 	if len(changed) > 0 {
-		release, err := b.ms.Setting.AcquireRelease(ctx, setting.ID)
-		if err != nil {
-			return nil, err
-		}
-		changed["rls"] = release
-		settingRule, err = b.ms.SettingRule.Update(ctx, settingRule.ID, changed)
+		snapshotVersion(ctx, b.ms, schema.VersionSetting, setting.ID)
+		err = withChange(ctx, b.ms, func(ctx context.Context) (*schema.Change, error) {
+			release, err := b.ms.Setting.AcquireRelease(ctx, setting.ID)
+			if err != nil {
+				return nil, err
+			}
+			changed["rls"] = release
+			if settingRule, err = b.ms.SettingRule.Update(ctx, settingRule.ID, changed); err != nil {
+				return nil, err
+			}
+			return changeOf(productName, schema.EventSettingRuleUpdated, map[string]interface{}{
+				"module": moduleName, "setting": settingName, "rule": tpl.SettingRuleInfoFrom(*settingRule),
+			})
+		})
 		if err != nil {
 			return nil, err
 		}
+		snapshotVersion(ctx, b.ms, schema.VersionSetting, setting.ID)
+		emitEvent(ctx, b.ms, productID, productName, schema.EventSettingRuleUpdated, map[string]interface{}{
+			"module": moduleName, "setting": settingName, "rule": tpl.SettingRuleInfoFrom(*settingRule),
+		})
 	}
 
 	return &tpl.SettingRuleInfoRes{Result: tpl.SettingRuleInfoFrom(*settingRule)}, nil
@@ -386,12 +484,12 @@ func (b *Setting) DeleteRule(ctx context.Context, productName, moduleName, setti
 		return nil, err
 	}
 
-	module, err := b.ms.Module.Acquire(ctx, productID, moduleName)
+	moduleID, err := b.ms.Module.AcquireID(ctx, productID, moduleName)
 	if err != nil {
 		return nil, err
 	}
 
-	setting, err := b.ms.Setting.Acquire(ctx, module.ID, settingName)
+	setting, err := b.ms.Setting.Acquire(ctx, moduleID, settingName)
 	if err != nil {
 		return nil, err
 	}
@@ -406,10 +504,25 @@ func (b *Setting) DeleteRule(ctx context.Context, productName, moduleName, setti
 		return nil, gear.ErrNotFound.WithMsgf("setting rule not matched!")
 	}
 
-	rowsAffected, err := b.ms.SettingRule.Delete(ctx, settingRule.ID)
+	snapshotVersion(ctx, b.ms, schema.VersionSetting, setting.ID)
+	var rowsAffected int64
+	err = withChange(ctx, b.ms, func(ctx context.Context) (*schema.Change, error) {
+		if rowsAffected, err = b.ms.SettingRule.Delete(ctx, settingRule.ID); err != nil || rowsAffected == 0 {
+			return nil, err
+		}
+		return changeOf(productName, schema.EventSettingRuleDeleted, map[string]interface{}{
+			"module": moduleName, "setting": settingName, "rule": tpl.SettingRuleInfoFrom(*settingRule),
+		})
+	})
 	if err != nil {
 		return nil, err
 	}
+	if rowsAffected > 0 {
+		snapshotVersion(ctx, b.ms, schema.VersionSetting, setting.ID)
+		emitEvent(ctx, b.ms, productID, productName, schema.EventSettingRuleDeleted, map[string]interface{}{
+			"module": moduleName, "setting": settingName, "rule": tpl.SettingRuleInfoFrom(*settingRule),
+		})
+	}
 	res.Result = rowsAffected > 0
 	return res, nil
 }
@@ -421,17 +534,17 @@ func (b *Setting) ListUsers(ctx context.Context, productName, moduleName, settin
 		return nil, err
 	}
 
-	module, err := b.ms.Module.Acquire(ctx, productID, moduleName)
+	moduleID, err := b.ms.Module.AcquireID(ctx, productID, moduleName)
 	if err != nil {
 		return nil, err
 	}
 
-	setting, err := b.ms.Setting.Acquire(ctx, module.ID, settingName)
+	settingID, err := b.ms.Setting.AcquireID(ctx, moduleID, settingName)
 	if err != nil {
 		return nil, err
 	}
 
-	data, total, err := b.ms.Setting.ListUsers(ctx, setting.ID, pg)
+	data, total, err := b.ms.Setting.ListUsers(ctx, settingID, pg)
 	if err != nil {
 		return nil, err
 	}
@@ -451,12 +564,12 @@ func (b *Setting) RollbackUserSetting(ctx context.Context, productName, moduleNa
 		return nil, err
 	}
 
-	module, err := b.ms.Module.Acquire(ctx, productID, moduleName)
+	moduleID, err := b.ms.Module.AcquireID(ctx, productID, moduleName)
 	if err != nil {
 		return nil, err
 	}
 
-	setting, err := b.ms.Setting.Acquire(ctx, module.ID, settingName)
+	settingID, err := b.ms.Setting.AcquireID(ctx, moduleID, settingName)
 	if err != nil {
 		return nil, err
 	}
@@ -466,7 +579,12 @@ func (b *Setting) RollbackUserSetting(ctx context.Context, productName, moduleNa
 		return nil, err
 	}
 
-	err = b.ms.Setting.RollbackUserSetting(ctx, user.ID, setting.ID)
+	err = withChange(ctx, b.ms, func(ctx context.Context) (*schema.Change, error) {
+		if err := b.ms.Setting.RollbackUserSetting(ctx, user.ID, settingID); err != nil {
+			return nil, err
+		}
+		return changeOf(productName, schema.EventSettingUserRollback, map[string]interface{}{"module": moduleName, "setting": settingName, "user": uid})
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -480,12 +598,12 @@ func (b *Setting) DeleteUser(ctx context.Context, productName, moduleName, setti
 		return nil, err
 	}
 
-	module, err := b.ms.Module.Acquire(ctx, productID, moduleName)
+	moduleID, err := b.ms.Module.AcquireID(ctx, productID, moduleName)
 	if err != nil {
 		return nil, err
 	}
 
-	setting, err := b.ms.Setting.Acquire(ctx, module.ID, settingName)
+	settingID, err := b.ms.Setting.AcquireID(ctx, moduleID, settingName)
 	if err != nil {
 		return nil, err
 	}
@@ -495,7 +613,13 @@ func (b *Setting) DeleteUser(ctx context.Context, productName, moduleName, setti
 		return nil, err
 	}
 
-	rowsAffected, err := b.ms.Setting.RemoveUserSetting(ctx, user.ID, setting.ID)
+	var rowsAffected int64
+	err = withChange(ctx, b.ms, func(ctx context.Context) (*schema.Change, error) {
+		if rowsAffected, err = b.ms.Setting.RemoveUserSetting(ctx, user.ID, settingID); err != nil || rowsAffected == 0 {
+			return nil, err
+		}
+		return changeOf(productName, schema.EventSettingUserRemoved, map[string]interface{}{"module": moduleName, "setting": settingName, "user": uid})
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -509,17 +633,17 @@ func (b *Setting) ListGroups(ctx context.Context, productName, moduleName, setti
 		return nil, err
 	}
 
-	module, err := b.ms.Module.Acquire(ctx, productID, moduleName)
+	moduleID, err := b.ms.Module.AcquireID(ctx, productID, moduleName)
 	if err != nil {
 		return nil, err
 	}
 
-	setting, err := b.ms.Setting.Acquire(ctx, module.ID, settingName)
+	settingID, err := b.ms.Setting.AcquireID(ctx, moduleID, settingName)
 	if err != nil {
 		return nil, err
 	}
 
-	data, total, err := b.ms.Setting.ListGroups(ctx, setting.ID, pg)
+	data, total, err := b.ms.Setting.ListGroups(ctx, settingID, pg)
 	if err != nil {
 		return nil, err
 	}
@@ -539,12 +663,12 @@ func (b *Setting) RollbackGroupSetting(ctx context.Context, productName, moduleN
 		return nil, err
 	}
 
-	module, err := b.ms.Module.Acquire(ctx, productID, moduleName)
+	moduleID, err := b.ms.Module.AcquireID(ctx, productID, moduleName)
 	if err != nil {
 		return nil, err
 	}
 
-	setting, err := b.ms.Setting.Acquire(ctx, module.ID, settingName)
+	settingID, err := b.ms.Setting.AcquireID(ctx, moduleID, settingName)
 	if err != nil {
 		return nil, err
 	}
@@ -554,7 +678,14 @@ func (b *Setting) RollbackGroupSetting(ctx context.Context, productName, moduleN
 		return nil, err
 	}
 
-	err = b.ms.Setting.RollbackGroupSetting(ctx, group.ID, setting.ID)
+	err = withChange(ctx, b.ms, func(ctx context.Context) (*schema.Change, error) {
+		if err := b.ms.Setting.RollbackGroupSetting(ctx, group.ID, settingID); err != nil {
+			return nil, err
+		}
+		return changeOf(productName, schema.EventSettingGroupRollback, map[string]interface{}{
+			"module": moduleName, "setting": settingName, "kind": kind, "group": uid,
+		})
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -568,12 +699,12 @@ func (b *Setting) DeleteGroup(ctx context.Context, productName, moduleName, sett
 		return nil, err
 	}
 
-	module, err := b.ms.Module.Acquire(ctx, productID, moduleName)
+	moduleID, err := b.ms.Module.AcquireID(ctx, productID, moduleName)
 	if err != nil {
 		return nil, err
 	}
 
-	setting, err := b.ms.Setting.Acquire(ctx, module.ID, settingName)
+	settingID, err := b.ms.Setting.AcquireID(ctx, moduleID, settingName)
 	if err != nil {
 		return nil, err
 	}
@@ -583,9 +714,162 @@ func (b *Setting) DeleteGroup(ctx context.Context, productName, moduleName, sett
 		return nil, err
 	}
 
-	rowsAffected, err := b.ms.Setting.RemoveGroupSetting(ctx, group.ID, setting.ID)
+	var rowsAffected int64
+	err = withChange(ctx, b.ms, func(ctx context.Context) (*schema.Change, error) {
+		if rowsAffected, err = b.ms.Setting.RemoveGroupSetting(ctx, group.ID, settingID); err != nil || rowsAffected == 0 {
+			return nil, err
+		}
+		return changeOf(productName, schema.EventSettingGroupRemoved, map[string]interface{}{
+			"module": moduleName, "setting": settingName, "kind": kind, "group": uid,
+		})
+	})
 	if err != nil {
 		return nil, err
 	}
 	return &tpl.BoolRes{Result: rowsAffected > 0}, nil
 }
+
+// ListVersions 返回功能模块配置项定义的版本列表
+func (b *Setting) ListVersions(ctx context.Context, productName, moduleName, settingName string, pg tpl.Pagination) (*tpl.VersionsInfoRes, error) {
+	productID, err := b.ms.Product.AcquireID(ctx, productName)
+	if err != nil {
+		return nil, err
+	}
+
+	moduleID, err := b.ms.Module.AcquireID(ctx, productID, moduleName)
+	if err != nil {
+		return nil, err
+	}
+
+	settingID, err := b.ms.Setting.AcquireID(ctx, moduleID, settingName)
+	if err != nil {
+		return nil, err
+	}
+	return listVersions(ctx, b.ms, schema.VersionSetting, settingID, pg)
+}
+
+// DiffVersions 比较功能模块配置项定义的两个版本
+func (b *Setting) DiffVersions(ctx context.Context, productName, moduleName, settingName string, q tpl.VersionDiffQuery) (*tpl.VersionDiffRes, error) {
+	productID, err := b.ms.Product.AcquireID(ctx, productName)
+	if err != nil {
+		return nil, err
+	}
+
+	moduleID, err := b.ms.Module.AcquireID(ctx, productID, moduleName)
+	if err != nil {
+		return nil, err
+	}
+
+	settingID, err := b.ms.Setting.AcquireID(ctx, moduleID, settingName)
+	if err != nil {
+		return nil, err
+	}
+	return diffVersions(ctx, b.ms, schema.VersionSetting, settingID, q)
+}
+
+// RestoreVersion 把配置项的描述、版本通道、客户端类型、可选值和灰度发布规则恢复到指定版本，并保存为新版本
+func (b *Setting) RestoreVersion(ctx context.Context, productName, moduleName, settingName string, version int64) (*tpl.VersionInfoRes, error) {
+	productID, err := b.ms.Product.AcquireID(ctx, productName)
+	if err != nil {
+		return nil, err
+	}
+
+	moduleID, err := b.ms.Module.AcquireID(ctx, productID, moduleName)
+	if err != nil {
+		return nil, err
+	}
+
+	setting, err := b.ms.Setting.Acquire(ctx, moduleID, settingName)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := b.ms.Version.Acquire(ctx, schema.VersionSetting, setting.ID, version)
+	if err != nil {
+		return nil, err
+	}
+	snapshotVersion(ctx, b.ms, schema.VersionSetting, setting.ID)
+
+	err = withChange(ctx, b.ms, func(ctx context.Context) (*schema.Change, error) {
+		s := v.GetSnapshot()
+		changed := map[string]interface{}{
+			"description": s.Desc,
+			"channels":    strings.Join(s.Channels, ","),
+			"clients":     strings.Join(s.Clients, ","),
+			"vals":        strings.Join(s.Values, ","),
+		}
+		if setting, err = b.ms.Setting.Update(ctx, setting.ID, changed); err != nil {
+			return nil, err
+		}
+
+		settingRules, err := b.ms.SettingRule.Find(ctx, productID, setting.ID)
+		if err != nil {
+			return nil, err
+		}
+		rules := make(map[string]schema.RuleSnapshot, len(s.Rules))
+		for _, r := range s.Rules {
+			rules[r.Kind] = r
+		}
+		for _, settingRule := range settingRules {
+			r, ok := rules[settingRule.Kind]
+			delete(rules, settingRule.Kind)
+			switch {
+			case !ok:
+				if _, err = b.ms.SettingRule.Delete(ctx, settingRule.ID); err != nil {
+					return nil, err
+				}
+			case r.Rule != settingRule.Rule || r.Value != settingRule.Value:
+				release, err := b.ms.Setting.AcquireRelease(ctx, setting.ID)
+				if err != nil {
+					return nil, err
+				}
+				changed := map[string]interface{}{"rule": r.Rule, "value": r.Value, "rls": release}
+				if _, err = b.ms.SettingRule.Update(ctx, settingRule.ID, changed); err != nil {
+					return nil, err
+				}
+			}
+		}
+		for _, r := range s.Rules {
+			if _, ok := rules[r.Kind]; !ok {
+				continue
+			}
+			settingRule := &schema.SettingRule{
+				ProductID: productID,
+				SettingID: setting.ID,
+				Kind:      r.Kind,
+				Rule:      r.Rule,
+				Value:     r.Value,
+				Release:   0,
+			}
+			if err = b.ms.SettingRule.Create(ctx, settingRule); err != nil {
+				return nil, err
+			}
+			// 创建成功再从 setting 获取当前的 release 发布计数
+			release, err := b.ms.Setting.AcquireRelease(ctx, setting.ID)
+			if err != nil {
+				return nil, err
+			}
+			if _, err = b.ms.SettingRule.Update(ctx, settingRule.ID, map[string]interface{}{"rls": release}); err != nil {
+				return nil, err
+			}
+		}
+
+		settingRules, err = b.ms.SettingRule.Find(ctx, productID, setting.ID)
+		if err != nil {
+			return nil, err
+		}
+		return changeOf(productName, schema.EventSettingUpdated, map[string]interface{}{
+			"module": moduleName, "setting": settingName, "definition": tpl.SettingInfoFrom(*setting, productName, moduleName),
+			"rules": tpl.SettingRulesInfoFrom(settingRules), "restored": v.Version,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	restored, err := b.ms.Version.Snapshot(ctx, schema.VersionSetting, setting.ID, v.Version)
+	if err != nil {
+		return nil, err
+	}
+	return &tpl.VersionInfoRes{Result: tpl.VersionInfoFrom(*restored)}, nil
+}
@@ -0,0 +1,130 @@
+package bll
+
+import (
+	"context"
+	"time"
+
+	"github.com/teambition/urbs-setting/src/conf"
+	"github.com/teambition/urbs-setting/src/logging"
+	"github.com/teambition/urbs-setting/src/model"
+	"github.com/teambition/urbs-setting/src/schema"
+	"github.com/teambition/urbs-setting/src/tpl"
+	"github.com/teambition/urbs-setting/src/util"
+)
+
+// Statistic ...
+type Statistic struct {
+	ms *model.Models
+}
+
+// Timeseries 返回产品、环境标签或配置项按天、周或月的时间序列统计
+func (b *Statistic) Timeseries(ctx context.Context, req *tpl.TimeseriesURL) (*tpl.Timeseries, error) {
+	productID, err := b.ms.Product.AcquireID(ctx, req.Product)
+	if err != nil {
+		return nil, err
+	}
+
+	kind, objectID := "", int64(0)
+	switch req.Kind() {
+	case schema.StatisticKindLabel:
+		if objectID, err = b.ms.Label.AcquireID(ctx, productID, req.Label); err != nil {
+			return nil, err
+		}
+		kind = schema.StatisticKindLabel
+	case schema.StatisticKindSetting:
+		moduleID, err := b.ms.Module.AcquireID(ctx, productID, req.Module)
+		if err != nil {
+			return nil, err
+		}
+		if objectID, err = b.ms.Setting.AcquireID(ctx, moduleID, req.Setting); err != nil {
+			return nil, err
+		}
+		kind = schema.StatisticKindSetting
+	}
+
+	daily, err := b.ms.StatisticDaily.FindDaily(ctx, productID, req.Metric, kind, objectID, req.FromDay, req.ToDay)
+	if err != nil {
+		return nil, err
+	}
+	return &tpl.Timeseries{
+		Metric:      req.Metric,
+		Granularity: req.Granularity,
+		From:        req.FromDay.Format("2006-01-02"),
+		To:          req.ToDay.Format("2006-01-02"),
+		Points:      req.Points(daily),
+	}, nil
+}
+
+// Flush 将写操作产生的按天统计计数写入数据库
+func (b *Statistic) Flush(ctx context.Context) error {
+	total, err := b.ms.StatisticDaily.Flush(ctx)
+	if err != nil {
+		logging.Warningf("Statistic: flushed %d daily counters, error %v", total, err)
+	}
+	return err
+}
+
+// StartJob 启动后台任务：定时写入按天统计计数，每天汇总前一天的活跃用户数，ctx 结束时退出。
+// 退出时剩余的计数需要调用 Flush 写入
+func (b *Statistic) StartJob(ctx context.Context) {
+	cfg := conf.Config.Timeseries
+
+	go func() {
+		ticker := time.NewTicker(cfg.FlushIntervalDuration())
+		defer ticker.Stop()
+		rollup := time.NewTimer(time.Until(cfg.NextRollup(time.Now())))
+		defer rollup.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				util.Go(ctx, cfg.FlushIntervalDuration(), func(gctx context.Context) {
+					_ = b.Flush(gctx)
+				})
+			case now := <-rollup.C:
+				rollup.Reset(time.Until(cfg.NextRollup(now)))
+				day := now.UTC().AddDate(0, 0, -1)
+				util.Go(ctx, 10*time.Minute, func(gctx context.Context) {
+					total, err := b.ms.StatisticDaily.RollupActiveUsers(gctx, day)
+					if err != nil {
+						logging.Warningf("Statistic: rollup active users of %s, error %v", day.Format("2006-01-02"), err)
+					} else {
+						logging.Infof("Statistic: rolled up active users of %s, %d rows affected", day.Format("2006-01-02"), total)
+					}
+				})
+			}
+		}
+	}()
+}
+
+// Reconcile 对账环境标签和配置项的精确使用用户数，并重新计算 urbs_statistic 中的对象总数
+func (b *Statistic) Reconcile(ctx context.Context) (int, int, error) {
+	cfg := conf.Config.Reconcile
+	return b.ms.ReconcileStatistics(ctx, cfg.BatchSize, cfg.IntervalDuration())
+}
+
+// StartReconcileJob 启动后台对账任务，ctx 结束时退出
+func (b *Statistic) StartReconcileJob(ctx context.Context) {
+	cfg := conf.Config.Reconcile
+
+	go func() {
+		ticker := time.NewTicker(cfg.IntervalDuration())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				util.Go(ctx, cfg.IntervalDuration(), func(gctx context.Context) {
+					labels, settings, err := b.Reconcile(gctx)
+					if err != nil {
+						logging.Warningf("Reconcile: reconciled %d labels and %d settings, error %v", labels, settings, err)
+					} else {
+						logging.Infof("Reconcile: reconciled %d labels and %d settings", labels, settings)
+					}
+				})
+			}
+		}
+	}()
+}
@@ -2,20 +2,28 @@ package bll
 
 import (
 	"context"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/teambition/gear"
 	"github.com/teambition/urbs-setting/src/conf"
 	"github.com/teambition/urbs-setting/src/logging"
+	"github.com/teambition/urbs-setting/src/metrics"
 	"github.com/teambition/urbs-setting/src/model"
 	"github.com/teambition/urbs-setting/src/schema"
+	"github.com/teambition/urbs-setting/src/service"
 	"github.com/teambition/urbs-setting/src/tpl"
+	"github.com/teambition/urbs-setting/src/tracing"
 	"github.com/teambition/urbs-setting/src/util"
+	"golang.org/x/sync/singleflight"
 )
 
 // User ...
 type User struct {
-	ms *model.Models
+	ms       *model.Models
+	exposure *service.Exposure
 }
 
 // List 返回用户列表
@@ -60,50 +68,119 @@ func (b *User) ListCachedLabels(ctx context.Context, uid, product string) *tpl.C
 		if strings.HasPrefix(uid, "anon-") {
 			if labels, err := b.ms.LabelRule.ApplyRulesToAnonymous(ctx, uid, productID, schema.RuleUserPercent); err == nil {
 				res.Result = labels
+				b.emitLabelExposures(uid, product, labels)
 			}
 		}
 		return res
 	}
 
-	activeAt := user.GetCache(product).ActiveAt
-	// user 上缓存的 labels 过期，则刷新获取最新，RefreshUser 要考虑并发场景
+	var activeAt int64
+	userCache := &schema.UserCache{Labels: []schema.UserCacheLabel{}}
+	if cache, err := b.ms.User.FindLabelCache(readCtx, user.ID, productID); err != nil {
+		logging.Warningf("FindLabelCache: userID %d, productID %d, error %v", user.ID, productID, err)
+	} else if cache != nil {
+		activeAt = cache.ActiveAt
+		userCache = cache.ToUserCache()
+	}
+
+	// user 在该产品下缓存的 labels 过期，则刷新获取最新，同一进程内相同 user 和产品的并发刷新会被合并
 	if activeAt == 0 {
-		if user = b.ms.TryApplyLabelRulesAndRefreshUserLabels(ctx, productID, product, user.ID, now, true); user == nil {
+		metrics.LabelCache.WithLabelValues("sync_refresh").Inc()
+		if userCache = b.refreshCachedLabels(ctx, productID, user.ID, now, true); userCache == nil {
 			return res
 		}
 	} else if conf.Config.IsCacheLabelExpired(now.Unix()-5, activeAt) { // 提前 5s 异步处理
 		if conf.Config.IsCacheLabelDoubleExpired(now.Unix(), activeAt) { // 大于等于 2 倍过期时间的缓存，同步等待结果。
-			if user = b.ms.TryApplyLabelRulesAndRefreshUserLabels(ctx, productID, product, user.ID, now, false); user == nil {
+			metrics.LabelCache.WithLabelValues("sync_refresh").Inc()
+			if userCache = b.refreshCachedLabels(ctx, productID, user.ID, now, false); userCache == nil {
 				return res
 			}
 		} else {
-			util.Go(10*time.Second, func(gctx context.Context) {
-				b.ms.TryApplyLabelRulesAndRefreshUserLabels(gctx, productID, product, user.ID, now, false)
-			})
+			metrics.LabelCache.WithLabelValues("async_refresh").Inc()
+			b.tryRefreshCachedLabelsAsync(ctx, productID, user.ID, now)
 		}
+	} else {
+		metrics.LabelCache.WithLabelValues("hit").Inc()
 	}
-	userCache := user.GetCache(product)
 
 	res.Result = userCache.Labels
 	res.Timestamp = userCache.ActiveAt
+	b.emitLabelExposures(uid, product, res.Result)
 	return res
 }
 
+// labelsRefreshing 合并同一进程内对相同 user 和产品的并发 labels 缓存刷新
+var labelsRefreshing = &singleflight.Group{}
+
+// labelsAsyncRefreshing 记录同一进程内正在后台刷新 labels 缓存的 user 和产品
+var labelsAsyncRefreshing sync.Map
+
+// labelsRefreshSem 限制同一进程内后台 labels 缓存刷新的并发数
+var labelsRefreshSem = util.NewSemaphore(conf.Config.CacheLabelRefreshLimit)
+
+func labelsRefreshKey(productID, userID int64) string {
+	return strconv.FormatInt(userID, 10) + ":" + strconv.FormatInt(productID, 10)
+}
+
+// refreshCachedLabels 同步刷新 user 在该产品下的 labels 缓存，并发的调用方等待并共享同一次刷新的结果。
+// 刷新不使用发起请求的 ctx，避免其取消时导致其它等待的调用方失败
+func (b *User) refreshCachedLabels(ctx context.Context, productID, userID int64, now time.Time, force bool) *schema.UserCache {
+	val, _, _ := labelsRefreshing.Do(labelsRefreshKey(productID, userID), func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(tracing.Detach(ctx), 10*time.Second)
+		defer cancel()
+		return b.ms.TryApplyLabelRulesAndRefreshUserLabels(ctx, productID, userID, now, force), nil
+	})
+	userCache, _ := val.(*schema.UserCache)
+	return userCache
+}
+
+// tryRefreshCachedLabelsAsync 后台刷新 user 在该产品下的 labels 缓存，
+// 相同 user 和产品已在刷新中，或后台刷新数已达上限时跳过，由后续请求再次触发
+func (b *User) tryRefreshCachedLabelsAsync(ctx context.Context, productID, userID int64, now time.Time) {
+	key := labelsRefreshKey(productID, userID)
+	if _, loaded := labelsAsyncRefreshing.LoadOrStore(key, struct{}{}); loaded {
+		return
+	}
+	if !labelsRefreshSem.TryAcquire() {
+		labelsAsyncRefreshing.Delete(key)
+		return
+	}
+	util.Go(ctx, 10*time.Second, func(gctx context.Context) {
+		defer labelsAsyncRefreshing.Delete(key)
+		defer labelsRefreshSem.Release()
+		labelsRefreshing.Do(key, func() (interface{}, error) {
+			return b.ms.TryApplyLabelRulesAndRefreshUserLabels(gctx, productID, userID, now, false), nil
+		})
+	})
+}
+
 // RefreshCachedLabels ...
 func (b *User) RefreshCachedLabels(ctx context.Context, product, uid string) (*schema.User, error) {
 	user, err := b.ms.User.Acquire(ctx, uid)
 	if err != nil {
 		return nil, err
 	}
-	readCtx := context.WithValue(ctx, model.ReadDB, true)
-	var productID int64 = 0
-	if product != "" {
-		productID, err = b.ms.Product.AcquireID(readCtx, product)
+
+	now := time.Now().UTC()
+	var data schema.UserCacheLabelMap
+	if product == "" {
+		data, err = b.ms.ApplyLabelRulesAndRefreshAllUserLabels(ctx, user.ID, now)
+	} else {
+		readCtx := context.WithValue(ctx, model.ReadDB, true)
+		productID, err := b.ms.Product.AcquireID(readCtx, product)
 		if err != nil {
 			return nil, err
 		}
+		if _, err = b.ms.ApplyLabelRulesAndRefreshUserLabels(ctx, productID, user.ID, now, true); err != nil {
+			return nil, err
+		}
+		data, err = b.ms.User.FindLabelCacheMap(ctx, user.ID)
 	}
-	if user, err = b.ms.ApplyLabelRulesAndRefreshUserLabels(ctx, productID, product, user.ID, time.Now().UTC(), true); err != nil {
+	if err != nil {
+		return nil, err
+	}
+	user.ActiveAt = now.Unix()
+	if err = user.PutCacheMap(data); err != nil {
 		return nil, err
 	}
 	return user, nil
@@ -198,6 +275,7 @@ func (b *User) ListSettingsUnionAll(ctx context.Context, req tpl.MySettingsQuery
 					settings[i].Product = req.Product
 				}
 				res.Result = settings
+				b.emitSettingExposures(req.UID, res.Result)
 			}
 		}
 		return res, nil
@@ -229,9 +307,10 @@ func (b *User) ListSettingsUnionAll(ctx context.Context, req tpl.MySettingsQuery
 	for i := range settings {
 		settings[i].Product = req.Product
 	}
-	if pg.PageToken == "" { // 请求首页时尝试应用 SettingRules
-		util.Go(10*time.Second, func(gctx context.Context) {
+	if pg.PageToken == "" { // 请求首页时尝试应用 SettingRules，并更新最近活跃时间
+		util.Go(ctx, 10*time.Second, func(gctx context.Context) {
 			b.ms.TryApplySettingRules(gctx, productID, user.ID)
+			b.ms.User.TouchActiveAt(gctx, user, time.Now().Unix())
 		})
 	}
 
@@ -240,9 +319,55 @@ func (b *User) ListSettingsUnionAll(ctx context.Context, req tpl.MySettingsQuery
 		res.NextPageToken = tpl.TimeToPageToken(res.Result[pg.PageSize].AssignedAt)
 		res.Result = res.Result[:pg.PageSize]
 	}
+	b.emitSettingExposures(req.UID, res.Result)
 	return res, nil
 }
 
+// emitLabelExposures 记录用户实际获取到的环境标签，不阻塞请求
+func (b *User) emitLabelExposures(uid, product string, labels []schema.UserCacheLabel) {
+	if !b.exposure.Enabled() || len(labels) == 0 {
+		return
+	}
+	ts := time.Now().UnixNano() / int64(time.Millisecond)
+	events := make([]schema.Exposure, 0, len(labels))
+	for _, l := range labels {
+		events = append(events, schema.Exposure{
+			Kind:      schema.ExposureLabel,
+			UID:       uid,
+			Product:   product,
+			Label:     l.Label,
+			Timestamp: ts,
+		})
+	}
+	b.exposure.Emit(events...)
+}
+
+// emitSettingExposures 记录用户实际获取到的配置项值，不阻塞请求
+func (b *User) emitSettingExposures(uid string, settings []tpl.MySetting) {
+	if !b.exposure.Enabled() || len(settings) == 0 {
+		return
+	}
+	ts := time.Now().UnixNano() / int64(time.Millisecond)
+	events := make([]schema.Exposure, 0, len(settings))
+	for _, s := range settings {
+		ev := schema.Exposure{
+			Kind:      schema.ExposureSetting,
+			UID:       uid,
+			Product:   s.Product,
+			Module:    s.Module,
+			Setting:   s.Name,
+			Value:     s.Value,
+			Release:   s.Release,
+			Timestamp: ts,
+		}
+		if s.RuleID > 0 {
+			ev.Rule = service.IDToHID(s.RuleID, "setting_rule")
+		}
+		events = append(events, ev)
+	}
+	b.exposure.Emit(events...)
+}
+
 // CheckExists ...
 func (b *User) CheckExists(ctx context.Context, uid string) bool {
 	user, _ := b.ms.User.FindByUID(context.WithValue(ctx, model.ReadDB, true), uid, "id")
@@ -279,3 +404,62 @@ func (b *User) ApplyRules(ctx context.Context, product string, body *tpl.ApplyRu
 	}
 	return err
 }
+
+// PurgeReport 返回不活跃用户清理的预览报告（dry-run），不会修改任何数据
+func (b *User) PurgeReport(ctx context.Context, retention string) (*tpl.UsersPurgeInfoRes, error) {
+	cfg := conf.Config.UserPurge
+	du := cfg.RetentionDuration()
+	if retention != "" {
+		du, _ = time.ParseDuration(retention)
+	} else if !cfg.Enabled() {
+		return nil, gear.ErrBadRequest.WithMsg("user purge is disabled, retention required")
+	}
+
+	info, err := b.ms.User.CountInactive(ctx, time.Now().UTC().Add(-du), 10)
+	if err != nil {
+		return nil, err
+	}
+	info.Enabled = cfg.Enabled()
+	info.Archive = cfg.Archive
+	info.Retention = du.String()
+	return &tpl.UsersPurgeInfoRes{Result: *info}, nil
+}
+
+// PurgeInactive 按配置分批清理不活跃的用户
+func (b *User) PurgeInactive(ctx context.Context) (int64, error) {
+	cfg := conf.Config.UserPurge
+	if !cfg.Enabled() {
+		return 0, nil
+	}
+
+	before := time.Now().UTC().Add(-cfg.RetentionDuration())
+	return b.ms.PurgeInactiveUsers(ctx, before, cfg.BatchSize, cfg.Archive, cfg.IntervalDuration())
+}
+
+// StartPurgeJob 启动后台不活跃用户清理任务，ctx 结束时退出
+func (b *User) StartPurgeJob(ctx context.Context) {
+	cfg := conf.Config.UserPurge
+	if !cfg.Enabled() {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(cfg.IntervalDuration())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				util.Go(ctx, cfg.IntervalDuration(), func(gctx context.Context) {
+					total, err := b.PurgeInactive(gctx)
+					if err != nil {
+						logging.Warningf("PurgeInactive: purged %d users, error %v", total, err)
+					} else if total > 0 {
+						logging.Infof("PurgeInactive: purged %d users", total)
+					}
+				})
+			}
+		}
+	}()
+}
@@ -2,9 +2,11 @@ package bll
 
 import (
 	"context"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/doug-martin/goqu/v9"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/teambition/urbs-setting/src/model"
@@ -14,8 +16,8 @@ import (
 )
 
 func TestUsers(t *testing.T) {
-	user := &User{ms: model.NewModels(service.NewDB())}
-	product := &Product{ms: model.NewModels(service.NewDB())}
+	user := &User{ms: model.NewModels(service.NewDB(), service.NewCache())}
+	product := &Product{ms: model.NewModels(service.NewDB(), service.NewCache())}
 
 	t.Run("newUserPercent should work with apply setting rule", func(t *testing.T) {
 		assert := assert.New(t)
@@ -109,8 +111,8 @@ func TestUsers(t *testing.T) {
 
 func TestChildLabelUserPercent(t *testing.T) {
 
-	user := &User{ms: model.NewModels(service.NewDB())}
-	product := &Product{ms: model.NewModels(service.NewDB())}
+	user := &User{ms: model.NewModels(service.NewDB(), service.NewCache())}
+	product := &Product{ms: model.NewModels(service.NewDB(), service.NewCache())}
 
 	t.Run("childLabelUserPercen should work with apply rule", func(t *testing.T) {
 		assert := assert.New(t)
@@ -163,15 +165,15 @@ func TestChildLabelUserPercent(t *testing.T) {
 		err = user.ms.LabelRule.Create(ctx, labelRule2)
 		assert.Nil(err)
 
-		userRes, err := user.ms.ApplyLabelRulesAndRefreshUserLabels(ctx, productRes.Result.ID, productName, userObj.ID, time.Now().UTC(), true)
+		userRes, err := user.ms.ApplyLabelRulesAndRefreshUserLabels(ctx, productRes.Result.ID, userObj.ID, time.Now().UTC(), true)
 		require.Nil(err)
-		userLabels := userRes.GetLabels(productName)
+		userLabels := userRes.Labels
 		assert.True(len(userLabels) == 1)
 		assert.Equal(labelRes.Name, userLabels[0].Label)
 
-		userRes, err = user.ms.ApplyLabelRulesAndRefreshUserLabels(ctx, productRes.Result.ID, productName, userObj.ID, time.Now().UTC(), true)
+		userRes, err = user.ms.ApplyLabelRulesAndRefreshUserLabels(ctx, productRes.Result.ID, userObj.ID, time.Now().UTC(), true)
 		assert.Nil(err)
-		userLabels = userRes.GetLabels(productName)
+		userLabels = userRes.Labels
 		assert.True(len(userLabels) == 2)
 		assert.Equal(labelRes2.Name, userLabels[0].Label)
 		assert.Equal(labelRes.Name, userLabels[1].Label)
@@ -179,8 +181,8 @@ func TestChildLabelUserPercent(t *testing.T) {
 }
 
 func TestUserListCachedLabels(t *testing.T) {
-	user := &User{ms: model.NewModels(service.NewDB())}
-	product := &Product{ms: model.NewModels(service.NewDB())}
+	user := &User{ms: model.NewModels(service.NewDB(), service.NewCache())}
+	product := &Product{ms: model.NewModels(service.NewDB(), service.NewCache())}
 
 	require := require.New(t)
 	ctx := context.Background()
@@ -223,3 +225,97 @@ func TestUserListCachedLabels(t *testing.T) {
 		require.Equal(res1.Timestamp, res2.Timestamp)
 	}
 }
+
+func TestUserListCachedLabelsConcurrently(t *testing.T) {
+	user := &User{ms: model.NewModels(service.NewDB(), service.NewCache())}
+	product := &Product{ms: model.NewModels(service.NewDB(), service.NewCache())}
+
+	require := require.New(t)
+	ctx := context.Background()
+
+	uid1 := tpl.RandUID()
+	user.BatchAdd(ctx, []string{uid1})
+	productName := tpl.RandName()
+	productRes, err := product.Create(ctx, productName, productName)
+	require.Nil(err)
+
+	label := &schema.Label{ProductID: productRes.Result.ID, Name: tpl.RandName()}
+	require.Nil(user.ms.Label.Create(ctx, label))
+	_, err = user.ms.Label.Assign(ctx, label.ID, []string{uid1}, []*tpl.GroupKindUID{})
+	require.Nil(err)
+
+	var wg sync.WaitGroup
+	results := make([]*tpl.CacheLabelsInfoRes, 20)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = user.ListCachedLabels(ctx, uid1, productName)
+		}(i)
+	}
+	wg.Wait()
+
+	for _, res := range results {
+		require.Equal(1, len(res.Result))
+		require.Equal(label.Name, res.Result[0].Label)
+	}
+	require.Equal(0, labelsRefreshSem.InUse())
+}
+
+func TestUserPurgeInactive(t *testing.T) {
+	user := &User{ms: model.NewModels(service.NewDB(), service.NewCache())}
+	product := &Product{ms: model.NewModels(service.NewDB(), service.NewCache())}
+
+	require := require.New(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	uid1 := tpl.RandUID()
+	uid2 := tpl.RandUID()
+	_, err := user.ms.Model.DB.Insert(schema.TableUser).Rows(
+		goqu.Record{"uid": uid1, "created_at": now.Add(-48 * time.Hour), "active_at": now.Add(-48 * time.Hour).Unix()},
+		goqu.Record{"uid": uid2, "created_at": now.Add(-48 * time.Hour), "active_at": now.Unix()},
+	).Executor().ExecContext(ctx)
+	require.Nil(err)
+	userObj, err := user.ms.User.Acquire(ctx, uid1)
+	require.Nil(err)
+
+	productName := tpl.RandName()
+	productRes, err := product.Create(ctx, productName, productName)
+	require.Nil(err)
+	label := &schema.Label{
+		ProductID: productRes.Result.ID,
+		Name:      tpl.RandName(),
+	}
+	require.Nil(user.ms.Label.Create(ctx, label))
+	labelRes, err := user.ms.Label.Acquire(ctx, productRes.Result.ID, label.Name)
+	require.Nil(err)
+	_, err = user.ms.Label.Assign(ctx, labelRes.ID, []string{uid1}, []*tpl.GroupKindUID{})
+	require.Nil(err)
+
+	before := now.Add(-24 * time.Hour)
+	info, err := user.ms.User.CountInactive(ctx, before, 10)
+	require.Nil(err)
+	require.True(info.Users >= 1)
+	require.True(tpl.StringSliceHas(info.Samples, uid1) || info.Users > 10)
+	require.False(tpl.StringSliceHas(info.Samples, uid2))
+
+	_, err = user.ms.PurgeInactiveUsers(ctx, before, 100, true, time.Second)
+	require.Nil(err)
+
+	_, err = user.ms.User.Acquire(ctx, uid1)
+	require.NotNil(err)
+	_, err = user.ms.User.Acquire(ctx, uid2)
+	require.Nil(err)
+
+	count, err := user.ms.Model.DB.From(schema.TableUserLabel).Where(goqu.C("user_id").Eq(userObj.ID)).CountContext(ctx)
+	require.Nil(err)
+	require.Equal(int64(0), count)
+
+	archive := &schema.UserArchive{}
+	ok, err := user.ms.Model.DB.From(schema.TableUserArchive).Where(goqu.C("uid").Eq(uid1)).ScanStructContext(ctx, archive)
+	require.Nil(err)
+	require.True(ok)
+	require.Equal(userObj.ID, archive.UserID)
+	require.Contains(archive.Data, `"LabelID":`)
+}
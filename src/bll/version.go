@@ -0,0 +1,51 @@
+package bll
+
+import (
+	"context"
+
+	"github.com/teambition/urbs-setting/src/logging"
+	"github.com/teambition/urbs-setting/src/model"
+	"github.com/teambition/urbs-setting/src/tpl"
+)
+
+// snapshotVersion 保存环境标签或配置项当前定义的版本快照，失败时只记录日志，不影响已完成的写操作。
+// 变更前也应调用一次，以便补全历史数据或外部变更产生的基线版本
+func snapshotVersion(ctx context.Context, ms *model.Models, kind string, objectID int64) {
+	if _, err := ms.Version.Snapshot(ctx, kind, objectID, 0); err != nil {
+		logging.Warningf("snapshotVersion: %s %d, error %v", kind, objectID, err)
+	}
+}
+
+// listVersions 返回环境标签或配置项的版本列表
+func listVersions(ctx context.Context, ms *model.Models, kind string, objectID int64, pg tpl.Pagination) (*tpl.VersionsInfoRes, error) {
+	versions, total, err := ms.Version.Find(context.WithValue(ctx, model.ReadDB, true), kind, objectID, pg)
+	if err != nil {
+		return nil, err
+	}
+	res := &tpl.VersionsInfoRes{Result: tpl.VersionsInfoFrom(versions)}
+	res.TotalSize = total
+	if len(res.Result) > pg.PageSize {
+		res.NextPageToken = tpl.IDToPageToken(res.Result[pg.PageSize].ID)
+		res.Result = res.Result[:pg.PageSize]
+	}
+	return res, nil
+}
+
+// diffVersions 比较环境标签或配置项的两个版本，to 为 0 时与最新版本比较
+func diffVersions(ctx context.Context, ms *model.Models, kind string, objectID int64, q tpl.VersionDiffQuery) (*tpl.VersionDiffRes, error) {
+	from, err := ms.Version.Acquire(ctx, kind, objectID, q.From)
+	if err != nil {
+		return nil, err
+	}
+	to, err := ms.Version.Acquire(ctx, kind, objectID, q.To)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &tpl.VersionDiffRes{Result: tpl.VersionDiff{
+		From:    from.Version,
+		To:      to.Version,
+		Changes: from.GetSnapshot().Diff(to.GetSnapshot()),
+	}}
+	return res, nil
+}
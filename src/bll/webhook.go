@@ -0,0 +1,255 @@
+package bll
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/teambition/gear"
+	"github.com/teambition/urbs-setting/src/conf"
+	"github.com/teambition/urbs-setting/src/logging"
+	"github.com/teambition/urbs-setting/src/model"
+	"github.com/teambition/urbs-setting/src/schema"
+	"github.com/teambition/urbs-setting/src/service"
+	"github.com/teambition/urbs-setting/src/tpl"
+	"github.com/teambition/urbs-setting/src/util"
+)
+
+// Webhook ...
+type Webhook struct {
+	ms *model.Models
+}
+
+// List 返回产品下的 webhook 订阅列表
+func (b *Webhook) List(ctx context.Context, productName string) (*tpl.WebhooksInfoRes, error) {
+	productID, err := b.ms.Product.AcquireID(ctx, productName)
+	if err != nil {
+		return nil, err
+	}
+
+	webhooks, err := b.ms.Webhook.Find(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+	res := &tpl.WebhooksInfoRes{Result: tpl.WebhooksInfoFrom(webhooks, productName)}
+	res.TotalSize = len(webhooks)
+	return res, nil
+}
+
+// Create 创建 webhook 订阅
+func (b *Webhook) Create(ctx context.Context, productName string, body *tpl.WebhookBody) (*tpl.WebhookInfoRes, error) {
+	productID, err := b.ms.Product.AcquireID(ctx, productName)
+	if err != nil {
+		return nil, err
+	}
+
+	webhook := &schema.Webhook{
+		ProductID: productID,
+		URL:       body.URL,
+		Events:    strings.Join(body.Events, ","),
+		Secret:    body.Secret,
+	}
+	if err = b.ms.Webhook.Create(ctx, webhook); err != nil {
+		return nil, err
+	}
+	return &tpl.WebhookInfoRes{Result: tpl.WebhookInfoFrom(*webhook, productName)}, nil
+}
+
+// Update ...
+func (b *Webhook) Update(ctx context.Context, productName string, webhookID int64, body tpl.WebhookUpdateBody) (*tpl.WebhookInfoRes, error) {
+	webhook, err := b.acquire(ctx, productName, webhookID)
+	if err != nil {
+		return nil, err
+	}
+
+	webhook, err = b.ms.Webhook.Update(ctx, webhook.ID, body.ToMap())
+	if err != nil {
+		return nil, err
+	}
+	return &tpl.WebhookInfoRes{Result: tpl.WebhookInfoFrom(*webhook, productName)}, nil
+}
+
+// Delete 删除 webhook 订阅及其投递记录
+func (b *Webhook) Delete(ctx context.Context, productName string, webhookID int64) (*tpl.BoolRes, error) {
+	webhook, err := b.acquire(ctx, productName, webhookID)
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := b.ms.Webhook.Delete(ctx, webhook.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &tpl.BoolRes{Result: rowsAffected > 0}, nil
+}
+
+// ListDeliveries 返回 webhook 的投递记录
+func (b *Webhook) ListDeliveries(ctx context.Context, productName string, webhookID int64, pg tpl.Pagination) (*tpl.WebhookDeliveriesInfoRes, error) {
+	webhook, err := b.acquire(ctx, productName, webhookID)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries, total, err := b.ms.Webhook.FindDeliveries(ctx, webhook.ID, pg)
+	if err != nil {
+		return nil, err
+	}
+	res := &tpl.WebhookDeliveriesInfoRes{Result: tpl.WebhookDeliveriesInfoFrom(deliveries)}
+	res.TotalSize = total
+	if len(res.Result) > pg.PageSize {
+		res.NextPageToken = tpl.IDToPageToken(res.Result[pg.PageSize].ID)
+		res.Result = res.Result[:pg.PageSize]
+	}
+	return res, nil
+}
+
+// Redeliver 重新投递指定的投递记录，立即投递一次，失败则按退避策略重试
+func (b *Webhook) Redeliver(ctx context.Context, productName string, webhookID, deliveryID int64) (*tpl.WebhookDeliveryInfoRes, error) {
+	webhook, err := b.acquire(ctx, productName, webhookID)
+	if err != nil {
+		return nil, err
+	}
+
+	delivery, err := b.ms.Webhook.AcquireDelivery(ctx, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	if delivery.WebhookID != webhook.ID {
+		return nil, gear.ErrNotFound.WithMsgf("webhook delivery not matched!")
+	}
+
+	if _, err = b.ms.Webhook.ResetDelivery(ctx, delivery.ID); err != nil {
+		return nil, err
+	}
+	deliverWebhook(ctx, b.ms, delivery.ID)
+	if delivery, err = b.ms.Webhook.AcquireDelivery(ctx, delivery.ID); err != nil {
+		return nil, err
+	}
+	return &tpl.WebhookDeliveryInfoRes{Result: tpl.WebhookDeliveryInfoFrom(*delivery)}, nil
+}
+
+// StartDeliveryJob 启动后台重试任务，定期投递已到重试时间的记录，ctx 结束时退出
+func (b *Webhook) StartDeliveryJob(ctx context.Context) {
+	cfg := conf.Config.Webhook
+	var running int32
+	go func() {
+		ticker := time.NewTicker(cfg.IntervalDuration())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				// 上一轮还未结束时跳过
+				if !atomic.CompareAndSwapInt32(&running, 0, 1) {
+					continue
+				}
+				util.Go(ctx, 10*time.Minute, func(gctx context.Context) {
+					defer atomic.StoreInt32(&running, 0)
+					ids, err := b.ms.Webhook.FindDueDeliveryIDs(gctx, 100)
+					if err != nil {
+						logging.Warningf("WebhookDelivery: find due deliveries error %v", err)
+						return
+					}
+					for _, id := range ids {
+						deliverWebhook(gctx, b.ms, id)
+					}
+				})
+			}
+		}
+	}()
+}
+
+func (b *Webhook) acquire(ctx context.Context, productName string, webhookID int64) (*schema.Webhook, error) {
+	productID, err := b.ms.Product.AcquireID(ctx, productName)
+	if err != nil {
+		return nil, err
+	}
+
+	webhook, err := b.ms.Webhook.Acquire(ctx, webhookID)
+	if err != nil {
+		return nil, err
+	}
+	if webhook.ProductID != productID {
+		return nil, gear.ErrNotFound.WithMsgf("webhook not matched!")
+	}
+	return webhook, nil
+}
+
+// emitEvent 在写操作完成后异步生成产品下订阅了该事件的 webhook 投递记录并投递，
+// 失败的投递由后台重试任务按退避策略重试
+func emitEvent(ctx context.Context, ms *model.Models, productID int64, productName, event string, data interface{}) {
+	payload, err := json.Marshal(tpl.WebhookEvent{
+		Event:     event,
+		Product:   productName,
+		Data:      data,
+		Timestamp: time.Now().Unix(),
+	})
+	if err != nil {
+		logging.Warningf("emitEvent: %s, error %v", event, err)
+		return
+	}
+
+	util.Go(ctx, time.Minute, func(gctx context.Context) {
+		webhooks, err := ms.Webhook.FindByEvent(gctx, productID, event)
+		if err != nil {
+			logging.Warningf("emitEvent: %s, error %v", event, err)
+			return
+		}
+		for _, webhook := range webhooks {
+			delivery := &schema.WebhookDelivery{WebhookID: webhook.ID, Event: event, Payload: string(payload)}
+			if err := ms.Webhook.CreateDelivery(gctx, delivery); err != nil {
+				logging.Warningf("emitEvent: %s, webhook %d, error %v", event, webhook.ID, err)
+				continue
+			}
+			deliverWebhook(gctx, ms, delivery.ID)
+		}
+	})
+}
+
+// deliverWebhook 抢占并投递一条待投递记录，记录结果；失败时按退避策略安排下次重试，超过最大次数则标记为失败
+func deliverWebhook(ctx context.Context, ms *model.Models, deliveryID int64) {
+	cfg := conf.Config.Webhook
+	ok, err := ms.Webhook.ClaimDelivery(ctx, deliveryID, 2*cfg.TimeoutDuration())
+	if err != nil || !ok {
+		return
+	}
+
+	delivery, err := ms.Webhook.AcquireDelivery(ctx, deliveryID)
+	if err != nil {
+		logging.Warningf("deliverWebhook: delivery %d, error %v", deliveryID, err)
+		return
+	}
+	changed := map[string]interface{}{"attempts": delivery.Attempts + 1}
+	webhook, err := ms.Webhook.Acquire(ctx, delivery.WebhookID)
+	if err == nil {
+		changed["code"], err = service.PostWebhook(ctx, webhook.URL, webhook.Secret, delivery.Event,
+			service.IDToHID(delivery.ID, "webhook_delivery"), []byte(delivery.Payload), cfg.TimeoutDuration())
+	}
+
+	now := time.Now().UTC()
+	switch {
+	case err == nil:
+		changed["status"] = schema.WebhookDeliverySucceeded
+		changed["message"] = ""
+		changed["delivered_at"] = now
+	case delivery.Attempts+1 >= cfg.MaxAttempts || webhook == nil:
+		changed["status"] = schema.WebhookDeliveryFailed
+		changed["message"] = truncateMessage(err.Error())
+	default:
+		changed["message"] = truncateMessage(err.Error())
+		changed["next_at"] = now.Add(cfg.RetryDelayAfter(delivery.Attempts + 1))
+	}
+	if err := ms.Webhook.UpdateDelivery(ctx, delivery.ID, changed); err != nil {
+		logging.Warningf("deliverWebhook: delivery %d, error %v", deliveryID, err)
+	}
+}
+
+func truncateMessage(msg string) string {
+	if len(msg) > 1022 {
+		return msg[:1022]
+	}
+	return msg
+}
@@ -2,6 +2,8 @@ package conf
 
 import (
 	"context"
+	"fmt"
+	"net"
 	"time"
 
 	otgo "github.com/open-trust/ot-go-lib"
@@ -42,23 +44,752 @@ type OpenTrust struct {
 	DomainPublicKeys []string  `json:"domain_public_keys" yaml:"domain_public_keys"`
 }
 
+// UserPurge 不活跃用户清理配置
+type UserPurge struct {
+	Retention string `json:"retention" yaml:"retention"`   // 用户不活跃的保留时长，如 "4320h"，为空则不清理
+	Interval  string `json:"interval" yaml:"interval"`     // 后台清理任务执行间隔，默认 1h
+	BatchSize int    `json:"batch_size" yaml:"batch_size"` // 每批清理的用户数，默认 500
+	Archive   bool   `json:"archive" yaml:"archive"`       // 删除前是否归档到 urbs_user_archive 表
+	retention time.Duration
+	interval  time.Duration
+}
+
+// Validate ...
+func (c *UserPurge) Validate() error {
+	if c.Retention != "" {
+		du, err := time.ParseDuration(c.Retention)
+		if err != nil {
+			return err
+		}
+		if du < 24*time.Hour {
+			du = 24 * time.Hour
+		}
+		c.retention = du
+	}
+	c.interval = time.Hour
+	if c.Interval != "" {
+		du, err := time.ParseDuration(c.Interval)
+		if err != nil {
+			return err
+		}
+		if du >= time.Minute {
+			c.interval = du
+		}
+	}
+	if c.BatchSize <= 0 || c.BatchSize > 5000 {
+		c.BatchSize = 500
+	}
+	return nil
+}
+
+// Enabled 是否开启不活跃用户清理
+func (c *UserPurge) Enabled() bool {
+	return c.retention > 0
+}
+
+// RetentionDuration 返回用户不活跃的保留时长
+func (c *UserPurge) RetentionDuration() time.Duration {
+	return c.retention
+}
+
+// IntervalDuration 返回后台清理任务执行间隔
+func (c *UserPurge) IntervalDuration() time.Duration {
+	return c.interval
+}
+
+// AuditLog 审计日志配置
+type AuditLog struct {
+	Retention string `json:"retention" yaml:"retention"` // 审计日志保留时长，如 "2160h"，为空则永久保留
+	Interval  string `json:"interval" yaml:"interval"`   // 后台清理过期审计日志的执行间隔，默认 1h
+	retention time.Duration
+	interval  time.Duration
+}
+
+// Validate ...
+func (c *AuditLog) Validate() error {
+	var err error
+	if c.retention, err = parseDuration(c.Retention, 0); err != nil {
+		return err
+	}
+	if c.retention > 0 && c.retention < 24*time.Hour {
+		c.retention = 24 * time.Hour
+	}
+	if c.interval, err = parseDuration(c.Interval, time.Hour); err != nil {
+		return err
+	}
+	if c.interval < time.Minute {
+		c.interval = time.Minute
+	}
+	return nil
+}
+
+// RetentionDuration 返回审计日志保留时长，为 0 则永久保留
+func (c *AuditLog) RetentionDuration() time.Duration {
+	return c.retention
+}
+
+// IntervalDuration 返回后台清理过期审计日志的执行间隔
+func (c *AuditLog) IntervalDuration() time.Duration {
+	return c.interval
+}
+
+// Webhook 变更事件 webhook 投递配置
+type Webhook struct {
+	Timeout             string `json:"timeout" yaml:"timeout"`                             // 单次投递的超时时间，默认 5s
+	RetryDelay          string `json:"retry_delay" yaml:"retry_delay"`                     // 首次重试的等待时间，之后每次翻倍，默认 10s
+	MaxAttempts         int    `json:"max_attempts" yaml:"max_attempts"`                   // 最大投递次数，超过后标记为失败，默认 6
+	Interval            string `json:"interval" yaml:"interval"`                           // 后台扫描待重试投递的执行间隔，默认 10s
+	AllowPrivateNetwork bool   `json:"allow_private_network" yaml:"allow_private_network"` // 是否允许投递到回环、链路本地和内网等地址，默认 false，避免通过 webhook 访问内部服务
+	timeout             time.Duration
+	retryDelay          time.Duration
+	interval            time.Duration
+}
+
+// Validate ...
+func (c *Webhook) Validate() error {
+	var err error
+	if c.timeout, err = parseDuration(c.Timeout, 5*time.Second); err != nil {
+		return err
+	}
+	if c.retryDelay, err = parseDuration(c.RetryDelay, 10*time.Second); err != nil {
+		return err
+	}
+	if c.interval, err = parseDuration(c.Interval, 10*time.Second); err != nil {
+		return err
+	}
+	if c.interval < time.Second {
+		c.interval = time.Second
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = 6
+	}
+	return nil
+}
+
+// TimeoutDuration 返回单次投递的超时时间
+func (c *Webhook) TimeoutDuration() time.Duration {
+	return c.timeout
+}
+
+// RetryDelayAfter 返回第 attempts 次投递失败后的重试等待时间，指数退避，最长 1 小时
+func (c *Webhook) RetryDelayAfter(attempts int) time.Duration {
+	delay := c.retryDelay
+	for i := 1; i < attempts && delay < time.Hour; i++ {
+		delay *= 2
+	}
+	if delay > time.Hour {
+		delay = time.Hour
+	}
+	return delay
+}
+
+// IntervalDuration 返回后台扫描待重试投递的执行间隔
+func (c *Webhook) IntervalDuration() time.Duration {
+	return c.interval
+}
+
+// ChangeFeed 变更流配置
+type ChangeFeed struct {
+	Retention    string `json:"retention" yaml:"retention"`         // 变更事件保留时长，如 "168h"，为空则永久保留
+	Interval     string `json:"interval" yaml:"interval"`           // 后台清理过期变更事件的执行间隔，默认 1h
+	PollInterval string `json:"poll_interval" yaml:"poll_interval"` // 长轮询期间查询新事件的间隔，也是为已提交的新事件分配游标的间隔，默认 1s
+	retention    time.Duration
+	interval     time.Duration
+	pollInterval time.Duration
+}
+
+// Validate ...
+func (c *ChangeFeed) Validate() error {
+	var err error
+	if c.retention, err = parseDuration(c.Retention, 0); err != nil {
+		return err
+	}
+	if c.retention > 0 && c.retention < 24*time.Hour {
+		c.retention = 24 * time.Hour
+	}
+	if c.interval, err = parseDuration(c.Interval, time.Hour); err != nil {
+		return err
+	}
+	if c.interval < time.Minute {
+		c.interval = time.Minute
+	}
+	if c.pollInterval, err = parseDuration(c.PollInterval, time.Second); err != nil {
+		return err
+	}
+	if c.pollInterval < 100*time.Millisecond {
+		c.pollInterval = 100 * time.Millisecond
+	}
+	return nil
+}
+
+// RetentionDuration 返回变更事件保留时长，为 0 则永久保留
+func (c *ChangeFeed) RetentionDuration() time.Duration {
+	return c.retention
+}
+
+// IntervalDuration 返回后台清理过期变更事件的执行间隔
+func (c *ChangeFeed) IntervalDuration() time.Duration {
+	return c.interval
+}
+
+// PollIntervalDuration 返回长轮询期间查询新事件的间隔
+func (c *ChangeFeed) PollIntervalDuration() time.Duration {
+	return c.pollInterval
+}
+
+// Exposure 曝光事件配置，记录用户实际获取到的配置项值和环境标签，用于分析实验效果
+type Exposure struct {
+	Sink          string `json:"sink" yaml:"sink"`                     // 曝光事件输出方式：stdout、file 或 http，为空则关闭
+	File          string `json:"file" yaml:"file"`                     // sink 为 file 时的 NDJSON 文件路径
+	MaxSize       int    `json:"max_size" yaml:"max_size"`             // sink 为 file 时单个文件的最大 MB 数，超过后轮转，默认 100
+	MaxBackups    int    `json:"max_backups" yaml:"max_backups"`       // sink 为 file 时保留的轮转文件数，默认 5
+	URL           string `json:"url" yaml:"url"`                       // sink 为 http 时的收集服务地址，以 NDJSON 批量 POST
+	Timeout       string `json:"timeout" yaml:"timeout"`               // sink 为 http 时单次请求的超时时间，默认 5s
+	Window        string `json:"window" yaml:"window"`                 // 同一用户同一配置项（或环境标签）相同值的去重时间窗口，默认 1h，为 0 则不去重
+	MaxEntries    int    `json:"max_entries" yaml:"max_entries"`       // 去重缓存的最大条数，默认 100000
+	BufferSize    int    `json:"buffer_size" yaml:"buffer_size"`       // 待输出事件的缓冲队列长度，队列满时丢弃新事件，默认 10000
+	BatchSize     int    `json:"batch_size" yaml:"batch_size"`         // 每批输出的最大事件数，默认 100
+	FlushInterval string `json:"flush_interval" yaml:"flush_interval"` // 未满一批时的输出间隔，默认 1s
+	timeout       time.Duration
+	window        time.Duration
+	flushInterval time.Duration
+}
+
+// Validate ...
+func (c *Exposure) Validate() error {
+	switch c.Sink {
+	case "", "stdout":
+	case "file":
+		if c.File == "" {
+			return fmt.Errorf("exposure.file is required for file sink")
+		}
+	case "http":
+		if c.URL == "" {
+			return fmt.Errorf("exposure.url is required for http sink")
+		}
+	default:
+		return fmt.Errorf("invalid exposure.sink %q", c.Sink)
+	}
+
+	var err error
+	if c.timeout, err = parseDuration(c.Timeout, 5*time.Second); err != nil {
+		return err
+	}
+	if c.window, err = parseDuration(c.Window, time.Hour); err != nil {
+		return err
+	}
+	if c.flushInterval, err = parseDuration(c.FlushInterval, time.Second); err != nil {
+		return err
+	}
+	if c.flushInterval < 10*time.Millisecond {
+		c.flushInterval = 10 * time.Millisecond
+	}
+	if c.MaxSize <= 0 {
+		c.MaxSize = 100
+	}
+	if c.MaxBackups <= 0 {
+		c.MaxBackups = 5
+	}
+	if c.MaxEntries <= 0 {
+		c.MaxEntries = 100000
+	}
+	if c.BufferSize <= 0 {
+		c.BufferSize = 10000
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = 100
+	}
+	return nil
+}
+
+// Enabled 是否开启了曝光事件
+func (c *Exposure) Enabled() bool {
+	return c.Sink != ""
+}
+
+// TimeoutDuration 返回 http sink 单次请求的超时时间
+func (c *Exposure) TimeoutDuration() time.Duration {
+	return c.timeout
+}
+
+// WindowDuration 返回去重时间窗口，为 0 则不去重
+func (c *Exposure) WindowDuration() time.Duration {
+	return c.window
+}
+
+// FlushIntervalDuration 返回未满一批时的输出间隔
+func (c *Exposure) FlushIntervalDuration() time.Duration {
+	return c.flushInterval
+}
+
+// RBAC 基于角色的访问控制配置
+type RBAC struct {
+	Enabled  bool     `json:"enabled" yaml:"enabled"`     // 是否对 /v1、/v2 接口启用角色检查，未启用时任何通过身份验证的请求者都可以调用全部接口
+	Admins   []string `json:"admins" yaml:"admins"`       // 内置的全局 admin 请求者（OTVID 或 JWT sub），用于初始化授权
+	CacheTTL string   `json:"cache_ttl" yaml:"cache_ttl"` // 请求者角色的进程内缓存有效期，其它实例上的授权变更最多延迟该时间生效，默认 5s，为 0 则不缓存
+	cacheTTL time.Duration
+}
+
+// Validate ...
+func (c *RBAC) Validate() error {
+	var err error
+	if c.cacheTTL, err = parseDuration(c.CacheTTL, 5*time.Second); err != nil {
+		return err
+	}
+	return nil
+}
+
+// IsAdmin 判断请求者是否为内置的全局 admin
+func (c *RBAC) IsAdmin(subject string) bool {
+	for _, s := range c.Admins {
+		if s == subject {
+			return true
+		}
+	}
+	return false
+}
+
+// CacheTTLDuration 返回请求者角色的进程内缓存有效期
+func (c *RBAC) CacheTTLDuration() time.Duration {
+	return c.cacheTTL
+}
+
+// APIKey 数据库管理的 API key 配置
+type APIKey struct {
+	CacheTTL string `json:"cache_ttl" yaml:"cache_ttl"` // API key 的进程内缓存有效期，其它实例上的撤销最多延迟该时间生效，默认 5s，为 0 则不缓存
+	cacheTTL time.Duration
+}
+
+// Validate ...
+func (c *APIKey) Validate() error {
+	var err error
+	if c.cacheTTL, err = parseDuration(c.CacheTTL, 5*time.Second); err != nil {
+		return err
+	}
+	return nil
+}
+
+// CacheTTLDuration 返回 API key 的进程内缓存有效期
+func (c *APIKey) CacheTTLDuration() time.Duration {
+	return c.cacheTTL
+}
+
+// LabelsCache 无身份验证的 GET /users/:uid/labels:cache 接口的访问策略
+type LabelsCache struct {
+	SharedSecrets   []string `json:"shared_secrets" yaml:"shared_secrets"`       // 网关共享密钥，通过 X-Gateway-Secret 请求头传递，支持多个以便轮换
+	ClientCAFile    string   `json:"client_ca_file" yaml:"client_ca_file"`       // 验证网关 mTLS 客户端证书的 CA 文件，需同时配置 cert_file 和 key_file
+	ClientCertNames []string `json:"client_cert_names" yaml:"client_cert_names"` // 允许的客户端证书 CN 或 DNS SAN，为空则允许 CA 签发的任意证书
+	IPRate          float64  `json:"ip_rate" yaml:"ip_rate"`                     // 每个客户端 IP 每秒允许的请求数，为 0 则不限流
+	IPBurst         int      `json:"ip_burst" yaml:"ip_burst"`                   // 每个客户端 IP 允许的突发请求数
+	UIDRate         float64  `json:"uid_rate" yaml:"uid_rate"`                   // 每个 uid 每秒允许的请求数，为 0 则不限流
+	UIDBurst        int      `json:"uid_burst" yaml:"uid_burst"`                 // 每个 uid 允许的突发请求数
+	MaxEntries      int      `json:"max_entries" yaml:"max_entries"`             // 限流器最多跟踪的客户端 IP 或 uid 数量，默认 100000
+	TrustedProxies  []string `json:"trusted_proxies" yaml:"trusted_proxies"`     // 可信代理的 CIDR，只信任来自这些地址的 X-Forwarded-For 和 X-Real-IP 请求头，为空则按连接地址限流
+	trustedProxies  []*net.IPNet
+}
+
+// Validate ...
+func (c *LabelsCache) Validate() error {
+	if c.IPRate < 0 || c.UIDRate < 0 {
+		return fmt.Errorf("labels_cache: ip_rate and uid_rate should not be negative")
+	}
+	if c.IPBurst <= 0 {
+		c.IPBurst = int(c.IPRate) + 1
+	}
+	if c.UIDBurst <= 0 {
+		c.UIDBurst = int(c.UIDRate) + 1
+	}
+	if c.MaxEntries <= 0 {
+		c.MaxEntries = 100000
+	}
+	c.trustedProxies = make([]*net.IPNet, 0, len(c.TrustedProxies))
+	for _, cidr := range c.TrustedProxies {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return fmt.Errorf("labels_cache: invalid trusted_proxies %q: %v", cidr, err)
+		}
+		c.trustedProxies = append(c.trustedProxies, n)
+	}
+	return nil
+}
+
+// IsTrustedProxy 判断 ip 是否属于 trusted_proxies
+func (c *LabelsCache) IsTrustedProxy(ip net.IP) bool {
+	for _, n := range c.trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireClientAuth 是否要求调用方提供共享密钥或 mTLS 客户端证书
+func (c *LabelsCache) RequireClientAuth() bool {
+	return len(c.SharedSecrets) > 0 || c.ClientCAFile != ""
+}
+
+// ChangeRequest 受保护产品的变更审批配置
+type ChangeRequest struct {
+	TTL      string `json:"ttl" yaml:"ttl"`           // 变更申请的有效期，超过后不能再审批，默认 72h
+	Interval string `json:"interval" yaml:"interval"` // 后台标记过期申请的执行间隔，默认 10m
+	ttl      time.Duration
+	interval time.Duration
+}
+
+// Validate ...
+func (c *ChangeRequest) Validate() error {
+	var err error
+	if c.ttl, err = parseDuration(c.TTL, 72*time.Hour); err != nil {
+		return err
+	}
+	if c.ttl < time.Minute {
+		c.ttl = time.Minute
+	}
+	if c.interval, err = parseDuration(c.Interval, 10*time.Minute); err != nil {
+		return err
+	}
+	if c.interval < time.Second {
+		c.interval = time.Second
+	}
+	return nil
+}
+
+// TTLDuration 返回变更申请的有效期
+func (c *ChangeRequest) TTLDuration() time.Duration {
+	return c.ttl
+}
+
+// IntervalDuration 返回后台标记过期申请的执行间隔
+func (c *ChangeRequest) IntervalDuration() time.Duration {
+	return c.interval
+}
+
+// Import 用户、群组和群组成员流式导入的配置
+type Import struct {
+	MaxSize   int64  `json:"max_size" yaml:"max_size"`     // 导入文件的最大字节数，默认 1GB
+	BatchSize int    `json:"batch_size" yaml:"batch_size"` // 每批写入的行数，默认 1000
+	MaxErrors int    `json:"max_errors" yaml:"max_errors"` // 每个任务最多记录的无效行数，超出的只计数，默认 10000
+	TempDir   string `json:"temp_dir" yaml:"temp_dir"`     // 暂存导入文件的目录，默认为系统临时目录
+	Timeout   string `json:"timeout" yaml:"timeout"`       // 单个导入任务的最长执行时间，默认 2h
+	timeout   time.Duration
+}
+
+// Validate ...
+func (c *Import) Validate() error {
+	if c.MaxSize <= 0 {
+		c.MaxSize = 1 << 30
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = 1000
+	}
+	if c.BatchSize > 10000 {
+		c.BatchSize = 10000
+	}
+	if c.MaxErrors <= 0 {
+		c.MaxErrors = 10000
+	}
+	var err error
+	if c.timeout, err = parseDuration(c.Timeout, 2*time.Hour); err != nil {
+		return err
+	}
+	if c.timeout < time.Minute {
+		c.timeout = time.Minute
+	}
+	return nil
+}
+
+// TimeoutDuration 返回单个导入任务的最长执行时间
+func (c *Import) TimeoutDuration() time.Duration {
+	return c.timeout
+}
+
+// Metrics GET /metrics 接口的访问配置
+type Metrics struct {
+	Tokens []string `json:"tokens" yaml:"tokens"` // 通过 Authorization: Bearer 请求头传递的令牌，支持多个以便轮换，为空则不验证
+}
+
+// Tracing OpenTelemetry 追踪配置，通过 W3C traceparent 请求头继续上游的追踪
+type Tracing struct {
+	Exporter    string  `json:"exporter" yaml:"exporter"`         // span 导出方式，为空或 none 时不导出，stdout 输出到标准输出，otlp 通过 gRPC 发送到 OTLP collector
+	Endpoint    string  `json:"endpoint" yaml:"endpoint"`         // OTLP collector 地址，默认 localhost:55680
+	Insecure    bool    `json:"insecure" yaml:"insecure"`         // 连接 OTLP collector 时不使用 TLS
+	SampleRatio float64 `json:"sample_ratio" yaml:"sample_ratio"` // 根 span 的采样率，0 到 1，为 0 时使用默认值 1，有上游 traceparent 时跟随上游的采样决定
+}
+
+// Validate ...
+func (c *Tracing) Validate() error {
+	switch c.Exporter {
+	case "", "none", "stdout", "otlp":
+	default:
+		return fmt.Errorf("invalid tracing exporter %q, should be none, stdout or otlp", c.Exporter)
+	}
+	if c.SampleRatio < 0 || c.SampleRatio > 1 {
+		return fmt.Errorf("invalid tracing sample_ratio %v, should be between 0 and 1", c.SampleRatio)
+	}
+	if c.SampleRatio == 0 {
+		c.SampleRatio = 1
+	}
+	return nil
+}
+
+// Healthz GET /readyz 就绪检查的配置
+type Healthz struct {
+	Timeout       string `json:"timeout" yaml:"timeout"`               // 每项检查的超时时间，默认 2s
+	ShutdownDelay string `json:"shutdown_delay" yaml:"shutdown_delay"` // 收到退出信号后 /readyz 返回 503，等待该时间后再关闭服务，以便负载均衡摘除实例，默认 0
+	timeout       time.Duration
+	shutdownDelay time.Duration
+}
+
+// Validate ...
+func (c *Healthz) Validate() error {
+	var err error
+	if c.timeout, err = parseDuration(c.Timeout, 2*time.Second); err != nil {
+		return err
+	}
+	if c.timeout <= 0 {
+		c.timeout = 2 * time.Second
+	}
+	c.shutdownDelay, err = parseDuration(c.ShutdownDelay, 0)
+	return err
+}
+
+// TimeoutDuration 返回每项就绪检查的超时时间
+func (c *Healthz) TimeoutDuration() time.Duration {
+	return c.timeout
+}
+
+// ShutdownDelayDuration 返回收到退出信号后延迟关闭服务的时间
+func (c *Healthz) ShutdownDelayDuration() time.Duration {
+	return c.shutdownDelay
+}
+
+// Timeseries 按天时间序列统计（urbs_statistic_daily）的配置
+type Timeseries struct {
+	FlushInterval string `json:"flush_interval" yaml:"flush_interval"` // 写操作产生的计数在内存中累加，按该间隔批量写入数据库，默认 10s
+	RollupAt      string `json:"rollup_at" yaml:"rollup_at"`           // 每天汇总前一天活跃用户数的时间（UTC），格式 HH:MM，默认 00:10
+	flushInterval time.Duration
+	rollupAt      time.Duration
+}
+
+// Validate ...
+func (c *Timeseries) Validate() error {
+	var err error
+	if c.flushInterval, err = parseDuration(c.FlushInterval, 10*time.Second); err != nil {
+		return err
+	}
+	if c.flushInterval < time.Second {
+		c.flushInterval = time.Second
+	}
+	rollupAt := c.RollupAt
+	if rollupAt == "" {
+		rollupAt = "00:10"
+	}
+	t, err := time.Parse("15:04", rollupAt)
+	if err != nil {
+		return fmt.Errorf("invalid timeseries.rollup_at %q, should be HH:MM", c.RollupAt)
+	}
+	c.rollupAt = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	return nil
+}
+
+// FlushIntervalDuration 返回计数批量写入数据库的间隔
+func (c *Timeseries) FlushIntervalDuration() time.Duration {
+	return c.flushInterval
+}
+
+// NextRollup 返回 now 之后下一次汇总的时间（UTC）
+func (c *Timeseries) NextRollup(now time.Time) time.Time {
+	now = now.UTC()
+	next := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).Add(c.rollupAt)
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// Reconcile 后台对账任务的配置，重新计算环境标签和配置项的精确使用用户数以及 urbs_statistic 中的对象总数
+type Reconcile struct {
+	Interval  string `json:"interval" yaml:"interval"`     // 对账任务的执行间隔，默认 6h
+	BatchSize int    `json:"batch_size" yaml:"batch_size"` // 每批对账的环境标签或配置项数，默认 100
+	interval  time.Duration
+}
+
+// Validate ...
+func (c *Reconcile) Validate() error {
+	var err error
+	if c.interval, err = parseDuration(c.Interval, 6*time.Hour); err != nil {
+		return err
+	}
+	if c.interval < time.Minute {
+		c.interval = time.Minute
+	}
+	if c.BatchSize <= 0 || c.BatchSize > 1000 {
+		c.BatchSize = 100
+	}
+	return nil
+}
+
+// IntervalDuration 返回对账任务的执行间隔
+func (c *Reconcile) IntervalDuration() time.Duration {
+	return c.interval
+}
+
+// ReadRouting 读写分离的路由配置
+type ReadRouting struct {
+	Window            string `json:"window" yaml:"window"`                         // 写操作后该时间窗口内，同一 subject 或 session 的读请求走主库，默认 5s，为 0 则关闭
+	MaxReplicaLag     string `json:"max_replica_lag" yaml:"max_replica_lag"`       // 从库延迟超过该值时读请求走主库，默认 2s
+	HeartbeatInterval string `json:"heartbeat_interval" yaml:"heartbeat_interval"` // 从库延迟检测的心跳间隔，默认 1s
+	window            time.Duration
+	maxReplicaLag     time.Duration
+	heartbeatInterval time.Duration
+}
+
+// Validate ...
+func (c *ReadRouting) Validate() error {
+	var err error
+	if c.window, err = parseDuration(c.Window, 5*time.Second); err != nil {
+		return err
+	}
+	if c.maxReplicaLag, err = parseDuration(c.MaxReplicaLag, 2*time.Second); err != nil {
+		return err
+	}
+	if c.heartbeatInterval, err = parseDuration(c.HeartbeatInterval, time.Second); err != nil {
+		return err
+	}
+	if c.heartbeatInterval < 100*time.Millisecond {
+		c.heartbeatInterval = 100 * time.Millisecond
+	}
+	return nil
+}
+
+// WindowDuration 返回写操作后读请求走主库的时间窗口
+func (c *ReadRouting) WindowDuration() time.Duration {
+	return c.window
+}
+
+// MaxReplicaLagDuration 返回允许的最大从库延迟
+func (c *ReadRouting) MaxReplicaLagDuration() time.Duration {
+	return c.maxReplicaLag
+}
+
+// HeartbeatIntervalDuration 返回从库延迟检测的心跳间隔
+func (c *ReadRouting) HeartbeatIntervalDuration() time.Duration {
+	return c.heartbeatInterval
+}
+
+// NameCache 产品、功能模块、配置项和环境标签的名称到 ID 的进程内缓存配置
+type NameCache struct {
+	TTL          string `json:"ttl" yaml:"ttl"`                     // 缓存有效期，默认 10s，为 0 则关闭
+	MaxEntries   int    `json:"max_entries" yaml:"max_entries"`     // 最大缓存条数，默认 10000
+	SyncInterval string `json:"sync_interval" yaml:"sync_interval"` // 跨实例失效的版本检测间隔，默认 1s
+	ttl          time.Duration
+	syncInterval time.Duration
+}
+
+// Validate ...
+func (c *NameCache) Validate() error {
+	var err error
+	if c.ttl, err = parseDuration(c.TTL, 10*time.Second); err != nil {
+		return err
+	}
+	if c.syncInterval, err = parseDuration(c.SyncInterval, time.Second); err != nil {
+		return err
+	}
+	if c.MaxEntries <= 0 {
+		c.MaxEntries = 10000
+	}
+	return nil
+}
+
+// TTLDuration 返回缓存有效期
+func (c *NameCache) TTLDuration() time.Duration {
+	return c.ttl
+}
+
+// SyncIntervalDuration 返回跨实例失效的版本检测间隔
+func (c *NameCache) SyncIntervalDuration() time.Duration {
+	return c.syncInterval
+}
+
+// Redis 共享缓存配置，兼容 Redis 协议的服务均可，Addr 为空则不启用
+type Redis struct {
+	Addr      string `json:"addr" yaml:"addr"`             // 如 localhost:6379，为空则不启用
+	Password  string `json:"password" yaml:"password"`     // 密码
+	DB        int    `json:"db" yaml:"db"`                 // 数据库编号
+	KeyPrefix string `json:"key_prefix" yaml:"key_prefix"` // 缓存键前缀，默认 urbs:
+	Timeout   string `json:"timeout" yaml:"timeout"`       // 单次读写超时，默认 200ms
+	PoolSize  int    `json:"pool_size" yaml:"pool_size"`   // 连接池大小，默认 64
+	timeout   time.Duration
+}
+
+// Validate ...
+func (c *Redis) Validate() error {
+	var err error
+	if c.timeout, err = parseDuration(c.Timeout, 200*time.Millisecond); err != nil {
+		return err
+	}
+	if c.KeyPrefix == "" {
+		c.KeyPrefix = "urbs:"
+	}
+	if c.PoolSize <= 0 {
+		c.PoolSize = 64
+	}
+	return nil
+}
+
+// Enabled 是否启用共享缓存
+func (c *Redis) Enabled() bool {
+	return c.Addr != ""
+}
+
+// TimeoutDuration 返回单次读写超时
+func (c *Redis) TimeoutDuration() time.Duration {
+	return c.timeout
+}
+
+func parseDuration(s string, defaultValue time.Duration) (time.Duration, error) {
+	if s == "" {
+		return defaultValue, nil
+	}
+	return time.ParseDuration(s)
+}
+
 // ConfigTpl ...
 type ConfigTpl struct {
 	GlobalCtx              context.Context
-	SrvAddr                string    `json:"addr" yaml:"addr"`
-	CertFile               string    `json:"cert_file" yaml:"cert_file"`
-	KeyFile                string    `json:"key_file" yaml:"key_file"`
-	Logger                 Logger    `json:"logger" yaml:"logger"`
-	MySQL                  SQL       `json:"mysql" yaml:"mysql"`
-	MySQLRd                SQL       `json:"mysql_read" yaml:"mysql_read"`
-	CacheLabelExpire       string    `json:"cache_label_expire" yaml:"cache_label_expire"`
-	Channels               []string  `json:"channels" yaml:"channels"`
-	Clients                []string  `json:"clients" yaml:"clients"`
-	HIDKey                 string    `json:"hid_key" yaml:"hid_key"`
-	AuthKeys               []string  `json:"auth_keys" yaml:"auth_keys"`
-	OpenTrust              OpenTrust `json:"open_trust" yaml:"open_trust"`
-	cacheLabelExpire       int64     // seconds, default to 60 seconds
-	cacheLabelDoubleExpire int64     // cacheLabelDoubleExpire * 2
+	SrvAddr                string        `json:"addr" yaml:"addr"`
+	CertFile               string        `json:"cert_file" yaml:"cert_file"`
+	KeyFile                string        `json:"key_file" yaml:"key_file"`
+	Logger                 Logger        `json:"logger" yaml:"logger"`
+	MySQL                  SQL           `json:"mysql" yaml:"mysql"`
+	MySQLRd                SQL           `json:"mysql_read" yaml:"mysql_read"`
+	CacheLabelExpire       string        `json:"cache_label_expire" yaml:"cache_label_expire"`
+	CacheLabelRefreshLimit int           `json:"cache_label_refresh_limit" yaml:"cache_label_refresh_limit"` // 同一进程内后台刷新 labels 缓存的最大并发数，默认 64
+	Channels               []string      `json:"channels" yaml:"channels"`
+	Clients                []string      `json:"clients" yaml:"clients"`
+	HIDKey                 string        `json:"hid_key" yaml:"hid_key"`
+	AuthKeys               []string      `json:"auth_keys" yaml:"auth_keys"`
+	OpenTrust              OpenTrust     `json:"open_trust" yaml:"open_trust"`
+	UserPurge              UserPurge     `json:"user_purge" yaml:"user_purge"`
+	ReadRouting            ReadRouting   `json:"read_routing" yaml:"read_routing"`
+	NameCache              NameCache     `json:"name_cache" yaml:"name_cache"`
+	Redis                  Redis         `json:"redis" yaml:"redis"`
+	AuditLog               AuditLog      `json:"audit_log" yaml:"audit_log"`
+	Webhook                Webhook       `json:"webhook" yaml:"webhook"`
+	ChangeFeed             ChangeFeed    `json:"change_feed" yaml:"change_feed"`
+	Exposure               Exposure      `json:"exposure" yaml:"exposure"`
+	RBAC                   RBAC          `json:"rbac" yaml:"rbac"`
+	APIKey                 APIKey        `json:"api_key" yaml:"api_key"`
+	LabelsCache            LabelsCache   `json:"labels_cache" yaml:"labels_cache"`
+	ChangeRequest          ChangeRequest `json:"change_request" yaml:"change_request"`
+	Import                 Import        `json:"import" yaml:"import"`
+	Metrics                Metrics       `json:"metrics" yaml:"metrics"`
+	Healthz                Healthz       `json:"healthz" yaml:"healthz"`
+	Tracing                Tracing       `json:"tracing" yaml:"tracing"`
+	Timeseries             Timeseries    `json:"timeseries" yaml:"timeseries"`
+	Reconcile              Reconcile     `json:"reconcile" yaml:"reconcile"`
+	cacheLabelExpire       int64         // seconds, default to 60 seconds
+	cacheLabelDoubleExpire int64         // cacheLabelDoubleExpire * 2
 }
 
 // Validate 用于完成基本的配置验证和初始化工作。业务相关的配置验证建议放到相关代码中实现，如 mysql 的配置。
@@ -72,7 +803,58 @@ func (c *ConfigTpl) Validate() error {
 	}
 	c.cacheLabelExpire = int64(du / time.Second)
 	c.cacheLabelDoubleExpire = 2 * c.cacheLabelExpire
-	return nil
+	if c.CacheLabelRefreshLimit <= 0 {
+		c.CacheLabelRefreshLimit = 64
+	}
+	if err := c.UserPurge.Validate(); err != nil {
+		return err
+	}
+	if err := c.ReadRouting.Validate(); err != nil {
+		return err
+	}
+	if err := c.NameCache.Validate(); err != nil {
+		return err
+	}
+	if err := c.Redis.Validate(); err != nil {
+		return err
+	}
+	if err := c.AuditLog.Validate(); err != nil {
+		return err
+	}
+	if err := c.Webhook.Validate(); err != nil {
+		return err
+	}
+	if err := c.ChangeFeed.Validate(); err != nil {
+		return err
+	}
+	if err := c.Exposure.Validate(); err != nil {
+		return err
+	}
+	if err := c.RBAC.Validate(); err != nil {
+		return err
+	}
+	if err := c.APIKey.Validate(); err != nil {
+		return err
+	}
+	if err := c.LabelsCache.Validate(); err != nil {
+		return err
+	}
+	if err := c.ChangeRequest.Validate(); err != nil {
+		return err
+	}
+	if err := c.Import.Validate(); err != nil {
+		return err
+	}
+	if err := c.Healthz.Validate(); err != nil {
+		return err
+	}
+	if err := c.Tracing.Validate(); err != nil {
+		return err
+	}
+	if err := c.Timeseries.Validate(); err != nil {
+		return err
+	}
+	return c.Reconcile.Validate()
 }
 
 // IsCacheLabelExpired 判断用户缓存的 labels 是否超过有效期
@@ -85,5 +867,10 @@ func (c *ConfigTpl) IsCacheLabelDoubleExpired(now, activeAt int64) bool {
 	return now-activeAt > c.cacheLabelDoubleExpire
 }
 
+// CacheLabelDoubleExpireDuration 返回用户 labels 缓存 2 倍有效期，超过该时间的缓存必须同步刷新
+func (c *ConfigTpl) CacheLabelDoubleExpireDuration() time.Duration {
+	return time.Duration(c.cacheLabelDoubleExpire) * time.Second
+}
+
 // Config ...
 var Config ConfigTpl
@@ -0,0 +1,179 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metrics 模块只引入官方库和 prometheus，以便 util、model 等模块都可以引入
+
+const namespace = "urbs"
+
+// Registry 服务的指标注册表，由 GET /metrics 输出
+var Registry = prometheus.NewRegistry()
+
+var (
+	// RequestDuration 按路由统计的请求耗时和响应状态码，route 为路由模式，如 /v1/products/:product/labels
+	RequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by method, route and status.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"method", "route", "status"})
+
+	// LabelCache ListCachedLabels 读取 labels 缓存的结果，hit 为缓存有效，
+	// sync_refresh 为缓存不存在或过期过久、同步刷新，async_refresh 为返回缓存并在后台刷新
+	LabelCache = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "label_cache_total",
+		Help:      "Label cache lookups in ListCachedLabels by result.",
+	}, []string{"result"})
+
+	// RuleHits 用户命中发布规则的次数，kind 为 label 或 setting，product 为产品 ID。
+	// 不按规则区分，避免序列数随规则增长，各环境标签和配置项的命中数见 urbs_statistic_daily 的 rule_hits
+	RuleHits = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rule_hits_total",
+		Help:      "Users matched by label or setting percent rules.",
+	}, []string{"kind", "product"})
+
+	// LabelsCacheRejected labels:cache 接口被拒绝的请求数，reason 为 unauthorized、ip_limited 或 uid_limited
+	LabelsCacheRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "labels_cache_rejected_total",
+		Help:      "Requests rejected by the labels:cache guard by reason.",
+	}, []string{"reason"})
+
+	// LockFailures 获取 urbs_lock 失败的次数，prefix 为锁键中第一个 ":" 之前的部分
+	LockFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "lock_failures_total",
+		Help:      "Failed urbs_lock acquisitions by key prefix.",
+	}, []string{"prefix"})
+
+	// TaskDuration 后台任务的耗时，result 为 ok、failed（panic）或 timeout
+	TaskDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "task_duration_seconds",
+		Help:      "Background task duration by task and result.",
+		Buckets:   []float64{.01, .05, .1, .5, 1, 5, 10, 30, 60, 300, 1800},
+	}, []string{"task", "result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		RequestDuration,
+		LabelCache,
+		RuleHits,
+		LabelsCacheRejected,
+		LockFailures,
+		TaskDuration,
+	)
+}
+
+// Register 注册指标，重复注册同一指标时忽略
+func Register(c prometheus.Collector) {
+	if err := Registry.Register(c); err != nil {
+		if _, ok := err.(prometheus.AlreadyRegisteredError); !ok {
+			panic(err)
+		}
+	}
+}
+
+// LockPrefix 返回锁键中第一个 ":" 之前的部分，避免锁键中的 ID 导致指标过多
+func LockPrefix(key string) string {
+	if i := strings.IndexByte(key, ':'); i >= 0 {
+		return key[:i]
+	}
+	return key
+}
+
+// dbStatsCollector 采集连接池的 sql.DBStats
+type dbStatsCollector struct {
+	stats func() sql.DBStats
+	descs map[string]*prometheus.Desc
+}
+
+var dbStatsHelps = map[string]string{
+	"max_open_connections":        "Maximum number of open connections to the database.",
+	"open_connections":            "The number of established connections both in use and idle.",
+	"in_use_connections":          "The number of connections currently in use.",
+	"idle_connections":            "The number of idle connections.",
+	"wait_count_total":            "The total number of connections waited for.",
+	"wait_duration_seconds_total": "The total time blocked waiting for a new connection.",
+	"max_idle_closed_total":       "The total number of connections closed due to SetMaxIdleConns.",
+	"max_lifetime_closed_total":   "The total number of connections closed due to SetConnMaxLifetime.",
+}
+
+// NewDBStatsCollector 返回连接池指标，pool 为 primary 或 read
+func NewDBStatsCollector(pool string, stats func() sql.DBStats) prometheus.Collector {
+	c := &dbStatsCollector{stats: stats, descs: make(map[string]*prometheus.Desc, len(dbStatsHelps))}
+	for name, help := range dbStatsHelps {
+		c.descs[name] = prometheus.NewDesc(prometheus.BuildFQName(namespace, "db", name), help,
+			nil, prometheus.Labels{"pool": pool})
+	}
+	return c
+}
+
+// Describe 实现 prometheus.Collector
+func (c *dbStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range c.descs {
+		ch <- desc
+	}
+}
+
+// Collect 实现 prometheus.Collector
+func (c *dbStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.stats()
+	gauge := prometheus.GaugeValue
+	counter := prometheus.CounterValue
+	ch <- prometheus.MustNewConstMetric(c.descs["max_open_connections"], gauge, float64(s.MaxOpenConnections))
+	ch <- prometheus.MustNewConstMetric(c.descs["open_connections"], gauge, float64(s.OpenConnections))
+	ch <- prometheus.MustNewConstMetric(c.descs["in_use_connections"], gauge, float64(s.InUse))
+	ch <- prometheus.MustNewConstMetric(c.descs["idle_connections"], gauge, float64(s.Idle))
+	ch <- prometheus.MustNewConstMetric(c.descs["wait_count_total"], counter, float64(s.WaitCount))
+	ch <- prometheus.MustNewConstMetric(c.descs["wait_duration_seconds_total"], counter, s.WaitDuration.Seconds())
+	ch <- prometheus.MustNewConstMetric(c.descs["max_idle_closed_total"], counter, float64(s.MaxIdleClosed))
+	ch <- prometheus.MustNewConstMetric(c.descs["max_lifetime_closed_total"], counter, float64(s.MaxLifetimeClosed))
+}
+
+// statisticCollector 采集 urbs_statistic 中的总数，每次采集时读取数据库
+type statisticCollector struct {
+	find func(context.Context) (map[string]int64, error)
+	desc *prometheus.Desc
+}
+
+// NewStatisticCollector 返回 urbs_statistic 总数的指标，find 返回名称到总数的映射，如 users: 1000
+func NewStatisticCollector(find func(context.Context) (map[string]int64, error)) prometheus.Collector {
+	return &statisticCollector{
+		find: find,
+		desc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "statistic", "total"),
+			"Object totals recorded in urbs_statistic.", []string{"name"}, nil),
+	}
+}
+
+// Describe 实现 prometheus.Collector
+func (c *statisticCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+// Collect 实现 prometheus.Collector，读取失败时输出错误，/metrics 跳过该指标并继续输出其它指标
+func (c *statisticCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	totals, err := c.find(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.desc, err)
+		return
+	}
+	for name, total := range totals {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(total), name)
+	}
+}
@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	t.Run("LockPrefix should work", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.Equal("refreshLabelStatus", LockPrefix("refreshLabelStatus:123"))
+		assert.Equal("UsersTotalSize", LockPrefix("UsersTotalSize"))
+	})
+
+	t.Run("RuleHits and LabelsCacheRejected should be registered", func(t *testing.T) {
+		assert := assert.New(t)
+
+		RuleHits.WithLabelValues("label", "1").Inc()
+		LabelsCacheRejected.WithLabelValues("ip_limited").Inc()
+		n, err := testutil.GatherAndCount(Registry, "urbs_rule_hits_total", "urbs_labels_cache_rejected_total")
+		assert.Nil(err)
+		assert.True(n >= 2)
+		assert.Equal(float64(1), testutil.ToFloat64(LabelsCacheRejected.WithLabelValues("ip_limited")))
+	})
+
+	t.Run("NewDBStatsCollector should work", func(t *testing.T) {
+		assert := assert.New(t)
+
+		c := NewDBStatsCollector("primary", func() sql.DBStats {
+			return sql.DBStats{MaxOpenConnections: 64, OpenConnections: 3, InUse: 1, Idle: 2}
+		})
+		assert.Equal(8, testutil.CollectAndCount(c))
+		assert.Nil(testutil.CollectAndCompare(c, strings.NewReader(`
+# HELP urbs_db_open_connections The number of established connections both in use and idle.
+# TYPE urbs_db_open_connections gauge
+urbs_db_open_connections{pool="primary"} 3
+`), "urbs_db_open_connections"))
+	})
+
+	t.Run("NewStatisticCollector should work", func(t *testing.T) {
+		assert := assert.New(t)
+
+		c := NewStatisticCollector(func(context.Context) (map[string]int64, error) {
+			return map[string]int64{"users": 10, "label_rules": 2}, nil
+		})
+		assert.Nil(testutil.CollectAndCompare(c, strings.NewReader(`
+# HELP urbs_statistic_total Object totals recorded in urbs_statistic.
+# TYPE urbs_statistic_total gauge
+urbs_statistic_total{name="label_rules"} 2
+urbs_statistic_total{name="users"} 10
+`)))
+
+		c = NewStatisticCollector(func(context.Context) (map[string]int64, error) {
+			return nil, errors.New("some error")
+		})
+		assert.NotNil(testutil.CollectAndCompare(c, strings.NewReader("")))
+	})
+}
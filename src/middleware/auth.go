@@ -1,6 +1,8 @@
 package middleware
 
 import (
+	"context"
+	"strings"
 	"time"
 
 	otgo "github.com/open-trust/ot-go-lib"
@@ -9,6 +11,7 @@ import (
 	authjwt "github.com/teambition/gear-auth/jwt"
 	"github.com/teambition/urbs-setting/src/conf"
 	"github.com/teambition/urbs-setting/src/logging"
+	"github.com/teambition/urbs-setting/src/tpl"
 )
 
 func init() {
@@ -46,8 +49,47 @@ var otLegacyVerifier *otgo.Verifier
 // Auther 是基于 JWT 的身份验证，当 config.auth_keys 配置了才会启用
 var Auther *auth.Auth
 
-// Auth 验证请求者身份，如果验证失败，则返回 401 的 gear.HTTPError
+// APIKeyVerifier 验证数据库管理的 API key，返回请求者身份和 key 的 scopes，由业务模块注入
+var APIKeyVerifier func(ctx context.Context, key string) (subject string, scopes []string, err error)
+
+type ctxKey string
+
+const subjectKey ctxKey = "subject"
+const scopesKey ctxKey = "scopes"
+
+// Subject 返回 Auth 中间件验证通过的请求者身份，未验证时返回空字符串
+func Subject(ctx *gear.Context) string {
+	if val, err := ctx.Any(subjectKey); err == nil {
+		if sub, ok := val.(string); ok {
+			return sub
+		}
+	}
+	return ""
+}
+
+// Scopes 返回使用 API key 验证通过时 key 的 scopes，ok 为 false 表示请求未使用 API key
+func Scopes(ctx *gear.Context) (scopes []string, ok bool) {
+	if val, err := ctx.Any(scopesKey); err == nil {
+		scopes, ok = val.([]string)
+	}
+	return
+}
+
+// Auth 验证请求者身份，支持 API key、Open Trust 和 JWT token，如果验证失败，则返回 401 的 gear.HTTPError
 func Auth(ctx *gear.Context) error {
+	if APIKeyVerifier != nil {
+		if token := otgo.ExtractTokenFromHeader(ctx.Req.Header); strings.HasPrefix(token, tpl.APIKeyPrefix) {
+			sub, scopes, err := APIKeyVerifier(ctx, token)
+			if err != nil {
+				return err
+			}
+			logging.AccessLogger.SetTo(ctx, "subject", sub)
+			ctx.SetAny(subjectKey, sub)
+			ctx.SetAny(scopesKey, scopes)
+			return nil
+		}
+	}
+
 	if otVerifier != nil {
 		token := otgo.ExtractTokenFromHeader(ctx.Req.Header)
 		if token == "" {
@@ -66,6 +108,7 @@ func Auth(ctx *gear.Context) error {
 		}
 
 		logging.AccessLogger.SetTo(ctx, "subject", vid.ID.String())
+		ctx.SetAny(subjectKey, vid.ID.String())
 		return nil
 	}
 	return oldAuth(ctx)
@@ -79,6 +122,7 @@ func oldAuth(ctx *gear.Context) error {
 		}
 		if sub, ok := claims.Subject(); ok {
 			logging.AccessLogger.SetTo(ctx, "jwt_sub", sub)
+			ctx.SetAny(subjectKey, sub)
 		}
 		if jti, ok := claims.JWTID(); ok {
 			logging.AccessLogger.SetTo(ctx, "jwt_id", jti)
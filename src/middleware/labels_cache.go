@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/teambition/gear"
+	"github.com/teambition/urbs-setting/src/conf"
+	"github.com/teambition/urbs-setting/src/metrics"
+	"github.com/teambition/urbs-setting/src/util"
+)
+
+// HeaderGatewaySecret 网关调用 labels:cache 接口时传递共享密钥的请求头
+const HeaderGatewaySecret = "X-Gateway-Secret"
+
+// NewLabelsCacheGuard 根据 labels_cache 配置创建 labels:cache 接口的访问控制中间件：
+// 验证网关共享密钥或 mTLS 客户端证书（任一通过即可），并按客户端 IP 和 uid 限流，超过限流返回 429 和 Retry-After 响应头。
+// 客户端 IP 取连接地址，只有连接来自 trusted_proxies 时才使用 X-Forwarded-For 或 X-Real-IP 请求头。
+func NewLabelsCacheGuard(cfg conf.LabelsCache) gear.Middleware {
+	ipLimiter := util.NewRateLimiter(cfg.IPRate, cfg.IPBurst, cfg.MaxEntries)
+	uidLimiter := util.NewRateLimiter(cfg.UIDRate, cfg.UIDBurst, cfg.MaxEntries)
+
+	return func(ctx *gear.Context) error {
+		if cfg.RequireClientAuth() && !verifyGatewaySecret(ctx, cfg.SharedSecrets) &&
+			!verifyClientCert(ctx, cfg.ClientCAFile, cfg.ClientCertNames) {
+			metrics.LabelsCacheRejected.WithLabelValues("unauthorized").Inc()
+			return gear.ErrUnauthorized.WithMsg("invalid gateway secret or client certificate")
+		}
+
+		if ok, wait := ipLimiter.Allow(clientIP(ctx, &cfg)); !ok {
+			metrics.LabelsCacheRejected.WithLabelValues("ip_limited").Inc()
+			return tooManyRequests(ctx, wait.Seconds(), "client ip")
+		}
+		if ok, wait := uidLimiter.Allow(ctx.Param("uid")); !ok {
+			metrics.LabelsCacheRejected.WithLabelValues("uid_limited").Inc()
+			return tooManyRequests(ctx, wait.Seconds(), "uid")
+		}
+		return nil
+	}
+}
+
+// clientIP 返回限流使用的客户端 IP。请求头可以被客户端伪造，
+// 因此只在连接来自可信代理时，从 X-Forwarded-For 右侧取第一个不属于可信代理的地址，没有则取 X-Real-IP
+func clientIP(ctx *gear.Context, cfg *conf.LabelsCache) string {
+	host, _, err := net.SplitHostPort(ctx.Req.RemoteAddr)
+	if err != nil {
+		host = ctx.Req.RemoteAddr
+	}
+	remote := net.ParseIP(host)
+	if remote == nil || !cfg.IsTrustedProxy(remote) {
+		return host
+	}
+
+	if xff := ctx.GetHeader(gear.HeaderXForwardedFor); xff != "" {
+		ips := strings.Split(xff, ",")
+		for i := len(ips) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(ips[i]))
+			if ip == nil {
+				break
+			}
+			if !cfg.IsTrustedProxy(ip) {
+				return ip.String()
+			}
+		}
+	}
+	if ip := net.ParseIP(strings.TrimSpace(ctx.GetHeader(gear.HeaderXRealIP))); ip != nil {
+		return ip.String()
+	}
+	return host
+}
+
+func verifyGatewaySecret(ctx *gear.Context, secrets []string) bool {
+	val := ctx.GetHeader(HeaderGatewaySecret)
+	if val == "" {
+		return false
+	}
+	for _, s := range secrets {
+		if subtle.ConstantTimeCompare([]byte(val), []byte(s)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyClientCert 检查 TLS 握手中已由 client_ca_file 验证通过的客户端证书
+func verifyClientCert(ctx *gear.Context, caFile string, names []string) bool {
+	if caFile == "" || ctx.Req.TLS == nil || len(ctx.Req.TLS.VerifiedChains) == 0 {
+		return false
+	}
+	if len(names) == 0 {
+		return true
+	}
+	cert := ctx.Req.TLS.VerifiedChains[0][0]
+	for _, name := range names {
+		if cert.Subject.CommonName == name {
+			return true
+		}
+		for _, dns := range cert.DNSNames {
+			if dns == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func tooManyRequests(ctx *gear.Context, wait float64, by string) error {
+	ctx.SetHeader(gear.HeaderRetryAfter, strconv.Itoa(int(math.Max(1, math.Ceil(wait)))))
+	return gear.ErrTooManyRequests.WithMsgf("too many requests for the %s", by)
+}
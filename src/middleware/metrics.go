@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/teambition/gear"
+	"github.com/teambition/urbs-setting/src/conf"
+	"github.com/teambition/urbs-setting/src/metrics"
+)
+
+// Metrics 记录请求耗时和响应状态码，route 为匹配的路由模式，未匹配路由时为 other
+func Metrics(ctx *gear.Context) error {
+	start := time.Now()
+	method := ctx.Method
+	ctx.OnEnd(func() {
+		route := gear.GetRouterPatternFromCtx(ctx)
+		if route == "" {
+			route = "other"
+		}
+		metrics.RequestDuration.WithLabelValues(method, route, strconv.Itoa(ctx.Res.Status())).
+			Observe(time.Since(start).Seconds())
+	})
+	return nil
+}
+
+// NewMetricsGuard 根据 metrics 配置创建 GET /metrics 接口的访问控制中间件，配置了 tokens 时验证 Bearer 令牌
+func NewMetricsGuard(cfg conf.Metrics) gear.Middleware {
+	return func(ctx *gear.Context) error {
+		if len(cfg.Tokens) == 0 {
+			return nil
+		}
+		token := strings.TrimPrefix(ctx.GetHeader(gear.HeaderAuthorization), "Bearer ")
+		for _, t := range cfg.Tokens {
+			if token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+				return nil
+			}
+		}
+		return gear.ErrUnauthorized.WithMsg("invalid metrics token")
+	}
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/teambition/gear"
+	"github.com/teambition/urbs-setting/src/service"
+)
+
+// HeaderSessionID 客户端可以通过该请求头声明会话，用于写后读一致
+const HeaderSessionID = "X-Session-Id"
+
+// HeaderReadPrimaryUntil 写请求成功后在响应头中返回读主库的截止时间（毫秒时间戳），
+// 客户端在之后的读请求中回传该请求头时读主库，不依赖请求路由到同一实例
+const HeaderReadPrimaryUntil = "X-Read-Primary-Until"
+
+// ReadYourWrites 实现写后读一致：写请求成功后，read_routing.window 时间内同一 subject 或 session 的读请求走主库。
+// subject 和 session 的记录只保存在当前实例内存中，多实例部署时客户端应回传 HeaderReadPrimaryUntil。
+// 需要放在 Auth 中间件之后。
+func ReadYourWrites(ctx *gear.Context) error {
+	key := writerKey(ctx)
+
+	switch ctx.Method {
+	case http.MethodGet, http.MethodHead:
+		if service.IsRecentWriter(key) || readPrimaryRequested(ctx) {
+			ctx.WithContext(service.WithPrimary(ctx.Context()))
+		}
+	default:
+		ctx.After(func() {
+			if ctx.Res.Status() < 400 {
+				if until := service.MarkWriter(key); !until.IsZero() {
+					ctx.SetHeader(HeaderReadPrimaryUntil, strconv.FormatInt(until.UnixNano()/int64(time.Millisecond), 10))
+				}
+			}
+		})
+	}
+	return nil
+}
+
+// readPrimaryRequested 判断请求是否回传了仍有效的读主库截止时间
+func readPrimaryRequested(ctx *gear.Context) bool {
+	v := ctx.GetHeader(HeaderReadPrimaryUntil)
+	if v == "" {
+		return false
+	}
+	ms, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return false
+	}
+	return service.IsWithinWindow(time.Unix(0, ms*int64(time.Millisecond)))
+}
+
+func writerKey(ctx *gear.Context) string {
+	if sid := ctx.GetHeader(HeaderSessionID); sid != "" {
+		return "session:" + sid
+	}
+	if sub := Subject(ctx); sub != "" {
+		return "subject:" + sub
+	}
+	return ""
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"github.com/teambition/gear"
+	"github.com/teambition/urbs-setting/src/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing 为每个请求创建 server span，请求头中有 W3C traceparent 时继续上游的追踪，
+// span 名称为请求方法和匹配的路由模式，如 GET /v1/products/:product/modules/:module/settings，未匹配路由时为 HTTP GET
+func Tracing(ctx *gear.Context) error {
+	c := otel.GetTextMapPropagator().Extract(ctx.Context(), ctx.Req.Header)
+	c, span := tracing.Start(c, "HTTP "+ctx.Method,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(semconv.HTTPServerAttributesFromHTTPRequest("", "", ctx.Req)...))
+	ctx.WithContext(c)
+	ctx.OnEnd(func() {
+		status := ctx.Res.Status()
+		if route := gear.GetRouterPatternFromCtx(ctx); route != "" {
+			span.SetName(ctx.Method + " " + route)
+			span.SetAttributes(semconv.HTTPRouteKey.String(route))
+		}
+		span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(status)...)
+		span.SetStatus(semconv.SpanStatusFromHTTPStatusCode(status))
+		span.End()
+	})
+	return nil
+}
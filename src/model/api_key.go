@@ -0,0 +1,79 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/teambition/urbs-setting/src/schema"
+	"github.com/teambition/urbs-setting/src/tpl"
+)
+
+// APIKey ...
+type APIKey struct {
+	*Model
+}
+
+// Create 创建 API key
+func (m *APIKey) Create(ctx context.Context, key *schema.APIKey) error {
+	_, err := m.createOne(ctx, schema.TableAPIKey, key)
+	return err
+}
+
+// Acquire ...
+func (m *APIKey) Acquire(ctx context.Context, id int64) (*schema.APIKey, error) {
+	key := &schema.APIKey{}
+	if err := m.findOneByID(ctx, schema.TableAPIKey, id, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Find 返回 API key 列表，按创建时间倒序
+func (m *APIKey) Find(ctx context.Context, pg tpl.Pagination) ([]schema.APIKey, int, error) {
+	keys := make([]schema.APIKey, 0)
+	cursor := pg.TokenToID()
+	sdc := m.rdDB(ctx).From(schema.TableAPIKey)
+	sd := m.rdDB(ctx).From(schema.TableAPIKey).
+		Where(goqu.C("id").Lte(cursor)).
+		Order(goqu.C("id").Desc()).Limit(uint(pg.PageSize + 1))
+
+	total, err := sdc.CountContext(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err = sd.Executor().ScanStructsContext(ctx, &keys); err != nil {
+		return nil, 0, err
+	}
+	return keys, int(total), nil
+}
+
+// Update ...
+func (m *APIKey) Update(ctx context.Context, id int64, changed map[string]interface{}) (*schema.APIKey, error) {
+	m.auditBefore(ctx, schema.TableAPIKey, id, &schema.APIKey{})
+	if _, err := m.updateByID(ctx, schema.TableAPIKey, id, goqu.Record(changed)); err != nil {
+		return nil, err
+	}
+	return m.Acquire(ctx, id)
+}
+
+// Revoke 撤销 API key，已撤销的 key 保持原撤销时间
+func (m *APIKey) Revoke(ctx context.Context, id int64, now time.Time) (*schema.APIKey, error) {
+	m.auditBefore(ctx, schema.TableAPIKey, id, &schema.APIKey{})
+	sd := m.db(ctx).Update(schema.TableAPIKey).
+		Where(goqu.C("id").Eq(id), goqu.C("revoked_at").IsNull()).
+		Set(goqu.Record{"revoked_at": now})
+	if _, err := sd.Executor().ExecContext(ctx); err != nil {
+		return nil, err
+	}
+	return m.Acquire(ctx, id)
+}
+
+// TouchLastUsed 更新 API key 最近使用时间
+func (m *APIKey) TouchLastUsed(ctx context.Context, id int64, now time.Time) error {
+	sd := m.DB.Update(schema.TableAPIKey).
+		Where(goqu.C("id").Eq(id)).
+		Set(goqu.Record{"last_used_at": now})
+	_, err := sd.Executor().ExecContext(ctx)
+	return err
+}
@@ -0,0 +1,71 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/teambition/urbs-setting/src/schema"
+	"github.com/teambition/urbs-setting/src/service"
+	"github.com/teambition/urbs-setting/src/tpl"
+)
+
+// AuditLog ...
+type AuditLog struct {
+	*Model
+}
+
+// Create 写入一条审计日志
+func (m *AuditLog) Create(ctx context.Context, log *schema.AuditLog) error {
+	_, err := m.DB.Insert(schema.TableAuditLog).Rows(log).Executor().ExecContext(ctx)
+	return err
+}
+
+// Find 根据条件查找审计日志，按时间倒序
+func (m *AuditLog) Find(ctx context.Context, filter tpl.AuditLogsURL) ([]schema.AuditLog, int, error) {
+	logs := make([]schema.AuditLog, 0)
+	cursor := filter.TokenToID()
+	sdc := m.rdDB(ctx).From(schema.TableAuditLog)
+	sd := m.rdDB(ctx).From(schema.TableAuditLog).Where(goqu.C("id").Lte(cursor))
+	if filter.Product != "" {
+		sdc = sdc.Where(goqu.C("product").Eq(filter.Product))
+		sd = sd.Where(goqu.C("product").Eq(filter.Product))
+	}
+	if filter.Target != "" {
+		sdc = sdc.Where(goqu.C("target").Like(filter.Target))
+		sd = sd.Where(goqu.C("target").Like(filter.Target))
+	}
+	if filter.Actor != "" {
+		sdc = sdc.Where(goqu.C("actor").Eq(filter.Actor))
+		sd = sd.Where(goqu.C("actor").Eq(filter.Actor))
+	}
+	if filter.Start > 0 {
+		start := time.Unix(filter.Start, 0).UTC()
+		sdc = sdc.Where(goqu.C("created_at").Gte(start))
+		sd = sd.Where(goqu.C("created_at").Gte(start))
+	}
+	if filter.End > 0 {
+		end := time.Unix(filter.End, 0).UTC()
+		sdc = sdc.Where(goqu.C("created_at").Lt(end))
+		sd = sd.Where(goqu.C("created_at").Lt(end))
+	}
+	sd = sd.Order(goqu.C("id").Desc()).Limit(uint(filter.PageSize + 1))
+
+	total, err := sdc.CountContext(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	err = sd.Executor().ScanStructsContext(ctx, &logs)
+	if err != nil {
+		return nil, 0, err
+	}
+	return logs, int(total), nil
+}
+
+// DeleteBefore 删除一批 before 之前的审计日志，返回删除的条数，为 0 时表示已无可删除的日志
+func (m *AuditLog) DeleteBefore(ctx context.Context, before time.Time, limit int) (int64, error) {
+	sd := m.DB.Delete(schema.TableAuditLog).
+		Where(goqu.C("created_at").Lt(before)).
+		Order(goqu.C("id").Asc()).Limit(uint(limit))
+	return service.DeResult(sd.Executor().ExecContext(ctx))
+}
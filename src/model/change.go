@@ -0,0 +1,89 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/teambition/urbs-setting/src/schema"
+	"github.com/teambition/urbs-setting/src/service"
+)
+
+// Change ...
+type Change struct {
+	*Model
+}
+
+// Create 写入变更事件，应在对应写操作的事务中调用
+func (m *Change) Create(ctx context.Context, change *schema.Change) error {
+	_, err := m.db(ctx).Insert(schema.TableChange).Rows(change).Executor().ExecContext(ctx)
+	return err
+}
+
+// FindAfter 返回游标（变更流序号）之后的变更事件，按序号正序，product 不为空时只返回该产品的事件。
+// 尚未分配序号的事件不返回
+func (m *Change) FindAfter(ctx context.Context, cursor int64, product string, limit int) ([]schema.Change, error) {
+	changes := make([]schema.Change, 0)
+	sd := m.rdDB(ctx).From(schema.TableChange).Where(goqu.C("seq").Gt(cursor))
+	if product != "" {
+		sd = sd.Where(goqu.C("product").Eq(product))
+	}
+	sd = sd.Order(goqu.C("seq").Asc()).Limit(uint(limit))
+	if err := sd.Executor().ScanStructsContext(ctx, &changes); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// Sequence 按 ID 顺序为一批已提交但尚未分配序号的变更事件分配递增的变更流序号，返回分配的条数。
+// 未提交的事件不可见，提交后才分配到更大的序号，因此消费者的游标不会跳过晚提交的事件。
+// 其它实例正在分配时直接返回 0
+func (m *Change) Sequence(ctx context.Context, limit int) (int, error) {
+	if err := m.lock(ctx, "sequenceChanges", 10*time.Second); err != nil {
+		return 0, nil
+	}
+	defer m.unlock(ctx, "sequenceChanges")
+
+	ids := make([]int64, 0)
+	sd := m.DB.From(schema.TableChange).Where(goqu.C("seq").IsNull()).
+		Order(goqu.C("id").Asc()).Limit(uint(limit))
+	if err := sd.PluckContext(ctx, &ids, "id"); err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	var max sql.NullInt64
+	if _, err := m.DB.From(schema.TableChange).Select(goqu.MAX("seq")).
+		Executor().ScanValContext(ctx, &max); err != nil {
+		return 0, err
+	}
+	seq := goqu.Case().Value(goqu.C("id"))
+	for i, id := range ids {
+		seq = seq.When(id, max.Int64+int64(i)+1)
+	}
+	_, err := m.DB.Update(schema.TableChange).
+		Where(goqu.C("id").In(ids)).
+		Set(goqu.Record{"seq": seq}).
+		Executor().ExecContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
+
+// DeleteBefore 删除一批 before 之前的变更事件，返回删除的条数，为 0 时表示已无可删除的事件。
+// 保留序号最大的事件，供 Sequence 继续分配递增的序号，尚未分配序号的事件也不删除
+func (m *Change) DeleteBefore(ctx context.Context, before time.Time, limit int) (int64, error) {
+	var max sql.NullInt64
+	if _, err := m.DB.From(schema.TableChange).Select(goqu.MAX("seq")).
+		Executor().ScanValContext(ctx, &max); err != nil {
+		return 0, err
+	}
+	sd := m.DB.Delete(schema.TableChange).
+		Where(goqu.C("created_at").Lt(before), goqu.C("seq").Lt(max.Int64)).
+		Order(goqu.C("id").Asc()).Limit(uint(limit))
+	return service.DeResult(sd.Executor().ExecContext(ctx))
+}
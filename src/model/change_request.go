@@ -0,0 +1,90 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/teambition/urbs-setting/src/schema"
+	"github.com/teambition/urbs-setting/src/tpl"
+)
+
+// ChangeRequest ...
+type ChangeRequest struct {
+	*Model
+}
+
+// Create 创建待审批的变更申请
+func (m *ChangeRequest) Create(ctx context.Context, cr *schema.ChangeRequest) error {
+	cr.Status = schema.ChangeRequestPending
+	_, err := m.createOne(ctx, schema.TableChangeRequest, cr)
+	return err
+}
+
+// Acquire ...
+func (m *ChangeRequest) Acquire(ctx context.Context, id int64) (*schema.ChangeRequest, error) {
+	cr := &schema.ChangeRequest{}
+	if err := m.findOneByID(ctx, schema.TableChangeRequest, id, cr); err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+// Find 返回产品下的变更申请，status 不为空时只返回该状态的申请，按创建时间倒序
+func (m *ChangeRequest) Find(ctx context.Context, productID int64, status string, pg tpl.Pagination) ([]schema.ChangeRequest, int, error) {
+	crs := make([]schema.ChangeRequest, 0)
+	cursor := pg.TokenToID()
+	cls := goqu.Ex{"product_id": productID}
+	if status != "" {
+		cls["status"] = status
+	}
+	sdc := m.rdDB(ctx).From(schema.TableChangeRequest).Where(cls)
+	sd := m.rdDB(ctx).From(schema.TableChangeRequest).
+		Where(cls, goqu.C("id").Lte(cursor)).
+		Order(goqu.C("id").Desc()).Limit(uint(pg.PageSize + 1))
+
+	total, err := sdc.CountContext(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err = sd.Executor().ScanStructsContext(ctx, &crs); err != nil {
+		return nil, 0, err
+	}
+	return crs, int(total), nil
+}
+
+// Decide 把未过期的待审批申请更新为审批后的状态，返回是否更新成功，用于防止重复审批
+func (m *ChangeRequest) Decide(ctx context.Context, id int64, status, decidedBy, reason string, now time.Time) (bool, error) {
+	rowsAffected, err := m.updateByCols(ctx, schema.TableChangeRequest,
+		goqu.Ex{"id": id, "status": schema.ChangeRequestPending, "expired_at": goqu.Op{"gt": now}},
+		goqu.Record{"status": status, "decided_by": decidedBy, "decided_at": now, "reason": reason},
+	)
+	return rowsAffected > 0, err
+}
+
+// Finish 记录批准后的执行结果
+func (m *ChangeRequest) Finish(ctx context.Context, id int64, status, result string) error {
+	_, err := m.updateByID(ctx, schema.TableChangeRequest, id, goqu.Record{"status": status, "result": result})
+	return err
+}
+
+// FindExpired 返回已过期但仍为待审批状态的申请
+func (m *ChangeRequest) FindExpired(ctx context.Context, now time.Time, limit int) ([]schema.ChangeRequest, error) {
+	crs := make([]schema.ChangeRequest, 0)
+	sd := m.DB.From(schema.TableChangeRequest).
+		Where(goqu.C("status").Eq(schema.ChangeRequestPending), goqu.C("expired_at").Lte(now)).
+		Order(goqu.C("id").Asc()).Limit(uint(limit))
+	if err := sd.Executor().ScanStructsContext(ctx, &crs); err != nil {
+		return nil, err
+	}
+	return crs, nil
+}
+
+// Expire 把已过期的待审批申请标记为过期，返回是否更新成功
+func (m *ChangeRequest) Expire(ctx context.Context, id int64, now time.Time) (bool, error) {
+	rowsAffected, err := m.updateByCols(ctx, schema.TableChangeRequest,
+		goqu.Ex{"id": id, "status": schema.ChangeRequestPending, "expired_at": goqu.Op{"lte": now}},
+		goqu.Record{"status": schema.ChangeRequestExpired, "decided_at": now},
+	)
+	return rowsAffected > 0, err
+}
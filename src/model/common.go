@@ -2,19 +2,25 @@ package model
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"math/rand"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/doug-martin/goqu/v9"
 	"github.com/teambition/gear"
 	"github.com/teambition/urbs-setting/src/logging"
+	"github.com/teambition/urbs-setting/src/metrics"
 	"github.com/teambition/urbs-setting/src/schema"
 	"github.com/teambition/urbs-setting/src/service"
 	"github.com/teambition/urbs-setting/src/tpl"
+	"github.com/teambition/urbs-setting/src/tracing"
 	"github.com/teambition/urbs-setting/src/util"
+	"go.opentelemetry.io/otel/label"
 )
 
 func init() {
@@ -29,53 +35,72 @@ const ReadDB dbMode = "ReadDB"
 
 // Model ...
 type Model struct {
-	SQL  *service.SQL
-	DB   *goqu.Database
-	RdDB *goqu.Database
+	SQL   *service.SQL
+	DB    *goqu.Database
+	RdDB  *goqu.Database
+	Cache service.Cache
 }
 
 // Models ...
 type Models struct {
-	Model       *Model
-	Healthz     *Healthz
-	User        *User
-	Group       *Group
-	Product     *Product
-	Label       *Label
-	Module      *Module
-	Setting     *Setting
-	LabelRule   *LabelRule
-	SettingRule *SettingRule
-	Statistic   *Statistic
+	Model          *Model
+	Healthz        *Healthz
+	User           *User
+	Group          *Group
+	Product        *Product
+	Label          *Label
+	Module         *Module
+	Setting        *Setting
+	LabelRule      *LabelRule
+	SettingRule    *SettingRule
+	Statistic      *Statistic
+	StatisticDaily *StatisticDaily
+	Job            *Job
+	AuditLog       *AuditLog
+	Version        *Version
+	Webhook        *Webhook
+	Change         *Change
+	RoleBinding    *RoleBinding
+	APIKey         *APIKey
+	ChangeRequest  *ChangeRequest
 }
 
 // NewModels ...
-func NewModels(sql *service.SQL) *Models {
-	m := &Model{SQL: sql, DB: sql.DB, RdDB: sql.RdDB}
+func NewModels(sql *service.SQL, cache service.Cache) *Models {
+	m := &Model{SQL: sql, DB: sql.DB, RdDB: sql.RdDB, Cache: cache}
 	return &Models{
-		Model:       m,
-		Healthz:     &Healthz{m},
-		User:        &User{m},
-		Group:       &Group{m},
-		Product:     &Product{m},
-		Label:       &Label{m},
-		Module:      &Module{m},
-		Setting:     &Setting{m},
-		LabelRule:   &LabelRule{m},
-		SettingRule: &SettingRule{m},
-		Statistic:   &Statistic{m},
+		Model:          m,
+		Healthz:        &Healthz{m},
+		User:           &User{m},
+		Group:          &Group{m},
+		Product:        &Product{m},
+		Label:          &Label{m},
+		Module:         &Module{m},
+		Setting:        &Setting{m},
+		LabelRule:      &LabelRule{m},
+		SettingRule:    &SettingRule{m},
+		Statistic:      &Statistic{m},
+		StatisticDaily: &StatisticDaily{m},
+		Job:            &Job{m},
+		AuditLog:       &AuditLog{m},
+		Version:        &Version{m},
+		Webhook:        &Webhook{m},
+		Change:         &Change{m},
+		RoleBinding:    &RoleBinding{m},
+		APIKey:         &APIKey{m},
+		ChangeRequest:  &ChangeRequest{m},
 	}
 }
 
 // ***** 以下为需要组合多个 model 接口能力而对外暴露的接口 *****
 
 // ApplyLabelRulesAndRefreshUserLabels ...
-func (ms *Models) ApplyLabelRulesAndRefreshUserLabels(ctx context.Context, productID int64, product string, userID int64, now time.Time, force bool) (*schema.User, error) {
-	user, labelIDs, ok, err := ms.User.RefreshLabels(ctx, userID, now.Unix(), force, product)
+func (ms *Models) ApplyLabelRulesAndRefreshUserLabels(ctx context.Context, productID int64, userID int64, now time.Time, force bool) (*schema.UserCache, error) {
+	cache, labelIDs, ok, err := ms.User.RefreshLabels(ctx, userID, productID, now.Unix(), force)
 	if err != nil {
 		return nil, err
 	}
-	userProductLables := user.GetLabels(product)
+	userProductLables := cache.GetLabels()
 	if ok && len(userProductLables) == 0 {
 		hit, err := ms.LabelRule.ApplyRules(ctx, productID, userID, labelIDs, schema.RuleUserPercent)
 		if err != nil {
@@ -83,7 +108,9 @@ func (ms *Models) ApplyLabelRulesAndRefreshUserLabels(ctx context.Context, produ
 		}
 		if hit > 0 {
 			// refresh label again
-			user, labelIDs, ok, err = ms.User.RefreshLabels(ctx, userID, now.Unix(), true, product)
+			if cache, _, ok, err = ms.User.RefreshLabels(ctx, userID, productID, now.Unix(), true); err != nil {
+				return nil, err
+			}
 		}
 	} else if len(userProductLables) > 0 {
 		pg := tpl.Pagination{PageSize: 200}
@@ -104,27 +131,48 @@ func (ms *Models) ApplyLabelRulesAndRefreshUserLabels(ctx context.Context, produ
 				return nil, err
 			}
 			if hit > 0 {
-				user, labelIDs, ok, err = ms.User.RefreshLabels(ctx, userID, now.Unix(), true, product)
+				if cache, _, ok, err = ms.User.RefreshLabels(ctx, userID, productID, now.Unix(), true); err != nil {
+					return nil, err
+				}
 			}
 			break
 		}
 	}
 
 	if elapsed := time.Now().UTC().Sub(now) / time.Millisecond; elapsed > 200 {
-		logging.Warningf("ApplyLabelRulesAndRefreshUserLabels: userID %d, consumed %d ms, refreshed %v, start %v\n",
-			userID, elapsed, ok, now)
+		logging.Warningf("ApplyLabelRulesAndRefreshUserLabels: userID %d, productID %d, consumed %d ms, refreshed %v, start %v\n",
+			userID, productID, elapsed, ok, now)
 	}
-	return user, err
+	return cache.ToUserCache(), nil
 }
 
 // TryApplyLabelRulesAndRefreshUserLabels ...
-func (ms *Models) TryApplyLabelRulesAndRefreshUserLabels(ctx context.Context, productID int64, product string, userID int64, now time.Time, force bool) *schema.User {
-	user, err := ms.ApplyLabelRulesAndRefreshUserLabels(ctx, productID, product, userID, now, force)
+func (ms *Models) TryApplyLabelRulesAndRefreshUserLabels(ctx context.Context, productID int64, userID int64, now time.Time, force bool) *schema.UserCache {
+	cache, err := ms.ApplyLabelRulesAndRefreshUserLabels(ctx, productID, userID, now, force)
 	if err != nil {
-		logging.Warningf("ApplyLabelRulesAndRefreshUserLabels: userID %d, error %v", userID, err)
+		logging.Warningf("ApplyLabelRulesAndRefreshUserLabels: userID %d, productID %d, error %v", userID, productID, err)
 		return nil
 	}
-	return user
+	return cache
+}
+
+// ApplyLabelRulesAndRefreshAllUserLabels 强制刷新 user 在所有产品下的 labels 缓存，返回以产品名为键的缓存
+func (ms *Models) ApplyLabelRulesAndRefreshAllUserLabels(ctx context.Context, userID int64, now time.Time) (schema.UserCacheLabelMap, error) {
+	labelIDs, err := ms.User.RefreshAllLabels(ctx, userID, now.Unix())
+	if err != nil {
+		return nil, err
+	}
+	hit, err := ms.LabelRule.ApplyRules(ctx, 0, userID, labelIDs, schema.RuleUserPercent)
+	if err != nil {
+		return nil, err
+	}
+	if hit > 0 {
+		// refresh label again
+		if _, err = ms.User.RefreshAllLabels(ctx, userID, now.Unix()); err != nil {
+			return nil, err
+		}
+	}
+	return ms.User.FindLabelCacheMap(ctx, userID)
 }
 
 // TryApplySettingRules ...
@@ -141,15 +189,221 @@ func (ms *Models) TryApplySettingRules(ctx context.Context, productID, userID in
 	}
 }
 
+// PurgeInactiveUsers 分批清理 active_at 与 created_at 都早于 before 的不活跃用户，返回被清理的用户数
+// 锁期内不主动释放锁，保证多实例下每个锁期最多执行一次
+func (ms *Models) PurgeInactiveUsers(ctx context.Context, before time.Time, batchSize int, archive bool, lockExpire time.Duration) (int64, error) {
+	if err := ms.Model.lock(ctx, "purgeInactiveUsers", lockExpire); err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+		n, err := ms.User.PurgeInactive(ctx, before, batchSize, archive)
+		total += n
+		if err != nil {
+			return total, err
+		}
+		if n < int64(batchSize) {
+			return total, nil
+		}
+	}
+}
+
+// ReconcileStatistics 分批对账所有未下线环境标签和配置项的使用用户数，并重新计算 urbs_statistic 中的对象总数，
+// 返回对账的环境标签数和配置项数。执行期间持有锁，避免多实例同时对账
+func (ms *Models) ReconcileStatistics(ctx context.Context, batchSize int, lockExpire time.Duration) (int, int, error) {
+	if err := ms.Model.lock(ctx, "reconcileStatistics", lockExpire); err != nil {
+		return 0, 0, err
+	}
+	defer ms.Model.unlock(ctx, "reconcileStatistics")
+
+	reconcile := func(fn func(context.Context, int64, int) (int64, int, error)) (int, error) {
+		total, cursor := 0, int64(0)
+		for {
+			if err := ctx.Err(); err != nil {
+				return total, err
+			}
+			next, n, err := fn(ctx, cursor, batchSize)
+			total += n
+			if err != nil || n < batchSize {
+				return total, err
+			}
+			cursor = next
+		}
+	}
+
+	labels, err := reconcile(ms.Label.ReconcileStatus)
+	if err != nil {
+		return labels, 0, err
+	}
+	settings, err := reconcile(ms.Setting.ReconcileStatus)
+	if err != nil {
+		return labels, settings, err
+	}
+	return labels, settings, ms.Statistic.RefreshTotals(ctx)
+}
+
+// invalidateLabelCacheBatchSize 每批标记过期的用户数
+const invalidateLabelCacheBatchSize = 500
+
+// InvalidateUsersLabelCache 创建后台任务，分批将 users 在指定产品下（productID 为 0 时为所有产品）的 labels 缓存标记为过期
+func (ms *Models) InvalidateUsersLabelCache(ctx context.Context, target string, userIDs []int64, productID int64) (*schema.Job, error) {
+	return ms.startInvalidateLabelCacheJob(ctx, target, productID, func(_ context.Context, cursor int64) ([]int64, int64, error) {
+		end := cursor + invalidateLabelCacheBatchSize
+		if end >= int64(len(userIDs)) {
+			return userIDs[cursor:], 0, nil
+		}
+		return userIDs[cursor:end], end, nil
+	})
+}
+
+// InvalidateGroupsLabelCache 创建后台任务，分批将群组所有成员在指定产品下（productID 为 0 时为所有产品）的 labels 缓存标记为过期
+func (ms *Models) InvalidateGroupsLabelCache(ctx context.Context, target string, groupIDs []int64, productID int64) (*schema.Job, error) {
+	return ms.startInvalidateLabelCacheJob(ctx, target, productID, func(gctx context.Context, cursor int64) ([]int64, int64, error) {
+		return ms.Group.FindMemberIDs(gctx, groupIDs, cursor, invalidateLabelCacheBatchSize)
+	})
+}
+
+// startInvalidateLabelCacheJob next 按游标返回下一批 user ID，返回的游标为 0 时表示已无更多用户
+func (ms *Models) startInvalidateLabelCacheJob(ctx context.Context, target string, productID int64,
+	next func(context.Context, int64) ([]int64, int64, error)) (*schema.Job, error) {
+	job, err := ms.Job.Create(ctx, schema.JobInvalidateLabelCache, target)
+	if err != nil {
+		return nil, err
+	}
+
+	util.Go(ctx, 30*time.Minute, func(gctx context.Context) {
+		var processed, invalidated, cursor int64
+		var err error
+		for {
+			var userIDs []int64
+			if userIDs, cursor, err = next(gctx, cursor); err != nil {
+				break
+			}
+			if len(userIDs) > 0 {
+				n, e := ms.User.InvalidateLabelCaches(gctx, userIDs, productID)
+				if e != nil {
+					err = e
+					break
+				}
+				processed += int64(len(userIDs))
+				invalidated += n
+			}
+			if cursor == 0 {
+				break
+			}
+			if e := ms.Job.UpdateProgress(gctx, job.ID, processed, invalidated, 0); e != nil {
+				logging.Warningf("InvalidateLabelCache: job %d, update progress error %v", job.ID, e)
+			}
+		}
+
+		// 任务超时后 gctx 已结束，仍需记录任务结果
+		fctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if e := ms.Job.Finish(fctx, job.ID, processed, invalidated, 0, err); e != nil {
+			logging.Warningf("InvalidateLabelCache: job %d, finish error %v", job.ID, e)
+		}
+		logging.Infof("InvalidateLabelCache: job %d, target %s, processed %d, invalidated %d, error %v",
+			job.ID, target, processed, invalidated, err)
+	})
+	return job, nil
+}
+
 // ***** 以下为多个 model 可能共用的接口 *****
+
+// rdDB 返回用于读取的数据库，需要写后读一致或从库延迟过大时返回主库
+func (m *Model) rdDB(ctx context.Context) sqlDB {
+	// 事务中的读操作需要读到事务内未提交的写入
+	if s, ok := ctx.Value(txCtxKey{}).(*txState); ok {
+		return s.tx
+	}
+	if m.SQL == nil {
+		return m.RdDB
+	}
+	return m.SQL.Reader(ctx)
+}
+
+type txCtxKey struct{}
+
+// sqlDB 为 goqu.Database 与 goqu.TxDatabase 共有的查询构造方法
+type sqlDB interface {
+	From(from ...interface{}) *goqu.SelectDataset
+	Select(cols ...interface{}) *goqu.SelectDataset
+	Insert(table interface{}) *goqu.InsertDataset
+	Update(table interface{}) *goqu.UpdateDataset
+	Delete(table interface{}) *goqu.DeleteDataset
+}
+
+// txState 进行中的事务，以及事务提交后才执行的操作
+type txState struct {
+	tx          *goqu.TxDatabase
+	mu          sync.Mutex
+	afterCommit []func(context.Context)
+}
+
+// db 返回 ctx 中进行中的事务，没有则返回主库
+func (m *Model) db(ctx context.Context) sqlDB {
+	if s, ok := ctx.Value(txCtxKey{}).(*txState); ok {
+		return s.tx
+	}
+	return m.DB
+}
+
+// Transaction 在事务中执行 fn，fn 中使用其 ctx 调用的 model 写操作都在该事务中执行，fn 返回错误则回滚。
+// ctx 已处于事务中时直接执行 fn
+func (m *Model) Transaction(ctx context.Context, fn func(context.Context) error) (err error) {
+	if _, ok := ctx.Value(txCtxKey{}).(*txState); ok {
+		return fn(ctx)
+	}
+
+	tctx, span := tracing.StartChild(ctx, "transaction")
+	defer func() { tracing.End(span, err) }()
+	tx, err := m.SQL.BeginTx(tctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return err
+	}
+	s := &txState{tx: tx}
+	if err = tx.Wrap(func() error {
+		return fn(context.WithValue(tctx, txCtxKey{}, s))
+	}); err != nil {
+		return err
+	}
+	for _, f := range s.afterCommit {
+		f(ctx)
+	}
+	return nil
+}
+
+// afterCommit ctx 处于事务中时，登记 fn 在事务提交后执行（回滚则不执行）并返回 true，否则返回 false
+func afterCommit(ctx context.Context, fn func(context.Context)) bool {
+	s, ok := ctx.Value(txCtxKey{}).(*txState)
+	if !ok {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.afterCommit = append(s.afterCommit, fn)
+	return true
+}
+
+// goAfterCommit 同 util.Go，ctx 处于事务中时在事务提交后才启动，避免后台任务读到未提交的数据
+func goAfterCommit(ctx context.Context, du time.Duration, fn func(context.Context)) {
+	if !afterCommit(ctx, func(context.Context) { util.Go(ctx, du, fn) }) {
+		util.Go(ctx, du, fn)
+	}
+}
+
 func (m *Model) findOneByID(ctx context.Context, table string, id int64, i interface{}) error {
 	if id <= 0 || table == "" {
 		return fmt.Errorf("invalid id %d or table %s for findOneByID", id, table)
 	}
 
-	db := m.DB
+	db := m.db(ctx)
 	if ctx.Value(ReadDB) != nil {
-		db = m.RdDB
+		db = m.rdDB(ctx)
 	}
 	sd := db.From(table).Where(goqu.C("id").Eq(id)).Order(goqu.C("id").Asc()).Limit(1)
 
@@ -168,9 +422,9 @@ func (m *Model) findOneByCols(ctx context.Context, table string, cls goqu.Ex, se
 		return false, fmt.Errorf("invalid clause %v for findOneByCols", cls)
 	}
 
-	db := m.DB
+	db := m.db(ctx)
 	if ctx.Value(ReadDB) != nil {
-		db = m.RdDB
+		db = m.rdDB(ctx)
 	}
 	sd := db.From(table).Where(cls).Order(goqu.C("id").Asc()).Limit(1)
 	if selectStr != "" {
@@ -180,11 +434,31 @@ func (m *Model) findOneByCols(ctx context.Context, table string, cls goqu.Ex, se
 	return sd.Executor().ScanStructContext(ctx, i)
 }
 
+// auditBefore 请求需要记录审计日志时，读取变更前的数据记录到审计日志
+func (m *Model) auditBefore(ctx context.Context, table string, id int64, obj interface{}) {
+	if !service.HasAuditLog(ctx) {
+		return
+	}
+	if err := m.findOneByID(ctx, table, id, obj); err == nil {
+		service.SetAuditBefore(ctx, obj)
+	}
+}
+
+// auditBeforeByCols 同 auditBefore，按条件读取变更前的数据
+func (m *Model) auditBeforeByCols(ctx context.Context, table string, cls goqu.Ex, obj interface{}) {
+	if !service.HasAuditLog(ctx) {
+		return
+	}
+	if ok, err := m.findOneByCols(ctx, table, cls, "", obj); err == nil && ok {
+		service.SetAuditBefore(ctx, obj)
+	}
+}
+
 func (m *Model) createOne(ctx context.Context, table string, obj interface{}) (int64, error) {
 	if obj == nil {
 		return 0, fmt.Errorf("invalid obj for createOne")
 	}
-	sd := m.DB.Insert(table).Rows(obj)
+	sd := m.db(ctx).Insert(table).Rows(obj)
 	res, err := sd.Executor().ExecContext(ctx)
 	if err != nil {
 		return 0, err
@@ -223,7 +497,7 @@ func (m *Model) updateByCols(ctx context.Context, table string, cls goqu.Ex, cha
 	if len(changed) == 0 {
 		return 0, nil
 	}
-	sd := m.DB.Update(table).Where(cls).Set(changed)
+	sd := m.db(ctx).Update(table).Where(cls).Set(changed)
 	return service.DeResult(sd.Executor().ExecContext(ctx))
 }
 
@@ -240,13 +514,13 @@ func (m *Model) deleteByCols(ctx context.Context, table string, cls goqu.Ex) (in
 		return 0, fmt.Errorf("invalid clause %v for deleteByCols", cls)
 	}
 
-	sd := m.DB.Delete(table).Where(cls)
+	sd := m.db(ctx).Delete(table).Where(cls)
 	return service.DeResult(sd.Executor().ExecContext(ctx))
 }
 
 func (m *Model) offlineLabels(ctx context.Context, cls goqu.Ex) error {
 	ids := make([]int64, 0)
-	sd := m.DB.Select("id").
+	sd := m.db(ctx).Select("id").
 		From(goqu.T(schema.TableLabel)).
 		Where(cls)
 	if err := sd.Executor().ScanValsContext(ctx, &ids); err != nil {
@@ -262,7 +536,7 @@ func (m *Model) offlineLabels(ctx context.Context, cls goqu.Ex) error {
 		"status":     -1,
 	})
 	if rowsAffected > 0 {
-		util.Go(10*time.Second, func(gctx context.Context) {
+		goAfterCommit(ctx, 10*time.Second, func(gctx context.Context) {
 			m.tryIncreaseStatisticStatus(gctx, schema.LabelsTotalSize, -int(rowsAffected))
 			m.tryDeleteLabelsRules(gctx, ids)
 			m.tryDeleteUserAndGroupLabels(gctx, ids)
@@ -274,7 +548,7 @@ func (m *Model) offlineLabels(ctx context.Context, cls goqu.Ex) error {
 func (m *Model) offlineSettingsInModule(ctx context.Context, moduleID int64, cls goqu.Ex) error {
 	cls["module_id"] = moduleID
 	ids := make([]int64, 0)
-	sd := m.DB.Select("id").
+	sd := m.db(ctx).Select("id").
 		From(goqu.T(schema.TableSetting)).
 		Where(cls)
 	if err := sd.Executor().ScanValsContext(ctx, &ids); err != nil {
@@ -290,7 +564,7 @@ func (m *Model) offlineSettingsInModule(ctx context.Context, moduleID int64, cls
 		"status":     -1,
 	})
 	if rowsAffected > 0 {
-		util.Go(10*time.Second, func(gctx context.Context) {
+		goAfterCommit(ctx, 10*time.Second, func(gctx context.Context) {
 			m.tryIncreaseStatisticStatus(gctx, schema.SettingsTotalSize, -int(rowsAffected))
 			m.tryDeleteSettingsRules(gctx, ids)
 			m.tryDeleteUserAndGroupSettings(gctx, ids)
@@ -302,7 +576,7 @@ func (m *Model) offlineSettingsInModule(ctx context.Context, moduleID int64, cls
 
 func (m *Model) offlineModules(ctx context.Context, cls goqu.Ex) error {
 	ids := make([]int64, 0)
-	sd := m.DB.Select("id").
+	sd := m.db(ctx).Select("id").
 		From(goqu.T(schema.TableModule)).
 		Where(cls)
 	if err := sd.Executor().ScanValsContext(ctx, &ids); err != nil {
@@ -318,7 +592,7 @@ func (m *Model) offlineModules(ctx context.Context, cls goqu.Ex) error {
 		"status":     -1,
 	})
 	if rowsAffected > 0 {
-		util.Go(5*time.Second, func(gctx context.Context) {
+		goAfterCommit(ctx, 5*time.Second, func(gctx context.Context) {
 			m.tryIncreaseStatisticStatus(gctx, schema.ModulesTotalSize, -int(rowsAffected))
 		})
 		for i := range ids {
@@ -330,10 +604,13 @@ func (m *Model) offlineModules(ctx context.Context, cls goqu.Ex) error {
 	return err
 }
 
-func (m *Model) lock(ctx context.Context, key string, expire time.Duration) error {
+func (m *Model) lock(ctx context.Context, key string, expire time.Duration) (err error) {
+	ctx, span := tracing.StartChild(ctx, "urbs_lock acquire", label.String("lock.key", key))
+	defer func() { tracing.End(span, err) }()
+
 	now := time.Now().UTC()
 	lock := &schema.Lock{Name: key, ExpireAt: now.Add(expire)}
-	_, err := m.DB.Insert(schema.TableLock).Rows(lock).Executor().ExecContext(ctx)
+	_, err = m.DB.Insert(schema.TableLock).Rows(lock).Executor().ExecContext(ctx)
 	if err != nil {
 		l := &schema.Lock{}
 		sd := m.DB.From(schema.TableLock).Where(goqu.C("name").Eq(key)).Order(goqu.C("id").Asc()).Limit(1)
@@ -348,19 +625,38 @@ func (m *Model) lock(ctx context.Context, key string, expire time.Duration) erro
 		}
 	}
 	if err != nil {
+		metrics.LockFailures.WithLabelValues(metrics.LockPrefix(key)).Inc()
 		err = fmt.Errorf("%s locked, should expire at: %v, error: %s", key, lock.ExpireAt, err.Error())
 	}
 	return err
 }
 
 func (m *Model) unlock(ctx context.Context, key string) {
+	ctx, span := tracing.StartChild(ctx, "urbs_lock release", label.String("lock.key", key))
 	sd := m.DB.Delete(schema.TableLock).Where(goqu.C("name").Eq(key))
 	_, err := service.DeResult(sd.Executor().ExecContext(ctx))
+	tracing.End(span, err)
 	if err != nil {
 		logging.Warningf("unlock: key %s, error %v", key, err)
 	}
 }
 
+// observeLabelRuleHits 记录命中的环境标签发布规则，并累加环境标签当天的 rule_hits
+func observeLabelRuleHits(rules ...schema.LabelRule) {
+	for _, rule := range rules {
+		metrics.RuleHits.WithLabelValues("label", strconv.FormatInt(rule.ProductID, 10)).Inc()
+		incrDaily(rule.ProductID, schema.MetricRuleHits, schema.StatisticKindLabel, rule.LabelID, 1)
+	}
+}
+
+// observeSettingRuleHits 记录命中的配置项发布规则，并累加配置项当天的 rule_hits
+func observeSettingRuleHits(rules ...schema.SettingRule) {
+	for _, rule := range rules {
+		metrics.RuleHits.WithLabelValues("setting", strconv.FormatInt(rule.ProductID, 10)).Inc()
+		incrDaily(rule.ProductID, schema.MetricRuleHits, schema.StatisticKindSetting, rule.SettingID, 1)
+	}
+}
+
 // tryRefreshLabelStatus 更新指定 label 的 Status（环境标签灰度进度，被作用的用户数，非精确）值
 // 比如用户因为属于 n 个群组而被重复设置环境标签
 func (m *Model) tryRefreshLabelStatus(ctx context.Context, labelID int64) {
@@ -435,6 +731,57 @@ func (m *Model) refreshSettingStatus(ctx context.Context, settingID int64) error
 	return err
 }
 
+// reconcileStatus 对账 table 中 id 大于 afterID 的至多 limit 个未下线的环境标签或配置项，返回最后一个的 ID 和对账的数量。
+// status 重新计算为直接设置的用户数与通过群组设置的成员数之和（不去重，与异步增减的口径一致），
+// exact_status 为两者去重后的用户数。通过发布规则设置的用户已写入 userTable，包含在直接设置的用户中
+func (m *Model) reconcileStatus(ctx context.Context, table, userTable, groupTable, col string, afterID int64, limit int) (int64, int, error) {
+	ids := make([]int64, 0, limit)
+	sd := m.DB.From(table).Select("id").
+		Where(goqu.C("id").Gt(afterID), goqu.C("offline_at").IsNull()).
+		Order(goqu.C("id").Asc()).Limit(uint(limit))
+	if err := sd.Executor().ScanValsContext(ctx, &ids); err != nil {
+		return afterID, 0, err
+	}
+
+	for i, id := range ids {
+		direct := m.DB.From(userTable).Select("user_id").Where(goqu.C(col).Eq(id))
+		viaGroup := m.DB.From(goqu.T(groupTable).As("t1")).
+			Join(goqu.T(schema.TableUserGroup).As("t2"), goqu.On(goqu.I("t2.group_id").Eq(goqu.I("t1.group_id")))).
+			Select(goqu.I("t2.user_id")).
+			Where(goqu.I("t1." + col).Eq(id))
+
+		directCount, err := direct.CountContext(ctx)
+		if err != nil {
+			return afterID, i, err
+		}
+		groupCount, err := viaGroup.CountContext(ctx)
+		if err != nil {
+			return afterID, i, err
+		}
+		exact, err := m.DB.From(direct.Union(viaGroup)).CountContext(ctx)
+		if err != nil {
+			return afterID, i, err
+		}
+
+		// 保持 updated_at 不变，对账不视为对象的修改
+		now := time.Now().UTC()
+		_, err = m.DB.Update(table).
+			Where(goqu.C("id").Eq(id), goqu.C("offline_at").IsNull()).
+			Set(goqu.Record{
+				"status":        directCount + groupCount,
+				"exact_status":  exact,
+				"reconciled_at": &now,
+				"updated_at":    goqu.I("updated_at"),
+			}).
+			Executor().ExecContext(ctx)
+		if err != nil {
+			return afterID, i, err
+		}
+		afterID = id
+	}
+	return afterID, len(ids), nil
+}
+
 // tryRefreshGroupStatus 更新指定 group 的 Status（成员数量统计）值
 func (m *Model) tryRefreshGroupStatus(ctx context.Context, groupID int64) {
 	if err := m.refreshGroupStatus(ctx, groupID); err != nil {
@@ -648,6 +995,38 @@ func (m *Model) refreshSettingsTotalSize(ctx context.Context) error {
 	return m.updateStatisticStatus(ctx, schema.SettingsTotalSize, count)
 }
 
+// refreshLabelRulesTotalSize 更新环境标签发布规则总数
+func (m *Model) refreshLabelRulesTotalSize(ctx context.Context) error {
+	key := string(schema.LabelRulesTotalSize)
+	if err := m.lock(ctx, key, time.Minute); err != nil {
+		return err
+	}
+	defer m.unlock(ctx, key)
+
+	count, err := m.DB.From(schema.TableLabelRule).CountContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	return m.updateStatisticStatus(ctx, schema.LabelRulesTotalSize, count)
+}
+
+// refreshSettingRulesTotalSize 更新配置项发布规则总数
+func (m *Model) refreshSettingRulesTotalSize(ctx context.Context) error {
+	key := string(schema.SettingRulesTotalSize)
+	if err := m.lock(ctx, key, time.Minute); err != nil {
+		return err
+	}
+	defer m.unlock(ctx, key)
+
+	count, err := m.DB.From(schema.TableSettingRule).CountContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	return m.updateStatisticStatus(ctx, schema.SettingRulesTotalSize, count)
+}
+
 func (m *Model) tryIncreaseLabelsStatus(ctx context.Context, labelIDs []int64, delta int) {
 	if err := m.increaseLabelsStatus(ctx, labelIDs, delta); err != nil {
 		logging.Debugf("increaseLabelsStatus: labelIDs [%v], delta: %d, error %v", labelIDs, delta, err)
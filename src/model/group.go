@@ -5,12 +5,12 @@ import (
 	"time"
 
 	"github.com/doug-martin/goqu/v9"
+	"github.com/doug-martin/goqu/v9/exp"
 	"github.com/teambition/gear"
 	"github.com/teambition/urbs-setting/src/dto"
 	"github.com/teambition/urbs-setting/src/schema"
 	"github.com/teambition/urbs-setting/src/service"
 	"github.com/teambition/urbs-setting/src/tpl"
-	"github.com/teambition/urbs-setting/src/util"
 )
 
 // Group ...
@@ -62,8 +62,8 @@ func (m *Group) AcquireID(ctx context.Context, kind, uid string) (int64, error)
 func (m *Group) Find(ctx context.Context, kind string, pg tpl.Pagination) ([]schema.Group, int, error) {
 	groups := make([]schema.Group, 0)
 	cursor := pg.TokenToID()
-	sdc := m.RdDB.From(schema.TableGroup)
-	sd := m.RdDB.From(schema.TableGroup).Where(goqu.C("id").Lte(cursor))
+	sdc := m.rdDB(ctx).From(schema.TableGroup)
+	sd := m.rdDB(ctx).From(schema.TableGroup).Where(goqu.C("id").Lte(cursor))
 	if kind != "" {
 		sdc = sdc.Where(goqu.C("kind").Eq(kind))
 		sd = sd.Where(goqu.C("kind").Eq(kind))
@@ -90,7 +90,7 @@ func (m *Group) FindLabels(ctx context.Context, groupID int64, pg tpl.Pagination
 	data := make([]tpl.MyLabel, 0)
 	cursor := pg.TokenToID()
 
-	sdc := m.RdDB.Select().
+	sdc := m.rdDB(ctx).Select().
 		From(
 			goqu.T(schema.TableGroupLabel).As("t1"),
 			goqu.T(schema.TableLabel).As("t2"),
@@ -99,7 +99,7 @@ func (m *Group) FindLabels(ctx context.Context, groupID int64, pg tpl.Pagination
 			goqu.I("t1.group_id").Eq(groupID),
 			goqu.I("t1.label_id").Eq(goqu.I("t2.id")))
 
-	sd := m.RdDB.Select(
+	sd := m.rdDB(ctx).Select(
 		goqu.I("t1.rls"),
 		goqu.I("t1.created_at").As("assigned_at"),
 		goqu.I("t2.id"),
@@ -154,7 +154,7 @@ func (m *Group) FindSettings(ctx context.Context, groupID, productID, moduleID,
 	data := []tpl.MySetting{}
 	cursor := pg.TokenToID()
 
-	sdc := m.RdDB.Select().
+	sdc := m.rdDB(ctx).Select().
 		From(
 			goqu.T(schema.TableGroupSetting).As("t1"),
 			goqu.T(schema.TableSetting).As("t2"),
@@ -162,7 +162,7 @@ func (m *Group) FindSettings(ctx context.Context, groupID, productID, moduleID,
 			goqu.T(schema.TableProduct).As("t4")).
 		Where(goqu.I("t1.group_id").Eq(groupID))
 
-	sd := m.RdDB.Select(
+	sd := m.rdDB(ctx).Select(
 		goqu.I("t1.rls"),
 		goqu.I("t1.updated_at").As("assigned_at"),
 		goqu.I("t1.value"),
@@ -261,11 +261,11 @@ func (m *Group) BatchAdd(ctx context.Context, groups []tpl.GroupBody) error {
 		vals[i] = goqu.Vals{g.UID, g.Kind, syncAt, g.Desc}
 	}
 
-	sd := m.DB.Insert(schema.TableGroup).Cols("uid", "kind", "sync_at", "description").
+	sd := m.db(ctx).Insert(schema.TableGroup).Cols("uid", "kind", "sync_at", "description").
 		Vals(vals...).OnConflict(goqu.DoNothing())
 	rowsAffected, err := service.DeResult(sd.Executor().ExecContext(ctx))
 	if rowsAffected > 0 {
-		util.Go(10*time.Second, func(gctx context.Context) {
+		goAfterCommit(ctx, 10*time.Second, func(gctx context.Context) {
 			m.tryRefreshGroupsTotalSize(gctx)
 		})
 	}
@@ -274,6 +274,7 @@ func (m *Group) BatchAdd(ctx context.Context, groups []tpl.GroupBody) error {
 
 // Update 更新指定群组
 func (m *Group) Update(ctx context.Context, groupID int64, changed map[string]interface{}) (*schema.Group, error) {
+	m.auditBefore(ctx, schema.TableGroup, groupID, &schema.Group{})
 	group := &schema.Group{}
 	if _, err := m.updateByID(ctx, schema.TableGroup, groupID, goqu.Record(changed)); err != nil {
 		return nil, err
@@ -286,6 +287,7 @@ func (m *Group) Update(ctx context.Context, groupID int64, changed map[string]in
 
 // Delete 删除指定群组
 func (m *Group) Delete(ctx context.Context, groupID int64) error {
+	m.auditBefore(ctx, schema.TableGroup, groupID, &schema.Group{})
 	_, err := m.deleteByCols(ctx, schema.TableGroupLabel, goqu.Ex{"group_id": groupID})
 	if err == nil {
 		_, err = m.deleteByCols(ctx, schema.TableGroupSetting, goqu.Ex{"group_id": groupID})
@@ -298,7 +300,7 @@ func (m *Group) Delete(ctx context.Context, groupID int64) error {
 		var rowsAffected int64
 		rowsAffected, err = m.deleteByID(ctx, schema.TableGroup, groupID)
 		if rowsAffected > 0 {
-			util.Go(5*time.Second, func(gctx context.Context) {
+			goAfterCommit(ctx, 5*time.Second, func(gctx context.Context) {
 				m.tryIncreaseStatisticStatus(gctx, schema.GroupsTotalSize, -1)
 			})
 		}
@@ -312,7 +314,7 @@ func (m *Group) BatchAddMembers(ctx context.Context, group *schema.Group, users
 		return nil
 	}
 
-	sd := m.DB.Insert(schema.TableUserGroup).Cols("user_id", "group_id", "sync_at").
+	sd := m.db(ctx).Insert(schema.TableUserGroup).Cols("user_id", "group_id", "sync_at").
 		FromQuery(goqu.From(goqu.T(schema.TableUser).As("t1")).
 			Select(goqu.I("t1.id"), goqu.V(group.ID), goqu.V(group.SyncAt)).
 			Where(goqu.I("t1.uid").In(tpl.StrSliceToInterface(users)...))).
@@ -320,7 +322,7 @@ func (m *Group) BatchAddMembers(ctx context.Context, group *schema.Group, users
 
 	rowsAffected, err := service.DeResult(sd.Executor().ExecContext(ctx))
 	if rowsAffected > 0 {
-		util.Go(10*time.Second, func(gctx context.Context) {
+		goAfterCommit(ctx, 10*time.Second, func(gctx context.Context) {
 			m.tryRefreshGroupStatus(gctx, group.ID)
 		})
 	}
@@ -333,7 +335,7 @@ func (m *Group) FindMembers(ctx context.Context, groupID int64, pg tpl.Paginatio
 	data := []tpl.GroupMember{}
 	cursor := pg.TokenToID()
 
-	sdc := m.RdDB.Select().
+	sdc := m.rdDB(ctx).Select().
 		From(
 			goqu.T(schema.TableUserGroup).As("t1"),
 			goqu.T(schema.TableUser).As("t2")).
@@ -341,7 +343,7 @@ func (m *Group) FindMembers(ctx context.Context, groupID int64, pg tpl.Paginatio
 			goqu.I("t1.group_id").Eq(groupID),
 			goqu.I("t1.user_id").Eq(goqu.I("t2.id")))
 
-	sd := m.RdDB.Select(
+	sd := m.rdDB(ctx).Select(
 		goqu.I("t1.id"),
 		goqu.I("t2.uid"),
 		goqu.I("t1.created_at"),
@@ -389,7 +391,7 @@ func (m *Group) FindMembers(ctx context.Context, groupID int64, pg tpl.Paginatio
 // FindIDsByUser 根据 userID 查找加入的 Group ID 数组
 func (m *Group) FindIDsByUser(ctx context.Context, userID int64) ([]int64, error) {
 	ids := make([]int64, 0)
-	sd := m.RdDB.From(schema.TableUserGroup).Where(goqu.C("user_id").Eq(userID)).Limit(1000)
+	sd := m.rdDB(ctx).From(schema.TableUserGroup).Where(goqu.C("user_id").Eq(userID)).Limit(1000)
 	if err := sd.PluckContext(ctx, &ids, "group_id"); err != nil {
 		return nil, err
 	}
@@ -397,23 +399,51 @@ func (m *Group) FindIDsByUser(ctx context.Context, userID int64) ([]int64, error
 	return ids, nil
 }
 
-// RemoveMembers 删除群组的成员
-func (m *Group) RemoveMembers(ctx context.Context, groupID, userID int64, syncLt int64) error {
+// FindMemberIDs 按 user_group ID 游标分批返回群组成员的 user ID，返回的游标为 0 时表示已无更多成员
+func (m *Group) FindMemberIDs(ctx context.Context, groupIDs []int64, cursor int64, limit int) ([]int64, int64, error) {
+	members := make([]schema.UserGroup, 0)
+	sd := m.DB.From(schema.TableUserGroup).Select("id", "user_id").
+		Where(goqu.C("group_id").In(groupIDs), goqu.C("id").Gt(cursor)).
+		Order(goqu.C("id").Asc()).Limit(uint(limit))
+	if err := sd.Executor().ScanStructsContext(ctx, &members); err != nil {
+		return nil, 0, err
+	}
+
+	ids := make([]int64, 0, len(members))
+	for _, member := range members {
+		ids = append(ids, member.UserID)
+	}
+	if len(members) < limit {
+		return ids, 0, nil
+	}
+	return ids, members[len(members)-1].ID, nil
+}
 
-	sd := m.DB.Delete(schema.TableUserGroup).Where(goqu.C("group_id").Eq(groupID))
+// RemoveMembers 删除群组的成员，返回被删除成员的 user ID
+func (m *Group) RemoveMembers(ctx context.Context, groupID, userID int64, syncLt int64) ([]int64, error) {
+	userIDs := make([]int64, 0)
+	exps := []exp.Expression{goqu.C("group_id").Eq(groupID)}
 	if syncLt > 0 {
-		sd = sd.Where(goqu.C("sync_at").Lt(syncLt))
+		exps = append(exps, goqu.C("sync_at").Lt(syncLt))
 	} else if userID > 0 {
-		sd = sd.Where(goqu.C("user_id").Eq(userID))
+		exps = append(exps, goqu.C("user_id").Eq(userID))
 	} else {
-		return nil
+		return userIDs, nil
+	}
+
+	if err := m.db(ctx).From(schema.TableUserGroup).Where(exps...).PluckContext(ctx, &userIDs, "user_id"); err != nil {
+		return nil, err
+	}
+	if len(userIDs) == 0 {
+		return userIDs, nil
 	}
 
+	sd := m.db(ctx).Delete(schema.TableUserGroup).Where(exps...)
 	res, err := service.DeResult(sd.Executor().ExecContext(ctx))
 	if res > 0 {
-		util.Go(10*time.Second, func(gctx context.Context) {
+		goAfterCommit(ctx, 10*time.Second, func(gctx context.Context) {
 			m.tryRefreshGroupStatus(gctx, groupID)
 		})
 	}
-	return err
+	return userIDs, err
 }
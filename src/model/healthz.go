@@ -3,6 +3,10 @@ package model
 import (
 	"context"
 	"database/sql"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/teambition/urbs-setting/src/schema"
 )
 
 // Healthz ...
@@ -14,3 +18,55 @@ type Healthz struct {
 func (m *Healthz) DBStats(ctx context.Context) sql.DBStats {
 	return m.SQL.DBStats()
 }
+
+// PingDB 检查主库连接
+func (m *Healthz) PingDB(ctx context.Context) error {
+	return m.SQL.Ping(ctx)
+}
+
+// PingRdDB 检查从库连接
+func (m *Healthz) PingRdDB(ctx context.Context) error {
+	return m.SQL.RdPing(ctx)
+}
+
+// ReplicaLag 返回最近一次检测到的从库延迟，未配置独立从库时 ok 为 false
+func (m *Healthz) ReplicaLag() (lag time.Duration, ok bool) {
+	return m.SQL.ReplicaLag(), m.SQL.HasReplica()
+}
+
+// PendingMigrations 返回尚未执行的数据库结构升级版本，按 information_schema 检查 schema.Migrations 中的表和列
+func (m *Healthz) PendingMigrations(ctx context.Context) ([]string, error) {
+	tables := make([]string, 0, len(schema.Migrations))
+	for _, mg := range schema.Migrations {
+		tables = append(tables, mg.Table)
+	}
+
+	columns := make([]struct {
+		Table  string `db:"table_name"`
+		Column string `db:"column_name"`
+	}, 0)
+	sd := m.DB.From(goqu.T("columns").Schema("information_schema")).
+		Select(goqu.C("table_name").As("table_name"), goqu.C("column_name").As("column_name")).
+		Where(goqu.C("table_schema").Eq(goqu.L("DATABASE()")), goqu.C("table_name").In(tables))
+	if err := sd.Executor().ScanStructsContext(ctx, &columns); err != nil {
+		return nil, err
+	}
+
+	exists := make(map[string]bool, len(columns))
+	for _, c := range columns {
+		exists[c.Table] = true
+		exists[c.Table+"."+c.Column] = true
+	}
+
+	pending := make([]string, 0)
+	for _, mg := range schema.Migrations {
+		key := mg.Table
+		if mg.Column != "" {
+			key += "." + mg.Column
+		}
+		if !exists[key] && (len(pending) == 0 || pending[len(pending)-1] != mg.Version) {
+			pending = append(pending, mg.Version)
+		}
+	}
+	return pending, nil
+}
@@ -0,0 +1,140 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/teambition/gear"
+	"github.com/teambition/urbs-setting/src/schema"
+	"github.com/teambition/urbs-setting/src/service"
+	"github.com/teambition/urbs-setting/src/tpl"
+)
+
+// Job ...
+type Job struct {
+	*Model
+}
+
+// Create 创建一个运行中的后台任务
+func (m *Job) Create(ctx context.Context, kind, target string) (*schema.Job, error) {
+	if len(target) > 255 {
+		target = target[:255]
+	}
+	job := &schema.Job{Kind: kind, Target: target, Status: schema.JobRunning}
+	if _, err := m.createOne(ctx, schema.TableJob, job); err != nil {
+		return nil, err
+	}
+	job.HID = service.IDToHID(job.ID, "job")
+	return job, nil
+}
+
+// Acquire ...
+func (m *Job) Acquire(ctx context.Context, id int64) (*schema.Job, error) {
+	job := &schema.Job{}
+	if err := m.findOneByID(ctx, schema.TableJob, id, job); err != nil {
+		return nil, err
+	}
+	job.HID = service.IDToHID(job.ID, "job")
+	return job, nil
+}
+
+// Find 根据条件查找后台任务
+func (m *Job) Find(ctx context.Context, kind string, pg tpl.Pagination) ([]schema.Job, int, error) {
+	jobs := make([]schema.Job, 0)
+	cursor := pg.TokenToID()
+	sdc := m.rdDB(ctx).From(schema.TableJob)
+	sd := m.rdDB(ctx).From(schema.TableJob).Where(goqu.C("id").Lte(cursor))
+	if kind != "" {
+		sdc = sdc.Where(goqu.C("kind").Eq(kind))
+		sd = sd.Where(goqu.C("kind").Eq(kind))
+	}
+	if pg.Q != "" {
+		sdc = sdc.Where(goqu.C("target").ILike(pg.Q))
+		sd = sd.Where(goqu.C("target").ILike(pg.Q))
+	}
+	sd = sd.Order(goqu.C("id").Desc()).Limit(uint(pg.PageSize + 1))
+
+	total, err := sdc.CountContext(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	err = sd.Executor().ScanStructsContext(ctx, &jobs)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range jobs {
+		jobs[i].HID = service.IDToHID(jobs[i].ID, "job")
+	}
+	return jobs, int(total), nil
+}
+
+// UpdateProgress 更新后台任务的进度
+func (m *Job) UpdateProgress(ctx context.Context, id int64, processed, invalidated, failed int64) error {
+	_, err := m.updateByID(ctx, schema.TableJob, id, goqu.Record{"processed": processed, "invalidated": invalidated, "failed": failed})
+	return err
+}
+
+// Finish 结束后台任务，jobErr 不为 nil 时任务状态为失败
+func (m *Job) Finish(ctx context.Context, id int64, processed, invalidated, failed int64, jobErr error) error {
+	changed := goqu.Record{
+		"status":      schema.JobSucceeded,
+		"processed":   processed,
+		"invalidated": invalidated,
+		"failed":      failed,
+		"finished_at": time.Now().UTC(),
+	}
+	if jobErr != nil {
+		msg := jobErr.Error()
+		if len(msg) > 1022 {
+			msg = msg[:1022]
+		}
+		changed["status"] = schema.JobFailed
+		changed["message"] = msg
+	}
+	rowsAffected, err := m.updateByID(ctx, schema.TableJob, id, changed)
+	if err == nil && rowsAffected == 0 {
+		err = gear.ErrNotFound.WithMsgf("job %d not found", id)
+	}
+	return err
+}
+
+// AddErrors 记录导入任务中无效的行
+func (m *Job) AddErrors(ctx context.Context, jobID int64, errs []schema.JobError) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	vals := make([][]interface{}, len(errs))
+	for i, e := range errs {
+		uid, msg := e.UID, e.Message
+		if len(uid) > 63 {
+			uid = uid[:63]
+		}
+		if len(msg) > 1022 {
+			msg = msg[:1022]
+		}
+		vals[i] = goqu.Vals{jobID, e.Line, uid, msg}
+	}
+	sd := m.DB.Insert(schema.TableJobError).Cols("job_id", "line", "uid", "message").Vals(vals...)
+	_, err := sd.Executor().ExecContext(ctx)
+	return err
+}
+
+// FindErrors 返回导入任务中无效的行，按行号倒序
+func (m *Job) FindErrors(ctx context.Context, jobID int64, pg tpl.Pagination) ([]schema.JobError, int, error) {
+	errs := make([]schema.JobError, 0)
+	cursor := pg.TokenToID()
+	sdc := m.rdDB(ctx).From(schema.TableJobError).Where(goqu.C("job_id").Eq(jobID))
+	sd := m.rdDB(ctx).From(schema.TableJobError).
+		Where(goqu.C("job_id").Eq(jobID), goqu.C("id").Lte(cursor)).
+		Order(goqu.C("id").Desc()).Limit(uint(pg.PageSize + 1))
+
+	total, err := sdc.CountContext(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := sd.Executor().ScanStructsContext(ctx, &errs); err != nil {
+		return nil, 0, err
+	}
+	return errs, int(total), nil
+}
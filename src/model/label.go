@@ -9,7 +9,6 @@ import (
 	"github.com/teambition/urbs-setting/src/schema"
 	"github.com/teambition/urbs-setting/src/service"
 	"github.com/teambition/urbs-setting/src/tpl"
-	"github.com/teambition/urbs-setting/src/util"
 )
 
 // Label ...
@@ -45,19 +44,21 @@ func (m *Label) Acquire(ctx context.Context, productID int64, labelName string)
 	return label, nil
 }
 
-// AcquireID ...
+// AcquireID 返回名称对应的 ID，优先从进程内缓存读取
 func (m *Label) AcquireID(ctx context.Context, productID int64, labelName string) (int64, error) {
-	label, err := m.FindByName(ctx, productID, labelName, "id, offline_at")
-	if err != nil {
-		return 0, err
-	}
-	if label == nil {
-		return 0, gear.ErrNotFound.WithMsgf("label %s not found", labelName)
-	}
-	if label.OfflineAt != nil {
-		return 0, gear.ErrNotFound.WithMsgf("label %s was offline", labelName)
-	}
-	return label.ID, nil
+	return m.acquireIDWithCache(ctx, labelNameKey(productID, labelName), func(ctx context.Context) (int64, error) {
+		label, err := m.FindByName(ctx, productID, labelName, "id, offline_at")
+		if err != nil {
+			return 0, err
+		}
+		if label == nil {
+			return 0, gear.ErrNotFound.WithMsgf("label %s not found", labelName)
+		}
+		if label.OfflineAt != nil {
+			return 0, gear.ErrNotFound.WithMsgf("label %s was offline", labelName)
+		}
+		return label.ID, nil
+	})
 }
 
 // AcquireByID ...
@@ -77,13 +78,13 @@ func (m *Label) Find(ctx context.Context, productID int64, pg tpl.Pagination) ([
 	labels := make([]schema.Label, 0)
 	cursor := pg.TokenToID()
 
-	sdc := m.RdDB.Select().
+	sdc := m.rdDB(ctx).Select().
 		From(goqu.T(schema.TableLabel)).
 		Where(
 			goqu.C("product_id").Eq(productID),
 			goqu.C("offline_at").IsNull())
 
-	sd := m.RdDB.Select().
+	sd := m.rdDB(ctx).Select().
 		From(goqu.T(schema.TableLabel)).
 		Where(
 			goqu.C("product_id").Eq(productID),
@@ -109,11 +110,16 @@ func (m *Label) Find(ctx context.Context, productID int64, pg tpl.Pagination) ([
 	return labels, int(total), nil
 }
 
+// ReconcileStatus 对账 ID 大于 afterID 的至多 limit 个未下线环境标签的 status 和 exact_status，返回最后一个的 ID 和对账的数量
+func (m *Label) ReconcileStatus(ctx context.Context, afterID int64, limit int) (int64, int, error) {
+	return m.reconcileStatus(ctx, schema.TableLabel, schema.TableUserLabel, schema.TableGroupLabel, "label_id", afterID, limit)
+}
+
 // Create ...
 func (m *Label) Create(ctx context.Context, label *schema.Label) error {
 	rowsAffected, err := m.createOne(ctx, schema.TableLabel, label)
 	if rowsAffected > 0 {
-		util.Go(5*time.Second, func(gctx context.Context) {
+		goAfterCommit(ctx, 5*time.Second, func(gctx context.Context) {
 			m.tryIncreaseStatisticStatus(gctx, schema.LabelsTotalSize, 1)
 		})
 	}
@@ -122,6 +128,8 @@ func (m *Label) Create(ctx context.Context, label *schema.Label) error {
 
 // Update 更新指定环境标签
 func (m *Label) Update(ctx context.Context, labelID int64, changed map[string]interface{}) (*schema.Label, error) {
+	m.auditBefore(ctx, schema.TableLabel, labelID, &schema.Label{})
+	defer m.invalidateNameIDCache(ctx)
 	label := &schema.Label{}
 	if _, err := m.updateByID(ctx, schema.TableLabel, labelID, goqu.Record(changed)); err != nil {
 		return nil, err
@@ -134,6 +142,8 @@ func (m *Label) Update(ctx context.Context, labelID int64, changed map[string]in
 
 // Offline 标记 label 下线，同时真删除用户和群组的 labels
 func (m *Label) Offline(ctx context.Context, labelID int64) error {
+	m.auditBefore(ctx, schema.TableLabel, labelID, &schema.Label{})
+	defer m.invalidateNameIDCache(ctx)
 	return m.offlineLabels(ctx, goqu.Ex{"id": labelID, "offline_at": nil})
 }
 
@@ -148,7 +158,7 @@ func (m *Label) Assign(ctx context.Context, labelID int64, users []string, group
 
 	releaseInfo := &tpl.LabelReleaseInfo{Release: release, Users: []string{}, Groups: []string{}}
 	if len(users) > 0 {
-		sd := m.DB.Insert(schema.TableUserLabel).Cols("user_id", "label_id", "rls").
+		sd := m.db(ctx).Insert(schema.TableUserLabel).Cols("user_id", "label_id", "rls").
 			FromQuery(goqu.From(goqu.T(schema.TableUser).As("t1")).
 				Select(goqu.I("t1.id"), goqu.V(labelID), goqu.V(release)).
 				Where(goqu.I("t1.uid").In(tpl.StrSliceToInterface(users)...))).
@@ -161,7 +171,7 @@ func (m *Label) Assign(ctx context.Context, labelID int64, users []string, group
 
 		totalRowsAffected += rowsAffected
 		if rowsAffected > 0 {
-			sd := m.DB.Select(goqu.I("t2.uid")).
+			sd := m.db(ctx).Select(goqu.I("t2.uid")).
 				From(
 					goqu.T(schema.TableUserLabel).As("t1"),
 					goqu.T(schema.TableUser).As("t2")).
@@ -184,7 +194,7 @@ func (m *Label) Assign(ctx context.Context, labelID int64, users []string, group
 		}
 		var rowsAffecteds int64
 		for k, v := range groupsMap {
-			sd := m.DB.Insert(schema.TableGroupLabel).Cols("group_id", "label_id", "rls").
+			sd := m.db(ctx).Insert(schema.TableGroupLabel).Cols("group_id", "label_id", "rls").
 				FromQuery(goqu.From(goqu.T(schema.TableGroup).As("t1")).
 					Select(goqu.I("t1.id"), goqu.V(labelID), goqu.V(release)).
 					Where(goqu.I("t1.uid").In(tpl.StrSliceToInterface(v)...), goqu.I("t1.kind").Eq(k))).
@@ -199,7 +209,7 @@ func (m *Label) Assign(ctx context.Context, labelID int64, users []string, group
 
 		totalRowsAffected += rowsAffecteds
 		if rowsAffecteds > 0 {
-			sd := m.DB.Select(goqu.I("t2.uid")).
+			sd := m.db(ctx).Select(goqu.I("t2.uid")).
 				From(
 					goqu.T(schema.TableGroupLabel).As("t1"),
 					goqu.T(schema.TableGroup).As("t2")).
@@ -216,7 +226,7 @@ func (m *Label) Assign(ctx context.Context, labelID int64, users []string, group
 	}
 
 	if totalRowsAffected > 0 {
-		util.Go(10*time.Second, func(gctx context.Context) {
+		goAfterCommit(ctx, 10*time.Second, func(gctx context.Context) {
 			m.tryRefreshLabelStatus(gctx, labelID)
 		})
 	}
@@ -225,12 +235,15 @@ func (m *Label) Assign(ctx context.Context, labelID int64, users []string, group
 
 // Delete 对标签进行物理删除
 func (m *Label) Delete(ctx context.Context, id int64) error {
+	m.auditBefore(ctx, schema.TableLabel, id, &schema.Label{})
+	defer m.invalidateNameIDCache(ctx)
 	_, err := m.deleteByID(ctx, schema.TableLabel, id)
 	return err
 }
 
 // Cleanup 清除产品环境标签下所有的用户、群组和百分比规则
 func (m *Label) Cleanup(ctx context.Context, id int64) error {
+	m.auditBefore(ctx, schema.TableLabel, id, &schema.Label{})
 	_, err := m.deleteByCols(ctx, schema.TableLabelRule, goqu.Ex{"label_id": id})
 	if err != nil {
 		return err
@@ -249,9 +262,10 @@ func (m *Label) Cleanup(ctx context.Context, id int64) error {
 
 // RemoveUserLabel 删除用户的 label
 func (m *Label) RemoveUserLabel(ctx context.Context, userID, labelID int64) (int64, error) {
+	m.auditBeforeByCols(ctx, schema.TableUserLabel, goqu.Ex{"user_id": userID, "label_id": labelID}, &schema.UserLabel{})
 	rowsAffected, err := m.deleteByCols(ctx, schema.TableUserLabel, goqu.Ex{"user_id": userID, "label_id": labelID})
 	if rowsAffected > 0 {
-		util.Go(5*time.Second, func(gctx context.Context) {
+		goAfterCommit(ctx, 5*time.Second, func(gctx context.Context) {
 			m.tryIncreaseLabelsStatus(gctx, []int64{labelID}, -1)
 		})
 	}
@@ -260,9 +274,10 @@ func (m *Label) RemoveUserLabel(ctx context.Context, userID, labelID int64) (int
 
 // RemoveGroupLabel 删除群组的 label
 func (m *Label) RemoveGroupLabel(ctx context.Context, groupID, labelID int64) (int64, error) {
+	m.auditBeforeByCols(ctx, schema.TableGroupLabel, goqu.Ex{"group_id": groupID, "label_id": labelID}, &schema.GroupLabel{})
 	rowsAffected, err := m.deleteByCols(ctx, schema.TableGroupLabel, goqu.Ex{"group_id": groupID, "label_id": labelID})
 	if rowsAffected > 0 {
-		util.Go(10*time.Second, func(gctx context.Context) {
+		goAfterCommit(ctx, 10*time.Second, func(gctx context.Context) {
 			m.tryRefreshLabelStatus(gctx, labelID)
 		})
 	}
@@ -284,13 +299,23 @@ func (m *Label) Recall(ctx context.Context, labelID, release int64) error {
 	}
 	totalRowsAffected += rowsAffected
 	if totalRowsAffected > 0 {
-		util.Go(10*time.Second, func(gctx context.Context) {
+		goAfterCommit(ctx, 10*time.Second, func(gctx context.Context) {
 			m.tryRefreshLabelStatus(gctx, labelID)
 		})
 	}
 	return nil
 }
 
+// FindGroupIDsByRelease 返回在指定发布批次中被指派该标签的群组 ID
+func (m *Label) FindGroupIDsByRelease(ctx context.Context, labelID, release int64) ([]int64, error) {
+	ids := make([]int64, 0)
+	sd := m.db(ctx).From(schema.TableGroupLabel).Where(goqu.C("label_id").Eq(labelID), goqu.C("rls").Eq(release))
+	if err := sd.PluckContext(ctx, &ids, "group_id"); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
 // AcquireRelease ...
 func (m *Label) AcquireRelease(ctx context.Context, labelID int64) (int64, error) {
 	label := &schema.Label{}
@@ -312,7 +337,7 @@ func (m *Label) ListUsers(ctx context.Context, labelID int64, pg tpl.Pagination)
 	data := []tpl.LabelUserInfo{}
 	cursor := pg.TokenToID()
 
-	sdc := m.RdDB.Select().
+	sdc := m.rdDB(ctx).Select().
 		From(
 			goqu.T(schema.TableUserLabel).As("t1"),
 			goqu.T(schema.TableUser).As("t2")).
@@ -320,7 +345,7 @@ func (m *Label) ListUsers(ctx context.Context, labelID int64, pg tpl.Pagination)
 			goqu.I("t1.label_id").Eq(labelID),
 			goqu.I("t1.user_id").Eq(goqu.I("t2.id")))
 
-	sd := m.RdDB.Select(
+	sd := m.rdDB(ctx).Select(
 		goqu.I("t1.id"),
 		goqu.I("t1.created_at").As("assigned_at"),
 		goqu.I("t1.rls"),
@@ -370,7 +395,7 @@ func (m *Label) ListUsers(ctx context.Context, labelID int64, pg tpl.Pagination)
 func (m *Label) ListGroups(ctx context.Context, labelID int64, pg tpl.Pagination) ([]tpl.LabelGroupInfo, int, error) {
 	data := []tpl.LabelGroupInfo{}
 	cursor := pg.TokenToID()
-	sdc := m.RdDB.Select().
+	sdc := m.rdDB(ctx).Select().
 		From(
 			goqu.T(schema.TableGroupLabel).As("t1"),
 			goqu.T(schema.TableGroup).As("t2")).
@@ -378,7 +403,7 @@ func (m *Label) ListGroups(ctx context.Context, labelID int64, pg tpl.Pagination
 			goqu.I("t1.label_id").Eq(labelID),
 			goqu.I("t1.group_id").Eq(goqu.I("t2.id")))
 
-	sd := m.RdDB.Select(
+	sd := m.rdDB(ctx).Select(
 		goqu.I("t1.id"),
 		goqu.I("t1.created_at").As("assigned_at"),
 		goqu.I("t1.rls"),
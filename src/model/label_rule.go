@@ -26,7 +26,7 @@ func (m *LabelRule) ApplyRules(ctx context.Context, productID int64, userID int6
 	if productID > 0 {
 		exps = append(exps, goqu.C("product_id").Eq(productID))
 	}
-	sd := m.RdDB.From(schema.TableLabelRule).Where(exps...).Order(goqu.C("updated_at").Desc()).Limit(200)
+	sd := m.rdDB(ctx).From(schema.TableLabelRule).Where(exps...).Order(goqu.C("updated_at").Desc()).Limit(200)
 	err := sd.Executor().ScanStructsContext(ctx, &rules)
 	if err != nil {
 		return 0, err
@@ -47,7 +47,7 @@ func (m *LabelRule) ApplyRule(ctx context.Context, productID int64, userID int64
 		goqu.C("label_id").Eq(labelID),
 		goqu.C("product_id").Eq(productID),
 	}
-	sd := m.RdDB.From(schema.TableLabelRule).Where(exps...).Order(goqu.C("updated_at").Desc()).Limit(200)
+	sd := m.rdDB(ctx).From(schema.TableLabelRule).Where(exps...).Order(goqu.C("updated_at").Desc()).Limit(200)
 	err := sd.Executor().ScanStructsContext(ctx, &rules)
 	if err != nil {
 		return 0, err
@@ -61,8 +61,7 @@ func (m *LabelRule) ApplyRule(ctx context.Context, productID int64, userID int64
 
 // ComputeUserRule ...
 func (m *LabelRule) ComputeUserRule(ctx context.Context, userID int64, excludeLabels []int64, rules []schema.LabelRule) (int, error) {
-	ids := make([]interface{}, 0)
-	labelIDs := make([]int64, 0)
+	hits := make([]schema.LabelRule, 0)
 	for _, rule := range rules {
 		if tpl.Int64SliceHas(excludeLabels, rule.LabelID) {
 			continue
@@ -72,15 +71,16 @@ func (m *LabelRule) ComputeUserRule(ctx context.Context, userID int64, excludeLa
 
 		if p > 0 && (int((userID+rule.CreatedAt.Unix())%100) <= p) {
 			// 百分比规则无效或者用户不在百分比区间内
-			ids = append(ids, rule.ID)
-			labelIDs = append(labelIDs, rule.LabelID)
+			hits = append(hits, rule)
 		}
 	}
 
-	if len(ids) > 0 {
-		index := rand.Intn(len(ids))
-		ids = []interface{}{ids[index]}
-		labelIDs = []int64{labelIDs[index]}
+	ids := make([]interface{}, 0)
+	if len(hits) > 0 {
+		hit := hits[rand.Intn(len(hits))]
+		ids = append(ids, hit.ID)
+		labelIDs := []int64{hit.LabelID}
+		observeLabelRuleHits(hit)
 
 		sd := m.DB.Insert(schema.TableUserLabel).Cols("user_id", "label_id", "rls").
 			FromQuery(goqu.From(goqu.T(schema.TableLabelRule).As("t1")).
@@ -93,7 +93,7 @@ func (m *LabelRule) ComputeUserRule(ctx context.Context, userID int64, excludeLa
 		}
 
 		if rowsAffected > 0 {
-			util.Go(5*time.Second, func(gctx context.Context) {
+			util.Go(ctx, 5*time.Second, func(gctx context.Context) {
 				m.tryIncreaseLabelsStatus(gctx, labelIDs, 1)
 			})
 		}
@@ -104,7 +104,7 @@ func (m *LabelRule) ComputeUserRule(ctx context.Context, userID int64, excludeLa
 // ApplyRulesToAnonymous ...
 func (m *LabelRule) ApplyRulesToAnonymous(ctx context.Context, anonymousID string, productID int64, kind string) ([]schema.UserCacheLabel, error) {
 	rules := []schema.LabelRule{}
-	sd := m.RdDB.From(schema.TableLabelRule).
+	sd := m.rdDB(ctx).From(schema.TableLabelRule).
 		Where(
 			goqu.C("kind").Eq(kind),
 			goqu.C("product_id").Eq(productID)).
@@ -121,12 +121,13 @@ func (m *LabelRule) ApplyRulesToAnonymous(ctx context.Context, anonymousID strin
 		if p > 0 && (int((anonID+rule.CreatedAt.Unix())%100) <= p) {
 			// 百分比规则无效或者用户不在百分比区间内
 			labelIDs = append(labelIDs, rule.LabelID)
+			observeLabelRuleHits(rule)
 		}
 	}
 
 	data := make([]schema.UserCacheLabel, 0)
 	if len(labelIDs) > 0 {
-		sd := m.RdDB.Select(
+		sd := m.rdDB(ctx).Select(
 			goqu.I("t1.id"),
 			goqu.I("t1.name"),
 			goqu.I("t1.channels"),
@@ -181,7 +182,7 @@ func (m *LabelRule) Acquire(ctx context.Context, labelRuleID int64) (*schema.Lab
 // Find ...
 func (m *LabelRule) Find(ctx context.Context, productID, labelID int64) ([]schema.LabelRule, error) {
 	labelRules := make([]schema.LabelRule, 0)
-	sd := m.RdDB.From(schema.TableLabelRule).
+	sd := m.rdDB(ctx).From(schema.TableLabelRule).
 		Where(goqu.C("product_id").Eq(productID), goqu.C("label_id").Eq(labelID)).
 		Order(goqu.C("id").Desc()).Limit(10)
 
@@ -194,12 +195,18 @@ func (m *LabelRule) Find(ctx context.Context, productID, labelID int64) ([]schem
 
 // Create ...
 func (m *LabelRule) Create(ctx context.Context, labelRule *schema.LabelRule) error {
-	_, err := m.createOne(ctx, schema.TableLabelRule, labelRule)
+	rowsAffected, err := m.createOne(ctx, schema.TableLabelRule, labelRule)
+	if rowsAffected > 0 {
+		goAfterCommit(ctx, 5*time.Second, func(gctx context.Context) {
+			m.tryIncreaseStatisticStatus(gctx, schema.LabelRulesTotalSize, 1)
+		})
+	}
 	return err
 }
 
 // Update ...
 func (m *LabelRule) Update(ctx context.Context, labelRuleID int64, changed map[string]interface{}) (*schema.LabelRule, error) {
+	m.auditBefore(ctx, schema.TableLabelRule, labelRuleID, &schema.LabelRule{})
 	labelRule := &schema.LabelRule{}
 	if _, err := m.updateByID(ctx, schema.TableLabelRule, labelRuleID, goqu.Record(changed)); err != nil {
 		return nil, err
@@ -212,5 +219,12 @@ func (m *LabelRule) Update(ctx context.Context, labelRuleID int64, changed map[s
 
 // Delete ...
 func (m *LabelRule) Delete(ctx context.Context, id int64) (int64, error) {
-	return m.deleteByID(ctx, schema.TableLabelRule, id)
+	m.auditBefore(ctx, schema.TableLabelRule, id, &schema.LabelRule{})
+	rowsAffected, err := m.deleteByID(ctx, schema.TableLabelRule, id)
+	if rowsAffected > 0 {
+		goAfterCommit(ctx, 5*time.Second, func(gctx context.Context) {
+			m.tryIncreaseStatisticStatus(gctx, schema.LabelRulesTotalSize, -int(rowsAffected))
+		})
+	}
+	return rowsAffected, err
 }
@@ -8,7 +8,6 @@ import (
 	"github.com/teambition/gear"
 	"github.com/teambition/urbs-setting/src/schema"
 	"github.com/teambition/urbs-setting/src/tpl"
-	"github.com/teambition/urbs-setting/src/util"
 )
 
 // Module ...
@@ -45,32 +44,34 @@ func (m *Module) Acquire(ctx context.Context, productID int64, moduleName string
 	return module, nil
 }
 
-// AcquireID ...
+// AcquireID 返回名称对应的 ID，优先从进程内缓存读取
 func (m *Module) AcquireID(ctx context.Context, productID int64, moduleName string) (int64, error) {
-	module, err := m.FindByName(ctx, productID, moduleName, "id, offline_at")
-	if err != nil {
-		return 0, err
-	}
-	if module == nil {
-		return 0, gear.ErrNotFound.WithMsgf("module %s not found", moduleName)
-	}
-	if module.OfflineAt != nil {
-		return 0, gear.ErrNotFound.WithMsgf("module %s was offline", moduleName)
-	}
-	return module.ID, nil
+	return m.acquireIDWithCache(ctx, moduleNameKey(productID, moduleName), func(ctx context.Context) (int64, error) {
+		module, err := m.FindByName(ctx, productID, moduleName, "id, offline_at")
+		if err != nil {
+			return 0, err
+		}
+		if module == nil {
+			return 0, gear.ErrNotFound.WithMsgf("module %s not found", moduleName)
+		}
+		if module.OfflineAt != nil {
+			return 0, gear.ErrNotFound.WithMsgf("module %s was offline", moduleName)
+		}
+		return module.ID, nil
+	})
 }
 
 // Find 根据条件查找 modules
 func (m *Module) Find(ctx context.Context, productID int64, pg tpl.Pagination) ([]schema.Module, int, error) {
 	modules := make([]schema.Module, 0)
 	cursor := pg.TokenToID()
-	sdc := m.RdDB.Select().
+	sdc := m.rdDB(ctx).Select().
 		From(goqu.T(schema.TableModule)).
 		Where(
 			goqu.C("product_id").Eq(productID),
 			goqu.C("offline_at").IsNull())
 
-	sd := m.RdDB.Select().
+	sd := m.rdDB(ctx).Select().
 		From(goqu.T(schema.TableModule)).
 		Where(
 			goqu.C("id").Lte(cursor),
@@ -100,7 +101,7 @@ func (m *Module) Find(ctx context.Context, productID int64, pg tpl.Pagination) (
 func (m *Module) Create(ctx context.Context, module *schema.Module) error {
 	rowsAffected, err := m.createOne(ctx, schema.TableModule, module)
 	if rowsAffected > 0 {
-		util.Go(5*time.Second, func(gctx context.Context) {
+		goAfterCommit(ctx, 5*time.Second, func(gctx context.Context) {
 			m.tryIncreaseStatisticStatus(gctx, schema.ModulesTotalSize, 1)
 		})
 	}
@@ -109,6 +110,8 @@ func (m *Module) Create(ctx context.Context, module *schema.Module) error {
 
 // Update 更新指定功能模块
 func (m *Module) Update(ctx context.Context, moduleID int64, changed map[string]interface{}) (*schema.Module, error) {
+	m.auditBefore(ctx, schema.TableModule, moduleID, &schema.Module{})
+	defer m.invalidateNameIDCache(ctx)
 	module := &schema.Module{}
 	if _, err := m.updateByID(ctx, schema.TableModule, moduleID, goqu.Record(changed)); err != nil {
 		return nil, err
@@ -121,5 +124,7 @@ func (m *Module) Update(ctx context.Context, moduleID int64, changed map[string]
 
 // Offline 标记模块下线
 func (m *Module) Offline(ctx context.Context, moduleID int64) error {
+	m.auditBefore(ctx, schema.TableModule, moduleID, &schema.Module{})
+	defer m.invalidateNameIDCache(ctx)
 	return m.offlineModules(ctx, goqu.Ex{"id": moduleID, "offline_at": nil})
 }
@@ -0,0 +1,122 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/teambition/urbs-setting/src/conf"
+	"github.com/teambition/urbs-setting/src/logging"
+	"github.com/teambition/urbs-setting/src/schema"
+	"github.com/teambition/urbs-setting/src/tracing"
+	"github.com/teambition/urbs-setting/src/util"
+	"go.opentelemetry.io/otel/label"
+)
+
+// nameIDs 产品、功能模块、配置项和环境标签名称到 ID 的进程内缓存，进程内共享。
+// 本地的 Update/Offline/Delete 操作会清空缓存，并增加 urbs_statistic 中的版本号，
+// 其它实例检测到版本号变化后也会清空缓存。
+var nameIDs = newNameIDCache()
+
+type nameIDCache struct {
+	version   int64 // 原子操作
+	checkedAt int64 // 原子操作，unix nano
+	checking  int32 // 原子操作
+	cache     *util.TTLCache
+}
+
+func newNameIDCache() *nameIDCache {
+	cfg := conf.Config.NameCache
+	if cfg.TTLDuration() <= 0 {
+		return &nameIDCache{}
+	}
+	return &nameIDCache{cache: util.NewTTLCache(cfg.TTLDuration(), cfg.MaxEntries)}
+}
+
+func productNameKey(name string) string {
+	return "product:" + name
+}
+
+func moduleNameKey(productID int64, name string) string {
+	return fmt.Sprintf("module:%d:%s", productID, name)
+}
+
+func settingNameKey(moduleID int64, name string) string {
+	return fmt.Sprintf("setting:%d:%s", moduleID, name)
+}
+
+func labelNameKey(productID int64, name string) string {
+	return fmt.Sprintf("label:%d:%s", productID, name)
+}
+
+// acquireIDWithCache 优先从缓存读取名称对应的 ID，未命中时调用 fn 查询并缓存
+// fn 使用传入的 ctx 查询，查询语句的 span 为 acquireID span 的子 span
+func (m *Model) acquireIDWithCache(ctx context.Context, key string, fn func(context.Context) (int64, error)) (id int64, err error) {
+	ctx, span := tracing.StartChild(ctx, "acquireID", label.String("name.key", key))
+	defer func() { tracing.End(span, err) }()
+
+	if nameIDs.cache == nil {
+		return fn(ctx)
+	}
+
+	m.trySyncNameIDCache(ctx)
+	if val, ok := nameIDs.cache.Get(key); ok {
+		span.SetAttributes(label.Bool("name.cache_hit", true))
+		return val.(int64), nil
+	}
+
+	span.SetAttributes(label.Bool("name.cache_hit", false))
+	version := atomic.LoadInt64(&nameIDs.version)
+	id, err = fn(ctx)
+	// 查询期间缓存被清空则不再写入，避免写入已失效的数据
+	if err == nil && version == atomic.LoadInt64(&nameIDs.version) {
+		nameIDs.cache.Set(key, id)
+	}
+	return id, err
+}
+
+// invalidateNameIDCache 清空本地缓存，并增加版本号通知其它实例
+func (m *Model) invalidateNameIDCache(ctx context.Context) {
+	if nameIDs.cache == nil {
+		return
+	}
+	// 事务中的变更在提交后再清空缓存，避免提交前被其它请求读到旧数据重新写入缓存
+	if afterCommit(ctx, m.invalidateNameIDCache) {
+		return
+	}
+
+	atomic.AddInt64(&nameIDs.version, 1)
+	nameIDs.cache.Purge()
+	if err := m.increaseStatisticStatus(ctx, schema.NameCacheVersion, 1); err != nil {
+		logging.Warningf("invalidateNameIDCache: error %v", err)
+	}
+}
+
+// trySyncNameIDCache 按 sync_interval 异步检测版本号，版本号变化则清空本地缓存
+func (m *Model) trySyncNameIDCache(ctx context.Context) {
+	now := time.Now().UnixNano()
+	interval := int64(conf.Config.NameCache.SyncIntervalDuration())
+	if now-atomic.LoadInt64(&nameIDs.checkedAt) < interval {
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&nameIDs.checking, 0, 1) {
+		return
+	}
+
+	util.Go(ctx, 5*time.Second, func(gctx context.Context) {
+		defer atomic.StoreInt32(&nameIDs.checking, 0)
+
+		var version int64
+		sd := m.DB.From(schema.TableStatistic).Select("status").Where(goqu.C("name").Eq(schema.NameCacheVersion))
+		if _, err := sd.Executor().ScanValContext(gctx, &version); err != nil {
+			logging.Debugf("syncNameIDCache: error %v", err)
+			return
+		}
+		atomic.StoreInt64(&nameIDs.checkedAt, time.Now().UnixNano())
+		if old := atomic.SwapInt64(&nameIDs.version, version); old != version {
+			nameIDs.cache.Purge()
+		}
+	})
+}
@@ -8,7 +8,6 @@ import (
 	"github.com/teambition/gear"
 	"github.com/teambition/urbs-setting/src/schema"
 	"github.com/teambition/urbs-setting/src/tpl"
-	"github.com/teambition/urbs-setting/src/util"
 )
 
 // Product ...
@@ -48,35 +47,46 @@ func (m *Product) Acquire(ctx context.Context, productName string) (*schema.Prod
 	return product, nil
 }
 
-// AcquireID ...
-func (m *Product) AcquireID(ctx context.Context, productName string) (int64, error) {
-	product, err := m.FindByName(ctx, productName, "id, offline_at, deleted_at")
-	if err != nil {
-		return 0, err
-	}
-	if product == nil {
-		return 0, gear.ErrNotFound.WithMsgf("product %s not found", productName)
-	}
-	if product.DeletedAt != nil {
-		return 0, gear.ErrNotFound.WithMsgf("product %s was deleted", productName)
-	}
-	if product.OfflineAt != nil {
-		return 0, gear.ErrNotFound.WithMsgf("product %s was offline", productName)
+// AcquireByID 根据 ID 返回产品，包括已下线和已删除的产品
+func (m *Product) AcquireByID(ctx context.Context, productID int64) (*schema.Product, error) {
+	product := &schema.Product{}
+	if err := m.findOneByID(ctx, schema.TableProduct, productID, product); err != nil {
+		return nil, err
 	}
-	return product.ID, nil
+	return product, nil
+}
+
+// AcquireID 返回名称对应的 ID，优先从进程内缓存读取
+func (m *Product) AcquireID(ctx context.Context, productName string) (int64, error) {
+	return m.acquireIDWithCache(ctx, productNameKey(productName), func(ctx context.Context) (int64, error) {
+		product, err := m.FindByName(ctx, productName, "id, offline_at, deleted_at")
+		if err != nil {
+			return 0, err
+		}
+		if product == nil {
+			return 0, gear.ErrNotFound.WithMsgf("product %s not found", productName)
+		}
+		if product.DeletedAt != nil {
+			return 0, gear.ErrNotFound.WithMsgf("product %s was deleted", productName)
+		}
+		if product.OfflineAt != nil {
+			return 0, gear.ErrNotFound.WithMsgf("product %s was offline", productName)
+		}
+		return product.ID, nil
+	})
 }
 
 // Find 根据条件查找 products
 func (m *Product) Find(ctx context.Context, pg tpl.Pagination) ([]schema.Product, int, error) {
 	products := make([]schema.Product, 0)
 	cursor := pg.TokenToID()
-	sdc := m.RdDB.Select().
+	sdc := m.rdDB(ctx).Select().
 		From(goqu.T(schema.TableProduct)).
 		Where(
 			goqu.C("deleted_at").IsNull(),
 			goqu.C("offline_at").IsNull())
 
-	sd := m.RdDB.Select().
+	sd := m.rdDB(ctx).Select().
 		From(goqu.T(schema.TableProduct)).
 		Where(
 			goqu.C("id").Lte(cursor),
@@ -105,7 +115,7 @@ func (m *Product) Find(ctx context.Context, pg tpl.Pagination) ([]schema.Product
 func (m *Product) Create(ctx context.Context, product *schema.Product) error {
 	rowsAffected, err := m.createOne(ctx, schema.TableProduct, product)
 	if rowsAffected > 0 {
-		util.Go(5*time.Second, func(gctx context.Context) {
+		goAfterCommit(ctx, 5*time.Second, func(gctx context.Context) {
 			m.tryIncreaseStatisticStatus(gctx, schema.ProductsTotalSize, 1)
 		})
 	}
@@ -114,6 +124,8 @@ func (m *Product) Create(ctx context.Context, product *schema.Product) error {
 
 // Update 更新指定功能模块
 func (m *Product) Update(ctx context.Context, productID int64, changed map[string]interface{}) (*schema.Product, error) {
+	m.auditBefore(ctx, schema.TableProduct, productID, &schema.Product{})
+	defer m.invalidateNameIDCache(ctx)
 	product := &schema.Product{}
 	if _, err := m.updateByID(ctx, schema.TableProduct, productID, goqu.Record(changed)); err != nil {
 		return nil, err
@@ -126,13 +138,15 @@ func (m *Product) Update(ctx context.Context, productID int64, changed map[strin
 
 // Offline 下线产品
 func (m *Product) Offline(ctx context.Context, productID int64) error {
+	m.auditBefore(ctx, schema.TableProduct, productID, &schema.Product{})
+	defer m.invalidateNameIDCache(ctx)
 	now := time.Now().UTC()
 	rowsAffected, err := m.updateByCols(ctx, schema.TableProduct,
 		goqu.Ex{"id": productID, "offline_at": nil},
 		goqu.Record{"offline_at": &now, "status": -1},
 	)
 	if rowsAffected > 0 {
-		util.Go(5*time.Second, func(gctx context.Context) {
+		goAfterCommit(ctx, 5*time.Second, func(gctx context.Context) {
 			m.tryIncreaseStatisticStatus(gctx, schema.ProductsTotalSize, -1)
 		})
 
@@ -142,7 +156,7 @@ func (m *Product) Offline(ctx context.Context, productID int64) error {
 		}
 
 		if err == nil {
-			util.Go(20*time.Second, func(gctx context.Context) {
+			goAfterCommit(ctx, 20*time.Second, func(gctx context.Context) {
 				m.tryRefreshModulesTotalSize(gctx)
 				m.tryRefreshSettingsTotalSize(gctx)
 			})
@@ -153,6 +167,8 @@ func (m *Product) Offline(ctx context.Context, productID int64) error {
 
 // Delete 对产品进行逻辑删除
 func (m *Product) Delete(ctx context.Context, productID int64) error {
+	m.auditBefore(ctx, schema.TableProduct, productID, &schema.Product{})
+	defer m.invalidateNameIDCache(ctx)
 	now := time.Now().UTC()
 	_, err := m.updateByID(ctx, schema.TableProduct, productID, goqu.Record{"deleted_at": &now})
 	return err
@@ -161,9 +177,10 @@ func (m *Product) Delete(ctx context.Context, productID int64) error {
 // Statistics 返回产品的统计数据
 func (m *Product) Statistics(ctx context.Context, productID int64) (*tpl.ProductStatistics, error) {
 	res := &tpl.ProductStatistics{}
-	sd := m.RdDB.Select(
+	sd := m.rdDB(ctx).Select(
 		goqu.COUNT("id").As("labels"),
 		goqu.L("IFNULL(SUM(`status`), 0)").As("status"),
+		goqu.L("IFNULL(SUM(`exact_status`), 0)").As("exact_status"),
 		goqu.L("IFNULL(SUM(`rls`), 0)").As("release")).
 		From(goqu.T(schema.TableLabel)).
 		Where(
@@ -175,7 +192,7 @@ func (m *Product) Statistics(ctx context.Context, productID int64) (*tpl.Product
 	}
 
 	moduleIDs := make([]int64, 0)
-	sd = m.RdDB.Select("id").
+	sd = m.rdDB(ctx).Select("id").
 		From(goqu.T(schema.TableModule)).
 		Where(
 			goqu.C("product_id").Eq(productID),
@@ -186,9 +203,10 @@ func (m *Product) Statistics(ctx context.Context, productID int64) (*tpl.Product
 
 	if len(moduleIDs) > 0 {
 		res.Modules = int64(len(moduleIDs))
-		sd = m.RdDB.Select(
+		sd = m.rdDB(ctx).Select(
 			goqu.COUNT("id").As("settings"),
 			goqu.L("IFNULL(SUM(`status`), 0)").As("status"),
+			goqu.L("IFNULL(SUM(`exact_status`), 0)").As("exact_status"),
 			goqu.L("IFNULL(SUM(`rls`), 0)").As("release")).
 			From(goqu.T(schema.TableSetting)).
 			Where(
@@ -202,6 +220,7 @@ func (m *Product) Statistics(ctx context.Context, productID int64) (*tpl.Product
 
 		res.Settings = res2.Settings
 		res.Status += res2.Status
+		res.ExactStatus += res2.ExactStatus
 		res.Release += res2.Release
 	}
 	return res, nil
@@ -0,0 +1,75 @@
+package model
+
+import (
+	"context"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/teambition/urbs-setting/src/schema"
+	"github.com/teambition/urbs-setting/src/service"
+	"github.com/teambition/urbs-setting/src/tpl"
+)
+
+// RoleBinding ...
+type RoleBinding struct {
+	*Model
+}
+
+// FindBySubject 返回请求者的全部角色，包括全局角色和各产品下的角色
+func (m *RoleBinding) FindBySubject(ctx context.Context, subject string) ([]schema.RoleBinding, error) {
+	bindings := make([]schema.RoleBinding, 0)
+	sd := m.rdDB(ctx).From(schema.TableRoleBinding).
+		Where(goqu.C("subject").Eq(subject)).
+		Order(goqu.C("id").Asc()).Limit(1000)
+	if err := sd.Executor().ScanStructsContext(ctx, &bindings); err != nil {
+		return nil, err
+	}
+	return bindings, nil
+}
+
+// Find 返回指定范围内的角色，productID 为 0 时返回全局角色，subject 不为空时只返回该请求者的角色
+func (m *RoleBinding) Find(ctx context.Context, productID int64, subject string, pg tpl.Pagination) ([]schema.RoleBinding, int, error) {
+	bindings := make([]schema.RoleBinding, 0)
+	cursor := pg.TokenToID()
+	cls := goqu.Ex{"product_id": productID}
+	if subject != "" {
+		cls["subject"] = subject
+	}
+	sdc := m.rdDB(ctx).From(schema.TableRoleBinding).Where(cls)
+	sd := m.rdDB(ctx).From(schema.TableRoleBinding).
+		Where(cls, goqu.C("id").Lte(cursor)).
+		Order(goqu.C("id").Desc()).Limit(uint(pg.PageSize + 1))
+
+	total, err := sdc.CountContext(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err = sd.Executor().ScanStructsContext(ctx, &bindings); err != nil {
+		return nil, 0, err
+	}
+	return bindings, int(total), nil
+}
+
+// Upsert 授予请求者指定范围内的角色，已有角色时替换
+func (m *RoleBinding) Upsert(ctx context.Context, subject string, productID int64, role string) (*schema.RoleBinding, error) {
+	cls := goqu.Ex{"subject": subject, "product_id": productID}
+	m.auditBeforeByCols(ctx, schema.TableRoleBinding, cls, &schema.RoleBinding{})
+	sd := m.db(ctx).Insert(schema.TableRoleBinding).
+		Rows(goqu.Record{"subject": subject, "product_id": productID, "role": role}).
+		OnConflict(goqu.DoUpdate("subject", goqu.C("role").Set(goqu.V(role))))
+	if _, err := service.DeResult(sd.Executor().ExecContext(ctx)); err != nil {
+		return nil, err
+	}
+
+	binding := &schema.RoleBinding{}
+	if _, err := m.findOneByCols(ctx, schema.TableRoleBinding, cls, "", binding); err != nil {
+		return nil, err
+	}
+	return binding, nil
+}
+
+// Delete 撤销请求者指定范围内的角色
+func (m *RoleBinding) Delete(ctx context.Context, subject string, productID int64) (int64, error) {
+	cls := goqu.Ex{"subject": subject, "product_id": productID}
+	m.auditBeforeByCols(ctx, schema.TableRoleBinding, cls, &schema.RoleBinding{})
+	return m.deleteByCols(ctx, schema.TableRoleBinding, cls)
+}
@@ -9,7 +9,6 @@ import (
 	"github.com/teambition/urbs-setting/src/schema"
 	"github.com/teambition/urbs-setting/src/service"
 	"github.com/teambition/urbs-setting/src/tpl"
-	"github.com/teambition/urbs-setting/src/util"
 )
 
 // Setting ...
@@ -47,19 +46,21 @@ func (m *Setting) Acquire(ctx context.Context, moduleID int64, settingName strin
 	return setting, nil
 }
 
-// AcquireID ...
+// AcquireID 返回名称对应的 ID，优先从进程内缓存读取
 func (m *Setting) AcquireID(ctx context.Context, moduleID int64, settingName string) (int64, error) {
-	setting, err := m.FindByName(ctx, moduleID, settingName, "id, offline_at")
-	if err != nil {
-		return 0, err
-	}
-	if setting == nil {
-		return 0, gear.ErrNotFound.WithMsgf("setting %s not found", settingName)
-	}
-	if setting.OfflineAt != nil {
-		return 0, gear.ErrNotFound.WithMsgf("setting %s was offline", settingName)
-	}
-	return setting.ID, nil
+	return m.acquireIDWithCache(ctx, settingNameKey(moduleID, settingName), func(ctx context.Context) (int64, error) {
+		setting, err := m.FindByName(ctx, moduleID, settingName, "id, offline_at")
+		if err != nil {
+			return 0, err
+		}
+		if setting == nil {
+			return 0, gear.ErrNotFound.WithMsgf("setting %s not found", settingName)
+		}
+		if setting.OfflineAt != nil {
+			return 0, gear.ErrNotFound.WithMsgf("setting %s was offline", settingName)
+		}
+		return setting.ID, nil
+	})
 }
 
 // AcquireByID ...
@@ -79,7 +80,7 @@ func (m *Setting) Find(ctx context.Context, productID, moduleID int64, pg tpl.Pa
 	data := make([]schema.Setting, 0)
 	cursor := pg.TokenToID()
 
-	sdc := m.RdDB.Select().
+	sdc := m.rdDB(ctx).Select().
 		From(
 			goqu.T(schema.TableSetting).As("t1"),
 			goqu.T(schema.TableModule).As("t2")).
@@ -87,7 +88,7 @@ func (m *Setting) Find(ctx context.Context, productID, moduleID int64, pg tpl.Pa
 			goqu.I("t2.product_id").Eq(productID),
 			goqu.I("t2.offline_at").IsNull())
 
-	sd := m.RdDB.Select(
+	sd := m.rdDB(ctx).Select(
 		goqu.I("t1.id"),
 		goqu.I("t1.created_at"),
 		goqu.I("t1.updated_at"),
@@ -98,6 +99,8 @@ func (m *Setting) Find(ctx context.Context, productID, moduleID int64, pg tpl.Pa
 		goqu.I("t1.vals"),
 		goqu.I("t1.status"),
 		goqu.I("t1.rls"),
+		goqu.I("t1.exact_status"),
+		goqu.I("t1.reconciled_at"),
 		goqu.I("t2.name").As("module")).
 		From(
 			goqu.T(schema.TableSetting).As("t1"),
@@ -151,11 +154,16 @@ func (m *Setting) Find(ctx context.Context, productID, moduleID int64, pg tpl.Pa
 	return data, int(total), nil
 }
 
+// ReconcileStatus 对账 ID 大于 afterID 的至多 limit 个未下线配置项的 status 和 exact_status，返回最后一个的 ID 和对账的数量
+func (m *Setting) ReconcileStatus(ctx context.Context, afterID int64, limit int) (int64, int, error) {
+	return m.reconcileStatus(ctx, schema.TableSetting, schema.TableUserSetting, schema.TableGroupSetting, "setting_id", afterID, limit)
+}
+
 // Create ...
 func (m *Setting) Create(ctx context.Context, setting *schema.Setting) error {
 	rowsAffected, err := m.createOne(ctx, schema.TableSetting, setting)
 	if rowsAffected > 0 {
-		util.Go(5*time.Second, func(gctx context.Context) {
+		goAfterCommit(ctx, 5*time.Second, func(gctx context.Context) {
 			m.tryIncreaseModulesStatus(gctx, []int64{setting.ModuleID}, 1)
 			m.tryIncreaseStatisticStatus(gctx, schema.SettingsTotalSize, 1)
 		})
@@ -165,6 +173,8 @@ func (m *Setting) Create(ctx context.Context, setting *schema.Setting) error {
 
 // Update 更新指定功能模块配置项
 func (m *Setting) Update(ctx context.Context, settingID int64, changed map[string]interface{}) (*schema.Setting, error) {
+	m.auditBefore(ctx, schema.TableSetting, settingID, &schema.Setting{})
+	defer m.invalidateNameIDCache(ctx)
 	setting := &schema.Setting{}
 	if _, err := m.updateByID(ctx, schema.TableSetting, settingID, goqu.Record(changed)); err != nil {
 		return nil, err
@@ -177,6 +187,8 @@ func (m *Setting) Update(ctx context.Context, settingID int64, changed map[strin
 
 // Offline 标记配置项下线，同时真删除用户和群组的配置项值
 func (m *Setting) Offline(ctx context.Context, moduleID, settingID int64) error {
+	m.auditBefore(ctx, schema.TableSetting, settingID, &schema.Setting{})
+	defer m.invalidateNameIDCache(ctx)
 	return m.offlineSettingsInModule(ctx, moduleID, goqu.Ex{"id": settingID, "offline_at": nil})
 }
 
@@ -190,7 +202,7 @@ func (m *Setting) Assign(ctx context.Context, settingID int64, value string, use
 
 	releaseInfo := &tpl.SettingReleaseInfo{Release: release, Value: value, Users: []string{}, Groups: []string{}}
 	if len(users) > 0 {
-		sd := m.DB.Insert(schema.TableUserSetting).Cols("user_id", "setting_id", "value", "rls").
+		sd := m.db(ctx).Insert(schema.TableUserSetting).Cols("user_id", "setting_id", "value", "rls").
 			FromQuery(goqu.From(goqu.T(schema.TableUser).As("t1")).
 				Select(goqu.I("t1.id"), goqu.V(settingID), goqu.V(value), goqu.V(release)).
 				Where(goqu.I("t1.uid").In(tpl.StrSliceToInterface(users)...))).
@@ -207,7 +219,7 @@ func (m *Setting) Assign(ctx context.Context, settingID int64, value string, use
 
 		totalRowsAffected += rowsAffected
 		if rowsAffected > 0 {
-			sd := m.DB.Select(goqu.I("t2.uid")).
+			sd := m.db(ctx).Select(goqu.I("t2.uid")).
 				From(
 					goqu.T(schema.TableUserSetting).As("t1"),
 					goqu.T(schema.TableUser).As("t2")).
@@ -230,7 +242,7 @@ func (m *Setting) Assign(ctx context.Context, settingID int64, value string, use
 		}
 		var rowsAffecteds int64
 		for k, v := range groupsMap {
-			sd := m.DB.Insert(schema.TableGroupSetting).Cols("group_id", "setting_id", "value", "rls").
+			sd := m.db(ctx).Insert(schema.TableGroupSetting).Cols("group_id", "setting_id", "value", "rls").
 				FromQuery(goqu.From(goqu.T(schema.TableGroup).As("t1")).
 					Select(goqu.I("t1.id"), goqu.V(settingID), goqu.V(value), goqu.V(release)).
 					Where(goqu.I("t1.uid").In(tpl.StrSliceToInterface(v)...), goqu.I("t1.kind").Eq(k))).
@@ -248,7 +260,7 @@ func (m *Setting) Assign(ctx context.Context, settingID int64, value string, use
 		}
 		totalRowsAffected += rowsAffecteds
 		if rowsAffecteds > 0 {
-			sd := m.DB.Select(goqu.I("t2.uid")).
+			sd := m.db(ctx).Select(goqu.I("t2.uid")).
 				From(
 					goqu.T(schema.TableGroupSetting).As("t1"),
 					goqu.T(schema.TableGroup).As("t2")).
@@ -265,7 +277,7 @@ func (m *Setting) Assign(ctx context.Context, settingID int64, value string, use
 	}
 
 	if totalRowsAffected > 0 {
-		util.Go(10*time.Second, func(gctx context.Context) {
+		goAfterCommit(ctx, 10*time.Second, func(gctx context.Context) {
 			m.tryRefreshSettingStatus(gctx, settingID)
 		})
 	}
@@ -274,12 +286,15 @@ func (m *Setting) Assign(ctx context.Context, settingID int64, value string, use
 
 // Delete 对配置项进行物理删除
 func (m *Setting) Delete(ctx context.Context, id int64) error {
+	m.auditBefore(ctx, schema.TableSetting, id, &schema.Setting{})
+	defer m.invalidateNameIDCache(ctx)
 	_, err := m.deleteByID(ctx, schema.TableSetting, id)
 	return err
 }
 
 // Cleanup 清除指定产品功能模块配置项下所有的用户、群组和百分比规则
 func (m *Setting) Cleanup(ctx context.Context, id int64) error {
+	m.auditBefore(ctx, schema.TableSetting, id, &schema.Setting{})
 	_, err := m.deleteByCols(ctx, schema.TableSettingRule, goqu.Ex{"setting_id": id})
 	if err != nil {
 		return err
@@ -298,10 +313,11 @@ func (m *Setting) Cleanup(ctx context.Context, id int64) error {
 
 // RemoveUserSetting 删除用户的 setting
 func (m *Setting) RemoveUserSetting(ctx context.Context, userID, settingID int64) (int64, error) {
+	m.auditBeforeByCols(ctx, schema.TableUserSetting, goqu.Ex{"user_id": userID, "setting_id": settingID}, &schema.UserSetting{})
 	rowsAffected, err := m.deleteByCols(ctx, schema.TableUserSetting,
 		goqu.Ex{"user_id": userID, "setting_id": settingID})
 	if rowsAffected > 0 {
-		util.Go(5*time.Second, func(gctx context.Context) {
+		goAfterCommit(ctx, 5*time.Second, func(gctx context.Context) {
 			m.tryIncreaseSettingsStatus(gctx, []int64{settingID}, -1)
 		})
 	}
@@ -310,6 +326,7 @@ func (m *Setting) RemoveUserSetting(ctx context.Context, userID, settingID int64
 
 // RollbackUserSetting 回滚用户的 setting
 func (m *Setting) RollbackUserSetting(ctx context.Context, userID, settingID int64) error {
+	m.auditBeforeByCols(ctx, schema.TableUserSetting, goqu.Ex{"user_id": userID, "setting_id": settingID}, &schema.UserSetting{})
 	_, err := m.updateByCols(ctx, schema.TableUserSetting,
 		goqu.Ex{"user_id": userID, "setting_id": settingID},
 		goqu.Record{"value": goqu.T(schema.TableUserSetting).Col("last_value")})
@@ -318,10 +335,11 @@ func (m *Setting) RollbackUserSetting(ctx context.Context, userID, settingID int
 
 // RemoveGroupSetting 删除群组的 setting
 func (m *Setting) RemoveGroupSetting(ctx context.Context, groupID, settingID int64) (int64, error) {
+	m.auditBeforeByCols(ctx, schema.TableGroupSetting, goqu.Ex{"group_id": groupID, "setting_id": settingID}, &schema.GroupSetting{})
 	rowsAffected, err := m.deleteByCols(ctx, schema.TableGroupSetting,
 		goqu.Ex{"group_id": groupID, "setting_id": settingID})
 	if rowsAffected > 0 {
-		util.Go(10*time.Second, func(gctx context.Context) {
+		goAfterCommit(ctx, 10*time.Second, func(gctx context.Context) {
 			m.tryRefreshSettingStatus(gctx, settingID)
 		})
 	}
@@ -330,6 +348,7 @@ func (m *Setting) RemoveGroupSetting(ctx context.Context, groupID, settingID int
 
 // RollbackGroupSetting 回滚群组的 setting
 func (m *Setting) RollbackGroupSetting(ctx context.Context, groupID, settingID int64) error {
+	m.auditBeforeByCols(ctx, schema.TableGroupSetting, goqu.Ex{"group_id": groupID, "setting_id": settingID}, &schema.GroupSetting{})
 	_, err := m.updateByCols(ctx, schema.TableGroupSetting,
 		goqu.Ex{"group_id": groupID, "setting_id": settingID},
 		goqu.Record{"value": goqu.T(schema.TableGroupSetting).Col("last_value")})
@@ -351,7 +370,7 @@ func (m *Setting) Recall(ctx context.Context, settingID, release int64) error {
 	}
 	totalRowsAffected += rowsAffected
 	if totalRowsAffected > 0 {
-		util.Go(10*time.Second, func(gctx context.Context) {
+		goAfterCommit(ctx, 10*time.Second, func(gctx context.Context) {
 			m.tryRefreshSettingStatus(gctx, settingID)
 		})
 	}
@@ -380,7 +399,7 @@ func (m *Setting) ListUsers(ctx context.Context, settingID int64, pg tpl.Paginat
 	data := []tpl.SettingUserInfo{}
 	cursor := pg.TokenToID()
 
-	sdc := m.RdDB.Select().
+	sdc := m.rdDB(ctx).Select().
 		From(
 			goqu.T(schema.TableUserSetting).As("t1"),
 			goqu.T(schema.TableUser).As("t2")).
@@ -388,7 +407,7 @@ func (m *Setting) ListUsers(ctx context.Context, settingID int64, pg tpl.Paginat
 			goqu.I("t1.setting_id").Eq(settingID),
 			goqu.I("t1.user_id").Eq(goqu.I("t2.id")))
 
-	sd := m.RdDB.Select(
+	sd := m.rdDB(ctx).Select(
 		goqu.I("t1.id"),
 		goqu.I("t1.updated_at").As("assigned_at"),
 		goqu.I("t1.rls"),
@@ -440,7 +459,7 @@ func (m *Setting) ListUsers(ctx context.Context, settingID int64, pg tpl.Paginat
 func (m *Setting) ListGroups(ctx context.Context, settingID int64, pg tpl.Pagination) ([]tpl.SettingGroupInfo, int, error) {
 	data := []tpl.SettingGroupInfo{}
 	cursor := pg.TokenToID()
-	sdc := m.RdDB.Select().
+	sdc := m.rdDB(ctx).Select().
 		From(
 			goqu.T(schema.TableGroupSetting).As("t1"),
 			goqu.T(schema.TableGroup).As("t2")).
@@ -448,7 +467,7 @@ func (m *Setting) ListGroups(ctx context.Context, settingID int64, pg tpl.Pagina
 			goqu.I("t1.setting_id").Eq(settingID),
 			goqu.I("t1.group_id").Eq(goqu.I("t2.id")))
 
-	sd := m.RdDB.Select(
+	sd := m.rdDB(ctx).Select(
 		goqu.I("t1.id"),
 		goqu.I("t1.updated_at").As("assigned_at"),
 		goqu.I("t1.rls"),
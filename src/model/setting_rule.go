@@ -3,6 +3,7 @@ package model
 import (
 	"context"
 	"hash/crc32"
+	"time"
 
 	"github.com/doug-martin/goqu/v9"
 	"github.com/doug-martin/goqu/v9/exp"
@@ -23,7 +24,7 @@ func (m *SettingRule) ApplyRules(ctx context.Context, productID, userID int64, k
 	if productID > 0 {
 		exps = append(exps, goqu.C("product_id").Eq(productID))
 	}
-	sd := m.RdDB.From(schema.TableSettingRule).
+	sd := m.rdDB(ctx).From(schema.TableSettingRule).
 		Where(exps...).
 		Order(goqu.C("updated_at").Desc()).Limit(1000)
 	err := sd.Executor().ScanStructsContext(ctx, &rules)
@@ -37,6 +38,7 @@ func (m *SettingRule) ApplyRules(ctx context.Context, productID, userID int64, k
 		if p > 0 && (int((userID+rule.CreatedAt.Unix())%100) <= p) {
 			// 百分比规则无效或者用户不在百分比区间内
 			ids = append(ids, rule.ID)
+			observeSettingRuleHits(rule)
 		}
 	}
 
@@ -78,7 +80,7 @@ func (m *SettingRule) ApplyRules(ctx context.Context, productID, userID int64, k
 // ApplyRulesToAnonymous ...
 func (m *SettingRule) ApplyRulesToAnonymous(ctx context.Context, anonymousID string, productID int64, channel, client string, kind string) ([]tpl.MySetting, error) {
 	rules := []schema.SettingRule{}
-	sd := m.RdDB.From(schema.TableSettingRule).
+	sd := m.rdDB(ctx).From(schema.TableSettingRule).
 		Where(goqu.C("product_id").Eq(productID), goqu.C("kind").Eq(kind)).
 		Order(goqu.C("updated_at").Desc()).Limit(1000)
 	err := sd.Executor().ScanStructsContext(ctx, &rules)
@@ -93,12 +95,14 @@ func (m *SettingRule) ApplyRulesToAnonymous(ctx context.Context, anonymousID str
 		if p > 0 && (int((anonID+rule.CreatedAt.Unix())%100) <= p) {
 			// 百分比规则无效或者用户不在百分比区间内
 			ids = append(ids, rule.ID)
+			observeSettingRuleHits(rule)
 		}
 	}
 
 	data := make([]tpl.MySetting, 0)
 	if len(ids) > 0 {
-		sd := m.RdDB.Select(
+		sd := m.rdDB(ctx).Select(
+			goqu.I("t1.id").As("rule_id"),
 			goqu.I("t1.rls"),
 			goqu.I("t1.updated_at").As("assigned_at"),
 			goqu.I("t1.value"),
@@ -165,7 +169,7 @@ func (m *SettingRule) Acquire(ctx context.Context, settingRuleID int64) (*schema
 // Find ...
 func (m *SettingRule) Find(ctx context.Context, productID, settingID int64) ([]schema.SettingRule, error) {
 	settingRules := make([]schema.SettingRule, 0)
-	sd := m.RdDB.From(schema.TableSettingRule).
+	sd := m.rdDB(ctx).From(schema.TableSettingRule).
 		Where(goqu.C("product_id").Eq(productID), goqu.C("setting_id").Eq(settingID)).
 		Order(goqu.C("id").Desc()).Limit(10)
 
@@ -178,12 +182,18 @@ func (m *SettingRule) Find(ctx context.Context, productID, settingID int64) ([]s
 
 // Create ...
 func (m *SettingRule) Create(ctx context.Context, settingRule *schema.SettingRule) error {
-	_, err := m.createOne(ctx, schema.TableSettingRule, settingRule)
+	rowsAffected, err := m.createOne(ctx, schema.TableSettingRule, settingRule)
+	if rowsAffected > 0 {
+		goAfterCommit(ctx, 5*time.Second, func(gctx context.Context) {
+			m.tryIncreaseStatisticStatus(gctx, schema.SettingRulesTotalSize, 1)
+		})
+	}
 	return err
 }
 
 // Update ...
 func (m *SettingRule) Update(ctx context.Context, settingRuleID int64, changed map[string]interface{}) (*schema.SettingRule, error) {
+	m.auditBefore(ctx, schema.TableSettingRule, settingRuleID, &schema.SettingRule{})
 	settingRule := &schema.SettingRule{}
 	if _, err := m.updateByID(ctx, schema.TableSettingRule, settingRuleID, goqu.Record(changed)); err != nil {
 		return nil, err
@@ -196,5 +206,12 @@ func (m *SettingRule) Update(ctx context.Context, settingRuleID int64, changed m
 
 // Delete ...
 func (m *SettingRule) Delete(ctx context.Context, id int64) (int64, error) {
-	return m.deleteByID(ctx, schema.TableSettingRule, id)
+	m.auditBefore(ctx, schema.TableSettingRule, id, &schema.SettingRule{})
+	rowsAffected, err := m.deleteByID(ctx, schema.TableSettingRule, id)
+	if rowsAffected > 0 {
+		goAfterCommit(ctx, 5*time.Second, func(gctx context.Context) {
+			m.tryIncreaseStatisticStatus(gctx, schema.SettingRulesTotalSize, -int(rowsAffected))
+		})
+	}
+	return rowsAffected, err
 }
@@ -2,6 +2,8 @@ package model
 
 import (
 	"context"
+	"strings"
+	"unicode"
 
 	"github.com/doug-martin/goqu/v9"
 	"github.com/teambition/urbs-setting/src/schema"
@@ -24,3 +26,52 @@ func (m *Statistic) FindByKey(ctx context.Context, key schema.StatisticKey) (*sc
 	}
 	return statistic, nil
 }
+
+// FindTotals 返回 urbs_statistic 中记录的各类对象总数，名称为去掉 TotalSize 后缀的小写下划线形式，如 label_rules
+func (m *Statistic) FindTotals(ctx context.Context) (map[string]int64, error) {
+	statistics := make([]schema.Statistic, 0)
+	sd := m.rdDB(ctx).From(schema.TableStatistic).Where(goqu.C("name").Like("%TotalSize"))
+	if err := sd.Executor().ScanStructsContext(ctx, &statistics); err != nil {
+		return nil, err
+	}
+
+	totals := make(map[string]int64, len(statistics))
+	for _, s := range statistics {
+		totals[snakeName(strings.TrimSuffix(s.Name, "TotalSize"))] = s.Status
+	}
+	return totals, nil
+}
+
+// RefreshTotals 重新计算 urbs_statistic 中的各类对象总数，某项失败时继续计算其它项，返回最后一个错误
+func (m *Statistic) RefreshTotals(ctx context.Context) error {
+	var err error
+	for _, refresh := range []func(context.Context) error{
+		m.refreshUsersTotalSize,
+		m.refreshGroupsTotalSize,
+		m.refreshProductsTotalSize,
+		m.refreshLabelsTotalSize,
+		m.refreshModulesTotalSize,
+		m.refreshSettingsTotalSize,
+		m.refreshLabelRulesTotalSize,
+		m.refreshSettingRulesTotalSize,
+	} {
+		if e := refresh(ctx); e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func snakeName(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,175 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/doug-martin/goqu/v9/exp"
+	"github.com/teambition/urbs-setting/src/schema"
+	"github.com/teambition/urbs-setting/src/service"
+)
+
+// StatisticDaily ...
+type StatisticDaily struct {
+	*Model
+}
+
+const dayLayout = "2006-01-02"
+
+// dailyKey 按天统计的计数键
+type dailyKey struct {
+	day       string // UTC 日期，如 2021-01-26
+	productID int64
+	metric    string
+	kind      string
+	objectID  int64
+}
+
+// dailyCounter 写操作产生的按天计数，先在内存中累加，由 StatisticDaily.Flush 批量写入，
+// 避免每次写操作都更新 urbs_statistic_daily 中的同一行
+type dailyCounter struct {
+	mu     sync.Mutex
+	counts map[dailyKey]int64
+}
+
+var dailyCounts = &dailyCounter{counts: make(map[dailyKey]int64)}
+
+func (c *dailyCounter) add(key dailyKey, n int64) {
+	c.mu.Lock()
+	c.counts[key] += n
+	c.mu.Unlock()
+}
+
+// take 取出并清空当前的计数
+func (c *dailyCounter) take() map[dailyKey]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counts := c.counts
+	c.counts = make(map[dailyKey]int64, len(counts))
+	return counts
+}
+
+// incrDaily 累加当天（UTC）的计数，n 不大于 0 时忽略
+func incrDaily(productID int64, metric, kind string, objectID, n int64) {
+	if productID <= 0 || n <= 0 {
+		return
+	}
+	key := dailyKey{
+		day:       time.Now().UTC().Format(dayLayout),
+		productID: productID,
+		metric:    metric,
+		kind:      kind,
+		objectID:  objectID,
+	}
+	dailyCounts.add(key, n)
+}
+
+// Incr 累加产品下对象当天的计数，kind 为 label 或 setting，objectID 为其 ID，计数在 Flush 时写入数据库
+func (m *StatisticDaily) Incr(productID int64, metric, kind string, objectID, n int64) {
+	incrDaily(productID, metric, kind, objectID, n)
+}
+
+// Flush 将内存中累加的计数批量写入 urbs_statistic_daily，返回写入的行数。
+// 写入失败的计数会放回内存，在下一次 Flush 时重试
+func (m *StatisticDaily) Flush(ctx context.Context) (int, error) {
+	counts := dailyCounts.take()
+	if len(counts) == 0 {
+		return 0, nil
+	}
+
+	keys := make([]dailyKey, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+
+	total := 0
+	for i := 0; i < len(keys); i += 500 {
+		batch := keys[i:]
+		if len(batch) > 500 {
+			batch = batch[:500]
+		}
+		rows := make([]interface{}, 0, len(batch))
+		for _, key := range batch {
+			day, _ := time.Parse(dayLayout, key.day)
+			rows = append(rows, schema.StatisticDaily{
+				Day:       day,
+				ProductID: key.productID,
+				Metric:    key.metric,
+				Kind:      key.kind,
+				ObjectID:  key.objectID,
+				Value:     counts[key],
+			})
+		}
+
+		sd := m.DB.Insert(schema.TableStatisticDaily).Rows(rows...).
+			OnConflict(goqu.DoUpdate("value", goqu.C("value").Set(goqu.L("`value` + VALUES(`value`)"))))
+		if _, err := sd.Executor().ExecContext(ctx); err != nil {
+			for _, key := range keys[i:] {
+				dailyCounts.add(key, counts[key])
+			}
+			return total, err
+		}
+		total += len(batch)
+	}
+	return total, nil
+}
+
+// RollupActiveUsers 汇总各产品在 day（UTC）当天刷新过 labels 缓存的用户数，重复执行时覆盖之前的结果。
+// 用户的 active_at 只记录最后一次刷新时间，之后再次活跃的用户不计入，因此结果为近似值
+func (m *StatisticDaily) RollupActiveUsers(ctx context.Context, day time.Time) (int64, error) {
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	key := fmt.Sprintf("rollupActiveUsers:%s", start.Format(dayLayout))
+	if err := m.lock(ctx, key, 10*time.Minute); err != nil {
+		return 0, err
+	}
+	defer m.unlock(ctx, key)
+
+	sd := m.DB.Insert(schema.TableStatisticDaily).
+		Cols("day", "product_id", "metric", "kind", "object_id", "value").
+		FromQuery(goqu.From(schema.TableUserLabelCache).
+			Select(
+				goqu.V(start.Format(dayLayout)),
+				goqu.C("product_id"),
+				goqu.V(schema.MetricActiveUsers),
+				goqu.V(schema.StatisticKindProduct),
+				goqu.V(0),
+				goqu.COUNT("*")).
+			Where(
+				goqu.C("active_at").Gte(start.Unix()),
+				goqu.C("active_at").Lt(start.AddDate(0, 0, 1).Unix())).
+			GroupBy(goqu.C("product_id"))).
+		OnConflict(goqu.DoUpdate("value", goqu.C("value").Set(goqu.L("VALUES(`value`)"))))
+	return service.DeResult(sd.Executor().ExecContext(ctx))
+}
+
+// FindDaily 返回产品在 [from, to] 日期范围内每天的统计值，kind 为空时汇总产品下所有对象，
+// 否则只统计 kind 和 objectID 指定的对象，返回日期（如 2021-01-26）到值的映射，没有数据的日期不返回
+func (m *StatisticDaily) FindDaily(ctx context.Context, productID int64, metric, kind string, objectID int64, from, to time.Time) (map[string]int64, error) {
+	exps := []exp.Expression{
+		goqu.C("product_id").Eq(productID),
+		goqu.C("metric").Eq(metric),
+		goqu.C("day").Gte(from.Format(dayLayout)),
+		goqu.C("day").Lte(to.Format(dayLayout)),
+	}
+	if kind != "" {
+		exps = append(exps, goqu.C("kind").Eq(kind), goqu.C("object_id").Eq(objectID))
+	}
+
+	rows := make([]schema.StatisticDaily, 0)
+	sd := m.rdDB(ctx).From(schema.TableStatisticDaily).
+		Select(goqu.C("day"), goqu.L("SUM(`value`)").As("value")).
+		Where(exps...).
+		GroupBy(goqu.C("day"))
+	if err := sd.Executor().ScanStructsContext(ctx, &rows); err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		res[row.Day.Format(dayLayout)] = row.Value
+	}
+	return res, nil
+}
@@ -3,12 +3,15 @@ package model
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/doug-martin/goqu/v9"
 	"github.com/doug-martin/goqu/v9/exp"
 	"github.com/teambition/gear"
 	"github.com/teambition/urbs-setting/src/conf"
+	"github.com/teambition/urbs-setting/src/logging"
 	"github.com/teambition/urbs-setting/src/schema"
 	"github.com/teambition/urbs-setting/src/service"
 	"github.com/teambition/urbs-setting/src/tpl"
@@ -61,8 +64,8 @@ func (m *User) AcquireID(ctx context.Context, uid string) (int64, error) {
 func (m *User) Find(ctx context.Context, pg tpl.Pagination) ([]schema.User, int, error) {
 	users := make([]schema.User, 0)
 	cursor := pg.TokenToID()
-	sdc := m.RdDB.From(schema.TableUser)
-	sd := m.RdDB.From(schema.TableUser).Where(goqu.C("id").Lte(cursor))
+	sdc := m.rdDB(ctx).From(schema.TableUser)
+	sd := m.rdDB(ctx).From(schema.TableUser).Where(goqu.C("id").Lte(cursor))
 
 	var total int64
 	var err error
@@ -84,139 +87,450 @@ func (m *User) Find(ctx context.Context, pg tpl.Pagination) ([]schema.User, int,
 	return users, int(total), nil
 }
 
-// RefreshLabels 更新 user 上的 labels 缓存，包括通过 group 关系获得的 labels
-func (m *User) RefreshLabels(ctx context.Context, id int64, now int64, force bool, product string) (*schema.User, []int64, bool, error) {
-	user := &schema.User{}
+// FindLabelCache 返回 user 在指定产品下的 labels 缓存，不存在时返回 nil
+func (m *User) FindLabelCache(ctx context.Context, userID, productID int64) (*schema.UserLabelCache, error) {
+	if cache := m.getSharedLabelCache(ctx, userID, productID); cache != nil {
+		return cache, nil
+	}
+
+	cache := &schema.UserLabelCache{}
+	ok, err := m.findOneByCols(ctx, schema.TableUserLabelCache, goqu.Ex{"user_id": userID, "product_id": productID}, "", cache)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, nil
+	}
+	// 可能读自从库，或读取后缓存已被标记为过期，不能覆盖刷新后写入的共享缓存和过期标记
+	m.setSharedLabelCache(ctx, cache, false)
+	return cache, nil
+}
+
+// FindLabelCacheMap 返回 user 在所有产品下的 labels 缓存，以产品名为键
+func (m *User) FindLabelCacheMap(ctx context.Context, userID int64) (schema.UserCacheLabelMap, error) {
+	data := make(schema.UserCacheLabelMap)
+	sd := m.DB.Select(
+		goqu.I("t1.active_at"),
+		goqu.I("t1.labels"),
+		goqu.I("t2.name")).
+		From(
+			goqu.T(schema.TableUserLabelCache).As("t1"),
+			goqu.T(schema.TableProduct).As("t2")).
+		Where(
+			goqu.I("t1.user_id").Eq(userID),
+			goqu.I("t1.product_id").Eq(goqu.I("t2.id")),
+			goqu.I("t2.deleted_at").IsNull())
+
+	scanner, err := sd.Executor().ScannerContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer scanner.Close()
+
+	for scanner.Next() {
+		item := struct {
+			schema.UserLabelCache
+			Product string `db:"name"`
+		}{}
+		if err := scanner.ScanStruct(&item); err != nil {
+			return nil, err
+		}
+		data[item.Product] = item.UserLabelCache.ToUserCache()
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// RefreshLabels 更新 user 在指定产品下的 labels 缓存，包括通过 group 关系获得的 labels
+// 缓存按 (user_id, product_id) 单独加锁和存储，不影响该用户在其它产品下的缓存
+func (m *User) RefreshLabels(ctx context.Context, id, productID int64, now int64, force bool) (*schema.UserLabelCache, []int64, bool, error) {
+	if !force && m.Cache.Enabled() {
+		unlock, locked, err := m.lockLabelCacheRefresh(ctx, id, productID)
+		if err != nil {
+			logging.Warningf("RefreshLabels: userID %d, productID %d, lock shared cache error %v", id, productID, err)
+		} else if locked {
+			defer unlock()
+		} else if cache := m.getSharedLabelCache(ctx, id, productID); cache != nil {
+			// 其它请求正在刷新，直接返回共享缓存中的数据，避免排队等待 MySQL 行锁
+			return cache, []int64{}, false, nil
+		}
+	}
+
+	cache := &schema.UserLabelCache{}
 	labelIDs := make([]int64, 0)
 	refreshed := false
-	tx, err := m.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	tx, err := m.SQL.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
 	if err != nil {
 		return nil, nil, false, err
 	}
 
 	err = tx.Wrap(func() error {
-		// 指定 id 的记录被锁住，如果表中无符合记录的数据则排他锁不生效
-		sd := tx.From(schema.TableUser).Where(goqu.C("id").Eq(id)).
-			ForUpdate(exp.Wait).Order(goqu.C("id").Asc()).Limit(1)
+		sd := tx.From(schema.TableUserLabelCache).
+			Where(goqu.C("user_id").Eq(id), goqu.C("product_id").Eq(productID)).
+			ForUpdate(exp.Wait).Limit(1)
 
-		ok, err := sd.Executor().ScanStructContext(ctx, user)
+		ok, err := sd.Executor().ScanStructContext(ctx, cache)
 		if err != nil {
 			return err
 		}
 		if !ok {
-			return gear.ErrNotFound.WithMsgf("user %d not found for RefreshLabels", id)
+			// 首次缓存，先插入空记录，再锁住该记录
+			empty := &schema.UserLabelCache{UserID: id, ProductID: productID, Labels: "[]"}
+			_, err = tx.Insert(schema.TableUserLabelCache).Rows(empty).
+				OnConflict(goqu.DoNothing()).Executor().ExecContext(ctx)
+			if err != nil {
+				return err
+			}
+			if ok, err = sd.Executor().ScanStructContext(ctx, cache); err != nil {
+				return err
+			}
+			if !ok {
+				return gear.ErrNotFound.WithMsgf("label cache for user %d not found for RefreshLabels", id)
+			}
 		}
 
-		if !force && product != "" && !conf.Config.IsCacheLabelExpired(now-5, user.GetCache(product).ActiveAt) {
+		if !force && !conf.Config.IsCacheLabelExpired(now-5, cache.ActiveAt) {
 			// 已被其它请求更新
 			return nil
 		}
 
-		data := user.GetCacheMap()
-		for _, v := range data { // 清空旧标签缓存
-			v.Labels = make([]schema.UserCacheLabel, 0)
-			if product == "" {
-				v.ActiveAt = now //强制刷新缓存，更新所有活跃时间
-			}
-		}
-		if product != "" {
-			// 放在外面赋值，是为了新产品的第一次更新。
-			data[product] = &schema.UserCache{
-				Labels:   make([]schema.UserCacheLabel, 0),
-				ActiveAt: now, // 只更新该产品缓存的刷新时间
-			}
+		data, ids, err := m.findCacheLabels(ctx, tx, id, productID)
+		if err != nil {
+			return err
 		}
+		labelIDs = ids
 
-		sd = tx.Select(
-			goqu.I("t1.created_at"),
-			goqu.I("t2.id"),
-			goqu.I("t2.name"),
-			goqu.I("t2.channels"),
-			goqu.I("t2.clients"),
-			goqu.I("t3.name").As("product")).
-			From(
-				goqu.T(schema.TableUserLabel).As("t1"),
-				goqu.T(schema.TableLabel).As("t2"),
-				goqu.T(schema.TableProduct).As("t3")).
-			Where(
-				goqu.I("t1.user_id").Eq(id),
-				goqu.I("t1.label_id").Eq(goqu.I("t2.id")),
-				goqu.I("t2.product_id").Eq(goqu.I("t3.id"))).
-			Order(goqu.I("t1.id").Desc()).Limit(200)
-
-		sd = sd.UnionAll(tx.Select(
-			goqu.I("t2.created_at"),
-			goqu.I("t3.id"),
-			goqu.I("t3.name"),
-			goqu.I("t3.channels"),
-			goqu.I("t3.clients"),
-			goqu.I("t4.name").As("product")).
-			From(
-				goqu.T(schema.TableUserGroup).As("t1"),
-				goqu.T(schema.TableGroupLabel).As("t2"),
-				goqu.T(schema.TableLabel).As("t3"),
-				goqu.T(schema.TableProduct).As("t4")).
-			Where(
-				goqu.I("t1.user_id").Eq(id),
-				goqu.I("t1.group_id").Eq(goqu.I("t2.group_id")),
-				goqu.I("t2.label_id").Eq(goqu.I("t3.id")),
-				goqu.I("t3.product_id").Eq(goqu.I("t4.id"))).
-			Order(goqu.I("t2.id").Desc()).Limit(200)).
-			Order(goqu.C("created_at").Desc())
+		refreshed = true
+		cache.ActiveAt = now
+		_ = cache.PutLabels(data[productID])
+		_, err = service.DeResult(tx.Update(schema.TableUserLabelCache).
+			Where(goqu.C("id").Eq(cache.ID)).
+			Set(goqu.Record{"labels": cache.Labels, "active_at": cache.ActiveAt}).
+			Executor().ExecContext(ctx))
+		return err
+	})
 
-		scanner, err := sd.Executor().ScannerContext(ctx)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	m.setSharedLabelCache(ctx, cache, true)
+	if refreshed {
+		m.tryUpdateActiveAt(ctx, id, now)
+	}
+	return cache, labelIDs, refreshed, nil
+}
+
+// RefreshAllLabels 强制更新 user 在所有产品下的 labels 缓存，包括通过 group 关系获得的 labels
+func (m *User) RefreshAllLabels(ctx context.Context, id int64, now int64) ([]int64, error) {
+	labelIDs := make([]int64, 0)
+	refreshed := make([]*schema.UserLabelCache, 0)
+	tx, err := m.SQL.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Wrap(func() error {
+		caches := make([]schema.UserLabelCache, 0)
+		sd := tx.From(schema.TableUserLabelCache).
+			Where(goqu.C("user_id").Eq(id)).
+			ForUpdate(exp.Wait).Order(goqu.C("id").Asc())
+		if err := sd.Executor().ScanStructsContext(ctx, &caches); err != nil {
+			return err
+		}
+
+		data, ids, err := m.findCacheLabels(ctx, tx, id, 0)
 		if err != nil {
 			return err
 		}
+		labelIDs = ids
 
-		set := make(map[int64]struct{})
-		for scanner.Next() {
-			myLabelInfo := schema.MyLabelInfo{}
-			if err := scanner.ScanStruct(&myLabelInfo); err != nil {
-				scanner.Close()
-				return err
-			}
-			if _, ok := set[myLabelInfo.ID]; ok {
-				continue // 去重
+		for _, c := range caches { // 已无 label 的产品也要刷新
+			if _, ok := data[c.ProductID]; !ok {
+				data[c.ProductID] = nil
 			}
-			set[myLabelInfo.ID] = struct{}{}
+		}
 
-			labelIDs = append(labelIDs, myLabelInfo.ID)
-			uclm, ok := data[myLabelInfo.Product]
-			if !ok {
-				uclm = &schema.UserCache{
-					Labels: make([]schema.UserCacheLabel, 0),
-				}
-				data[myLabelInfo.Product] = uclm
+		for productID, labels := range data {
+			cache := &schema.UserLabelCache{UserID: id, ProductID: productID, ActiveAt: now}
+			_ = cache.PutLabels(labels)
+			_, err := tx.Insert(schema.TableUserLabelCache).Rows(cache).
+				OnConflict(goqu.DoUpdate("user_id", goqu.Record{"labels": cache.Labels, "active_at": now})).
+				Executor().ExecContext(ctx)
+			if err != nil {
+				return err
 			}
-			data[myLabelInfo.Product].Labels = append(uclm.Labels, schema.UserCacheLabel{
-				Label:    myLabelInfo.Name,
-				Clients:  tpl.StringToSlice(myLabelInfo.Clients),
-				Channels: tpl.StringToSlice(myLabelInfo.Channels),
-			})
+			refreshed = append(refreshed, cache)
 		}
+		return nil
+	})
 
-		if err := scanner.Close(); err != nil {
-			return err
+	if err != nil {
+		return nil, err
+	}
+	for _, cache := range refreshed {
+		m.setSharedLabelCache(ctx, cache, true)
+	}
+	m.tryUpdateActiveAt(ctx, id, now)
+	return labelIDs, nil
+}
+
+// FindIDsByUIDs 根据 uid 数组返回对应的 user ID 数组，不存在的 uid 会被忽略
+func (m *User) FindIDsByUIDs(ctx context.Context, uids []string) ([]int64, error) {
+	ids := make([]int64, 0)
+	if len(uids) == 0 {
+		return ids, nil
+	}
+	sd := m.DB.From(schema.TableUser).Where(goqu.C("uid").In(uids))
+	if err := sd.PluckContext(ctx, &ids, "id"); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// FindUIDsByIDs 根据 user ID 数组返回对应的 uid 数组，不存在的 ID 会被忽略
+func (m *User) FindUIDsByIDs(ctx context.Context, ids []int64) ([]string, error) {
+	uids := make([]string, 0)
+	if len(ids) == 0 {
+		return uids, nil
+	}
+	sd := m.db(ctx).From(schema.TableUser).Where(goqu.C("id").In(ids))
+	if err := sd.PluckContext(ctx, &uids, "uid"); err != nil {
+		return nil, err
+	}
+	return uids, nil
+}
+
+// InvalidateLabelCaches 将 users 在指定产品下（productID 为 0 时为所有产品）的 labels 缓存标记为过期，
+// 下次读取时会同步刷新。返回缓存被标记为过期的用户数
+func (m *User) InvalidateLabelCaches(ctx context.Context, userIDs []int64, productID int64) (int64, error) {
+	if len(userIDs) == 0 {
+		return 0, nil
+	}
+	exps := []exp.Expression{goqu.C("user_id").In(userIDs)}
+	if productID > 0 {
+		exps = append(exps, goqu.C("product_id").Eq(productID))
+	}
+
+	caches := make([]schema.UserLabelCache, 0)
+	sd := m.DB.From(schema.TableUserLabelCache).Select("id", "user_id", "product_id").Where(exps...)
+	if err := sd.Executor().ScanStructsContext(ctx, &caches); err != nil {
+		return 0, err
+	}
+	if len(caches) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]int64, 0, len(caches))
+	keys := make([]string, 0, len(caches))
+	users := make(map[int64]struct{})
+	for _, c := range caches {
+		ids = append(ids, c.ID)
+		keys = append(keys, m.labelCacheKey(c.UserID, c.ProductID))
+		users[c.UserID] = struct{}{}
+	}
+	// active_at 设为 1 即超过 2 倍有效期，读取时会同步刷新，同时仍保留刷新锁避免并发重复刷新
+	_, err := m.DB.Update(schema.TableUserLabelCache).
+		Where(goqu.C("id").In(ids)).
+		Set(goqu.Record{"active_at": 1}).
+		Executor().ExecContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	m.markSharedLabelCachesInvalid(ctx, keys)
+	return int64(len(users)), nil
+}
+
+// labelCacheKey 返回 user 在指定产品下 labels 的共享缓存键
+func (m *User) labelCacheKey(userID, productID int64) string {
+	return m.Cache.Key(fmt.Sprintf("ulc:%d:%d", userID, productID))
+}
+
+// lockLabelCacheRefresh 在共享缓存中获取 user 在指定产品下刷新 labels 缓存的锁，锁 10 秒后过期。
+// 获取成功时返回释放锁的函数，锁可能已过期并被其它请求获取，因此只释放自己持有的锁
+func (m *User) lockLabelCacheRefresh(ctx context.Context, userID, productID int64) (func(), bool, error) {
+	key := m.labelCacheKey(userID, productID) + ":lock"
+	token := []byte(util.RandToken())
+	locked, err := m.Cache.SetNX(ctx, key, token, 10*time.Second)
+	if err != nil || !locked {
+		return nil, false, err
+	}
+	return func() {
+		if _, err := m.Cache.DelIfValue(ctx, key, token); err != nil {
+			logging.Warningf("lockLabelCacheRefresh: userID %d, productID %d, unlock error %v", userID, productID, err)
 		}
-		if err := scanner.Err(); err != nil {
-			return err
+	}, true, nil
+}
+
+// sharedLabelCache 共享缓存中存储的 labels 缓存数据，labels 直接使用 user_label_cache 表中的 JSON。
+// Invalid 为 true 时为过期标记，读取时视为未命中，同时阻止读取较早的数据通过 SetNX 写回
+type sharedLabelCache struct {
+	ActiveAt int64           `json:"activeAt"`
+	Labels   json.RawMessage `json:"labels,omitempty"`
+	Invalid  bool            `json:"invalid,omitempty"`
+}
+
+// invalidSharedLabelCache 过期标记
+var invalidSharedLabelCache = []byte(`{"activeAt":1,"invalid":true}`)
+
+// markSharedLabelCachesInvalid 将共享缓存替换为过期标记，直到下次刷新时覆盖。
+// 直接删除时，标记过期前读取的数据仍可能通过 SetNX 写回
+func (m *User) markSharedLabelCachesInvalid(ctx context.Context, keys []string) {
+	if !m.Cache.Enabled() {
+		return
+	}
+	expire := conf.Config.CacheLabelDoubleExpireDuration()
+	for _, key := range keys {
+		if err := m.Cache.Set(ctx, key, invalidSharedLabelCache, expire); err != nil {
+			logging.Warningf("markSharedLabelCachesInvalid: key %s, error %v", key, err)
+			_ = m.Cache.Del(ctx, key)
 		}
+	}
+}
 
-		refreshed = true
-		user.ActiveAt = time.Now().UTC().Unix()
-		_ = user.PutCacheMap(data)
-		_, err = service.DeResult(tx.Update(schema.TableUser).
-			Where(goqu.C("id").Eq(id)).
-			Set(goqu.Record{"labels": user.Labels, "active_at": user.ActiveAt}).
-			Executor().ExecContext(ctx))
-		return err
-	})
+// getSharedLabelCache 从共享缓存读取 user 在指定产品下的 labels 缓存，未命中或出错时返回 nil，由调用方回退到 MySQL
+func (m *User) getSharedLabelCache(ctx context.Context, userID, productID int64) *schema.UserLabelCache {
+	if !m.Cache.Enabled() {
+		return nil
+	}
+	data, err := m.Cache.Get(ctx, m.labelCacheKey(userID, productID))
+	if err != nil {
+		logging.Warningf("getSharedLabelCache: userID %d, productID %d, error %v", userID, productID, err)
+		return nil
+	}
+	if data == nil {
+		return nil
+	}
+	sc := &sharedLabelCache{}
+	if err := json.Unmarshal(data, sc); err != nil {
+		logging.Warningf("getSharedLabelCache: userID %d, productID %d, error %v", userID, productID, err)
+		return nil
+	}
+	if sc.Invalid {
+		return nil
+	}
+	return &schema.UserLabelCache{UserID: userID, ProductID: productID, ActiveAt: sc.ActiveAt, Labels: string(sc.Labels)}
+}
 
+// setSharedLabelCache 写入共享缓存，overwrite 为 false 时只在缓存不存在时写入。
+// 写入失败时尝试删除旧缓存，避免读到过期数据
+func (m *User) setSharedLabelCache(ctx context.Context, cache *schema.UserLabelCache, overwrite bool) {
+	if !m.Cache.Enabled() {
+		return
+	}
+	labels := cache.Labels
+	if labels == "" {
+		labels = "[]"
+	}
+	data, err := json.Marshal(&sharedLabelCache{ActiveAt: cache.ActiveAt, Labels: json.RawMessage(labels)})
 	if err != nil {
-		return nil, nil, false, err
+		logging.Warningf("setSharedLabelCache: userID %d, productID %d, error %v", cache.UserID, cache.ProductID, err)
+		return
+	}
+	key := m.labelCacheKey(cache.UserID, cache.ProductID)
+	expire := conf.Config.CacheLabelDoubleExpireDuration()
+	if overwrite {
+		err = m.Cache.Set(ctx, key, data, expire)
+	} else {
+		_, err = m.Cache.SetNX(ctx, key, data, expire)
+	}
+	if err != nil {
+		logging.Warningf("setSharedLabelCache: userID %d, productID %d, error %v", cache.UserID, cache.ProductID, err)
+		_ = m.Cache.Del(ctx, key)
+	}
+}
+
+// findCacheLabels 查询 user 直接或通过 group 获得的 labels，按产品 ID 分组，productID 为 0 时查询所有产品
+func (m *User) findCacheLabels(ctx context.Context, tx *goqu.TxDatabase, id, productID int64) (map[int64][]schema.UserCacheLabel, []int64, error) {
+	data := make(map[int64][]schema.UserCacheLabel)
+	labelIDs := make([]int64, 0)
+
+	exps := []exp.Expression{
+		goqu.I("t1.user_id").Eq(id),
+		goqu.I("t1.label_id").Eq(goqu.I("t2.id"))}
+	if productID > 0 {
+		exps = append(exps, goqu.I("t2.product_id").Eq(productID))
+	}
+	sd := tx.Select(
+		goqu.I("t1.created_at"),
+		goqu.I("t2.id"),
+		goqu.I("t2.name"),
+		goqu.I("t2.channels"),
+		goqu.I("t2.clients"),
+		goqu.I("t2.product_id")).
+		From(
+			goqu.T(schema.TableUserLabel).As("t1"),
+			goqu.T(schema.TableLabel).As("t2")).
+		Where(exps...)
+
+	exps = []exp.Expression{
+		goqu.I("t1.user_id").Eq(id),
+		goqu.I("t1.group_id").Eq(goqu.I("t2.group_id")),
+		goqu.I("t2.label_id").Eq(goqu.I("t3.id"))}
+	if productID > 0 {
+		exps = append(exps, goqu.I("t3.product_id").Eq(productID))
+	}
+	sd = sd.UnionAll(tx.Select(
+		goqu.I("t2.created_at"),
+		goqu.I("t3.id"),
+		goqu.I("t3.name"),
+		goqu.I("t3.channels"),
+		goqu.I("t3.clients"),
+		goqu.I("t3.product_id")).
+		From(
+			goqu.T(schema.TableUserGroup).As("t1"),
+			goqu.T(schema.TableGroupLabel).As("t2"),
+			goqu.T(schema.TableLabel).As("t3")).
+		Where(exps...)).
+		Order(goqu.C("created_at").Desc())
+
+	scanner, err := sd.Executor().ScannerContext(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer scanner.Close()
+
+	set := make(map[int64]struct{})
+	for scanner.Next() {
+		myLabelInfo := schema.MyLabelInfo{}
+		if err := scanner.ScanStruct(&myLabelInfo); err != nil {
+			return nil, nil, err
+		}
+		if _, ok := set[myLabelInfo.ID]; ok {
+			continue // 去重
+		}
+		set[myLabelInfo.ID] = struct{}{}
+
+		labelIDs = append(labelIDs, myLabelInfo.ID)
+		data[myLabelInfo.ProductID] = append(data[myLabelInfo.ProductID], schema.UserCacheLabel{
+			Label:    myLabelInfo.Name,
+			Clients:  tpl.StringToSlice(myLabelInfo.Clients),
+			Channels: tpl.StringToSlice(myLabelInfo.Channels),
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	return data, labelIDs, nil
+}
+
+// TouchActiveAt 在 user 的最近活跃时间超过 labels 缓存有效期时更新，用于只读取 settings 的用户，避免被当作不活跃用户清理
+func (m *User) TouchActiveAt(ctx context.Context, user *schema.User, now int64) {
+	if conf.Config.IsCacheLabelExpired(now, user.ActiveAt) {
+		m.tryUpdateActiveAt(ctx, user.ID, now)
+	}
+}
+
+// tryUpdateActiveAt 更新 user 的最近活跃时间
+func (m *User) tryUpdateActiveAt(ctx context.Context, id int64, now int64) {
+	_, err := m.DB.Update(schema.TableUser).
+		Where(goqu.C("id").Eq(id), goqu.C("active_at").Lt(now)).
+		Set(goqu.Record{"active_at": now}).
+		Executor().ExecContext(ctx)
+	if err != nil {
+		logging.Warningf("updateUserActiveAt: userID %d, error %v", id, err)
 	}
-	return user, labelIDs, refreshed, nil
 }
 
 // FindSettingsUnionAll 根据用户 ID, updateGt, productName 返回其 settings 数据。
@@ -226,7 +540,7 @@ func (m *User) FindSettingsUnionAll(ctx context.Context, groupIDs []int64, userI
 	set := make(map[int64]struct{})
 	size := pg.PageSize + 1
 
-	s := m.RdDB.Select(
+	s := m.rdDB(ctx).Select(
 		goqu.I("t1.rls"),
 		goqu.I("t1.updated_at").As("assigned_at"),
 		goqu.I("t1.value"),
@@ -360,7 +674,7 @@ func (m *User) FindLabels(ctx context.Context, userID int64, pg tpl.Pagination)
 	data := []tpl.MyLabel{}
 	cursor := pg.TokenToID()
 
-	sdc := m.RdDB.Select().
+	sdc := m.rdDB(ctx).Select().
 		From(
 			goqu.T(schema.TableUserLabel).As("t1"),
 			goqu.T(schema.TableLabel).As("t2"),
@@ -369,7 +683,7 @@ func (m *User) FindLabels(ctx context.Context, userID int64, pg tpl.Pagination)
 			goqu.I("t1.user_id").Eq(userID),
 			goqu.I("t1.label_id").Eq(goqu.I("t2.id")))
 
-	sd := m.RdDB.Select(
+	sd := m.rdDB(ctx).Select(
 		goqu.I("t1.rls"),
 		goqu.I("t1.created_at").As("assigned_at"),
 		goqu.I("t2.id"),
@@ -423,7 +737,7 @@ func (m *User) FindLabels(ctx context.Context, userID int64, pg tpl.Pagination)
 func (m *User) FindSettings(ctx context.Context, userID, productID, moduleID, settingID int64, pg tpl.Pagination, channel, client string) ([]tpl.MySetting, int, error) {
 	data := []tpl.MySetting{}
 	cursor := pg.TokenToID()
-	sdc := m.RdDB.Select().
+	sdc := m.rdDB(ctx).Select().
 		From(
 			goqu.T(schema.TableUserSetting).As("t1"),
 			goqu.T(schema.TableSetting).As("t2"),
@@ -431,7 +745,7 @@ func (m *User) FindSettings(ctx context.Context, userID, productID, moduleID, se
 			goqu.T(schema.TableProduct).As("t4")).
 		Where(goqu.I("t1.user_id").Eq(userID))
 
-	sd := m.RdDB.Select(
+	sd := m.rdDB(ctx).Select(
 		goqu.I("t1.rls"),
 		goqu.I("t1.updated_at").As("assigned_at"),
 		goqu.I("t1.value"),
@@ -531,12 +845,213 @@ func (m *User) BatchAdd(ctx context.Context, uids []string) error {
 		vals[i] = goqu.Vals{uids[i]}
 	}
 
-	sd := m.DB.Insert(schema.TableUser).Cols("uid").Vals(vals...).OnConflict(goqu.DoNothing())
+	sd := m.db(ctx).Insert(schema.TableUser).Cols("uid").Vals(vals...).OnConflict(goqu.DoNothing())
 	rowsAffected, err := service.DeResult(sd.Executor().ExecContext(ctx))
 	if rowsAffected > 0 {
-		util.Go(30*time.Second, func(gctx context.Context) {
+		goAfterCommit(ctx, 30*time.Second, func(gctx context.Context) {
 			m.tryRefreshUsersTotalSize(gctx)
 		})
 	}
 	return err
 }
+
+// CountInactive 统计 active_at 与 created_at 都早于 before 的不活跃用户，及其环境标签、配置项和群组关系数量
+func (m *User) CountInactive(ctx context.Context, before time.Time, samples int) (*tpl.UsersPurgeInfo, error) {
+	info := &tpl.UsersPurgeInfo{Before: before, Samples: []string{}}
+	cls := inactiveUsersExp(before)
+
+	var err error
+	if info.Users, err = m.rdDB(ctx).From(schema.TableUser).Where(cls...).CountContext(ctx); err != nil {
+		return nil, err
+	}
+	if info.Users == 0 {
+		return info, nil
+	}
+
+	ids := m.rdDB(ctx).From(schema.TableUser).Select("id").Where(cls...)
+	if info.Labels, err = m.rdDB(ctx).From(schema.TableUserLabel).Where(goqu.C("user_id").In(ids)).CountContext(ctx); err != nil {
+		return nil, err
+	}
+	if info.Settings, err = m.rdDB(ctx).From(schema.TableUserSetting).Where(goqu.C("user_id").In(ids)).CountContext(ctx); err != nil {
+		return nil, err
+	}
+	if info.Groups, err = m.rdDB(ctx).From(schema.TableUserGroup).Where(goqu.C("user_id").In(ids)).CountContext(ctx); err != nil {
+		return nil, err
+	}
+
+	sd := m.rdDB(ctx).From(schema.TableUser).Select("uid").Where(cls...).Order(goqu.C("id").Asc()).Limit(uint(samples))
+	if err = sd.Executor().ScanValsContext(ctx, &info.Samples); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// PurgeInactive 清理一批 active_at 与 created_at 都早于 before 的不活跃用户，
+// 包括其环境标签、配置项、群组关系和标签缓存，archive 为 true 时先归档到 urbs_user_archive 表
+// 返回被清理的用户数，为 0 时表示已无可清理的用户
+func (m *User) PurgeInactive(ctx context.Context, before time.Time, limit int, archive bool) (int64, error) {
+	var rowsAffected int64
+	labelIDs := make([]int64, 0)
+	settingIDs := make([]int64, 0)
+	groupIDs := make([]int64, 0)
+	cacheKeys := make([]string, 0)
+	tx, err := m.SQL.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Wrap(func() error {
+		users := make([]schema.User, 0)
+		// 锁住待清理的用户，避免清理期间用户变为活跃状态
+		sd := tx.From(schema.TableUser).Where(inactiveUsersExp(before)...).
+			ForUpdate(exp.Wait).Order(goqu.C("id").Asc()).Limit(uint(limit))
+		if err := sd.Executor().ScanStructsContext(ctx, &users); err != nil {
+			return err
+		}
+		if len(users) == 0 {
+			return nil
+		}
+
+		ids := make([]int64, len(users))
+		for i, u := range users {
+			ids[i] = u.ID
+		}
+
+		userLabels := make([]schema.UserLabel, 0)
+		sd = tx.From(schema.TableUserLabel).Where(goqu.C("user_id").In(ids))
+		if err := sd.Executor().ScanStructsContext(ctx, &userLabels); err != nil {
+			return err
+		}
+		userSettings := make([]schema.UserSetting, 0)
+		sd = tx.From(schema.TableUserSetting).Where(goqu.C("user_id").In(ids))
+		if err := sd.Executor().ScanStructsContext(ctx, &userSettings); err != nil {
+			return err
+		}
+		userGroups := make([]schema.UserGroup, 0)
+		sd = tx.From(schema.TableUserGroup).Where(goqu.C("user_id").In(ids))
+		if err := sd.Executor().ScanStructsContext(ctx, &userGroups); err != nil {
+			return err
+		}
+
+		if archive {
+			data := make(map[int64]*schema.UserArchiveData, len(users))
+			for _, u := range users {
+				data[u.ID] = &schema.UserArchiveData{
+					Labels:   make([]schema.UserLabel, 0),
+					Settings: make([]schema.UserSetting, 0),
+					Groups:   make([]schema.UserGroup, 0),
+				}
+			}
+			for _, v := range userLabels {
+				data[v.UserID].Labels = append(data[v.UserID].Labels, v)
+			}
+			for _, v := range userSettings {
+				data[v.UserID].Settings = append(data[v.UserID].Settings, v)
+			}
+			for _, v := range userGroups {
+				data[v.UserID].Groups = append(data[v.UserID].Groups, v)
+			}
+
+			archives := make([]interface{}, len(users))
+			for i, u := range users {
+				b, err := json.Marshal(data[u.ID])
+				if err != nil {
+					return err
+				}
+				archives[i] = &schema.UserArchive{
+					UserID:        u.ID,
+					UID:           u.UID,
+					UserCreatedAt: u.CreatedAt,
+					ActiveAt:      u.ActiveAt,
+					Data:          string(b),
+				}
+			}
+			if _, err := tx.Insert(schema.TableUserArchive).Rows(archives...).Executor().ExecContext(ctx); err != nil {
+				return err
+			}
+		}
+
+		if m.Cache.Enabled() {
+			caches := make([]schema.UserLabelCache, 0)
+			sd = tx.From(schema.TableUserLabelCache).Select("user_id", "product_id").Where(goqu.C("user_id").In(ids))
+			if err := sd.Executor().ScanStructsContext(ctx, &caches); err != nil {
+				return err
+			}
+			for _, c := range caches {
+				cacheKeys = append(cacheKeys, m.labelCacheKey(c.UserID, c.ProductID))
+			}
+		}
+
+		for _, table := range []string{schema.TableUserLabel, schema.TableUserSetting, schema.TableUserGroup, schema.TableUserLabelCache} {
+			_, err := tx.Delete(table).Where(goqu.C("user_id").In(ids)).Executor().ExecContext(ctx)
+			if err != nil {
+				return err
+			}
+		}
+		rowsAffected, err = service.DeResult(tx.Delete(schema.TableUser).
+			Where(goqu.C("id").In(ids)).Executor().ExecContext(ctx))
+		if err != nil {
+			return err
+		}
+
+		uids := make([]string, len(users))
+		for i, u := range users {
+			uids[i] = u.UID
+		}
+		data, err := json.Marshal(map[string]interface{}{"users": uids})
+		if err != nil {
+			return err
+		}
+		change := &schema.Change{Event: schema.EventUserPurged, Data: string(data)}
+		if _, err := tx.Insert(schema.TableChange).Rows(change).Executor().ExecContext(ctx); err != nil {
+			return err
+		}
+
+		for _, v := range userLabels {
+			if !tpl.Int64SliceHas(labelIDs, v.LabelID) {
+				labelIDs = append(labelIDs, v.LabelID)
+			}
+		}
+		for _, v := range userSettings {
+			if !tpl.Int64SliceHas(settingIDs, v.SettingID) {
+				settingIDs = append(settingIDs, v.SettingID)
+			}
+		}
+		for _, v := range userGroups {
+			if !tpl.Int64SliceHas(groupIDs, v.GroupID) {
+				groupIDs = append(groupIDs, v.GroupID)
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return 0, err
+	}
+	if err := m.Cache.Del(ctx, cacheKeys...); err != nil {
+		logging.Warningf("PurgeInactive: delete shared label caches error %v", err)
+	}
+	if rowsAffected > 0 {
+		util.Go(ctx, 5*time.Minute, func(gctx context.Context) {
+			m.tryIncreaseStatisticStatus(gctx, schema.UsersTotalSize, -int(rowsAffected))
+			// label 和 setting 的 Status 依赖 group 的 Status，所以先更新 group
+			for _, id := range groupIDs {
+				m.tryRefreshGroupStatus(gctx, id)
+			}
+			for _, id := range labelIDs {
+				m.tryRefreshLabelStatus(gctx, id)
+			}
+			for _, id := range settingIDs {
+				m.tryRefreshSettingStatus(gctx, id)
+			}
+		})
+	}
+	return rowsAffected, nil
+}
+
+func inactiveUsersExp(before time.Time) []exp.Expression {
+	return []exp.Expression{
+		goqu.C("active_at").Lt(before.Unix()),
+		goqu.C("created_at").Lt(before),
+	}
+}
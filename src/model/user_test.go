@@ -0,0 +1,107 @@
+package model
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/teambition/urbs-setting/src/conf"
+	"github.com/teambition/urbs-setting/src/schema"
+	"github.com/teambition/urbs-setting/src/service"
+)
+
+func TestUserSharedLabelCache(t *testing.T) {
+	srv, err := miniredis.Run()
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer srv.Close()
+
+	cfg := conf.Redis{Addr: srv.Addr()}
+	assert.Nil(t, cfg.Validate())
+	cache := service.NewRedisCache(cfg)
+	defer cache.Close()
+	m := &User{Model: &Model{Cache: cache}}
+	ctx := context.Background()
+
+	t.Run("getSharedLabelCache and setSharedLabelCache should work", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.Nil(m.getSharedLabelCache(ctx, 1, 2))
+
+		m.setSharedLabelCache(ctx, &schema.UserLabelCache{UserID: 1, ProductID: 2, ActiveAt: 100}, false)
+		c := m.getSharedLabelCache(ctx, 1, 2)
+		if assert.NotNil(c) {
+			assert.Equal(int64(100), c.ActiveAt)
+			assert.Equal("[]", c.Labels)
+		}
+		ttl := srv.TTL(m.labelCacheKey(1, 2))
+		assert.Equal(conf.Config.CacheLabelDoubleExpireDuration(), ttl)
+
+		// overwrite 为 false 时不覆盖已有缓存
+		m.setSharedLabelCache(ctx, &schema.UserLabelCache{UserID: 1, ProductID: 2, ActiveAt: 90, Labels: `[{"l":"a"}]`}, false)
+		assert.Equal(int64(100), m.getSharedLabelCache(ctx, 1, 2).ActiveAt)
+
+		m.setSharedLabelCache(ctx, &schema.UserLabelCache{UserID: 1, ProductID: 2, ActiveAt: 200, Labels: `[{"l":"b"}]`}, true)
+		c = m.getSharedLabelCache(ctx, 1, 2)
+		if assert.NotNil(c) {
+			assert.Equal(int64(200), c.ActiveAt)
+			assert.Equal(`[{"l":"b"}]`, c.Labels)
+		}
+
+		srv.Set(m.labelCacheKey(1, 2), "invalid json")
+		assert.Nil(m.getSharedLabelCache(ctx, 1, 2))
+	})
+
+	t.Run("invalidated cache should not be written back by stale reads", func(t *testing.T) {
+		assert := assert.New(t)
+
+		m.setSharedLabelCache(ctx, &schema.UserLabelCache{UserID: 3, ProductID: 2, ActiveAt: 100, Labels: `[{"l":"a"}]`}, true)
+		m.markSharedLabelCachesInvalid(ctx, []string{m.labelCacheKey(3, 2)})
+		assert.Nil(m.getSharedLabelCache(ctx, 3, 2))
+
+		// 标记过期前读取的数据不能写回
+		m.setSharedLabelCache(ctx, &schema.UserLabelCache{UserID: 3, ProductID: 2, ActiveAt: 100, Labels: `[{"l":"a"}]`}, false)
+		assert.Nil(m.getSharedLabelCache(ctx, 3, 2))
+
+		// 刷新后覆盖过期标记
+		m.setSharedLabelCache(ctx, &schema.UserLabelCache{UserID: 3, ProductID: 2, ActiveAt: 300}, true)
+		c := m.getSharedLabelCache(ctx, 3, 2)
+		if assert.NotNil(c) {
+			assert.Equal(int64(300), c.ActiveAt)
+			assert.Equal("[]", c.Labels)
+		}
+	})
+
+	t.Run("lockLabelCacheRefresh should only release its own lock", func(t *testing.T) {
+		assert := assert.New(t)
+
+		key := m.labelCacheKey(4, 2) + ":lock"
+		unlock, locked, err := m.lockLabelCacheRefresh(ctx, 4, 2)
+		assert.Nil(err)
+		assert.True(locked)
+
+		_, locked, err = m.lockLabelCacheRefresh(ctx, 4, 2)
+		assert.Nil(err)
+		assert.False(locked)
+
+		unlock()
+		assert.False(srv.Exists(key))
+
+		unlock, locked, err = m.lockLabelCacheRefresh(ctx, 4, 2)
+		assert.Nil(err)
+		assert.True(locked)
+
+		// 锁过期后被其它请求获取，原持有者释放时不能删除
+		srv.FastForward(11 * time.Second)
+		unlock2, locked, err := m.lockLabelCacheRefresh(ctx, 4, 2)
+		assert.Nil(err)
+		assert.True(locked)
+		unlock()
+		assert.True(srv.Exists(key))
+		unlock2()
+		assert.False(srv.Exists(key))
+	})
+}
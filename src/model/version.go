@@ -0,0 +1,161 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/teambition/gear"
+	"github.com/teambition/urbs-setting/src/schema"
+	"github.com/teambition/urbs-setting/src/service"
+	"github.com/teambition/urbs-setting/src/tpl"
+)
+
+// Version ...
+type Version struct {
+	*Model
+}
+
+// Snapshot 读取环境标签或配置项当前的定义（包括灰度发布规则），与最新版本不同时保存为新版本。
+// restored 不为 0 时表示由该版本恢复，总是保存为新版本。返回最新版本
+func (m *Version) Snapshot(ctx context.Context, kind string, objectID, restored int64) (*schema.Version, error) {
+	var snapshot schema.DefinitionSnapshot
+	var err error
+	switch kind {
+	case schema.VersionLabel:
+		snapshot, err = m.labelSnapshot(ctx, objectID)
+	case schema.VersionSetting:
+		snapshot, err = m.settingSnapshot(ctx, objectID)
+	default:
+		err = gear.ErrBadRequest.WithMsgf("invalid version kind: %s", kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	actor := ""
+	if log := service.AuditLogFrom(ctx); log != nil {
+		actor = log.Actor
+	}
+	// 并发写入同一版本号时唯一索引冲突，重试几次
+	for i := 0; ; i++ {
+		latest, err := m.findLatest(ctx, kind, objectID)
+		if err != nil {
+			return nil, err
+		}
+		if latest != nil && restored == 0 && latest.GetSnapshot().Equal(snapshot) {
+			return latest, nil
+		}
+
+		version := &schema.Version{Kind: kind, ObjectID: objectID, Version: 1, Actor: actor, Restored: restored}
+		if latest != nil {
+			version.Version = latest.Version + 1
+		}
+		if err = version.PutSnapshot(snapshot); err != nil {
+			return nil, err
+		}
+		if _, err = m.createOne(ctx, schema.TableVersion, version); err == nil || i >= 2 {
+			return version, err
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Acquire 读取指定版本，version 为 0 时读取最新版本，不存在时返回 404 错误
+func (m *Version) Acquire(ctx context.Context, kind string, objectID, version int64) (*schema.Version, error) {
+	if version == 0 {
+		v, err := m.findLatest(ctx, kind, objectID)
+		if err == nil && v == nil {
+			err = gear.ErrNotFound.WithMsgf("%s %d has no version", kind, objectID)
+		}
+		return v, err
+	}
+
+	v := &schema.Version{}
+	ok, err := m.findOneByCols(ctx, schema.TableVersion,
+		goqu.Ex{"kind": kind, "object_id": objectID, "version": version}, "", v)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, gear.ErrNotFound.WithMsgf("%s version %d not found", kind, version)
+	}
+	return v, nil
+}
+
+// Find 返回指定对象的版本列表，按版本倒序
+func (m *Version) Find(ctx context.Context, kind string, objectID int64, pg tpl.Pagination) ([]schema.Version, int, error) {
+	versions := make([]schema.Version, 0)
+	cursor := pg.TokenToID()
+	sdc := m.rdDB(ctx).From(schema.TableVersion).
+		Where(goqu.C("kind").Eq(kind), goqu.C("object_id").Eq(objectID))
+	sd := m.rdDB(ctx).From(schema.TableVersion).
+		Where(goqu.C("kind").Eq(kind), goqu.C("object_id").Eq(objectID), goqu.C("id").Lte(cursor)).
+		Order(goqu.C("id").Desc()).Limit(uint(pg.PageSize + 1))
+
+	total, err := sdc.CountContext(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err = sd.Executor().ScanStructsContext(ctx, &versions); err != nil {
+		return nil, 0, err
+	}
+	return versions, int(total), nil
+}
+
+func (m *Version) findLatest(ctx context.Context, kind string, objectID int64) (*schema.Version, error) {
+	v := &schema.Version{}
+	sd := m.DB.From(schema.TableVersion).
+		Where(goqu.C("kind").Eq(kind), goqu.C("object_id").Eq(objectID)).
+		Order(goqu.C("version").Desc()).Limit(1)
+	ok, err := sd.Executor().ScanStructContext(ctx, v)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return v, nil
+}
+
+// labelSnapshot 从主库读取环境标签当前的定义
+func (m *Version) labelSnapshot(ctx context.Context, labelID int64) (schema.DefinitionSnapshot, error) {
+	s := schema.DefinitionSnapshot{}
+	label := &schema.Label{}
+	if err := m.findOneByID(ctx, schema.TableLabel, labelID, label); err != nil {
+		return s, err
+	}
+	rules := make([]schema.LabelRule, 0)
+	sd := m.DB.From(schema.TableLabelRule).Where(goqu.C("label_id").Eq(labelID))
+	if err := sd.Executor().ScanStructsContext(ctx, &rules); err != nil {
+		return s, err
+	}
+
+	s.Desc = label.Desc
+	s.Channels = tpl.StringToSlice(label.Channels)
+	s.Clients = tpl.StringToSlice(label.Clients)
+	for _, r := range rules {
+		s.Rules = append(s.Rules, schema.RuleSnapshot{Kind: r.Kind, Rule: r.Rule})
+	}
+	return s, nil
+}
+
+// settingSnapshot 从主库读取配置项当前的定义
+func (m *Version) settingSnapshot(ctx context.Context, settingID int64) (schema.DefinitionSnapshot, error) {
+	s := schema.DefinitionSnapshot{}
+	setting := &schema.Setting{}
+	if err := m.findOneByID(ctx, schema.TableSetting, settingID, setting); err != nil {
+		return s, err
+	}
+	rules := make([]schema.SettingRule, 0)
+	sd := m.DB.From(schema.TableSettingRule).Where(goqu.C("setting_id").Eq(settingID))
+	if err := sd.Executor().ScanStructsContext(ctx, &rules); err != nil {
+		return s, err
+	}
+
+	s.Desc = setting.Desc
+	s.Channels = tpl.StringToSlice(setting.Channels)
+	s.Clients = tpl.StringToSlice(setting.Clients)
+	s.Values = tpl.StringToSlice(setting.Values)
+	for _, r := range rules {
+		s.Rules = append(s.Rules, schema.RuleSnapshot{Kind: r.Kind, Rule: r.Rule, Value: r.Value})
+	}
+	return s, nil
+}
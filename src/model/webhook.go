@@ -0,0 +1,155 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/teambition/urbs-setting/src/schema"
+	"github.com/teambition/urbs-setting/src/tpl"
+)
+
+// Webhook ...
+type Webhook struct {
+	*Model
+}
+
+// Create 创建 webhook 订阅
+func (m *Webhook) Create(ctx context.Context, webhook *schema.Webhook) error {
+	_, err := m.createOne(ctx, schema.TableWebhook, webhook)
+	return err
+}
+
+// Acquire ...
+func (m *Webhook) Acquire(ctx context.Context, id int64) (*schema.Webhook, error) {
+	webhook := &schema.Webhook{}
+	if err := m.findOneByID(ctx, schema.TableWebhook, id, webhook); err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+// Find 返回产品下的全部 webhook 订阅
+func (m *Webhook) Find(ctx context.Context, productID int64) ([]schema.Webhook, error) {
+	webhooks := make([]schema.Webhook, 0)
+	sd := m.rdDB(ctx).From(schema.TableWebhook).
+		Where(goqu.C("product_id").Eq(productID)).
+		Order(goqu.C("id").Asc()).Limit(100)
+	if err := sd.Executor().ScanStructsContext(ctx, &webhooks); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// FindByEvent 返回产品下订阅了指定事件的 webhook
+func (m *Webhook) FindByEvent(ctx context.Context, productID int64, event string) ([]schema.Webhook, error) {
+	webhooks, err := m.Find(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+	res := webhooks[:0]
+	for _, w := range webhooks {
+		if w.Events == "" || tpl.StringSliceHas(tpl.StringToSlice(w.Events), event) {
+			res = append(res, w)
+		}
+	}
+	return res, nil
+}
+
+// Update ...
+func (m *Webhook) Update(ctx context.Context, id int64, changed map[string]interface{}) (*schema.Webhook, error) {
+	m.auditBefore(ctx, schema.TableWebhook, id, &schema.Webhook{})
+	if _, err := m.updateByID(ctx, schema.TableWebhook, id, goqu.Record(changed)); err != nil {
+		return nil, err
+	}
+	return m.Acquire(ctx, id)
+}
+
+// Delete 删除 webhook 订阅及其投递记录
+func (m *Webhook) Delete(ctx context.Context, id int64) (int64, error) {
+	m.auditBefore(ctx, schema.TableWebhook, id, &schema.Webhook{})
+	rowsAffected, err := m.deleteByID(ctx, schema.TableWebhook, id)
+	if err != nil {
+		return 0, err
+	}
+	_, err = m.deleteByCols(ctx, schema.TableWebhookDelivery, goqu.Ex{"webhook_id": id})
+	return rowsAffected, err
+}
+
+// CreateDelivery 创建待投递记录
+func (m *Webhook) CreateDelivery(ctx context.Context, delivery *schema.WebhookDelivery) error {
+	delivery.Status = schema.WebhookDeliveryPending
+	delivery.NextAt = time.Now().UTC()
+	_, err := m.createOne(ctx, schema.TableWebhookDelivery, delivery)
+	return err
+}
+
+// AcquireDelivery ...
+func (m *Webhook) AcquireDelivery(ctx context.Context, id int64) (*schema.WebhookDelivery, error) {
+	delivery := &schema.WebhookDelivery{}
+	if err := m.findOneByID(ctx, schema.TableWebhookDelivery, id, delivery); err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// FindDeliveries 返回 webhook 的投递记录，按时间倒序
+func (m *Webhook) FindDeliveries(ctx context.Context, webhookID int64, pg tpl.Pagination) ([]schema.WebhookDelivery, int, error) {
+	deliveries := make([]schema.WebhookDelivery, 0)
+	cursor := pg.TokenToID()
+	sdc := m.rdDB(ctx).From(schema.TableWebhookDelivery).
+		Where(goqu.C("webhook_id").Eq(webhookID))
+	sd := m.rdDB(ctx).From(schema.TableWebhookDelivery).
+		Where(goqu.C("webhook_id").Eq(webhookID), goqu.C("id").Lte(cursor)).
+		Order(goqu.C("id").Desc()).Limit(uint(pg.PageSize + 1))
+
+	total, err := sdc.CountContext(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err = sd.Executor().ScanStructsContext(ctx, &deliveries); err != nil {
+		return nil, 0, err
+	}
+	return deliveries, int(total), nil
+}
+
+// FindDueDeliveryIDs 返回已到投递时间的待投递记录 ID
+func (m *Webhook) FindDueDeliveryIDs(ctx context.Context, limit int) ([]int64, error) {
+	ids := make([]int64, 0)
+	sd := m.DB.From(schema.TableWebhookDelivery).Select("id").
+		Where(goqu.C("status").Eq(schema.WebhookDeliveryPending), goqu.C("next_at").Lte(time.Now().UTC())).
+		Order(goqu.C("next_at").Asc()).Limit(uint(limit))
+	if err := sd.Executor().ScanValsContext(ctx, &ids); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// ClaimDelivery 抢占一条已到投递时间的待投递记录，抢占成功后 lease 时间内其它实例不会重复投递
+func (m *Webhook) ClaimDelivery(ctx context.Context, id int64, lease time.Duration) (bool, error) {
+	now := time.Now().UTC()
+	rowsAffected, err := m.updateByCols(ctx, schema.TableWebhookDelivery,
+		goqu.Ex{"id": id, "status": schema.WebhookDeliveryPending, "next_at": goqu.Op{"lte": now}},
+		goqu.Record{"next_at": now.Add(lease)})
+	return rowsAffected > 0, err
+}
+
+// UpdateDelivery ...
+func (m *Webhook) UpdateDelivery(ctx context.Context, id int64, changed map[string]interface{}) error {
+	_, err := m.updateByID(ctx, schema.TableWebhookDelivery, id, goqu.Record(changed))
+	return err
+}
+
+// ResetDelivery 把投递记录重置为待投递，用于手动重新投递
+func (m *Webhook) ResetDelivery(ctx context.Context, id int64) (*schema.WebhookDelivery, error) {
+	_, err := m.updateByID(ctx, schema.TableWebhookDelivery, id, goqu.Record{
+		"status":       schema.WebhookDeliveryPending,
+		"attempts":     0,
+		"next_at":      time.Now().UTC(),
+		"delivered_at": nil,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m.AcquireDelivery(ctx, id)
+}
@@ -0,0 +1,47 @@
+package schema
+
+// schema 模块不要引入官方库以外的其它模块或内部模块
+import (
+	"time"
+)
+
+// TableAPIKey is a table name in db.
+const TableAPIKey = "urbs_api_key"
+
+// API key 的 scope，admin:product:<name> 为指定产品的全部权限
+const (
+	ScopeAdmin        = "admin"          // 全部权限
+	ScopeAdminProduct = "admin:product:" // 前缀，加上产品名称，为该产品下的全部权限
+	ScopeReadAll      = "read:all"       // 全部读接口
+	ScopeReadEvaluate = "read:evaluate"  // 读取用户、群组的环境标签和配置项
+	ScopeWriteAll     = "write:all"      // 全部写接口
+	ScopeWriteAssign  = "write:assign"   // 为用户、群组设置或撤销环境标签和配置项，触发应用规则
+)
+
+// APIKey 详见 ./sql/schema.sql table `urbs_api_key`
+// 记录数据库管理的 API key，只保存 key 的 SHA-256 哈希
+type APIKey struct {
+	ID         int64      `db:"id" goqu:"skipinsert"`
+	CreatedAt  time.Time  `db:"created_at" goqu:"skipinsert"`
+	UpdatedAt  time.Time  `db:"updated_at" goqu:"skipinsert"`
+	Name       string     `db:"name"`         // varchar(63)，key 的用途说明
+	Hash       string     `db:"hash"`         // char(64)，key 密文部分的 SHA-256 hex
+	Scopes     string     `db:"scopes"`       // varchar(1022)，逗号分隔的 scope
+	CreatedBy  string     `db:"created_by"`   // varchar(255)，创建者身份
+	ExpiredAt  *time.Time `db:"expired_at"`   // 过期时间，为空则不过期
+	RevokedAt  *time.Time `db:"revoked_at"`   // 撤销时间，为空则未撤销
+	LastUsedAt *time.Time `db:"last_used_at"` // 最近使用时间
+}
+
+// TableName retuns table name
+func (APIKey) TableName() string {
+	return "urbs_api_key"
+}
+
+// IsActive 判断 key 在 now 时是否有效，即未撤销且未过期
+func (k *APIKey) IsActive(now time.Time) bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	return k.ExpiredAt == nil || now.Before(*k.ExpiredAt)
+}
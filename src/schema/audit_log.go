@@ -0,0 +1,29 @@
+package schema
+
+// schema 模块不要引入官方库以外的其它模块或内部模块
+import (
+	"time"
+)
+
+// TableAuditLog is a table name in db.
+const TableAuditLog = "urbs_audit_log"
+
+// AuditLog 详见 ./sql/schema.sql table `urbs_audit_log`
+// 写操作的审计日志
+type AuditLog struct {
+	ID        int64     `db:"id" json:"-" goqu:"skipinsert"`
+	CreatedAt time.Time `db:"created_at" json:"createdAt" goqu:"skipinsert"`
+	Actor     string    `db:"actor" json:"actor"`     // varchar(255)，操作者身份，即 OTVID subject 或 jwt_sub
+	Action    string    `db:"action" json:"action"`   // varchar(255)，操作，即请求方法和路由，如 PUT /v1/products/:product+:offline
+	Product   string    `db:"product" json:"product"` // varchar(63)，操作所属的产品名称，与产品无关则为空
+	Target    string    `db:"target" json:"target"`   // varchar(1022)，操作对象，即请求路径，如 /v1/products/urbs+:offline
+	Status    int       `db:"status" json:"status"`   // 响应状态码
+	Body      string    `db:"body" json:"body"`       // mediumtext，请求参数，JSON 字符串
+	Before    string    `db:"before" json:"before"`   // mediumtext，变更前的数据，JSON 字符串，没有则为空
+	After     string    `db:"after" json:"after"`     // mediumtext，变更后的数据，即响应结果，JSON 字符串
+}
+
+// TableName retuns table name
+func (AuditLog) TableName() string {
+	return "urbs_audit_log"
+}
@@ -0,0 +1,53 @@
+package schema
+
+// schema 模块不要引入官方库以外的其它模块或内部模块
+import (
+	"time"
+)
+
+// TableChange is a table name in db.
+const TableChange = "urbs_change"
+
+// 变更流事件类型，除 webhook 事件类型外还包括以下事件
+const (
+	EventProductCreated       = "product.created"
+	EventProductUpdated       = "product.updated"
+	EventProductDeleted       = "product.deleted"
+	EventModuleCreated        = "module.created"
+	EventModuleUpdated        = "module.updated"
+	EventLabelCreated         = "label.created"
+	EventLabelUpdated         = "label.updated"
+	EventLabelDeleted         = "label.deleted"
+	EventLabelUserRemoved     = "label.user.removed"
+	EventLabelGroupRemoved    = "label.group.removed"
+	EventSettingCreated       = "setting.created"
+	EventSettingUpdated       = "setting.updated"
+	EventSettingDeleted       = "setting.deleted"
+	EventSettingUserRemoved   = "setting.user.removed"
+	EventSettingUserRollback  = "setting.user.rollback"
+	EventSettingGroupRemoved  = "setting.group.removed"
+	EventSettingGroupRollback = "setting.group.rollback"
+	EventGroupCreated         = "group.created"
+	EventGroupUpdated         = "group.updated"
+	EventGroupDeleted         = "group.deleted"
+	EventGroupMembersAdded    = "group.members.added"
+	EventGroupMembersRemoved  = "group.members.removed"
+	EventUserPurged           = "user.purged"
+)
+
+// Change 详见 ./sql/schema.sql table `urbs_change`
+// 变更流事件，与对应的写操作在同一事务中写入（transactional outbox）。
+// 自增 ID 在写入时分配，与提交顺序不一定一致，变更流游标使用提交后由后台任务按可见顺序分配的 Seq
+type Change struct {
+	ID        int64     `db:"id" goqu:"skipinsert"`
+	Seq       int64     `db:"seq" goqu:"skipinsert"` // 变更流序号，分配前为 NULL，只读取已分配序号的事件
+	CreatedAt time.Time `db:"created_at" goqu:"skipinsert"`
+	Product   string    `db:"product"` // varchar(63)，事件所属的产品名称，与产品无关（如群组、用户）则为空
+	Event     string    `db:"event"`   // varchar(63)，事件类型，如 label.assigned
+	Data      string    `db:"data"`    // mediumtext，事件数据，JSON 字符串
+}
+
+// TableName retuns table name
+func (Change) TableName() string {
+	return "urbs_change"
+}
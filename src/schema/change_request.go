@@ -0,0 +1,84 @@
+package schema
+
+// schema 模块不要引入官方库以外的其它模块或内部模块
+import (
+	"time"
+)
+
+// TableChangeRequest is a table name in db.
+const TableChangeRequest = "urbs_change_request"
+
+// 受保护产品需要审批的操作
+const (
+	ActionLabelUpdate          = "label.update"
+	ActionLabelDelete          = "label.delete"
+	ActionLabelAssign          = "label.assign"
+	ActionLabelRecall          = "label.recall"
+	ActionLabelCleanup         = "label.cleanup"
+	ActionLabelOffline         = "label.offline"
+	ActionLabelUserDelete      = "label.user.delete"
+	ActionLabelGroupDelete     = "label.group.delete"
+	ActionLabelRuleCreate      = "label.rule.create"
+	ActionLabelRuleUpdate      = "label.rule.update"
+	ActionLabelRuleDelete      = "label.rule.delete"
+	ActionLabelRestore         = "label.version.restore"
+	ActionSettingUpdate        = "setting.update"
+	ActionSettingAssign        = "setting.assign"
+	ActionSettingRecall        = "setting.recall"
+	ActionSettingCleanup       = "setting.cleanup"
+	ActionSettingOffline       = "setting.offline"
+	ActionSettingUserDelete    = "setting.user.delete"
+	ActionSettingUserRollback  = "setting.user.rollback"
+	ActionSettingGroupDelete   = "setting.group.delete"
+	ActionSettingGroupRollback = "setting.group.rollback"
+	ActionSettingRuleCreate    = "setting.rule.create"
+	ActionSettingRuleUpdate    = "setting.rule.update"
+	ActionSettingRuleDelete    = "setting.rule.delete"
+	ActionSettingRestore       = "setting.version.restore"
+	ActionModuleUpdate         = "module.update"
+	ActionModuleOffline        = "module.offline"
+	ActionProductUpdate        = "product.update" // 只有取消产品的保护需要审批
+	ActionProductOffline       = "product.offline"
+	ActionProductDelete        = "product.delete"
+	ActionProductApply         = "product.apply"
+	ActionProductClone         = "product.clone"
+	ActionProductPromote       = "product.promote"
+)
+
+// 变更申请状态
+const (
+	ChangeRequestPending  = "pending"
+	ChangeRequestApplied  = "applied"  // 已批准并执行成功
+	ChangeRequestFailed   = "failed"   // 已批准但执行失败
+	ChangeRequestRejected = "rejected" // 已拒绝
+	ChangeRequestExpired  = "expired"  // 超过有效期未审批
+)
+
+// ChangeRequest 详见 ./sql/schema.sql table `urbs_change_request`
+// 受保护产品上待审批的写操作
+type ChangeRequest struct {
+	ID        int64      `db:"id" goqu:"skipinsert"`
+	CreatedAt time.Time  `db:"created_at" goqu:"skipinsert"`
+	UpdatedAt time.Time  `db:"updated_at" goqu:"skipinsert"`
+	ProductID int64      `db:"product_id"` // 所从属的产品线 ID
+	Action    string     `db:"action"`     // varchar(63)，操作类型，如 label.assign
+	Target    string     `db:"target"`     // varchar(1022)，操作对象，即原始请求路径
+	Payload   string     `db:"payload"`    // mediumtext，执行操作所需的完整参数，JSON 字符串
+	Status    string     `db:"status"`     // varchar(15)，pending、applied、failed、rejected 或 expired
+	CreatedBy string     `db:"created_by"` // varchar(255)，申请者身份
+	DecidedBy string     `db:"decided_by"` // varchar(255)，审批者身份
+	DecidedAt *time.Time `db:"decided_at"` // 审批或过期时间
+	Reason    string     `db:"reason"`     // varchar(1022)，审批意见
+	Result    string     `db:"result"`     // mediumtext，执行结果或错误信息
+	ExpiredAt time.Time  `db:"expired_at"` // 过期时间，过期后不能再审批
+}
+
+// TableName retuns table name
+func (ChangeRequest) TableName() string {
+	return "urbs_change_request"
+}
+
+// IsActionable 是否可以审批
+func (c ChangeRequest) IsActionable(now time.Time) bool {
+	return c.Status == ChangeRequestPending && now.Before(c.ExpiredAt)
+}
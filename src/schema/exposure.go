@@ -0,0 +1,37 @@
+package schema
+
+// schema 模块不要引入官方库以外的其它模块或内部模块
+import (
+	"strconv"
+	"strings"
+)
+
+// 曝光事件类型
+const (
+	ExposureSetting = "setting"
+	ExposureLabel   = "label"
+)
+
+// Exposure 曝光事件，记录用户实际获取到的配置项值或环境标签，不落库，由 exposure sink 输出
+type Exposure struct {
+	Kind      string `json:"kind"` // setting 或 label
+	UID       string `json:"uid"`
+	Product   string `json:"product"`
+	Module    string `json:"module,omitempty"`
+	Setting   string `json:"setting,omitempty"`
+	Label     string `json:"label,omitempty"`
+	Value     string `json:"value,omitempty"`
+	Release   int64  `json:"release,omitempty"`
+	Rule      string `json:"rule,omitempty"` // 值来自百分比规则时为规则 HID
+	Timestamp int64  `json:"timestamp"`      // 毫秒
+}
+
+// DedupKey 返回去重键，同一用户同一配置项（或环境标签）在去重窗口内只输出一次
+func (e *Exposure) DedupKey() string {
+	return strings.Join([]string{e.Kind, e.UID, e.Product, e.Module, e.Setting, e.Label}, "\x00")
+}
+
+// DedupValue 返回去重值，值或批次变化时即使在去重窗口内也会再次输出
+func (e *Exposure) DedupValue() string {
+	return e.Value + "\x00" + e.Rule + "\x00" + strconv.FormatInt(e.Release, 10)
+}
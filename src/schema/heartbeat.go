@@ -0,0 +1,25 @@
+package schema
+
+import "time"
+
+// schema 模块不要引入官方库以外的其它模块或内部模块
+
+// TableHeartbeat is a table name in db.
+const TableHeartbeat = "urbs_heartbeat"
+
+// HeartbeatReplica 从库延迟检测的心跳名称
+const HeartbeatReplica = "replica"
+
+// Heartbeat 详见 ./sql/schema.sql table `urbs_heartbeat`
+// 内部心跳，用于检测从库延迟等运行状态，不属于统计数据
+type Heartbeat struct {
+	ID        int64     `db:"id" goqu:"skipinsert"`
+	UpdatedAt time.Time `db:"updated_at" goqu:"skipinsert"`
+	Name      string    `db:"name"`    // varchar(127) 心跳名称，表内唯一
+	BeatAt    int64     `db:"beat_at"` // 主库写入时的毫秒时间戳
+}
+
+// TableName retuns table name
+func (Heartbeat) TableName() string {
+	return "urbs_heartbeat"
+}
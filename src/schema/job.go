@@ -0,0 +1,68 @@
+package schema
+
+// schema 模块不要引入官方库以外的其它模块或内部模块
+import (
+	"time"
+)
+
+// TableJob is a table name in db.
+const TableJob = "urbs_job"
+
+// TableJobError is a table name in db.
+const TableJobError = "urbs_job_error"
+
+// 后台任务类型
+const (
+	// JobInvalidateLabelCache 群组标签或成员变更后，分批将受影响用户的 labels 缓存标记为过期
+	JobInvalidateLabelCache = "invalidate_label_cache"
+	// JobImportUsers 从 CSV 或 NDJSON 文件分批导入用户
+	JobImportUsers = "import_users"
+	// JobImportGroups 从 CSV 或 NDJSON 文件分批导入群组
+	JobImportGroups = "import_groups"
+	// JobImportMembers 从 CSV 或 NDJSON 文件分批导入群组成员，并将其 labels 缓存标记为过期
+	JobImportMembers = "import_members"
+)
+
+// 后台任务状态
+const (
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// Job 详见 ./sql/schema.sql table `urbs_job`
+// 可追踪进度的后台任务
+type Job struct {
+	ID          int64      `db:"id" json:"-" goqu:"skipinsert"`
+	HID         string     `db:"-" json:"hid"`
+	CreatedAt   time.Time  `db:"created_at" json:"createdAt" goqu:"skipinsert"`
+	UpdatedAt   time.Time  `db:"updated_at" json:"updatedAt" goqu:"skipinsert"`
+	Kind        string     `db:"kind" json:"kind"`               // varchar(63)，任务类型
+	Target      string     `db:"target" json:"target"`           // varchar(255)，任务对象，如 group:organization/abc
+	Status      string     `db:"status" json:"status"`           // varchar(15)，任务状态，running、succeeded 或 failed
+	Processed   int64      `db:"processed" json:"processed"`     // 已处理的用户数，导入任务为已写入的行数
+	Invalidated int64      `db:"invalidated" json:"invalidated"` // 缓存被标记为过期的用户数
+	Failed      int64      `db:"failed" json:"failed"`           // 导入任务中无效的行数
+	Message     string     `db:"message" json:"message"`         // varchar(1022)，任务失败原因
+	FinishedAt  *time.Time `db:"finished_at" json:"finishedAt"`  // 任务结束时间
+}
+
+// TableName retuns table name
+func (Job) TableName() string {
+	return "urbs_job"
+}
+
+// JobError 详见 ./sql/schema.sql table `urbs_job_error`
+// 导入任务中无效的行
+type JobError struct {
+	ID      int64  `db:"id" json:"-" goqu:"skipinsert"`
+	JobID   int64  `db:"job_id" json:"-"`
+	Line    int64  `db:"line" json:"line"`       // 行号，从 1 开始，CSV 包括标题行
+	UID     string `db:"uid" json:"uid"`         // varchar(63)，该行的 uid，无法解析时为空
+	Message string `db:"message" json:"message"` // varchar(1022)，错误原因
+}
+
+// TableName retuns table name
+func (JobError) TableName() string {
+	return "urbs_job_error"
+}
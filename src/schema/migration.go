@@ -0,0 +1,33 @@
+package schema
+
+// schema 模块不要引入官方库以外的其它模块或内部模块
+
+// Migration 数据库结构升级，详见 ./sql/update_*.sql
+// 以升级新增的表或列作为标记，标记存在即认为已执行该升级
+type Migration struct {
+	Version string // 升级脚本的日期，如 20210119
+	Table   string
+	Column  string // 为空时只检查表是否存在
+}
+
+// Migrations 当前代码依赖的数据库结构升级，新增 ./sql/update_*.sql 时需同步添加
+var Migrations = []Migration{
+	{Version: "20200424", Table: TableGroup, Column: "status"},
+	{Version: "20201105", Table: TableUserLabelCache},
+	{Version: "20201120", Table: TableUserArchive},
+	{Version: "20201125", Table: TableJob},
+	{Version: "20201201", Table: TableAuditLog},
+	{Version: "20201208", Table: TableVersion},
+	{Version: "20201215", Table: TableWebhookDelivery},
+	{Version: "20201222", Table: TableChange},
+	{Version: "20201229", Table: TableRoleBinding},
+	{Version: "20210105", Table: TableAPIKey},
+	{Version: "20210112", Table: TableChangeRequest},
+	{Version: "20210119", Table: TableJobError},
+	{Version: "20210119", Table: TableJob, Column: "failed"},
+	{Version: "20210126", Table: TableStatisticDaily},
+	{Version: "20210202", Table: TableLabel, Column: "exact_status"},
+	{Version: "20210202", Table: TableSetting, Column: "exact_status"},
+	{Version: "20210209", Table: TableHeartbeat},
+	{Version: "20210216", Table: TableChange, Column: "seq"},
+}
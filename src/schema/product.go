@@ -19,6 +19,7 @@ type Product struct {
 	Name      string     `db:"name" json:"name"`            // varchar(63) 产品线名称，表内唯一
 	Desc      string     `db:"description" json:"desc"`     // varchar(1022) 产品线描述
 	Status    int64      `db:"status" json:"status"`        // -1 下线弃用，未使用
+	Protected bool       `db:"protected" json:"protected"`  // 受保护产品的关键写操作需要他人审批后才执行
 }
 
 // TableName retuns table name
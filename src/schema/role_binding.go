@@ -0,0 +1,48 @@
+package schema
+
+// schema 模块不要引入官方库以外的其它模块或内部模块
+import (
+	"time"
+)
+
+// TableRoleBinding is a table name in db.
+const TableRoleBinding = "urbs_role_binding"
+
+// 角色，权限依次递减，高权限角色包含低权限角色的全部权限
+const (
+	RoleAdmin  = "admin"  // 只能全局授予，可以执行全部操作，包括管理全局角色和创建产品
+	RoleOwner  = "owner"  // 可以更新、下线和删除产品，管理产品的 webhook 和角色
+	RoleEditor = "editor" // 可以执行产品下功能模块、配置项和环境标签的写操作
+	RoleViewer = "viewer" // 只能执行读操作
+)
+
+// RoleLevel 返回角色的权限等级，无效角色返回 0
+func RoleLevel(role string) int {
+	switch role {
+	case RoleAdmin:
+		return 4
+	case RoleOwner:
+		return 3
+	case RoleEditor:
+		return 2
+	case RoleViewer:
+		return 1
+	}
+	return 0
+}
+
+// RoleBinding 详见 ./sql/schema.sql table `urbs_role_binding`
+// 记录授予请求者（OTVID 或 JWT sub）的角色，同一请求者在同一范围内只有一个角色
+type RoleBinding struct {
+	ID        int64     `db:"id" goqu:"skipinsert"`
+	CreatedAt time.Time `db:"created_at" goqu:"skipinsert"`
+	UpdatedAt time.Time `db:"updated_at" goqu:"skipinsert"`
+	Subject   string    `db:"subject"`    // varchar(255)，请求者身份
+	ProductID int64     `db:"product_id"` // 产品内部 ID，为 0 表示全局角色
+	Role      string    `db:"role"`       // varchar(15)，角色
+}
+
+// TableName retuns table name
+func (RoleBinding) TableName() string {
+	return "urbs_role_binding"
+}
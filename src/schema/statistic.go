@@ -36,4 +36,6 @@ const (
 	SettingsTotalSize     StatisticKey = "SettingsTotalSize"
 	LabelRulesTotalSize   StatisticKey = "LabelRulesTotalSize"
 	SettingRulesTotalSize StatisticKey = "SettingRulesTotalSize"
+	// NameCacheVersion 名称到 ID 缓存的版本，用于跨实例失效
+	NameCacheVersion StatisticKey = "NameCacheVersion"
 )
@@ -0,0 +1,44 @@
+package schema
+
+import "time"
+
+// schema 模块不要引入官方库以外的其它模块或内部模块
+
+// TableStatisticDaily is a table name in db.
+const TableStatisticDaily = "urbs_statistic_daily"
+
+// 按天统计的指标
+const (
+	// MetricAssignments 灰度发布作用的用户和群组数
+	MetricAssignments = "assignments"
+	// MetricRuleHits 命中发布规则的用户数（含匿名用户）
+	MetricRuleHits = "rule_hits"
+	// MetricRecalls 撤回灰度发布的次数
+	MetricRecalls = "recalls"
+	// MetricActiveUsers 当天刷新过 labels 缓存的用户数，由每天的汇总任务写入，只有产品维度
+	MetricActiveUsers = "active_users"
+)
+
+// 按天统计的对象类型
+const (
+	StatisticKindProduct = "product"
+	StatisticKindLabel   = "label"
+	StatisticKindSetting = "setting"
+)
+
+// StatisticDaily 详见 ./sql/schema.sql table `urbs_statistic_daily`
+// 按天（UTC）的时间序列统计
+type StatisticDaily struct {
+	ID        int64     `db:"id" goqu:"skipinsert"`
+	Day       time.Time `db:"day"` // date，UTC 日期
+	ProductID int64     `db:"product_id"`
+	Metric    string    `db:"metric"`    // varchar(63)，统计指标，如 assignments
+	Kind      string    `db:"kind"`      // varchar(63)，统计对象类型：product、label 或 setting
+	ObjectID  int64     `db:"object_id"` // 统计对象的 ID，kind 为 product 时为 0
+	Value     int64     `db:"value"`
+}
+
+// TableName retuns table name
+func (StatisticDaily) TableName() string {
+	return "urbs_statistic_daily"
+}
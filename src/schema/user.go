@@ -11,14 +11,14 @@ const TableUser = "urbs_user"
 
 // User 详见 ./sql/schema.sql table `urbs_user`
 // 记录用户外部唯一 ID，uid 和最近活跃时间
-// 缓存用户当前全部 label，根据 active_at 和 cache_label_expire 刷新
-// labels 格式：TODO
+// 用户 label 缓存按产品存储在 `user_label_cache` 表，Labels 字段不再落库，仅用于接口返回
+// labels 格式：{"product":{"activeAt":0,"labels":[{"l":"label","cls":["client"],"chs":["channel"]}]}}
 type User struct {
 	ID        int64     `db:"id" json:"-" goqu:"skipinsert"`
 	CreatedAt time.Time `db:"created_at" json:"createdAt" goqu:"skipinsert"`
 	UID       string    `db:"uid" json:"uid"`            // varchar(63)，用户外部ID，表内唯一， 如 Teambition user id
 	ActiveAt  int64     `db:"active_at" json:"activeAt"` // 最近活跃时间戳，1970 以来的秒数，但不及时更新
-	Labels    string    `db:"labels" json:"labels"`      // varchar(8190)，缓存用户当前被设置的 labels
+	Labels    string    `db:"-" json:"labels"`           // 由 user_label_cache 组装的 labels 缓存
 }
 
 // GetUsersUID 返回 users 数组的 uid 数组
@@ -43,6 +43,7 @@ type MyLabelInfo struct {
 	Channels  string    `db:"channels"`
 	Clients   string    `db:"clients"`
 	Product   string    `db:"product"`
+	ProductID int64     `db:"product_id"`
 }
 
 // UserCache 用于在 User 数据上缓存数据
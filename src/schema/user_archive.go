@@ -0,0 +1,33 @@
+package schema
+
+// schema 模块不要引入官方库以外的其它模块或内部模块
+import (
+	"time"
+)
+
+// TableUserArchive is a table name in db.
+const TableUserArchive = "urbs_user_archive"
+
+// UserArchive 详见 ./sql/schema.sql table `urbs_user_archive`
+// 记录因长期不活跃而被清理的用户及其被指派的环境标签、配置项和所属群组
+type UserArchive struct {
+	ID            int64     `db:"id" goqu:"skipinsert"`
+	CreatedAt     time.Time `db:"created_at" goqu:"skipinsert"` // 归档时间
+	UserID        int64     `db:"user_id"`                      // 用户原内部 ID
+	UID           string    `db:"uid"`                          // varchar(63)，用户外部ID
+	UserCreatedAt time.Time `db:"user_created_at"`              // 用户原创建时间
+	ActiveAt      int64     `db:"active_at"`                    // 最近活跃时间戳，1970 以来的秒数
+	Data          string    `db:"data"`                         // mediumtext，UserArchiveData 的 JSON 数据
+}
+
+// TableName retuns table name
+func (UserArchive) TableName() string {
+	return "urbs_user_archive"
+}
+
+// UserArchiveData 归档的用户关系数据
+type UserArchiveData struct {
+	Labels   []UserLabel   `json:"labels"`
+	Settings []UserSetting `json:"settings"`
+	Groups   []UserGroup   `json:"groups"`
+}
@@ -0,0 +1,54 @@
+package schema
+
+// schema 模块不要引入官方库以外的其它模块或内部模块
+import (
+	"encoding/json"
+	"time"
+)
+
+// TableUserLabelCache is a table name in db.
+const TableUserLabelCache = "user_label_cache"
+
+// UserLabelCache 详见 ./sql/schema.sql table `user_label_cache`
+// 按产品缓存用户当前全部 label（包括通过 group 继承的），根据 active_at 和 cache_label_expire 刷新
+// labels 格式：[{"l":"label","cls":["client"],"chs":["channel"]}]
+type UserLabelCache struct {
+	ID        int64     `db:"id" goqu:"skipinsert"`
+	CreatedAt time.Time `db:"created_at" goqu:"skipinsert"`
+	UpdatedAt time.Time `db:"updated_at" goqu:"skipinsert"`
+	UserID    int64     `db:"user_id"`    // 用户内部 ID
+	ProductID int64     `db:"product_id"` // 产品内部 ID
+	ActiveAt  int64     `db:"active_at"`  // 缓存刷新时间戳，1970 以来的秒数
+	Labels    string    `db:"labels"`     // mediumtext，缓存用户在该产品下的 labels
+}
+
+// TableName retuns table name
+func (UserLabelCache) TableName() string {
+	return "user_label_cache"
+}
+
+// GetLabels 从缓存记录上读取结构化的 labels 数据
+func (c *UserLabelCache) GetLabels() []UserCacheLabel {
+	labels := make([]UserCacheLabel, 0)
+	if c.Labels != "" {
+		_ = json.Unmarshal([]byte(c.Labels), &labels)
+	}
+	return labels
+}
+
+// PutLabels 把结构化的 labels 数据转成字符串设置在 c.Labels 上
+func (c *UserLabelCache) PutLabels(labels []UserCacheLabel) error {
+	if labels == nil {
+		labels = make([]UserCacheLabel, 0)
+	}
+	data, err := json.Marshal(labels)
+	if err == nil {
+		c.Labels = string(data)
+	}
+	return err
+}
+
+// ToUserCache 转换为 UserCache 结构
+func (c *UserLabelCache) ToUserCache() *UserCache {
+	return &UserCache{ActiveAt: c.ActiveAt, Labels: c.GetLabels()}
+}
@@ -0,0 +1,141 @@
+package schema
+
+// schema 模块不要引入官方库以外的其它模块或内部模块
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// TableVersion is a table name in db.
+const TableVersion = "urbs_version"
+
+// 版本快照的对象类型
+const (
+	VersionLabel   = "label"
+	VersionSetting = "setting"
+)
+
+// Version 详见 ./sql/schema.sql table `urbs_version`
+// 环境标签或配置项定义（包括灰度发布规则）的版本快照
+type Version struct {
+	ID        int64     `db:"id" goqu:"skipinsert"`
+	CreatedAt time.Time `db:"created_at" goqu:"skipinsert"`
+	Kind      string    `db:"kind"`      // varchar(15)，对象类型，label 或 setting
+	ObjectID  int64     `db:"object_id"` // 环境标签或配置项的内部 ID
+	Version   int64     `db:"version"`   // 版本号，同一对象内从 1 开始递增
+	Actor     string    `db:"actor"`     // varchar(255)，产生该版本的操作者身份
+	Restored  int64     `db:"restored"`  // 该版本由哪个版本恢复而来，0 表示普通变更
+	Snapshot  string    `db:"snapshot"`  // mediumtext，定义快照，JSON string
+}
+
+// TableName retuns table name
+func (Version) TableName() string {
+	return "urbs_version"
+}
+
+// GetSnapshot 从版本记录上读取结构化的快照数据
+func (v *Version) GetSnapshot() DefinitionSnapshot {
+	s := DefinitionSnapshot{}
+	if v.Snapshot != "" {
+		_ = json.Unmarshal([]byte(v.Snapshot), &s)
+	}
+	return s.normalize()
+}
+
+// PutSnapshot 把结构化的快照数据转成字符串设置在 v.Snapshot 上
+func (v *Version) PutSnapshot(s DefinitionSnapshot) error {
+	data, err := json.Marshal(s.normalize())
+	if err == nil {
+		v.Snapshot = string(data)
+	}
+	return err
+}
+
+// DefinitionSnapshot 环境标签或配置项的定义快照，Values 仅配置项有
+type DefinitionSnapshot struct {
+	Desc     string         `json:"desc"`
+	Channels []string       `json:"channels"`
+	Clients  []string       `json:"clients"`
+	Values   []string       `json:"values,omitempty"`
+	Rules    []RuleSnapshot `json:"rules"`
+}
+
+// RuleSnapshot 灰度发布规则快照，同一对象下每种规则类型只有一条
+type RuleSnapshot struct {
+	Kind  string `json:"kind"`
+	Rule  string `json:"rule"`
+	Value string `json:"value,omitempty"` // 仅配置项的规则有
+}
+
+// SnapshotChange 两个版本快照之间的一处差异，新增时 From 为 null，删除时 To 为 null
+type SnapshotChange struct {
+	Field string      `json:"field"` // desc、channels、clients、values 或 rules.<kind>
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// Equal 判断两个快照是否相同
+func (s DefinitionSnapshot) Equal(other DefinitionSnapshot) bool {
+	return len(s.Diff(other)) == 0
+}
+
+// Diff 返回从 s 到 other 的差异
+func (s DefinitionSnapshot) Diff(other DefinitionSnapshot) []SnapshotChange {
+	s = s.normalize()
+	other = other.normalize()
+	changes := make([]SnapshotChange, 0)
+	if s.Desc != other.Desc {
+		changes = append(changes, SnapshotChange{Field: "desc", From: s.Desc, To: other.Desc})
+	}
+	if !reflect.DeepEqual(s.Channels, other.Channels) {
+		changes = append(changes, SnapshotChange{Field: "channels", From: s.Channels, To: other.Channels})
+	}
+	if !reflect.DeepEqual(s.Clients, other.Clients) {
+		changes = append(changes, SnapshotChange{Field: "clients", From: s.Clients, To: other.Clients})
+	}
+	if !reflect.DeepEqual(s.Values, other.Values) {
+		changes = append(changes, SnapshotChange{Field: "values", From: s.Values, To: other.Values})
+	}
+
+	from := make(map[string]RuleSnapshot, len(s.Rules))
+	for _, r := range s.Rules {
+		from[r.Kind] = r
+	}
+	to := make(map[string]RuleSnapshot, len(other.Rules))
+	for _, r := range other.Rules {
+		to[r.Kind] = r
+	}
+	for _, r := range s.Rules {
+		if t, ok := to[r.Kind]; !ok {
+			changes = append(changes, SnapshotChange{Field: "rules." + r.Kind, From: r, To: nil})
+		} else if t != r {
+			changes = append(changes, SnapshotChange{Field: "rules." + r.Kind, From: r, To: t})
+		}
+	}
+	for _, r := range other.Rules {
+		if _, ok := from[r.Kind]; !ok {
+			changes = append(changes, SnapshotChange{Field: "rules." + r.Kind, From: nil, To: r})
+		}
+	}
+	return changes
+}
+
+// normalize 统一空值和规则顺序，保证相同的定义得到相同的快照
+func (s DefinitionSnapshot) normalize() DefinitionSnapshot {
+	if s.Channels == nil {
+		s.Channels = []string{}
+	}
+	if s.Clients == nil {
+		s.Clients = []string{}
+	}
+	if len(s.Values) == 0 {
+		s.Values = nil
+	}
+	rules := make([]RuleSnapshot, len(s.Rules))
+	copy(rules, s.Rules)
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Kind < rules[j].Kind })
+	s.Rules = rules
+	return s
+}
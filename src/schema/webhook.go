@@ -0,0 +1,87 @@
+package schema
+
+// schema 模块不要引入官方库以外的其它模块或内部模块
+import (
+	"time"
+)
+
+// TableWebhook is a table name in db.
+const TableWebhook = "urbs_webhook"
+
+// TableWebhookDelivery is a table name in db.
+const TableWebhookDelivery = "urbs_webhook_delivery"
+
+// webhook 事件类型
+const (
+	EventLabelAssigned      = "label.assigned"
+	EventLabelRecalled      = "label.recalled"
+	EventLabelOffline       = "label.offline"
+	EventLabelCleanup       = "label.cleanup"
+	EventLabelRuleCreated   = "label.rule.created"
+	EventLabelRuleUpdated   = "label.rule.updated"
+	EventLabelRuleDeleted   = "label.rule.deleted"
+	EventSettingAssigned    = "setting.assigned"
+	EventSettingRecalled    = "setting.recalled"
+	EventSettingOffline     = "setting.offline"
+	EventSettingCleanup     = "setting.cleanup"
+	EventSettingRuleCreated = "setting.rule.created"
+	EventSettingRuleUpdated = "setting.rule.updated"
+	EventSettingRuleDeleted = "setting.rule.deleted"
+	EventModuleOffline      = "module.offline"
+	EventProductOffline     = "product.offline"
+)
+
+// webhook 投递状态
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// WebhookEvents 支持订阅的全部事件类型
+var WebhookEvents = []string{
+	EventLabelAssigned, EventLabelRecalled, EventLabelOffline, EventLabelCleanup,
+	EventLabelRuleCreated, EventLabelRuleUpdated, EventLabelRuleDeleted,
+	EventSettingAssigned, EventSettingRecalled, EventSettingOffline, EventSettingCleanup,
+	EventSettingRuleCreated, EventSettingRuleUpdated, EventSettingRuleDeleted,
+	EventModuleOffline, EventProductOffline,
+}
+
+// Webhook 详见 ./sql/schema.sql table `urbs_webhook`
+// 产品下配置变更事件的 webhook 订阅
+type Webhook struct {
+	ID        int64     `db:"id" goqu:"skipinsert"`
+	CreatedAt time.Time `db:"created_at" goqu:"skipinsert"`
+	UpdatedAt time.Time `db:"updated_at" goqu:"skipinsert"`
+	ProductID int64     `db:"product_id"`      // 所从属的产品线 ID
+	URL       string    `db:"url"`             // varchar(1022)，接收事件的 URL
+	Events    string    `db:"events"`          // varchar(1022)，订阅的事件类型，逗号分隔，为空表示订阅全部事件
+	Secret    string    `db:"secret" json:"-"` // varchar(255)，HMAC 签名密钥，不输出到审计日志等 JSON 数据中
+}
+
+// TableName retuns table name
+func (Webhook) TableName() string {
+	return "urbs_webhook"
+}
+
+// WebhookDelivery 详见 ./sql/schema.sql table `urbs_webhook_delivery`
+// webhook 事件的投递记录
+type WebhookDelivery struct {
+	ID          int64      `db:"id" goqu:"skipinsert"`
+	CreatedAt   time.Time  `db:"created_at" goqu:"skipinsert"`
+	UpdatedAt   time.Time  `db:"updated_at" goqu:"skipinsert"`
+	WebhookID   int64      `db:"webhook_id"`   // webhook 内部 ID
+	Event       string     `db:"event"`        // varchar(63)，事件类型
+	Payload     string     `db:"payload"`      // mediumtext，投递的 JSON 内容
+	Status      string     `db:"status"`       // varchar(15)，pending、succeeded 或 failed
+	Attempts    int        `db:"attempts"`     // 已投递次数
+	Code        int        `db:"code"`         // 最后一次投递的响应状态码，请求失败为 0
+	Message     string     `db:"message"`      // varchar(1022)，最后一次投递的错误信息
+	NextAt      time.Time  `db:"next_at"`      // 下次投递时间，用于重试和多实例抢占
+	DeliveredAt *time.Time `db:"delivered_at"` // 投递成功时间
+}
+
+// TableName retuns table name
+func (WebhookDelivery) TableName() string {
+	return "urbs_webhook_delivery"
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/teambition/urbs-setting/src/schema"
+)
+
+type auditCtxKey struct{}
+
+// auditRecord 请求处理期间记录的审计数据，业务层可能在多个 goroutine 中补充
+type auditRecord struct {
+	mu     sync.Mutex
+	log    *schema.AuditLog
+	redact []string
+}
+
+// WithAuditLog 返回携带审计日志的 context，业务层通过 SetAuditBefore 补充变更前的数据
+func WithAuditLog(ctx context.Context, log *schema.AuditLog) context.Context {
+	return context.WithValue(ctx, auditCtxKey{}, &auditRecord{log: log})
+}
+
+// HasAuditLog 判断 context 是否携带审计日志，避免无需审计时额外查询变更前的数据
+func HasAuditLog(ctx context.Context) bool {
+	_, ok := ctx.Value(auditCtxKey{}).(*auditRecord)
+	return ok
+}
+
+// SetAuditBefore 记录变更前的数据，context 未携带审计日志时忽略。
+// 同一请求多次调用时保留第一次的数据
+func SetAuditBefore(ctx context.Context, before interface{}) {
+	r, ok := ctx.Value(auditCtxKey{}).(*auditRecord)
+	if !ok || before == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.log.Before != "" {
+		return
+	}
+	if data, err := json.Marshal(before); err == nil {
+		r.log.Before = string(data)
+	}
+}
+
+// AuditLogFrom 返回 context 携带的审计日志，没有则返回 nil
+func AuditLogFrom(ctx context.Context) *schema.AuditLog {
+	r, ok := ctx.Value(auditCtxKey{}).(*auditRecord)
+	if !ok {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	log := *r.log
+	return &log
+}
+
+// SetAuditRedact 设置审计日志中需要移除的 JSON 字段，context 未携带审计日志时忽略。
+// 请求参数、变更前和变更后的数据中任意层级的同名字段都会被移除，用于密钥等敏感数据
+func SetAuditRedact(ctx context.Context, fields ...string) {
+	r, ok := ctx.Value(auditCtxKey{}).(*auditRecord)
+	if !ok {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.redact = append(r.redact, fields...)
+}
+
+// AuditRedactFields 返回 SetAuditRedact 设置的字段
+func AuditRedactFields(ctx context.Context) []string {
+	r, ok := ctx.Value(auditCtxKey{}).(*auditRecord)
+	if !ok {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string{}, r.redact...)
+}
+
+// RedactedAuditData 无法解析为 JSON 的数据无法移除指定字段，整体替换为该值
+const RedactedAuditData = "[REDACTED]"
+
+// RedactJSON 移除 JSON 数据中任意层级的 fields 字段，data 不是合法的 JSON 时返回 RedactedAuditData
+func RedactJSON(data string, fields []string) string {
+	if data == "" || len(fields) == 0 {
+		return data
+	}
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader([]byte(data)))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil || dec.More() {
+		return RedactedAuditData
+	}
+	redactValue(v, fields)
+	b, err := json.Marshal(v)
+	if err != nil {
+		return RedactedAuditData
+	}
+	return string(b)
+}
+
+func redactValue(v interface{}, fields []string) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for _, f := range fields {
+			delete(val, f)
+		}
+		for _, item := range val {
+			redactValue(item, fields)
+		}
+	case []interface{}:
+		for _, item := range val {
+			redactValue(item, fields)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/teambition/urbs-setting/src/schema"
+)
+
+func TestAuditLog(t *testing.T) {
+	t.Run("SetAuditBefore should work", func(t *testing.T) {
+		assert := assert.New(t)
+
+		ctx := context.Background()
+		SetAuditBefore(ctx, map[string]string{"name": "a"})
+		assert.Nil(AuditLogFrom(ctx))
+
+		ctx = WithAuditLog(ctx, &schema.AuditLog{Actor: "tester"})
+		SetAuditBefore(ctx, nil)
+		assert.Equal("", AuditLogFrom(ctx).Before)
+
+		SetAuditBefore(ctx, map[string]string{"name": "a"})
+		SetAuditBefore(ctx, map[string]string{"name": "b"})
+		log := AuditLogFrom(ctx)
+		assert.Equal("tester", log.Actor)
+		assert.Equal(`{"name":"a"}`, log.Before)
+	})
+
+	t.Run("SetAuditRedact and RedactJSON should work", func(t *testing.T) {
+		assert := assert.New(t)
+
+		ctx := context.Background()
+		SetAuditRedact(ctx, "secret")
+		assert.Nil(AuditRedactFields(ctx))
+
+		ctx = WithAuditLog(ctx, &schema.AuditLog{Actor: "tester"})
+		SetAuditRedact(ctx, "secret")
+		SetAuditRedact(ctx, "key")
+		fields := AuditRedactFields(ctx)
+		assert.Equal([]string{"secret", "key"}, fields)
+
+		assert.Equal("", RedactJSON("", fields))
+		assert.Equal(`{"a":1}`, RedactJSON(`{"a":1}`, nil))
+		assert.Equal(`{"id":12345678901234567890,"url":"http://a"}`,
+			RedactJSON(`{"url":"http://a","secret":"abc","id":12345678901234567890}`, fields))
+		assert.Equal(`[{"name":"a","sub":{"x":1}}]`, RedactJSON(`[{"name":"a","key":"k","sub":{"x":1,"secret":"s"}}]`, fields))
+		assert.Equal(RedactedAuditData, RedactJSON(`{"secret":"abc"`, fields))
+		assert.Equal(RedactedAuditData, RedactJSON(`{"secret":"abc"} {}`, fields))
+	})
+}
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/teambition/urbs-setting/src/conf"
+	"github.com/teambition/urbs-setting/src/logging"
+	"github.com/teambition/urbs-setting/src/util"
+)
+
+func init() {
+	util.DigProvide(NewCache)
+}
+
+// Cache 共享缓存后端接口，MySQL 仍为数据源，缓存不可用时调用方应回退到 MySQL
+type Cache interface {
+	// Enabled 是否启用了共享缓存
+	Enabled() bool
+	// Key 返回加上前缀的缓存键
+	Key(key string) string
+	// Get 读取缓存，不存在时返回 nil, nil
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Set 写入缓存
+	Set(ctx context.Context, key string, value []byte, expire time.Duration) error
+	// SetNX 在缓存不存在时写入，用于简单的分布式锁
+	SetNX(ctx context.Context, key string, value []byte, expire time.Duration) (bool, error)
+	// Del 删除缓存
+	Del(ctx context.Context, keys ...string) error
+	// DelIfValue 在缓存值等于 value 时删除，用于释放 SetNX 获取的锁，返回是否删除
+	DelIfValue(ctx context.Context, key string, value []byte) (bool, error)
+	// Ping 检查缓存服务是否可用
+	Ping(ctx context.Context) error
+}
+
+// NewCache 根据配置创建共享缓存，未配置时返回不缓存任何数据的空实现
+func NewCache() Cache {
+	cfg := conf.Config.Redis
+	if !cfg.Enabled() {
+		return &noopCache{}
+	}
+	return NewRedisCache(cfg)
+}
+
+// RedisCache 基于 Redis 协议的共享缓存实现
+type RedisCache struct {
+	cli     *redis.Client
+	prefix  string
+	timeout time.Duration
+}
+
+// NewRedisCache ...
+func NewRedisCache(cfg conf.Redis) *RedisCache {
+	if cfg.Addr == "" {
+		logging.Panicf("Invalid Redis config, addr is required")
+	}
+	cli := redis.NewClient(&redis.Options{
+		Addr:         cfg.Addr,
+		Password:     cfg.Password,
+		DB:           cfg.DB,
+		PoolSize:     cfg.PoolSize,
+		DialTimeout:  time.Second,
+		ReadTimeout:  cfg.TimeoutDuration(),
+		WriteTimeout: cfg.TimeoutDuration(),
+	})
+	return &RedisCache{cli: cli, prefix: cfg.KeyPrefix, timeout: cfg.TimeoutDuration()}
+}
+
+// Enabled ...
+func (c *RedisCache) Enabled() bool {
+	return true
+}
+
+// Key ...
+func (c *RedisCache) Key(key string) string {
+	return c.prefix + key
+}
+
+// Get ...
+func (c *RedisCache) Get(ctx context.Context, key string) ([]byte, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	data, err := c.cli.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	return data, err
+}
+
+// Set ...
+func (c *RedisCache) Set(ctx context.Context, key string, value []byte, expire time.Duration) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	return c.cli.Set(ctx, key, value, expire).Err()
+}
+
+// SetNX ...
+func (c *RedisCache) SetNX(ctx context.Context, key string, value []byte, expire time.Duration) (bool, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	return c.cli.SetNX(ctx, key, value, expire).Result()
+}
+
+// Del ...
+func (c *RedisCache) Del(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	return c.cli.Del(ctx, keys...).Err()
+}
+
+// delIfValueScript 原子地比较并删除，避免删除已过期后被其它调用方重新获取的锁
+var delIfValueScript = redis.NewScript(`if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) end return 0`)
+
+// DelIfValue ...
+func (c *RedisCache) DelIfValue(ctx context.Context, key string, value []byte) (bool, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	n, err := delIfValueScript.Run(ctx, c.cli, []string{key}, value).Int()
+	return n > 0, err
+}
+
+// Ping ...
+func (c *RedisCache) Ping(ctx context.Context) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	return c.cli.Ping(ctx).Err()
+}
+
+// Close ...
+func (c *RedisCache) Close() error {
+	return c.cli.Close()
+}
+
+func (c *RedisCache) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, c.timeout)
+}
+
+// noopCache 未启用共享缓存时的空实现，读取始终未命中
+type noopCache struct{}
+
+func (c *noopCache) Enabled() bool         { return false }
+func (c *noopCache) Key(key string) string { return key }
+func (c *noopCache) Get(ctx context.Context, key string) ([]byte, error) {
+	return nil, nil
+}
+func (c *noopCache) Set(ctx context.Context, key string, value []byte, expire time.Duration) error {
+	return nil
+}
+func (c *noopCache) SetNX(ctx context.Context, key string, value []byte, expire time.Duration) (bool, error) {
+	return true, nil
+}
+func (c *noopCache) Del(ctx context.Context, keys ...string) error { return nil }
+func (c *noopCache) DelIfValue(ctx context.Context, key string, value []byte) (bool, error) {
+	return true, nil
+}
+func (c *noopCache) Ping(ctx context.Context) error { return nil }
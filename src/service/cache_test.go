@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/teambition/urbs-setting/src/conf"
+)
+
+func TestCache(t *testing.T) {
+	t.Run("noopCache should work", func(t *testing.T) {
+		assert := assert.New(t)
+		ctx := context.Background()
+
+		c := NewCache()
+		assert.False(c.Enabled())
+		data, err := c.Get(ctx, "abc")
+		assert.Nil(err)
+		assert.Nil(data)
+		assert.Nil(c.Set(ctx, "abc", []byte("123"), time.Second))
+		data, err = c.Get(ctx, "abc")
+		assert.Nil(err)
+		assert.Nil(data)
+	})
+
+	t.Run("RedisCache should work", func(t *testing.T) {
+		assert := assert.New(t)
+		ctx := context.Background()
+
+		srv, err := miniredis.Run()
+		if !assert.Nil(err) {
+			return
+		}
+		defer srv.Close()
+
+		cfg := conf.Redis{Addr: srv.Addr()}
+		assert.Nil(cfg.Validate())
+		c := NewRedisCache(cfg)
+		defer c.Close()
+
+		assert.True(c.Enabled())
+		assert.Nil(c.Ping(ctx))
+		key := c.Key("abc")
+		assert.Equal("urbs:abc", key)
+
+		data, err := c.Get(ctx, key)
+		assert.Nil(err)
+		assert.Nil(data)
+
+		assert.Nil(c.Set(ctx, key, []byte("123"), time.Second))
+		data, err = c.Get(ctx, key)
+		assert.Nil(err)
+		assert.Equal("123", string(data))
+
+		ok, err := c.SetNX(ctx, key, []byte("456"), time.Second)
+		assert.Nil(err)
+		assert.False(ok)
+
+		srv.FastForward(2 * time.Second)
+		data, err = c.Get(ctx, key)
+		assert.Nil(err)
+		assert.Nil(data)
+
+		ok, err = c.SetNX(ctx, key, []byte("456"), time.Second)
+		assert.Nil(err)
+		assert.True(ok)
+		ok, err = c.DelIfValue(ctx, key, []byte("123"))
+		assert.Nil(err)
+		assert.False(ok)
+		assert.True(srv.Exists(key))
+		ok, err = c.DelIfValue(ctx, key, []byte("456"))
+		assert.Nil(err)
+		assert.True(ok)
+		assert.False(srv.Exists(key))
+
+		assert.Nil(c.Set(ctx, key, []byte("456"), time.Second))
+		assert.Nil(c.Del(ctx, key, c.Key("xyz")))
+		assert.False(srv.Exists(key))
+		assert.Nil(c.Del(ctx))
+
+		srv.Close()
+		_, err = c.Get(ctx, key)
+		assert.NotNil(err)
+	})
+}
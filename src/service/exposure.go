@@ -0,0 +1,334 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/teambition/urbs-setting/src/conf"
+	"github.com/teambition/urbs-setting/src/logging"
+	"github.com/teambition/urbs-setting/src/schema"
+	"github.com/teambition/urbs-setting/src/util"
+)
+
+func init() {
+	util.DigProvide(NewExposure)
+}
+
+// ExposureSink 曝光事件的输出接口
+type ExposureSink interface {
+	// Write 输出一批曝光事件
+	Write(ctx context.Context, events []schema.Exposure) error
+	// Close 关闭 sink，释放资源
+	Close() error
+}
+
+// Exposure 曝光事件发送器，事件经去重后进入缓冲队列，由后台任务批量输出到 sink。
+// Emit 不会阻塞调用方，队列满时丢弃事件。nil 或未配置 sink 时不做任何处理
+type Exposure struct {
+	sink          ExposureSink
+	seen          *util.TTLCache
+	ch            chan schema.Exposure
+	batchSize     int
+	flushInterval time.Duration
+	dropped       uint64
+}
+
+// NewExposure 根据配置创建曝光事件发送器
+func NewExposure() *Exposure {
+	cfg := conf.Config.Exposure
+	switch cfg.Sink {
+	case "stdout":
+		return NewExposureWith(cfg, NewWriterExposureSink(os.Stdout))
+	case "file":
+		sink, err := NewFileExposureSink(cfg.File, int64(cfg.MaxSize)<<20, cfg.MaxBackups)
+		if err != nil {
+			logging.Panicf("Invalid exposure file sink: %v", err)
+		}
+		return NewExposureWith(cfg, sink)
+	case "http":
+		return NewExposureWith(cfg, NewHTTPExposureSink(cfg.URL, cfg.TimeoutDuration()))
+	}
+	return &Exposure{}
+}
+
+// NewExposureWith 使用指定的 sink 创建曝光事件发送器，cfg 需已通过 Validate
+func NewExposureWith(cfg conf.Exposure, sink ExposureSink) *Exposure {
+	e := &Exposure{
+		sink:          sink,
+		ch:            make(chan schema.Exposure, cfg.BufferSize),
+		batchSize:     cfg.BatchSize,
+		flushInterval: cfg.FlushIntervalDuration(),
+	}
+	if du := cfg.WindowDuration(); du > 0 {
+		e.seen = util.NewTTLCache(du, cfg.MaxEntries)
+	}
+	return e
+}
+
+// Enabled 是否配置了 sink
+func (e *Exposure) Enabled() bool {
+	return e != nil && e.sink != nil
+}
+
+// Emit 发送曝光事件，去重窗口内已发送过相同值的事件被忽略
+func (e *Exposure) Emit(events ...schema.Exposure) {
+	if !e.Enabled() {
+		return
+	}
+	for _, ev := range events {
+		key := ev.DedupKey()
+		val := ev.DedupValue()
+		if e.seen != nil {
+			if v, ok := e.seen.Get(key); ok && v.(string) == val {
+				continue
+			}
+		}
+		select {
+		case e.ch <- ev:
+			if e.seen != nil {
+				e.seen.Set(key, val)
+			}
+		default:
+			// 队列满时丢弃，不阻塞请求，也不记录去重，下次请求仍会尝试发送
+			if n := atomic.AddUint64(&e.dropped, 1); n == 1 || n%10000 == 0 {
+				logging.Warningf("exposure buffer is full, %d events dropped", n)
+			}
+		}
+	}
+}
+
+// Dropped 返回因队列满而丢弃的事件数
+func (e *Exposure) Dropped() uint64 {
+	if e == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&e.dropped)
+}
+
+// Start 启动后台任务批量输出曝光事件，ctx 结束时输出队列中剩余的事件并关闭 sink
+func (e *Exposure) Start(ctx context.Context) {
+	if !e.Enabled() {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(e.flushInterval)
+		defer ticker.Stop()
+		batch := make([]schema.Exposure, 0, e.batchSize)
+		for {
+			select {
+			case <-ctx.Done():
+				for {
+					select {
+					case ev := <-e.ch:
+						batch = append(batch, ev)
+						if len(batch) >= e.batchSize {
+							batch = e.flush(batch)
+						}
+					default:
+						e.flush(batch)
+						if err := e.sink.Close(); err != nil {
+							logging.Warningf("exposure sink close error: %v", err)
+						}
+						return
+					}
+				}
+			case ev := <-e.ch:
+				batch = append(batch, ev)
+				if len(batch) >= e.batchSize {
+					batch = e.flush(batch)
+				}
+			case <-ticker.C:
+				batch = e.flush(batch)
+			}
+		}
+	}()
+}
+
+func (e *Exposure) flush(batch []schema.Exposure) []schema.Exposure {
+	if len(batch) == 0 {
+		return batch
+	}
+	// ctx 可能已结束，使用独立的 context 输出最后一批事件
+	if err := e.sink.Write(context.Background(), batch); err != nil {
+		logging.Warningf("exposure sink write %d events error: %v", len(batch), err)
+	}
+	return batch[:0]
+}
+
+func marshalExposures(events []schema.Exposure) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	for i := range events {
+		if err := enc.Encode(&events[i]); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// WriterExposureSink 以 NDJSON 格式将曝光事件写入 io.Writer，如 stdout
+type WriterExposureSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterExposureSink ...
+func NewWriterExposureSink(w io.Writer) *WriterExposureSink {
+	return &WriterExposureSink{w: w}
+}
+
+// Write ...
+func (s *WriterExposureSink) Write(ctx context.Context, events []schema.Exposure) error {
+	data, err := marshalExposures(events)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(data)
+	return err
+}
+
+// Close ...
+func (s *WriterExposureSink) Close() error {
+	return nil
+}
+
+// FileExposureSink 以 NDJSON 格式将曝光事件追加写入文件，文件超过 maxSize 字节时轮转。
+// 轮转后的文件依次命名为 path.1、path.2 ...，最多保留 maxBackups 个
+type FileExposureSink struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+// NewFileExposureSink ...
+func NewFileExposureSink(path string, maxSize int64, maxBackups int) (*FileExposureSink, error) {
+	s := &FileExposureSink{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileExposureSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.file = f
+	s.size = info.Size()
+	return nil
+}
+
+func (s *FileExposureSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	os.Remove(s.path + "." + strconv.Itoa(s.maxBackups))
+	for i := s.maxBackups - 1; i > 0; i-- {
+		os.Rename(s.path+"."+strconv.Itoa(i), s.path+"."+strconv.Itoa(i+1))
+	}
+	if err := os.Rename(s.path, s.path+".1"); err != nil {
+		return err
+	}
+	return s.open()
+}
+
+// Write ...
+func (s *FileExposureSink) Write(ctx context.Context, events []schema.Exposure) error {
+	data, err := marshalExposures(events)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return fmt.Errorf("exposure file %s is closed", s.path)
+	}
+	if s.size > 0 && s.size+int64(len(data)) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := s.file.Write(data)
+	s.size += int64(n)
+	return err
+}
+
+// Close ...
+func (s *FileExposureSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// HTTPExposureSink 以 NDJSON 格式将一批曝光事件 POST 到收集服务，响应状态码为 2xx 时成功，失败不重试
+type HTTPExposureSink struct {
+	url     string
+	timeout time.Duration
+	cli     *http.Client
+}
+
+// NewHTTPExposureSink ...
+func NewHTTPExposureSink(url string, timeout time.Duration) *HTTPExposureSink {
+	return &HTTPExposureSink{url: url, timeout: timeout, cli: &http.Client{}}
+}
+
+// Write ...
+func (s *HTTPExposureSink) Write(ctx context.Context, events []schema.Exposure) error {
+	data, err := marshalExposures(events)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	req.Header.Set("User-Agent", "urbs-setting-exposure")
+
+	res, err := s.cli.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 512))
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("exposure collector responded %d: %s", res.StatusCode, body)
+	}
+	return nil
+}
+
+// Close ...
+func (s *HTTPExposureSink) Close() error {
+	s.cli.CloseIdleConnections()
+	return nil
+}
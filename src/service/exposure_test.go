@@ -0,0 +1,184 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/teambition/urbs-setting/src/conf"
+	"github.com/teambition/urbs-setting/src/schema"
+)
+
+type memExposureSink struct {
+	mu     sync.Mutex
+	events []schema.Exposure
+	closed bool
+}
+
+func (s *memExposureSink) Write(ctx context.Context, events []schema.Exposure) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, events...)
+	return nil
+}
+
+func (s *memExposureSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func (s *memExposureSink) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.events)
+}
+
+func exposureConfig(t *testing.T, cfg conf.Exposure) conf.Exposure {
+	cfg.Sink = "stdout"
+	require.Nil(t, cfg.Validate())
+	return cfg
+}
+
+func TestExposure(t *testing.T) {
+	t.Run("nil Exposure should be a noop", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var e *Exposure
+		assert.False(e.Enabled())
+		e.Emit(schema.Exposure{UID: "u1"})
+		e.Start(context.Background())
+		assert.Equal(uint64(0), e.Dropped())
+	})
+
+	t.Run("should dedup per user per setting in window", func(t *testing.T) {
+		assert := assert.New(t)
+
+		sink := &memExposureSink{}
+		e := NewExposureWith(exposureConfig(t, conf.Exposure{FlushInterval: "10ms"}), sink)
+		ctx, cancel := context.WithCancel(context.Background())
+		e.Start(ctx)
+
+		ev := schema.Exposure{Kind: schema.ExposureSetting, UID: "u1", Product: "p", Module: "m", Setting: "s", Value: "a", Release: 1}
+		e.Emit(ev, ev)
+		ev2 := ev
+		ev2.UID = "u2"
+		e.Emit(ev2)
+		ev3 := ev
+		ev3.Value = "b"
+		e.Emit(ev3) // 值变化后再次输出
+		e.Emit(ev3)
+
+		assert.Eventually(func() bool { return sink.Len() == 3 }, time.Second, 10*time.Millisecond)
+		cancel()
+		assert.Eventually(func() bool {
+			sink.mu.Lock()
+			defer sink.mu.Unlock()
+			return sink.closed
+		}, time.Second, 10*time.Millisecond)
+		assert.Equal("u1", sink.events[0].UID)
+		assert.Equal("u2", sink.events[1].UID)
+		assert.Equal("b", sink.events[2].Value)
+	})
+
+	t.Run("should drop events when buffer is full", func(t *testing.T) {
+		assert := assert.New(t)
+
+		sink := &memExposureSink{}
+		e := NewExposureWith(exposureConfig(t, conf.Exposure{BufferSize: 2, Window: "0s"}), sink)
+		ev := schema.Exposure{Kind: schema.ExposureLabel, UID: "u1", Product: "p", Label: "beta"}
+		e.Emit(ev, ev, ev) // 未启动后台任务，第 3 个事件被丢弃
+		assert.Equal(uint64(1), e.Dropped())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		e.Start(ctx) // 退出前输出队列中剩余的事件
+		assert.Eventually(func() bool { return sink.Len() == 2 }, time.Second, 10*time.Millisecond)
+	})
+}
+
+func TestFileExposureSink(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "exposure")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "exposure.ndjson")
+	sink, err := NewFileExposureSink(path, 200, 2)
+	require.Nil(err)
+
+	ev := schema.Exposure{Kind: schema.ExposureSetting, UID: "u1", Product: "p", Module: "m", Setting: "s", Value: "a", Timestamp: 1}
+	for i := 0; i < 6; i++ {
+		require.Nil(sink.Write(context.Background(), []schema.Exposure{ev}))
+	}
+	require.Nil(sink.Close())
+	assert.NotNil(sink.Write(context.Background(), []schema.Exposure{ev}))
+
+	_, err = os.Stat(path + ".1")
+	assert.Nil(err)
+	_, err = os.Stat(path + ".2")
+	assert.Nil(err)
+	_, err = os.Stat(path + ".3")
+	assert.True(os.IsNotExist(err))
+
+	data, err := ioutil.ReadFile(path)
+	require.Nil(err)
+	assert.True(len(data) <= 200)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		got := schema.Exposure{}
+		require.Nil(json.Unmarshal(scanner.Bytes(), &got))
+		assert.Equal(ev, got)
+	}
+}
+
+func TestHTTPExposureSink(t *testing.T) {
+	var header http.Header
+	var body []byte
+	status := 204
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		body, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	t.Run("should post NDJSON batch", func(t *testing.T) {
+		assert := assert.New(t)
+
+		sink := NewHTTPExposureSink(srv.URL, time.Second)
+		events := []schema.Exposure{
+			{Kind: schema.ExposureLabel, UID: "u1", Product: "p", Label: "beta"},
+			{Kind: schema.ExposureSetting, UID: "u1", Product: "p", Module: "m", Setting: "s", Value: "a", Rule: "abc"},
+		}
+		assert.Nil(sink.Write(context.Background(), events))
+		assert.Equal("application/x-ndjson", header.Get("Content-Type"))
+		lines := bytes.Split(bytes.TrimSpace(body), []byte("\n"))
+		assert.Equal(2, len(lines))
+		got := schema.Exposure{}
+		assert.Nil(json.Unmarshal(lines[1], &got))
+		assert.Equal(events[1], got)
+	})
+
+	t.Run("should return error when collector fails", func(t *testing.T) {
+		assert := assert.New(t)
+
+		status = 500
+		sink := NewHTTPExposureSink(srv.URL, time.Second)
+		assert.NotNil(sink.Write(context.Background(), []schema.Exposure{{UID: "u1"}}))
+	})
+}
@@ -11,6 +11,12 @@ func init() {
 	hIDer["setting"] = util.NewHID([]byte("setting" + conf.Config.HIDKey))
 	hIDer["label_rule"] = util.NewHID([]byte("label_rule" + conf.Config.HIDKey))
 	hIDer["setting_rule"] = util.NewHID([]byte("setting_rule" + conf.Config.HIDKey))
+	hIDer["job"] = util.NewHID([]byte("job" + conf.Config.HIDKey))
+	hIDer["webhook"] = util.NewHID([]byte("webhook" + conf.Config.HIDKey))
+	hIDer["webhook_delivery"] = util.NewHID([]byte("webhook_delivery" + conf.Config.HIDKey))
+	hIDer["role_binding"] = util.NewHID([]byte("role_binding" + conf.Config.HIDKey))
+	hIDer["api_key"] = util.NewHID([]byte("api_key" + conf.Config.HIDKey))
+	hIDer["change_request"] = util.NewHID([]byte("change_request" + conf.Config.HIDKey))
 }
 
 // HIDer 全局 HID 转换器，目前仅支持 schema.Label,  schema.setting 的 ID 转换。
@@ -13,6 +13,7 @@ import (
 	_ "github.com/go-sql-driver/mysql" // go-sql-driver
 	"github.com/teambition/urbs-setting/src/conf"
 	"github.com/teambition/urbs-setting/src/logging"
+	"github.com/teambition/urbs-setting/src/tracing"
 	"github.com/teambition/urbs-setting/src/util"
 )
 
@@ -23,9 +24,12 @@ func init() {
 
 // SQL ...
 type SQL struct {
-	db   *sql.DB
-	DB   *goqu.Database
-	RdDB *goqu.Database
+	replicaLag int64 // time.Duration，原子操作，放在首位以保证 64 位对齐
+	db         *sql.DB
+	rdDB       *sql.DB
+	DB         *goqu.Database
+	RdDB       *goqu.Database
+	hasReplica bool
 }
 
 // DBStats ...
@@ -33,6 +37,21 @@ func (s *SQL) DBStats() sql.DBStats {
 	return s.db.Stats()
 }
 
+// RdDBStats 返回从库连接池的状态，未配置从库时与 DBStats 相同
+func (s *SQL) RdDBStats() sql.DBStats {
+	return s.rdDB.Stats()
+}
+
+// Ping 检查主库连接
+func (s *SQL) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// RdPing 检查从库连接，未配置从库时与 Ping 相同
+func (s *SQL) RdPing(ctx context.Context) error {
+	return s.rdDB.PingContext(ctx)
+}
+
 // NewDB ...
 func NewDB() *SQL {
 	db := connectDB(conf.Config.MySQL)
@@ -42,11 +61,27 @@ func NewDB() *SQL {
 	}
 
 	dialect := goqu.Dialect("mysql")
+	rdInstance := "primary"
+	if rdDB != db {
+		rdInstance = "read"
+	}
+	// 通过 goqu 执行的每条语句都会创建 span
 	return &SQL{
-		db:   db,
-		DB:   dialect.DB(db),
-		RdDB: dialect.DB(rdDB),
+		db:         db,
+		rdDB:       rdDB,
+		DB:         dialect.DB(tracing.NewDB(db, "primary")),
+		RdDB:       dialect.DB(tracing.NewDB(rdDB, rdInstance)),
+		hasReplica: rdDB != db,
+	}
+}
+
+// BeginTx 在主库上开始事务，事务中的语句同样会创建 span
+func (s *SQL) BeginTx(ctx context.Context, opts *sql.TxOptions) (*goqu.TxDatabase, error) {
+	tx, err := s.db.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
 	}
+	return goqu.NewTx("mysql", tracing.NewTx(tx, "primary")), nil
 }
 
 func connectDB(cfg conf.SQL) *sql.DB {
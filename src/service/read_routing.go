@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/teambition/urbs-setting/src/conf"
+	"github.com/teambition/urbs-setting/src/logging"
+	"github.com/teambition/urbs-setting/src/schema"
+)
+
+type dbCtxKey string
+
+const primaryCtxKey dbCtxKey = "PrimaryDB"
+
+// WithPrimary 返回强制从主库读取的 context
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryCtxKey, true)
+}
+
+// IsPrimary 判断 context 是否要求从主库读取
+func IsPrimary(ctx context.Context) bool {
+	return ctx.Value(primaryCtxKey) != nil
+}
+
+// Reader 返回用于读取的数据库。
+// 未配置从库、context 要求读主库（写后读一致）或从库延迟超过 max_replica_lag 时返回主库，否则返回从库
+func (s *SQL) Reader(ctx context.Context) *goqu.Database {
+	if !s.hasReplica || IsPrimary(ctx) || s.ReplicaLag() > conf.Config.ReadRouting.MaxReplicaLagDuration() {
+		return s.DB
+	}
+	return s.RdDB
+}
+
+// ReplicaLag 返回最近一次检测到的从库延迟，未配置从库时为 0，检测失败或从库没有心跳时为最大值
+func (s *SQL) ReplicaLag() time.Duration {
+	return time.Duration(atomic.LoadInt64(&s.replicaLag))
+}
+
+// HasReplica 是否配置了独立的从库
+func (s *SQL) HasReplica() bool {
+	return s.hasReplica
+}
+
+// StartHeartbeat 启动从库延迟检测，定期向主库写入心跳，并比较主从库读到的心跳值，ctx 结束时退出
+func (s *SQL) StartHeartbeat(ctx context.Context) {
+	if !s.hasReplica {
+		return
+	}
+
+	go func() {
+		interval := conf.Config.ReadRouting.HeartbeatIntervalDuration()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				hctx, cancel := context.WithTimeout(ctx, interval)
+				lag, err := s.heartbeat(hctx)
+				cancel()
+				if err != nil {
+					lag = math.MaxInt64
+					logging.Warningf("replica heartbeat: error %v", err)
+				}
+				atomic.StoreInt64(&s.replicaLag, int64(lag))
+			}
+		}
+	}()
+}
+
+var errReplicaHeartbeatMissing = errors.New("replica heartbeat not found")
+
+func (s *SQL) heartbeat(ctx context.Context) (time.Duration, error) {
+	ms := time.Now().UTC().UnixNano() / int64(time.Millisecond)
+	// 多实例时取最大值，避免各实例时钟误差导致心跳回退
+	_, err := s.DB.Insert(schema.TableHeartbeat).
+		Rows(schema.Heartbeat{Name: schema.HeartbeatReplica, BeatAt: ms}).
+		OnConflict(goqu.DoUpdate("name", goqu.C("beat_at").Set(goqu.L("GREATEST(`beat_at`, ?)", ms)))).
+		Executor().ExecContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var primary, replica int64
+	sd := s.DB.From(schema.TableHeartbeat).Select("beat_at").Where(goqu.C("name").Eq(schema.HeartbeatReplica))
+	if _, err = sd.Executor().ScanValContext(ctx, &primary); err != nil {
+		return 0, err
+	}
+	sd = s.RdDB.From(schema.TableHeartbeat).Select("beat_at").Where(goqu.C("name").Eq(schema.HeartbeatReplica))
+	found, err := sd.Executor().ScanValContext(ctx, &replica)
+	if err != nil {
+		return 0, err
+	}
+	// 心跳尚未同步到从库时无法判断延迟，按检测失败处理，读请求走主库
+	if !found || replica <= 0 {
+		return 0, errReplicaHeartbeatMissing
+	}
+
+	lag := time.Duration(primary-replica) * time.Millisecond
+	if lag < 0 {
+		lag = 0
+	}
+	return lag, nil
+}
+
+// recentWriters 记录最近进行了写操作的 subject 或 session，及其读主库的截止时间。
+// 记录只保存在当前实例内存中，多实例部署时只对路由到同一实例的读请求生效，
+// 跨实例的写后读一致由客户端回传写请求响应中的截止时间实现，详见 middleware.HeaderReadPrimaryUntil
+type recentWriters struct {
+	mu    sync.Mutex
+	m     map[string]time.Time
+	swept time.Time // 上次清理过期记录的时间
+}
+
+var writers = &recentWriters{m: make(map[string]time.Time)}
+
+// MarkWriter 记录 key（subject 或 session）刚进行了写操作，read_routing.window 时间内其读请求走主库，
+// 返回读主库的截止时间，未开启时返回零值。key 为空时只返回截止时间
+func MarkWriter(key string) time.Time {
+	window := conf.Config.ReadRouting.WindowDuration()
+	if window <= 0 {
+		return time.Time{}
+	}
+
+	now := time.Now()
+	if key == "" {
+		return now.Add(window)
+	}
+	writers.mu.Lock()
+	defer writers.mu.Unlock()
+	// 每个 read_routing.window 最多清理一次过期记录，记录数不超过两个时间窗口内的写入者
+	if now.Sub(writers.swept) >= window {
+		writers.swept = now
+		for k, until := range writers.m {
+			if until.Before(now) {
+				delete(writers.m, k)
+			}
+		}
+	}
+	writers.m[key] = now.Add(window)
+	return now.Add(window)
+}
+
+// IsWithinWindow 判断客户端回传的读主库截止时间是否仍有效，超出 read_routing.window 的截止时间视为无效
+func IsWithinWindow(until time.Time) bool {
+	window := conf.Config.ReadRouting.WindowDuration()
+	if window <= 0 {
+		return false
+	}
+	now := time.Now()
+	return until.After(now) && !until.After(now.Add(window))
+}
+
+// IsRecentWriter 判断 key（subject 或 session）是否在写操作后的时间窗口内
+func IsRecentWriter(key string) bool {
+	if key == "" {
+		return false
+	}
+
+	writers.mu.Lock()
+	defer writers.mu.Unlock()
+	until, ok := writers.m[key]
+	if !ok {
+		return false
+	}
+	if until.Before(time.Now()) {
+		delete(writers.m, key)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadRouting(t *testing.T) {
+	t.Run("Reader should work", func(t *testing.T) {
+		assert := assert.New(t)
+		ctx := context.Background()
+
+		s := &SQL{DB: goqu.New("mysql", nil), RdDB: goqu.New("mysql", nil)}
+		assert.True(s.Reader(ctx) == s.DB)
+
+		s.hasReplica = true
+		assert.True(s.Reader(ctx) == s.RdDB)
+		assert.True(s.Reader(WithPrimary(ctx)) == s.DB)
+
+		atomic.StoreInt64(&s.replicaLag, int64(time.Hour))
+		assert.True(s.Reader(ctx) == s.DB)
+		atomic.StoreInt64(&s.replicaLag, math.MaxInt64)
+		assert.True(s.Reader(ctx) == s.DB)
+		atomic.StoreInt64(&s.replicaLag, 0)
+		assert.True(s.Reader(ctx) == s.RdDB)
+	})
+
+	t.Run("heartbeat should treat missing replica heartbeat as failure", func(t *testing.T) {
+		assert := assert.New(t)
+		ctx := context.Background()
+
+		ms := time.Now().UTC().UnixNano() / int64(time.Millisecond)
+		primary := goqu.New("mysql", sql.OpenDB(heartbeatConnector{beatAt: []int64{ms}}))
+		s := &SQL{DB: primary, RdDB: goqu.New("mysql", sql.OpenDB(heartbeatConnector{})), hasReplica: true}
+		_, err := s.heartbeat(ctx)
+		assert.Equal(errReplicaHeartbeatMissing, err)
+
+		s.RdDB = goqu.New("mysql", sql.OpenDB(heartbeatConnector{beatAt: []int64{0}}))
+		_, err = s.heartbeat(ctx)
+		assert.Equal(errReplicaHeartbeatMissing, err)
+
+		s.RdDB = goqu.New("mysql", sql.OpenDB(heartbeatConnector{beatAt: []int64{ms - 2000}}))
+		lag, err := s.heartbeat(ctx)
+		assert.Nil(err)
+		assert.Equal(2*time.Second, lag)
+	})
+
+	t.Run("MarkWriter should work", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.False(IsRecentWriter(""))
+		assert.False(IsRecentWriter("subject:abc"))
+		MarkWriter("subject:abc")
+		assert.True(IsRecentWriter("subject:abc"))
+		assert.False(IsRecentWriter("subject:abcd"))
+
+		writers.mu.Lock()
+		writers.m["subject:abc"] = time.Now().Add(-time.Second)
+		writers.mu.Unlock()
+		assert.False(IsRecentWriter("subject:abc"))
+
+		writers.mu.Lock()
+		writers.m["subject:expired"] = time.Now().Add(-time.Second)
+		writers.swept = time.Time{}
+		writers.mu.Unlock()
+		MarkWriter("subject:abc")
+		writers.mu.Lock()
+		_, ok := writers.m["subject:expired"]
+		writers.mu.Unlock()
+		assert.False(ok)
+
+		until := MarkWriter("")
+		assert.True(IsWithinWindow(until))
+		assert.False(IsRecentWriter(""))
+		assert.False(IsWithinWindow(time.Now().Add(-time.Second)))
+		assert.False(IsWithinWindow(time.Now().Add(time.Hour)))
+	})
+}
+
+// heartbeatConnector 模拟 urbs_heartbeat 表，查询返回 beatAt 中的记录，写入直接成功
+type heartbeatConnector struct {
+	beatAt []int64
+}
+
+func (c heartbeatConnector) Connect(context.Context) (driver.Conn, error) { return c, nil }
+func (c heartbeatConnector) Driver() driver.Driver                        { return nil }
+func (c heartbeatConnector) Prepare(query string) (driver.Stmt, error)    { return c, nil }
+func (c heartbeatConnector) Close() error                                 { return nil }
+func (c heartbeatConnector) Begin() (driver.Tx, error)                    { return nil, driver.ErrSkip }
+func (c heartbeatConnector) NumInput() int                                { return -1 }
+func (c heartbeatConnector) Exec(args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+func (c heartbeatConnector) Query(args []driver.Value) (driver.Rows, error) {
+	return &heartbeatRows{beatAt: c.beatAt}, nil
+}
+
+type heartbeatRows struct {
+	beatAt []int64
+}
+
+func (r *heartbeatRows) Columns() []string { return []string{"beat_at"} }
+func (r *heartbeatRows) Close() error      { return nil }
+func (r *heartbeatRows) Next(dest []driver.Value) error {
+	if len(r.beatAt) == 0 {
+		return io.EOF
+	}
+	dest[0], r.beatAt = r.beatAt[0], r.beatAt[1:]
+	return nil
+}
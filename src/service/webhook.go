@@ -0,0 +1,129 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/teambition/urbs-setting/src/conf"
+)
+
+// webhook 投递请求的 Header
+const (
+	HeaderWebhookEvent     = "X-Urbs-Event"
+	HeaderWebhookDelivery  = "X-Urbs-Delivery"
+	HeaderWebhookSignature = "X-Urbs-Signature"
+)
+
+var webhookClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy: nil, // 直接连接，保证连接前检查的是订阅地址解析后的 IP
+		DialContext: (&net.Dialer{
+			Timeout:   5 * time.Second,
+			KeepAlive: 30 * time.Second,
+			Control:   checkWebhookDial,
+		}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	},
+	// 不跟随跳转，避免把签名后的请求转发到订阅以外的地址
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// privateNetworks 默认禁止 webhook 投递的地址段：回环、链路本地（包括云服务元数据地址）、内网、共享地址和组播等，
+// 以及内嵌 IPv4 地址的 NAT64（64:ff9b::/96、64:ff9b:1::/48）和 6to4（2002::/16）地址段，避免借此访问内网 IPv4 地址
+var privateNetworks = func() []*net.IPNet {
+	cidrs := []string{
+		"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16",
+		"172.16.0.0/12", "192.0.0.0/24", "192.168.0.0/16", "198.18.0.0/15", "224.0.0.0/4", "240.0.0.0/4",
+		"::/128", "::1/128", "64:ff9b::/96", "64:ff9b:1::/48", "2002::/16", "fc00::/7", "fe80::/10", "ff00::/8",
+	}
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}()
+
+// isPrivateIP 判断 ip 是否属于 privateNetworks
+func isPrivateIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	for _, n := range privateNetworks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkWebhookDial 在建立连接前检查 DNS 解析后的目标地址，未开启 webhook.allow_private_network 时拒绝内部地址，
+// 避免通过 webhook 访问内部服务并从投递记录中读取响应内容，同时防止 DNS 重绑定绕过检查
+func checkWebhookDial(network, address string, _ syscall.RawConn) error {
+	if conf.Config.Webhook.AllowPrivateNetwork {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || isPrivateIP(ip) {
+		return fmt.Errorf("webhook address %s is not allowed", host)
+	}
+	return nil
+}
+
+// SignWebhookPayload 使用 secret 对 payload 做 HMAC-SHA256 签名，返回 "sha256=<hex>"
+func SignWebhookPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// PostWebhook 投递一次 webhook 事件，响应状态码为 2xx 时成功。
+// 返回响应状态码，请求失败时为 0
+func PostWebhook(ctx context.Context, url, secret, event, delivery string, payload []byte, timeout time.Duration) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "urbs-setting-webhook")
+	req.Header.Set(HeaderWebhookEvent, event)
+	req.Header.Set(HeaderWebhookDelivery, delivery)
+	req.Header.Set(HeaderWebhookSignature, SignWebhookPayload(secret, payload))
+
+	res, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	// 读取少量响应内容用于记录错误，并保证连接可复用
+	body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 512))
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return res.StatusCode, fmt.Errorf("webhook responded %d: %s", res.StatusCode, body)
+	}
+	return res.StatusCode, nil
+}
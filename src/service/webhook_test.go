@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/teambition/urbs-setting/src/conf"
+)
+
+func TestPostWebhook(t *testing.T) {
+	var header http.Header
+	var body []byte
+	status := 204
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		body, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(status)
+		w.Write([]byte("oops"))
+	}))
+	defer srv.Close()
+
+	t.Run("should sign and post payload", func(t *testing.T) {
+		assert := assert.New(t)
+
+		payload := []byte(`{"event":"label.offline"}`)
+		code, err := PostWebhook(context.Background(), srv.URL, "secret", "label.offline", "abc", payload, time.Second)
+		assert.Nil(err)
+		assert.Equal(204, code)
+		assert.Equal(string(payload), string(body))
+		assert.Equal("application/json", header.Get("Content-Type"))
+		assert.Equal("label.offline", header.Get(HeaderWebhookEvent))
+		assert.Equal("abc", header.Get(HeaderWebhookDelivery))
+		assert.Equal(SignWebhookPayload("secret", payload), header.Get(HeaderWebhookSignature))
+		assert.NotEqual(SignWebhookPayload("secret2", payload), header.Get(HeaderWebhookSignature))
+	})
+
+	t.Run("should return error when responded non-2xx", func(t *testing.T) {
+		assert := assert.New(t)
+
+		status = 500
+		code, err := PostWebhook(context.Background(), srv.URL, "secret", "label.offline", "abc", []byte("{}"), time.Second)
+		assert.NotNil(err)
+		assert.Equal(500, code)
+		assert.Contains(err.Error(), "oops")
+
+		code, err = PostWebhook(context.Background(), "http://127.0.0.1:1", "secret", "label.offline", "abc", []byte("{}"), time.Second)
+		assert.NotNil(err)
+		assert.Equal(0, code)
+	})
+
+	t.Run("should reject private addresses", func(t *testing.T) {
+		assert := assert.New(t)
+
+		allow := conf.Config.Webhook.AllowPrivateNetwork
+		conf.Config.Webhook.AllowPrivateNetwork = false
+		defer func() { conf.Config.Webhook.AllowPrivateNetwork = allow }()
+		webhookClient.CloseIdleConnections() // 之前的测试建立的连接不再经过检查
+
+		status = 200
+		for _, url := range []string{srv.URL, "http://localhost:1", "http://169.254.169.254/latest/meta-data", "http://[::1]:1", "http://10.0.0.1:1"} {
+			code, err := PostWebhook(context.Background(), url, "secret", "label.offline", "abc", []byte("{}"), time.Second)
+			assert.Equal(0, code)
+			if assert.NotNil(err, url) {
+				assert.Contains(err.Error(), "is not allowed")
+			}
+		}
+
+		assert.True(isPrivateIP(net.ParseIP("192.168.1.1")))
+		assert.True(isPrivateIP(net.ParseIP("::ffff:127.0.0.1")))
+		assert.True(isPrivateIP(net.ParseIP("fd00::1")))
+		assert.True(isPrivateIP(net.ParseIP("64:ff9b::a9fe:a9fe")))
+		assert.True(isPrivateIP(net.ParseIP("64:ff9b:1::a00:1")))
+		assert.True(isPrivateIP(net.ParseIP("2002:a00:1::1")))
+		assert.False(isPrivateIP(net.ParseIP("64:ff9c::1")))
+		assert.False(isPrivateIP(net.ParseIP("8.8.8.8")))
+		assert.False(isPrivateIP(net.ParseIP("2001:4860:4860::8888")))
+	})
+}
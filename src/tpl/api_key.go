@@ -0,0 +1,172 @@
+package tpl
+
+import (
+	"strings"
+	"time"
+
+	"github.com/teambition/gear"
+	"github.com/teambition/urbs-setting/src/schema"
+	"github.com/teambition/urbs-setting/src/service"
+)
+
+// APIKeyPrefix API key 的前缀，完整的 key 为 "urbsk_" + key HID + "_" + 密文
+const APIKeyPrefix = "urbsk_"
+
+// APIKeyBody ...
+type APIKeyBody struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiredAt *time.Time `json:"expiredAt"` // 过期时间，为空则不过期
+}
+
+// Validate 实现 gear.BodyTemplate。
+func (t *APIKeyBody) Validate() error {
+	if err := validateAPIKeyName(t.Name); err != nil {
+		return err
+	}
+	if len(t.Scopes) == 0 {
+		return gear.ErrBadRequest.WithMsg("scopes required")
+	}
+	for _, scope := range t.Scopes {
+		if !ValidAPIKeyScope(scope) {
+			return gear.ErrBadRequest.WithMsgf("invalid scope: %s", scope)
+		}
+	}
+	if len(strings.Join(t.Scopes, ",")) > 1022 {
+		return gear.ErrBadRequest.WithMsg("too many scopes")
+	}
+	if t.ExpiredAt != nil && !t.ExpiredAt.After(time.Now()) {
+		return gear.ErrBadRequest.WithMsgf("expiredAt should be in the future")
+	}
+	return nil
+}
+
+// APIKeyUpdateBody ...
+type APIKeyUpdateBody struct {
+	Name      *string    `json:"name"`
+	ExpiredAt *time.Time `json:"expiredAt"` // 修改过期时间，设置为过去的时间可以让 key 立即过期
+}
+
+// Validate 实现 gear.BodyTemplate。
+func (t *APIKeyUpdateBody) Validate() error {
+	if t.Name == nil && t.ExpiredAt == nil {
+		return gear.ErrBadRequest.WithMsg("name or expiredAt required")
+	}
+	if t.Name != nil {
+		if err := validateAPIKeyName(*t.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ToMap ...
+func (t *APIKeyUpdateBody) ToMap() map[string]interface{} {
+	changed := make(map[string]interface{})
+	if t.Name != nil {
+		changed["name"] = *t.Name
+	}
+	if t.ExpiredAt != nil {
+		changed["expired_at"] = t.ExpiredAt.UTC()
+	}
+	return changed
+}
+
+func validateAPIKeyName(name string) error {
+	if name == "" || len(name) > 63 {
+		return gear.ErrBadRequest.WithMsgf("invalid api key name: %s", name)
+	}
+	return nil
+}
+
+// ValidAPIKeyScope 判断 scope 是否有效
+func ValidAPIKeyScope(scope string) bool {
+	switch scope {
+	case schema.ScopeAdmin, schema.ScopeReadAll, schema.ScopeReadEvaluate, schema.ScopeWriteAll, schema.ScopeWriteAssign:
+		return true
+	}
+	if strings.HasPrefix(scope, schema.ScopeAdminProduct) {
+		return validNameReg.MatchString(scope[len(schema.ScopeAdminProduct):])
+	}
+	return false
+}
+
+// APIKeyURL ...
+type APIKeyURL struct {
+	HID string `json:"hid" param:"hid"`
+}
+
+// Validate 实现 gear.BodyTemplate。
+func (t *APIKeyURL) Validate() error {
+	if !validHIDReg.MatchString(t.HID) {
+		return gear.ErrBadRequest.WithMsgf("invalid hid: %s", t.HID)
+	}
+	return nil
+}
+
+// ParseAPIKey 解析 API key，返回 key 的内部 ID 和密文，格式不合法时 ID 为 0
+func ParseAPIKey(key string) (int64, string) {
+	// HID 固定为 24 个字符
+	if len(key) <= len(APIKeyPrefix)+25 || !strings.HasPrefix(key, APIKeyPrefix) {
+		return 0, ""
+	}
+	key = key[len(APIKeyPrefix):]
+	if key[24] != '_' {
+		return 0, ""
+	}
+	return service.HIDToID(key[:24], "api_key"), key[25:]
+}
+
+// APIKeyInfo ...
+type APIKeyInfo struct {
+	ID         int64      `json:"-"`
+	HID        string     `json:"hid"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedBy  string     `json:"createdBy"`
+	Active     bool       `json:"active"` // 未撤销且未过期
+	ExpiredAt  *time.Time `json:"expiredAt"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+	Key        string     `json:"key,omitempty"` // 完整的 key，只在创建时返回一次
+}
+
+// APIKeyInfoFrom 转换 API key，不返回 key
+func APIKeyInfoFrom(key schema.APIKey) APIKeyInfo {
+	return APIKeyInfo{
+		ID:         key.ID,
+		HID:        service.IDToHID(key.ID, "api_key"),
+		Name:       key.Name,
+		Scopes:     StringToSlice(key.Scopes),
+		CreatedBy:  key.CreatedBy,
+		Active:     key.IsActive(time.Now()),
+		ExpiredAt:  key.ExpiredAt,
+		RevokedAt:  key.RevokedAt,
+		LastUsedAt: key.LastUsedAt,
+		CreatedAt:  key.CreatedAt,
+		UpdatedAt:  key.UpdatedAt,
+	}
+}
+
+// APIKeysInfoFrom ...
+func APIKeysInfoFrom(keys []schema.APIKey) []APIKeyInfo {
+	res := make([]APIKeyInfo, len(keys))
+	for i, k := range keys {
+		res[i] = APIKeyInfoFrom(k)
+	}
+	return res
+}
+
+// APIKeysInfoRes ...
+type APIKeysInfoRes struct {
+	SuccessResponseType
+	Result []APIKeyInfo `json:"result"` // 空数组也保留
+}
+
+// APIKeyInfoRes ...
+type APIKeyInfoRes struct {
+	SuccessResponseType
+	Result APIKeyInfo `json:"result"`
+}
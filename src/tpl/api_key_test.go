@@ -0,0 +1,42 @@
+package tpl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/teambition/urbs-setting/src/service"
+)
+
+func TestParseAPIKey(t *testing.T) {
+	t.Run(`ParseAPIKey should work`, func(t *testing.T) {
+		assert := assert.New(t)
+
+		hid := service.IDToHID(123, "api_key")
+		id, secret := ParseAPIKey(APIKeyPrefix + hid + "_abc_def")
+		assert.Equal(int64(123), id)
+		assert.Equal("abc_def", secret)
+
+		id, _ = ParseAPIKey(APIKeyPrefix + hid + "_")
+		assert.Equal(int64(0), id)
+		id, _ = ParseAPIKey(APIKeyPrefix + hid + "-abc")
+		assert.Equal(int64(0), id)
+		id, _ = ParseAPIKey("urbs_" + hid + "_abc")
+		assert.Equal(int64(0), id)
+		id, _ = ParseAPIKey(APIKeyPrefix + service.IDToHID(123, "webhook") + "_abc")
+		assert.Equal(int64(0), id)
+	})
+}
+
+func TestValidAPIKeyScope(t *testing.T) {
+	t.Run(`ValidAPIKeyScope should work`, func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.True(ValidAPIKeyScope("admin"))
+		assert.True(ValidAPIKeyScope("read:evaluate"))
+		assert.True(ValidAPIKeyScope("write:assign"))
+		assert.True(ValidAPIKeyScope("admin:product:urbs"))
+		assert.False(ValidAPIKeyScope("admin:product:"))
+		assert.False(ValidAPIKeyScope("admin:product:Urbs"))
+		assert.False(ValidAPIKeyScope("write"))
+	})
+}
@@ -0,0 +1,47 @@
+package tpl
+
+import (
+	"strings"
+
+	"github.com/teambition/gear"
+	"github.com/teambition/urbs-setting/src/schema"
+)
+
+// AuditLogsURL ...
+type AuditLogsURL struct {
+	Pagination
+	Product string `json:"product" query:"product"` // 产品名称
+	Target  string `json:"target" query:"target"`   // 操作对象（请求路径）前缀，如 /v1/products/urbs/labels
+	Actor   string `json:"actor" query:"actor"`     // 操作者身份
+	Start   int64  `json:"start" query:"start"`     // 起始时间，包含，1970 以来的秒数
+	End     int64  `json:"end" query:"end"`         // 结束时间，不包含，1970 以来的秒数
+}
+
+// Validate 实现 gear.BodyTemplate。
+func (t *AuditLogsURL) Validate() error {
+	if t.Product != "" && !validNameReg.MatchString(t.Product) {
+		return gear.ErrBadRequest.WithMsgf("invalid product name: %s", t.Product)
+	}
+	if t.Target != "" {
+		if !strings.HasPrefix(t.Target, "/") || len(t.Target) > 1022 {
+			return gear.ErrBadRequest.WithMsgf("invalid target: %s", t.Target)
+		}
+		t.Target = strings.ReplaceAll(t.Target, `\`, `\\`)
+		t.Target = strings.ReplaceAll(t.Target, "%", `\%`)
+		t.Target = strings.ReplaceAll(t.Target, "_", `\_`)
+		t.Target += "%"
+	}
+	if len(t.Actor) > 255 {
+		return gear.ErrBadRequest.WithMsgf("invalid actor: %s", t.Actor)
+	}
+	if t.Start < 0 || t.End < 0 || (t.End > 0 && t.End <= t.Start) {
+		return gear.ErrBadRequest.WithMsgf("invalid time range: [%d, %d)", t.Start, t.End)
+	}
+	return t.Pagination.Validate()
+}
+
+// AuditLogsRes ...
+type AuditLogsRes struct {
+	SuccessResponseType
+	Result []schema.AuditLog `json:"result"`
+}
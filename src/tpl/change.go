@@ -0,0 +1,91 @@
+package tpl
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/teambition/gear"
+	"github.com/teambition/urbs-setting/src/schema"
+	"github.com/teambition/urbs-setting/src/service"
+)
+
+// ChangesURL ...
+type ChangesURL struct {
+	Cursor   string `json:"cursor" query:"cursor"`     // 上次返回的 nextCursor，为空则从保留的最早事件开始
+	Product  string `json:"product" query:"product"`   // 产品名称，只返回该产品的事件
+	PageSize int    `json:"pageSize" query:"pageSize"` // 每次最多返回的事件数，默认 100，最大 1000
+	Wait     int    `json:"wait" query:"wait"`         // 没有新事件时最长等待的秒数，默认 0 即不等待，最大 60
+}
+
+// Validate 实现 gear.BodyTemplate。
+func (t *ChangesURL) Validate() error {
+	if t.Cursor != "" && ChangeCursorToSeq(t.Cursor) <= 0 {
+		return gear.ErrBadRequest.WithMsgf("invalid cursor: %s", t.Cursor)
+	}
+	if t.Product != "" && !validNameReg.MatchString(t.Product) {
+		return gear.ErrBadRequest.WithMsgf("invalid product name: %s", t.Product)
+	}
+	if t.PageSize > 1000 {
+		return gear.ErrBadRequest.WithMsgf("pageSize %v should not great than 1000", t.PageSize)
+	}
+	if t.PageSize <= 0 {
+		t.PageSize = 100
+	}
+	if t.Wait < 0 || t.Wait > 60 {
+		return gear.ErrBadRequest.WithMsgf("wait %v should be in [0, 60]", t.Wait)
+	}
+	return nil
+}
+
+// ChangeCursorToSeq 把变更流游标转换为变更流序号，无效游标返回 0
+func ChangeCursorToSeq(cursor string) int64 {
+	if !strings.HasPrefix(cursor, "c.") {
+		return 0
+	}
+	return service.HIDToID(cursor[2:])
+}
+
+// SeqToChangeCursor 把变更流序号转换为变更流游标
+func SeqToChangeCursor(seq int64) string {
+	if seq <= 0 {
+		return ""
+	}
+	return "c." + service.IDToHID(seq)
+}
+
+// ChangeInfo ...
+type ChangeInfo struct {
+	Cursor    string          `json:"cursor"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Product   string          `json:"product"`
+	Event     string          `json:"event"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// ChangeInfoFrom create a ChangeInfo from schema.Change
+func ChangeInfoFrom(change schema.Change) ChangeInfo {
+	return ChangeInfo{
+		Cursor:    SeqToChangeCursor(change.Seq),
+		CreatedAt: change.CreatedAt,
+		Product:   change.Product,
+		Event:     change.Event,
+		Data:      json.RawMessage(change.Data),
+	}
+}
+
+// ChangesInfoFrom create a slice of ChangeInfo from a slice of schema.Change
+func ChangesInfoFrom(changes []schema.Change) []ChangeInfo {
+	res := make([]ChangeInfo, len(changes))
+	for i, c := range changes {
+		res[i] = ChangeInfoFrom(c)
+	}
+	return res
+}
+
+// ChangesRes ...
+type ChangesRes struct {
+	SuccessResponseType
+	Result     []ChangeInfo `json:"result"`
+	NextCursor string       `json:"nextCursor"` // 下次请求使用的游标，没有新事件时与请求的游标相同
+}
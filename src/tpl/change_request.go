@@ -0,0 +1,145 @@
+package tpl
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/teambition/gear"
+	"github.com/teambition/urbs-setting/src/schema"
+	"github.com/teambition/urbs-setting/src/service"
+)
+
+// ChangeRequestPayload 变更申请保存的完整操作参数，批准后按此参数执行
+type ChangeRequestPayload struct {
+	Product string          `json:"product"`
+	Source  string          `json:"source,omitempty"` // 复制、推广操作的源产品，Product 为目标产品
+	Module  string          `json:"module,omitempty"`
+	Setting string          `json:"setting,omitempty"`
+	Label   string          `json:"label,omitempty"`
+	Rule    string          `json:"rule,omitempty"`    // 灰度发布规则 hid，更新、删除规则时有效
+	Version int64           `json:"version,omitempty"` // 恢复的版本号，恢复版本时有效
+	Kind    string          `json:"kind,omitempty"`    // 群组类型，移除或回滚群组时有效
+	UID     string          `json:"uid,omitempty"`     // 用户或群组 uid，移除或回滚用户、群组时有效
+	Body    json.RawMessage `json:"body,omitempty"`    // 请求参数，下线或清除操作没有请求参数
+}
+
+// ChangeRequestsURL ...
+type ChangeRequestsURL struct {
+	ProductPaginationURL
+	Status string `json:"status" query:"status"` // 可选，只返回该状态的申请
+}
+
+// Validate 实现 gear.BodyTemplate。
+func (t *ChangeRequestsURL) Validate() error {
+	switch t.Status {
+	case "", schema.ChangeRequestPending, schema.ChangeRequestApplied, schema.ChangeRequestFailed,
+		schema.ChangeRequestRejected, schema.ChangeRequestExpired:
+	default:
+		return gear.ErrBadRequest.WithMsgf("invalid status: %s", t.Status)
+	}
+	return t.ProductPaginationURL.Validate()
+}
+
+// ProductChangeRequestURL ...
+type ProductChangeRequestURL struct {
+	ProductURL
+	HID string `json:"hid" param:"hid"`
+}
+
+// Validate 实现 gear.BodyTemplate。
+func (t *ProductChangeRequestURL) Validate() error {
+	if !validHIDReg.MatchString(t.HID) {
+		return gear.ErrBadRequest.WithMsgf("invalid hid: %s", t.HID)
+	}
+	return t.ProductURL.Validate()
+}
+
+// ChangeRequestDecisionBody ...
+type ChangeRequestDecisionBody struct {
+	Reason string `json:"reason"` // 可选，审批意见
+}
+
+// Validate 实现 gear.BodyTemplate。
+func (t *ChangeRequestDecisionBody) Validate() error {
+	if len(t.Reason) > 1022 {
+		return gear.ErrBadRequest.WithMsgf("reason too long: %d", len(t.Reason))
+	}
+	return nil
+}
+
+// ChangeRequestInfo ...
+type ChangeRequestInfo struct {
+	ID        int64                `json:"-"`
+	HID       string               `json:"hid"`
+	Product   string               `json:"product"`
+	Action    string               `json:"action"`
+	Target    string               `json:"target"`
+	Payload   ChangeRequestPayload `json:"payload"`
+	Status    string               `json:"status"`
+	CreatedBy string               `json:"createdBy"`
+	DecidedBy string               `json:"decidedBy"`
+	DecidedAt *time.Time           `json:"decidedAt"`
+	Reason    string               `json:"reason"`
+	Result    string               `json:"result"` // 批准后的执行结果，执行失败时为错误信息
+	ExpiredAt time.Time            `json:"expiredAt"`
+	CreatedAt time.Time            `json:"createdAt"`
+	UpdatedAt time.Time            `json:"updatedAt"`
+}
+
+// ChangeRequestInfoFrom ...
+func ChangeRequestInfoFrom(cr schema.ChangeRequest, product string) ChangeRequestInfo {
+	payload := ChangeRequestPayload{}
+	json.Unmarshal([]byte(cr.Payload), &payload)
+	return ChangeRequestInfo{
+		ID:        cr.ID,
+		HID:       service.IDToHID(cr.ID, "change_request"),
+		Product:   product,
+		Action:    cr.Action,
+		Target:    cr.Target,
+		Payload:   payload,
+		Status:    cr.Status,
+		CreatedBy: cr.CreatedBy,
+		DecidedBy: cr.DecidedBy,
+		DecidedAt: cr.DecidedAt,
+		Reason:    cr.Reason,
+		Result:    cr.Result,
+		ExpiredAt: cr.ExpiredAt,
+		CreatedAt: cr.CreatedAt,
+		UpdatedAt: cr.UpdatedAt,
+	}
+}
+
+// ChangeRequestsInfoFrom ...
+func ChangeRequestsInfoFrom(crs []schema.ChangeRequest, product string) []ChangeRequestInfo {
+	res := make([]ChangeRequestInfo, len(crs))
+	for i, cr := range crs {
+		res[i] = ChangeRequestInfoFrom(cr, product)
+	}
+	return res
+}
+
+// ChangeRequestsInfoRes ...
+type ChangeRequestsInfoRes struct {
+	SuccessResponseType
+	Result []ChangeRequestInfo `json:"result"` // 空数组也保留
+}
+
+// ChangeRequestInfoRes ...
+type ChangeRequestInfoRes struct {
+	SuccessResponseType
+	Result ChangeRequestInfo `json:"result"`
+}
+
+// ChangeRequestDiff 变更申请的对比，before 为操作对象的当前数据，after 为申请的请求参数
+type ChangeRequestDiff struct {
+	Action string          `json:"action"`
+	Target string          `json:"target"`
+	Before interface{}     `json:"before"` // 创建规则时为空
+	After  json.RawMessage `json:"after"`  // 下线或清除操作为空
+}
+
+// ChangeRequestDiffRes ...
+type ChangeRequestDiffRes struct {
+	SuccessResponseType
+	Result ChangeRequestDiff `json:"result"`
+}
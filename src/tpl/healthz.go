@@ -0,0 +1,27 @@
+package tpl
+
+// 健康检查的状态
+const (
+	HealthOK   = "ok"
+	HealthWarn = "warn" // 降级但仍可以服务，如从库延迟过大时读请求走主库
+	HealthFail = "fail"
+)
+
+// HealthCheck 单项就绪检查的结果
+type HealthCheck struct {
+	Name    string  `json:"name"`
+	Status  string  `json:"status"`
+	Latency float64 `json:"latency"` // 检查耗时，毫秒
+	Message string  `json:"message,omitempty"`
+}
+
+// ReadyzRes GET /readyz 的返回结果，任一检查为 fail 时 status 为 fail
+type ReadyzRes struct {
+	Status string         `json:"status"`
+	Checks []*HealthCheck `json:"checks"`
+}
+
+// Ready 是否可以接收流量
+func (t *ReadyzRes) Ready() bool {
+	return t.Status != HealthFail
+}
@@ -0,0 +1,55 @@
+package tpl
+
+import (
+	"mime"
+
+	"github.com/teambition/gear"
+)
+
+// 流式导入的文件格式
+const (
+	ImportCSV    = "csv"
+	ImportNDJSON = "ndjson"
+)
+
+// ImportFormatOf 根据请求的 Content-Type 返回导入文件格式，
+// text/csv 为 CSV，application/x-ndjson、application/ndjson 或 application/jsonl 为 NDJSON
+func ImportFormatOf(contentType string) (string, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "text/csv":
+		return ImportCSV, nil
+	case "application/x-ndjson", "application/ndjson", "application/jsonl":
+		return ImportNDJSON, nil
+	}
+	return "", gear.ErrUnsupportedMediaType.WithMsgf("unsupported import format: %q, text/csv or application/x-ndjson required", contentType)
+}
+
+// ImportRow 导入文件中的一行，CSV 的标题行为字段名，NDJSON 每行为一个 JSON 对象
+type ImportRow struct {
+	UID  string `json:"uid"`
+	Kind string `json:"kind"` // 导入群组时有效
+	Desc string `json:"desc"` // 导入群组时有效
+}
+
+// ValidateUser 验证用户或群组成员的行
+func (t *ImportRow) ValidateUser() error {
+	if !validIDReg.MatchString(t.UID) {
+		return gear.ErrBadRequest.WithMsgf("invalid user: %q", t.UID)
+	}
+	return nil
+}
+
+// ValidateGroup 验证群组的行，与 GroupsBody 的验证一致
+func (t *ImportRow) ValidateGroup() error {
+	if !validIDReg.MatchString(t.UID) {
+		return gear.ErrBadRequest.WithMsgf("invalid group uid: %q", t.UID)
+	}
+	if !validLabelReg.MatchString(t.Kind) {
+		return gear.ErrBadRequest.WithMsgf("invalid group kind: %q", t.Kind)
+	}
+	if len(t.Desc) > 1022 {
+		return gear.ErrBadRequest.WithMsgf("desc too long: %d", len(t.Desc))
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package tpl
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImport(t *testing.T) {
+	t.Run(`ImportFormatOf should work`, func(t *testing.T) {
+		assert := assert.New(t)
+
+		format, err := ImportFormatOf("text/csv; charset=utf-8")
+		assert.Nil(err)
+		assert.Equal(ImportCSV, format)
+
+		for _, ct := range []string{"application/x-ndjson", "application/ndjson", "application/jsonl"} {
+			format, err = ImportFormatOf(ct)
+			assert.Nil(err)
+			assert.Equal(ImportNDJSON, format)
+		}
+
+		_, err = ImportFormatOf("application/json")
+		assert.NotNil(err)
+		assert.Contains(err.Error(), "unsupported import format")
+	})
+
+	t.Run(`ImportRow.ValidateUser should work`, func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.Nil((&ImportRow{UID: "50c32afae8cf1439d35a87e6"}).ValidateUser())
+		assert.NotNil((&ImportRow{}).ValidateUser())
+		assert.NotNil((&ImportRow{UID: "a b"}).ValidateUser())
+	})
+
+	t.Run(`ImportRow.ValidateGroup should work`, func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.Nil((&ImportRow{UID: "50c32afae8cf1439d35a87e6", Kind: "org", Desc: "test"}).ValidateGroup())
+		assert.NotNil((&ImportRow{UID: "50c32afae8cf1439d35a87e6"}).ValidateGroup())
+		assert.NotNil((&ImportRow{UID: "50c32afae8cf1439d35a87e6", Kind: "Org"}).ValidateGroup())
+		assert.NotNil((&ImportRow{UID: "50c32afae8cf1439d35a87e6", Kind: "org", Desc: strings.Repeat("a", 1023)}).ValidateGroup())
+	})
+}
@@ -0,0 +1,75 @@
+package tpl
+
+import (
+	"regexp"
+
+	"github.com/teambition/gear"
+	"github.com/teambition/urbs-setting/src/schema"
+)
+
+var validJobKindReg = regexp.MustCompile(`^[a-z][a-z_]{0,62}$`)
+
+// JobsURL ...
+type JobsURL struct {
+	Pagination
+	Kind string `json:"kind" query:"kind"`
+}
+
+// Validate 实现 gear.BodyTemplate。
+func (t *JobsURL) Validate() error {
+	if t.Kind != "" && !validJobKindReg.MatchString(t.Kind) {
+		return gear.ErrBadRequest.WithMsgf("invalid job kind: %s", t.Kind)
+	}
+	return t.Pagination.Validate()
+}
+
+// JobURL ...
+type JobURL struct {
+	HID string `json:"hid" param:"hid"`
+}
+
+// Validate 实现 gear.BodyTemplate。
+func (t *JobURL) Validate() error {
+	if !validHIDReg.MatchString(t.HID) {
+		return gear.ErrBadRequest.WithMsgf("invalid hid: %s", t.HID)
+	}
+	return nil
+}
+
+// JobErrorsURL ...
+type JobErrorsURL struct {
+	Pagination
+	HID string `json:"hid" param:"hid"`
+}
+
+// Validate 实现 gear.BodyTemplate。
+func (t *JobErrorsURL) Validate() error {
+	if !validHIDReg.MatchString(t.HID) {
+		return gear.ErrBadRequest.WithMsgf("invalid hid: %s", t.HID)
+	}
+	return t.Pagination.Validate()
+}
+
+// JobErrorsRes ...
+type JobErrorsRes struct {
+	SuccessResponseType
+	Result []schema.JobError `json:"result"`
+}
+
+// JobRes ...
+type JobRes struct {
+	SuccessResponseType
+	Result schema.Job `json:"result"`
+}
+
+// JobsRes ...
+type JobsRes struct {
+	SuccessResponseType
+	Result []schema.Job `json:"result"`
+}
+
+// BoolJobRes 在 BoolRes 的基础上返回因此创建的后台任务 HID，没有则为空
+type BoolJobRes struct {
+	BoolRes
+	Job string `json:"job,omitempty"`
+}
@@ -116,35 +116,39 @@ func (t *LabelUpdateBody) ToMap() map[string]interface{} {
 
 // LabelInfo ...
 type LabelInfo struct {
-	ID        int64      `json:"-"`
-	HID       string     `json:"hid"`
-	Product   string     `json:"product"`
-	Name      string     `json:"name"`
-	Desc      string     `json:"desc"`
-	Channels  []string   `json:"channels"`
-	Clients   []string   `json:"clients"`
-	Status    int64      `json:"status"`
-	Release   int64      `json:"release"`
-	CreatedAt time.Time  `json:"createdAt"`
-	UpdatedAt time.Time  `json:"updatedAt"`
-	OfflineAt *time.Time `json:"offlineAt"`
+	ID           int64      `json:"-"`
+	HID          string     `json:"hid"`
+	Product      string     `json:"product"`
+	Name         string     `json:"name"`
+	Desc         string     `json:"desc"`
+	Channels     []string   `json:"channels"`
+	Clients      []string   `json:"clients"`
+	Status       int64      `json:"status"` // 使用用户数，异步增减的近似值
+	Release      int64      `json:"release"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	UpdatedAt    time.Time  `json:"updatedAt"`
+	OfflineAt    *time.Time `json:"offlineAt"`
+	ExactStatus  int64      `json:"exactStatus"`  // 最近一次对账时的去重使用用户数
+	ReconciledAt *time.Time `json:"reconciledAt"` // 最近一次对账的时间，为空则尚未对账
 }
 
 // LabelInfoFrom create a LabelInfo from schema.Label
 func LabelInfoFrom(label schema.Label, product string) LabelInfo {
 	return LabelInfo{
-		ID:        label.ID,
-		HID:       service.IDToHID(label.ID, "label"),
-		Product:   product,
-		Name:      label.Name,
-		Desc:      label.Desc,
-		Channels:  StringToSlice(label.Channels),
-		Clients:   StringToSlice(label.Clients),
-		Status:    label.Status,
-		Release:   label.Release,
-		CreatedAt: label.CreatedAt,
-		UpdatedAt: label.UpdatedAt,
-		OfflineAt: label.OfflineAt,
+		ID:           label.ID,
+		HID:          service.IDToHID(label.ID, "label"),
+		Product:      product,
+		Name:         label.Name,
+		Desc:         label.Desc,
+		Channels:     StringToSlice(label.Channels),
+		Clients:      StringToSlice(label.Clients),
+		Status:       label.Status,
+		Release:      label.Release,
+		CreatedAt:    label.CreatedAt,
+		UpdatedAt:    label.UpdatedAt,
+		OfflineAt:    label.OfflineAt,
+		ExactStatus:  label.ExactStatus,
+		ReconciledAt: label.ReconciledAt,
 	}
 }
 
@@ -198,6 +202,7 @@ type LabelReleaseInfo struct {
 	Release int64    `json:"release"`
 	Users   []string `json:"users"`
 	Groups  []string `json:"groups"`
+	Job     string   `json:"job,omitempty"` // 群组成员 labels 缓存失效的后台任务 HID
 }
 
 // LabelReleaseInfoRes ...
@@ -7,16 +7,17 @@ import (
 
 // ProductUpdateBody ...
 type ProductUpdateBody struct {
-	Desc *string `json:"desc"`
+	Desc      *string `json:"desc"`
+	Protected *bool   `json:"protected"` // 受保护产品的关键写操作需要他人审批后才执行
 }
 
 // Validate 实现 gear.BodyTemplate。
 func (t *ProductUpdateBody) Validate() error {
-	if t.Desc == nil {
-		return gear.ErrBadRequest.WithMsgf("desc required")
+	if t.Desc == nil && t.Protected == nil {
+		return gear.ErrBadRequest.WithMsgf("desc or protected required")
 	}
 
-	if len(*t.Desc) > 1022 {
+	if t.Desc != nil && len(*t.Desc) > 1022 {
 		return gear.ErrBadRequest.WithMsgf("desc too long: %d", len(*t.Desc))
 	}
 	return nil
@@ -28,6 +29,9 @@ func (t *ProductUpdateBody) ToMap() map[string]interface{} {
 	if t.Desc != nil {
 		changed["description"] = *t.Desc
 	}
+	if t.Protected != nil {
+		changed["protected"] = *t.Protected
+	}
 	return changed
 }
 
@@ -216,11 +220,12 @@ type ProductRes struct {
 
 // ProductStatistics ...
 type ProductStatistics struct {
-	Labels   int64 `json:"labels" db:"labels"`
-	Modules  int64 `json:"modules" db:"modules"`
-	Settings int64 `json:"settings" db:"settings"`
-	Release  int64 `json:"release" db:"release"`
-	Status   int64 `json:"status" db:"status"`
+	Labels      int64 `json:"labels" db:"labels"`
+	Modules     int64 `json:"modules" db:"modules"`
+	Settings    int64 `json:"settings" db:"settings"`
+	Release     int64 `json:"release" db:"release"`
+	Status      int64 `json:"status" db:"status"`
+	ExactStatus int64 `json:"exactStatus" db:"exact_status"` // 环境标签和配置项最近一次对账时的去重作用人数之和
 }
 
 // ProductStatisticsRes ...
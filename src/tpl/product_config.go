@@ -0,0 +1,220 @@
+package tpl
+
+import (
+	"github.com/teambition/gear"
+	"github.com/teambition/urbs-setting/src/schema"
+	"gopkg.in/yaml.v2"
+)
+
+// ProductConfig 产品的声明式配置，包括功能模块、配置项、环境标签和灰度发布规则，
+// 可以导出为 YAML 保存在 git 中，再通过 plan/apply 同步到线上。
+// 不包括群组和用户的环境标签、配置项
+type ProductConfig struct {
+	Product string          `json:"product" yaml:"product"`
+	Modules []*ModuleConfig `json:"modules" yaml:"modules"`
+	Labels  []*LabelConfig  `json:"labels" yaml:"labels"`
+}
+
+// ModuleConfig 功能模块的声明式配置
+type ModuleConfig struct {
+	Name     string           `json:"name" yaml:"name"`
+	Desc     string           `json:"desc" yaml:"desc"`
+	Settings []*SettingConfig `json:"settings,omitempty" yaml:"settings,omitempty"`
+}
+
+// SettingConfig 配置项的声明式配置
+type SettingConfig struct {
+	Name     string        `json:"name" yaml:"name"`
+	Desc     string        `json:"desc" yaml:"desc"`
+	Channels []string      `json:"channels,omitempty" yaml:"channels,omitempty"`
+	Clients  []string      `json:"clients,omitempty" yaml:"clients,omitempty"`
+	Values   []string      `json:"values,omitempty" yaml:"values,omitempty"`
+	Rules    []*RuleConfig `json:"rules,omitempty" yaml:"rules,omitempty"`
+}
+
+// LabelConfig 环境标签的声明式配置
+type LabelConfig struct {
+	Name     string        `json:"name" yaml:"name"`
+	Desc     string        `json:"desc" yaml:"desc"`
+	Channels []string      `json:"channels,omitempty" yaml:"channels,omitempty"`
+	Clients  []string      `json:"clients,omitempty" yaml:"clients,omitempty"`
+	Rules    []*RuleConfig `json:"rules,omitempty" yaml:"rules,omitempty"`
+}
+
+// RuleConfig 灰度发布规则的声明式配置，同一个环境标签或配置项下每种规则只能有一个
+type RuleConfig struct {
+	Kind    string `json:"kind" yaml:"kind"`
+	Percent int    `json:"percent" yaml:"percent"`
+	Value   string `json:"value,omitempty" yaml:"value,omitempty"` // 配置项规则命中时设置的值，环境标签规则没有该字段
+}
+
+// ParseProductConfig 解析 YAML 或 JSON 格式的声明式配置并验证，不允许未知字段
+func ParseProductConfig(data []byte) (*ProductConfig, error) {
+	cfg := &ProductConfig{}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, gear.ErrBadRequest.WithMsgf("invalid product config: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate 实现 gear.BodyTemplate。
+func (t *ProductConfig) Validate() error {
+	if t.Product != "" && !validNameReg.MatchString(t.Product) {
+		return gear.ErrBadRequest.WithMsgf("invalid product name: %s", t.Product)
+	}
+
+	modules := make(map[string]bool, len(t.Modules))
+	for _, m := range t.Modules {
+		if m == nil {
+			return gear.ErrBadRequest.WithMsg("module config required")
+		}
+		if err := (&NameDescBody{Name: m.Name, Desc: m.Desc}).Validate(); err != nil {
+			return err
+		}
+		if modules[m.Name] {
+			return gear.ErrBadRequest.WithMsgf("duplicate module: %s", m.Name)
+		}
+		modules[m.Name] = true
+
+		settings := make(map[string]bool, len(m.Settings))
+		for _, s := range m.Settings {
+			if s == nil {
+				return gear.ErrBadRequest.WithMsgf("setting config required in module %s", m.Name)
+			}
+			if err := s.Body().Validate(); err != nil {
+				return err
+			}
+			if settings[s.Name] {
+				return gear.ErrBadRequest.WithMsgf("duplicate setting: %s/%s", m.Name, s.Name)
+			}
+			settings[s.Name] = true
+			if err := validateRuleConfigs(m.Name+"/"+s.Name, s.Rules, true, s.Values); err != nil {
+				return err
+			}
+		}
+	}
+
+	labels := make(map[string]bool, len(t.Labels))
+	for _, l := range t.Labels {
+		if l == nil {
+			return gear.ErrBadRequest.WithMsg("label config required")
+		}
+		if err := l.Body().Validate(); err != nil {
+			return err
+		}
+		if labels[l.Name] {
+			return gear.ErrBadRequest.WithMsgf("duplicate label: %s", l.Name)
+		}
+		labels[l.Name] = true
+		if err := validateRuleConfigs(l.Name, l.Rules, false, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateRuleConfigs 验证规则，isSetting 为 true 时是配置项的规则，规则的值必须是配置项的可选值
+func validateRuleConfigs(target string, rules []*RuleConfig, isSetting bool, values []string) error {
+	kinds := make(map[string]bool, len(rules))
+	for _, r := range rules {
+		if r == nil {
+			return gear.ErrBadRequest.WithMsgf("rule config required in %s", target)
+		}
+		if err := r.PercentRule().Validate(); err != nil {
+			return gear.ErrBadRequest.WithMsgf("invalid rule in %s: %v", target, err)
+		}
+		if kinds[r.Kind] {
+			return gear.ErrBadRequest.WithMsgf("duplicate rule %s in %s", r.Kind, target)
+		}
+		kinds[r.Kind] = true
+
+		if !isSetting {
+			if r.Value != "" {
+				return gear.ErrBadRequest.WithMsgf("label rule %s in %s should not have value", r.Kind, target)
+			}
+		} else if !StringSliceHas(values, r.Value) {
+			return gear.ErrBadRequest.WithMsgf("value %q of rule %s is not in setting %s", r.Value, r.Kind, target)
+		}
+	}
+	return nil
+}
+
+// Body 转换为创建配置项的请求参数
+func (t *SettingConfig) Body() *SettingBody {
+	return &SettingBody{Name: t.Name, Desc: t.Desc, Channels: &t.Channels, Clients: &t.Clients, Values: &t.Values}
+}
+
+// Body 转换为创建环境标签的请求参数
+func (t *LabelConfig) Body() *LabelBody {
+	return &LabelBody{Name: t.Name, Desc: t.Desc, Channels: &t.Channels, Clients: &t.Clients}
+}
+
+// PercentRule 转换为百分比规则
+func (t *RuleConfig) PercentRule() *schema.PercentRule {
+	r := &schema.PercentRule{Kind: t.Kind}
+	r.Rule.Value = t.Percent
+	return r
+}
+
+// ProductConfigOp 同步声明式配置的一个操作
+type ProductConfigOp struct {
+	Op     string      `json:"op"`               // create、update、offline、delete（规则）或 assign（群组）
+	Kind   string      `json:"kind"`             // product、module、setting、label、labelRule、settingRule、labelGroups 或 settingGroups
+	Target string      `json:"target"`           // 操作对象，如 web、web/theme、beta、beta/userPercent、web/theme/userPercent
+	Before interface{} `json:"before,omitempty"` // 操作对象的当前配置，创建时没有
+	After  interface{} `json:"after,omitempty"`  // 操作对象的目标配置，下线或删除时没有
+	Reason string      `json:"reason,omitempty"` // 复制、推广时冲突的原因
+}
+
+// ProductConfigPlan 声明式配置与线上配置的差异
+type ProductConfigPlan struct {
+	Product    string            `json:"product"`
+	Prune      bool              `json:"prune"` // 是否下线或删除配置文件中没有的对象
+	Operations []ProductConfigOp `json:"operations"`
+}
+
+// ProductConfigApplyBody 变更申请中保存的 apply 参数
+type ProductConfigApplyBody struct {
+	Prune  bool           `json:"prune"`
+	Config *ProductConfig `json:"config"`
+}
+
+// Validate 实现 gear.BodyTemplate。
+func (t *ProductConfigApplyBody) Validate() error {
+	if t.Config == nil {
+		return gear.ErrBadRequest.WithMsg("config required")
+	}
+	return t.Config.Validate()
+}
+
+// ProductConfigURL ...
+type ProductConfigURL struct {
+	ProductURL
+	Format string `json:"format" query:"format"` // 导出格式，json（默认）或 yaml
+	Prune  bool   `json:"prune" query:"prune"`   // plan、apply 时下线或删除配置文件中没有的对象
+}
+
+// Validate 实现 gear.BodyTemplate。
+func (t *ProductConfigURL) Validate() error {
+	switch t.Format {
+	case "", "json", "yaml":
+	default:
+		return gear.ErrBadRequest.WithMsgf("invalid format: %s", t.Format)
+	}
+	return t.ProductURL.Validate()
+}
+
+// ProductConfigRes ...
+type ProductConfigRes struct {
+	SuccessResponseType
+	Result ProductConfig `json:"result"`
+}
+
+// ProductConfigPlanRes ...
+type ProductConfigPlanRes struct {
+	SuccessResponseType
+	Result ProductConfigPlan `json:"result"`
+}
@@ -0,0 +1,72 @@
+package tpl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseProductConfig(t *testing.T) {
+	t.Run(`ParseProductConfig should work with YAML`, func(t *testing.T) {
+		assert := assert.New(t)
+
+		cfg, err := ParseProductConfig([]byte(`
+product: urbs
+modules:
+  - name: web
+    desc: web app
+    settings:
+      - name: theme
+        channels: [stable, beta]
+        values: [light, dark]
+        rules:
+          - kind: userPercent
+            percent: 10
+            value: dark
+labels:
+  - name: beta
+    clients: [web]
+    rules:
+      - kind: newUserPercent
+        percent: 5
+`))
+		assert.Nil(err)
+		assert.Equal("urbs", cfg.Product)
+		assert.Equal(1, len(cfg.Modules))
+		assert.Equal("web app", cfg.Modules[0].Desc)
+		setting := cfg.Modules[0].Settings[0]
+		assert.Equal([]string{"beta", "stable"}, setting.Channels)
+		assert.Equal([]string{"dark", "light"}, setting.Values)
+		assert.Equal(RuleConfig{Kind: "userPercent", Percent: 10, Value: "dark"}, *setting.Rules[0])
+		assert.Equal(RuleConfig{Kind: "newUserPercent", Percent: 5}, *cfg.Labels[0].Rules[0])
+	})
+
+	t.Run(`ParseProductConfig should work with JSON`, func(t *testing.T) {
+		assert := assert.New(t)
+
+		cfg, err := ParseProductConfig([]byte(`{"modules":[{"name":"web","desc":""}],"labels":[]}`))
+		assert.Nil(err)
+		assert.Equal("", cfg.Product)
+		assert.Equal("web", cfg.Modules[0].Name)
+	})
+
+	t.Run(`ParseProductConfig should return error`, func(t *testing.T) {
+		assert := assert.New(t)
+
+		for _, data := range []string{
+			"modules: [{name: web, unknown: 1}]",
+			"modules: [{name: Web}]",
+			"modules: [{name: web}, {name: web}]",
+			"modules: [{name: web, settings: [{name: theme, channels: [nightly]}]}]",
+			"modules: [{name: web, settings: [{name: theme, rules: [{kind: userPercent, percent: 10, value: dark}]}]}]",
+			"modules: [{name: web, settings: [{name: theme, values: [dark], rules: [{kind: userPercent, percent: 10}]}]}]",
+			"labels: [{name: beta.1}]",
+			"labels: [{name: beta, rules: [{kind: userPercent, percent: 101}]}]",
+			"labels: [{name: beta, rules: [{kind: userPercent, percent: 1}, {kind: userPercent, percent: 2}]}]",
+			"labels: [{name: beta, rules: [{kind: userPercent, percent: 1, value: x}]}]",
+		} {
+			_, err := ParseProductConfig([]byte(data))
+			assert.NotNil(err, data)
+		}
+	})
+}
@@ -0,0 +1,86 @@
+package tpl
+
+import (
+	"strings"
+
+	"github.com/teambition/gear"
+)
+
+// ProductCloneBody 把产品的全部功能模块、配置项、环境标签和灰度发布规则复制到目标产品，
+// 目标产品不存在时先创建
+type ProductCloneBody struct {
+	Target    string `json:"target"`
+	Desc      string `json:"desc"`      // 可选，创建目标产品时使用的描述
+	Groups    bool   `json:"groups"`    // 是否同时复制群组的环境标签、配置项
+	Overwrite bool   `json:"overwrite"` // 是否用源产品的配置覆盖冲突的对象，默认只报告冲突
+	DryRun    bool   `json:"dryRun"`    // 只返回将要执行的操作和冲突，不做修改
+}
+
+// Validate 实现 gear.BodyTemplate。
+func (t *ProductCloneBody) Validate() error {
+	if !validNameReg.MatchString(t.Target) {
+		return gear.ErrBadRequest.WithMsgf("invalid target product: %s", t.Target)
+	}
+	if len(t.Desc) > 1022 {
+		return gear.ErrBadRequest.WithMsgf("desc too long: %d (<= 1022)", len(t.Desc))
+	}
+	return nil
+}
+
+// ProductPromoteBody 把产品中选定的功能模块、配置项、环境标签推广到已存在的目标产品
+type ProductPromoteBody struct {
+	Target    string   `json:"target"`
+	Modules   []string `json:"modules"` // 功能模块 web 包括其全部配置项，web/theme 只包括该配置项
+	Labels    []string `json:"labels"`
+	Groups    bool     `json:"groups"`    // 是否同时复制群组的环境标签、配置项
+	Overwrite bool     `json:"overwrite"` // 是否用源产品的配置覆盖冲突的对象，默认只报告冲突
+	DryRun    bool     `json:"dryRun"`    // 只返回将要执行的操作和冲突，不做修改
+}
+
+// Validate 实现 gear.BodyTemplate。
+func (t *ProductPromoteBody) Validate() error {
+	if !validNameReg.MatchString(t.Target) {
+		return gear.ErrBadRequest.WithMsgf("invalid target product: %s", t.Target)
+	}
+	if len(t.Modules) == 0 && len(t.Labels) == 0 {
+		return gear.ErrBadRequest.WithMsg("modules or labels required")
+	}
+	if len(t.Modules)+len(t.Labels) > 1000 {
+		return gear.ErrBadRequest.WithMsgf("too many modules and labels: %d (<= 1000)", len(t.Modules)+len(t.Labels))
+	}
+	for _, m := range t.Modules {
+		module, setting := SplitModuleSetting(m)
+		if !validNameReg.MatchString(module) || (module != m && !validNameReg.MatchString(setting)) {
+			return gear.ErrBadRequest.WithMsgf("invalid module or setting: %s", m)
+		}
+	}
+	for _, l := range t.Labels {
+		if !validLabelReg.MatchString(l) {
+			return gear.ErrBadRequest.WithMsgf("invalid label: %s", l)
+		}
+	}
+	return nil
+}
+
+// SplitModuleSetting 拆分 web/theme 格式的功能模块和配置项，没有配置项时 setting 为空
+func SplitModuleSetting(s string) (module, setting string) {
+	if i := strings.IndexByte(s, '/'); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	return s, ""
+}
+
+// ProductPromoteResult 复制、推广的结果，预演时 Operations 为将要执行的操作
+type ProductPromoteResult struct {
+	Source     string            `json:"source"`
+	Target     string            `json:"target"`
+	DryRun     bool              `json:"dryRun"`
+	Operations []ProductConfigOp `json:"operations"`
+	Conflicts  []ProductConfigOp `json:"conflicts"` // 目标产品中与源产品不一致、没有覆盖的对象
+}
+
+// ProductPromoteRes ...
+type ProductPromoteRes struct {
+	SuccessResponseType
+	Result ProductPromoteResult `json:"result"`
+}
@@ -0,0 +1,38 @@
+package tpl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProductPromoteBody(t *testing.T) {
+	t.Run(`ProductPromoteBody.Validate should work`, func(t *testing.T) {
+		assert := assert.New(t)
+
+		body := &ProductPromoteBody{Target: "urbs", Modules: []string{"web", "web/theme"}, Labels: []string{"beta"}}
+		assert.Nil(body.Validate())
+
+		for _, body := range []*ProductPromoteBody{
+			{Target: "urbs"},
+			{Target: "Urbs", Labels: []string{"beta"}},
+			{Target: "urbs", Modules: []string{"web/"}},
+			{Target: "urbs", Modules: []string{"web/theme/dark"}},
+			{Target: "urbs", Labels: []string{"beta.1"}},
+		} {
+			assert.NotNil(body.Validate(), body)
+		}
+	})
+
+	t.Run(`SplitModuleSetting should work`, func(t *testing.T) {
+		assert := assert.New(t)
+
+		module, setting := SplitModuleSetting("web/theme")
+		assert.Equal("web", module)
+		assert.Equal("theme", setting)
+
+		module, setting = SplitModuleSetting("web")
+		assert.Equal("web", module)
+		assert.Equal("", setting)
+	})
+}
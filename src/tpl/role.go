@@ -0,0 +1,134 @@
+package tpl
+
+import (
+	"time"
+
+	"github.com/teambition/gear"
+	"github.com/teambition/urbs-setting/src/schema"
+	"github.com/teambition/urbs-setting/src/service"
+)
+
+// RoleBody ...
+type RoleBody struct {
+	Subject string `json:"subject"` // OTVID 或 JWT sub
+	Role    string `json:"role"`
+}
+
+// Validate 实现 gear.BodyTemplate。
+func (t *RoleBody) Validate() error {
+	if err := validateRoleSubject(t.Subject); err != nil {
+		return err
+	}
+	if schema.RoleLevel(t.Role) == 0 {
+		return gear.ErrBadRequest.WithMsgf("invalid role: %s", t.Role)
+	}
+	return nil
+}
+
+// RolesURL ...
+type RolesURL struct {
+	Pagination
+	Subject string `json:"subject" query:"subject"` // 可选，只返回该请求者的角色
+}
+
+// Validate 实现 gear.BodyTemplate。
+func (t *RolesURL) Validate() error {
+	if t.Subject != "" {
+		if err := validateRoleSubject(t.Subject); err != nil {
+			return err
+		}
+	}
+	return t.Pagination.Validate()
+}
+
+// RoleSubjectURL subject 可能包含 ":" 等字符，通过 query 传递
+type RoleSubjectURL struct {
+	Subject string `json:"subject" query:"subject"`
+}
+
+// Validate 实现 gear.BodyTemplate。
+func (t *RoleSubjectURL) Validate() error {
+	return validateRoleSubject(t.Subject)
+}
+
+// ProductRolesURL ...
+type ProductRolesURL struct {
+	ProductPaginationURL
+	Subject string `json:"subject" query:"subject"` // 可选，只返回该请求者的角色
+}
+
+// Validate 实现 gear.BodyTemplate。
+func (t *ProductRolesURL) Validate() error {
+	if t.Subject != "" {
+		if err := validateRoleSubject(t.Subject); err != nil {
+			return err
+		}
+	}
+	return t.ProductPaginationURL.Validate()
+}
+
+// ProductRoleSubjectURL ...
+type ProductRoleSubjectURL struct {
+	ProductURL
+	Subject string `json:"subject" query:"subject"`
+}
+
+// Validate 实现 gear.BodyTemplate。
+func (t *ProductRoleSubjectURL) Validate() error {
+	if err := validateRoleSubject(t.Subject); err != nil {
+		return err
+	}
+	return t.ProductURL.Validate()
+}
+
+func validateRoleSubject(subject string) error {
+	if subject == "" || len(subject) > 255 {
+		return gear.ErrBadRequest.WithMsgf("invalid subject: %s", subject)
+	}
+	return nil
+}
+
+// RoleBindingInfo ...
+type RoleBindingInfo struct {
+	ID        int64     `json:"-"`
+	HID       string    `json:"hid"`
+	Subject   string    `json:"subject"`
+	Product   string    `json:"product"` // 为空表示全局角色
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// RoleBindingInfoFrom ...
+func RoleBindingInfoFrom(binding schema.RoleBinding, product string) RoleBindingInfo {
+	return RoleBindingInfo{
+		ID:        binding.ID,
+		HID:       service.IDToHID(binding.ID, "role_binding"),
+		Subject:   binding.Subject,
+		Product:   product,
+		Role:      binding.Role,
+		CreatedAt: binding.CreatedAt,
+		UpdatedAt: binding.UpdatedAt,
+	}
+}
+
+// RoleBindingsInfoFrom ...
+func RoleBindingsInfoFrom(bindings []schema.RoleBinding, product string) []RoleBindingInfo {
+	res := make([]RoleBindingInfo, len(bindings))
+	for i, b := range bindings {
+		res[i] = RoleBindingInfoFrom(b, product)
+	}
+	return res
+}
+
+// RoleBindingsInfoRes ...
+type RoleBindingsInfoRes struct {
+	SuccessResponseType
+	Result []RoleBindingInfo `json:"result"` // 空数组也保留
+}
+
+// RoleBindingInfoRes ...
+type RoleBindingInfoRes struct {
+	SuccessResponseType
+	Result RoleBindingInfo `json:"result"`
+}
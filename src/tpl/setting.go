@@ -147,20 +147,22 @@ func (t *SettingUpdateBody) ToMap() map[string]interface{} {
 
 // SettingInfo ...
 type SettingInfo struct {
-	ID        int64      `json:"-"`
-	HID       string     `json:"hid"`
-	Product   string     `json:"product"`
-	Module    string     `json:"module"`
-	Name      string     `json:"name"`
-	Desc      string     `json:"desc"`
-	Channels  []string   `json:"channels"`
-	Clients   []string   `json:"clients"`
-	Values    []string   `json:"values"`
-	Status    int64      `json:"status"`
-	Release   int64      `json:"release"`
-	CreatedAt time.Time  `json:"createdAt"`
-	UpdatedAt time.Time  `json:"updatedAt"`
-	OfflineAt *time.Time `json:"offlineAt"`
+	ID           int64      `json:"-"`
+	HID          string     `json:"hid"`
+	Product      string     `json:"product"`
+	Module       string     `json:"module"`
+	Name         string     `json:"name"`
+	Desc         string     `json:"desc"`
+	Channels     []string   `json:"channels"`
+	Clients      []string   `json:"clients"`
+	Values       []string   `json:"values"`
+	Status       int64      `json:"status"` // 使用用户数，异步增减的近似值
+	Release      int64      `json:"release"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	UpdatedAt    time.Time  `json:"updatedAt"`
+	OfflineAt    *time.Time `json:"offlineAt"`
+	ExactStatus  int64      `json:"exactStatus"`  // 最近一次对账时的去重使用用户数
+	ReconciledAt *time.Time `json:"reconciledAt"` // 最近一次对账的时间，为空则尚未对账
 }
 
 // SettingInfoFrom create a SettingInfo from schema.Setting
@@ -170,20 +172,22 @@ func SettingInfoFrom(setting schema.Setting, product, module string) SettingInfo
 	}
 
 	return SettingInfo{
-		ID:        setting.ID,
-		HID:       service.IDToHID(setting.ID, "setting"),
-		Product:   product,
-		Module:    setting.Module,
-		Name:      setting.Name,
-		Desc:      setting.Desc,
-		Channels:  StringToSlice(setting.Channels),
-		Clients:   StringToSlice(setting.Clients),
-		Values:    StringToSlice(setting.Values),
-		Status:    setting.Status,
-		Release:   setting.Release,
-		CreatedAt: setting.CreatedAt,
-		UpdatedAt: setting.UpdatedAt,
-		OfflineAt: setting.OfflineAt,
+		ID:           setting.ID,
+		HID:          service.IDToHID(setting.ID, "setting"),
+		Product:      product,
+		Module:       setting.Module,
+		Name:         setting.Name,
+		Desc:         setting.Desc,
+		Channels:     StringToSlice(setting.Channels),
+		Clients:      StringToSlice(setting.Clients),
+		Values:       StringToSlice(setting.Values),
+		Status:       setting.Status,
+		Release:      setting.Release,
+		CreatedAt:    setting.CreatedAt,
+		UpdatedAt:    setting.UpdatedAt,
+		OfflineAt:    setting.OfflineAt,
+		ExactStatus:  setting.ExactStatus,
+		ReconciledAt: setting.ReconciledAt,
 	}
 }
 
@@ -222,6 +226,7 @@ type MySetting struct {
 	AssignedAt time.Time `json:"assignedAt" db:"assigned_at"`
 	Channels   string    `json:"-" db:"channels"`
 	Clients    string    `json:"-" db:"clients"`
+	RuleID     int64     `json:"-" db:"rule_id"` // 值来自百分比规则时的规则 ID，仅匿名用户返回
 }
 
 // MySettingsRes ...
@@ -0,0 +1,160 @@
+package tpl
+
+import (
+	"time"
+
+	"github.com/teambition/gear"
+	"github.com/teambition/urbs-setting/src/schema"
+)
+
+// 时间序列统计的粒度
+const (
+	GranularityDay   = "day"
+	GranularityWeek  = "week"
+	GranularityMonth = "month"
+)
+
+// maxTimeseriesDays 单次查询的最大天数
+const maxTimeseriesDays = 1096
+
+const dayLayout = "2006-01-02"
+
+// TimeseriesURL ...
+type TimeseriesURL struct {
+	Product     string    `json:"product" param:"product"`
+	Metric      string    `json:"metric" query:"metric"`           // 统计指标：assignments、rule_hits、recalls 或 active_users
+	From        string    `json:"from" query:"from"`               // 起始日期（UTC），包含，如 2021-01-01，默认为 to 之前 29 天
+	To          string    `json:"to" query:"to"`                   // 结束日期（UTC），包含，默认为当天
+	Granularity string    `json:"granularity" query:"granularity"` // 粒度：day、week 或 month，默认 day
+	Label       string    `json:"label" query:"label"`             // 只统计该环境标签
+	Module      string    `json:"module" query:"module"`           // 与 setting 一起指定时只统计该配置项
+	Setting     string    `json:"setting" query:"setting"`
+	FromDay     time.Time `json:"-"`
+	ToDay       time.Time `json:"-"`
+}
+
+// Validate 实现 gear.BodyTemplate。
+func (t *TimeseriesURL) Validate() error {
+	if !validNameReg.MatchString(t.Product) {
+		return gear.ErrBadRequest.WithMsgf("invalid product name: %s", t.Product)
+	}
+	switch t.Metric {
+	case schema.MetricAssignments, schema.MetricRuleHits, schema.MetricRecalls, schema.MetricActiveUsers:
+	default:
+		return gear.ErrBadRequest.WithMsgf("invalid metric: %q, should be assignments, rule_hits, recalls or active_users", t.Metric)
+	}
+	switch t.Granularity {
+	case "":
+		t.Granularity = GranularityDay
+	case GranularityDay, GranularityWeek, GranularityMonth:
+	default:
+		return gear.ErrBadRequest.WithMsgf("invalid granularity: %q, should be day, week or month", t.Granularity)
+	}
+
+	if t.Label != "" {
+		if t.Module != "" || t.Setting != "" {
+			return gear.ErrBadRequest.WithMsg("label can not be used with module and setting")
+		}
+		if !validLabelReg.MatchString(t.Label) {
+			return gear.ErrBadRequest.WithMsgf("invalid label: %s", t.Label)
+		}
+	}
+	if t.Module != "" || t.Setting != "" {
+		if !validNameReg.MatchString(t.Module) {
+			return gear.ErrBadRequest.WithMsgf("invalid module name: %s", t.Module)
+		}
+		if !validNameReg.MatchString(t.Setting) {
+			return gear.ErrBadRequest.WithMsgf("invalid setting name: %s", t.Setting)
+		}
+	}
+	if t.Metric == schema.MetricActiveUsers && t.Kind() != schema.StatisticKindProduct {
+		return gear.ErrBadRequest.WithMsg("active_users can not be filtered by label or setting")
+	}
+
+	var err error
+	t.ToDay = time.Now().UTC().Truncate(24 * time.Hour)
+	if t.To != "" {
+		if t.ToDay, err = time.Parse(dayLayout, t.To); err != nil {
+			return gear.ErrBadRequest.WithMsgf("invalid to: %q, should be YYYY-MM-DD", t.To)
+		}
+	}
+	t.FromDay = t.ToDay.AddDate(0, 0, -29)
+	if t.From != "" {
+		if t.FromDay, err = time.Parse(dayLayout, t.From); err != nil {
+			return gear.ErrBadRequest.WithMsgf("invalid from: %q, should be YYYY-MM-DD", t.From)
+		}
+	}
+	if t.FromDay.After(t.ToDay) {
+		return gear.ErrBadRequest.WithMsgf("invalid date range: [%s, %s]", t.FromDay.Format(dayLayout), t.ToDay.Format(dayLayout))
+	}
+	if days := int(t.ToDay.Sub(t.FromDay)/(24*time.Hour)) + 1; days > maxTimeseriesDays {
+		return gear.ErrBadRequest.WithMsgf("date range too long: %d days, should not exceed %d", days, maxTimeseriesDays)
+	}
+	return nil
+}
+
+// Kind 返回统计对象的类型，未指定环境标签或配置项时为 product
+func (t *TimeseriesURL) Kind() string {
+	switch {
+	case t.Label != "":
+		return schema.StatisticKindLabel
+	case t.Setting != "":
+		return schema.StatisticKindSetting
+	}
+	return schema.StatisticKindProduct
+}
+
+// Points 将每天的统计值（日期到值的映射）按粒度合并为时间序列，没有数据的区间值为 0。
+// assignments、rule_hits 和 recalls 为区间内的总和，active_users 为区间内（限于查询范围）每天的平均值
+func (t *TimeseriesURL) Points(daily map[string]int64) []TimeseriesPoint {
+	points := make([]TimeseriesPoint, 0)
+	days := int64(0)
+	for day := t.FromDay; !day.After(t.ToDay); day = day.AddDate(0, 0, 1) {
+		start := bucketStart(day, t.Granularity).Format(dayLayout)
+		if len(points) == 0 || points[len(points)-1].Date != start {
+			if len(points) > 0 && t.Metric == schema.MetricActiveUsers {
+				points[len(points)-1].Value /= days
+			}
+			points = append(points, TimeseriesPoint{Date: start})
+			days = 0
+		}
+		points[len(points)-1].Value += daily[day.Format(dayLayout)]
+		days++
+	}
+	if len(points) > 0 && t.Metric == schema.MetricActiveUsers {
+		points[len(points)-1].Value /= days
+	}
+	return points
+}
+
+// bucketStart 返回 day 所在区间的起始日期，week 为周一，month 为当月 1 日
+func bucketStart(day time.Time, granularity string) time.Time {
+	switch granularity {
+	case GranularityWeek:
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case GranularityMonth:
+		return time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return day
+}
+
+// TimeseriesPoint 时间序列中的一个区间
+type TimeseriesPoint struct {
+	Date  string `json:"date"` // 区间的起始日期，week 为周一，month 为当月 1 日，可能早于查询的起始日期
+	Value int64  `json:"value"`
+}
+
+// Timeseries ...
+type Timeseries struct {
+	Metric      string            `json:"metric"`
+	Granularity string            `json:"granularity"`
+	From        string            `json:"from"`
+	To          string            `json:"to"`
+	Points      []TimeseriesPoint `json:"points"`
+}
+
+// TimeseriesRes ...
+type TimeseriesRes struct {
+	SuccessResponseType
+	Result Timeseries `json:"result"`
+}
@@ -0,0 +1,70 @@
+package tpl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeseriesURL(t *testing.T) {
+	t.Run(`Validate should work`, func(t *testing.T) {
+		assert := assert.New(t)
+
+		req := TimeseriesURL{Product: "urbs", Metric: "assignments"}
+		assert.Nil(req.Validate())
+		assert.Equal(GranularityDay, req.Granularity)
+		assert.Equal("product", req.Kind())
+		assert.Equal(29, int(req.ToDay.Sub(req.FromDay).Hours()/24))
+
+		req = TimeseriesURL{Product: "urbs", Metric: "rule_hits", From: "2021-01-01", To: "2021-01-31", Granularity: "week", Label: "beta"}
+		assert.Nil(req.Validate())
+		assert.Equal("label", req.Kind())
+		assert.Equal("2021-01-01", req.FromDay.Format("2006-01-02"))
+
+		req = TimeseriesURL{Product: "urbs", Metric: "recalls", Module: "task", Setting: "share"}
+		assert.Nil(req.Validate())
+		assert.Equal("setting", req.Kind())
+
+		for _, req := range []TimeseriesURL{
+			{Product: "urbs"},
+			{Product: "urbs", Metric: "clicks"},
+			{Product: "urbs", Metric: "assignments", Granularity: "hour"},
+			{Product: "urbs", Metric: "assignments", Label: "beta", Module: "task", Setting: "share"},
+			{Product: "urbs", Metric: "assignments", Module: "task"},
+			{Product: "urbs", Metric: "active_users", Label: "beta"},
+			{Product: "urbs", Metric: "assignments", From: "2021/01/01"},
+			{Product: "urbs", Metric: "assignments", From: "2021-02-01", To: "2021-01-01"},
+			{Product: "urbs", Metric: "assignments", From: "2018-01-01", To: "2021-01-01"},
+		} {
+			assert.NotNil(req.Validate(), req)
+		}
+	})
+
+	t.Run(`Points should work`, func(t *testing.T) {
+		assert := assert.New(t)
+
+		daily := map[string]int64{"2021-01-03": 3, "2021-01-04": 4, "2021-01-10": 10, "2021-01-11": 11}
+		req := TimeseriesURL{Product: "urbs", Metric: "assignments", From: "2021-01-03", To: "2021-01-05"}
+		assert.Nil(req.Validate())
+		assert.Equal([]TimeseriesPoint{
+			{Date: "2021-01-03", Value: 3},
+			{Date: "2021-01-04", Value: 4},
+			{Date: "2021-01-05", Value: 0},
+		}, req.Points(daily))
+
+		req = TimeseriesURL{Product: "urbs", Metric: "assignments", From: "2021-01-03", To: "2021-01-11", Granularity: "week"}
+		assert.Nil(req.Validate())
+		assert.Equal([]TimeseriesPoint{
+			{Date: "2020-12-28", Value: 3},
+			{Date: "2021-01-04", Value: 14},
+			{Date: "2021-01-11", Value: 11},
+		}, req.Points(daily))
+
+		req = TimeseriesURL{Product: "urbs", Metric: "active_users", From: "2020-12-31", To: "2021-01-10", Granularity: "month"}
+		assert.Nil(req.Validate())
+		assert.Equal([]TimeseriesPoint{
+			{Date: "2020-12-01", Value: 0},
+			{Date: "2021-01-01", Value: 1}, // (3 + 4 + 10) / 10
+		}, req.Points(daily))
+	})
+}
@@ -1,6 +1,8 @@
 package tpl
 
 import (
+	"time"
+
 	"github.com/teambition/gear"
 	"github.com/teambition/urbs-setting/src/schema"
 )
@@ -51,3 +53,38 @@ func (t *ApplyRulesBody) Validate() error {
 	}
 	return nil
 }
+
+// UsersPurgeInfo 不活跃用户清理报告
+type UsersPurgeInfo struct {
+	Enabled   bool      `json:"enabled"`   // 是否开启了后台清理任务
+	Archive   bool      `json:"archive"`   // 清理前是否归档
+	Retention string    `json:"retention"` // 用户不活跃的保留时长
+	Before    time.Time `json:"before"`    // 最近活跃时间和创建时间都早于该时间的用户将被清理
+	Users     int64     `json:"users"`     // 待清理的用户数
+	Labels    int64     `json:"labels"`    // 待清理的用户环境标签关系数
+	Settings  int64     `json:"settings"`  // 待清理的用户配置项关系数
+	Groups    int64     `json:"groups"`    // 待清理的用户群组关系数
+	Samples   []string  `json:"samples"`   // 部分待清理用户的 uid
+}
+
+// UsersPurgeInfoRes ...
+type UsersPurgeInfoRes struct {
+	SuccessResponseType
+	Result UsersPurgeInfo `json:"result"`
+}
+
+// UsersPurgeURL ...
+type UsersPurgeURL struct {
+	Retention string `json:"retention" query:"retention"` // 可选，预览指定保留时长下的清理结果，默认使用配置
+}
+
+// Validate 实现 gear.BodyTemplate。
+func (t *UsersPurgeURL) Validate() error {
+	if t.Retention != "" {
+		du, err := time.ParseDuration(t.Retention)
+		if err != nil || du < 24*time.Hour {
+			return gear.ErrBadRequest.WithMsgf("invalid retention: %s, should be a duration not less than 24h", t.Retention)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package tpl
+
+import (
+	"time"
+
+	"github.com/teambition/gear"
+	"github.com/teambition/urbs-setting/src/schema"
+)
+
+// ProductLabelVersionURL ...
+type ProductLabelVersionURL struct {
+	ProductLabelURL
+	Version int64 `json:"version" param:"version"`
+}
+
+// Validate 实现 gear.BodyTemplate。
+func (t *ProductLabelVersionURL) Validate() error {
+	if t.Version <= 0 {
+		return gear.ErrBadRequest.WithMsgf("invalid version: %d", t.Version)
+	}
+	return t.ProductLabelURL.Validate()
+}
+
+// ProductModuleSettingVersionURL ...
+type ProductModuleSettingVersionURL struct {
+	ProductModuleSettingURL
+	Version int64 `json:"version" param:"version"`
+}
+
+// Validate 实现 gear.BodyTemplate。
+func (t *ProductModuleSettingVersionURL) Validate() error {
+	if t.Version <= 0 {
+		return gear.ErrBadRequest.WithMsgf("invalid version: %d", t.Version)
+	}
+	return t.ProductModuleSettingURL.Validate()
+}
+
+// VersionDiffQuery 比较两个版本，To 为 0 时与最新版本比较
+type VersionDiffQuery struct {
+	From int64 `json:"from" query:"from"`
+	To   int64 `json:"to" query:"to"`
+}
+
+// Validate 实现 gear.BodyTemplate。
+func (t *VersionDiffQuery) Validate() error {
+	if t.From <= 0 || t.To < 0 {
+		return gear.ErrBadRequest.WithMsgf("invalid versions: from %d to %d", t.From, t.To)
+	}
+	return nil
+}
+
+// ProductLabelVersionDiffURL ...
+type ProductLabelVersionDiffURL struct {
+	ProductLabelURL
+	VersionDiffQuery
+}
+
+// Validate 实现 gear.BodyTemplate。
+func (t *ProductLabelVersionDiffURL) Validate() error {
+	if err := t.VersionDiffQuery.Validate(); err != nil {
+		return err
+	}
+	return t.ProductLabelURL.Validate()
+}
+
+// ProductModuleSettingVersionDiffURL ...
+type ProductModuleSettingVersionDiffURL struct {
+	ProductModuleSettingURL
+	VersionDiffQuery
+}
+
+// Validate 实现 gear.BodyTemplate。
+func (t *ProductModuleSettingVersionDiffURL) Validate() error {
+	if err := t.VersionDiffQuery.Validate(); err != nil {
+		return err
+	}
+	return t.ProductModuleSettingURL.Validate()
+}
+
+// VersionInfo ...
+type VersionInfo struct {
+	ID        int64                     `json:"-"`
+	Version   int64                     `json:"version"`
+	Actor     string                    `json:"actor"`
+	Restored  int64                     `json:"restored"`
+	Snapshot  schema.DefinitionSnapshot `json:"snapshot"`
+	CreatedAt time.Time                 `json:"createdAt"`
+}
+
+// VersionInfoFrom ...
+func VersionInfoFrom(v schema.Version) VersionInfo {
+	return VersionInfo{
+		ID:        v.ID,
+		Version:   v.Version,
+		Actor:     v.Actor,
+		Restored:  v.Restored,
+		Snapshot:  v.GetSnapshot(),
+		CreatedAt: v.CreatedAt,
+	}
+}
+
+// VersionsInfoFrom ...
+func VersionsInfoFrom(versions []schema.Version) []VersionInfo {
+	res := make([]VersionInfo, len(versions))
+	for i, v := range versions {
+		res[i] = VersionInfoFrom(v)
+	}
+	return res
+}
+
+// VersionsInfoRes ...
+type VersionsInfoRes struct {
+	SuccessResponseType
+	Result []VersionInfo `json:"result"`
+}
+
+// VersionInfoRes ...
+type VersionInfoRes struct {
+	SuccessResponseType
+	Result VersionInfo `json:"result"`
+}
+
+// VersionDiff ...
+type VersionDiff struct {
+	From    int64                   `json:"from"`
+	To      int64                   `json:"to"`
+	Changes []schema.SnapshotChange `json:"changes"`
+}
+
+// VersionDiffRes ...
+type VersionDiffRes struct {
+	SuccessResponseType
+	Result VersionDiff `json:"result"`
+}
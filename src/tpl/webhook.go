@@ -0,0 +1,240 @@
+package tpl
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/teambition/gear"
+	"github.com/teambition/urbs-setting/src/schema"
+	"github.com/teambition/urbs-setting/src/service"
+)
+
+// WebhookBody ...
+type WebhookBody struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"` // 订阅的事件类型，为空表示订阅全部事件
+	Secret string   `json:"secret"`
+}
+
+// Validate 实现 gear.BodyTemplate。
+func (t *WebhookBody) Validate() error {
+	if err := validateWebhookURL(t.URL); err != nil {
+		return err
+	}
+	if err := validateWebhookEvents(t.Events); err != nil {
+		return err
+	}
+	if err := validateWebhookSecret(t.Secret); err != nil {
+		return err
+	}
+	return nil
+}
+
+// WebhookUpdateBody ...
+type WebhookUpdateBody struct {
+	URL    *string   `json:"url"`
+	Events *[]string `json:"events"`
+	Secret *string   `json:"secret"`
+}
+
+// Validate 实现 gear.BodyTemplate。
+func (t *WebhookUpdateBody) Validate() error {
+	if t.URL == nil && t.Events == nil && t.Secret == nil {
+		return gear.ErrBadRequest.WithMsgf("url or events or secret required")
+	}
+	if t.URL != nil {
+		if err := validateWebhookURL(*t.URL); err != nil {
+			return err
+		}
+	}
+	if t.Events != nil {
+		if err := validateWebhookEvents(*t.Events); err != nil {
+			return err
+		}
+	}
+	if t.Secret != nil {
+		if err := validateWebhookSecret(*t.Secret); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ToMap ...
+func (t *WebhookUpdateBody) ToMap() map[string]interface{} {
+	changed := make(map[string]interface{})
+	if t.URL != nil {
+		changed["url"] = *t.URL
+	}
+	if t.Events != nil {
+		changed["events"] = strings.Join(*t.Events, ",")
+	}
+	if t.Secret != nil {
+		changed["secret"] = *t.Secret
+	}
+	return changed
+}
+
+func validateWebhookURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil || len(s) > 1022 || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return gear.ErrBadRequest.WithMsgf("invalid webhook url: %s", s)
+	}
+	return nil
+}
+
+func validateWebhookEvents(events []string) error {
+	if !SortStringsAndCheck(events) {
+		return gear.ErrBadRequest.WithMsgf("invalid events: %v", events)
+	}
+	for _, event := range events {
+		if !StringSliceHas(schema.WebhookEvents, event) {
+			return gear.ErrBadRequest.WithMsgf("invalid event: %s", event)
+		}
+	}
+	return nil
+}
+
+func validateWebhookSecret(secret string) error {
+	if len(secret) < 8 || len(secret) > 255 {
+		return gear.ErrBadRequest.WithMsgf("invalid secret length: %d (8 ~ 255)", len(secret))
+	}
+	return nil
+}
+
+// ProductWebhookURL ...
+type ProductWebhookURL struct {
+	ProductPaginationURL
+	HID string `json:"hid" param:"hid"`
+}
+
+// Validate 实现 gear.BodyTemplate。
+func (t *ProductWebhookURL) Validate() error {
+	if !validHIDReg.MatchString(t.HID) {
+		return gear.ErrBadRequest.WithMsgf("invalid hid: %s", t.HID)
+	}
+	return t.ProductPaginationURL.Validate()
+}
+
+// ProductWebhookDeliveryURL ...
+type ProductWebhookDeliveryURL struct {
+	ProductWebhookURL
+	Delivery string `json:"delivery" param:"delivery"`
+}
+
+// Validate 实现 gear.BodyTemplate。
+func (t *ProductWebhookDeliveryURL) Validate() error {
+	if !validHIDReg.MatchString(t.Delivery) {
+		return gear.ErrBadRequest.WithMsgf("invalid delivery hid: %s", t.Delivery)
+	}
+	return t.ProductWebhookURL.Validate()
+}
+
+// WebhookEvent 投递给 webhook 的事件内容
+type WebhookEvent struct {
+	Event     string      `json:"event"`
+	Product   string      `json:"product"`
+	Data      interface{} `json:"data"`
+	Timestamp int64       `json:"timestamp"` // 事件发生时间，1970 以来的秒数
+}
+
+// WebhookInfo ...
+type WebhookInfo struct {
+	ID        int64     `json:"-"`
+	HID       string    `json:"hid"`
+	Product   string    `json:"product"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// WebhookInfoFrom 转换 webhook，不返回 secret
+func WebhookInfoFrom(webhook schema.Webhook, product string) WebhookInfo {
+	return WebhookInfo{
+		ID:        webhook.ID,
+		HID:       service.IDToHID(webhook.ID, "webhook"),
+		Product:   product,
+		URL:       webhook.URL,
+		Events:    StringToSlice(webhook.Events),
+		CreatedAt: webhook.CreatedAt,
+		UpdatedAt: webhook.UpdatedAt,
+	}
+}
+
+// WebhooksInfoFrom ...
+func WebhooksInfoFrom(webhooks []schema.Webhook, product string) []WebhookInfo {
+	res := make([]WebhookInfo, len(webhooks))
+	for i, w := range webhooks {
+		res[i] = WebhookInfoFrom(w, product)
+	}
+	return res
+}
+
+// WebhooksInfoRes ...
+type WebhooksInfoRes struct {
+	SuccessResponseType
+	Result []WebhookInfo `json:"result"`
+}
+
+// WebhookInfoRes ...
+type WebhookInfoRes struct {
+	SuccessResponseType
+	Result WebhookInfo `json:"result"`
+}
+
+// WebhookDeliveryInfo ...
+type WebhookDeliveryInfo struct {
+	ID          int64      `json:"-"`
+	HID         string     `json:"hid"`
+	Webhook     string     `json:"webhook"`
+	Event       string     `json:"event"`
+	Payload     string     `json:"payload"`
+	Status      string     `json:"status"`
+	Attempts    int        `json:"attempts"`
+	Code        int        `json:"code"`
+	Message     string     `json:"message"`
+	NextAt      time.Time  `json:"nextAt"`
+	DeliveredAt *time.Time `json:"deliveredAt"`
+	CreatedAt   time.Time  `json:"createdAt"`
+}
+
+// WebhookDeliveryInfoFrom ...
+func WebhookDeliveryInfoFrom(delivery schema.WebhookDelivery) WebhookDeliveryInfo {
+	return WebhookDeliveryInfo{
+		ID:          delivery.ID,
+		HID:         service.IDToHID(delivery.ID, "webhook_delivery"),
+		Webhook:     service.IDToHID(delivery.WebhookID, "webhook"),
+		Event:       delivery.Event,
+		Payload:     delivery.Payload,
+		Status:      delivery.Status,
+		Attempts:    delivery.Attempts,
+		Code:        delivery.Code,
+		Message:     delivery.Message,
+		NextAt:      delivery.NextAt,
+		DeliveredAt: delivery.DeliveredAt,
+		CreatedAt:   delivery.CreatedAt,
+	}
+}
+
+// WebhookDeliveriesInfoFrom ...
+func WebhookDeliveriesInfoFrom(deliveries []schema.WebhookDelivery) []WebhookDeliveryInfo {
+	res := make([]WebhookDeliveryInfo, len(deliveries))
+	for i, d := range deliveries {
+		res[i] = WebhookDeliveryInfoFrom(d)
+	}
+	return res
+}
+
+// WebhookDeliveriesInfoRes ...
+type WebhookDeliveriesInfoRes struct {
+	SuccessResponseType
+	Result []WebhookDeliveryInfo `json:"result"`
+}
+
+// WebhookDeliveryInfoRes ...
+type WebhookDeliveryInfoRes struct {
+	SuccessResponseType
+	Result WebhookDeliveryInfo `json:"result"`
+}
@@ -0,0 +1,145 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"go.opentelemetry.io/otel/label"
+	"go.opentelemetry.io/otel/semconv"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// DB 为 *sql.DB 上执行的每条语句创建 span，实现 goqu.SQLDatabase。
+// 事务中的语句需使用 NewTx 包装 BeginTx 返回的 *sql.Tx
+type DB struct {
+	*sql.DB
+	instance string
+}
+
+// NewDB 包装 db，instance 为连接池名称，如 primary 或 read
+func NewDB(db *sql.DB, instance string) *DB {
+	return &DB{DB: db, instance: instance}
+}
+
+// ExecContext ...
+func (d *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := startStatement(ctx, d.instance, query)
+	res, err := d.DB.ExecContext(ctx, query, args...)
+	End(span, err)
+	return res, err
+}
+
+// PrepareContext ...
+func (d *DB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	ctx, span := startStatement(ctx, d.instance, query)
+	stmt, err := d.DB.PrepareContext(ctx, query)
+	End(span, err)
+	return stmt, err
+}
+
+// QueryContext span 在返回结果时结束，不包括读取 rows 的耗时
+func (d *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := startStatement(ctx, d.instance, query)
+	rows, err := d.DB.QueryContext(ctx, query, args...)
+	End(span, err)
+	return rows, err
+}
+
+// QueryRowContext ...
+func (d *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := startStatement(ctx, d.instance, query)
+	row := d.DB.QueryRowContext(ctx, query, args...)
+	span.End()
+	return row
+}
+
+// Tx 为事务中执行的每条语句创建 span，实现 goqu.SQLTx
+type Tx struct {
+	*sql.Tx
+	instance string
+}
+
+// NewTx 包装 tx，instance 为连接池名称
+func NewTx(tx *sql.Tx, instance string) *Tx {
+	return &Tx{Tx: tx, instance: instance}
+}
+
+// ExecContext ...
+func (t *Tx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := startStatement(ctx, t.instance, query)
+	res, err := t.Tx.ExecContext(ctx, query, args...)
+	End(span, err)
+	return res, err
+}
+
+// PrepareContext ...
+func (t *Tx) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	ctx, span := startStatement(ctx, t.instance, query)
+	stmt, err := t.Tx.PrepareContext(ctx, query)
+	End(span, err)
+	return stmt, err
+}
+
+// QueryContext ...
+func (t *Tx) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := startStatement(ctx, t.instance, query)
+	rows, err := t.Tx.QueryContext(ctx, query, args...)
+	End(span, err)
+	return rows, err
+}
+
+// QueryRowContext ...
+func (t *Tx) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := startStatement(ctx, t.instance, query)
+	row := t.Tx.QueryRowContext(ctx, query, args...)
+	span.End()
+	return row
+}
+
+// startStatement span 名称为语句的操作和主表，如 SELECT urbs_setting。
+// goqu 默认将参数内联到语句中，语句可能包含 uid、配置值和密钥等数据，因此 db.statement 也只记录操作和主表
+func startStatement(ctx context.Context, instance, query string) (context.Context, oteltrace.Span) {
+	operation, table := parseStatement(query)
+	name := operation
+	if table != "" {
+		name += " " + table
+	}
+	return StartChild(ctx, name,
+		semconv.DBSystemMySQL,
+		label.String("db.instance", instance),
+		semconv.DBOperationKey.String(operation),
+		label.String("db.sql.table", table),
+		semconv.DBStatementKey.String(name),
+	)
+}
+
+// parseStatement 返回语句的操作和第一个表名，如 "SELECT * FROM `urbs_label` WHERE ..." 返回 SELECT 和 urbs_label
+func parseStatement(query string) (operation, table string) {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return "", ""
+	}
+	operation = strings.ToUpper(fields[0])
+
+	keyword := ""
+	switch operation {
+	case "SELECT", "DELETE":
+		keyword = "FROM"
+	case "INSERT", "REPLACE":
+		keyword = "INTO"
+	case "UPDATE":
+		if len(fields) > 1 {
+			table = fields[1]
+		}
+	}
+	if keyword != "" {
+		for i, f := range fields[:len(fields)-1] {
+			if strings.EqualFold(f, keyword) {
+				table = fields[i+1]
+				break
+			}
+		}
+	}
+	return operation, strings.Trim(table, "`(),")
+}
@@ -0,0 +1,122 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp"
+	"go.opentelemetry.io/otel/exporters/stdout"
+	"go.opentelemetry.io/otel/label"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/export/trace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/semconv"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// tracing 模块只引入官方库、goqu 和 OpenTelemetry，以便 util、model 等模块都可以引入
+
+const instrumentationName = "github.com/teambition/urbs-setting"
+
+// 支持的 span 导出方式
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+// Options 追踪配置
+type Options struct {
+	ServiceName    string
+	ServiceVersion string
+	Exporter       string  // 为空或 none 时不导出 span，stdout 输出到标准输出，otlp 通过 gRPC 发送到 OTLP collector
+	Endpoint       string  // OTLP collector 地址
+	Insecure       bool    // OTLP 不使用 TLS
+	SampleRatio    float64 // 根 span 的采样率，有上游 traceparent 时跟随上游的采样决定
+}
+
+func init() {
+	// 未启用导出时也透传 W3C traceparent 和 baggage
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+}
+
+// Init 设置全局 TracerProvider，返回在服务退出时导出剩余 span 的函数
+func Init(opts Options) (func(context.Context) error, error) {
+	var exporter trace.SpanExporter
+	var err error
+	switch opts.Exporter {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exporter, err = stdout.NewExporter(stdout.WithWriter(os.Stdout), stdout.WithoutMetricExport())
+	case ExporterOTLP:
+		o := []otlp.ExporterOption{}
+		if opts.Endpoint != "" {
+			o = append(o, otlp.WithAddress(opts.Endpoint))
+		}
+		if opts.Insecure {
+			o = append(o, otlp.WithInsecure())
+		}
+		exporter, err = otlp.NewExporter(o...)
+	default:
+		err = fmt.Errorf("unsupported tracing exporter: %q", opts.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithConfig(sdktrace.Config{
+			DefaultSampler: sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio)),
+		}),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.ServiceNameKey.String(opts.ServiceName),
+			semconv.ServiceVersionKey.String(opts.ServiceVersion),
+		)),
+		sdktrace.WithBatcher(exporter),
+	)
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// Start 创建 span，ctx 中有 span 时作为其子 span
+func Start(ctx context.Context, name string, opts ...oteltrace.SpanOption) (context.Context, oteltrace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, opts...)
+}
+
+// StartChild 仅在 ctx 中有记录中的 span 时创建子 span，否则返回不记录的 span，
+// 用于 SQL 语句等细粒度操作，避免心跳等没有上层 span 的操作产生大量根 span
+func StartChild(ctx context.Context, name string, attrs ...label.KeyValue) (context.Context, oteltrace.Span) {
+	if !oteltrace.SpanFromContext(ctx).IsRecording() {
+		return ctx, oteltrace.SpanFromContext(context.Background())
+	}
+	return Start(ctx, name, oteltrace.WithAttributes(attrs...))
+}
+
+// StartLinked 在 ctx 上创建新的根 span，并链接到 parent 中的 span，
+// 用于生命周期超出请求的后台任务，使任务可以追溯到创建它的请求
+func StartLinked(parent, ctx context.Context, name string, attrs ...label.KeyValue) (context.Context, oteltrace.Span) {
+	opts := []oteltrace.SpanOption{oteltrace.WithNewRoot(), oteltrace.WithAttributes(attrs...)}
+	if sc := oteltrace.SpanContextFromContext(parent); sc.IsValid() {
+		opts = append(opts, oteltrace.WithLinks(oteltrace.Link{SpanContext: sc}))
+	}
+	return Start(ctx, name, opts...)
+}
+
+// End 结束 span，err 不为 nil 时记录错误
+func End(span oteltrace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Detach 返回只携带 ctx 中 span 的 context，ctx 结束时不会被取消，用于不应随请求取消的操作
+func Detach(ctx context.Context) context.Context {
+	return oteltrace.ContextWithSpan(context.Background(), oteltrace.SpanFromContext(ctx))
+}
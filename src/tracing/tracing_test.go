@@ -0,0 +1,116 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/label"
+	"go.opentelemetry.io/otel/oteltest"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+func TestTracing(t *testing.T) {
+	sr := new(oteltest.StandardSpanRecorder)
+	otel.SetTracerProvider(oteltest.NewTracerProvider(oteltest.WithSpanRecorder(sr)))
+	defer otel.SetTracerProvider(oteltrace.NewNoopTracerProvider())
+
+	t.Run("StartChild should only work with a recording parent", func(t *testing.T) {
+		assert := assert.New(t)
+
+		ctx, span := StartChild(context.Background(), "SELECT urbs_user")
+		assert.False(span.IsRecording())
+		assert.False(oteltrace.SpanFromContext(ctx).IsRecording())
+
+		ctx, parent := Start(context.Background(), "GET /v1/users/:uid")
+		_, span = StartChild(ctx, "SELECT urbs_user", label.String("db.instance", "primary"))
+		assert.True(span.IsRecording())
+		End(span, errors.New("some error"))
+		End(parent, nil)
+
+		s := span.(*oteltest.Span)
+		assert.Equal(parent.SpanContext().SpanID, s.ParentSpanID())
+		assert.Equal(codes.Error, s.StatusCode())
+		assert.Equal("primary", s.Attributes()["db.instance"].AsString())
+	})
+
+	t.Run("startStatement should not record literal values", func(t *testing.T) {
+		assert := assert.New(t)
+
+		ctx, parent := Start(context.Background(), "GET /v1/users/:uid")
+		_, span := startStatement(ctx, "read", "SELECT `id` FROM `urbs_user` WHERE (`uid` = 'secret-uid') LIMIT 1")
+		End(span, nil)
+		End(parent, nil)
+
+		s := span.(*oteltest.Span)
+		assert.Equal("SELECT urbs_user", s.Name())
+		assert.Equal("SELECT urbs_user", s.Attributes()["db.statement"].AsString())
+		assert.Equal("urbs_user", s.Attributes()["db.sql.table"].AsString())
+		for _, v := range s.Attributes() {
+			assert.NotContains(v.Emit(), "secret-uid")
+		}
+	})
+
+	t.Run("StartLinked should link to parent", func(t *testing.T) {
+		assert := assert.New(t)
+
+		ctx, parent := Start(context.Background(), "POST /v1/users:import")
+		_, span := StartLinked(ctx, context.Background(), "task bll.(*Import).start")
+		End(span, nil)
+		End(parent, nil)
+
+		s := span.(*oteltest.Span)
+		assert.False(s.ParentSpanID().IsValid())
+		assert.Equal(1, len(s.Links()))
+		_, ok := s.Links()[parent.SpanContext()]
+		assert.True(ok)
+	})
+
+	t.Run("Detach should keep span but not cancellation", func(t *testing.T) {
+		assert := assert.New(t)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		ctx, span := Start(ctx, "GET /users/:uid/labels:cache")
+		cancel()
+		dctx := Detach(ctx)
+		assert.Nil(dctx.Err())
+		assert.Equal(span.SpanContext(), oteltrace.SpanContextFromContext(dctx))
+		End(span, nil)
+	})
+
+	t.Run("Init should validate exporter", func(t *testing.T) {
+		assert := assert.New(t)
+
+		shutdown, err := Init(Options{Exporter: ExporterNone})
+		assert.Nil(err)
+		assert.Nil(shutdown(context.Background()))
+
+		_, err = Init(Options{Exporter: "zipkin"})
+		assert.NotNil(err)
+	})
+}
+
+func TestParseStatement(t *testing.T) {
+	assert := assert.New(t)
+
+	cases := []struct {
+		query, operation, table string
+	}{
+		{"SELECT `id` FROM `urbs_product` WHERE (`name` = 'urbs') LIMIT 1", "SELECT", "urbs_product"},
+		{"select count(*) from `user_label` AS `t1`", "SELECT", "user_label"},
+		{"INSERT INTO `urbs_lock` (`expire_at`, `name`) VALUES ('2021-01-01', 'key')", "INSERT", "urbs_lock"},
+		{"INSERT IGNORE INTO `user_group` (`group_id`) VALUES (1)", "INSERT", "user_group"},
+		{"UPDATE `urbs_label` SET `status`=1", "UPDATE", "urbs_label"},
+		{"DELETE FROM `urbs_lock` WHERE (`name` = 'key')", "DELETE", "urbs_lock"},
+		{"SELECT 1", "SELECT", ""},
+		{"", "", ""},
+	}
+	for _, c := range cases {
+		operation, table := parseStatement(c.query)
+		assert.Equal(c.operation, operation, c.query)
+		assert.Equal(c.table, table, c.query)
+	}
+}
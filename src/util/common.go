@@ -1,5 +1,10 @@
 package util
 
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
 // StringSliceHas ...
 func StringSliceHas(sl []string, v string) bool {
 	for _, s := range sl {
@@ -9,3 +14,12 @@ func StringSliceHas(sl []string, v string) bool {
 	}
 	return false
 }
+
+// RandToken 返回 16 字节随机数的十六进制字符串，用于标识锁的持有者等
+func RandToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic("crypto-go: rand.Read() failed, " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,60 @@
+package util
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimiter 按 key 分别计数的令牌桶限流器，key 数量有上限，长期不活跃的 key 会被淘汰
+type RateLimiter struct {
+	mu      sync.Mutex
+	rate    float64 // 每秒生成的令牌数
+	burst   float64 // 令牌桶容量
+	buckets *TTLCache
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter 创建 RateLimiter，rate 为每秒允许的请求数，burst 为允许的突发请求数，max 为最多跟踪的 key 数量。
+// rate <= 0 时返回 nil，表示不限流。
+func NewRateLimiter(rate float64, burst, max int) *RateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	// 令牌桶补满后与新建的桶等价，之后可以淘汰
+	ttl := time.Duration(float64(burst)/rate*float64(time.Second)) + time.Second
+	return &RateLimiter{rate: rate, burst: float64(burst), buckets: NewTTLCache(ttl, max)}
+}
+
+// Allow 消耗 key 对应令牌桶中的一个令牌，令牌不足时返回 false 和需要等待的时间。
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	b := &tokenBucket{tokens: l.burst, last: now}
+	if val, ok := l.buckets.Get(key); ok {
+		b = val.(*tokenBucket)
+		b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+		b.last = now
+	}
+	// 每次访问都刷新有效期，避免活跃的 key 过期后被重置为满桶
+	l.buckets.Set(key, b)
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
@@ -0,0 +1,42 @@
+package util
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	t.Run("nil RateLimiter should allow all", func(t *testing.T) {
+		assert := assert.New(t)
+
+		l := NewRateLimiter(0, 10, 10)
+		assert.Nil(l)
+		ok, wait := l.Allow("a")
+		assert.True(ok)
+		assert.Equal(time.Duration(0), wait)
+	})
+
+	t.Run("RateLimiter should limit by key", func(t *testing.T) {
+		assert := assert.New(t)
+
+		l := NewRateLimiter(10, 2, 10)
+		ok, _ := l.Allow("a")
+		assert.True(ok)
+		ok, _ = l.Allow("a")
+		assert.True(ok)
+		ok, wait := l.Allow("a")
+		assert.False(ok)
+		assert.True(wait > 0 && wait <= 100*time.Millisecond)
+
+		ok, _ = l.Allow("b")
+		assert.True(ok)
+
+		time.Sleep(110 * time.Millisecond)
+		ok, _ = l.Allow("a")
+		assert.True(ok)
+		ok, _ = l.Allow("a")
+		assert.False(ok)
+	})
+}
@@ -0,0 +1,34 @@
+package util
+
+// Semaphore 限制并发数的信号量
+type Semaphore struct {
+	ch chan struct{}
+}
+
+// NewSemaphore 创建 Semaphore，n 为最大并发数
+func NewSemaphore(n int) *Semaphore {
+	if n <= 0 {
+		n = 1
+	}
+	return &Semaphore{ch: make(chan struct{}, n)}
+}
+
+// TryAcquire 尝试获取许可，已达最大并发数时立即返回 false
+func (s *Semaphore) TryAcquire() bool {
+	select {
+	case s.ch <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// Release 释放许可
+func (s *Semaphore) Release() {
+	<-s.ch
+}
+
+// InUse 返回正在使用的许可数
+func (s *Semaphore) InUse() int {
+	return len(s.ch)
+}
@@ -0,0 +1,24 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSemaphore(t *testing.T) {
+	t.Run("Semaphore should work", func(t *testing.T) {
+		assert := assert.New(t)
+
+		s := NewSemaphore(2)
+		assert.True(s.TryAcquire())
+		assert.True(s.TryAcquire())
+		assert.False(s.TryAcquire())
+		assert.Equal(2, s.InUse())
+		s.Release()
+		assert.True(s.TryAcquire())
+		s.Release()
+		s.Release()
+		assert.Equal(0, s.InUse())
+	})
+}
@@ -0,0 +1,94 @@
+package util
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// TTLCache 并发安全、有容量上限的 TTL 缓存，容量满时淘汰最久未使用的数据
+type TTLCache struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	max   int
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type ttlEntry struct {
+	key      string
+	val      interface{}
+	expireAt time.Time
+}
+
+// NewTTLCache 创建 TTLCache，ttl 为数据有效期，max 为最大数据条数
+func NewTTLCache(ttl time.Duration, max int) *TTLCache {
+	if max <= 0 {
+		max = 1
+	}
+	return &TTLCache{ttl: ttl, max: max, ll: list.New(), items: make(map[string]*list.Element)}
+}
+
+// Get 返回 key 对应的有效数据
+func (c *TTLCache) Get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ele, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := ele.Value.(*ttlEntry)
+	if time.Now().After(entry.expireAt) {
+		c.removeElement(ele)
+		return nil, false
+	}
+	c.ll.MoveToFront(ele)
+	return entry.val, true
+}
+
+// Set 添加或更新 key 对应的数据
+func (c *TTLCache) Set(key string, val interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expireAt := time.Now().Add(c.ttl)
+	if ele, ok := c.items[key]; ok {
+		entry := ele.Value.(*ttlEntry)
+		entry.val = val
+		entry.expireAt = expireAt
+		c.ll.MoveToFront(ele)
+		return
+	}
+	c.items[key] = c.ll.PushFront(&ttlEntry{key: key, val: val, expireAt: expireAt})
+	for c.ll.Len() > c.max {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+// Delete 删除 key 对应的数据
+func (c *TTLCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if ele, ok := c.items[key]; ok {
+		c.removeElement(ele)
+	}
+}
+
+// Purge 清空缓存
+func (c *TTLCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ll.Init()
+	c.items = make(map[string]*list.Element)
+}
+
+// Len 返回缓存的数据条数，包括已过期但未清理的数据
+func (c *TTLCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+func (c *TTLCache) removeElement(ele *list.Element) {
+	c.ll.Remove(ele)
+	delete(c.items, ele.Value.(*ttlEntry).key)
+}
@@ -0,0 +1,56 @@
+package util
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTTLCache(t *testing.T) {
+	t.Run("TTLCache should work", func(t *testing.T) {
+		assert := assert.New(t)
+
+		c := NewTTLCache(time.Minute, 2)
+		_, ok := c.Get("a")
+		assert.False(ok)
+
+		c.Set("a", int64(1))
+		c.Set("b", int64(2))
+		val, ok := c.Get("a")
+		assert.True(ok)
+		assert.Equal(int64(1), val)
+		assert.Equal(2, c.Len())
+
+		c.Set("c", int64(3)) // b 最久未使用，被淘汰
+		assert.Equal(2, c.Len())
+		_, ok = c.Get("b")
+		assert.False(ok)
+		_, ok = c.Get("a")
+		assert.True(ok)
+
+		c.Delete("a")
+		_, ok = c.Get("a")
+		assert.False(ok)
+
+		c.Purge()
+		assert.Equal(0, c.Len())
+		_, ok = c.Get("c")
+		assert.False(ok)
+	})
+
+	t.Run("TTLCache should expire", func(t *testing.T) {
+		assert := assert.New(t)
+
+		c := NewTTLCache(10*time.Millisecond, 10)
+		c.Set("a", "x")
+		val, ok := c.Get("a")
+		assert.True(ok)
+		assert.Equal("x", val)
+
+		time.Sleep(20 * time.Millisecond)
+		_, ok = c.Get("a")
+		assert.False(ok)
+		assert.Equal(0, c.Len())
+	})
+}
@@ -2,15 +2,87 @@ package util
 
 import (
 	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/teambition/urbs-setting/src/metrics"
+	"github.com/teambition/urbs-setting/src/tracing"
+	"go.opentelemetry.io/otel/label"
 )
 
-// Go ...
-func Go(du time.Duration, fn func(context.Context)) {
+// Go 在后台执行 fn，du 为 fn 的最长执行时间。fn 的耗时、panic 和超时记录到 urbs_task_duration_seconds 指标，
+// 任务名为 fn 所在的函数，如 model.(*Group).BatchAddMembers；fn panic 时记录到 stderr，不会导致进程退出。
+// parent 为创建任务的请求或任务的 context，只用于将任务的 span 链接到其 span，parent 结束不会取消 fn
+func Go(parent context.Context, du time.Duration, fn func(context.Context)) {
 	ctx, cancel := context.WithTimeout(context.Background(), du)
+	task := taskName(fn)
+	ctx, span := tracing.StartLinked(parent, ctx, "task "+task, label.String("task", task))
 
 	go func() {
+		start := time.Now()
+		result := "ok"
+		defer func() {
+			var err error
+			if r := recover(); r != nil {
+				result = "failed"
+				err = fmt.Errorf("panic: %v", r)
+				fmt.Fprintf(os.Stderr, "util.Go: task %s panic: %v\n%s", task, r, debug.Stack())
+			} else if ctx.Err() == context.DeadlineExceeded {
+				result = "timeout"
+				err = ctx.Err()
+			}
+			cancel()
+			tracing.End(span, err)
+			metrics.TaskDuration.WithLabelValues(task, result).Observe(time.Since(start).Seconds())
+		}()
 		fn(ctx)
-		cancel()
 	}()
 }
+
+const modulePrefix = "github.com/teambition/urbs-setting/src/"
+
+var taskNames sync.Map // map[uintptr]string
+
+// taskName 返回 fn 所在的函数名，去掉模块路径和匿名函数后缀
+func taskName(fn func(context.Context)) string {
+	pc := reflect.ValueOf(fn).Pointer()
+	if name, ok := taskNames.Load(pc); ok {
+		return name.(string)
+	}
+
+	name := "unknown"
+	if f := runtime.FuncForPC(pc); f != nil {
+		name = strings.TrimPrefix(f.Name(), modulePrefix)
+		// 匿名函数名如 model.(*Group).BatchAddMembers.func1 或 bll.(*User).StartPurgeJob.func1.1
+		for {
+			i := strings.LastIndexByte(name, '.')
+			if i < 0 || !isAnonymousSuffix(name[i+1:]) {
+				break
+			}
+			name = name[:i]
+		}
+	}
+	taskNames.Store(pc, name)
+	return name
+}
+
+func isAnonymousSuffix(s string) bool {
+	if strings.HasPrefix(s, "func") {
+		s = s[4:]
+	}
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,41 @@
+package util
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/teambition/urbs-setting/src/metrics"
+)
+
+func TestGo(t *testing.T) {
+	t.Run("taskName should work", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.Equal("util.TestGo", taskName(func(context.Context) {}))
+		assert.True(isAnonymousSuffix("func12"))
+		assert.True(isAnonymousSuffix("3"))
+		assert.False(isAnonymousSuffix("func"))
+		assert.False(isAnonymousSuffix("BatchAdd"))
+	})
+
+	t.Run("Go should record duration, panic and timeout", func(t *testing.T) {
+		assert := assert.New(t)
+
+		Go(context.Background(), time.Second, func(context.Context) {})
+		Go(context.Background(), time.Second, func(context.Context) {
+			panic("some error")
+		})
+		Go(context.Background(), 10*time.Millisecond, func(ctx context.Context) {
+			<-ctx.Done()
+		})
+
+		// ok、failed、timeout 三个结果各一个时间序列
+		for i := 0; i < 50 && testutil.CollectAndCount(metrics.TaskDuration) < 3; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		assert.Equal(3, testutil.CollectAndCount(metrics.TaskDuration))
+	})
+}